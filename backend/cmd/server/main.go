@@ -1,20 +1,43 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/anilist"
 	"github.com/streambox/backend/internal/api"
+	"github.com/streambox/backend/internal/cast"
 	"github.com/streambox/backend/internal/config"
 	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/debrid"
+	"github.com/streambox/backend/internal/episodes"
+	"github.com/streambox/backend/internal/ffmpeg"
 	"github.com/streambox/backend/internal/hdrezka"
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/images"
+	"github.com/streambox/backend/internal/kinopoisk"
+	"github.com/streambox/backend/internal/metrics"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/notify"
+	"github.com/streambox/backend/internal/omdb"
 	"github.com/streambox/backend/internal/stream"
 	"github.com/streambox/backend/internal/subtitle"
+	"github.com/streambox/backend/internal/telegram"
 	"github.com/streambox/backend/internal/tmdb"
 	"github.com/streambox/backend/internal/torrent"
+	"github.com/streambox/backend/internal/trakt"
 )
 
+// shutdownTimeout bounds how long in-flight requests may take to finish on
+// SIGINT/SIGTERM.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
@@ -27,42 +50,323 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to create torrent directory")
 	}
 
-	database, err := db.New(cfg.DBPath)
+	database, err := db.Open(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to initialize database")
 	}
-	defer database.Close()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateCommand(database, os.Args[2:])
+		return
+	}
+
+	// Shared outbound HTTP settings; each integration applies its own default
+	// timeout when HTTP_TIMEOUT_SEC is not set.
+	httpOpts := httpclient.Options{
+		Timeout:    time.Duration(cfg.HTTPTimeoutSec) * time.Second,
+		MaxRetries: cfg.HTTPMaxRetries,
+		ProxyURL:   cfg.HTTPProxy,
+		UserAgent:  cfg.HTTPUserAgent,
+	}
 
-	tmdbClient := tmdb.NewClient(cfg.TMDBAPIKey)
+	tmdbClient := tmdb.NewClient(cfg.TMDBAPIKey, httpOpts)
+	notifier := newNotifier(cfg, httpOpts)
+
+	var kinopoiskClient *kinopoisk.Client
+	if cfg.KinopoiskAPIKey != "" {
+		kinopoiskClient = kinopoisk.NewClient(cfg.KinopoiskAPIKey, providerHTTPOptions(cfg, httpOpts, "kinopoisk"))
+		log.Info().Msg("kinopoisk enrichment enabled")
+	}
+
+	var omdbClient *omdb.Client
+	if cfg.OMDbAPIKey != "" {
+		omdbClient = omdb.NewClient(cfg.OMDbAPIKey, database, httpOpts)
+		log.Info().Msg("omdb ratings enabled")
+	}
 
-	torrentClient, err := torrent.NewClient(cfg.TorrentDir)
+	var blocklist *torrent.Blocklist
+	if cfg.TorrentBlocklist != "" {
+		blocklist = torrent.NewBlocklist(cfg.TorrentBlocklist, httpOpts)
+	}
+	torrentClient, err := torrent.NewClient(cfg.TorrentDir, torrent.ClientOptions{
+		Proxies: torrent.ProxyOptions{
+			PeerProxy:    cfg.TorrentPeerProxy,
+			TrackerProxy: cfg.TorrentTrackerProxy,
+		},
+		Blocklist:            blocklist,
+		SeedWhileDownloading: cfg.TorrentSeedWhileStreaming,
+	})
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to initialize torrent client")
 	}
-	defer torrentClient.Close()
+	trackersURL := ""
+	if cfg.TorrentPublicTrackers {
+		trackersURL = cfg.TorrentTrackersURL
+	}
+	trackerList := torrent.NewTrackerList(cfg.TorrentExtraTrackers, trackersURL, httpOpts)
+	torrentClient.SetTrackerList(trackerList)
 
 	providers := torrent.NewProviderRegistry()
+	providers.SetCache(database, time.Duration(cfg.SearchCacheMinutes)*time.Minute)
+	providers.SetTimeout(time.Duration(cfg.SearchProviderTimeoutSec) * time.Second)
+	providers.SetBreaker(cfg.SearchBreakerFailures, time.Duration(cfg.SearchBreakerCooldownMinutes)*time.Minute)
 	if cfg.RutrackerUsername != "" && cfg.RutrackerPassword != "" {
-		rt := torrent.NewRutracker(cfg.RutrackerMirror, cfg.RutrackerUsername, cfg.RutrackerPassword)
+		rtOpts := providerHTTPOptions(cfg, httpOpts, "rutracker")
+		rtOpts.HostRateLimit = cfg.RutrackerRequestsPerSec
+		rtOpts.HostBurst = cfg.RutrackerTopicWorkers
+		rt := torrent.NewRutracker(cfg.RutrackerMirror, cfg.RutrackerUsername, cfg.RutrackerPassword, rtOpts)
+		rt.SetSessionStore(database)
+		rt.SetTopicLimits(cfg.RutrackerTopicLimit, cfg.RutrackerTopicWorkers)
 		providers.Register(rt)
 		log.Info().Msg("rutracker provider registered")
 	}
-	providers.Register(torrent.NewYTS())
+	if cfg.RutorEnabled {
+		providers.Register(torrent.NewRutor(cfg.RutorMirrors, providerHTTPOptions(cfg, httpOpts, "rutor")))
+	}
+	if cfg.KinozalUsername != "" && cfg.KinozalPassword != "" {
+		providers.Register(torrent.NewKinozal(cfg.KinozalMirrors, cfg.KinozalUsername, cfg.KinozalPassword, providerHTTPOptions(cfg, httpOpts, "kinozal")))
+		log.Info().Msg("kinozal provider registered")
+	}
+	providers.Register(torrent.NewYTS(providerHTTPOptions(cfg, httpOpts, "yts")))
+	providers.Register(torrent.NewNyaa(providerHTTPOptions(cfg, httpOpts, "nyaa")))
+	for name, target := range cfg.PluginProviders {
+		providers.Register(torrent.NewPlugin(name, target, providerHTTPOptions(cfg, httpOpts, name)))
+		log.Info().Str("provider", name).Msg("plugin provider registered")
+	}
 
-	torrentMgr := torrent.NewManager(torrentClient, database)
+	torrentMgr := torrent.NewManager(torrentClient, database, time.Duration(cfg.MetadataTimeoutSec)*time.Second)
+	torrentMgr.SetProviders(providers)
+	torrentMgr.SetStreamLimit(cfg.MaxConcurrentStreams)
+	torrentMgr.SetStartBuffer(cfg.StartBufferSec)
+	torrentMgr.StartStallWatchdog(cfg.StallFallback, time.Duration(cfg.StallFallbackMinutes)*time.Minute)
+	settings := loadSettings(cfg, database)
+	torrentMgr.SetRateLimits(settings)
+	torrentMgr.SetAudioLanguages(settings.PreferredAudioLanguages)
+	torrentMgr.SetTranscodeDefaults(models.TranscodeOptions{
+		MaxHeight:     cfg.TranscodeMaxHeight,
+		MaxBitrate:    cfg.TranscodeMaxBitrate,
+		AudioChannels: cfg.TranscodeAudioChannels,
+	})
+	torrentMgr.SetSeedPolicy(torrent.SeedPolicy{
+		WhileStreaming: cfg.TorrentSeedWhileStreaming,
+		AfterComplete:  cfg.TorrentSeedAfterComplete,
+		Ratio:          cfg.TorrentSeedRatio,
+		Minutes:        cfg.TorrentSeedMinutes,
+	})
+	torrentMgr.StartIdleReaper(time.Duration(cfg.SessionIdleTimeoutMin) * time.Minute)
+	logMediaCapabilities()
 	streamSrv := stream.NewServer(torrentMgr)
+	streamSrv.SetTranscodeLimit(cfg.MaxConcurrentTranscodes)
+	streamSrv.SetNotifier(notifier)
+	if err := streamSrv.SetCacheDir(cfg.TranscodeCacheDir, int64(cfg.TranscodeCacheGB)<<30); err != nil {
+		log.Fatal().Err(err).Msg("failed to create transcode cache directory")
+	}
+	streamSrv.SetRemuxCache(cfg.RemuxCache)
 
-	var subClient *subtitle.Client
+	subtitles := subtitle.NewRegistry()
 	if cfg.OpenSubtitlesKey != "" {
-		subClient = subtitle.NewClient(cfg.OpenSubtitlesKey)
+		subtitles.Register(subtitle.NewClient(cfg.OpenSubtitlesKey, httpOpts))
+		log.Info().Msg("opensubtitles provider registered")
+	}
+	if cfg.SubdlKey != "" {
+		subtitles.Register(subtitle.NewSubdl(cfg.SubdlKey, httpOpts))
+		log.Info().Msg("subdl provider registered")
+	}
+	streamSrv.SetSubtitles(subtitles)
+
+	var traktClient *trakt.Client
+	if cfg.TraktClientID != "" && cfg.TraktClientSecret != "" {
+		traktClient = trakt.NewClient(cfg.TraktClientID, cfg.TraktClientSecret, database, httpOpts)
+		log.Info().Msg("trakt integration enabled")
 	}
 
-	hdrezkaClient := hdrezka.NewClient()
+	hdrezkaClient := hdrezka.NewClient(providerHTTPOptions(cfg, httpOpts, "hdrezka"))
 
-	server := api.NewServer(cfg, database, tmdbClient, providers, torrentMgr, streamSrv, subClient, hdrezkaClient)
+	// Failover chain for titles whose torrent can't be started
+	for _, name := range cfg.FailoverSources {
+		switch name {
+		case "debrid":
+			if cfg.RealDebridKey != "" {
+				torrentMgr.RegisterSource(debrid.NewRealDebrid(cfg.RealDebridKey, providerHTTPOptions(cfg, httpOpts, "debrid")))
+				log.Info().Msg("real-debrid failover source registered")
+			}
+		case "hdrezka":
+			torrentMgr.RegisterSource(hdrezkaClient)
+			log.Info().Msg("hdrezka failover source registered")
+		default:
+			log.Warn().Str("source", name).Msg("unknown failover source, ignoring")
+		}
+	}
+
+	var bot *telegram.Bot
+	if cfg.TelegramBotToken != "" {
+		bot = telegram.NewBot(cfg.TelegramBotToken, cfg.TelegramAllowedChats, tmdbClient, providers, torrentMgr, httpOpts)
+		notifier.Add(bot)
+		if len(cfg.TelegramAllowedChats) == 0 {
+			log.Warn().Msg("TELEGRAM_ALLOWED_CHATS is empty: the telegram bot will only reply with each chat's ID")
+		}
+	}
+
+	torrentMgr.OnDownloadFinished(func(d models.Download) {
+		notifier.Notify(notify.Download(d))
+	})
+
+	registerMetrics(torrentClient, torrentMgr)
+
+	// Bring back sessions and downloads that were active before the last shutdown
+	torrentMgr.RestoreSessions()
+	torrentMgr.RestoreDownloads()
+
+	imageCache, err := images.NewCache(cfg.ImageCacheDir, httpOpts)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create image cache")
+	}
+	imageCache.SetMaxBytes(int64(cfg.ImageCacheMB) << 20)
+
+	server := api.NewServer(cfg, database, tmdbClient, kinopoiskClient, omdbClient, anilist.NewClient(providerHTTPOptions(cfg, httpOpts, "anilist")), providers, torrentMgr, streamSrv, subtitles, hdrezkaClient, imageCache, traktClient, cast.NewManager())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if bot != nil {
+		go bot.Run(ctx)
+	}
+	server.StartDiskMonitor(ctx, notifier)
+	episodes.NewTracker(database, tmdbClient, notifier).Start(ctx, time.Duration(cfg.EpisodeCheckHours)*time.Hour)
+	trackerList.Start(ctx, torrentClient, time.Duration(cfg.TorrentTrackersRefreshHours)*time.Hour)
+	if blocklist != nil {
+		blocklist.Start(ctx, time.Duration(cfg.TorrentBlocklistRefreshHours)*time.Hour)
+	}
+
+	log.Info().Int("port", cfg.Port).Bool("tls", cfg.TLSEnabled()).Msg("starting StreamBox server")
+	runErr := make(chan error, 1)
+	go func() { runErr <- server.Run() }()
+
+	var failed error
+	select {
+	case failed = <-runErr:
+		log.Error().Err(failed).Msg("server failed")
+	case <-ctx.Done():
+		log.Info().Msg("shutting down")
+	}
 
-	log.Info().Int("port", cfg.Port).Msg("starting StreamBox server")
-	if err := server.Run(); err != nil {
-		log.Fatal().Err(err).Msg("server failed")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Warn().Err(err).Msg("requests still running at shutdown were aborted")
+	}
+	torrentClient.Close()
+	if err := database.Close(); err != nil {
+		log.Warn().Err(err).Msg("failed to close database")
+	}
+
+	if failed != nil {
+		os.Exit(1)
+	}
+	log.Info().Msg("StreamBox stopped")
+}
+
+// loadSettings returns the runtime settings, defaulting to the config for
+// anything never changed through /api/settings.
+// migrateCommand handles `server migrate <version>`, which moves the database
+// schema to the given version, e.g. to revert migrations before going back
+// to an older release. Opening the database has already applied any newer
+// migrations.
+func migrateCommand(database *db.DB, args []string) {
+	defer database.Close()
+
+	if len(args) != 1 {
+		log.Fatal().Int("latest", db.LatestSchemaVersion()).Msg("usage: server migrate <version>")
+	}
+	version, err := strconv.Atoi(args[0])
+	if err != nil {
+		log.Fatal().Str("version", args[0]).Msg("invalid schema version")
+	}
+	if err := database.MigrateTo(version); err != nil {
+		log.Fatal().Err(err).Msg("migration failed")
+	}
+	log.Info().Int("version", version).Msg("database schema migrated")
+}
+
+func loadSettings(cfg *config.Config, database db.Store) models.Settings {
+	settings := models.Settings{
+		DownloadLimitKBps: cfg.DownloadLimitKBps,
+		UploadLimitKBps:   cfg.UploadLimitKBps,
+		SessionLimitKBps:  cfg.SessionLimitKBps,
+
+		PreferredAudioLanguages: cfg.PreferredAudioLanguages,
+	}
+	if _, err := database.GetSetting(db.SettingsKey, &settings); err != nil {
+		log.Warn().Err(err).Msg("failed to load settings, using config defaults")
+	}
+	return settings
+}
+
+// providerHTTPOptions returns the outbound HTTP options for a provider,
+// using its entry in PROVIDER_PROXIES if there is one.
+func providerHTTPOptions(cfg *config.Config, opts httpclient.Options, name string) httpclient.Options {
+	if proxy, ok := cfg.ProviderProxies[name]; ok {
+		opts.ProxyURL = proxy
+	}
+	return opts
+}
+
+// registerMetrics exposes live torrent state on /metrics.
+func registerMetrics(client *torrent.TorrentClient, mgr *torrent.Manager) {
+	metrics.NewGaugeFunc("streambox_sessions_active", "Running stream sessions.", func() float64 {
+		sessions, _ := mgr.Counts()
+		return float64(sessions)
+	})
+	metrics.NewGaugeFunc("streambox_downloads_active", "Unfinished offline downloads.", func() float64 {
+		_, downloads := mgr.Counts()
+		return float64(downloads)
+	})
+	metrics.NewCounterFunc("streambox_torrent_downloaded_bytes_total", "Torrent payload bytes downloaded from peers.", func() float64 {
+		downloaded, _ := client.DataTransferred()
+		return float64(downloaded)
+	})
+	metrics.NewCounterFunc("streambox_torrent_uploaded_bytes_total", "Torrent payload bytes uploaded to peers.", func() float64 {
+		_, uploaded := client.DataTransferred()
+		return float64(uploaded)
+	})
+}
+
+// logMediaCapabilities detects FFmpeg and warns about the features it can't
+// provide, which are turned off.
+func logMediaCapabilities() {
+	caps := ffmpeg.Capabilities()
+	if !caps.FFmpeg.Available {
+		log.Warn().Msg("ffmpeg not found: transcoding, HLS, thumbnails and subtitle extraction are disabled")
+	} else {
+		log.Info().Str("ffmpeg", caps.FFmpeg.Version).Str("ffprobe", caps.FFprobe.Version).Strs("hwaccels", caps.HWAccels).Str("hw_encoder", caps.HWEncoder).Msg("ffmpeg detected")
+	}
+	for feature, reason := range caps.Missing {
+		log.Warn().Str("feature", feature).Str("reason", reason).Msg("media feature disabled")
+	}
+}
+
+// newNotifier creates the notifier with a sink for each configured service.
+// The Telegram bot is added as another sink when enabled.
+func newNotifier(cfg *config.Config, opts httpclient.Options) *notify.Notifier {
+	events := make([]notify.EventType, len(cfg.NotifyEvents))
+	for i, e := range cfg.NotifyEvents {
+		events[i] = notify.EventType(e)
+	}
+	notifier := notify.New(events)
+
+	if cfg.NotifyWebhookURL != "" {
+		notifier.Add(notify.NewWebhook(cfg.NotifyWebhookURL, opts))
+	}
+	if cfg.NotifyDiscordURL != "" {
+		notifier.Add(notify.NewDiscord(cfg.NotifyDiscordURL, opts))
+	}
+	if cfg.NotifyGotifyURL != "" {
+		notifier.Add(notify.NewGotify(cfg.NotifyGotifyURL, cfg.NotifyGotifyToken, opts))
+	}
+	if cfg.NotifyNtfyURL != "" {
+		notifier.Add(notify.NewNtfy(cfg.NotifyNtfyURL, cfg.NotifyNtfyToken, opts))
+	}
+	if sinks := notifier.Sinks(); len(sinks) > 0 {
+		log.Info().Strs("sinks", sinks).Msg("notifications enabled")
 	}
+	return notifier
 }
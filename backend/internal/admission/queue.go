@@ -0,0 +1,128 @@
+// Package admission limits how many streams and transcodes run at once.
+// Clients turned away are queued and keep their place while they retry, so
+// slots that free up go to whoever asked first.
+package admission
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// queueTimeout drops queued clients that stopped retrying.
+const queueTimeout = 30 * time.Second
+
+// BusyError is returned when all slots are taken. Position is the client's
+// place in the queue, 1 being next.
+type BusyError struct {
+	Resource string `json:"resource"`
+	Limit    int    `json:"limit"`
+	Position int    `json:"queue_position"`
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("too many concurrent %s (limit %d), queue position %d", e.Resource, e.Limit, e.Position)
+}
+
+// Queue hands out a limited number of slots to holders, such as sessions.
+// A holder that already has a slot can take more without counting against
+// the limit again, e.g. for a session seeking in its own transcode.
+type Queue struct {
+	resource string
+	limit    int // 0 for unlimited
+
+	mu      sync.Mutex
+	holders map[string]int // slots taken by holder
+	waiting []waiter
+}
+
+type waiter struct {
+	client string
+	seen   time.Time
+}
+
+// NewQueue creates a queue for limit concurrent holders of resource (used in
+// errors); limit 0 means unlimited.
+func NewQueue(resource string, limit int) *Queue {
+	return &Queue{
+		resource: resource,
+		limit:    max(limit, 0),
+		holders:  make(map[string]int),
+	}
+}
+
+// Acquire takes a slot for holder on behalf of client (e.g. its IP address),
+// or returns a *BusyError and queues client when none is free. The returned
+// func releases the slot; calling it again is a no-op.
+func (q *Queue) Acquire(client, holder string) (release func(), err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.limit > 0 && q.holders[holder] == 0 {
+		q.prune()
+		pos := len(q.waiting) + 1
+		for i, w := range q.waiting {
+			if w.client == client {
+				pos = i + 1
+				q.waiting[i].seen = time.Now()
+				break
+			}
+		}
+		free := q.limit - len(q.holders)
+		if pos > free {
+			if pos > len(q.waiting) {
+				q.waiting = append(q.waiting, waiter{client: client, seen: time.Now()})
+			}
+			return nil, &BusyError{Resource: q.resource, Limit: q.limit, Position: pos - max(free, 0)}
+		}
+		if pos <= len(q.waiting) {
+			q.waiting = append(q.waiting[:pos-1], q.waiting[pos:]...)
+		}
+	}
+	return q.take(holder), nil
+}
+
+// Take takes a slot for holder regardless of the limit, for work that was
+// admitted before (such as a restored session) or can't be turned away.
+func (q *Queue) Take(holder string) (release func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.take(holder)
+}
+
+// Active returns the number of holders with a slot.
+func (q *Queue) Active() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.holders)
+}
+
+// Limit returns the number of holders allowed at once, 0 for unlimited.
+func (q *Queue) Limit() int {
+	return q.limit
+}
+
+func (q *Queue) take(holder string) func() {
+	q.holders[holder]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if q.holders[holder]--; q.holders[holder] <= 0 {
+				delete(q.holders, holder)
+			}
+		})
+	}
+}
+
+// prune drops clients that haven't retried within queueTimeout.
+func (q *Queue) prune() {
+	kept := q.waiting[:0]
+	for _, w := range q.waiting {
+		if time.Since(w.seen) < queueTimeout {
+			kept = append(kept, w)
+		}
+	}
+	q.waiting = kept
+}
@@ -0,0 +1,199 @@
+package anilist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+)
+
+const defaultEndpoint = "https://graphql.anilist.co"
+
+// htmlTagRe strips the markup AniList descriptions contain (<br>, <i>).
+var htmlTagRe = regexp.MustCompile(`<[^>]+>`)
+
+// Client searches anime metadata through the public AniList GraphQL API,
+// which needs no API key.
+type Client struct {
+	http     *httpclient.Client
+	endpoint string
+}
+
+func NewClient(opts httpclient.Options) *Client {
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &Client{
+		http:     httpclient.New(opts),
+		endpoint: defaultEndpoint,
+	}
+}
+
+const mediaFields = `
+	id
+	idMal
+	title { romaji english native }
+	synonyms
+	format
+	status
+	episodes
+	duration
+	seasonYear
+	averageScore
+	genres
+	description
+	coverImage { extraLarge large }
+	bannerImage
+`
+
+const searchQuery = `query ($search: String, $perPage: Int) {
+	Page(perPage: $perPage) {
+		media(search: $search, type: ANIME, sort: SEARCH_MATCH, isAdult: false) {` + mediaFields + `}
+	}
+}`
+
+const mediaQuery = `query ($id: Int) {
+	Media(id: $id, type: ANIME) {` + mediaFields + `}
+}`
+
+type media struct {
+	ID    int `json:"id"`
+	IDMal int `json:"idMal"`
+	Title struct {
+		Romaji  string `json:"romaji"`
+		English string `json:"english"`
+		Native  string `json:"native"`
+	} `json:"title"`
+	Synonyms     []string `json:"synonyms"`
+	Format       string   `json:"format"`
+	Status       string   `json:"status"`
+	Episodes     int      `json:"episodes"`
+	Duration     int      `json:"duration"`
+	SeasonYear   int      `json:"seasonYear"`
+	AverageScore int      `json:"averageScore"`
+	Genres       []string `json:"genres"`
+	Description  string   `json:"description"`
+	CoverImage   struct {
+		ExtraLarge string `json:"extraLarge"`
+		Large      string `json:"large"`
+	} `json:"coverImage"`
+	BannerImage string `json:"bannerImage"`
+}
+
+// Search returns anime matching query, best matches first.
+func (c *Client) Search(ctx context.Context, query string, limit int) ([]models.Anime, error) {
+	var data struct {
+		Page struct {
+			Media []media `json:"media"`
+		} `json:"Page"`
+	}
+	vars := map[string]any{"search": query, "perPage": limit}
+	if err := c.query(ctx, searchQuery, vars, &data); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.Anime, 0, len(data.Page.Media))
+	for _, m := range data.Page.Media {
+		results = append(results, toAnime(m))
+	}
+	return results, nil
+}
+
+// Get returns an anime by its AniList ID, or nil if there is none.
+func (c *Client) Get(ctx context.Context, id int) (*models.Anime, error) {
+	var data struct {
+		Media *media `json:"Media"`
+	}
+	if err := c.query(ctx, mediaQuery, map[string]any{"id": id}, &data); err != nil {
+		return nil, err
+	}
+	if data.Media == nil {
+		return nil, nil
+	}
+	a := toAnime(*data.Media)
+	return &a, nil
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+func (c *Client) query(ctx context.Context, query string, vars map[string]any, dest any) error {
+	body, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		return fmt.Errorf("encode anilist query: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("anilist request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []graphQLError  `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("decode anilist response (status %d): %w", resp.StatusCode, err)
+	}
+	// A missing Media is reported as a 404 error alongside null data.
+	if len(out.Errors) > 0 && !(len(out.Errors) == 1 && out.Errors[0].Status == http.StatusNotFound) {
+		return fmt.Errorf("anilist: %s", out.Errors[0].Message)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("anilist api returned status %d", resp.StatusCode)
+	}
+	if len(out.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(out.Data, dest); err != nil {
+		return fmt.Errorf("decode anilist data: %w", err)
+	}
+	return nil
+}
+
+func toAnime(m media) models.Anime {
+	title := m.Title.English
+	if title == "" {
+		title = m.Title.Romaji
+	}
+	poster := m.CoverImage.ExtraLarge
+	if poster == "" {
+		poster = m.CoverImage.Large
+	}
+	return models.Anime{
+		ID:           m.ID,
+		MALID:        m.IDMal,
+		Title:        title,
+		TitleRomaji:  m.Title.Romaji,
+		TitleEnglish: m.Title.English,
+		TitleNative:  m.Title.Native,
+		Synonyms:     m.Synonyms,
+		Format:       m.Format,
+		Status:       m.Status,
+		Episodes:     m.Episodes,
+		Duration:     m.Duration,
+		Year:         m.SeasonYear,
+		Score:        float64(m.AverageScore) / 10,
+		Genres:       m.Genres,
+		Overview:     strings.TrimSpace(htmlTagRe.ReplaceAllString(m.Description, "")),
+		PosterURL:    poster,
+		BackdropURL:  m.BannerImage,
+		AniListURL:   fmt.Sprintf("https://anilist.co/anime/%d", m.ID),
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+const (
+	// animeSearchLimit is how many AniList results a search returns.
+	animeSearchLimit = 20
+	// animeMapLimit caps how many search results are mapped to TMDB.
+	animeMapLimit = 8
+	// animeSearchTimeout bounds a search including the TMDB mapping.
+	animeSearchTimeout = 20 * time.Second
+)
+
+// searchAnime handles GET /api/anime/search?q={query} — AniList search
+// results, the top ones mapped to TMDB by title and year.
+func (s *Server) searchAnime(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		apierror.Respond(c, http.StatusBadRequest, "query parameter 'q' is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), animeSearchTimeout)
+	defer cancel()
+
+	results, err := s.anilist.Search(ctx, query, animeSearchLimit)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to search anime", err.Error())
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range results[:min(animeMapLimit, len(results))] {
+		wg.Add(1)
+		go func(a *models.Anime) {
+			defer wg.Done()
+			s.mapAnime(ctx, a)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	c.JSON(http.StatusOK, results)
+}
+
+// getAnime handles GET /api/anime/:id — an AniList title by ID, mapped to
+// TMDB.
+func (s *Server) getAnime(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid anime ID")
+		return
+	}
+
+	anime, err := s.anilist.Get(c.Request.Context(), id)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get anime", err.Error())
+		return
+	}
+	if anime == nil {
+		apierror.Respond(c, http.StatusNotFound, "anime not found")
+		return
+	}
+
+	s.mapAnime(c.Request.Context(), anime)
+	c.JSON(http.StatusOK, anime)
+}
+
+// searchAnimeTorrents handles GET /api/anime/torrents?title={title}&episode={n}&live={0|1}&audio={lang}&refresh={0|1}&strict={0|1}&providers={names}&min_seeds={n}&quality={q}&max_size_gb={gb}&audio_lang={lang}
+func (s *Server) searchAnimeTorrents(c *gin.Context) {
+	title := c.Query("title")
+	if title == "" {
+		apierror.Respond(c, http.StatusBadRequest, "query parameter 'title' is required")
+		return
+	}
+	episode, _ := strconv.Atoi(c.Query("episode"))
+	providers, opts, ok := s.searchRequest(c, true)
+	if !ok {
+		return
+	}
+
+	results, statuses, err := providers.SearchAnime(c.Request.Context(), title, episode)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to search anime torrents", providerErrors(statuses))
+		return
+	}
+
+	opts.Episode = episode > 0
+	results = torrent.Rank(results, opts)
+	if c.Query("live") == "1" {
+		s.torrentMgr.AttachLiveStats(results, liveStatsLimit, 8*time.Second)
+		results = torrent.Rank(results, opts)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "providers": statuses})
+}
+
+// mapAnime sets the TMDB ID of an anime. TMDB lists most anime under their
+// English or romaji titles; films are movies there, everything else a show.
+func (s *Server) mapAnime(ctx context.Context, a *models.Anime) {
+	mediaType := "tv"
+	if a.Format == "MOVIE" {
+		mediaType = "movie"
+	}
+
+	for _, title := range []string{a.TitleEnglish, a.TitleRomaji} {
+		if title == "" {
+			continue
+		}
+		if id := s.findTMDB(ctx, mediaType, title, a.Year); id != 0 {
+			a.TMDbID, a.MediaType = id, mediaType
+			return
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+)
+
+const (
+	apiKeyHeader      = "X-API-Key"
+	sessionCookie     = "streambox_session"
+	sessionCookieTTL  = 30 * 24 * time.Hour
+	sessionCookiePath = "/"
+	// streamTokenTTL is how long a stream URL handed to an external player
+	// stays valid.
+	streamTokenTTL = 7 * 24 * time.Hour
+)
+
+// streamTokenPath matches a session's stream and its sub-resources, which a
+// stream token grants access to.
+var streamTokenPath = regexp.MustCompile(`^/api/stream/([^/]+)(/|$)`)
+
+// kodiPlayPath is the endpoint a Kodi play token grants access to.
+const kodiPlayPath = "/api/kodi/play"
+
+// authEnabled reports whether any authentication method is configured.
+func (s *Server) authEnabled() bool {
+	return s.config.AuthAPIKey != "" || s.passwordAuthEnabled()
+}
+
+func (s *Server) passwordAuthEnabled() bool {
+	return s.config.AuthUsername != "" && s.config.AuthPassword != ""
+}
+
+// requireAuth rejects unauthenticated /api requests when auth is configured.
+// A request is authenticated by the API key (X-API-Key header, bearer token
+// or ?api_key= for external players) or by the session cookie set by login.
+// Players that can't send either, such as Cast receivers, use a stream
+// token. The auth endpoints themselves are exempt; the SPA is served
+// outside /api.
+func (s *Server) requireAuth(c *gin.Context) {
+	if !s.authEnabled() || c.Request.Method == http.MethodOptions ||
+		strings.HasPrefix(c.Request.URL.Path, "/api/auth/") {
+		c.Next()
+		return
+	}
+
+	if s.validAPIKey(c) || s.validSessionCookie(c) || s.validStreamToken(c) || s.validKodiPlayToken(c) {
+		c.Next()
+		return
+	}
+
+	apierror.Respond(c, http.StatusUnauthorized, "authentication required")
+}
+
+func (s *Server) validAPIKey(c *gin.Context) bool {
+	if s.config.AuthAPIKey == "" {
+		return false
+	}
+	key := requestAPIKey(c)
+	return key != "" && secureEqual(key, s.config.AuthAPIKey)
+}
+
+// requestAPIKey returns the API key a request was sent with, if any.
+func requestAPIKey(c *gin.Context) string {
+	key := c.GetHeader(apiKeyHeader)
+	if key == "" {
+		key, _ = strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		key = c.Query("api_key")
+	}
+	return key
+}
+
+func (s *Server) validSessionCookie(c *gin.Context) bool {
+	if !s.passwordAuthEnabled() {
+		return false
+	}
+	token, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+
+	expiry, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.signSession(expiry))) {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && time.Now().Unix() < unix
+}
+
+// signSession signs a session expiry with the auth secret. Changing the
+// password invalidates existing sessions.
+func (s *Server) signSession(expiry string) string {
+	mac := hmac.New(sha256.New, s.authSecret)
+	mac.Write([]byte(s.config.AuthUsername + "\x00" + s.config.AuthPassword + "\x00" + expiry))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// streamToken returns a token for ?token= that authenticates requests for
+// one session's stream until streamTokenTTL from now, for players that can't
+// send headers or cookies.
+func (s *Server) streamToken(sessionID string) string {
+	expiry := strconv.FormatInt(time.Now().Add(streamTokenTTL).Unix(), 10)
+	return expiry + "." + s.signStream(sessionID, expiry)
+}
+
+func (s *Server) signStream(sessionID, expiry string) string {
+	mac := hmac.New(sha256.New, s.authSecret)
+	mac.Write([]byte("stream\x00" + sessionID + "\x00" + expiry))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validStreamToken reports whether a GET of a session's stream carries a
+// valid token for that session.
+func (s *Server) validStreamToken(c *gin.Context) bool {
+	token := c.Query("token")
+	if token == "" || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+		return false
+	}
+	m := streamTokenPath.FindStringSubmatch(c.Request.URL.Path)
+	if m == nil {
+		return false
+	}
+	expiry, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.signStream(m[1], expiry))) {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && time.Now().Unix() < unix
+}
+
+// kodiPlayToken returns a token for ?token= that authenticates a
+// /api/kodi/play request with exactly the given query. It doesn't expire,
+// since .strm files stay in Kodi's library; changing AUTH_SECRET revokes it.
+func (s *Server) kodiPlayToken(q url.Values) string {
+	mac := hmac.New(sha256.New, s.authSecret)
+	mac.Write([]byte("kodi\x00" + q.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validKodiPlayToken reports whether a GET of /api/kodi/play carries a valid
+// token for its query.
+func (s *Server) validKodiPlayToken(c *gin.Context) bool {
+	if c.Request.Method != http.MethodGet || c.Request.URL.Path != kodiPlayPath {
+		return false
+	}
+	q := c.Request.URL.Query()
+	token := q.Get("token")
+	if token == "" {
+		return false
+	}
+	q.Del("token")
+	return hmac.Equal([]byte(token), []byte(s.kodiPlayToken(q)))
+}
+
+// newAuthSecret returns the configured signing secret, or a random one that
+// logs everyone out on restart.
+func newAuthSecret(configured string) []byte {
+	if configured != "" {
+		return []byte(configured)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal().Err(err).Msg("failed to generate auth secret")
+	}
+	return secret
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// login handles POST /api/auth/login
+func (s *Server) login(c *gin.Context) {
+	if !s.passwordAuthEnabled() {
+		apierror.Respond(c, http.StatusNotImplemented, "password login not configured")
+		return
+	}
+
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	// Compare both fields so timing doesn't reveal which one was wrong.
+	userOK := secureEqual(req.Username, s.config.AuthUsername)
+	passOK := secureEqual(req.Password, s.config.AuthPassword)
+	if !userOK || !passOK {
+		log.Warn().Str("ip", c.ClientIP()).Msg("failed login attempt")
+		apierror.Respond(c, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+
+	expiry := strconv.FormatInt(time.Now().Add(sessionCookieTTL).Unix(), 10)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, expiry+"."+s.signSession(expiry), int(sessionCookieTTL.Seconds()),
+		sessionCookiePath, "", c.Request.TLS != nil, true)
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged in"})
+}
+
+// logout handles POST /api/auth/logout
+func (s *Server) logout(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, "", -1, sessionCookiePath, "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// getAuthStatus handles GET /api/auth/status — lets the SPA decide whether
+// to show the login page.
+func (s *Server) getAuthStatus(c *gin.Context) {
+	enabled := s.authEnabled()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":        enabled,
+		"password_login": s.passwordAuthEnabled(),
+		"authenticated":  !enabled || s.validAPIKey(c) || s.validSessionCookie(c),
+	})
+}
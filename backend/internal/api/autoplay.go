@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+type autoStreamRequest struct {
+	TMDbID int `json:"tmdb_id" binding:"required"`
+	// MediaType is "movie" or "tv"; by default "tv" if an episode is given.
+	MediaType string `json:"media_type"`
+	Season    int    `json:"season"`
+	Episode   int    `json:"episode"`
+	// Quality is the preferred quality, e.g. "1080p"; the best release in
+	// another quality is played if there is none in it.
+	Quality string `json:"quality"`
+	// Audio is the preferred audio language (ISO 639 code), by default the
+	// profile's; releases with it rank higher and its track is selected.
+	Audio string `json:"audio"`
+	// Resume, Capabilities and Async are as for /api/stream/start.
+	Resume       bool                       `json:"resume"`
+	Capabilities *models.ClientCapabilities `json:"capabilities"`
+	Async        bool                       `json:"async"`
+}
+
+type autoStreamResponse struct {
+	Session *models.StreamSession `json:"session"`
+	Torrent models.TorrentResult  `json:"torrent"` // the release chosen
+}
+
+// autoStream handles POST /api/stream/auto — "just play it": searches the
+// providers for a TMDB title (an episode of it, for TV), ranks the results
+// and starts a stream of the best one, the episode's file in season packs.
+func (s *Server) autoStream(c *gin.Context) {
+	var req autoStreamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	item := kodiItem{TMDbID: req.TMDbID, MediaType: req.MediaType, Season: req.Season, Episode: req.Episode}
+	if item.MediaType == "" {
+		item.MediaType = "movie"
+		if item.Episode > 0 {
+			item.MediaType = "tv"
+		}
+	}
+	switch item.MediaType {
+	case "movie":
+		item.Season, item.Episode = 0, 0
+	case "tv":
+		if item.Season < 0 || item.Episode <= 0 {
+			apierror.Respond(c, http.StatusBadRequest, "season and episode are required for tv")
+			return
+		}
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "media_type must be movie or tv")
+		return
+	}
+
+	meta, err := s.kodiLookup(c.Request.Context(), item)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to look up title", err.Error())
+		return
+	}
+	opts := s.rankOptions(c, item.MediaType == "tv")
+	if req.Audio != "" {
+		opts.AudioLanguage = req.Audio
+	}
+	results, err := s.titleTorrents(c, item, meta, opts)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to search torrents", err.Error())
+		return
+	}
+	best, ok := torrent.Best(results, req.Quality)
+	if !ok {
+		apierror.Respond(c, http.StatusNotFound, "no playable torrents found")
+		return
+	}
+
+	year, _ := strconv.Atoi(meta.Year)
+	sreq := models.SourceRequest{
+		TMDbID:       item.TMDbID,
+		Title:        meta.Title,
+		Year:         year,
+		IMDbID:       meta.IMDbID,
+		Season:       item.Season,
+		Episode:      item.Episode,
+		MagnetURI:    best.MagnetURI,
+		Provider:     best.Provider,
+		Quality:      best.Quality,
+		TopicID:      best.TopicID,
+		Client:       c.ClientIP(),
+		Capabilities: req.Capabilities,
+
+		AudioLanguage: opts.AudioLanguage,
+	}
+	resumeReq := startStreamRequest{TMDbID: item.TMDbID, Title: meta.Title, Season: item.Season, Episode: item.Episode, Resume: req.Resume}
+
+	if req.Async {
+		profile := profileID(c)
+		session, err := s.torrentMgr.PlayAsync(sreq, -1, func(session *models.StreamSession) {
+			s.resumePosition(profile, session, resumeReq)
+		})
+		if err != nil {
+			if respondBusy(c, err) {
+				return
+			}
+			apierror.Respond(c, http.StatusInternalServerError, "failed to start stream", err.Error())
+			return
+		}
+		c.JSON(http.StatusAccepted, autoStreamResponse{Session: session, Torrent: best})
+		return
+	}
+
+	session, err := s.torrentMgr.Play(sreq, -1)
+	if err != nil {
+		if respondBusy(c, err) {
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, "failed to start stream", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, autoStreamResponse{Session: s.withResumePosition(c, session, resumeReq), Torrent: best})
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const indexFile = "./static/index.html"
+
+// stripBasePath serves the app under basePath (e.g. "/streambox") by removing
+// the prefix before routing. Requests without it are routed as they are, so
+// both proxies that forward the prefix and proxies that strip it work, and
+// LAN clients (Cast, DLNA) can keep using the root paths.
+func stripBasePath(basePath string, next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == basePath {
+			http.Redirect(w, r, basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+		if rest, ok := strings.CutPrefix(r.URL.Path, basePath+"/"); ok {
+			r.URL.Path = "/" + rest
+			r.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// originAllowed reports whether a browser origin is in ALLOWED_ORIGINS.
+func originAllowed(allowed []string, origin string) bool {
+	return slices.Contains(allowed, "*") || slices.Contains(allowed, origin)
+}
+
+// serveIndex serves the SPA's index.html. Behind a base path, its root-relative
+// asset links are prefixed and the prefix is passed to the app as
+// window.__BASE_PATH__ for its API requests and routes.
+func (s *Server) serveIndex(c *gin.Context) {
+	base := s.config.BasePath
+	if base == "" {
+		c.File(indexFile)
+		return
+	}
+
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	html := strings.ReplaceAll(string(data), `="/`, `="`+base+`/`)
+	script := "<script>window.__BASE_PATH__ = " + strconv.Quote(base) + "</script>"
+	html = strings.Replace(html, "<head>", "<head>\n    "+script, 1)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
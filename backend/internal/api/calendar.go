@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/notify"
+)
+
+const (
+	// calendarDays is the default ?days of GET /api/calendar, and
+	// calendarMaxDays its maximum.
+	calendarDays    = 30
+	calendarMaxDays = 90
+	// calendarWorkers caps concurrent TMDB lookups for one calendar.
+	calendarWorkers = 4
+)
+
+const dateLayout = "2006-01-02"
+
+// getCalendar handles GET /api/calendar?from=&days=&format=ics — upcoming
+// episodes of the profile's followed shows and digital releases of movies on
+// its watchlist, by date. Titles TMDB fails to return are left out.
+func (s *Server) getCalendar(c *gin.Context) {
+	from := time.Now().Format(dateLayout)
+	if v := c.Query("from"); v != "" {
+		if _, err := time.Parse(dateLayout, v); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "invalid from, want YYYY-MM-DD")
+			return
+		}
+		from = v
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(calendarDays)))
+	if err != nil || days < 1 || days > calendarMaxDays {
+		apierror.Respond(c, http.StatusBadRequest, fmt.Sprintf("invalid days, want 1 to %d", calendarMaxDays))
+		return
+	}
+	start, _ := time.Parse(dateLayout, from)
+	to := start.AddDate(0, 0, days-1).Format(dateLayout)
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "ics" {
+		apierror.Respond(c, http.StatusBadRequest, "invalid format, want json or ics")
+		return
+	}
+
+	entries, err := s.calendarEntries(c.Request.Context(), profileID(c), from, to)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to build calendar", err.Error())
+		return
+	}
+
+	if format == "ics" {
+		c.Header("Content-Disposition", `inline; filename="streambox.ics"`)
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(icsCalendar(entries)))
+		return
+	}
+
+	cal := models.Calendar{From: from, To: to, Days: []models.CalendarDay{}}
+	for _, e := range entries {
+		if n := len(cal.Days); n == 0 || cal.Days[n-1].Date != e.Date {
+			cal.Days = append(cal.Days, models.CalendarDay{Date: e.Date})
+		}
+		day := &cal.Days[len(cal.Days)-1]
+		day.Entries = append(day.Entries, e)
+	}
+	c.JSON(http.StatusOK, cal)
+}
+
+// calendarEntries returns the releases of a profile's followed titles from
+// from to to (inclusive), sorted by date and title.
+func (s *Server) calendarEntries(ctx context.Context, profile int, from, to string) ([]models.CalendarEntry, error) {
+	shows, err := s.db.FollowedShows()
+	if err != nil {
+		return nil, err
+	}
+	watchlist, err := s.db.GetWatchlist(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		entries []models.CalendarEntry
+		sem     = make(chan struct{}, calendarWorkers)
+		wg      sync.WaitGroup
+	)
+	lookup := func(fn func() []models.CalendarEntry) {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			found := fn()
+			mu.Lock()
+			entries = append(entries, found...)
+			mu.Unlock()
+		}()
+	}
+
+	for _, show := range shows {
+		if show.ProfileID == profile {
+			lookup(func() []models.CalendarEntry { return s.showReleases(ctx, show, from, to) })
+		}
+	}
+	for _, item := range watchlist {
+		if item.MediaType == "movie" {
+			lookup(func() []models.CalendarEntry { return s.movieReleases(ctx, item, from, to) })
+		}
+	}
+	wg.Wait()
+
+	slices.SortFunc(entries, func(a, b models.CalendarEntry) int {
+		if c := strings.Compare(a.Date, b.Date); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Title, b.Title); c != 0 {
+			return c
+		}
+		if a.Season != b.Season {
+			return a.Season - b.Season
+		}
+		return a.Episode - b.Episode
+	})
+	return entries, nil
+}
+
+// showReleases returns the episodes of a show airing from from to to. Only
+// the seasons of its last and next episodes are looked at, which covers any
+// window of a few months.
+func (s *Server) showReleases(ctx context.Context, show models.FollowedShow, from, to string) []models.CalendarEntry {
+	details, err := s.tmdb.GetTVDetails(ctx, show.TMDbID)
+	if err != nil {
+		log.Warn().Err(err).Int("tmdb_id", show.TMDbID).Msg("calendar show lookup failed")
+		return nil
+	}
+
+	var seasons []int
+	var known []models.Episode // fallback if a season can't be loaded
+	for _, ep := range []*models.Episode{details.LastEpisodeToAir, details.NextEpisodeToAir} {
+		if ep == nil || ep.AirDate == "" {
+			continue
+		}
+		if (ep == details.LastEpisodeToAir && ep.AirDate >= from) || (ep == details.NextEpisodeToAir && ep.AirDate <= to) {
+			if !slices.Contains(seasons, ep.SeasonNumber) {
+				seasons = append(seasons, ep.SeasonNumber)
+			}
+			known = append(known, *ep)
+		}
+	}
+
+	var episodes []models.Episode
+	for _, n := range seasons {
+		season, err := s.tmdb.GetSeasonDetails(ctx, show.TMDbID, n)
+		if err != nil {
+			log.Warn().Err(err).Int("tmdb_id", show.TMDbID).Int("season", n).Msg("calendar season lookup failed")
+			for _, ep := range known {
+				if ep.SeasonNumber == n {
+					episodes = append(episodes, ep)
+				}
+			}
+			continue
+		}
+		episodes = append(episodes, season.Episodes...)
+	}
+
+	title := details.Name
+	if title == "" {
+		title = show.Title
+	}
+	var entries []models.CalendarEntry
+	for _, ep := range episodes {
+		if ep.AirDate == "" || ep.AirDate < from || ep.AirDate > to {
+			continue
+		}
+		entries = append(entries, models.CalendarEntry{
+			Date:        ep.AirDate,
+			MediaType:   "tv",
+			TMDbID:      show.TMDbID,
+			Title:       title,
+			PosterPath:  show.PosterPath,
+			Season:      ep.SeasonNumber,
+			Episode:     ep.EpisodeNumber,
+			EpisodeName: ep.Name,
+		})
+	}
+	return entries
+}
+
+// movieReleases returns a movie's first digital release, the earliest it's
+// likely to be out in good quality, if it falls from from to to.
+func (s *Server) movieReleases(ctx context.Context, item models.WatchlistItem, from, to string) []models.CalendarEntry {
+	dates, err := s.tmdb.GetReleaseDates(ctx, item.TMDbID)
+	if err != nil {
+		log.Warn().Err(err).Int("tmdb_id", item.TMDbID).Msg("calendar release dates lookup failed")
+		return nil
+	}
+
+	var first *models.ReleaseDate
+	for i, d := range dates {
+		if d.Type == models.ReleaseDigital && (first == nil || d.Date < first.Date) {
+			first = &dates[i]
+		}
+	}
+	if first == nil || first.Date < from || first.Date > to {
+		return nil
+	}
+	return []models.CalendarEntry{{
+		Date:       first.Date,
+		MediaType:  "movie",
+		TMDbID:     item.TMDbID,
+		Title:      item.Title,
+		PosterPath: item.PosterPath,
+		Release:    "digital",
+		Country:    first.Country,
+	}}
+}
+
+// icsCalendar renders entries as an iCalendar (RFC 5545) feed of all-day
+// events, for subscribing from a calendar app.
+func icsCalendar(entries []models.CalendarEntry) string {
+	var b strings.Builder
+	line := func(s string) {
+		// Lines longer than 75 octets are folded onto continuation lines
+		// starting with a space, without splitting UTF-8 sequences.
+		for len(s) > 75 {
+			cut := 75
+			for cut > 0 && s[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			b.WriteString(s[:cut] + "\r\n")
+			s = " " + s[cut:]
+		}
+		b.WriteString(s + "\r\n")
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//StreamBox//Calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:StreamBox")
+	for _, e := range entries {
+		date, err := time.Parse(dateLayout, e.Date)
+		if err != nil {
+			continue
+		}
+		summary := e.Title
+		uid := fmt.Sprintf("%s-%d", e.MediaType, e.TMDbID)
+		if e.MediaType == "tv" {
+			summary += notify.EpisodeLabel(e.Season, e.Episode)
+			if e.EpisodeName != "" {
+				summary += " — " + e.EpisodeName
+			}
+			uid += fmt.Sprintf("-s%de%d", e.Season, e.Episode)
+		} else {
+			summary += " (" + e.Release + " release)"
+		}
+
+		line("BEGIN:VEVENT")
+		line("UID:" + uid + "@streambox")
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + date.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + date.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + icsEscape(summary))
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "")
+
+func icsEscape(s string) string {
+	return icsEscaper.Replace(s)
+}
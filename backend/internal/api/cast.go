@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/cast"
+	"github.com/streambox/backend/internal/models"
+)
+
+const (
+	castDiscoverTimeout = 3 * time.Second
+	castCommandTimeout  = 15 * time.Second
+)
+
+// castMediaPath matches the media a Cast receiver fetches for a session:
+// HLS playlists/segments and subtitles.
+var castMediaPath = regexp.MustCompile(`^/api/(stream/[^/]+/(hls|subtitles)/|subtitles/download/)`)
+
+// isCastMedia reports whether a request is a Cast receiver fetching session
+// media, which must be allowed from any origin. It still needs auth: the
+// URLs cast carry a stream token (see castLoad).
+func isCastMedia(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return castMediaPath.MatchString(c.Request.URL.Path)
+	}
+	return false
+}
+
+// listCastDevices handles GET /api/cast/devices?refresh=1
+func (s *Server) listCastDevices(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), castDiscoverTimeout)
+	defer cancel()
+
+	devices, err := s.cast.Devices(ctx, c.Query("refresh") != "")
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to discover cast devices", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+type castLoadRequest struct {
+	SessionID string  `json:"session_id"`
+	URL       string  `json:"url"`
+	Title     string  `json:"title"`
+	Position  float64 `json:"position"` // seconds
+}
+
+// castLoad handles POST /api/cast/:device/load — casts a stream session (via
+// its HLS playlist) or an arbitrary media URL to a device.
+func (s *Server) castLoad(c *gin.Context) {
+	var req castLoadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	if req.SessionID == "" && req.URL == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session_id or url is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), castCommandTimeout)
+	defer cancel()
+	deviceID := c.Param("device")
+
+	media := cast.Media{URL: req.URL, Title: req.Title, StartTime: req.Position}
+	if req.SessionID != "" {
+		sess := s.torrentMgr.GetSession(req.SessionID)
+		if sess == nil {
+			apierror.Respond(c, http.StatusNotFound, "session not found")
+			return
+		}
+		base, err := s.castBaseURL(ctx, deviceID)
+		if err != nil {
+			apierror.Respond(c, http.StatusNotFound, "cast device unavailable", err.Error())
+			return
+		}
+		media.URL = fmt.Sprintf("%s/api/stream/%s/hls/playlist.m3u8", base, sess.ID)
+		if s.authEnabled() {
+			// Receivers can't send credentials; the playlist passes the
+			// token on to its segments.
+			media.URL += "?token=" + url.QueryEscape(s.streamToken(sess.ID))
+		}
+		media.ContentType = "application/x-mpegurl"
+		if media.Title == "" {
+			media.Title = sess.Title
+		}
+	}
+
+	status, err := s.cast.Load(ctx, deviceID, media)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to cast", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// castBaseURL returns the server URL as reachable from a Cast device.
+func (s *Server) castBaseURL(ctx context.Context, deviceID string) (string, error) {
+	if s.config.CastBaseURL != "" {
+		return s.config.CastBaseURL, nil
+	}
+	ip, err := s.cast.LocalIP(ctx, deviceID)
+	if err != nil {
+		return "", err
+	}
+	scheme, port := lanAddr(s.config)
+	return fmt.Sprintf("%s://%s:%d", scheme, ip, port), nil
+}
+
+// castPlay handles POST /api/cast/:device/play
+func (s *Server) castPlay(c *gin.Context) {
+	s.castCommand(c, s.cast.Play)
+}
+
+// castPause handles POST /api/cast/:device/pause
+func (s *Server) castPause(c *gin.Context) {
+	s.castCommand(c, s.cast.Pause)
+}
+
+// castSeek handles POST /api/cast/:device/seek
+func (s *Server) castSeek(c *gin.Context) {
+	var req struct {
+		Position *float64 `json:"position" binding:"required"` // seconds
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	s.castCommand(c, func(ctx context.Context, deviceID string) (*models.CastStatus, error) {
+		return s.cast.Seek(ctx, deviceID, *req.Position)
+	})
+}
+
+// castStop handles POST /api/cast/:device/stop
+func (s *Server) castStop(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), castCommandTimeout)
+	defer cancel()
+
+	if err := s.cast.Stop(ctx, c.Param("device")); err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to stop casting", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "casting stopped"})
+}
+
+// castStatus handles GET /api/cast/:device/status
+func (s *Server) castStatus(c *gin.Context) {
+	s.castCommand(c, s.cast.Status)
+}
+
+func (s *Server) castCommand(c *gin.Context, command func(context.Context, string) (*models.CastStatus, error)) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), castCommandTimeout)
+	defer cancel()
+
+	status, err := command(ctx, c.Param("device"))
+	if errors.Is(err, cast.ErrNoMedia) {
+		apierror.Respond(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "cast command failed", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package api
+
+import "io/fs"
+
+func diskFree(path string) (uint64, error) {
+	return 0, errDiskFreeUnsupported
+}
+
+func allocatedSize(fi fs.FileInfo) int64 {
+	return fi.Size()
+}
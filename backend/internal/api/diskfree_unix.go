@@ -0,0 +1,28 @@
+//go:build unix
+
+package api
+
+import (
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+// diskFree returns the bytes available to unprivileged users on the file
+// system holding path.
+func diskFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// allocatedSize returns the disk space a file takes, which for partially
+// downloaded (sparse) torrent files is less than their size.
+func allocatedSize(fi fs.FileInfo) int64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return int64(st.Blocks) * 512
+	}
+	return fi.Size()
+}
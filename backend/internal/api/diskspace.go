@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/notify"
+)
+
+// diskCheckInterval is how often the disk monitor checks free space.
+const diskCheckInterval = time.Minute
+
+// StartDiskMonitor sends a notification when free space in TorrentDir drops
+// below DISK_LOW_GB. It notifies again only after space has recovered by 10%
+// above the threshold and dropped once more. Stops when ctx is cancelled.
+func (s *Server) StartDiskMonitor(ctx context.Context, notifier *notify.Notifier) {
+	if s.config.DiskLowGB <= 0 {
+		return
+	}
+	dir := s.config.TorrentDir
+	threshold := uint64(s.config.DiskLowGB) << 30
+	if _, err := diskFree(dir); errors.Is(err, errDiskFreeUnsupported) {
+		log.Warn().Err(err).Msg("disk space monitor disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(diskCheckInterval)
+		defer ticker.Stop()
+		low := false
+		for {
+			free, err := diskFree(dir)
+			switch {
+			case err != nil:
+				log.Warn().Err(err).Msg("disk space check failed")
+			case !low && free < threshold:
+				low = true
+				log.Warn().Uint64("free_bytes", free).Str("path", dir).Msg("disk space low")
+				notifier.Notify(notify.Event{
+					Type:    notify.DiskSpaceLow,
+					Title:   "Disk space low",
+					Message: fmt.Sprintf("%.1f GB free in %s (warning below %d GB)", float64(free)/(1<<30), dir, s.config.DiskLowGB),
+					Data:    map[string]any{"path": dir, "free_bytes": free, "threshold_bytes": threshold},
+				})
+			case low && free >= threshold+threshold/10:
+				low = false
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/dlna"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+// dlnaLANOnly rejects DLNA requests from outside private networks. DLNA
+// clients can't authenticate, so the media server is only for the LAN;
+// behind a reverse proxy, TRUSTED_PROXIES must be set for the client's
+// address to be seen.
+func dlnaLANOnly(c *gin.Context) {
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil || !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()) {
+		apierror.Respond(c, http.StatusForbidden, "dlna is only served to the local network")
+		return
+	}
+	c.Next()
+}
+
+// dlnaLibrary exposes stream sessions to DLNA renderers: every session under
+// "Streams", and completed downloads plus fully downloaded sessions under
+// "Completed".
+type dlnaLibrary struct {
+	torrentMgr *torrent.Manager
+}
+
+func (l *dlnaLibrary) Folders() []dlna.Folder {
+	sessions := l.torrentMgr.Sessions()
+	// Renderers page through results, so the order must be stable.
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return dlnaTitle(sessions[i]) < dlnaTitle(sessions[j])
+	})
+
+	streams := dlna.Folder{ID: "streams", Title: "Streams"}
+	completed := dlna.Folder{ID: "completed", Title: "Completed"}
+
+	downloads, err := l.torrentMgr.Downloads(models.DownloadCompleted)
+	if err != nil {
+		log.Warn().Err(err).Msg("dlna: failed to list downloads")
+	}
+	downloaded := make(map[string]bool, len(downloads))
+	for _, dl := range downloads {
+		downloaded[fmt.Sprintf("%s/%d", dl.InfoHash, dl.FileIndex)] = true
+		completed.Videos = append(completed.Videos, dlna.Video{
+			ID:       dl.ID,
+			Title:    dlnaTitle(models.StreamSession{Title: dl.Title, Season: dl.Season, Episode: dl.Episode}),
+			Path:     "/dlna/download/" + dl.ID,
+			MimeType: torrent.PlaybackContentType(dl.FilePath),
+		})
+	}
+
+	for _, sess := range sessions {
+		v := dlnaVideo(sess)
+		streams.Videos = append(streams.Videos, v)
+		// Sessions playing a download are already listed as the download.
+		if !downloaded[fmt.Sprintf("%s/%d", sess.InfoHash, sess.FileIndex)] && l.torrentMgr.Downloaded(sess.ID) {
+			completed.Videos = append(completed.Videos, v)
+		}
+	}
+	return []dlna.Folder{streams, completed}
+}
+
+func dlnaVideo(sess models.StreamSession) dlna.Video {
+	v := dlna.Video{
+		ID:       sess.ID,
+		Title:    dlnaTitle(sess),
+		Path:     "/dlna/media/" + sess.ID,
+		MimeType: dlnaMimeType(sess),
+		Duration: sess.Duration,
+	}
+	if !sess.NeedsTranscode {
+		v.Size = sess.FileSize
+	}
+	return v
+}
+
+func dlnaTitle(sess models.StreamSession) string {
+	if sess.Season > 0 && sess.Episode > 0 {
+		return fmt.Sprintf("%s S%02dE%02d", sess.Title, sess.Season, sess.Episode)
+	}
+	return sess.Title
+}
+
+// dlnaMimeType is the type renderers receive: transcoded sessions are served
+// as fragmented MP4.
+func dlnaMimeType(sess models.StreamSession) string {
+	if sess.NeedsTranscode || sess.ContentType == "" {
+		return "video/mp4"
+	}
+	return sess.ContentType
+}
+
+// serveDLNAMedia handles GET/HEAD /dlna/media/:id
+func (s *Server) serveDLNAMedia(c *gin.Context) {
+	s.serveDLNASession(c, c.Param("id"))
+}
+
+func (s *Server) serveDLNASession(c *gin.Context, id string) {
+	sess := s.torrentMgr.GetSession(id)
+	if sess == nil {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+
+	c.Header("transferMode.dlna.org", "Streaming")
+	c.Header("contentFeatures.dlna.org", dlna.ContentFeatures())
+
+	// Renderers probe with HEAD before playing; don't start FFmpeg for it.
+	if c.Request.Method == http.MethodHead && sess.NeedsTranscode {
+		c.Header("Content-Type", dlnaMimeType(sess.StreamSession))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	s.streamSrv.ServeStream(c, id)
+}
+
+// serveDLNADownload handles GET/HEAD /dlna/download/:id — plays a completed
+// download through a (reused) stream session.
+func (s *Server) serveDLNADownload(c *gin.Context) {
+	session, err := s.torrentMgr.PlayDownload(c.Param("id"))
+	if errors.Is(err, torrent.ErrDownloadNotFound) {
+		apierror.Respond(c, http.StatusNotFound, "download not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to start stream", err.Error())
+		return
+	}
+
+	s.serveDLNASession(c, session.ID)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+type startDownloadRequest struct {
+	TMDbID    int    `json:"tmdb_id" binding:"required"`
+	Title     string `json:"title" binding:"required"`
+	MagnetURI string `json:"magnet_uri" binding:"required"`
+	FileIndex int    `json:"file_index"`
+	Season    int    `json:"season"`
+	Episode   int    `json:"episode"`
+}
+
+// startDownload handles POST /api/downloads
+func (s *Server) startDownload(c *gin.Context) {
+	var req startDownloadRequest
+	req.FileIndex = -1 // default: largest video file
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	dl, err := s.torrentMgr.StartDownload(req.TMDbID, req.Title, req.Season, req.Episode, req.MagnetURI, req.FileIndex)
+	if errors.Is(err, torrent.ErrInvalidMagnet) {
+		apierror.Respond(c, http.StatusBadRequest, "invalid magnet link", err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to start download", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, dl)
+}
+
+// listDownloads handles GET /api/downloads?status=
+func (s *Server) listDownloads(c *gin.Context) {
+	s.respondDownloads(c, c.Query("status"))
+}
+
+// getLibrary handles GET /api/downloads/library — completed downloads
+// available for offline playback.
+func (s *Server) getLibrary(c *gin.Context) {
+	s.respondDownloads(c, models.DownloadCompleted)
+}
+
+func (s *Server) respondDownloads(c *gin.Context, status string) {
+	downloads, err := s.torrentMgr.Downloads(status)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to list downloads", err.Error())
+		return
+	}
+	if downloads == nil {
+		downloads = []models.Download{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"downloads": downloads})
+}
+
+// getDownload handles GET /api/downloads/:id
+func (s *Server) getDownload(c *gin.Context) {
+	dl, err := s.torrentMgr.GetDownload(c.Param("id"))
+	s.respondDownload(c, dl, err)
+}
+
+// pauseDownload handles POST /api/downloads/:id/pause
+func (s *Server) pauseDownload(c *gin.Context) {
+	dl, err := s.torrentMgr.PauseDownload(c.Param("id"))
+	s.respondDownload(c, dl, err)
+}
+
+// resumeDownload handles POST /api/downloads/:id/resume — also retries
+// failed downloads.
+func (s *Server) resumeDownload(c *gin.Context) {
+	dl, err := s.torrentMgr.ResumeDownload(c.Param("id"))
+	s.respondDownload(c, dl, err)
+}
+
+func (s *Server) respondDownload(c *gin.Context, dl *models.Download, err error) {
+	switch {
+	case errors.Is(err, torrent.ErrDownloadNotFound):
+		apierror.Respond(c, http.StatusNotFound, "download not found")
+	case errors.Is(err, torrent.ErrDownloadState):
+		apierror.Respond(c, http.StatusConflict, err.Error())
+	case err != nil:
+		apierror.Respond(c, http.StatusInternalServerError, "download operation failed", err.Error())
+	default:
+		c.JSON(http.StatusOK, dl)
+	}
+}
+
+// deleteDownload handles DELETE /api/downloads/:id?files=1 — files=1 also
+// deletes the downloaded data.
+func (s *Server) deleteDownload(c *gin.Context) {
+	err := s.torrentMgr.DeleteDownload(c.Param("id"), c.Query("files") != "")
+	if errors.Is(err, torrent.ErrDownloadNotFound) {
+		apierror.Respond(c, http.StatusNotFound, "download not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to delete download", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "download deleted"})
+}
+
+// playDownload handles POST /api/downloads/:id/play — returns a stream
+// session for the downloaded file, served from disk once complete.
+func (s *Server) playDownload(c *gin.Context) {
+	session, err := s.torrentMgr.PlayDownload(c.Param("id"))
+	if errors.Is(err, torrent.ErrDownloadNotFound) {
+		apierror.Respond(c, http.StatusNotFound, "download not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to start stream", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
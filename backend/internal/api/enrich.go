@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// enrichTimeout bounds third-party metadata lookups, so a slow service only
+// delays details pages briefly.
+const enrichTimeout = 3 * time.Second
+
+// externalMetadata looks up a title on Kinopoisk and OMDb concurrently,
+// where configured. Failures are logged and yield nil: the data is optional.
+func (s *Server) externalMetadata(c *gin.Context, imdbID string) (*models.KinopoiskInfo, *models.Ratings) {
+	if imdbID == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), enrichTimeout)
+	defer cancel()
+
+	var (
+		kp      *models.KinopoiskInfo
+		ratings *models.Ratings
+		wg      sync.WaitGroup
+	)
+	if s.kinopoisk != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if kp, err = s.kinopoisk.Lookup(ctx, imdbID); err != nil {
+				log.Warn().Err(err).Str("imdb_id", imdbID).Msg("kinopoisk lookup failed")
+			}
+		}()
+	}
+	if s.omdb != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if ratings, err = s.omdb.Ratings(ctx, imdbID); err != nil {
+				log.Warn().Err(err).Str("imdb_id", imdbID).Msg("omdb lookup failed")
+			}
+		}()
+	}
+	wg.Wait()
+	return kp, ratings
+}
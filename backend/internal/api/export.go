@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/models"
+)
+
+// exportVersion is the UserDataExport format version written by exportData.
+const exportVersion = 1
+
+// exportData handles GET /api/export — every profile's history and watchlist
+// plus the runtime settings, as a JSON download.
+func (s *Server) exportData(c *gin.Context) {
+	settings, err := s.settings()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to load settings", err.Error())
+		return
+	}
+	profiles, err := s.db.ListProfiles()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to list profiles", err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	export := models.UserDataExport{
+		Version:    exportVersion,
+		ExportedAt: now.Format(time.RFC3339),
+		Settings:   &settings,
+		Profiles:   make([]models.ProfileExport, 0, len(profiles)),
+	}
+	for _, p := range profiles {
+		history, _, err := s.db.GetHistory(p.ID, models.HistoryFilter{})
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, "failed to get watch history", err.Error())
+			return
+		}
+		watchlist, err := s.db.GetWatchlist(p.ID)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, "failed to get watchlist", err.Error())
+			return
+		}
+		export.Profiles = append(export.Profiles, models.ProfileExport{Profile: p, History: history, Watchlist: watchlist})
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="streambox-export-`+now.Format("20060102")+`.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
+// importData handles POST /api/import — restores an export, creating
+// profiles missing by name. ?on_conflict decides titles both sides have:
+// newest (default) keeps the history entry updated last, skip keeps the
+// existing data and overwrite replaces it.
+func (s *Server) importData(c *gin.Context) {
+	conflict := c.DefaultQuery("on_conflict", db.ConflictNewest)
+	switch conflict {
+	case db.ConflictNewest, db.ConflictSkip, db.ConflictOverwrite:
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "on_conflict must be newest, skip or overwrite")
+		return
+	}
+
+	var data models.UserDataExport
+	if err := c.ShouldBindJSON(&data); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	if data.Version != exportVersion {
+		apierror.Respond(c, http.StatusBadRequest, "unsupported export version")
+		return
+	}
+	if st := data.Settings; st != nil && (st.DownloadLimitKBps < 0 || st.UploadLimitKBps < 0 || st.SessionLimitKBps < 0) {
+		apierror.Respond(c, http.StatusBadRequest, "rate limits must not be negative")
+		return
+	}
+
+	existing, err := s.db.ListProfiles()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to list profiles", err.Error())
+		return
+	}
+	profileIDs := make(map[string]int, len(existing))
+	for _, p := range existing {
+		profileIDs[p.Name] = p.ID
+	}
+
+	var result models.ImportResult
+	for _, pe := range data.Profiles {
+		if pe.Name == "" {
+			continue
+		}
+		id, ok := profileIDs[pe.Name]
+		if !ok {
+			created, err := s.db.CreateProfile(pe.Profile)
+			if err != nil {
+				apierror.Write(c, apierror.New(http.StatusInternalServerError, "failed to create profile").WithDetails(err.Error()).WithData(result))
+				return
+			}
+			id = created.ID
+			profileIDs[pe.Name] = id
+			result.ProfilesCreated++
+		}
+
+		for _, h := range pe.History {
+			written, err := s.db.ImportHistoryEntry(id, h, conflict)
+			if err != nil {
+				apierror.Write(c, apierror.New(http.StatusInternalServerError, "failed to import watch history").WithDetails(err.Error()).WithData(result))
+				return
+			}
+			if written {
+				result.HistoryImported++
+			} else {
+				result.HistorySkipped++
+			}
+		}
+		for _, item := range pe.Watchlist {
+			if item.MediaType == "" {
+				item.MediaType = "movie"
+			}
+			written, err := s.db.ImportWatchlistItem(id, item, conflict)
+			if err != nil {
+				apierror.Write(c, apierror.New(http.StatusInternalServerError, "failed to import watchlist").WithDetails(err.Error()).WithData(result))
+				return
+			}
+			if written {
+				result.WatchlistImported++
+			} else {
+				result.WatchlistSkipped++
+			}
+		}
+	}
+
+	if data.Settings != nil {
+		var saved models.Settings
+		found, err := s.db.GetSetting(db.SettingsKey, &saved)
+		if err != nil {
+			apierror.Write(c, apierror.New(http.StatusInternalServerError, "failed to load settings").WithDetails(err.Error()).WithData(result))
+			return
+		}
+		if !found || conflict != db.ConflictSkip {
+			if err := s.db.SaveSetting(db.SettingsKey, *data.Settings); err != nil {
+				apierror.Write(c, apierror.New(http.StatusInternalServerError, "failed to save settings").WithDetails(err.Error()).WithData(result))
+				return
+			}
+			s.torrentMgr.SetRateLimits(*data.Settings)
+			result.SettingsImported = true
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
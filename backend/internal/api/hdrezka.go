@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/hdrezka"
+	"github.com/streambox/backend/internal/models"
+)
+
+const (
+	// hdrezkaMapLimit caps how many search results are mapped to TMDB; each
+	// costs a page scrape and a TMDB search.
+	hdrezkaMapLimit = 8
+	// hdrezkaSearchTimeout bounds a search including the TMDB mapping.
+	hdrezkaSearchTimeout = 20 * time.Second
+)
+
+// searchHDRezka handles GET /api/hdrezka/search?q={query} — HDRezka search
+// results, the top ones mapped to TMDB by original title and year.
+func (s *Server) searchHDRezka(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		apierror.Respond(c, http.StatusBadRequest, "query parameter 'q' is required")
+		return
+	}
+	if s.hdrezka == nil {
+		c.JSON(http.StatusOK, []any{})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), hdrezkaSearchTimeout)
+	defer cancel()
+
+	items, err := s.hdrezka.Search(ctx, query)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to search hdrezka", err.Error())
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range items[:min(hdrezkaMapLimit, len(items))] {
+		wg.Add(1)
+		go func(item *models.HDRezkaItem) {
+			defer wg.Done()
+			s.mapHDRezka(ctx, item)
+		}(&items[i])
+	}
+	wg.Wait()
+
+	c.JSON(http.StatusOK, items)
+}
+
+// mapHDRezka sets the TMDB ID of an HDRezka title, looked up by the original
+// title and year from its page. Cartoons and anime may be either movies or
+// series, so both are tried.
+func (s *Server) mapHDRezka(ctx context.Context, item *models.HDRezkaItem) {
+	details, err := s.hdrezka.Details(ctx, item.URL)
+	if err != nil {
+		log.Debug().Err(err).Str("url", item.URL).Msg("hdrezka details failed")
+		return
+	}
+
+	query := details.OriginalTitle
+	if query == "" {
+		query = details.Title
+	}
+	year := details.Year
+	if year == 0 {
+		year = item.Year
+	}
+
+	var mediaTypes []string
+	switch details.Type {
+	case hdrezka.TypeFilm:
+		mediaTypes = []string{"movie"}
+	case hdrezka.TypeSeries:
+		mediaTypes = []string{"tv"}
+	default:
+		mediaTypes = []string{"movie", "tv"}
+	}
+
+	for _, mt := range mediaTypes {
+		if id := s.findTMDB(ctx, mt, query, year); id != 0 {
+			item.TMDbID, item.MediaType = id, mt
+			return
+		}
+	}
+}
+
+// findTMDB returns the ID of the first TMDB movie or show named query that
+// was released in year (any year if 0), or 0.
+func (s *Server) findTMDB(ctx context.Context, mediaType, query string, year int) int {
+	yearPrefix := ""
+	if year > 0 {
+		yearPrefix = strconv.Itoa(year)
+	}
+
+	switch mediaType {
+	case "movie":
+		res, err := s.tmdb.Search(ctx, query, 1)
+		if err != nil {
+			log.Debug().Err(err).Str("query", query).Msg("tmdb movie search failed")
+			return 0
+		}
+		for _, m := range res.Results {
+			if strings.HasPrefix(m.ReleaseDate, yearPrefix) {
+				return m.ID
+			}
+		}
+	case "tv":
+		res, err := s.tmdb.SearchTV(ctx, query, 1)
+		if err != nil {
+			log.Debug().Err(err).Str("query", query).Msg("tmdb tv search failed")
+			return 0
+		}
+		for _, t := range res.Results {
+			if strings.HasPrefix(t.FirstAirDate, yearPrefix) {
+				return t.ID
+			}
+		}
+	}
+	return 0
+}
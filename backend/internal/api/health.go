@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/models"
+)
+
+const (
+	healthTimeout = 3 * time.Second
+	// healthMinFreeBytes is the free space in TorrentDir below which the
+	// server isn't ready: torrents can't be written.
+	healthMinFreeBytes = 1 << 30
+)
+
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthFail     = "fail"
+)
+
+var errDiskFreeUnsupported = errors.New("disk space check not supported on this platform")
+
+type healthProbe func(ctx context.Context) models.HealthCheck
+
+// healthz handles GET /healthz — liveness: the database answers and the
+// torrent client runs. Not behind auth, for container orchestrators.
+func (s *Server) healthz(c *gin.Context) {
+	s.respondHealth(c, map[string]healthProbe{
+		"database": s.checkDatabase,
+		"torrent":  s.checkTorrentClient,
+	})
+}
+
+// readyz handles GET /readyz — readiness: the liveness checks plus free disk
+// space for torrents and FFmpeg, whose absence only degrades the server
+// (no transcoding, HLS or thumbnails).
+func (s *Server) readyz(c *gin.Context) {
+	s.respondHealth(c, map[string]healthProbe{
+		"database": s.checkDatabase,
+		"torrent":  s.checkTorrentClient,
+		"disk":     s.checkDisk,
+		"ffmpeg":   checkFFmpeg,
+	})
+}
+
+// respondHealth runs probes concurrently and answers 503 if any failed.
+func (s *Server) respondHealth(c *gin.Context, probes map[string]healthProbe) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthTimeout)
+	defer cancel()
+
+	report := models.HealthReport{Status: healthOK, Checks: make(map[string]models.HealthCheck, len(probes))}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, probe := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			check := probe(ctx)
+			check.LatencyMs = time.Since(start).Milliseconds()
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = check
+			switch {
+			case check.Status == healthFail:
+				report.Status = healthFail
+			case check.Status == healthDegraded && report.Status == healthOK:
+				report.Status = healthDegraded
+			}
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if report.Status == healthFail {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
+
+func (s *Server) checkDatabase(ctx context.Context) models.HealthCheck {
+	if err := s.db.Ping(ctx); err != nil {
+		return models.HealthCheck{Status: healthFail, Error: err.Error()}
+	}
+	return models.HealthCheck{Status: healthOK}
+}
+
+func (s *Server) checkTorrentClient(ctx context.Context) models.HealthCheck {
+	if !s.torrentMgr.ClientRunning() {
+		return models.HealthCheck{Status: healthFail, Error: "torrent client is closed"}
+	}
+	return models.HealthCheck{Status: healthOK}
+}
+
+func (s *Server) checkDisk(ctx context.Context) models.HealthCheck {
+	free, err := diskFree(s.config.TorrentDir)
+	if errors.Is(err, errDiskFreeUnsupported) {
+		return models.HealthCheck{Status: healthDegraded, Error: err.Error()}
+	}
+	if err != nil {
+		return models.HealthCheck{Status: healthFail, Error: err.Error()}
+	}
+	if free < healthMinFreeBytes {
+		return models.HealthCheck{Status: healthFail, FreeBytes: free, Error: fmt.Sprintf("less than %d MiB free", healthMinFreeBytes>>20)}
+	}
+	return models.HealthCheck{Status: healthOK, FreeBytes: free}
+}
+
+func checkFFmpeg(ctx context.Context) models.HealthCheck {
+	caps := ffmpeg.Capabilities()
+	if !caps.FFmpeg.Available {
+		return models.HealthCheck{Status: healthDegraded, Error: "ffmpeg not found in PATH"}
+	}
+	if len(caps.Missing) > 0 {
+		features := slices.Sorted(maps.Keys(caps.Missing))
+		return models.HealthCheck{Status: healthDegraded, Error: "unavailable: " + strings.Join(features, ", ")}
+	}
+	return models.HealthCheck{Status: healthOK}
+}
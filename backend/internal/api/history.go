@@ -5,24 +5,76 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/trakt"
+)
+
+const (
+	defaultHistoryPerPage = 50
+	maxHistoryPerPage     = 200
 )
 
 // getHistory handles GET /api/history
 func (s *Server) getHistory(c *gin.Context) {
-	history, err := s.db.GetHistory()
+	f := models.HistoryFilter{
+		Page:      1,
+		PerPage:   defaultHistoryPerPage,
+		MediaType: c.Query("media_type"),
+		Query:     c.Query("q"),
+	}
+	if v := c.Query("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			apierror.Respond(c, http.StatusBadRequest, "invalid page")
+			return
+		}
+		f.Page = page
+	}
+	if v := c.Query("per_page"); v != "" {
+		perPage, err := strconv.Atoi(v)
+		if err != nil || perPage < 1 || perPage > maxHistoryPerPage {
+			apierror.Respond(c, http.StatusBadRequest, "per_page must be between 1 and "+strconv.Itoa(maxHistoryPerPage))
+			return
+		}
+		f.PerPage = perPage
+	}
+	if v := c.Query("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "invalid completed, expected true or false")
+			return
+		}
+		f.Completed = &completed
+	}
+	if f.MediaType != "" && f.MediaType != "movie" && f.MediaType != "tv" {
+		apierror.Respond(c, http.StatusBadRequest, "media_type must be movie or tv")
+		return
+	}
+
+	history, total, err := s.db.GetHistory(profileID(c), f)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get watch history", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get watch history", err.Error())
 		return
 	}
+	if history == nil {
+		history = []models.WatchHistory{}
+	}
 
-	c.JSON(http.StatusOK, history)
+	c.JSON(http.StatusOK, models.HistoryPage{
+		Page:         f.Page,
+		PerPage:      f.PerPage,
+		TotalPages:   (total + f.PerPage - 1) / f.PerPage,
+		TotalResults: total,
+		Results:      history,
+	})
 }
 
 // getContinueWatching handles GET /api/history/continue
 func (s *Server) getContinueWatching(c *gin.Context) {
-	items, err := s.db.GetContinueWatching()
+	items, err := s.db.GetContinueWatching(profileID(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get continue watching", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get continue watching", err.Error())
 		return
 	}
 
@@ -30,6 +82,7 @@ func (s *Server) getContinueWatching(c *gin.Context) {
 }
 
 type updateProgressRequest struct {
+	MediaType  string  `json:"media_type"` // "movie" (default) or "tv"
 	Progress   float64 `json:"progress"`
 	Duration   int     `json:"duration"`
 	Quality    string  `json:"quality"`
@@ -37,6 +90,7 @@ type updateProgressRequest struct {
 	PosterPath string  `json:"poster_path"`
 	Title      string  `json:"title"`
 	Year       int     `json:"year"`
+	Event      string  `json:"event"` // trakt scrobble: start (default), pause or stop
 }
 
 // updateProgress handles PUT /api/history/:tmdb_id
@@ -44,21 +98,35 @@ func (s *Server) updateProgress(c *gin.Context) {
 	tmdbIDStr := c.Param("tmdb_id")
 	tmdbID, err := strconv.Atoi(tmdbIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tmdb_id"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid tmdb_id")
 		return
 	}
 
 	var req updateProgressRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body", "details": err.Error()})
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
 		return
 	}
 
-	if err := s.db.UpsertProgress(tmdbID, req.Title, req.PosterPath, req.Year, req.Duration, req.Progress, req.Quality, req.MagnetURI); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update progress", "details": err.Error()})
+	switch req.MediaType {
+	case "":
+		req.MediaType = "movie"
+	case "movie", "tv":
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "media_type must be movie or tv")
 		return
 	}
 
+	if err := s.db.UpsertProgress(profileID(c), tmdbID, req.MediaType, req.Title, req.PosterPath, req.Year, req.Duration, req.Progress, req.Quality, req.MagnetURI); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to update progress", err.Error())
+		return
+	}
+
+	// Scrobbles identify movies by TMDB ID; shows would need the episode.
+	if s.trakt != nil && req.Duration > 0 && req.MediaType == "movie" {
+		s.scrobble(profileID(c), tmdbID, req.Progress/float64(req.Duration)*100, req.Event)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "progress updated"})
 }
 
@@ -67,14 +135,33 @@ func (s *Server) deleteHistory(c *gin.Context) {
 	tmdbIDStr := c.Param("tmdb_id")
 	tmdbID, err := strconv.Atoi(tmdbIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tmdb_id"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid tmdb_id")
+		return
+	}
+	mediaType := c.DefaultQuery("media_type", "movie")
+	if mediaType != "movie" && mediaType != "tv" {
+		apierror.Respond(c, http.StatusBadRequest, "media_type must be movie or tv")
 		return
 	}
 
-	if err := s.db.DeleteHistory(tmdbID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete history", "details": err.Error()})
+	if err := s.db.DeleteHistory(profileID(c), tmdbID, mediaType); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to delete history", err.Error())
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "history entry deleted"})
 }
+
+// scrobble forwards a progress update to Trakt. Updates past the completion
+// threshold are sent as "stop" so Trakt records the title as watched.
+func (s *Server) scrobble(profile, tmdbID int, percent float64, event string) {
+	action := trakt.ActionStart
+	switch event {
+	case trakt.ActionPause, trakt.ActionStop:
+		action = event
+	}
+	if percent > 90 {
+		action = trakt.ActionStop
+	}
+	s.trakt.Scrobble(profile, tmdbID, min(percent, 100), action)
+}
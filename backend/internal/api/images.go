@@ -0,0 +1,31 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/images"
+)
+
+// getImage handles GET /api/images/:size/:file — TMDB images (e.g.
+// /api/images/w500/abc.jpg) served from the local cache.
+func (s *Server) getImage(c *gin.Context) {
+	path, err := s.images.Get(c.Request.Context(), c.Param("size"), c.Param("file"))
+	if errors.Is(err, images.ErrInvalidPath) {
+		apierror.Respond(c, http.StatusBadRequest, "invalid image path")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to fetch image", err.Error())
+		return
+	}
+
+	// TMDB file names are content-addressed, so they never change.
+	c.Header("Cache-Control", "public, max-age=2592000, immutable")
+	// SVG logos can carry scripts; never run them on this origin.
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.File(path)
+}
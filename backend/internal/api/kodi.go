@@ -0,0 +1,370 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+// The /api/kodi routes are a simplified API for a Kodi addon (or any player
+// that only needs a URL): one call goes from a TMDB ID to a playable stream,
+// and watched state flows back into the watch history.
+
+// kodiCapabilities is what Kodi plays without help, so most files are
+// served as they are.
+var kodiCapabilities = models.ClientCapabilities{
+	Containers:  []string{"mp4", "matroska", "webm", "avi"},
+	VideoCodecs: []string{"h264", "hevc", "vp8", "vp9", "av1", "mpeg4", "mpeg2video", "vc1"},
+	AudioCodecs: []string{"aac", "ac3", "eac3", "dts", "truehd", "mp3", "mp2", "opus", "vorbis", "flac", "pcm_s16le"},
+}
+
+// kodiItem identifies what to play: a movie, or an episode of a show.
+type kodiItem struct {
+	TMDbID    int
+	MediaType string // "movie" or "tv"
+	Season    int
+	Episode   int
+}
+
+// kodiTitle is the TMDB metadata a torrent search and the history need.
+type kodiTitle struct {
+	Title      string
+	Year       string
+	IMDbID     string
+	PosterPath string
+}
+
+type kodiPlayResponse struct {
+	URL            string               `json:"url"` // absolute, with api_key when the request had one
+	SessionID      string               `json:"session_id"`
+	Title          string               `json:"title"`
+	Season         int                  `json:"season,omitempty"`
+	Episode        int                  `json:"episode,omitempty"`
+	ResumePosition float64              `json:"resume_position,omitempty"` // seconds
+	Torrent        models.TorrentResult `json:"torrent"`
+}
+
+type kodiWatchedItem struct {
+	TMDbID    int     `json:"tmdb_id"`
+	MediaType string  `json:"media_type"`
+	Title     string  `json:"title"`
+	Year      int     `json:"year,omitempty"`
+	Position  float64 `json:"position"` // seconds
+	Duration  int     `json:"duration"` // seconds
+	Watched   bool    `json:"watched"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+type kodiWatchedRequest struct {
+	TMDbID     int     `json:"tmdb_id" binding:"required"`
+	MediaType  string  `json:"media_type"` // "movie" (default) or "tv"
+	Title      string  `json:"title"`      // looked up on TMDB if empty
+	Year       int     `json:"year"`
+	PosterPath string  `json:"poster_path"`
+	Position   float64 `json:"position"` // seconds
+	Duration   int     `json:"duration"` // seconds
+	// Watched marks the title as seen regardless of position. Without a
+	// duration, only movies can be marked.
+	Watched bool `json:"watched"`
+}
+
+// kodiPlay handles GET /api/kodi/play?tmdb_id=&type=movie|tv&season=&episode=&redirect=1
+// — searches torrents for the title, starts a stream of the best-ranked one
+// (the episode's file in season packs) and returns its URL. With redirect=1
+// it redirects to the stream instead, so the URL can go in a .strm file.
+func (s *Server) kodiPlay(c *gin.Context) {
+	item, ok := parseKodiItem(c)
+	if !ok {
+		return
+	}
+	meta, err := s.kodiLookup(c.Request.Context(), item)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to look up title", err.Error())
+		return
+	}
+
+	results, err := s.titleTorrents(c, item, meta, s.rankOptions(c, item.MediaType == "tv"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to search torrents", err.Error())
+		return
+	}
+	best, ok := torrent.Best(results, "")
+	if !ok {
+		apierror.Respond(c, http.StatusNotFound, "no playable torrents found")
+		return
+	}
+
+	year, _ := strconv.Atoi(meta.Year)
+	req := startStreamRequest{TMDbID: item.TMDbID, Title: meta.Title, Season: item.Season, Episode: item.Episode}
+	session, err := s.torrentMgr.Play(models.SourceRequest{
+		TMDbID:       item.TMDbID,
+		Title:        meta.Title,
+		Year:         year,
+		IMDbID:       meta.IMDbID,
+		Season:       item.Season,
+		Episode:      item.Episode,
+		MagnetURI:    best.MagnetURI,
+		Provider:     best.Provider,
+		Quality:      best.Quality,
+		TopicID:      best.TopicID,
+		Client:       c.ClientIP(),
+		Capabilities: &kodiCapabilities,
+
+		AudioLanguage: s.profileAudioLanguage(c),
+	}, -1) // the episode's file in season packs, else the largest video file
+	if err != nil {
+		if respondBusy(c, err) {
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, "failed to start stream", err.Error())
+		return
+	}
+	session = s.withResumePosition(c, session, req)
+
+	streamURL := s.kodiStreamURL(c, session)
+	if c.Query("redirect") == "1" {
+		c.Redirect(http.StatusFound, streamURL)
+		return
+	}
+	c.JSON(http.StatusOK, kodiPlayResponse{
+		URL:            streamURL,
+		SessionID:      session.ID,
+		Title:          meta.Title,
+		Season:         item.Season,
+		Episode:        item.Episode,
+		ResumePosition: session.ResumePosition,
+		Torrent:        best,
+	})
+}
+
+// kodiStrm handles GET /api/kodi/strm?tmdb_id=&type=movie|tv&season=&episode=
+// — a .strm file for the Kodi library whose URL starts the stream through
+// kodiPlay when it's opened.
+func (s *Server) kodiStrm(c *gin.Context) {
+	item, ok := parseKodiItem(c)
+	if !ok {
+		return
+	}
+	meta, err := s.kodiLookup(c.Request.Context(), item)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to look up title", err.Error())
+		return
+	}
+
+	q := url.Values{}
+	q.Set("tmdb_id", strconv.Itoa(item.TMDbID))
+	q.Set("type", item.MediaType)
+	name := meta.Title
+	if meta.Year != "" {
+		name += " (" + meta.Year + ")"
+	}
+	if item.MediaType == "tv" {
+		q.Set("season", strconv.Itoa(item.Season))
+		q.Set("episode", strconv.Itoa(item.Episode))
+		name += fmt.Sprintf(" S%02dE%02d", item.Season, item.Episode)
+	}
+	q.Set("redirect", "1")
+	q.Set("profile", strconv.Itoa(profileID(c)))
+	if s.authEnabled() {
+		q.Set("token", s.kodiPlayToken(q))
+	}
+
+	// Path separators would make Kodi look for the file elsewhere.
+	name = strings.NewReplacer("/", " ", "\\", " ", `"`, "'").Replace(name)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.strm"`, name))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(requestBaseURL(c, s.config.BasePath)+"/api/kodi/play?"+q.Encode()+"\n"))
+}
+
+// getKodiWatched handles GET /api/kodi/watched — the profile's watch
+// history as positions and watched flags, to sync into Kodi's library.
+func (s *Server) getKodiWatched(c *gin.Context) {
+	history, _, err := s.db.GetHistory(profileID(c), models.HistoryFilter{})
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get history", err.Error())
+		return
+	}
+
+	items := make([]kodiWatchedItem, 0, len(history))
+	for _, h := range history {
+		items = append(items, kodiWatchedItem{
+			TMDbID:    h.TMDbID,
+			MediaType: h.MediaType,
+			Title:     h.Title,
+			Year:      h.Year,
+			Position:  h.Progress,
+			Duration:  h.Duration,
+			Watched:   h.Completed,
+			UpdatedAt: h.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// setKodiWatched handles POST /api/kodi/watched — Kodi reports a playback
+// position, or that a title was watched, into the watch history.
+func (s *Server) setKodiWatched(c *gin.Context) {
+	var req kodiWatchedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	switch req.MediaType {
+	case "":
+		req.MediaType = "movie"
+	case "movie", "tv":
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "media_type must be movie or tv")
+		return
+	}
+	if req.Position < 0 || req.Duration < 0 {
+		apierror.Respond(c, http.StatusBadRequest, "position and duration must not be negative")
+		return
+	}
+	if req.Watched && req.Duration == 0 && req.MediaType == "tv" {
+		apierror.Respond(c, http.StatusBadRequest, "duration is required to mark a show watched")
+		return
+	}
+
+	if req.Title == "" {
+		meta, err := s.kodiLookup(c.Request.Context(), kodiItem{TMDbID: req.TMDbID, MediaType: req.MediaType})
+		if err != nil {
+			apierror.Respond(c, http.StatusBadGateway, "failed to look up title", err.Error())
+			return
+		}
+		req.Title, req.PosterPath = meta.Title, meta.PosterPath
+		req.Year, _ = strconv.Atoi(meta.Year)
+	}
+
+	profile := profileID(c)
+	if req.Watched && req.Duration == 0 {
+		err := s.db.MarkWatched(profile, req.TMDbID, req.MediaType, req.Title, req.Year)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, "failed to mark watched", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "marked watched"})
+		return
+	}
+
+	if req.Watched {
+		req.Position = float64(req.Duration)
+	}
+	// Keep the torrent that was played, so "continue watching" resumes it.
+	var quality, magnet string
+	if entry, err := s.db.GetHistoryEntry(profile, req.TMDbID, req.MediaType); err == nil && entry != nil {
+		quality, magnet = entry.Quality, entry.MagnetURI
+	}
+	err := s.db.UpsertProgress(profile, req.TMDbID, req.MediaType, req.Title, req.PosterPath, req.Year, req.Duration, req.Position, quality, magnet)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to update progress", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "progress updated"})
+}
+
+// parseKodiItem reads the title to play from the query, answering 400 if it's
+// invalid.
+func parseKodiItem(c *gin.Context) (kodiItem, bool) {
+	item := kodiItem{MediaType: c.DefaultQuery("type", "movie")}
+	var err error
+	if item.TMDbID, err = strconv.Atoi(c.Query("tmdb_id")); err != nil || item.TMDbID <= 0 {
+		apierror.Respond(c, http.StatusBadRequest, "invalid tmdb_id")
+		return item, false
+	}
+	switch item.MediaType {
+	case "movie":
+	case "tv":
+		item.Season, _ = strconv.Atoi(c.Query("season"))
+		item.Episode, _ = strconv.Atoi(c.Query("episode"))
+		if item.Season < 0 || item.Episode <= 0 {
+			apierror.Respond(c, http.StatusBadRequest, "season and episode are required for tv")
+			return item, false
+		}
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "type must be movie or tv")
+		return item, false
+	}
+	return item, true
+}
+
+// titleTorrents searches torrents of the title (the episode's, for TV)
+// and ranks them with opts, matched against its name and year.
+func (s *Server) titleTorrents(c *gin.Context, item kodiItem, meta kodiTitle, opts torrent.RankOptions) ([]models.TorrentResult, error) {
+	var (
+		results []models.TorrentResult
+		err     error
+	)
+	if item.MediaType == "tv" {
+		results, _, err = s.providers.SearchTV(c.Request.Context(), meta.Title, item.Season, item.Episode, meta.Year)
+	} else {
+		results, _, err = s.providers.Search(c.Request.Context(), meta.Title, meta.IMDbID, meta.Year)
+	}
+	if err != nil {
+		return nil, err
+	}
+	opts.Title, opts.Year = meta.Title, meta.Year
+	return torrent.Rank(results, opts), nil
+}
+
+func (s *Server) kodiLookup(ctx context.Context, item kodiItem) (kodiTitle, error) {
+	if item.MediaType == "tv" {
+		show, err := s.tmdb.GetTVDetails(ctx, item.TMDbID)
+		if err != nil {
+			return kodiTitle{}, err
+		}
+		return kodiTitle{Title: show.Name, Year: yearOf(show.FirstAirDate), IMDbID: show.IMDbID, PosterPath: show.PosterPath}, nil
+	}
+	movie, err := s.tmdb.GetDetails(ctx, item.TMDbID)
+	if err != nil {
+		return kodiTitle{}, err
+	}
+	return kodiTitle{Title: movie.Title, Year: yearOf(movie.ReleaseDate), IMDbID: movie.IMDbID, PosterPath: movie.PosterPath}, nil
+}
+
+// kodiStreamURL returns the absolute URL of a session's stream, with a stream
+// token when auth is on. Transcoded streams keep every audio track, which
+// Kodi can switch between.
+func (s *Server) kodiStreamURL(c *gin.Context, session *models.StreamSession) string {
+	q := url.Values{}
+	if session.NeedsTranscode {
+		q.Set("audio", "all")
+	}
+	if s.authEnabled() {
+		q.Set("token", s.streamToken(session.ID))
+	}
+	u := requestBaseURL(c, s.config.BasePath) + "/api/stream/" + session.ID
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// requestBaseURL returns the server URL as the client reached it, including
+// the base path, which is also accepted on direct requests.
+func requestBaseURL(c *gin.Context, basePath string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	host := c.Request.Host
+	if fwd := c.GetHeader("X-Forwarded-Host"); fwd != "" {
+		host = fwd
+	}
+	return scheme + "://" + host + basePath
+}
+
+// yearOf returns the year of a TMDB date (YYYY-MM-DD), or "".
+func yearOf(date string) string {
+	if len(date) < 4 {
+		return ""
+	}
+	return date[:4]
+}
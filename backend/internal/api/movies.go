@@ -5,13 +5,14 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
 )
 
 // searchMovies handles GET /api/movies/search?q={query}&page={page}
 func (s *Server) searchMovies(c *gin.Context) {
 	query := c.Query("q")
 	if query == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter 'q' is required"})
+		apierror.Respond(c, http.StatusBadRequest, "query parameter 'q' is required")
 		return
 	}
 
@@ -20,9 +21,9 @@ func (s *Server) searchMovies(c *gin.Context) {
 		page = 1
 	}
 
-	results, err := s.tmdb.Search(query, page)
+	results, err := s.tmdb.Search(c.Request.Context(), query, page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search movies", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to search movies", err.Error())
 		return
 	}
 
@@ -31,9 +32,9 @@ func (s *Server) searchMovies(c *gin.Context) {
 
 // getTrending handles GET /api/movies/trending
 func (s *Server) getTrending(c *gin.Context) {
-	results, err := s.tmdb.GetTrending()
+	results, err := s.tmdb.GetTrending(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get trending movies", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get trending movies", err.Error())
 		return
 	}
 
@@ -47,9 +48,9 @@ func (s *Server) getPopular(c *gin.Context) {
 		page = 1
 	}
 
-	results, err := s.tmdb.GetPopular(page)
+	results, err := s.tmdb.GetPopular(c.Request.Context(), page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get popular movies", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get popular movies", err.Error())
 		return
 	}
 
@@ -61,15 +62,16 @@ func (s *Server) getMovieDetails(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid movie ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid movie ID")
 		return
 	}
 
-	movie, err := s.tmdb.GetDetails(id)
+	movie, err := s.tmdb.GetDetails(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get movie details", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get movie details", err.Error())
 		return
 	}
+	movie.Kinopoisk, movie.Ratings = s.externalMetadata(c, movie.IMDbID)
 
 	c.JSON(http.StatusOK, movie)
 }
@@ -78,7 +80,7 @@ func (s *Server) getMovieDetails(c *gin.Context) {
 func (s *Server) searchMulti(c *gin.Context) {
 	query := c.Query("q")
 	if query == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter 'q' is required"})
+		apierror.Respond(c, http.StatusBadRequest, "query parameter 'q' is required")
 		return
 	}
 
@@ -87,9 +89,9 @@ func (s *Server) searchMulti(c *gin.Context) {
 		page = 1
 	}
 
-	results, err := s.tmdb.SearchMulti(query, page)
+	results, err := s.tmdb.SearchMulti(c.Request.Context(), query, page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to search", err.Error())
 		return
 	}
 
@@ -98,9 +100,9 @@ func (s *Server) searchMulti(c *gin.Context) {
 
 // getTrendingAll handles GET /api/trending — unified trending movies+TV
 func (s *Server) getTrendingAll(c *gin.Context) {
-	results, err := s.tmdb.GetTrendingAll()
+	results, err := s.tmdb.GetTrendingAll(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get trending", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get trending", err.Error())
 		return
 	}
 
@@ -114,9 +116,9 @@ func (s *Server) getPopularHDRezka(c *gin.Context) {
 		return
 	}
 
-	items, err := s.hdrezka.GetPopular()
+	items, err := s.hdrezka.GetPopular(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get hdrezka popular", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get hdrezka popular", err.Error())
 		return
 	}
 
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/models"
+)
+
+// notificationListLimit is the default and maximum ?limit of
+// GET /api/notifications.
+const notificationListLimit = 100
+
+type notificationList struct {
+	Notifications []models.Notification `json:"notifications"`
+	Unread        int                   `json:"unread"`
+}
+
+type unreadCount struct {
+	Unread int `json:"unread"`
+}
+
+type markReadRequest struct {
+	IDs []int `json:"ids"` // empty: all
+}
+
+// getNotifications handles GET /api/notifications?unread=1&limit= — the
+// profile's notifications, newest first, with the unread count.
+func (s *Server) getNotifications(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(notificationListLimit)))
+	if err != nil || limit < 1 {
+		apierror.Respond(c, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	limit = min(limit, notificationListLimit)
+
+	list, err := s.db.ListNotifications(profileID(c), c.Query("unread") == "1", limit)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to list notifications", err.Error())
+		return
+	}
+	unread, err := s.db.CountUnreadNotifications(profileID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to count notifications", err.Error())
+		return
+	}
+	if list == nil {
+		list = []models.Notification{}
+	}
+
+	c.JSON(http.StatusOK, notificationList{Notifications: list, Unread: unread})
+}
+
+// getUnreadNotifications handles GET /api/notifications/unread — the unread
+// count, cheap enough to poll for a badge.
+func (s *Server) getUnreadNotifications(c *gin.Context) {
+	unread, err := s.db.CountUnreadNotifications(profileID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to count notifications", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, unreadCount{Unread: unread})
+}
+
+// markNotificationsRead handles POST /api/notifications/read — marks the
+// given notifications, or all of them without ids, as read.
+func (s *Server) markNotificationsRead(c *gin.Context) {
+	var req markReadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+			return
+		}
+	}
+
+	if err := s.db.MarkNotificationsRead(profileID(c), req.IDs); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to mark notifications read", err.Error())
+		return
+	}
+	s.getUnreadNotifications(c)
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/openapi"
+)
+
+// openAPIVersion is the version of the API described by /api/openapi.json.
+const openAPIVersion = "1.0.0"
+
+// Response bodies the handlers build with gin.H, spelled out for the
+// OpenAPI document.
+type (
+	torrentResults struct {
+		Results   []models.TorrentResult  `json:"results"`
+		Providers []models.ProviderStatus `json:"providers"`
+	}
+	subtitleResults struct {
+		Results []models.SubtitleResult `json:"results"`
+	}
+	downloadList struct {
+		Downloads []models.Download `json:"downloads"`
+	}
+	torrentFileList struct {
+		Files []models.TorrentFile `json:"files"`
+	}
+	castDeviceList struct {
+		Devices []models.CastDevice `json:"devices"`
+	}
+	sessionList struct {
+		Sessions []models.SessionInfo `json:"sessions"`
+	}
+	message struct {
+		Message string `json:"message"`
+	}
+	stoppedStreams struct {
+		Message string `json:"message"`
+		Stopped int    `json:"stopped"`
+	}
+	authStatus struct {
+		Enabled       bool `json:"enabled"`
+		PasswordLogin bool `json:"password_login"`
+		Authenticated bool `json:"authenticated"`
+	}
+	subtitleOffset struct {
+		OffsetMs int64 `json:"offset_ms"`
+	}
+	streamRateLimit struct {
+		DownloadKBps *int `json:"download_kbps"` // null removes the limit
+	}
+	streamSinglePlayer struct {
+		Enabled bool `json:"enabled"`
+	}
+	castSeekRequest struct {
+		Position *float64 `json:"position" binding:"required"`
+	}
+	magnetRequest struct {
+		MagnetURI string `json:"magnet_uri" binding:"required"`
+	}
+	playMethod struct {
+		Method string `json:"play_method"`
+		Reason string `json:"play_reason,omitempty"`
+	}
+)
+
+var (
+	pageParam    = openapi.Param{Name: "page", Type: "integer", Description: "1-based page number"}
+	searchParam  = openapi.Param{Name: "q", Description: "search query", Required: true}
+	liveParam    = openapi.Param{Name: "live", Description: "1 to skip cached results"}
+	refreshParam = openapi.Param{Name: "refresh", Description: "1 to search the providers again instead of using cached results"}
+	strictParam  = openapi.Param{Name: "strict", Description: "1 to drop releases whose name doesn't match the title and year, 0 to only flag them"}
+	// Result filters of the torrent searches.
+	providersParam = openapi.Param{Name: "providers", Description: "comma-separated providers to search, e.g. yts,rutracker (default: all)"}
+	minSeedsParam  = openapi.Param{Name: "min_seeds", Type: "integer", Description: "drop releases with fewer seeders"}
+	qualityParam   = openapi.Param{Name: "quality", Description: "comma-separated accepted qualities, e.g. 1080p,2160p"}
+	maxSizeParam   = openapi.Param{Name: "max_size_gb", Type: "number", Description: "drop larger releases"}
+	audioLangParam = openapi.Param{Name: "audio_lang", Description: "keep only releases with audio in this language (ISO 639 code)"}
+	profileParam   = openapi.Param{Name: "profile", Type: "integer", Description: "profile ID, instead of the X-Profile-ID header"}
+)
+
+// kodiItemParams are the query parameters naming a title for the /api/kodi
+// routes, followed by extra.
+func kodiItemParams(extra ...openapi.Param) []openapi.Param {
+	return append([]openapi.Param{
+		{Name: "tmdb_id", Type: "integer", Required: true},
+		{Name: "type", Description: "movie (default) or tv"},
+		{Name: "season", Type: "integer", Description: "tv only"},
+		{Name: "episode", Type: "integer", Description: "tv only"},
+	}, append(extra, profileParam)...)
+}
+
+// apiDocs documents the routes registered in setupRoutes, keyed by
+// "METHOD path". Routes missing here are still listed, without schemas.
+var apiDocs = map[string]openapi.Route{
+	"POST /api/auth/login":  {Tag: "auth", Summary: "Log in with the configured username and password", Body: loginRequest{}, Response: message{}},
+	"POST /api/auth/logout": {Tag: "auth", Summary: "Clear the session cookie", Response: message{}},
+	"GET /api/auth/status":  {Tag: "auth", Summary: "Whether auth is enabled and the request is authenticated", Response: authStatus{}},
+
+	"GET /api/movies/search":   {Tag: "movies", Summary: "Search movies on TMDB", Query: []openapi.Param{searchParam, pageParam}, Response: models.MovieSearchResult{}},
+	"GET /api/movies/trending": {Tag: "movies", Summary: "Movies trending this week", Response: []models.Movie{}},
+	"GET /api/movies/popular":  {Tag: "movies", Summary: "Popular movies", Query: []openapi.Param{pageParam}, Response: models.MovieSearchResult{}},
+	"GET /api/movies/:id":      {Tag: "movies", Summary: "Movie details", Response: models.Movie{}},
+
+	"GET /api/tv/search":             {Tag: "tv", Summary: "Search TV shows on TMDB", Query: []openapi.Param{searchParam, pageParam}, Response: models.TVShowSearchResult{}},
+	"GET /api/tv/trending":           {Tag: "tv", Summary: "TV shows trending this week", Response: []models.TVShow{}},
+	"GET /api/tv/popular":            {Tag: "tv", Summary: "Popular TV shows", Query: []openapi.Param{pageParam}, Response: models.TVShowSearchResult{}},
+	"GET /api/tv/:id":                {Tag: "tv", Summary: "TV show details", Response: models.TVShow{}},
+	"GET /api/tv/:id/season/:season": {Tag: "tv", Summary: "Season details with episodes", Response: models.Season{}},
+	"GET /api/search":                {Tag: "movies", Summary: "Search movies and TV shows", Query: []openapi.Param{searchParam, pageParam}, Response: models.MediaSearchResult{}},
+	"GET /api/trending":              {Tag: "movies", Summary: "Movies and TV shows trending this week", Response: []models.MediaItem{}},
+	"GET /api/images/:size/:file":    {Tag: "movies", Summary: "TMDB image, cached locally", Produces: "image/*"},
+	"GET /api/popular/hdrezka":       {Tag: "hdrezka", Summary: "Popular titles on HDRezka", Response: []models.HDRezkaItem{}},
+	"GET /api/hdrezka/search":        {Tag: "hdrezka", Summary: "Search HDRezka", Query: []openapi.Param{searchParam}, Response: []models.HDRezkaItem{}},
+	"GET /api/anime/search":          {Tag: "anime", Summary: "Search anime on AniList", Query: []openapi.Param{searchParam}, Response: []models.Anime{}},
+	"GET /api/anime/:id":             {Tag: "anime", Summary: "Anime details", Response: models.Anime{}},
+	"GET /api/anime/torrents":        {Tag: "anime", Summary: "Search anime torrents", Query: []openapi.Param{{Name: "title", Required: true}, {Name: "episode", Type: "integer"}, liveParam, refreshParam, strictParam, providersParam, minSeedsParam, qualityParam, maxSizeParam, audioLangParam}, Response: torrentResults{}},
+	"GET /api/torrents/search":       {Tag: "torrents", Summary: "Search movie torrents", Query: []openapi.Param{{Name: "title", Required: true}, {Name: "imdb_id"}, {Name: "year"}, liveParam, refreshParam, strictParam, providersParam, minSeedsParam, qualityParam, maxSizeParam, audioLangParam}, Response: torrentResults{}},
+	"GET /api/torrents/search/tv":    {Tag: "torrents", Summary: "Search TV torrents", Query: []openapi.Param{{Name: "title", Required: true}, {Name: "season", Type: "integer"}, {Name: "episode", Type: "integer", Description: "one episode; its season packs are found too"}, {Name: "year"}, {Name: "audio", Description: "preferred audio language"}, profileParam, liveParam, refreshParam, strictParam, providersParam, minSeedsParam, qualityParam, maxSizeParam, audioLangParam}, Response: torrentResults{}},
+	"POST /api/torrents/files":       {Tag: "torrents", Summary: "List a torrent's files", Body: magnetRequest{}, Response: torrentFileList{}},
+	"POST /api/torrents/inspect":     {Tag: "torrents", Summary: "Inspect a magnet without streaming it", Body: inspectTorrentRequest{}, Response: models.MagnetInspection{}},
+	"GET /api/torrents/stats": {Tag: "torrents", Summary: "Torrent client and active torrent statistics", Query: []openapi.Param{
+		{Name: "pieces", Type: "string", Description: "0 leaves out each torrent's piece completion map"},
+		{Name: "verbose", Type: "string", Description: "1 adds the client's status report, with tracker announce results"},
+	}, Response: models.ClientStats{}},
+	"PUT /api/torrents/:hash/seeding":    {Tag: "torrents", Summary: "Override the seeding policy for a torrent", Body: models.SeedOverride{}, Response: models.SeedOverride{}},
+	"DELETE /api/torrents/:hash/seeding": {Tag: "torrents", Summary: "Restore the configured seeding policy for a torrent", Response: message{}},
+	"POST /api/torrents/check":           {Tag: "torrents", Summary: "Check whether a torrent has peers", Body: inspectTorrentRequest{}, Response: models.TorrentHealth{}},
+	"POST /api/torrents/upload":          {Tag: "torrents", Summary: "Add a .torrent file", Upload: "file", Response: models.MagnetInspection{}},
+
+	"GET /api/stream":                      {Tag: "stream", Summary: "List active stream sessions", Response: sessionList{}},
+	"DELETE /api/stream":                   {Tag: "stream", Summary: "Stop all streams", Response: stoppedStreams{}},
+	"POST /api/stream/start":               {Tag: "stream", Summary: "Start streaming a torrent or HDRezka title", Body: startStreamRequest{}, Response: models.StreamSession{}},
+	"POST /api/stream/auto":                {Tag: "stream", Summary: "Search a title's torrents and stream the best one", Body: autoStreamRequest{}, Response: autoStreamResponse{}},
+	"GET /api/stream/:id":                  {Tag: "stream", Summary: "Stream the video file (supports Range)", Query: []openapi.Param{{Name: "original", Description: "1 to serve the file without transcoding"}, {Name: "token", Description: "stream token from playlist.m3u, instead of other auth"}, {Name: "takeover", Description: "1 to take a single-player session over from another client"}, {Name: "resolution", Description: "target video height for transcoding, e.g. 720p (0 unsets)"}, {Name: "max_bitrate", Description: "cap on transcoded video in kb/s (0 unsets)"}, {Name: "audio_channels", Description: "downmix audio with more channels, e.g. 2 for stereo (0 unsets)"}, {Name: "tonemap", Description: "1 to tone-map HDR video to SDR, transcoding it; 0 to stop"}}, Produces: "video/*"},
+	"GET /api/stream/:id/status":           {Tag: "stream", Summary: "Download and buffering status", Response: models.StreamStatus{}},
+	"GET /api/stream/:id/playlist.m3u":     {Tag: "stream", Summary: "M3U playlist with the stream's URL for VLC, mpv or IINA", Query: []openapi.Param{{Name: "format", Description: "strm for a bare URL"}}, Produces: "audio/x-mpegurl"},
+	"GET /api/stream/:id/events":           {Tag: "stream", Summary: "Server-Sent Events with StreamStatus updates", Produces: "text/event-stream"},
+	"GET /api/stream/:id/hls/:file":        {Tag: "stream", Summary: "HLS playlist or segment", Produces: "application/vnd.apple.mpegurl"},
+	"GET /api/stream/:id/dash/:file":       {Tag: "stream", Summary: "DASH manifest (manifest.mpd) or segment", Produces: "application/dash+xml"},
+	"GET /api/stream/:id/thumbnails.vtt":   {Tag: "stream", Summary: "Seek preview thumbnails track", Produces: "text/vtt"},
+	"GET /api/stream/:id/thumbnails/:file": {Tag: "stream", Summary: "Seek preview thumbnail sprite", Produces: "image/jpeg"},
+	"GET /api/stream/:id/subtitles/:track": {Tag: "stream", Summary: "Embedded subtitle track as WebVTT", Produces: "text/vtt"},
+	"PUT /api/stream/:id/subtitle-offset":  {Tag: "stream", Summary: "Set the subtitle offset", Body: subtitleOffset{}, Response: subtitleOffset{}},
+	"PUT /api/stream/:id/capabilities":     {Tag: "stream", Summary: "Report what the player can play and decide the play method again", Body: models.ClientCapabilities{}, Response: playMethod{}},
+	"PUT /api/stream/:id/rate-limit":       {Tag: "stream", Summary: "Set the session's download limit", Body: streamRateLimit{}, Response: streamRateLimit{}},
+	"PUT /api/stream/:id/single-player":    {Tag: "stream", Summary: "Allow only one client to play the session at a time", Body: streamSinglePlayer{}, Response: streamSinglePlayer{}},
+	"DELETE /api/stream/:id":               {Tag: "stream", Summary: "Stop a stream", Response: message{}},
+	"POST /api/stream/:id/fallback":        {Tag: "stream", Summary: "Switch to the suggested fallback torrent", Response: models.StreamSession{}},
+	"GET /api/stream/:id/resume":           {Tag: "stream", Summary: "Resume a stopped session", Response: models.StreamSession{}},
+	"GET /api/stream/:id/next":             {Tag: "stream", Summary: "Start the next episode", Response: models.StreamSession{}},
+	"POST /api/stream/:id/playhead":        {Tag: "stream", Summary: "Report the playback position", Body: playheadRequest{}, Response: message{}},
+
+	"POST /api/downloads":            {Tag: "downloads", Summary: "Download a torrent for offline playback", Body: startDownloadRequest{}, Response: models.Download{}},
+	"GET /api/downloads":             {Tag: "downloads", Summary: "List downloads", Query: []openapi.Param{{Name: "status"}}, Response: downloadList{}},
+	"GET /api/downloads/library":     {Tag: "downloads", Summary: "Completed downloads", Response: downloadList{}},
+	"GET /api/downloads/:id":         {Tag: "downloads", Summary: "Download details", Response: models.Download{}},
+	"POST /api/downloads/:id/pause":  {Tag: "downloads", Summary: "Pause a download", Response: models.Download{}},
+	"POST /api/downloads/:id/resume": {Tag: "downloads", Summary: "Resume a download", Response: models.Download{}},
+	"POST /api/downloads/:id/play":   {Tag: "downloads", Summary: "Start a stream session for a download", Response: models.StreamSession{}},
+	"DELETE /api/downloads/:id":      {Tag: "downloads", Summary: "Delete a download", Query: []openapi.Param{{Name: "files", Description: "non-empty to delete the files too"}}, Response: message{}},
+
+	"GET /api/settings": {Tag: "settings", Summary: "Runtime settings", Response: models.Settings{}},
+	"PUT /api/settings": {Tag: "settings", Summary: "Update runtime settings", Body: models.Settings{}, Response: models.Settings{}},
+	"GET /api/export":   {Tag: "settings", Summary: "Export profiles, history, watchlists and settings", Response: models.UserDataExport{}},
+	"POST /api/import":  {Tag: "settings", Summary: "Import an export", Query: []openapi.Param{{Name: "on_conflict", Description: "newest (default), skip or overwrite"}}, Body: models.UserDataExport{}, Response: models.ImportResult{}},
+
+	"GET /api/cast/devices":        {Tag: "cast", Summary: "Discovered Chromecast devices", Query: []openapi.Param{{Name: "refresh", Description: "non-empty to rescan"}}, Response: castDeviceList{}},
+	"POST /api/cast/:device/load":  {Tag: "cast", Summary: "Cast a session or URL", Body: castLoadRequest{}, Response: models.CastStatus{}},
+	"POST /api/cast/:device/play":  {Tag: "cast", Summary: "Resume playback", Response: models.CastStatus{}},
+	"POST /api/cast/:device/pause": {Tag: "cast", Summary: "Pause playback", Response: models.CastStatus{}},
+	"POST /api/cast/:device/seek":  {Tag: "cast", Summary: "Seek to a position in seconds", Body: castSeekRequest{}, Response: models.CastStatus{}},
+	"POST /api/cast/:device/stop":  {Tag: "cast", Summary: "Stop casting", Response: message{}},
+	"GET /api/cast/:device/status": {Tag: "cast", Summary: "Playback status", Response: models.CastStatus{}},
+
+	"GET /api/subtitles/search":       {Tag: "subtitles", Summary: "Search subtitles", Query: []openapi.Param{{Name: "imdb_id"}, {Name: "session", Description: "stream session to match by file hash"}, {Name: "lang", Description: "language code, default en"}}, Response: subtitleResults{}},
+	"GET /api/subtitles/download/:id": {Tag: "subtitles", Summary: "Download a subtitle as WebVTT", Query: []openapi.Param{{Name: "offset_ms", Type: "integer"}, {Name: "session"}}, Produces: "text/vtt"},
+
+	"GET /api/profiles":        {Tag: "profiles", Summary: "List profiles", Response: []models.Profile{}},
+	"POST /api/profiles":       {Tag: "profiles", Summary: "Create a profile", Body: profileRequest{}, Response: models.Profile{}},
+	"GET /api/profiles/:id":    {Tag: "profiles", Summary: "Profile details", Response: models.Profile{}},
+	"PUT /api/profiles/:id":    {Tag: "profiles", Summary: "Update a profile", Body: profileRequest{}, Response: message{}},
+	"DELETE /api/profiles/:id": {Tag: "profiles", Summary: "Delete a profile and its data", Response: message{}},
+
+	"GET /api/history": {Tag: "history", Summary: "Watch history, newest first", Query: []openapi.Param{
+		pageParam,
+		{Name: "per_page", Type: "integer", Description: "1-200, default 50"},
+		{Name: "completed", Type: "boolean"},
+		{Name: "media_type", Description: "movie or tv"},
+		{Name: "q", Description: "title search"},
+		profileParam,
+	}, Response: models.HistoryPage{}},
+	"GET /api/history/continue":      {Tag: "history", Summary: "Titles in progress", Query: []openapi.Param{profileParam}, Response: []models.WatchHistory{}},
+	"PUT /api/history/:tmdb_id":      {Tag: "history", Summary: "Save playback progress", Query: []openapi.Param{profileParam}, Body: updateProgressRequest{}, Response: message{}},
+	"POST /api/history/:tmdb_id":     {Tag: "history", Summary: "Save playback progress (for sendBeacon)", Query: []openapi.Param{profileParam}, Body: updateProgressRequest{}, Response: message{}},
+	"DELETE /api/history/:tmdb_id":   {Tag: "history", Summary: "Remove a history entry", Query: []openapi.Param{{Name: "media_type", Description: "movie (default) or tv"}, profileParam}, Response: message{}},
+	"GET /api/stats":                 {Tag: "history", Summary: "Watch statistics", Query: []openapi.Param{{Name: "year", Type: "integer"}, profileParam}, Response: models.WatchStats{}},
+	"GET /api/watchlist":             {Tag: "watchlist", Summary: "Watchlist", Query: []openapi.Param{profileParam}, Response: []models.WatchlistItem{}},
+	"PUT /api/watchlist/:tmdb_id":    {Tag: "watchlist", Summary: "Add to the watchlist", Query: []openapi.Param{profileParam}, Body: watchlistRequest{}, Response: message{}},
+	"DELETE /api/watchlist/:tmdb_id": {Tag: "watchlist", Summary: "Remove from the watchlist", Query: []openapi.Param{{Name: "media_type", Description: "movie (default) or tv"}, profileParam}, Response: message{}},
+
+	"GET /api/notifications":        {Tag: "notifications", Summary: "New episode notifications, newest first, with the unread count", Query: []openapi.Param{{Name: "unread", Description: "1 for unread only"}, {Name: "limit", Type: "integer", Description: "at most 100 (default)"}, profileParam}, Response: notificationList{}},
+	"GET /api/notifications/unread": {Tag: "notifications", Summary: "Unread notification count", Query: []openapi.Param{profileParam}, Response: unreadCount{}},
+	"POST /api/notifications/read":  {Tag: "notifications", Summary: "Mark notifications read (all without ids)", Query: []openapi.Param{profileParam}, Body: markReadRequest{}, Response: unreadCount{}},
+
+	"GET /api/calendar": {Tag: "calendar", Summary: "Upcoming episodes of followed shows and digital releases of watchlist movies, by date", Query: []openapi.Param{{Name: "from", Description: "first date, YYYY-MM-DD (default today)"}, {Name: "days", Type: "integer", Description: "1 to 90 (default 30)"}, {Name: "format", Description: "json (default) or ics for an iCalendar feed"}, profileParam}, Response: models.Calendar{}},
+
+	"GET /api/kodi/play":     {Tag: "kodi", Summary: "Search, start the best torrent and return its stream URL in one call", Query: kodiItemParams(openapi.Param{Name: "redirect", Description: "1 to redirect to the stream, for .strm files"}), Response: kodiPlayResponse{}},
+	"GET /api/kodi/strm":     {Tag: "kodi", Summary: "A .strm file for the Kodi library that plays the title when opened", Query: kodiItemParams()},
+	"GET /api/kodi/watched":  {Tag: "kodi", Summary: "Watch history as positions and watched flags", Query: []openapi.Param{profileParam}, Response: []kodiWatchedItem{}},
+	"POST /api/kodi/watched": {Tag: "kodi", Summary: "Report a playback position or mark a title watched", Query: []openapi.Param{profileParam}, Body: kodiWatchedRequest{}, Response: message{}},
+
+	"POST /api/trakt/device": {Tag: "trakt", Summary: "Start Trakt device authorization", Query: []openapi.Param{profileParam}, Response: models.TraktDeviceCode{}},
+	"GET /api/trakt/status":  {Tag: "trakt", Summary: "Trakt connection status", Query: []openapi.Param{profileParam}, Response: models.TraktStatus{}},
+	"POST /api/trakt/sync":   {Tag: "trakt", Summary: "Sync history and watchlist with Trakt", Query: []openapi.Param{profileParam}, Response: models.TraktSyncResult{}},
+	"DELETE /api/trakt":      {Tag: "trakt", Summary: "Disconnect Trakt", Query: []openapi.Param{profileParam}, Response: message{}},
+
+	"GET /api/system":              {Tag: "system", Summary: "Disk, database and memory usage, uptime and library counts", Response: models.SystemInfo{}},
+	"GET /api/system/capabilities": {Tag: "system", Summary: "FFmpeg capabilities and the features they allow", Response: models.MediaCapabilities{}},
+	"GET /api/openapi.json":        {Tag: "meta", Summary: "This document"},
+}
+
+// getOpenAPI handles GET /api/openapi.json — an OpenAPI 3 description of the
+// API, built from the registered routes on first request.
+func (s *Server) getOpenAPI(c *gin.Context) {
+	s.openAPIOnce.Do(func() {
+		s.openAPI = s.buildOpenAPI()
+	})
+	c.JSON(http.StatusOK, s.openAPI)
+}
+
+func (s *Server) buildOpenAPI() *openapi.Document {
+	routes := s.router.Routes()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	b := openapi.New("StreamBox API", openAPIVersion, s.config.BasePath)
+	for _, r := range routes {
+		if !strings.HasPrefix(r.Path, "/api/") || r.Method == http.MethodHead {
+			continue
+		}
+		b.Add(r.Method, r.Path, handlerName(r.Handler), apiDocs[r.Method+" "+r.Path])
+	}
+	return b.Document()
+}
+
+// handlerName turns a Gin handler name such as
+// "github.com/streambox/backend/internal/api.(*Server).getHistory-fm" into
+// "getHistory".
+func handlerName(full string) string {
+	name := full[strings.LastIndexByte(full, '.')+1:]
+	return strings.TrimSuffix(name, "-fm")
+}
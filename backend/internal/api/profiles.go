@@ -0,0 +1,158 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/models"
+)
+
+// profileHeader selects the profile for history and watchlist requests.
+// The "profile" query parameter works too, for sendBeacon and plain links.
+const profileHeader = "X-Profile-ID"
+
+// withProfile resolves the requesting profile (default profile if none is
+// given) and stores its ID in the context for profileID.
+func (s *Server) withProfile(c *gin.Context) {
+	raw := c.GetHeader(profileHeader)
+	if raw == "" {
+		raw = c.Query("profile")
+	}
+	if raw == "" {
+		c.Set("profile_id", db.DefaultProfileID)
+		c.Next()
+		return
+	}
+
+	id, err := strconv.Atoi(raw)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid profile id")
+		return
+	}
+	profile, err := s.db.GetProfile(id)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get profile", err.Error())
+		return
+	}
+	if profile == nil {
+		apierror.Respond(c, http.StatusNotFound, "profile not found")
+		return
+	}
+
+	c.Set("profile_id", profile.ID)
+	c.Next()
+}
+
+// profileID returns the profile resolved by withProfile.
+func profileID(c *gin.Context) int {
+	return c.GetInt("profile_id")
+}
+
+type profileRequest struct {
+	Name             string `json:"name" binding:"required"`
+	Avatar           string `json:"avatar"`
+	AudioLanguage    string `json:"audio_language"`
+	SubtitleLanguage string `json:"subtitle_language"`
+}
+
+// listProfiles handles GET /api/profiles
+func (s *Server) listProfiles(c *gin.Context) {
+	profiles, err := s.db.ListProfiles()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to list profiles", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, profiles)
+}
+
+// createProfile handles POST /api/profiles
+func (s *Server) createProfile(c *gin.Context) {
+	var req profileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	profile, err := s.db.CreateProfile(models.Profile{
+		Name:             req.Name,
+		Avatar:           req.Avatar,
+		AudioLanguage:    req.AudioLanguage,
+		SubtitleLanguage: req.SubtitleLanguage,
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to create profile", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, profile)
+}
+
+// getProfile handles GET /api/profiles/:id
+func (s *Server) getProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid profile id")
+		return
+	}
+
+	profile, err := s.db.GetProfile(id)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get profile", err.Error())
+		return
+	}
+	if profile == nil {
+		apierror.Respond(c, http.StatusNotFound, "profile not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// updateProfile handles PUT /api/profiles/:id
+func (s *Server) updateProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid profile id")
+		return
+	}
+
+	var req profileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	profile := models.Profile{
+		ID:               id,
+		Name:             req.Name,
+		Avatar:           req.Avatar,
+		AudioLanguage:    req.AudioLanguage,
+		SubtitleLanguage: req.SubtitleLanguage,
+	}
+	if err := s.db.UpdateProfile(profile); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to update profile", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "profile updated"})
+}
+
+// deleteProfile handles DELETE /api/profiles/:id
+func (s *Server) deleteProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid profile id")
+		return
+	}
+
+	if err := s.db.DeleteProfile(id); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to delete profile", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "profile deleted"})
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"golang.org/x/time/rate"
+)
+
+// ipRateLimiter is a token bucket per client IP: perMinute requests a
+// minute, in bursts of up to perMinute. A nil limiter allows everything.
+type ipRateLimiter struct {
+	name      string // in error details, e.g. "search"
+	perMinute int
+
+	mu        sync.Mutex
+	clients   map[string]*clientBucket
+	lastPrune time.Time
+}
+
+type clientBucket struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// newIPRateLimiter returns a limiter allowing perMinute requests per IP, or
+// nil when perMinute is 0.
+func newIPRateLimiter(name string, perMinute int) *ipRateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &ipRateLimiter{
+		name:      name,
+		perMinute: perMinute,
+		clients:   make(map[string]*clientBucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// reserve takes a token for ip, returning how long to wait when none is
+// left.
+func (l *ipRateLimiter) reserve(ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastPrune) > time.Minute {
+		// A bucket idle for a minute has refilled; dropping it changes nothing.
+		for k, b := range l.clients {
+			if now.Sub(b.seen) > time.Minute {
+				delete(l.clients, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	b := l.clients[ip]
+	if b == nil {
+		b = &clientBucket{limiter: rate.NewLimiter(rate.Limit(float64(l.perMinute)/60), l.perMinute)}
+		l.clients[ip] = b
+	}
+	b.seen = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// handle is route middleware answering 429, with Retry-After, to clients
+// over the limit.
+func (l *ipRateLimiter) handle(c *gin.Context) {
+	if l == nil {
+		return
+	}
+	if wait := l.reserve(c.ClientIP()); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		apierror.Respond(c, http.StatusTooManyRequests, "too many requests",
+			fmt.Sprintf("%s is limited to %d requests per minute", l.name, l.perMinute))
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID accepts IDs set by a reverse proxy or client, rejecting
+// anything that could garble the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// assignRequestID tags each request with an ID — the client's or proxy's
+// X-Request-ID if it has one — echoed in the response header and in error
+// bodies. Handlers can log with zerolog.Ctx(c.Request.Context()) to include
+// it; server errors are logged with it by apierror, and every request at
+// debug level when it completes.
+func assignRequestID(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = newRequestID()
+	}
+	c.Set(apierror.RequestIDKey, id)
+	c.Header(requestIDHeader, id)
+
+	logger := log.With().Str("request_id", id).Logger()
+	c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context()))
+
+	start := time.Now()
+	c.Next()
+
+	logger.Debug().
+		Str("method", c.Request.Method).
+		Str("path", c.Request.URL.Path).
+		Int("status", c.Writer.Status()).
+		Dur("duration", time.Since(start)).
+		Msg("request")
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,118 +1,420 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/anilist"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/cast"
 	"github.com/streambox/backend/internal/config"
 	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/dlna"
 	"github.com/streambox/backend/internal/hdrezka"
-	"github.com/streambox/backend/internal/tmdb"
-	"github.com/streambox/backend/internal/torrent"
+	"github.com/streambox/backend/internal/images"
+	"github.com/streambox/backend/internal/kinopoisk"
+	"github.com/streambox/backend/internal/metrics"
+	"github.com/streambox/backend/internal/omdb"
+	"github.com/streambox/backend/internal/openapi"
 	"github.com/streambox/backend/internal/stream"
 	"github.com/streambox/backend/internal/subtitle"
+	"github.com/streambox/backend/internal/tmdb"
+	"github.com/streambox/backend/internal/torrent"
+	"github.com/streambox/backend/internal/trakt"
 )
 
 type Server struct {
-	config         *config.Config
-	router         *gin.Engine
-	tmdb           *tmdb.Client
-	providers      *torrent.ProviderRegistry
-	torrentMgr     *torrent.Manager
-	streamSrv      *stream.Server
-	subtitleClient *subtitle.Client
-	hdrezka        *hdrezka.Client
-	db             *db.DB
+	config      *config.Config
+	router      *gin.Engine
+	tmdb        *tmdb.Client
+	kinopoisk   *kinopoisk.Client // nil unless KINOPOISK_API_KEY is set
+	omdb        *omdb.Client      // nil unless OMDB_API_KEY is set
+	anilist     *anilist.Client
+	providers   *torrent.ProviderRegistry
+	torrentMgr  *torrent.Manager
+	streamSrv   *stream.Server
+	subtitles   *subtitle.Registry
+	hdrezka     *hdrezka.Client
+	images      *images.Cache
+	trakt       *trakt.Client
+	cast        *cast.Manager
+	dlna        *dlna.Server // nil unless DLNA_ENABLED
+	authSecret  []byte       // signs login session cookies
+	httpSrv     *http.Server
+	plainSrv    *http.Server   // HTTP_PORT listener next to HTTPS, if set
+	searchLimit *ipRateLimiter // nil when RATE_LIMIT_SEARCH is 0
+	streamLimit *ipRateLimiter // nil when RATE_LIMIT_STREAM is 0
+	startedAt   time.Time
+	db          db.Store
+
+	openAPIOnce sync.Once
+	openAPI     *openapi.Document // built on first request
+
+	// stopping is cancelled by Shutdown, ending long-lived responses such
+	// as event streams, which would otherwise hold the shutdown up.
+	stopping context.Context
+	stop     context.CancelFunc
 }
 
-func NewServer(cfg *config.Config, database *db.DB, tmdbClient *tmdb.Client, providers *torrent.ProviderRegistry, torrentMgr *torrent.Manager, streamSrv *stream.Server, subClient *subtitle.Client, hdrezkaClient *hdrezka.Client) *Server {
+func NewServer(cfg *config.Config, database db.Store, tmdbClient *tmdb.Client, kinopoiskClient *kinopoisk.Client, omdbClient *omdb.Client, anilistClient *anilist.Client, providers *torrent.ProviderRegistry, torrentMgr *torrent.Manager, streamSrv *stream.Server, subtitles *subtitle.Registry, hdrezkaClient *hdrezka.Client, imageCache *images.Cache, traktClient *trakt.Client, castMgr *cast.Manager) *Server {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
-	r.Use(gin.Recovery())
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Warn().Err(err).Msg("invalid TRUSTED_PROXIES")
+	}
+	r.Use(assignRequestID)
+	r.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
+		apierror.Respond(c, http.StatusInternalServerError, "internal server error", fmt.Sprint(err))
+	}))
+	r.Use(countServedBytes)
 
 	r.Use(cors.New(cors.Config{
-		AllowOriginFunc: func(origin string) bool {
-			return strings.HasPrefix(origin, "http://localhost:")
+		AllowOriginWithContextFunc: func(c *gin.Context, origin string) bool {
+			// Cast receivers fetch media from their own (Google) origin.
+			return strings.HasPrefix(origin, "http://localhost:") || originAllowed(cfg.AllowedOrigins, origin) || isCastMedia(c)
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", apiKeyHeader, profileHeader, requestIDHeader},
+		ExposeHeaders:    []string{requestIDHeader},
 		AllowCredentials: true,
 	}))
 
 	s := &Server{
-		config:         cfg,
-		router:         r,
-		tmdb:           tmdbClient,
-		providers:      providers,
-		torrentMgr:     torrentMgr,
-		streamSrv:      streamSrv,
-		subtitleClient: subClient,
-		hdrezka:        hdrezkaClient,
-		db:             database,
+		config:      cfg,
+		router:      r,
+		tmdb:        tmdbClient,
+		kinopoisk:   kinopoiskClient,
+		omdb:        omdbClient,
+		anilist:     anilistClient,
+		providers:   providers,
+		torrentMgr:  torrentMgr,
+		streamSrv:   streamSrv,
+		subtitles:   subtitles,
+		hdrezka:     hdrezkaClient,
+		images:      imageCache,
+		trakt:       traktClient,
+		cast:        castMgr,
+		db:          database,
+		authSecret:  newAuthSecret(cfg.AuthSecret),
+		searchLimit: newIPRateLimiter("search", cfg.RateLimitSearch),
+		streamLimit: newIPRateLimiter("starting streams", cfg.RateLimitStream),
+		startedAt:   time.Now(),
 	}
+	s.httpSrv = &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
+		Handler: stripBasePath(cfg.BasePath, r),
+	}
+	if cfg.HTTPPort != 0 {
+		s.plainSrv = &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.HTTPPort),
+			Handler: s.httpSrv.Handler,
+		}
+	}
+	if cfg.DLNAEnabled {
+		_, port := lanAddr(cfg)
+		s.dlna = dlna.NewServer(cfg.DLNAName, port, &dlnaLibrary{torrentMgr: torrentMgr})
+		if s.authEnabled() {
+			log.Warn().Msg("dlna is enabled: devices on the local network can browse and play every session without authentication")
+		}
+	}
+
+	s.stopping, s.stop = context.WithCancel(context.Background())
 
 	s.setupRoutes()
 	return s
 }
 
 func (s *Server) setupRoutes() {
-	api := s.router.Group("/api")
+	api := s.router.Group("/api", s.requireAuth)
 	{
+		// Authentication (exempt from requireAuth)
+		api.POST("/auth/login", s.login)
+		api.POST("/auth/logout", s.logout)
+		api.GET("/auth/status", s.getAuthStatus)
+
+		// OpenAPI document for client generators
+		api.GET("/openapi.json", s.getOpenAPI)
+
 		// Movies (TMDB proxy)
-		api.GET("/movies/search", s.searchMovies)
+		api.GET("/movies/search", s.searchLimit.handle, s.searchMovies)
 		api.GET("/movies/trending", s.getTrending)
 		api.GET("/movies/popular", s.getPopular)
 		api.GET("/movies/:id", s.getMovieDetails)
 
 		// TV Shows (TMDB proxy)
-		api.GET("/tv/search", s.searchTV)
+		api.GET("/tv/search", s.searchLimit.handle, s.searchTV)
 		api.GET("/tv/trending", s.getTrendingTV)
 		api.GET("/tv/popular", s.getPopularTV)
 		api.GET("/tv/:id", s.getTVDetails)
 		api.GET("/tv/:id/season/:season", s.getSeasonDetails)
 
 		// Unified search (movies + TV)
-		api.GET("/search", s.searchMulti)
+		api.GET("/search", s.searchLimit.handle, s.searchMulti)
 		api.GET("/trending", s.getTrendingAll)
 
+		// TMDB image proxy/cache
+		api.GET("/images/:size/:file", s.getImage)
+
 		// External popular
 		api.GET("/popular/hdrezka", s.getPopularHDRezka)
 
+		// HDRezka
+		api.GET("/hdrezka/search", s.searchLimit.handle, s.searchHDRezka)
+
+		// Anime
+		api.GET("/anime/search", s.searchLimit.handle, s.searchAnime)
+		api.GET("/anime/torrents", s.searchLimit.handle, s.searchAnimeTorrents)
+		api.GET("/anime/:id", s.getAnime)
+
 		// Torrents
-		api.GET("/torrents/search", s.searchTorrents)
-		api.GET("/torrents/search/tv", s.searchTVTorrents)
-		api.POST("/torrents/files", s.listTorrentFiles)
+		api.GET("/torrents/search", s.searchLimit.handle, s.searchTorrents)
+		api.GET("/torrents/search/tv", s.searchLimit.handle, s.searchTVTorrents)
+		api.POST("/torrents/files", s.streamLimit.handle, s.listTorrentFiles)
+		api.POST("/torrents/inspect", s.streamLimit.handle, s.inspectTorrent)
+		api.POST("/torrents/check", s.streamLimit.handle, s.checkTorrent)
+		api.POST("/torrents/upload", s.streamLimit.handle, s.uploadTorrent)
+		api.GET("/torrents/stats", s.torrentStats)
+		api.PUT("/torrents/:hash/seeding", s.setSeedOverride)
+		api.DELETE("/torrents/:hash/seeding", s.clearSeedOverride)
 
 		// Streaming
-		api.POST("/stream/start", s.startStream)
+		api.GET("/stream", s.listStreams)
+		api.DELETE("/stream", s.stopAllStreams)
+		api.POST("/stream/start", s.streamLimit.handle, s.startStream)
 		api.GET("/stream/:id", s.serveStream)
 		api.GET("/stream/:id/status", s.getStreamStatus)
+		api.GET("/stream/:id/playlist.m3u", s.streamPlaylist)
+		api.GET("/stream/:id/events", s.streamEvents)
+		api.GET("/stream/:id/hls/:file", s.serveHLS)
+		api.GET("/stream/:id/dash/:file", s.serveDASH)
+		api.GET("/stream/:id/thumbnails.vtt", s.serveThumbnails)
+		api.GET("/stream/:id/thumbnails/:file", s.serveThumbnails)
+		api.GET("/stream/:id/subtitles/:track", s.getEmbeddedSubtitle)
+		api.PUT("/stream/:id/subtitle-offset", s.setSubtitleOffset)
+		api.PUT("/stream/:id/capabilities", s.setStreamCapabilities)
+		api.PUT("/stream/:id/rate-limit", s.setStreamRateLimit)
+		api.PUT("/stream/:id/single-player", s.setStreamSinglePlayer)
 		api.DELETE("/stream/:id", s.stopStream)
+		api.POST("/stream/:id/fallback", s.streamLimit.handle, s.acceptFallback)
+		api.GET("/stream/:id/resume", s.streamLimit.handle, s.resumeStream)
+		api.GET("/stream/:id/next", s.streamLimit.handle, s.nextEpisode)
+		api.POST("/stream/:id/playhead", s.updatePlayhead)
+
+		// Offline downloads
+		api.POST("/downloads", s.streamLimit.handle, s.startDownload)
+		api.GET("/downloads", s.listDownloads)
+		api.GET("/downloads/library", s.getLibrary)
+		api.GET("/downloads/:id", s.getDownload)
+		api.POST("/downloads/:id/pause", s.pauseDownload)
+		api.POST("/downloads/:id/resume", s.resumeDownload)
+		api.POST("/downloads/:id/play", s.streamLimit.handle, s.playDownload)
+		api.DELETE("/downloads/:id", s.deleteDownload)
+
+		// Runtime settings (bandwidth limits)
+		api.GET("/settings", s.getSettings)
+		api.PUT("/settings", s.updateSettings)
+
+		// Server environment
+		api.GET("/system", s.getSystemInfo)
+		api.GET("/system/capabilities", s.getCapabilities)
+
+		// Backup and migration between servers
+		api.GET("/export", s.exportData)
+		api.POST("/import", s.importData)
+
+		// Chromecast
+		api.GET("/cast/devices", s.listCastDevices)
+		api.POST("/cast/:device/load", s.castLoad)
+		api.POST("/cast/:device/play", s.castPlay)
+		api.POST("/cast/:device/pause", s.castPause)
+		api.POST("/cast/:device/seek", s.castSeek)
+		api.POST("/cast/:device/stop", s.castStop)
+		api.GET("/cast/:device/status", s.castStatus)
 
 		// Subtitles
-		api.GET("/subtitles/search", s.searchSubtitles)
+		api.GET("/subtitles/search", s.searchLimit.handle, s.searchSubtitles)
 		api.GET("/subtitles/download/:id", s.downloadSubtitle)
 
+		// Profiles
+		api.GET("/profiles", s.listProfiles)
+		api.POST("/profiles", s.createProfile)
+		api.GET("/profiles/:id", s.getProfile)
+		api.PUT("/profiles/:id", s.updateProfile)
+		api.DELETE("/profiles/:id", s.deleteProfile)
+
+		// Per-profile data (X-Profile-ID header or ?profile=)
+		profiled := api.Group("", s.withProfile)
+
 		// Watch History
-		api.GET("/history", s.getHistory)
-		api.GET("/history/continue", s.getContinueWatching)
-		api.PUT("/history/:tmdb_id", s.updateProgress)
-		api.POST("/history/:tmdb_id", s.updateProgress) // sendBeacon can only POST
-		api.DELETE("/history/:tmdb_id", s.deleteHistory)
+		profiled.GET("/history", s.getHistory)
+		profiled.GET("/history/continue", s.getContinueWatching)
+		profiled.PUT("/history/:tmdb_id", s.updateProgress)
+		profiled.POST("/history/:tmdb_id", s.updateProgress) // sendBeacon can only POST
+		profiled.DELETE("/history/:tmdb_id", s.deleteHistory)
+		profiled.GET("/stats", s.getStats)
+
+		// Watchlist
+		profiled.GET("/watchlist", s.getWatchlist)
+		profiled.PUT("/watchlist/:tmdb_id", s.addToWatchlist)
+		profiled.DELETE("/watchlist/:tmdb_id", s.removeFromWatchlist)
+
+		// Notifications
+		profiled.GET("/notifications", s.getNotifications)
+		profiled.GET("/notifications/unread", s.getUnreadNotifications)
+		profiled.POST("/notifications/read", s.markNotificationsRead)
+
+		// Calendar
+		profiled.GET("/calendar", s.getCalendar)
+
+		// Kodi addon
+		profiled.GET("/kodi/play", s.streamLimit.handle, s.kodiPlay)
+		profiled.POST("/stream/auto", s.streamLimit.handle, s.autoStream)
+		profiled.GET("/kodi/strm", s.kodiStrm)
+		profiled.GET("/kodi/watched", s.getKodiWatched)
+		profiled.POST("/kodi/watched", s.setKodiWatched)
+
+		// Trakt.tv
+		profiled.POST("/trakt/device", s.startTraktAuth)
+		profiled.GET("/trakt/status", s.getTraktStatus)
+		profiled.POST("/trakt/sync", s.syncTrakt)
+		profiled.DELETE("/trakt", s.disconnectTrakt)
 	}
 
+	// DLNA media server (UPnP paths are fixed by the device description),
+	// unauthenticated but limited to the LAN
+	if s.dlna != nil {
+		lan := s.router.Group("/", dlnaLANOnly)
+		s.dlna.Routes(lan)
+		lan.GET("/dlna/media/:id", s.serveDLNAMedia)
+		lan.HEAD("/dlna/media/:id", s.serveDLNAMedia)
+		lan.GET("/dlna/download/:id", s.serveDLNADownload)
+		lan.HEAD("/dlna/download/:id", s.serveDLNADownload)
+	}
+
+	// Liveness and readiness probes for container orchestrators (no auth)
+	s.router.GET("/healthz", s.healthz)
+	s.router.HEAD("/healthz", s.healthz)
+	s.router.GET("/readyz", s.readyz)
+	s.router.HEAD("/readyz", s.readyz)
+
+	// Prometheus metrics (API key or login required when auth is enabled)
+	s.router.GET("/metrics", s.requireAuth, gin.WrapH(metrics.Handler()))
+
 	// Serve React SPA static files
 	s.router.Static("/assets", "./static/assets")
 	s.router.NoRoute(func(c *gin.Context) {
 		if !strings.HasPrefix(c.Request.URL.Path, "/api/") {
-			c.File("./static/index.html")
+			s.serveIndex(c)
 		}
 	})
 }
 
+// servedRoutes are the media routes whose response bytes are counted in
+// streambox_bytes_served_total.
+var servedRoutes = map[string]bool{
+	"/api/stream/:id":            true,
+	"/api/stream/:id/hls/:file":  true,
+	"/api/stream/:id/dash/:file": true,
+	"/dlna/media/:id":            true,
+	"/dlna/download/:id":         true,
+}
+
+// countServedBytes counts media bytes as they are written, so long-running
+// streams show up in the metrics while they play.
+func countServedBytes(c *gin.Context) {
+	if route := c.FullPath(); servedRoutes[route] {
+		c.Writer = &countingWriter{ResponseWriter: c.Writer, served: metrics.BytesServed.With(route)}
+	}
+	c.Next()
+}
+
+type countingWriter struct {
+	gin.ResponseWriter
+	served *metrics.Counter
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.served.Add(float64(n))
+	return n, err
+}
+
+func (w *countingWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.served.Add(float64(n))
+	return n, err
+}
+
+// Run serves HTTP until Shutdown is called.
 func (s *Server) Run() error {
-	addr := fmt.Sprintf(":%d", s.config.Port)
-	return s.router.Run(addr)
+	if s.dlna != nil {
+		if err := s.dlna.Start(); err != nil {
+			log.Warn().Err(err).Msg("dlna media server disabled")
+		}
+	}
+
+	if !s.config.TLSEnabled() {
+		err := s.httpSrv.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+
+	tlsCfg, plain, err := tlsConfig(s.config, s.httpSrv.Handler)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	s.httpSrv.TLSConfig = tlsCfg
+	if s.plainSrv != nil {
+		s.plainSrv.Handler = plain
+		go func() {
+			if err := s.plainSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Int("port", s.config.HTTPPort).Msg("plain http listener failed")
+			}
+		}()
+	} else if s.dlna != nil {
+		log.Warn().Msg("DLNA clients can't play over HTTPS; set HTTP_PORT for a plain listener")
+	}
+
+	err = s.httpSrv.ListenAndServeTLS("", "")
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops the server: it ends event streams and kills running
+// transcodes (their responses never end on their own), drains remaining
+// requests until ctx expires, then persists sessions and drops all torrents.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stop()
+	if s.dlna != nil {
+		s.dlna.Close()
+	}
+	s.streamSrv.Close()
+
+	if s.plainSrv != nil {
+		go func() {
+			if s.plainSrv.Shutdown(ctx) != nil {
+				s.plainSrv.Close()
+			}
+		}()
+	}
+	err := s.httpSrv.Shutdown(ctx)
+	if err != nil {
+		// Long-running direct streams are cut off.
+		s.httpSrv.Close()
+	}
+
+	s.torrentMgr.Close()
+	return err
 }
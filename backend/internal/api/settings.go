@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/models"
+)
+
+// settings returns the current runtime settings: the config defaults,
+// overridden by anything saved through PUT /api/settings.
+func (s *Server) settings() (models.Settings, error) {
+	settings := models.Settings{
+		DownloadLimitKBps: s.config.DownloadLimitKBps,
+		UploadLimitKBps:   s.config.UploadLimitKBps,
+		SessionLimitKBps:  s.config.SessionLimitKBps,
+
+		PreferredAudioLanguages: s.config.PreferredAudioLanguages,
+	}
+	_, err := s.db.GetSetting(db.SettingsKey, &settings)
+	return settings, err
+}
+
+// getSettings handles GET /api/settings
+func (s *Server) getSettings(c *gin.Context) {
+	settings, err := s.settings()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to load settings", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// updateSettings handles PUT /api/settings — fields missing from the body
+// keep their current values. Changes apply immediately and persist across
+// restarts.
+func (s *Server) updateSettings(c *gin.Context) {
+	settings, err := s.settings()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to load settings", err.Error())
+		return
+	}
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	if settings.DownloadLimitKBps < 0 || settings.UploadLimitKBps < 0 || settings.SessionLimitKBps < 0 {
+		apierror.Respond(c, http.StatusBadRequest, "rate limits must not be negative")
+		return
+	}
+
+	if err := s.db.SaveSetting(db.SettingsKey, settings); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to save settings", err.Error())
+		return
+	}
+	s.torrentMgr.SetRateLimits(settings)
+	s.torrentMgr.SetAudioLanguages(settings.PreferredAudioLanguages)
+
+	c.JSON(http.StatusOK, settings)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/models"
+)
+
+const (
+	// statsGenreLookups bounds the TMDB lookups one stats request makes for
+	// titles without saved genres; later requests fill in the rest.
+	statsGenreLookups = 50
+	// statsGenreWorkers is how many of those lookups run at once.
+	statsGenreWorkers = 4
+)
+
+// getStats handles GET /api/stats
+func (s *Server) getStats(c *gin.Context) {
+	var from, to time.Time
+	if v := c.Query("year"); v != "" {
+		year, err := strconv.Atoi(v)
+		if err != nil || year < 1900 || year > 9999 {
+			apierror.Respond(c, http.StatusBadRequest, "invalid year")
+			return
+		}
+		from = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		to = from.AddDate(1, 0, 0)
+	}
+
+	profile := profileID(c)
+	s.fillGenres(c.Request.Context(), profile)
+
+	stats, err := s.db.GetWatchStats(profile, from, to)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get watch stats", err.Error())
+		return
+	}
+	if !from.IsZero() {
+		stats.From = from.Format(time.DateOnly)
+		stats.To = to.Format(time.DateOnly)
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// fillGenres looks up the genres of history titles that have none saved, for
+// the genre ranking. Failures are logged; those titles are retried next time.
+func (s *Server) fillGenres(ctx context.Context, profile int) {
+	titles, err := s.db.TitlesWithoutGenres(profile, statsGenreLookups)
+	if err != nil {
+		log.Warn().Err(err).Int("profile_id", profile).Msg("failed to list titles without genres")
+		return
+	}
+
+	sem := make(chan struct{}, statsGenreWorkers)
+	var wg sync.WaitGroup
+	for _, t := range titles {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(t models.WatchHistory) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			genres, err := s.titleGenres(ctx, t.MediaType, t.TMDbID)
+			if err != nil {
+				log.Warn().Err(err).Int("tmdb_id", t.TMDbID).Str("media_type", t.MediaType).Msg("genre lookup failed")
+				return
+			}
+			if err := s.db.SaveTitleGenres(t.MediaType, t.TMDbID, genres); err != nil {
+				log.Warn().Err(err).Int("tmdb_id", t.TMDbID).Msg("failed to save genres")
+			}
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (s *Server) titleGenres(ctx context.Context, mediaType string, tmdbID int) ([]string, error) {
+	var genres []models.Genre
+	if mediaType == "tv" {
+		show, err := s.tmdb.GetTVDetails(ctx, tmdbID)
+		if err != nil {
+			return nil, err
+		}
+		genres = show.Genres
+	} else {
+		movie, err := s.tmdb.GetDetails(ctx, tmdbID)
+		if err != nil {
+			return nil, err
+		}
+		genres = movie.Genres
+	}
+
+	names := make([]string, 0, len(genres))
+	for _, g := range genres {
+		names = append(names, g.Name)
+	}
+	return names, nil
+}
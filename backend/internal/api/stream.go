@@ -1,16 +1,62 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/admission"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/notify"
+	"github.com/streambox/backend/internal/torrent"
 )
 
+// hdrezkaResolveTimeout bounds finding a title on HDRezka and fetching its
+// stream links.
+const hdrezkaResolveTimeout = 45 * time.Second
+
 type startStreamRequest struct {
 	TMDbID    int    `json:"tmdb_id" binding:"required"`
 	Title     string `json:"title" binding:"required"`
-	MagnetURI string `json:"magnet_uri" binding:"required"`
+	MagnetURI string `json:"magnet_uri"`
+	InfoHash  string `json:"info_hash"` // alternative to magnet_uri
 	FileIndex int    `json:"file_index"`
+	Year      int    `json:"year"`
+	IMDbID    string `json:"imdb_id"`
+	Season    int    `json:"season"`
+	Episode   int    `json:"episode"`
+	// Release the magnet came from (see TorrentResult); used to prefer the
+	// same provider and quality for the next episode, and to fetch the
+	// release's .torrent file where the provider supports it.
+	Provider string `json:"provider"`
+	Quality  string `json:"quality"`
+	TopicID  string `json:"topic_id"`
+	// Source "hdrezka" streams from HDRezka over HLS instead of a torrent;
+	// HDRezkaURL optionally names the title page (see /api/hdrezka/search).
+	Source     string `json:"source"`
+	HDRezkaURL string `json:"hdrezka_url"`
+	// Resume starts transcoded streams where the profile left off watching
+	// (see resume_position in the response).
+	Resume bool `json:"resume"`
+	// Capabilities of the player, which decide whether the file is played
+	// directly, remuxed or transcoded (see play_method in the response).
+	// Browsers' common formats are assumed without them.
+	Capabilities *models.ClientCapabilities `json:"capabilities"`
+	// Async returns the session at once with status "resolving" instead of
+	// waiting for the torrent's metadata; /api/stream/:id/status reports the
+	// progress until it is "buffering" or "ready", or "failed".
+	Async bool `json:"async"`
 }
 
 // startStream handles POST /api/stream/start
@@ -18,76 +64,552 @@ func (s *Server) startStream(c *gin.Context) {
 	var req startStreamRequest
 	req.FileIndex = -1 // default: auto-select largest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body", "details": err.Error()})
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	if req.Source == "hdrezka" {
+		s.startHDRezkaStream(c, req)
 		return
 	}
+	if req.MagnetURI == "" {
+		req.MagnetURI = req.InfoHash
+	}
+	if _, err := torrent.ParseMagnet(req.MagnetURI); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "magnet_uri or info_hash is required", err.Error())
+		return
+	}
+
+	sreq := models.SourceRequest{
+		TMDbID:       req.TMDbID,
+		Title:        req.Title,
+		Year:         req.Year,
+		IMDbID:       req.IMDbID,
+		Season:       req.Season,
+		Episode:      req.Episode,
+		MagnetURI:    req.MagnetURI,
+		Provider:     req.Provider,
+		Quality:      req.Quality,
+		TopicID:      req.TopicID,
+		Client:       c.ClientIP(),
+		Capabilities: req.Capabilities,
 
-	session, err := s.torrentMgr.StartStream(req.TMDbID, req.Title, req.MagnetURI, req.FileIndex)
+		AudioLanguage: s.profileAudioLanguage(c),
+	}
+	if req.Async {
+		// The request is over once the session starts, so the profile is
+		// looked up now.
+		profile := profileID(c)
+		session, err := s.torrentMgr.PlayAsync(sreq, req.FileIndex, func(session *models.StreamSession) {
+			s.resumePosition(profile, session, req)
+		})
+		if err != nil {
+			if respondBusy(c, err) {
+				return
+			}
+			apierror.Respond(c, http.StatusInternalServerError, "failed to start stream", err.Error())
+			return
+		}
+		c.JSON(http.StatusAccepted, session)
+		return
+	}
+
+	session, err := s.torrentMgr.Play(sreq, req.FileIndex)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start stream", "details": err.Error()})
+		if respondBusy(c, err) {
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, "failed to start stream", err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, session)
+	c.JSON(http.StatusOK, s.withResumePosition(c, session, req))
+}
+
+// withResumePosition sets a new session's resume position from the profile's
+// watch history. History is kept per title, so episodes, whose progress
+// can't be told apart there, aren't resumed.
+func (s *Server) withResumePosition(c *gin.Context, session *models.StreamSession, req startStreamRequest) *models.StreamSession {
+	return s.resumePosition(profileID(c), session, req)
+}
+
+// resumePosition is withResumePosition for the given profile.
+func (s *Server) resumePosition(profile int, session *models.StreamSession, req startStreamRequest) *models.StreamSession {
+	if req.Season > 0 || req.Episode > 0 {
+		return session
+	}
+	entry, err := s.db.GetHistoryEntry(profile, req.TMDbID, "movie")
+	if err != nil {
+		log.Warn().Err(err).Int("tmdb_id", req.TMDbID).Msg("failed to look up resume position")
+		return session
+	}
+	if entry == nil || entry.Completed || entry.Progress <= 0 {
+		return session
+	}
+	if resumed := s.torrentMgr.SetResumePosition(session.ID, entry.Progress, req.Resume); resumed != nil {
+		return resumed
+	}
+	return session
+}
+
+// startHDRezkaStream starts a session on the title's HDRezka HLS stream. The
+// playlist and segments are proxied under /api/stream/:id/hls/.
+func (s *Server) startHDRezkaStream(c *gin.Context, req startStreamRequest) {
+	if s.hdrezka == nil {
+		apierror.Write(c, apierror.New(http.StatusServiceUnavailable, "hdrezka is not configured").WithCode(apierror.CodeNotConfigured))
+		return
+	}
+
+	sreq := models.SourceRequest{
+		TMDbID:       req.TMDbID,
+		Title:        req.Title,
+		Year:         req.Year,
+		IMDbID:       req.IMDbID,
+		Season:       req.Season,
+		Episode:      req.Episode,
+		Client:       c.ClientIP(),
+		Capabilities: req.Capabilities,
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), hdrezkaResolveTimeout)
+	defer cancel()
+	ds, err := s.hdrezka.ResolveHLS(ctx, sreq, req.HDRezkaURL)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to resolve hdrezka stream", err.Error())
+		return
+	}
+
+	session, err := s.torrentMgr.PlayDirect(sreq, "hdrezka", ds)
+	if err != nil {
+		if respondBusy(c, err) {
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, "failed to start stream", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, s.withResumePosition(c, session, req))
+}
+
+// respondBusy answers 429 if err is an *admission.BusyError, with the
+// client's place in the queue, reporting whether it did.
+func respondBusy(c *gin.Context, err error) bool {
+	var busy *admission.BusyError
+	if !errors.As(err, &busy) {
+		return false
+	}
+	c.Header("Retry-After", "5")
+	apierror.Write(c, apierror.New(http.StatusTooManyRequests, "server busy").WithCode(apierror.CodeBusy).WithDetails(busy.Error()).WithData(busy))
+	return true
 }
 
 // serveStream handles GET /api/stream/:id
 func (s *Server) serveStream(c *gin.Context) {
 	sessionID := c.Param("id")
 	if sessionID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "session ID is required"})
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
 		return
 	}
 
 	s.streamSrv.ServeStream(c, sessionID)
 }
 
+// streamPlaylist handles GET /api/stream/:id/playlist.m3u?format=strm — a
+// playlist holding the stream's URL, to hand playback to VLC, mpv or IINA.
+// The URL serves the original file, which those players handle without
+// transcoding, and carries a stream token (see streamToken) when auth is on.
+func (s *Server) streamPlaylist(c *gin.Context) {
+	sess := s.torrentMgr.GetSession(c.Param("id"))
+	if sess == nil {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+
+	q := url.Values{}
+	q.Set("original", "1")
+	if s.authEnabled() {
+		q.Set("token", s.streamToken(sess.ID))
+	}
+	streamURL := requestBaseURL(c, s.config.BasePath) + "/api/stream/" + sess.ID + "?" + q.Encode()
+
+	title := sess.Title + notify.EpisodeLabel(sess.Season, sess.Episode)
+	name := strings.NewReplacer("/", " ", "\\", " ", `"`, "'").Replace(title)
+	if c.Query("format") == "strm" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.strm"`, name))
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(streamURL+"\n"))
+		return
+	}
+
+	duration := -1
+	if sess.Duration > 0 {
+		duration = int(sess.Duration)
+	}
+	// Newlines in the title would end the #EXTINF line.
+	title = strings.NewReplacer("\r", " ", "\n", " ").Replace(title)
+	playlist := fmt.Sprintf("#EXTM3U\n#EXTINF:%d,%s\n%s\n", duration, title, streamURL)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.m3u"`, name))
+	c.Data(http.StatusOK, "audio/x-mpegurl; charset=utf-8", []byte(playlist))
+}
+
+// serveHLS handles GET /api/stream/:id/hls/:file — the HLS playlist
+// (playlist.m3u8) and its segments, for players that can't handle the
+// fragmented-MP4 pipe.
+func (s *Server) serveHLS(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+
+	s.streamSrv.ServeHLS(c, sessionID, c.Param("file"))
+}
+
+// serveDASH handles GET /api/stream/:id/dash/:file — the DASH manifest
+// (manifest.mpd) and its segments, cut by the same segmenter as HLS.
+func (s *Server) serveDASH(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+
+	s.streamSrv.ServeDASH(c, sessionID, c.Param("file"))
+}
+
+// serveThumbnails handles GET /api/stream/:id/thumbnails.vtt — a WebVTT
+// track of seek-bar preview thumbnails — and GET /api/stream/:id/thumbnails/:file,
+// the sprite sheets its cues point into.
+func (s *Server) serveThumbnails(c *gin.Context) {
+	file := c.Param("file")
+	if file == "" {
+		file = "thumbnails.vtt"
+	}
+	s.streamSrv.ServeThumbnails(c, c.Param("id"), file)
+}
+
+// getEmbeddedSubtitle handles GET /api/stream/:id/subtitles/:track — an
+// embedded subtitle track (see subtitle_tracks in the session) as WebVTT.
+func (s *Server) getEmbeddedSubtitle(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+
+	track, err := strconv.Atoi(c.Param("track"))
+	if err != nil || track < 0 {
+		apierror.Respond(c, http.StatusBadRequest, "invalid subtitle track")
+		return
+	}
+
+	s.streamSrv.ServeSubtitle(c, sessionID, track)
+}
+
 // getStreamStatus handles GET /api/stream/:id/status
 func (s *Server) getStreamStatus(c *gin.Context) {
 	sessionID := c.Param("id")
 	if sessionID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "session ID is required"})
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
 		return
 	}
 
 	status, err := s.torrentMgr.GetStatus(sessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get stream status", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get stream status", err.Error())
 		return
 	}
 
 	c.JSON(http.StatusOK, status)
 }
 
+const (
+	// statusPushInterval is how often status is sampled for the event feed.
+	statusPushInterval = time.Second
+	// statusKeepAlive resends an unchanged status so idle proxies keep the
+	// connection open.
+	statusKeepAlive = 15 * time.Second
+)
+
+// streamEvents handles GET /api/stream/:id/events — a Server-Sent Events feed
+// that pushes a "status" event (StreamStatus) whenever it changes, replacing
+// status polling. An "end" event is sent when the session goes away; the
+// feed also ends when the server shuts down.
+func (s *Server) streamEvents(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+	if s.torrentMgr.GetSession(sessionID) == nil && !s.torrentMgr.Resolving(sessionID) {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // disable nginx response buffering
+
+	ticker := time.NewTicker(statusPushInterval)
+	defer ticker.Stop()
+
+	var (
+		last     []byte
+		lastSent time.Time
+	)
+	c.Stream(func(w io.Writer) bool {
+		status, err := s.torrentMgr.GetStatus(sessionID)
+		if err != nil {
+			c.SSEvent("end", gin.H{"error": err.Error()})
+			return false
+		}
+
+		data, _ := json.Marshal(status)
+		if !bytes.Equal(data, last) || time.Since(lastSent) >= statusKeepAlive {
+			c.SSEvent("status", status)
+			last, lastSent = data, time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		case <-s.stopping.Done():
+			return false
+		}
+	})
+}
+
 // listTorrentFiles handles POST /api/torrents/files
 func (s *Server) listTorrentFiles(c *gin.Context) {
 	var req struct {
 		MagnetURI string `json:"magnet_uri" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body", "details": err.Error()})
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
 		return
 	}
 
 	files, err := s.torrentMgr.ListFiles(req.MagnetURI)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list files", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to list files", err.Error())
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"files": files})
 }
 
+// acceptFallback handles POST /api/stream/:id/fallback — switches a stalled
+// session to the smaller release prepared by the stall watchdog.
+func (s *Server) acceptFallback(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+
+	session, err := s.torrentMgr.AcceptFallback(sessionID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to switch to fallback", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// nextEpisode handles GET /api/stream/:id/next — prepares and pre-buffers the
+// episode after the one playing, for gapless autoplay.
+func (s *Server) nextEpisode(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+
+	session, err := s.torrentMgr.Next(c.Request.Context(), sessionID)
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, "next episode not available", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// resumeStream handles GET /api/stream/:id/resume — restores a session after a
+// restart and returns it with the last transcoded position to seek back to.
+func (s *Server) resumeStream(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+
+	session, err := s.torrentMgr.Resume(sessionID)
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, "failed to resume stream", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+type playheadRequest struct {
+	Position *float64 `json:"position"` // seconds
+	Offset   *int64   `json:"offset"`   // bytes, for direct-play clients
+}
+
+// updatePlayhead handles POST /api/stream/:id/playhead — the client reports
+// where it is playing so pieces around that point are downloaded first.
+func (s *Server) updatePlayhead(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+
+	var req playheadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	var err error
+	switch {
+	case req.Offset != nil:
+		err = s.torrentMgr.SetPlayheadOffset(sessionID, *req.Offset)
+	case req.Position != nil:
+		err = s.torrentMgr.SetPlayhead(sessionID, *req.Position)
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "position or offset is required")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to update playhead", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "playhead updated"})
+}
+
+// setSubtitleOffset handles PUT /api/stream/:id/subtitle-offset — stores a
+// timing offset applied to every subtitle served for the session, to fix
+// out-of-sync subtitles without searching again.
+func (s *Server) setSubtitleOffset(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+
+	var req struct {
+		OffsetMs int64 `json:"offset_ms"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	if s.torrentMgr.GetSession(sessionID) == nil {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+
+	s.torrentMgr.SetSubtitleOffset(sessionID, req.OffsetMs)
+	c.JSON(http.StatusOK, gin.H{"offset_ms": req.OffsetMs})
+}
+
+// setStreamCapabilities handles PUT /api/stream/:id/capabilities — the
+// player reports the containers and codecs it can play, e.g. when the stream
+// moves to another device, and the session's play method is decided again.
+func (s *Server) setStreamCapabilities(c *gin.Context) {
+	var caps models.ClientCapabilities
+	if err := c.ShouldBindJSON(&caps); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	session, err := s.torrentMgr.SetCapabilities(c.Param("id"), caps)
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+	c.JSON(http.StatusOK, playMethod{Method: session.PlayMethod, Reason: session.PlayReason})
+}
+
+// setStreamRateLimit handles PUT /api/stream/:id/rate-limit — overrides the
+// session's download limit in KiB/s (0 = unlimited, null = the default from
+// /api/settings) until the session ends.
+func (s *Server) setStreamRateLimit(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+
+	var req struct {
+		DownloadKBps *int `json:"download_kbps"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	kbps := -1 // restore the default
+	if req.DownloadKBps != nil {
+		if *req.DownloadKBps < 0 {
+			apierror.Respond(c, http.StatusBadRequest, "download_kbps must not be negative")
+			return
+		}
+		kbps = *req.DownloadKBps
+	}
+
+	if !s.torrentMgr.SetSessionRateLimit(sessionID, kbps) {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"download_kbps": req.DownloadKBps})
+}
+
+// setStreamSinglePlayer handles PUT /api/stream/:id/single-player — while
+// enabled, only one client may play the session at a time; others get 409
+// unless they take it over with ?takeover=1.
+func (s *Server) setStreamSinglePlayer(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
+		return
+	}
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	if !s.torrentMgr.SetSinglePlayer(sessionID, req.Enabled) {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": req.Enabled})
+}
+
+// listStreams handles GET /api/stream — every running session with its
+// status, client count and download speed, for the admin page.
+func (s *Server) listStreams(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"sessions": s.torrentMgr.ListSessions()})
+}
+
+// stopAllStreams handles DELETE /api/stream — stops every running session.
+func (s *Server) stopAllStreams(c *gin.Context) {
+	stopped := s.torrentMgr.StopAll()
+	c.JSON(http.StatusOK, gin.H{"message": "streams stopped", "stopped": stopped})
+}
+
 // stopStream handles DELETE /api/stream/:id
 func (s *Server) stopStream(c *gin.Context) {
 	sessionID := c.Param("id")
 	if sessionID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "session ID is required"})
+		apierror.Respond(c, http.StatusBadRequest, "session ID is required")
 		return
 	}
 
 	if err := s.torrentMgr.StopSession(sessionID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stop stream", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to stop stream", err.Error())
 		return
 	}
 
@@ -1,55 +1,91 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/subtitle"
 )
 
-// searchSubtitles handles GET /api/subtitles/search?imdb_id={id}&lang={en}
+// movieHashTimeout bounds how long a subtitle search waits for the ends of
+// the torrent file to download for hashing.
+const movieHashTimeout = 20 * time.Second
+
+// searchSubtitles handles GET /api/subtitles/search?imdb_id={id}&lang={en}&session={id}
+// Results from all subtitle providers are merged. With session, the playing
+// file's hash is sent too so subtitles for that exact release come first
+// (hash_match); imdb_id is then optional.
 func (s *Server) searchSubtitles(c *gin.Context) {
-	if s.subtitleClient == nil {
-		c.JSON(http.StatusNotImplemented, gin.H{"error": "subtitles not configured"})
+	if s.subtitles.Len() == 0 {
+		apierror.Respond(c, http.StatusNotImplemented, "subtitles not configured")
 		return
 	}
 
 	imdbID := c.Query("imdb_id")
-	if imdbID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter 'imdb_id' is required"})
+	sessionID := c.Query("session")
+	if imdbID == "" && sessionID == "" {
+		apierror.Respond(c, http.StatusBadRequest, "query parameter 'imdb_id' or 'session' is required")
 		return
 	}
 
 	lang := c.DefaultQuery("lang", "en")
 
-	results, err := s.subtitleClient.Search(imdbID, lang)
+	var movieHash string
+	if sessionID != "" {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), movieHashTimeout)
+		hash, err := s.torrentMgr.MovieHash(ctx, sessionID)
+		cancel()
+		if err != nil {
+			log.Warn().Err(err).Str("session_id", sessionID).Msg("movie hash unavailable, searching by imdb id")
+		}
+		movieHash = hash
+	}
+	if imdbID == "" && movieHash == "" {
+		apierror.Respond(c, http.StatusBadRequest, "could not hash session file and no imdb_id given")
+		return
+	}
+
+	results, err := s.subtitles.Search(c.Request.Context(), subtitle.Query{IMDbID: imdbID, Lang: lang, MovieHash: movieHash})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search subtitles", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to search subtitles", err.Error())
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"results": results})
 }
 
-// downloadSubtitle handles GET /api/subtitles/download/:id
+// downloadSubtitle handles GET /api/subtitles/download/:id?offset_ms={ms}&session={id}
+// Cues are shifted by offset_ms, or else by the session's stored offset.
 func (s *Server) downloadSubtitle(c *gin.Context) {
-	if s.subtitleClient == nil {
-		c.JSON(http.StatusNotImplemented, gin.H{"error": "subtitles not configured"})
+	if s.subtitles.Len() == 0 {
+		apierror.Respond(c, http.StatusNotImplemented, "subtitles not configured")
 		return
 	}
 
-	idStr := c.Param("id")
-	fileID, err := strconv.Atoi(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subtitle file ID"})
-		return
+	var offset int64
+	if o := c.Query("offset_ms"); o != "" {
+		parsed, err := strconv.ParseInt(o, 10, 64)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "invalid offset_ms")
+			return
+		}
+		offset = parsed
+	} else if id := c.Query("session"); id != "" {
+		if sess := s.torrentMgr.GetSession(id); sess != nil {
+			offset = sess.SubtitleOffset
+		}
 	}
 
-	data, err := s.subtitleClient.Download(fileID)
+	data, err := s.subtitles.Download(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to download subtitle", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to download subtitle", err.Error())
 		return
 	}
 
-	c.Data(http.StatusOK, "text/vtt", data)
+	c.Data(http.StatusOK, "text/vtt", subtitle.ShiftVTT(data, offset))
 }
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/models"
+)
+
+// getSystemInfo handles GET /api/system — disk, database and memory usage,
+// uptime, and session and library counts for a diagnostics page.
+func (s *Server) getSystemInfo(c *gin.Context) {
+	dbInfo, err := s.db.DatabaseInfo()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get database info", err.Error())
+		return
+	}
+	library, err := s.db.LibraryCounts()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to count library", err.Error())
+		return
+	}
+	disk, err := s.diskUsage()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to measure disk usage", err.Error())
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	c.JSON(http.StatusOK, models.SystemInfo{
+		StartedAt:     s.startedAt.UTC(),
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+		GoVersion:     runtime.Version(),
+		Disk:          disk,
+		Database:      *dbInfo,
+		Memory: models.MemoryUsage{
+			HeapAllocBytes: mem.HeapAlloc,
+			SysBytes:       mem.Sys,
+			Goroutines:     runtime.NumGoroutine(),
+			GCCycles:       mem.NumGC,
+		},
+		ActiveSessions: len(s.torrentMgr.ListSessions()),
+		Library:        *library,
+	})
+}
+
+// diskUsage sums the space taken by the files in TorrentDir.
+func (s *Server) diskUsage() (models.DiskUsage, error) {
+	usage := models.DiskUsage{
+		Path:       s.config.TorrentDir,
+		LimitBytes: int64(s.config.MaxCacheGB) << 30,
+	}
+	err := filepath.WalkDir(s.config.TorrentDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // deleted while walking, or no torrents yet
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				usage.UsedBytes += allocatedSize(fi)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return usage, err
+	}
+	if free, err := diskFree(s.config.TorrentDir); err == nil {
+		usage.FreeBytes = free
+	}
+	return usage, nil
+}
+
+// getCapabilities handles GET /api/system/capabilities — the FFmpeg and
+// FFprobe versions, encoders and hardware accelerations found at startup,
+// and which features they allow.
+func (s *Server) getCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, ffmpeg.Capabilities())
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/streambox/backend/internal/config"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	selfSignedCertFile = "selfsigned.crt"
+	selfSignedKeyFile  = "selfsigned.key"
+	selfSignedValidity = 365 * 24 * time.Hour
+	// selfSignedRenewBefore regenerates the certificate this long before it
+	// expires.
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+)
+
+// lanAddr returns the scheme and port devices on the LAN (Cast, DLNA) reach
+// the server on: the plain HTTP listener when HTTPS is on and HTTP_PORT is
+// set, since those devices don't trust our certificates.
+func lanAddr(cfg *config.Config) (scheme string, port int) {
+	switch {
+	case !cfg.TLSEnabled():
+		return "http", cfg.Port
+	case cfg.HTTPPort != 0:
+		return "http", cfg.HTTPPort
+	default:
+		return "https", cfg.Port
+	}
+}
+
+// tlsConfig returns the HTTPS configuration for the configured certificate
+// source. For ACME it also wraps the plain HTTP handler to answer HTTP-01
+// challenges; without a plain listener, TLS-ALPN-01 on PORT is used.
+func tlsConfig(cfg *config.Config, plain http.Handler) (*tls.Config, http.Handler, error) {
+	switch {
+	case cfg.TLSCertFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load certificate: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, plain, nil
+
+	case len(cfg.ACMEDomains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+			Cache:      autocert.DirCache(filepath.Join(cfg.TLSDir, "acme")),
+			Email:      cfg.ACMEEmail,
+		}
+		return m.TLSConfig(), m.HTTPHandler(plain), nil
+
+	default:
+		cert, err := selfSignedCertificate(cfg.TLSDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, plain, nil
+	}
+}
+
+// selfSignedCertificate loads the self-signed certificate kept in dir, making
+// a new one when there is none, it is about to expire or it doesn't cover the
+// current addresses. Keeping it lets browsers remember an exception.
+func selfSignedCertificate(dir string) (tls.Certificate, error) {
+	certPath, keyPath := filepath.Join(dir, selfSignedCertFile), filepath.Join(dir, selfSignedKeyFile)
+	hosts, ips := certificateNames()
+
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err == nil && time.Until(leaf.NotAfter) > selfSignedRenewBefore && coversAll(leaf, hosts, ips) {
+			return cert, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate serial: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"StreamBox"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              hosts,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("encode key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return tls.Certificate{}, fmt.Errorf("create tls dir: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, fmt.Errorf("save key: %w", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return tls.Certificate{}, fmt.Errorf("save certificate: %w", err)
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// certificateNames returns the host names and addresses the server is
+// reached by on the LAN: localhost, the host name and the interface IPs.
+func certificateNames() ([]string, []net.IP) {
+	hosts := []string{"localhost"}
+	if name, err := os.Hostname(); err == nil && name != "" && name != "localhost" {
+		hosts = append(hosts, name, name+".local")
+	}
+
+	var ips []net.IP
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	if len(ips) == 0 {
+		ips = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	}
+	return hosts, ips
+}
+
+func coversAll(cert *x509.Certificate, hosts []string, ips []net.IP) bool {
+	for _, h := range hosts {
+		if !slices.Contains(cert.DNSNames, h) {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,48 +1,374 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
 )
 
-// searchTorrents handles GET /api/torrents/search?tmdb_id={id}&title={title}&year={year}&imdb_id={imdb}
+const (
+	// liveStatsLimit is how many top search results get a live tracker/DHT
+	// scrape when ?live=1 is passed.
+	liveStatsLimit = 10
+	// maxTorrentFileSize caps .torrent uploads.
+	maxTorrentFileSize = 10 << 20
+)
+
+// searchProviders returns the provider registry for a search request: just
+// the providers listed in ?providers=, bypassing cached results with
+// ?refresh=1.
+func (s *Server) searchProviders(c *gin.Context) (*torrent.ProviderRegistry, error) {
+	providers := s.providers
+	if names := splitList(c.Query("providers")); len(names) > 0 {
+		var err error
+		if providers, err = providers.Only(names); err != nil {
+			return nil, err
+		}
+	}
+	if c.Query("refresh") == "1" {
+		providers = providers.Fresh()
+	}
+	return providers, nil
+}
+
+// resultFilter parses a search's result filters: ?min_seeds=, ?quality=
+// (comma-separated), ?max_size_gb= and ?audio_lang=.
+func resultFilter(c *gin.Context) (torrent.ResultFilter, error) {
+	f := torrent.ResultFilter{
+		Qualities:     splitList(c.Query("quality")),
+		AudioLanguage: c.Query("audio_lang"),
+	}
+	if raw := c.Query("min_seeds"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return f, errors.New("min_seeds must be a non-negative integer")
+		}
+		f.MinSeeds = n
+	}
+	if raw := c.Query("max_size_gb"); raw != "" {
+		gb, err := strconv.ParseFloat(raw, 64)
+		if err != nil || gb <= 0 {
+			return f, errors.New("max_size_gb must be a positive number")
+		}
+		f.MaxSizeBytes = int64(gb * (1 << 30))
+	}
+	return f, nil
+}
+
+// splitList splits a comma-separated query parameter, dropping blanks.
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// searchRequest is a search handler's providers and ranking options, or
+// false after responding with the error.
+func (s *Server) searchRequest(c *gin.Context, series bool) (*torrent.ProviderRegistry, torrent.RankOptions, bool) {
+	opts := s.rankOptions(c, series)
+	filter, err := resultFilter(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+		return nil, opts, false
+	}
+	opts.Filter = filter
+	providers, err := s.searchProviders(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+		return nil, opts, false
+	}
+	return providers, opts, true
+}
+
+// providerErrors describes why each provider failed, for error details.
+func providerErrors(statuses []models.ProviderStatus) string {
+	details := make([]string, 0, len(statuses))
+	for _, st := range statuses {
+		details = append(details, st.Provider+": "+st.Error)
+	}
+	return strings.Join(details, "; ")
+}
+
+// searchTorrents handles GET /api/torrents/search?tmdb_id={id}&title={title}&year={year}&imdb_id={imdb}&live={0|1}&audio={lang}&refresh={0|1}&strict={0|1}&providers={names}&min_seeds={n}&quality={q}&max_size_gb={gb}&audio_lang={lang}
 func (s *Server) searchTorrents(c *gin.Context) {
 	title := c.Query("title")
 	if title == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter 'title' is required"})
+		apierror.Respond(c, http.StatusBadRequest, "query parameter 'title' is required")
 		return
 	}
 
 	imdbID := c.Query("imdb_id")
 	year := c.Query("year")
+	providers, opts, ok := s.searchRequest(c, false)
+	if !ok {
+		return
+	}
 
-	results, err := s.providers.Search(title, imdbID, year)
+	results, statuses, err := providers.Search(c.Request.Context(), title, imdbID, year)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search torrents", "details": err.Error()})
+		apierror.Respond(c, http.StatusBadGateway, "failed to search torrents", providerErrors(statuses))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"results": results})
+	// Rank before the live scrape so it covers the best results, then again
+	// with their live seed counts.
+	results = torrent.Rank(results, opts)
+	if c.Query("live") == "1" {
+		s.torrentMgr.AttachLiveStats(results, liveStatsLimit, 8*time.Second)
+		results = torrent.Rank(results, opts)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "providers": statuses})
 }
 
-// searchTVTorrents handles GET /api/torrents/search/tv?title={title}&season={n}&year={year}
+// searchTVTorrents handles GET /api/torrents/search/tv?title={title}&season={n}&episode={n}&year={year}&live={0|1}&audio={lang}&refresh={0|1}&strict={0|1}&providers={names}&min_seeds={n}&quality={q}&max_size_gb={gb}&audio_lang={lang}
 func (s *Server) searchTVTorrents(c *gin.Context) {
 	title := c.Query("title")
 	if title == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter 'title' is required"})
+		apierror.Respond(c, http.StatusBadRequest, "query parameter 'title' is required")
 		return
 	}
 
 	seasonNum, _ := strconv.Atoi(c.DefaultQuery("season", "0"))
+	episode, _ := strconv.Atoi(c.DefaultQuery("episode", "0"))
 	year := c.Query("year")
+	providers, opts, ok := s.searchRequest(c, true)
+	if !ok {
+		return
+	}
+
+	results, statuses, err := providers.SearchTV(c.Request.Context(), title, seasonNum, episode, year)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to search tv torrents", providerErrors(statuses))
+		return
+	}
+
+	// Rank before the live scrape so it covers the best results, then again
+	// with their live seed counts.
+	results = torrent.Rank(results, opts)
+	if c.Query("live") == "1" {
+		s.torrentMgr.AttachLiveStats(results, liveStatsLimit, 8*time.Second)
+		results = torrent.Rank(results, opts)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "providers": statuses})
+}
+
+// rankOptions builds the ranking options for a search: the title and year
+// searched for come from ?title= and ?year=, strict matching from ?strict=
+// or else the config, and the preferred audio language from ?audio= or else
+// the requesting profile, followed by the preferred_audio_languages setting.
+func (s *Server) rankOptions(c *gin.Context, series bool) torrent.RankOptions {
+	opts := torrent.RankOptions{
+		AudioLanguage: c.Query("audio"),
+		CanTranscode:  ffmpeg.Supports(ffmpeg.Transcode),
+		Series:        series,
+		Title:         c.Query("title"),
+		Year:          c.Query("year"),
+		Strict:        s.config.SearchStrictMatch,
+	}
+	if strict := c.Query("strict"); strict != "" {
+		opts.Strict = strict == "1"
+	}
+	if opts.AudioLanguage == "" {
+		opts.AudioLanguage = s.profileAudioLanguage(c)
+	}
+	if settings, err := s.settings(); err == nil {
+		opts.AudioLanguages = settings.PreferredAudioLanguages
+	}
+	return opts
+}
+
+// profileAudioLanguage returns the audio language of the requesting profile
+// (the profile header or ?profile=, else the default profile), if it has one.
+func (s *Server) profileAudioLanguage(c *gin.Context) string {
+	raw := c.GetHeader(profileHeader)
+	if raw == "" {
+		raw = c.Query("profile")
+	}
+	id := db.DefaultProfileID
+	if raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil {
+			id = n
+		}
+	}
+	if profile, err := s.db.GetProfile(id); err == nil && profile != nil {
+		return profile.AudioLanguage
+	}
+	return ""
+}
+
+type inspectTorrentRequest struct {
+	MagnetURI  string `json:"magnet_uri"`
+	InfoHash   string `json:"info_hash"`
+	TimeoutSec int    `json:"timeout_sec"`
+}
+
+// inspectTorrent handles POST /api/torrents/inspect — reports a magnet's name,
+// trackers and (once metadata arrives) its files, without starting a stream.
+func (s *Server) inspectTorrent(c *gin.Context) {
+	var req inspectTorrentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	input := req.MagnetURI
+	if input == "" {
+		input = req.InfoHash
+	}
+	if input == "" {
+		apierror.Respond(c, http.StatusBadRequest, "magnet_uri or info_hash is required")
+		return
+	}
+
+	timeout := 30 * time.Second
+	if req.TimeoutSec > 0 {
+		timeout = time.Duration(min(req.TimeoutSec, 120)) * time.Second
+	}
+
+	result, err := s.torrentMgr.Inspect(input, timeout)
+	if err != nil {
+		if errors.Is(err, torrent.ErrInvalidMagnet) {
+			apierror.Respond(c, http.StatusBadRequest, "invalid magnet", err.Error())
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, "failed to inspect torrent", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// torrentStats handles GET /api/torrents/stats — DHT size, peers, transfer
+// rates and every active torrent's state, for debugging slow streams.
+// ?pieces=0 leaves out the piece maps; ?verbose=1 adds the client's status
+// report with tracker announce results.
+func (s *Server) torrentStats(c *gin.Context) {
+	c.JSON(http.StatusOK, s.torrentMgr.ClientStats(c.Query("pieces") != "0", c.Query("verbose") == "1"))
+}
+
+// setSeedOverride handles PUT /api/torrents/:hash/seeding — overrides the
+// seeding policy for one torrent, e.g. to keep seeding a private tracker's
+// release to a ratio. It applies at once if the torrent is active, and is
+// saved for when it's added otherwise.
+func (s *Server) setSeedOverride(c *gin.Context) {
+	var req models.SeedOverride
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	if !s.updateSeedOverride(c, &req) {
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+// clearSeedOverride handles DELETE /api/torrents/:hash/seeding — restores
+// the configured seeding policy for the torrent.
+func (s *Server) clearSeedOverride(c *gin.Context) {
+	if !s.updateSeedOverride(c, nil) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "seed override removed"})
+}
+
+// updateSeedOverride sets or clears the :hash torrent's seed override,
+// responding with an error and returning false if that fails.
+func (s *Server) updateSeedOverride(c *gin.Context, o *models.SeedOverride) bool {
+	err := s.torrentMgr.SetSeedOverride(c.Param("hash"), o)
+	switch {
+	case errors.Is(err, torrent.ErrInvalidMagnet), errors.Is(err, torrent.ErrInvalidSeedOverride):
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+		return false
+	case err != nil:
+		apierror.Respond(c, http.StatusInternalServerError, "failed to save seed override", err.Error())
+		return false
+	}
+	return true
+}
+
+// checkTorrent handles POST /api/torrents/check — joins the swarm for up to
+// timeout_sec (default 10) and reports whether metadata resolves and how many
+// peers and seeders are reachable, so dead torrents can be flagged up front.
+func (s *Server) checkTorrent(c *gin.Context) {
+	var req inspectTorrentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	input := req.MagnetURI
+	if input == "" {
+		input = req.InfoHash
+	}
+	if input == "" {
+		apierror.Respond(c, http.StatusBadRequest, "magnet_uri or info_hash is required")
+		return
+	}
+
+	timeout := 10 * time.Second
+	if req.TimeoutSec > 0 {
+		timeout = time.Duration(min(req.TimeoutSec, 60)) * time.Second
+	}
+
+	health, err := s.torrentMgr.CheckHealth(input, timeout)
+	if err != nil {
+		if errors.Is(err, torrent.ErrInvalidMagnet) {
+			apierror.Respond(c, http.StatusBadRequest, "invalid magnet", err.Error())
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, "failed to check torrent", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, health)
+}
+
+// uploadTorrent handles POST /api/torrents/upload — accepts a .torrent file
+// (multipart field "file") and returns its magnet URI and files. Streams
+// started from the magnet use the uploaded metadata.
+func (s *Server) uploadTorrent(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxTorrentFileSize+1<<20)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "torrent file is required", err.Error())
+		return
+	}
+	if fh.Size > maxTorrentFileSize {
+		apierror.Respond(c, http.StatusRequestEntityTooLarge, "torrent file too large")
+		return
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to read upload", err.Error())
+		return
+	}
+	defer f.Close()
 
-	results, err := s.providers.SearchTV(title, seasonNum, year)
+	result, err := s.torrentMgr.AddTorrentFile(f)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search tv torrents", "details": err.Error()})
+		if errors.Is(err, torrent.ErrInvalidTorrentFile) {
+			apierror.Respond(c, http.StatusBadRequest, "invalid torrent file", err.Error())
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, "failed to add torrent file", err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"results": results})
+	c.JSON(http.StatusOK, result)
 }
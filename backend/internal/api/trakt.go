@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/trakt"
+)
+
+// startTraktAuth handles POST /api/trakt/device — returns a code the user
+// enters at trakt.tv/activate to link their account to the profile.
+func (s *Server) startTraktAuth(c *gin.Context) {
+	if s.trakt == nil {
+		apierror.Respond(c, http.StatusNotImplemented, "trakt not configured")
+		return
+	}
+
+	code, err := s.trakt.StartDeviceAuth(c.Request.Context(), profileID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "failed to start trakt authorization", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, code)
+}
+
+// getTraktStatus handles GET /api/trakt/status
+func (s *Server) getTraktStatus(c *gin.Context) {
+	if s.trakt == nil {
+		apierror.Respond(c, http.StatusNotImplemented, "trakt not configured")
+		return
+	}
+
+	status, err := s.trakt.Status(profileID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get trakt status", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// syncTrakt handles POST /api/trakt/sync — merges the watchlist and watched
+// movies with the linked Trakt account in both directions.
+func (s *Server) syncTrakt(c *gin.Context) {
+	if s.trakt == nil {
+		apierror.Respond(c, http.StatusNotImplemented, "trakt not configured")
+		return
+	}
+
+	result, err := s.trakt.Sync(c.Request.Context(), profileID(c))
+	if errors.Is(err, trakt.ErrNotConnected) {
+		apierror.Respond(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, "trakt sync failed", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// disconnectTrakt handles DELETE /api/trakt
+func (s *Server) disconnectTrakt(c *gin.Context) {
+	if s.trakt == nil {
+		apierror.Respond(c, http.StatusNotImplemented, "trakt not configured")
+		return
+	}
+
+	if err := s.trakt.Disconnect(c.Request.Context(), profileID(c)); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to disconnect trakt", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "trakt disconnected"})
+}
@@ -5,13 +5,14 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
 )
 
 // searchTV handles GET /api/tv/search?q={query}&page={page}
 func (s *Server) searchTV(c *gin.Context) {
 	query := c.Query("q")
 	if query == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter 'q' is required"})
+		apierror.Respond(c, http.StatusBadRequest, "query parameter 'q' is required")
 		return
 	}
 
@@ -20,9 +21,9 @@ func (s *Server) searchTV(c *gin.Context) {
 		page = 1
 	}
 
-	results, err := s.tmdb.SearchTV(query, page)
+	results, err := s.tmdb.SearchTV(c.Request.Context(), query, page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search tv shows", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to search tv shows", err.Error())
 		return
 	}
 
@@ -31,9 +32,9 @@ func (s *Server) searchTV(c *gin.Context) {
 
 // getTrendingTV handles GET /api/tv/trending
 func (s *Server) getTrendingTV(c *gin.Context) {
-	results, err := s.tmdb.GetTrendingTV()
+	results, err := s.tmdb.GetTrendingTV(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get trending tv shows", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get trending tv shows", err.Error())
 		return
 	}
 
@@ -47,9 +48,9 @@ func (s *Server) getPopularTV(c *gin.Context) {
 		page = 1
 	}
 
-	results, err := s.tmdb.GetPopularTV(page)
+	results, err := s.tmdb.GetPopularTV(c.Request.Context(), page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get popular tv shows", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get popular tv shows", err.Error())
 		return
 	}
 
@@ -61,15 +62,16 @@ func (s *Server) getTVDetails(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid TV show ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid TV show ID")
 		return
 	}
 
-	show, err := s.tmdb.GetTVDetails(id)
+	show, err := s.tmdb.GetTVDetails(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get tv show details", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get tv show details", err.Error())
 		return
 	}
+	show.Kinopoisk, show.Ratings = s.externalMetadata(c, show.IMDbID)
 
 	c.JSON(http.StatusOK, show)
 }
@@ -78,19 +80,19 @@ func (s *Server) getTVDetails(c *gin.Context) {
 func (s *Server) getSeasonDetails(c *gin.Context) {
 	tvID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid TV show ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid TV show ID")
 		return
 	}
 
 	seasonNum, err := strconv.Atoi(c.Param("season"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid season number"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid season number")
 		return
 	}
 
-	season, err := s.tmdb.GetSeasonDetails(tvID, seasonNum)
+	season, err := s.tmdb.GetSeasonDetails(c.Request.Context(), tvID, seasonNum)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get season details", "details": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get season details", err.Error())
 		return
 	}
 
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/models"
+)
+
+// getWatchlist handles GET /api/watchlist
+func (s *Server) getWatchlist(c *gin.Context) {
+	items, err := s.db.GetWatchlist(profileID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to get watchlist", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+type watchlistRequest struct {
+	MediaType  string `json:"media_type"`
+	Title      string `json:"title" binding:"required"`
+	PosterPath string `json:"poster_path"`
+	Year       int    `json:"year"`
+}
+
+// addToWatchlist handles PUT /api/watchlist/:tmdb_id
+func (s *Server) addToWatchlist(c *gin.Context) {
+	tmdbID, err := strconv.Atoi(c.Param("tmdb_id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid tmdb_id")
+		return
+	}
+
+	var req watchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+	if req.MediaType == "" {
+		req.MediaType = "movie"
+	}
+
+	err = s.db.AddToWatchlist(models.WatchlistItem{
+		ProfileID:  profileID(c),
+		TMDbID:     tmdbID,
+		MediaType:  req.MediaType,
+		Title:      req.Title,
+		PosterPath: req.PosterPath,
+		Year:       req.Year,
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to add to watchlist", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "added to watchlist"})
+}
+
+// removeFromWatchlist handles DELETE /api/watchlist/:tmdb_id?media_type={movie|tv}
+func (s *Server) removeFromWatchlist(c *gin.Context) {
+	tmdbID, err := strconv.Atoi(c.Param("tmdb_id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid tmdb_id")
+		return
+	}
+
+	mediaType := c.DefaultQuery("media_type", "movie")
+	if err := s.db.RemoveFromWatchlist(profileID(c), tmdbID, mediaType); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to remove from watchlist", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "removed from watchlist"})
+}
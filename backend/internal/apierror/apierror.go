@@ -0,0 +1,135 @@
+// Package apierror is the error body every API handler responds with, so
+// clients can branch on a stable code and match failures to server logs by
+// request ID.
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// RequestIDKey is the gin context key holding the request's ID.
+const RequestIDKey = "request_id"
+
+// Code classifies an error for clients; unlike messages, codes don't change.
+type Code string
+
+const (
+	CodeInvalidRequest  Code = "invalid_request"
+	CodeUnauthorized    Code = "unauthorized"
+	CodeForbidden       Code = "forbidden"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodePayloadTooLarge Code = "payload_too_large"
+	CodeRateLimited     Code = "rate_limited"
+	CodeBusy            Code = "busy"   // all stream or transcode slots taken
+	CodeInUse           Code = "in_use" // a single-player session is playing elsewhere
+	CodeNotConfigured   Code = "not_configured"
+	CodeInternal        Code = "internal"
+	CodeUpstream        Code = "upstream_error" // TMDB, a tracker, a Cast device...
+	CodeUnavailable     Code = "unavailable"    // not ready yet, e.g. a segment
+	CodeTimeout         Code = "timeout"
+)
+
+// statusCodes is the default code for each status.
+var statusCodes = map[int]Code{
+	http.StatusBadRequest:            CodeInvalidRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusNotImplemented:        CodeNotConfigured,
+	http.StatusBadGateway:            CodeUpstream,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+	http.StatusGatewayTimeout:        CodeTimeout,
+}
+
+// retryable lists the codes worth retrying the same request for.
+var retryable = map[Code]bool{
+	CodeRateLimited: true,
+	CodeBusy:        true,
+	CodeUpstream:    true,
+	CodeUnavailable: true,
+	CodeTimeout:     true,
+}
+
+// Error is an API error response. Message is sent as "error", the key error
+// bodies have always used.
+type Error struct {
+	Status    int    `json:"-"`
+	Code      Code   `json:"code"`
+	Message   string `json:"error"`
+	Details   string `json:"details,omitempty"`
+	Retryable bool   `json:"retryable"`
+	RequestID string `json:"request_id,omitempty"`
+	// Data carries structured context, e.g. the queue position of a busy
+	// error or the partial result of a failed import.
+	Data any `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Details == "" {
+		return e.Message
+	}
+	return e.Message + ": " + e.Details
+}
+
+// New returns an error with the code and retryability implied by status.
+func New(status int, message string) *Error {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = CodeInternal
+		if status < http.StatusInternalServerError {
+			code = CodeInvalidRequest
+		}
+	}
+	return &Error{Status: status, Code: code, Message: message, Retryable: retryable[code]}
+}
+
+// WithCode replaces the code implied by the status, and its retryability.
+func (e *Error) WithCode(code Code) *Error {
+	e.Code, e.Retryable = code, retryable[code]
+	return e
+}
+
+func (e *Error) WithDetails(details string) *Error {
+	e.Details = details
+	return e
+}
+
+func (e *Error) WithData(data any) *Error {
+	e.Data = data
+	return e
+}
+
+// Respond aborts the request with status and message, plus details when
+// given (usually err.Error()).
+func Respond(c *gin.Context, status int, message string, details ...string) {
+	e := New(status, message)
+	if len(details) > 0 {
+		e.Details = details[0]
+	}
+	Write(c, e)
+}
+
+// Write aborts the request with e, stamped with the request's ID. Server-side
+// failures are logged under the same ID.
+func Write(c *gin.Context, e *Error) {
+	e.RequestID = c.GetString(RequestIDKey)
+	if e.Status >= http.StatusInternalServerError && e.Code != CodeNotConfigured {
+		log.Warn().
+			Str("request_id", e.RequestID).
+			Str("method", c.Request.Method).
+			Str("path", c.Request.URL.Path).
+			Int("status", e.Status).
+			Str("code", string(e.Code)).
+			Str("details", e.Details).
+			Msg(e.Message)
+	}
+	c.AbortWithStatusJSON(e.Status, e)
+}
@@ -0,0 +1,155 @@
+package cast
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/streambox/backend/internal/models"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const castService = "_googlecast._tcp.local."
+
+// defaultDiscoverTimeout is how long Discover listens when ctx has no deadline.
+const defaultDiscoverTimeout = 3 * time.Second
+
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Discover finds Cast devices on the local network with an mDNS query for
+// _googlecast._tcp, collecting answers until ctx is done. The query is sent
+// from an ephemeral port, so devices answer by unicast and no multicast
+// group membership is needed.
+func Discover(ctx context.Context) ([]models.CastDevice, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("open mdns socket: %w", err)
+	}
+	defer conn.Close()
+
+	query, err := buildQuery()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(query, mdnsAddr); err != nil {
+		return nil, fmt.Errorf("send mdns query: %w", err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultDiscoverTimeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline)
+	go func() {
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	found := make(map[string]models.CastDevice)
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break // deadline reached
+		}
+		for _, dev := range parseResponse(buf[:n]) {
+			found[dev.ID] = dev
+		}
+	}
+
+	devices := make([]models.CastDevice, 0, len(found))
+	for _, dev := range found {
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
+
+func buildQuery() ([]byte, error) {
+	name, err := dnsmessage.NewName(castService)
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return msg.Pack()
+}
+
+// parseResponse extracts devices from an mDNS response. Cast devices send
+// the PTR, SRV, TXT and A records for themselves in a single packet.
+func parseResponse(packet []byte) []models.CastDevice {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(packet); err != nil || !msg.Header.Response {
+		return nil
+	}
+
+	type instance struct {
+		target string
+		port   int
+		txt    map[string]string
+	}
+	instances := make(map[string]*instance)
+	addrs := make(map[string]net.IP)
+	get := func(name string) *instance {
+		if instances[name] == nil {
+			instances[name] = &instance{txt: map[string]string{}}
+		}
+		return instances[name]
+	}
+
+	records := append(msg.Answers, msg.Additionals...)
+	for _, rr := range records {
+		name := rr.Header.Name.String()
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if strings.EqualFold(name, castService) {
+				get(body.PTR.String())
+			}
+		case *dnsmessage.SRVResource:
+			inst := get(name)
+			inst.target = body.Target.String()
+			inst.port = int(body.Port)
+		case *dnsmessage.TXTResource:
+			inst := get(name)
+			for _, kv := range body.TXT {
+				if k, v, ok := strings.Cut(kv, "="); ok {
+					inst.txt[k] = v
+				}
+			}
+		case *dnsmessage.AResource:
+			addrs[name] = net.IP(body.A[:])
+		}
+	}
+
+	var devices []models.CastDevice
+	for name, inst := range instances {
+		ip := addrs[inst.target]
+		if ip == nil || inst.port == 0 {
+			continue
+		}
+		id := inst.txt["id"]
+		if id == "" {
+			id = strings.TrimSuffix(name, "."+castService)
+		}
+		friendly := inst.txt["fn"]
+		if friendly == "" {
+			friendly = id
+		}
+		devices = append(devices, models.CastDevice{
+			ID:    id,
+			Name:  friendly,
+			Model: inst.txt["md"],
+			Host:  ip.String(),
+			Port:  inst.port,
+		})
+	}
+	return devices
+}
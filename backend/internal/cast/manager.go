@@ -0,0 +1,215 @@
+package cast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// deviceCacheTTL is how long discovery results are reused.
+const deviceCacheTTL = time.Minute
+
+// Media describes what to play on a Cast device.
+type Media struct {
+	URL         string
+	ContentType string
+	Title       string
+	StartTime   float64 // seconds
+}
+
+// Manager discovers Cast devices and keeps one control connection per
+// device it has cast to.
+type Manager struct {
+	mu      sync.Mutex
+	devices map[string]models.CastDevice
+	scanned time.Time
+	players map[string]*player
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		devices: make(map[string]models.CastDevice),
+		players: make(map[string]*player),
+	}
+}
+
+// Devices returns the Cast devices on the network, scanning again if the
+// cached list is stale or refresh is set.
+func (m *Manager) Devices(ctx context.Context, refresh bool) ([]models.CastDevice, error) {
+	m.mu.Lock()
+	fresh := !refresh && time.Since(m.scanned) < deviceCacheTTL
+	m.mu.Unlock()
+
+	if !fresh {
+		found, err := Discover(ctx)
+		if err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		m.devices = make(map[string]models.CastDevice, len(found))
+		for _, d := range found {
+			m.devices[d.ID] = d
+		}
+		m.scanned = time.Now()
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	devices := make([]models.CastDevice, 0, len(m.devices))
+	for _, d := range m.devices {
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// Device looks up a device by ID, scanning once if it isn't known.
+func (m *Manager) Device(ctx context.Context, id string) (models.CastDevice, error) {
+	m.mu.Lock()
+	d, ok := m.devices[id]
+	m.mu.Unlock()
+	if ok {
+		return d, nil
+	}
+
+	if _, err := m.Devices(ctx, true); err != nil {
+		return models.CastDevice{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d, ok := m.devices[id]; ok {
+		return d, nil
+	}
+	return models.CastDevice{}, fmt.Errorf("cast device %s not found", id)
+}
+
+// LocalIP returns the address of this host on the network route to a
+// device, i.e. the address the device can reach us at.
+func (m *Manager) LocalIP(ctx context.Context, deviceID string) (string, error) {
+	d, err := m.Device(ctx, deviceID)
+	if err != nil {
+		return "", err
+	}
+	// UDP "dial" sends nothing; it only selects the route.
+	conn, err := net.Dial("udp", net.JoinHostPort(d.Host, strconv.Itoa(d.Port)))
+	if err != nil {
+		return "", fmt.Errorf("find route to %s: %w", d.Name, err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// player returns the open connection to a device, dialing if needed.
+func (m *Manager) player(ctx context.Context, deviceID string) (*player, error) {
+	m.mu.Lock()
+	p := m.players[deviceID]
+	m.mu.Unlock()
+	if p != nil && !p.isClosed() {
+		return p, nil
+	}
+
+	d, err := m.Device(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if p, err = dial(ctx, d); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if old := m.players[deviceID]; old != nil && old != p {
+		old.close()
+	}
+	m.players[deviceID] = p
+	m.mu.Unlock()
+	return p, nil
+}
+
+// connected returns the open connection to a device without dialing.
+func (m *Manager) connected(deviceID string) (*player, error) {
+	m.mu.Lock()
+	p := m.players[deviceID]
+	m.mu.Unlock()
+	if p == nil || p.isClosed() {
+		return nil, ErrNoMedia
+	}
+	return p, nil
+}
+
+// Load casts media to a device.
+func (m *Manager) Load(ctx context.Context, deviceID string, media Media) (*models.CastStatus, error) {
+	p, err := m.player(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.load(ctx, media); err != nil {
+		return nil, err
+	}
+	return p.currentStatus(), nil
+}
+
+// Play resumes paused media.
+func (m *Manager) Play(ctx context.Context, deviceID string) (*models.CastStatus, error) {
+	return m.control(ctx, deviceID, "PLAY", nil)
+}
+
+// Pause pauses playing media.
+func (m *Manager) Pause(ctx context.Context, deviceID string) (*models.CastStatus, error) {
+	return m.control(ctx, deviceID, "PAUSE", nil)
+}
+
+// Seek jumps to position (seconds).
+func (m *Manager) Seek(ctx context.Context, deviceID string, position float64) (*models.CastStatus, error) {
+	return m.control(ctx, deviceID, "SEEK", map[string]any{"currentTime": position})
+}
+
+// Stop stops playback and closes the connection to the device.
+func (m *Manager) Stop(ctx context.Context, deviceID string) error {
+	p, err := m.connected(deviceID)
+	if err != nil {
+		return nil // nothing to stop
+	}
+	err = p.control(ctx, "STOP", nil)
+
+	m.mu.Lock()
+	if m.players[deviceID] == p {
+		delete(m.players, deviceID)
+	}
+	m.mu.Unlock()
+	p.close()
+
+	if errors.Is(err, ErrNoMedia) {
+		return nil
+	}
+	return err
+}
+
+// Status reports what a device is playing. Devices we aren't connected to
+// report IDLE.
+func (m *Manager) Status(ctx context.Context, deviceID string) (*models.CastStatus, error) {
+	p, err := m.connected(deviceID)
+	if err != nil {
+		return &models.CastStatus{DeviceID: deviceID, PlayerState: "IDLE"}, nil
+	}
+	if err := p.control(ctx, "GET_STATUS", nil); err != nil && !errors.Is(err, ErrNoMedia) {
+		return nil, err
+	}
+	return p.currentStatus(), nil
+}
+
+func (m *Manager) control(ctx context.Context, deviceID, command string, extra map[string]any) (*models.CastStatus, error) {
+	p, err := m.connected(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.control(ctx, command, extra); err != nil {
+		return nil, err
+	}
+	return p.currentStatus(), nil
+}
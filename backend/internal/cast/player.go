@@ -0,0 +1,349 @@
+package cast
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+const (
+	heartbeatInterval = 5 * time.Second
+	writeTimeout      = 10 * time.Second
+)
+
+// ErrNoMedia is returned by media commands when nothing has been cast to the
+// device.
+var ErrNoMedia = errors.New("nothing is playing on this device")
+
+// player is a Cast v2 connection to one device, driving the Default Media
+// Receiver app.
+type player struct {
+	device models.CastDevice
+	conn   *tls.Conn
+
+	writeMu sync.Mutex
+	nextID  atomic.Int64
+
+	mu           sync.Mutex
+	pending      map[int64]chan json.RawMessage // replies awaited by requestId
+	transportID  string                         // receiver app session, once launched
+	mediaSession int
+	status       models.CastStatus
+	statusAt     time.Time
+
+	closed chan struct{}
+	err    error // why the connection closed; set before closed is closed
+}
+
+// dial connects to a device and opens the virtual connection to its
+// platform receiver.
+func dial(ctx context.Context, device models.CastDevice) (*player, error) {
+	// Cast devices present self-signed certificates.
+	dialer := tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(device.Host, strconv.Itoa(device.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", device.Name, err)
+	}
+
+	p := &player{
+		device:  device,
+		conn:    conn.(*tls.Conn),
+		pending: make(map[int64]chan json.RawMessage),
+		status:  models.CastStatus{DeviceID: device.ID, PlayerState: "IDLE"},
+		closed:  make(chan struct{}),
+	}
+	go p.readLoop()
+
+	if err := p.send(defaultReceiver, nsConnection, map[string]any{"type": "CONNECT"}); err != nil {
+		p.close()
+		return nil, err
+	}
+	go p.heartbeat()
+
+	return p, nil
+}
+
+func (p *player) close() {
+	p.conn.Close()
+}
+
+func (p *player) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *player) send(dest, namespace string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return writeMessage(p.conn, &message{
+		SourceID:      defaultSender,
+		DestinationID: dest,
+		Namespace:     namespace,
+		Payload:       string(data),
+	})
+}
+
+// request sends payload with a fresh requestId and waits for the reply that
+// carries it.
+func (p *player) request(ctx context.Context, dest, namespace string, payload map[string]any) (json.RawMessage, error) {
+	id := p.nextID.Add(1)
+	payload["requestId"] = id
+	reply := make(chan json.RawMessage, 1)
+
+	p.mu.Lock()
+	p.pending[id] = reply
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	if err := p.send(dest, namespace, payload); err != nil {
+		return nil, err
+	}
+
+	select {
+	case raw := <-reply:
+		var resp struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		}
+		json.Unmarshal(raw, &resp)
+		switch resp.Type {
+		case "LOAD_FAILED", "LOAD_CANCELLED", "INVALID_REQUEST", "INVALID_PLAYER_STATE", "LAUNCH_ERROR":
+			if resp.Reason != "" {
+				return nil, fmt.Errorf("%s: %s", resp.Type, resp.Reason)
+			}
+			return nil, errors.New(resp.Type)
+		}
+		return raw, nil
+	case <-p.closed:
+		return nil, p.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *player) readLoop() {
+	defer close(p.closed)
+
+	for {
+		msg, err := readMessage(p.conn)
+		if err != nil {
+			p.err = fmt.Errorf("connection to %s closed: %w", p.device.Name, err)
+			return
+		}
+
+		var hdr struct {
+			Type      string `json:"type"`
+			RequestID int64  `json:"requestId"`
+		}
+		if err := json.Unmarshal([]byte(msg.Payload), &hdr); err != nil {
+			continue
+		}
+
+		switch {
+		case msg.Namespace == nsHeartbeat && hdr.Type == "PING":
+			p.send(msg.SourceID, nsHeartbeat, map[string]any{"type": "PONG"})
+		case msg.Namespace == nsConnection && hdr.Type == "CLOSE":
+			// The receiver app quit (e.g. another sender took over).
+			p.mu.Lock()
+			if msg.SourceID == p.transportID {
+				p.transportID, p.mediaSession = "", 0
+				p.status.PlayerState = "IDLE"
+			}
+			p.mu.Unlock()
+		case msg.Namespace == nsMedia && hdr.Type == "MEDIA_STATUS":
+			p.updateStatus([]byte(msg.Payload))
+		}
+
+		if hdr.RequestID != 0 {
+			p.mu.Lock()
+			reply := p.pending[hdr.RequestID]
+			p.mu.Unlock()
+			if reply != nil {
+				select {
+				case reply <- json.RawMessage(msg.Payload):
+				default: // already answered
+				}
+			}
+		}
+	}
+}
+
+func (p *player) heartbeat() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.send(defaultReceiver, nsHeartbeat, map[string]any{"type": "PING"}); err != nil {
+				log.Debug().Err(err).Str("device", p.device.Name).Msg("cast heartbeat failed")
+				p.close()
+				return
+			}
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+func (p *player) updateStatus(payload []byte) {
+	var resp struct {
+		Status []struct {
+			MediaSessionID int     `json:"mediaSessionId"`
+			PlayerState    string  `json:"playerState"`
+			CurrentTime    float64 `json:"currentTime"`
+			IdleReason     string  `json:"idleReason"`
+			Media          *struct {
+				ContentID string  `json:"contentId"`
+				Duration  float64 `json:"duration"`
+			} `json:"media"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(payload, &resp); err != nil || len(resp.Status) == 0 {
+		return
+	}
+	st := resp.Status[0]
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mediaSession = st.MediaSessionID
+	p.status.PlayerState = st.PlayerState
+	p.status.CurrentTime = st.CurrentTime
+	p.status.IdleReason = st.IdleReason
+	if st.Media != nil {
+		p.status.ContentID = st.Media.ContentID
+		p.status.Duration = st.Media.Duration
+	}
+	p.statusAt = time.Now()
+}
+
+// launch starts the Default Media Receiver (if it isn't already running)
+// and connects to it.
+func (p *player) launch(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	transport := p.transportID
+	p.mu.Unlock()
+	if transport != "" {
+		return transport, nil
+	}
+
+	raw, err := p.request(ctx, defaultReceiver, nsReceiver, map[string]any{
+		"type":  "LAUNCH",
+		"appId": defaultMediaReceiver,
+	})
+	if err != nil {
+		return "", fmt.Errorf("launch media receiver: %w", err)
+	}
+
+	var resp struct {
+		Status struct {
+			Applications []struct {
+				AppID       string `json:"appId"`
+				TransportID string `json:"transportId"`
+			} `json:"applications"`
+		} `json:"status"`
+	}
+	json.Unmarshal(raw, &resp)
+	for _, app := range resp.Status.Applications {
+		if app.AppID == defaultMediaReceiver {
+			transport = app.TransportID
+		}
+	}
+	if transport == "" {
+		return "", errors.New("media receiver did not start")
+	}
+
+	if err := p.send(transport, nsConnection, map[string]any{"type": "CONNECT"}); err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	p.transportID = transport
+	p.mu.Unlock()
+	return transport, nil
+}
+
+// load starts playing media on the device.
+func (p *player) load(ctx context.Context, media Media) error {
+	transport, err := p.launch(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.request(ctx, transport, nsMedia, map[string]any{
+		"type":        "LOAD",
+		"autoplay":    true,
+		"currentTime": media.StartTime,
+		"media": map[string]any{
+			"contentId":   media.URL,
+			"contentType": media.ContentType,
+			"streamType":  "BUFFERED",
+			"metadata": map[string]any{
+				"metadataType": 0, // GenericMediaMetadata
+				"title":        media.Title,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("load media: %w", err)
+	}
+	return nil
+}
+
+// control sends a media command (PLAY, PAUSE, SEEK, STOP, GET_STATUS) for
+// the loaded media.
+func (p *player) control(ctx context.Context, command string, extra map[string]any) error {
+	p.mu.Lock()
+	transport, session := p.transportID, p.mediaSession
+	p.mu.Unlock()
+	if transport == "" || session == 0 {
+		return ErrNoMedia
+	}
+
+	payload := map[string]any{"type": command, "mediaSessionId": session}
+	for k, v := range extra {
+		payload[k] = v
+	}
+	_, err := p.request(ctx, transport, nsMedia, payload)
+	return err
+}
+
+// currentStatus returns the last reported status, with the position
+// advanced by the time elapsed since if the media is playing.
+func (p *player) currentStatus() *models.CastStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := p.status
+	if st.PlayerState == "PLAYING" && !p.statusAt.IsZero() {
+		st.CurrentTime += time.Since(p.statusAt).Seconds()
+		if st.Duration > 0 && st.CurrentTime > st.Duration {
+			st.CurrentTime = st.Duration
+		}
+	}
+	return &st
+}
@@ -0,0 +1,141 @@
+package cast
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Cast v2 channel namespaces.
+const (
+	nsConnection = "urn:x-cast:com.google.cast.tp.connection"
+	nsHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
+	nsReceiver   = "urn:x-cast:com.google.cast.receiver"
+	nsMedia      = "urn:x-cast:com.google.cast.media"
+)
+
+const (
+	defaultSender   = "sender-0"
+	defaultReceiver = "receiver-0"
+
+	// defaultMediaReceiver is the app ID of Google's Default Media Receiver,
+	// which plays HLS and MP4 URLs without a custom receiver app.
+	defaultMediaReceiver = "CC1AD845"
+
+	// maxMessageSize is the largest frame the protocol allows.
+	maxMessageSize = 64 * 1024
+)
+
+// message is a CastMessage protobuf with a UTF-8 (JSON) payload, the only
+// kind the media and receiver namespaces use.
+type message struct {
+	SourceID      string
+	DestinationID string
+	Namespace     string
+	Payload       string
+}
+
+// CastMessage protobuf field numbers.
+const (
+	fieldProtocolVersion = 1
+	fieldSourceID        = 2
+	fieldDestinationID   = 3
+	fieldNamespace       = 4
+	fieldPayloadType     = 5
+	fieldPayloadUTF8     = 6
+)
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// marshal encodes the message as a CastMessage protobuf. The message is small
+// and fixed, so it is encoded by hand rather than with generated code.
+func (m *message) marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, fieldProtocolVersion, 0) // CASTV2_1_0
+	b = appendStringField(b, fieldSourceID, m.SourceID)
+	b = appendStringField(b, fieldDestinationID, m.DestinationID)
+	b = appendStringField(b, fieldNamespace, m.Namespace)
+	b = appendVarintField(b, fieldPayloadType, 0) // STRING
+	b = appendStringField(b, fieldPayloadUTF8, m.Payload)
+	return b
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|wireVarint))
+	return binary.AppendUvarint(b, v)
+}
+
+func appendStringField(b []byte, field int, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|wireBytes))
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// unmarshalMessage decodes a CastMessage, ignoring fields it doesn't use.
+func unmarshalMessage(b []byte) (*message, error) {
+	var m message
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("malformed field key")
+		}
+		b = b[n:]
+
+		switch key & 7 {
+		case wireVarint:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("malformed varint")
+			}
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errors.New("malformed length-delimited field")
+			}
+			val := string(b[n : n+int(l)])
+			b = b[n+int(l):]
+
+			switch key >> 3 {
+			case fieldSourceID:
+				m.SourceID = val
+			case fieldDestinationID:
+				m.DestinationID = val
+			case fieldNamespace:
+				m.Namespace = val
+			case fieldPayloadUTF8:
+				m.Payload = val
+			}
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", key&7)
+		}
+	}
+	return &m, nil
+}
+
+// writeMessage writes a length-prefixed (big-endian uint32) message frame.
+func writeMessage(w io.Writer, m *message) error {
+	data := m.marshal()
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(data)), uint32(len(data)))
+	_, err := w.Write(append(frame, data...))
+	return err
+}
+
+// readMessage reads one length-prefixed message frame.
+func readMessage(r io.Reader) (*message, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message too large (%d bytes)", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return unmarshalMessage(data)
+}
@@ -2,45 +2,500 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
-	Port               int
-	TMDBAPIKey         string
-	RutrackerUsername   string
-	RutrackerPassword  string
-	RutrackerMirror    string
-	OpenSubtitlesKey   string
-	DataDir            string
-	TorrentDir         string
-	DBPath             string
-	MaxCacheGB         int
+	Port              int
+	TMDBAPIKey        string
+	KinopoiskAPIKey   string
+	OMDbAPIKey        string
+	RutrackerUsername string
+	RutrackerPassword string
+	RutrackerMirror   string
+	OpenSubtitlesKey  string
+	SubdlKey          string
+	DataDir           string
+	TorrentDir        string
+	ImageCacheDir     string
+	ImageCacheMB      int // total, least recently used deleted beyond it
+	DBPath            string
+	// DatabaseURL is a postgres:// URL or a SQLite path (default: DBPath).
+	DatabaseURL string
+	MaxCacheGB  int
+	// Transcoded stream output kept for Range requests, capped at
+	// TranscodeCacheGB in total
+	TranscodeCacheDir string
+	TranscodeCacheGB  int
+	// RemuxCache remuxes Matroska files that only need remuxing to MP4 in
+	// TranscodeCacheDir as they download, then serves the MP4 directly
+	RemuxCache bool
+	// Default limits on transcoded output, overridable per session
+	// (0 = unset)
+	TranscodeMaxHeight     int
+	TranscodeMaxBitrate    int // video, kb/s
+	TranscodeAudioChannels int
+
+	// Outbound HTTP (TMDB, OpenSubtitles, torrent providers, HDRezka)
+	HTTPTimeoutSec int
+	HTTPMaxRetries int
+	HTTPProxy      string
+	HTTPUserAgent  string
+	// Per-provider proxies overriding HTTPProxy, keyed by provider name
+	ProviderProxies map[string]string
+	// External search providers: webhook URL or executable, keyed by name
+	PluginProviders map[string]string
+
+	// Torrent traffic proxies: SOCKS5 for peer connections, HTTP or SOCKS5
+	// for tracker announces
+	TorrentPeerProxy    string
+	TorrentTrackerProxy string
+
+	// Trackers added to every public torrent: a fixed list and, with
+	// TorrentPublicTrackers, a list fetched from TorrentTrackersURL every
+	// TorrentTrackersRefreshHours
+	TorrentExtraTrackers        []string
+	TorrentPublicTrackers       bool
+	TorrentTrackersURL          string
+	TorrentTrackersRefreshHours int
+
+	// IP blocklist (file path or http(s) URL) refused as peers, reloaded
+	// every TorrentBlocklistRefreshHours
+	TorrentBlocklist             string
+	TorrentBlocklistRefreshHours int
+
+	// Seeding: uploading to any peer while streaming, and keeping torrents
+	// to seed after use until TorrentSeedRatio or TorrentSeedMinutes (0 for
+	// unlimited)
+	TorrentSeedWhileStreaming bool
+	TorrentSeedAfterComplete  bool
+	TorrentSeedRatio          float64
+	TorrentSeedMinutes        int
+
+	// How long torrent search results are cached; 0 disables the cache
+	SearchCacheMinutes int
+
+	// How long a search waits for each provider, and how many failures in
+	// a row skip a provider for SearchBreakerCooldownMinutes (0 disables)
+	SearchProviderTimeoutSec     int
+	SearchBreakerFailures        int
+	SearchBreakerCooldownMinutes int
+
+	// Drop torrent results whose name doesn't match the title and year
+	// searched for, instead of ranking them lower
+	SearchStrictMatch bool
+
+	// Rutracker topic pages fetched per search for magnets, how many at
+	// once, and the cap on requests per second to the mirror (0 unlimited)
+	RutrackerTopicLimit     int
+	RutrackerTopicWorkers   int
+	RutrackerRequestsPerSec float64
+
+	// Rutor search and its mirror domains, tried in turn
+	RutorEnabled bool
+	RutorMirrors []string
+
+	// Kinozal account (both required to enable it) and mirror domains
+	KinozalUsername string
+	KinozalPassword string
+	KinozalMirrors  []string
+
+	// Stall fallback: "off", "offer" or "switch"
+	StallFallback        string
+	StallFallbackMinutes int
+
+	// Sessions unused for this long are unloaded (0 = never)
+	SessionIdleTimeoutMin int
+
+	// Seconds of playback downloaded from the start of a torrent file before
+	// its session is ready (0 = ready at once)
+	StartBufferSec int
+
+	// Admission control (0 = unlimited)
+	MaxConcurrentStreams    int
+	MaxConcurrentTranscodes int
+
+	// Source failover when a torrent can't be started
+	MetadataTimeoutSec int
+	FailoverSources    []string
+	RealDebridKey      string
+
+	// Base URL Cast devices use to reach this server (default: derived from
+	// the LAN address on the route to the device and PORT)
+	CastBaseURL string
+
+	// HTTPS from certificate files, Let's Encrypt (ACME) for public domains
+	// or a self-signed certificate. HTTPPort adds a plain HTTP listener for
+	// LAN devices (Cast, DLNA) and ACME HTTP challenges.
+	TLSCertFile   string
+	TLSKeyFile    string
+	ACMEDomains   []string
+	ACMEEmail     string
+	TLSSelfSigned bool
+	TLSDir        string
+	HTTPPort      int
+
+	// Browser access: origins allowed besides http://localhost:* ("*" for
+	// any), and the path prefix of a reverse proxy, e.g. "/streambox"
+	AllowedOrigins []string
+	BasePath       string
+	// Proxies (IPs or CIDRs) whose X-Forwarded-For header is believed when
+	// telling clients apart
+	TrustedProxies []string
+
+	// Per-IP requests per minute to search and to stream-starting endpoints
+	// (0 = unlimited)
+	RateLimitSearch int
+	RateLimitStream int
+
+	// Trakt.tv integration (scrobbling and sync)
+	TraktClientID     string
+	TraktClientSecret string
+
+	// Telegram bot for searching, downloading and notifications; only the
+	// allowed chats may use it
+	TelegramBotToken     string
+	TelegramAllowedChats []int64
+
+	// Notifications about finished downloads, new episodes, failed
+	// transcodes and low disk space; NotifyEvents limits which are sent
+	// (empty: all)
+	NotifyEvents      []string
+	NotifyWebhookURL  string
+	NotifyDiscordURL  string
+	NotifyGotifyURL   string
+	NotifyGotifyToken string
+	NotifyNtfyURL     string
+	NotifyNtfyToken   string
+	// Free space in GiB below which a disk.low notification is sent (0 = off)
+	DiskLowGB int
+	// Hours between checks for new episodes of followed shows (0 = off)
+	EpisodeCheckHours int
+
+	// API authentication (disabled unless a key or username/password is set)
+	AuthAPIKey   string
+	AuthUsername string
+	AuthPassword string
+	AuthSecret   string
+
+	// DLNA media server for smart TVs and consoles on the LAN
+	DLNAEnabled bool
+	DLNAName    string
+
+	// Bandwidth limits in KiB/s (0 = unlimited); defaults for the runtime
+	// settings in /api/settings
+	DownloadLimitKBps int
+	UploadLimitKBps   int
+	SessionLimitKBps  int
+
+	// Preferred audio languages (ISO 639 codes, in order); default for the
+	// runtime setting in /api/settings
+	PreferredAudioLanguages []string
 }
 
 func Load() (*Config, error) {
 	cfg := &Config{
-		Port:             getEnvInt("PORT", 8080),
-		TMDBAPIKey:       os.Getenv("TMDB_API_KEY"),
+		Port:              getEnvInt("PORT", 8080),
+		TMDBAPIKey:        os.Getenv("TMDB_API_KEY"),
+		KinopoiskAPIKey:   os.Getenv("KINOPOISK_API_KEY"),
+		OMDbAPIKey:        os.Getenv("OMDB_API_KEY"),
 		RutrackerUsername: os.Getenv("RUTRACKER_USERNAME"),
 		RutrackerPassword: os.Getenv("RUTRACKER_PASSWORD"),
-		RutrackerMirror:  getEnv("RUTRACKER_MIRROR", "rutracker.org"),
-		OpenSubtitlesKey: os.Getenv("OPENSUBTITLES_API_KEY"),
-		DataDir:          getEnv("DATA_DIR", "./data"),
-		MaxCacheGB:       getEnvInt("MAX_CACHE_GB", 50),
+		RutrackerMirror:   getEnv("RUTRACKER_MIRROR", "rutracker.org"),
+		OpenSubtitlesKey:  os.Getenv("OPENSUBTITLES_API_KEY"),
+		SubdlKey:          os.Getenv("SUBDL_API_KEY"),
+		DataDir:           getEnv("DATA_DIR", "./data"),
+		DatabaseURL:       os.Getenv("DATABASE_URL"),
+		MaxCacheGB:        getEnvInt("MAX_CACHE_GB", 50),
+		ImageCacheMB:      getEnvInt("IMAGE_CACHE_MB", 500),
+		TranscodeCacheGB:  getEnvInt("TRANSCODE_CACHE_GB", 10),
+		RemuxCache:        getEnvBool("REMUX_CACHE", false),
+
+		TranscodeMaxHeight:     getEnvInt("TRANSCODE_MAX_HEIGHT", 0),
+		TranscodeMaxBitrate:    getEnvInt("TRANSCODE_MAX_BITRATE", 0),
+		TranscodeAudioChannels: getEnvInt("TRANSCODE_AUDIO_CHANNELS", 0),
+		HTTPTimeoutSec:         getEnvInt("HTTP_TIMEOUT_SEC", 0),
+		HTTPMaxRetries:         getEnvInt("HTTP_MAX_RETRIES", 2),
+		HTTPProxy:              os.Getenv("HTTP_PROXY_URL"),
+		HTTPUserAgent:          os.Getenv("HTTP_USER_AGENT"),
+
+		TorrentPeerProxy:    os.Getenv("TORRENT_PEER_PROXY_URL"),
+		TorrentTrackerProxy: os.Getenv("TORRENT_TRACKER_PROXY_URL"),
+
+		TorrentExtraTrackers:        getEnvList("TORRENT_EXTRA_TRACKERS", ""),
+		TorrentPublicTrackers:       getEnvBool("TORRENT_PUBLIC_TRACKERS", false),
+		TorrentTrackersURL:          getEnv("TORRENT_TRACKERS_URL", "https://raw.githubusercontent.com/ngosang/trackerslist/master/trackers_best.txt"),
+		TorrentTrackersRefreshHours: getEnvInt("TORRENT_TRACKERS_REFRESH_HOURS", 24),
+
+		TorrentBlocklist:             os.Getenv("TORRENT_BLOCKLIST"),
+		TorrentBlocklistRefreshHours: getEnvInt("TORRENT_BLOCKLIST_REFRESH_HOURS", 24),
+
+		TorrentSeedWhileStreaming: getEnvBool("TORRENT_SEED_WHILE_STREAMING", false),
+		TorrentSeedAfterComplete:  getEnvBool("TORRENT_SEED_AFTER_COMPLETE", false),
+		TorrentSeedRatio:          getEnvFloat("TORRENT_SEED_RATIO", 0),
+		TorrentSeedMinutes:        getEnvInt("TORRENT_SEED_MINUTES", 0),
+
+		SearchCacheMinutes:           getEnvInt("SEARCH_CACHE_MINUTES", 15),
+		SearchProviderTimeoutSec:     getEnvInt("SEARCH_PROVIDER_TIMEOUT_SEC", 20),
+		SearchBreakerFailures:        getEnvInt("SEARCH_BREAKER_FAILURES", 3),
+		SearchBreakerCooldownMinutes: getEnvInt("SEARCH_BREAKER_COOLDOWN_MINUTES", 5),
+		SearchStrictMatch:            getEnvBool("SEARCH_STRICT_MATCH", false),
+
+		RutrackerTopicLimit:     getEnvInt("RUTRACKER_TOPIC_LIMIT", 10),
+		RutrackerTopicWorkers:   getEnvInt("RUTRACKER_TOPIC_WORKERS", 4),
+		RutrackerRequestsPerSec: getEnvFloat("RUTRACKER_REQUESTS_PER_SEC", 4),
+
+		RutorEnabled: getEnvBool("RUTOR_ENABLED", true),
+		RutorMirrors: getEnvList("RUTOR_MIRRORS", "rutor.info,rutor.is"),
+
+		KinozalUsername: os.Getenv("KINOZAL_USERNAME"),
+		KinozalPassword: os.Getenv("KINOZAL_PASSWORD"),
+		KinozalMirrors:  getEnvList("KINOZAL_MIRRORS", "kinozal.tv,kinozal.me,kinozal.guru"),
+
+		StallFallback:        getEnv("STALL_FALLBACK", "off"),
+		StallFallbackMinutes: getEnvInt("STALL_FALLBACK_MINUTES", 3),
+
+		SessionIdleTimeoutMin: getEnvInt("SESSION_IDLE_TIMEOUT_MIN", 30),
+
+		StartBufferSec: getEnvInt("START_BUFFER_SEC", 10),
+
+		MaxConcurrentStreams:    getEnvInt("MAX_CONCURRENT_STREAMS", 0),
+		MaxConcurrentTranscodes: getEnvInt("MAX_CONCURRENT_TRANSCODES", 0),
+
+		MetadataTimeoutSec: getEnvInt("METADATA_TIMEOUT_SEC", 90),
+		FailoverSources:    getEnvList("FAILOVER_SOURCES", "debrid,hdrezka"),
+		RealDebridKey:      os.Getenv("REALDEBRID_API_KEY"),
+
+		CastBaseURL: strings.TrimSuffix(os.Getenv("CAST_BASE_URL"), "/"),
+
+		TLSCertFile:   os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:    os.Getenv("TLS_KEY_FILE"),
+		ACMEDomains:   getEnvList("ACME_DOMAINS", ""),
+		ACMEEmail:     os.Getenv("ACME_EMAIL"),
+		TLSSelfSigned: getEnvBool("TLS_SELF_SIGNED", false),
+		HTTPPort:      getEnvInt("HTTP_PORT", 0),
+
+		AllowedOrigins: getEnvList("ALLOWED_ORIGINS", ""),
+		BasePath:       strings.Trim(os.Getenv("BASE_PATH"), "/"),
+		TrustedProxies: getEnvList("TRUSTED_PROXIES", "127.0.0.0/8,::1,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"),
+
+		RateLimitSearch: getEnvInt("RATE_LIMIT_SEARCH", 60),
+		RateLimitStream: getEnvInt("RATE_LIMIT_STREAM", 20),
+
+		TraktClientID:     os.Getenv("TRAKT_CLIENT_ID"),
+		TraktClientSecret: os.Getenv("TRAKT_CLIENT_SECRET"),
+
+		TelegramBotToken: os.Getenv("TELEGRAM_BOT_TOKEN"),
+
+		NotifyEvents:      getEnvList("NOTIFY_EVENTS", ""),
+		NotifyWebhookURL:  os.Getenv("NOTIFY_WEBHOOK_URL"),
+		NotifyDiscordURL:  os.Getenv("NOTIFY_DISCORD_URL"),
+		NotifyGotifyURL:   os.Getenv("NOTIFY_GOTIFY_URL"),
+		NotifyGotifyToken: os.Getenv("NOTIFY_GOTIFY_TOKEN"),
+		NotifyNtfyURL:     os.Getenv("NOTIFY_NTFY_URL"),
+		NotifyNtfyToken:   os.Getenv("NOTIFY_NTFY_TOKEN"),
+		DiskLowGB:         getEnvInt("DISK_LOW_GB", 5),
+		EpisodeCheckHours: getEnvInt("EPISODE_CHECK_HOURS", 6),
+
+		AuthAPIKey:   os.Getenv("AUTH_API_KEY"),
+		AuthUsername: os.Getenv("AUTH_USERNAME"),
+		AuthPassword: os.Getenv("AUTH_PASSWORD"),
+		AuthSecret:   os.Getenv("AUTH_SECRET"),
+
+		DLNAEnabled: getEnvBool("DLNA_ENABLED", false),
+		DLNAName:    getEnv("DLNA_NAME", "StreamBox"),
+
+		DownloadLimitKBps: getEnvInt("DOWNLOAD_LIMIT_KBPS", 0),
+		UploadLimitKBps:   getEnvInt("UPLOAD_LIMIT_KBPS", 0),
+		SessionLimitKBps:  getEnvInt("SESSION_LIMIT_KBPS", 0),
+
+		PreferredAudioLanguages: getEnvList("PREFERRED_AUDIO_LANGUAGES", ""),
 	}
 
 	cfg.TorrentDir = cfg.DataDir + "/torrents"
+	cfg.ImageCacheDir = cfg.DataDir + "/images"
+	cfg.TranscodeCacheDir = cfg.DataDir + "/transcode"
 	cfg.DBPath = cfg.DataDir + "/streambox.db"
+	cfg.TLSDir = cfg.DataDir + "/tls"
+	if cfg.DatabaseURL == "" {
+		cfg.DatabaseURL = cfg.DBPath
+	}
 
 	if cfg.TMDBAPIKey == "" {
 		return nil, fmt.Errorf("TMDB_API_KEY is required")
 	}
 
+	switch cfg.StallFallback {
+	case "off", "offer", "switch":
+	default:
+		return nil, fmt.Errorf("invalid STALL_FALLBACK %q (want off, offer or switch)", cfg.StallFallback)
+	}
+
+	tlsModes := 0
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		tlsModes++
+	}
+	if len(cfg.ACMEDomains) > 0 {
+		tlsModes++
+	}
+	if cfg.TLSSelfSigned {
+		tlsModes++
+	}
+	if tlsModes > 1 {
+		return nil, fmt.Errorf("set only one of TLS_CERT_FILE/TLS_KEY_FILE, ACME_DOMAINS and TLS_SELF_SIGNED")
+	}
+	if cfg.HTTPPort != 0 && (tlsModes == 0 || cfg.HTTPPort == cfg.Port) {
+		return nil, fmt.Errorf("HTTP_PORT needs HTTPS enabled and must differ from PORT")
+	}
+
+	if cfg.BasePath != "" {
+		cfg.BasePath = "/" + cfg.BasePath
+	}
+	for i, origin := range cfg.AllowedOrigins {
+		cfg.AllowedOrigins[i] = strings.TrimSuffix(origin, "/")
+	}
+
+	for _, proxy := range cfg.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q (want an IP or CIDR)", proxy)
+		}
+	}
+	if cfg.RateLimitSearch < 0 || cfg.RateLimitStream < 0 {
+		return nil, fmt.Errorf("rate limits must not be negative")
+	}
+
+	for _, entry := range getEnvList("TELEGRAM_ALLOWED_CHATS", "") {
+		id, err := strconv.ParseInt(entry, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TELEGRAM_ALLOWED_CHATS entry %q (want a chat ID)", entry)
+		}
+		cfg.TelegramAllowedChats = append(cfg.TelegramAllowedChats, id)
+	}
+
+	for _, event := range cfg.NotifyEvents {
+		switch event {
+		case "download.completed", "download.failed", "episode.new", "transcode.failed", "disk.low":
+		default:
+			return nil, fmt.Errorf("invalid NOTIFY_EVENTS entry %q (want download.completed, download.failed, episode.new, transcode.failed or disk.low)", event)
+		}
+	}
+	if (cfg.NotifyGotifyURL == "") != (cfg.NotifyGotifyToken == "") {
+		return nil, fmt.Errorf("NOTIFY_GOTIFY_URL and NOTIFY_GOTIFY_TOKEN must be set together")
+	}
+	if cfg.DiskLowGB < 0 {
+		return nil, fmt.Errorf("DISK_LOW_GB must not be negative")
+	}
+	if cfg.EpisodeCheckHours < 0 {
+		return nil, fmt.Errorf("EPISODE_CHECK_HOURS must not be negative")
+	}
+
+	if cfg.DownloadLimitKBps < 0 || cfg.UploadLimitKBps < 0 || cfg.SessionLimitKBps < 0 {
+		return nil, fmt.Errorf("bandwidth limits must not be negative")
+	}
+
+	if cfg.HTTPProxy != "" {
+		if _, err := url.Parse(cfg.HTTPProxy); err != nil {
+			return nil, fmt.Errorf("invalid HTTP_PROXY_URL: %w", err)
+		}
+	}
+
+	cfg.ProviderProxies = make(map[string]string)
+	for _, entry := range getEnvList("PROVIDER_PROXIES", "") {
+		name, proxy, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid PROVIDER_PROXIES entry %q (want name=url)", entry)
+		}
+		if _, err := url.Parse(proxy); err != nil {
+			return nil, fmt.Errorf("invalid PROVIDER_PROXIES url for %s: %w", name, err)
+		}
+		cfg.ProviderProxies[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(proxy)
+	}
+
+	cfg.PluginProviders = make(map[string]string)
+	for _, entry := range getEnvList("PLUGIN_PROVIDERS", "") {
+		name, target, ok := strings.Cut(entry, "=")
+		name, target = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(target)
+		if !ok || name == "" || target == "" {
+			return nil, fmt.Errorf("invalid PLUGIN_PROVIDERS entry %q (want name=url or name=/path/to/command)", entry)
+		}
+		cfg.PluginProviders[name] = target
+	}
+
+	if cfg.TorrentPeerProxy != "" {
+		u, err := url.Parse(cfg.TorrentPeerProxy)
+		if err != nil || (u.Scheme != "socks5" && u.Scheme != "socks5h") {
+			return nil, fmt.Errorf("invalid TORRENT_PEER_PROXY_URL %q (want socks5://host:port)", cfg.TorrentPeerProxy)
+		}
+	}
+	if cfg.TorrentTrackerProxy != "" {
+		if _, err := url.Parse(cfg.TorrentTrackerProxy); err != nil {
+			return nil, fmt.Errorf("invalid TORRENT_TRACKER_PROXY_URL: %w", err)
+		}
+	}
+	for _, tr := range cfg.TorrentExtraTrackers {
+		u, err := url.Parse(tr)
+		if err != nil || u.Host == "" || !slices.Contains([]string{"udp", "http", "https", "ws", "wss"}, u.Scheme) {
+			return nil, fmt.Errorf("invalid TORRENT_EXTRA_TRACKERS entry %q (want udp://, http(s):// or ws(s):// announce URL)", tr)
+		}
+	}
+	if cfg.TorrentPublicTrackers {
+		if u, err := url.Parse(cfg.TorrentTrackersURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid TORRENT_TRACKERS_URL %q (want an http(s) URL)", cfg.TorrentTrackersURL)
+		}
+		if cfg.TorrentTrackersRefreshHours < 1 {
+			return nil, fmt.Errorf("TORRENT_TRACKERS_REFRESH_HOURS must be at least 1")
+		}
+	}
+	if cfg.TorrentBlocklist != "" {
+		if strings.Contains(cfg.TorrentBlocklist, "://") {
+			if u, err := url.Parse(cfg.TorrentBlocklist); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("invalid TORRENT_BLOCKLIST %q (want a file path or an http(s) URL)", cfg.TorrentBlocklist)
+			}
+		} else if _, err := os.Stat(cfg.TorrentBlocklist); err != nil {
+			return nil, fmt.Errorf("invalid TORRENT_BLOCKLIST: %w", err)
+		}
+		if cfg.TorrentBlocklistRefreshHours < 1 {
+			return nil, fmt.Errorf("TORRENT_BLOCKLIST_REFRESH_HOURS must be at least 1")
+		}
+	}
+	if cfg.TorrentSeedRatio < 0 {
+		return nil, fmt.Errorf("TORRENT_SEED_RATIO must not be negative")
+	}
+	if cfg.TorrentSeedMinutes < 0 {
+		return nil, fmt.Errorf("TORRENT_SEED_MINUTES must not be negative")
+	}
+	if cfg.SearchCacheMinutes < 0 {
+		return nil, fmt.Errorf("SEARCH_CACHE_MINUTES must not be negative")
+	}
+	if cfg.SearchProviderTimeoutSec < 1 {
+		return nil, fmt.Errorf("SEARCH_PROVIDER_TIMEOUT_SEC must be at least 1")
+	}
+	if cfg.SearchBreakerFailures < 0 || cfg.SearchBreakerCooldownMinutes < 1 {
+		return nil, fmt.Errorf("SEARCH_BREAKER_FAILURES must not be negative and SEARCH_BREAKER_COOLDOWN_MINUTES must be at least 1")
+	}
+	if cfg.RutrackerTopicLimit < 1 || cfg.RutrackerTopicWorkers < 1 {
+		return nil, fmt.Errorf("RUTRACKER_TOPIC_LIMIT and RUTRACKER_TOPIC_WORKERS must be at least 1")
+	}
+	if cfg.RutrackerRequestsPerSec < 0 {
+		return nil, fmt.Errorf("RUTRACKER_REQUESTS_PER_SEC must not be negative")
+	}
+
 	return cfg, nil
 }
 
+// TLSEnabled reports whether the server listens on HTTPS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || len(c.ACMEDomains) > 0 || c.TLSSelfSigned
+}
+
 func getEnv(key, defaultVal string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
@@ -48,6 +503,26 @@ func getEnv(key, defaultVal string) string {
 	return defaultVal
 }
 
+// getEnvList parses a comma-separated variable, dropping empty entries.
+func getEnvList(key, defaultVal string) []string {
+	var out []string
+	for _, v := range strings.Split(getEnv(key, defaultVal), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func getEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
+
 func getEnvInt(key string, defaultVal int) int {
 	if val := os.Getenv(key); val != "" {
 		if n, err := strconv.Atoi(val); err == nil {
@@ -56,3 +531,12 @@ func getEnvInt(key string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+func getEnvFloat(key string, defaultVal float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	}
+	return defaultVal
+}
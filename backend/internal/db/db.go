@@ -1,15 +1,31 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-// DB wraps the SQLite database connection and provides data access methods.
+// DB wraps the SQLite or PostgreSQL database connection and provides data
+// access methods. Queries are written for SQLite with ? placeholders and
+// rewritten for PostgreSQL (see rebind).
 type DB struct {
-	db *sql.DB
+	db       *sql.DB
+	postgres bool
+}
+
+// Open opens the database named by dsn: a postgres:// or postgresql:// URL
+// for PostgreSQL, the path of a SQLite file otherwise.
+func Open(dsn string) (*DB, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return NewPostgres(dsn)
+	}
+	return New(dsn)
 }
 
 // New opens (or creates) the SQLite database at dbPath, runs migrations,
@@ -46,9 +62,67 @@ func (d *DB) Close() error {
 	return d.db.Close()
 }
 
-// migrate creates the required tables if they do not already exist.
-func (d *DB) migrate() error {
-	migrations := []string{
+// Ping checks that the database is reachable.
+func (d *DB) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
+// rebind rewrites the ? placeholders of a query to PostgreSQL's $1, $2, ...
+// A ? inside a string literal is left alone.
+func (d *DB) rebind(query string) string {
+	if !d.postgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	literal := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			literal = !literal // an escaped '' toggles twice
+		case r == '?' && !literal:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (d *DB) exec(query string, args ...any) (sql.Result, error) {
+	return d.db.Exec(d.rebind(query), args...)
+}
+
+func (d *DB) query(query string, args ...any) (*sql.Rows, error) {
+	return d.db.Query(d.rebind(query), args...)
+}
+
+func (d *DB) queryRow(query string, args ...any) *sql.Row {
+	return d.db.QueryRow(d.rebind(query), args...)
+}
+
+// dialect returns the SQL fragment for the database in use.
+func (d *DB) dialect(sqlite, postgres string) string {
+	if d.postgres {
+		return postgres
+	}
+	return sqlite
+}
+
+// timestamp returns t as a query argument comparable with the DATETIME
+// columns, which SQLite stores as UTC text in CURRENT_TIMESTAMP's format.
+func (d *DB) timestamp(t time.Time) any {
+	if d.postgres {
+		return t
+	}
+	return t.UTC().Format(time.DateTime)
+}
+
+// baselineSQLite creates the SQLite schema of migration 1 and upgrades
+// databases created before versioned migrations to it.
+func (d *DB) baselineSQLite() error {
+	stmts := []string{
 		`CREATE TABLE IF NOT EXISTS stream_sessions (
 			id            TEXT PRIMARY KEY,
 			tmdb_id       INTEGER NOT NULL,
@@ -63,9 +137,21 @@ func (d *DB) migrate() error {
 			updated_at    DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		`CREATE TABLE IF NOT EXISTS profiles (
+			id                INTEGER PRIMARY KEY AUTOINCREMENT,
+			name              TEXT NOT NULL UNIQUE,
+			avatar            TEXT DEFAULT '',
+			audio_language    TEXT DEFAULT '',
+			subtitle_language TEXT DEFAULT '',
+			created_at        DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`INSERT OR IGNORE INTO profiles (id, name) VALUES (1, 'Default')`,
+
 		`CREATE TABLE IF NOT EXISTS watch_history (
 			id          INTEGER PRIMARY KEY AUTOINCREMENT,
-			tmdb_id     INTEGER NOT NULL UNIQUE,
+			profile_id  INTEGER NOT NULL DEFAULT 1,
+			tmdb_id     INTEGER NOT NULL,
 			title       TEXT NOT NULL,
 			poster_path TEXT DEFAULT '',
 			year        INTEGER DEFAULT 0,
@@ -75,7 +161,44 @@ func (d *DB) migrate() error {
 			quality     TEXT DEFAULT '',
 			magnet_uri  TEXT DEFAULT '',
 			watched_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at  DATETIME DEFAULT CURRENT_TIMESTAMP
+			updated_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (profile_id, tmdb_id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS watchlist (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			profile_id  INTEGER NOT NULL,
+			tmdb_id     INTEGER NOT NULL,
+			media_type  TEXT NOT NULL DEFAULT 'movie',
+			title       TEXT NOT NULL,
+			poster_path TEXT DEFAULT '',
+			year        INTEGER DEFAULT 0,
+			added_at    DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (profile_id, tmdb_id, media_type)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS trakt_tokens (
+			profile_id    INTEGER PRIMARY KEY,
+			access_token  TEXT NOT NULL,
+			refresh_token TEXT NOT NULL,
+			expires_at    INTEGER NOT NULL -- unix seconds
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS downloads (
+			id           TEXT PRIMARY KEY,
+			tmdb_id      INTEGER NOT NULL,
+			title        TEXT NOT NULL,
+			season       INTEGER DEFAULT 0,
+			episode      INTEGER DEFAULT 0,
+			magnet_uri   TEXT NOT NULL,
+			info_hash    TEXT NOT NULL,
+			file_path    TEXT DEFAULT '',
+			file_index   INTEGER DEFAULT -1,
+			file_size    INTEGER DEFAULT 0,
+			status       TEXT NOT NULL,
+			error        TEXT DEFAULT '',
+			created_at   DATETIME DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME
 		)`,
 
 		`CREATE TABLE IF NOT EXISTS torrent_cache (
@@ -88,13 +211,145 @@ func (d *DB) migrate() error {
 			last_used   DATETIME DEFAULT CURRENT_TIMESTAMP,
 			created_at  DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
+
+		`CREATE TABLE IF NOT EXISTS settings (
+			key   TEXT PRIMARY KEY,
+			value TEXT NOT NULL -- JSON
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS ratings_cache (
+			imdb_id    TEXT PRIMARY KEY,
+			data       TEXT NOT NULL, -- JSON, "null" for unknown titles
+			fetched_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS skip_markers (
+			info_hash   TEXT NOT NULL,
+			file_index  INTEGER NOT NULL,
+			tmdb_id     INTEGER NOT NULL,
+			season      INTEGER NOT NULL,
+			episode     INTEGER NOT NULL,
+			data        TEXT NOT NULL, -- JSON, "[]" when nothing was found
+			analyzed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (info_hash, file_index)
+		)`,
 	}
 
-	for _, m := range migrations {
-		if _, err := d.db.Exec(m); err != nil {
-			return fmt.Errorf("exec migration: %w", err)
+	for _, stmt := range stmts {
+		if _, err := d.db.Exec(stmt); err != nil {
+			return fmt.Errorf("create schema: %w", err)
+		}
+	}
+
+	if err := d.migrateHistoryProfiles(); err != nil {
+		return err
+	}
+
+	// Columns added after the initial schema.
+	columns := []struct{ table, column, def string }{
+		{"stream_sessions", "source", "TEXT DEFAULT 'torrent'"},
+		{"stream_sessions", "last_position", "REAL DEFAULT 0"},
+		{"stream_sessions", "season", "INTEGER DEFAULT 0"},
+		{"stream_sessions", "episode", "INTEGER DEFAULT 0"},
+		{"stream_sessions", "file_index", "INTEGER DEFAULT -1"},
+		{"stream_sessions", "audio_track", "INTEGER DEFAULT -1"},
+		{"stream_sessions", "subtitle_offset", "INTEGER DEFAULT 0"},
+	}
+	for _, col := range columns {
+		if err := d.addColumnIfMissing(col.table, col.column, col.def); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// migrateHistoryProfiles rebuilds a pre-profiles watch_history table, whose
+// tmdb_id was globally unique, assigning existing rows to the default profile.
+// SQLite can't drop a UNIQUE constraint in place.
+func (d *DB) migrateHistoryProfiles() error {
+	ok, err := d.hasColumn("watch_history", "profile_id")
+	if err != nil || ok {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin history migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		`ALTER TABLE watch_history RENAME TO watch_history_old`,
+		`CREATE TABLE watch_history (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			profile_id  INTEGER NOT NULL DEFAULT 1,
+			tmdb_id     INTEGER NOT NULL,
+			title       TEXT NOT NULL,
+			poster_path TEXT DEFAULT '',
+			year        INTEGER DEFAULT 0,
+			duration    INTEGER DEFAULT 0,
+			progress    REAL DEFAULT 0,
+			completed   INTEGER DEFAULT 0,
+			quality     TEXT DEFAULT '',
+			magnet_uri  TEXT DEFAULT '',
+			watched_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (profile_id, tmdb_id)
+		)`,
+		`INSERT INTO watch_history (id, profile_id, tmdb_id, title, poster_path, year, duration, progress, completed, quality, magnet_uri, watched_at, updated_at)
+		 SELECT id, 1, tmdb_id, title, poster_path, year, duration, progress, completed, quality, magnet_uri, watched_at, updated_at
+		 FROM watch_history_old`,
+		`DROP TABLE watch_history_old`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migrate watch_history to profiles: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// addColumnIfMissing adds a column to an existing table, since SQLite has no
+// ADD COLUMN IF NOT EXISTS.
+func (d *DB) addColumnIfMissing(table, column, def string) error {
+	ok, err := d.hasColumn(table, column)
+	if err != nil || ok {
+		return err
+	}
+
+	if _, err := d.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, def)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// hasColumn reports whether table has the given column.
+func (d *DB) hasColumn(table, column string) (bool, error) {
+	rows, err := d.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("table info %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, fmt.Errorf("scan table info %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("iterate table info %s: %w", table, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,28 @@
+package db
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name     string
+		postgres bool
+		query    string
+		want     string
+	}{
+		{"sqlite unchanged", false, "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = ? AND b = ?"},
+		{"no placeholders", true, "SELECT 1", "SELECT 1"},
+		{"numbered in order", true, "UPDATE t SET a = ?, b = ? WHERE id = ?", "UPDATE t SET a = $1, b = $2 WHERE id = $3"},
+		{"literal", true, "SELECT * FROM t WHERE a = '?' AND b = ?", "SELECT * FROM t WHERE a = '?' AND b = $1"},
+		{"escaped quote in literal", true, "SELECT * FROM t WHERE a = 'it''s ?' AND b = ?", "SELECT * FROM t WHERE a = 'it''s ?' AND b = $1"},
+		{"after literal", true, "INSERT INTO t (a, b) VALUES ('x', ?)", "INSERT INTO t (a, b) VALUES ('x', $1)"},
+		{"non-ASCII", true, "SELECT * FROM t WHERE title = 'Дюна?' AND year = ?", "SELECT * FROM t WHERE title = 'Дюна?' AND year = $1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DB{postgres: tt.postgres}
+			if got := d.rebind(tt.query); got != tt.want {
+				t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
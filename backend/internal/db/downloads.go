@@ -0,0 +1,89 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// SaveDownload inserts or updates a download. completed_at is set the first
+// time the download is saved as completed.
+func (d *DB) SaveDownload(dl *models.Download) error {
+	_, err := d.exec(`
+		INSERT INTO downloads (id, tmdb_id, title, season, episode, magnet_uri, info_hash, file_path, file_index, file_size, status, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			file_path    = excluded.file_path,
+			file_index   = excluded.file_index,
+			file_size    = excluded.file_size,
+			status       = excluded.status,
+			error        = excluded.error,
+			completed_at = CASE WHEN excluded.status = 'completed' THEN COALESCE(completed_at, CURRENT_TIMESTAMP) END
+	`, dl.ID, dl.TMDbID, dl.Title, dl.Season, dl.Episode, dl.MagnetURI, dl.InfoHash, dl.FilePath, dl.FileIndex, dl.FileSize, dl.Status, dl.Error)
+	if err != nil {
+		return fmt.Errorf("save download %s: %w", dl.ID, err)
+	}
+	return nil
+}
+
+const downloadColumns = `id, tmdb_id, title, season, episode, magnet_uri, info_hash, file_path,
+	file_index, file_size, status, error, created_at, completed_at`
+
+func scanDownload(row sessionScanner) (*models.Download, error) {
+	var (
+		dl          models.Download
+		completedAt sql.NullString
+	)
+	err := row.Scan(
+		&dl.ID, &dl.TMDbID, &dl.Title, &dl.Season, &dl.Episode, &dl.MagnetURI, &dl.InfoHash, &dl.FilePath,
+		&dl.FileIndex, &dl.FileSize, &dl.Status, &dl.Error, &dl.CreatedAt, &completedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	dl.CompletedAt = completedAt.String
+	return &dl, nil
+}
+
+// GetDownload returns a download by ID, or nil if none exists.
+func (d *DB) GetDownload(id string) (*models.Download, error) {
+	dl, err := scanDownload(d.queryRow("SELECT "+downloadColumns+" FROM downloads WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get download %s: %w", id, err)
+	}
+	return dl, nil
+}
+
+// ListDownloads returns downloads with the given status (all if empty),
+// newest first.
+func (d *DB) ListDownloads(status string) ([]models.Download, error) {
+	rows, err := d.query("SELECT "+downloadColumns+" FROM downloads WHERE ? = '' OR status = ? ORDER BY created_at DESC", status, status)
+	if err != nil {
+		return nil, fmt.Errorf("query downloads: %w", err)
+	}
+	defer rows.Close()
+
+	var downloads []models.Download
+	for rows.Next() {
+		dl, err := scanDownload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan download: %w", err)
+		}
+		downloads = append(downloads, *dl)
+	}
+	return downloads, rows.Err()
+}
+
+// DeleteDownload removes a download record.
+func (d *DB) DeleteDownload(id string) error {
+	_, err := d.exec("DELETE FROM downloads WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete download %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// How imported rows are resolved against existing ones for the same title.
+const (
+	// ConflictNewest keeps whichever history entry was updated last, and the
+	// existing watchlist entry.
+	ConflictNewest = "newest"
+	// ConflictSkip keeps existing rows.
+	ConflictSkip = "skip"
+	// ConflictOverwrite replaces existing rows.
+	ConflictOverwrite = "overwrite"
+)
+
+// ImportHistoryEntry writes an exported history entry to a profile, keeping
+// its timestamps. It reports whether the entry was written, which depends on
+// the conflict mode when the profile already has the title.
+func (d *DB) ImportHistoryEntry(profileID int, h models.WatchHistory, conflict string) (bool, error) {
+	var onConflict string
+	switch conflict {
+	case ConflictSkip:
+		onConflict = "DO NOTHING"
+	case ConflictOverwrite, ConflictNewest:
+		onConflict = `DO UPDATE SET
+			title       = excluded.title,
+			poster_path = excluded.poster_path,
+			year        = excluded.year,
+			duration    = excluded.duration,
+			progress    = excluded.progress,
+			completed   = excluded.completed,
+			quality     = excluded.quality,
+			magnet_uri  = excluded.magnet_uri,
+			watched_at  = excluded.watched_at,
+			updated_at  = excluded.updated_at`
+		if conflict == ConflictNewest {
+			onConflict += " WHERE excluded.updated_at > watch_history.updated_at"
+		}
+	default:
+		return false, fmt.Errorf("unknown conflict mode %q", conflict)
+	}
+
+	mediaType := h.MediaType
+	if mediaType == "" {
+		mediaType = "movie"
+	}
+	res, err := d.exec(`
+		INSERT INTO watch_history (profile_id, tmdb_id, media_type, title, poster_path, year, duration, progress, completed, quality, magnet_uri, watched_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(profile_id, tmdb_id, media_type) `+onConflict,
+		profileID, h.TMDbID, mediaType, h.Title, h.PosterPath, h.Year, h.Duration, h.Progress, boolInt(h.Completed),
+		h.Quality, h.MagnetURI, d.timestamp(parseTimestamp(h.WatchedAt)), d.timestamp(parseTimestamp(h.UpdatedAt)))
+	if err != nil {
+		return false, fmt.Errorf("import history for tmdb_id %d: %w", h.TMDbID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("import history for tmdb_id %d: %w", h.TMDbID, err)
+	}
+	return n > 0, nil
+}
+
+// ImportWatchlistItem adds an exported watchlist entry to a profile, keeping
+// when it was added. It reports whether the entry was written; existing
+// entries are only replaced with ConflictOverwrite.
+func (d *DB) ImportWatchlistItem(profileID int, item models.WatchlistItem, conflict string) (bool, error) {
+	onConflict := "DO NOTHING"
+	if conflict == ConflictOverwrite {
+		onConflict = `DO UPDATE SET
+			title       = excluded.title,
+			poster_path = excluded.poster_path,
+			year        = excluded.year,
+			added_at    = excluded.added_at`
+	}
+
+	res, err := d.exec(`
+		INSERT INTO watchlist (profile_id, tmdb_id, media_type, title, poster_path, year, added_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(profile_id, tmdb_id, media_type) `+onConflict,
+		profileID, item.TMDbID, item.MediaType, item.Title, item.PosterPath, item.Year, d.timestamp(parseTimestamp(item.AddedAt)))
+	if err != nil {
+		return false, fmt.Errorf("import tmdb_id %d to watchlist: %w", item.TMDbID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("import tmdb_id %d to watchlist: %w", item.TMDbID, err)
+	}
+	return n > 0, nil
+}
+
+// parseTimestamp reads a timestamp as exported from SQLite or PostgreSQL,
+// falling back to now for missing or unreadable ones.
+func parseTimestamp(s string) time.Time {
+	for _, layout := range []string{time.DateTime, time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
@@ -2,37 +2,75 @@ package db
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/streambox/backend/internal/models"
 )
 
-// GetHistory returns the most recent watch history entries (up to 50).
-func (d *DB) GetHistory() ([]models.WatchHistory, error) {
-	rows, err := d.db.Query(`
-		SELECT id, tmdb_id, title, poster_path, year, duration, progress,
-		       completed, quality, magnet_uri, watched_at, updated_at
+const historyColumns = `id, profile_id, tmdb_id, media_type, title, poster_path, year, duration, progress,
+	completed, quality, magnet_uri, watched_at, updated_at`
+
+// GetHistory returns a page of a profile's watch history, most recent first,
+// and the number of entries matching the filter.
+func (d *DB) GetHistory(profileID int, f models.HistoryFilter) ([]models.WatchHistory, int, error) {
+	where := "profile_id = ?"
+	args := []any{profileID}
+	if f.Completed != nil {
+		where += " AND completed = ?"
+		args = append(args, boolInt(*f.Completed))
+	}
+	if f.MediaType != "" {
+		where += " AND media_type = ?"
+		args = append(args, f.MediaType)
+	}
+
+	rows, err := d.query(`
+		SELECT `+historyColumns+`
 		FROM watch_history
-		ORDER BY updated_at DESC
-		LIMIT 50
-	`)
+		WHERE `+where+`
+		ORDER BY updated_at DESC, id DESC
+	`, args...)
 	if err != nil {
-		return nil, fmt.Errorf("query history: %w", err)
+		return nil, 0, fmt.Errorf("query history: %w", err)
 	}
 	defer rows.Close()
 
-	return scanHistoryRows(rows)
+	entries, err := scanHistoryRows(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Title search happens here rather than in SQL: SQLite's LIKE and LOWER
+	// only fold ASCII case, and most titles are Cyrillic. A profile has one
+	// row per title, so its history stays small.
+	if q := strings.ToLower(strings.TrimSpace(f.Query)); q != "" {
+		matched := entries[:0]
+		for _, h := range entries {
+			if strings.Contains(strings.ToLower(h.Title), q) {
+				matched = append(matched, h)
+			}
+		}
+		entries = matched
+	}
+
+	total := len(entries)
+	if f.PerPage <= 0 {
+		return entries, total, nil
+	}
+	start := min((f.Page-1)*f.PerPage, total)
+	end := min(start+f.PerPage, total)
+	return entries[start:end], total, nil
 }
 
-// GetContinueWatching returns movies that are in-progress (not completed, progress > 0).
-func (d *DB) GetContinueWatching() ([]models.WatchHistory, error) {
-	rows, err := d.db.Query(`
-		SELECT id, tmdb_id, title, poster_path, year, duration, progress,
-		       completed, quality, magnet_uri, watched_at, updated_at
+// GetContinueWatching returns a profile's in-progress movies (not completed, progress > 0).
+func (d *DB) GetContinueWatching(profileID int) ([]models.WatchHistory, error) {
+	rows, err := d.query(`
+		SELECT `+historyColumns+`
 		FROM watch_history
-		WHERE completed = 0 AND progress > 0
+		WHERE profile_id = ? AND completed = 0 AND progress > 0
 		ORDER BY updated_at DESC
 		LIMIT 20
-	`)
+	`, profileID)
 	if err != nil {
 		return nil, fmt.Errorf("query continue watching: %w", err)
 	}
@@ -41,18 +79,38 @@ func (d *DB) GetContinueWatching() ([]models.WatchHistory, error) {
 	return scanHistoryRows(rows)
 }
 
-// UpsertProgress inserts or updates a watch history record for the given movie.
-// A movie is marked as completed if progress/duration exceeds 0.9.
-func (d *DB) UpsertProgress(tmdbID int, title, posterPath string, year int, duration int, progress float64, quality, magnetURI string) error {
+// GetHistoryEntry returns a profile's watch history entry for a title, or nil
+// if there is none.
+func (d *DB) GetHistoryEntry(profileID, tmdbID int, mediaType string) (*models.WatchHistory, error) {
+	rows, err := d.query(`
+		SELECT `+historyColumns+`
+		FROM watch_history
+		WHERE profile_id = ? AND tmdb_id = ? AND media_type = ?
+	`, profileID, tmdbID, mediaType)
+	if err != nil {
+		return nil, fmt.Errorf("query history for tmdb_id %d: %w", tmdbID, err)
+	}
+	defer rows.Close()
+
+	entries, err := scanHistoryRows(rows)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// UpsertProgress inserts or updates a profile's watch history record for the
+// given movie. A movie is marked as completed if progress/duration exceeds 0.9.
+func (d *DB) UpsertProgress(profileID, tmdbID int, mediaType, title, posterPath string, year int, duration int, progress float64, quality, magnetURI string) error {
 	completed := 0
 	if duration > 0 && progress/float64(duration) > 0.9 {
 		completed = 1
 	}
 
-	_, err := d.db.Exec(`
-		INSERT INTO watch_history (tmdb_id, title, poster_path, year, duration, progress, completed, quality, magnet_uri, watched_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		ON CONFLICT(tmdb_id) DO UPDATE SET
+	_, err := d.exec(`
+		INSERT INTO watch_history (profile_id, tmdb_id, media_type, title, poster_path, year, duration, progress, completed, quality, magnet_uri, watched_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(profile_id, tmdb_id, media_type) DO UPDATE SET
 			title       = excluded.title,
 			poster_path = excluded.poster_path,
 			year        = excluded.year,
@@ -62,22 +120,61 @@ func (d *DB) UpsertProgress(tmdbID int, title, posterPath string, year int, dura
 			quality     = excluded.quality,
 			magnet_uri  = excluded.magnet_uri,
 			updated_at  = CURRENT_TIMESTAMP
-	`, tmdbID, title, posterPath, year, duration, progress, completed, quality, magnetURI)
+	`, profileID, tmdbID, mediaType, title, posterPath, year, duration, progress, completed, quality, magnetURI)
 	if err != nil {
 		return fmt.Errorf("upsert progress for tmdb_id %d: %w", tmdbID, err)
 	}
 	return nil
 }
 
-// DeleteHistory removes a watch history entry by TMDB ID.
-func (d *DB) DeleteHistory(tmdbID int) error {
-	_, err := d.db.Exec("DELETE FROM watch_history WHERE tmdb_id = ?", tmdbID)
+// GetWatched returns all of a profile's completed movies.
+func (d *DB) GetWatched(profileID int) ([]models.WatchHistory, error) {
+	rows, err := d.query(`
+		SELECT `+historyColumns+`
+		FROM watch_history
+		WHERE profile_id = ? AND completed = 1
+		ORDER BY updated_at DESC
+	`, profileID)
+	if err != nil {
+		return nil, fmt.Errorf("query watched: %w", err)
+	}
+	defer rows.Close()
+
+	return scanHistoryRows(rows)
+}
+
+// MarkWatched records a title as completed for a profile (e.g. when it was
+// watched elsewhere), keeping any existing progress row.
+func (d *DB) MarkWatched(profileID, tmdbID int, mediaType, title string, year int) error {
+	_, err := d.exec(`
+		INSERT INTO watch_history (profile_id, tmdb_id, media_type, title, year, completed, watched_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(profile_id, tmdb_id, media_type) DO UPDATE SET
+			completed  = 1,
+			updated_at = CURRENT_TIMESTAMP
+	`, profileID, tmdbID, mediaType, title, year)
+	if err != nil {
+		return fmt.Errorf("mark tmdb_id %d watched: %w", tmdbID, err)
+	}
+	return nil
+}
+
+// DeleteHistory removes a profile's watch history entry for a title.
+func (d *DB) DeleteHistory(profileID, tmdbID int, mediaType string) error {
+	_, err := d.exec("DELETE FROM watch_history WHERE profile_id = ? AND tmdb_id = ? AND media_type = ?", profileID, tmdbID, mediaType)
 	if err != nil {
 		return fmt.Errorf("delete history for tmdb_id %d: %w", tmdbID, err)
 	}
 	return nil
 }
 
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 // scanHistoryRows is a helper that scans sql.Rows into a slice of WatchHistory.
 func scanHistoryRows(rows interface {
 	Next() bool
@@ -89,7 +186,7 @@ func scanHistoryRows(rows interface {
 		var h models.WatchHistory
 		var completedInt int
 		if err := rows.Scan(
-			&h.ID, &h.TMDbID, &h.Title, &h.PosterPath, &h.Year,
+			&h.ID, &h.ProfileID, &h.TMDbID, &h.MediaType, &h.Title, &h.PosterPath, &h.Year,
 			&h.Duration, &h.Progress, &completedInt, &h.Quality,
 			&h.MagnetURI, &h.WatchedAt, &h.UpdatedAt,
 		); err != nil {
@@ -0,0 +1,355 @@
+package db
+
+import (
+	"fmt"
+)
+
+// migration is one versioned schema change. Its statements run in a
+// transaction together with the schema_migrations bookkeeping, so a failed
+// step leaves the database at the previous version.
+//
+// To change the schema, append a migration with the next version; never edit
+// one that has shipped. Statements use SQLite syntax unless pgUp/pgDown give
+// PostgreSQL's.
+type migration struct {
+	version int
+	name    string
+	up      []string
+	down    []string
+
+	pgUp   []string
+	pgDown []string
+
+	// baseline migrations create the schema that existed before versioned
+	// migrations (upgrading older SQLite databases in place) instead of
+	// running statements. They can't be reverted.
+	baseline bool
+}
+
+var migrations = []migration{
+	{
+		version:  1,
+		name:     "baseline schema",
+		baseline: true,
+	},
+	{
+		version: 2,
+		name:    "index watch history by recency",
+		up:      []string{`CREATE INDEX IF NOT EXISTS idx_watch_history_profile_updated ON watch_history (profile_id, updated_at)`},
+		down:    []string{`DROP INDEX IF EXISTS idx_watch_history_profile_updated`},
+	},
+	{
+		version: 3,
+		name:    "add watch history media type",
+		up:      []string{`ALTER TABLE watch_history ADD COLUMN media_type TEXT NOT NULL DEFAULT 'movie'`},
+		down:    []string{`ALTER TABLE watch_history DROP COLUMN media_type`},
+	},
+	{
+		version: 4,
+		name:    "add title genres",
+		up: []string{`CREATE TABLE IF NOT EXISTS title_genres (
+			media_type TEXT NOT NULL,
+			tmdb_id    INTEGER NOT NULL,
+			genre      TEXT NOT NULL, -- '' for titles without genres
+			PRIMARY KEY (media_type, tmdb_id, genre)
+		)`},
+		down: []string{`DROP TABLE IF EXISTS title_genres`},
+	},
+	{
+		version: 5,
+		name:    "add notifications and episode tracking",
+		up: []string{
+			`CREATE TABLE IF NOT EXISTS notifications (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				profile_id  INTEGER NOT NULL,
+				type        TEXT NOT NULL,
+				tmdb_id     INTEGER NOT NULL,
+				title       TEXT NOT NULL,
+				season      INTEGER NOT NULL DEFAULT 0,
+				episode     INTEGER NOT NULL DEFAULT 0,
+				message     TEXT DEFAULT '',
+				poster_path TEXT DEFAULT '',
+				air_date    TEXT DEFAULT '',
+				read        INTEGER DEFAULT 0,
+				created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (profile_id, type, tmdb_id, season, episode)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_notifications_profile ON notifications (profile_id, read)`,
+			// The latest aired episode seen for each followed show.
+			`CREATE TABLE IF NOT EXISTS episode_tracking (
+				tmdb_id    INTEGER PRIMARY KEY,
+				season     INTEGER NOT NULL,
+				episode    INTEGER NOT NULL,
+				checked_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		pgUp: []string{
+			`CREATE TABLE IF NOT EXISTS notifications (
+				id          BIGSERIAL PRIMARY KEY,
+				profile_id  INTEGER NOT NULL,
+				type        TEXT NOT NULL,
+				tmdb_id     INTEGER NOT NULL,
+				title       TEXT NOT NULL,
+				season      INTEGER NOT NULL DEFAULT 0,
+				episode     INTEGER NOT NULL DEFAULT 0,
+				message     TEXT DEFAULT '',
+				poster_path TEXT DEFAULT '',
+				air_date    TEXT DEFAULT '',
+				read        INTEGER DEFAULT 0,
+				created_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (profile_id, type, tmdb_id, season, episode)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_notifications_profile ON notifications (profile_id, read)`,
+			`CREATE TABLE IF NOT EXISTS episode_tracking (
+				tmdb_id    INTEGER PRIMARY KEY,
+				season     INTEGER NOT NULL,
+				episode    INTEGER NOT NULL,
+				checked_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		down: []string{
+			`DROP TABLE IF EXISTS episode_tracking`,
+			`DROP INDEX IF EXISTS idx_notifications_profile`,
+			`DROP TABLE IF EXISTS notifications`,
+		},
+	},
+	{
+		version: 6,
+		name:    "add provider sessions",
+		// Login cookies of search providers, so restarts reuse them.
+		up: []string{`CREATE TABLE IF NOT EXISTS provider_sessions (
+			provider   TEXT PRIMARY KEY,
+			cookies    TEXT NOT NULL, -- JSON
+			expires_at INTEGER NOT NULL, -- unix seconds
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		pgUp: []string{`CREATE TABLE IF NOT EXISTS provider_sessions (
+			provider   TEXT PRIMARY KEY,
+			cookies    TEXT NOT NULL,
+			expires_at BIGINT NOT NULL,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		)`},
+		down: []string{`DROP TABLE IF EXISTS provider_sessions`},
+	},
+	{
+		version: 7,
+		name:    "add search cache",
+		up: []string{
+			`CREATE TABLE IF NOT EXISTS search_cache (
+				provider   TEXT NOT NULL,
+				query      TEXT NOT NULL, -- normalized search
+				results    TEXT NOT NULL, -- JSON
+				fetched_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (provider, query)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_search_cache_fetched ON search_cache (fetched_at)`,
+		},
+		pgUp: []string{
+			`CREATE TABLE IF NOT EXISTS search_cache (
+				provider   TEXT NOT NULL,
+				query      TEXT NOT NULL,
+				results    TEXT NOT NULL,
+				fetched_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (provider, query)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_search_cache_fetched ON search_cache (fetched_at)`,
+		},
+		down: []string{
+			`DROP INDEX IF EXISTS idx_search_cache_fetched`,
+			`DROP TABLE IF EXISTS search_cache`,
+		},
+	},
+	{
+		version: 8,
+		name:    "key watch history by media type",
+		// A movie and a show can share a TMDB ID. SQLite can't alter a
+		// table constraint, so the table is rebuilt.
+		up: []string{
+			`ALTER TABLE watch_history RENAME TO watch_history_old`,
+			`CREATE TABLE watch_history (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				profile_id  INTEGER NOT NULL DEFAULT 1,
+				tmdb_id     INTEGER NOT NULL,
+				media_type  TEXT NOT NULL DEFAULT 'movie',
+				title       TEXT NOT NULL,
+				poster_path TEXT DEFAULT '',
+				year        INTEGER DEFAULT 0,
+				duration    INTEGER DEFAULT 0,
+				progress    REAL DEFAULT 0,
+				completed   INTEGER DEFAULT 0,
+				quality     TEXT DEFAULT '',
+				magnet_uri  TEXT DEFAULT '',
+				watched_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (profile_id, tmdb_id, media_type)
+			)`,
+			`INSERT INTO watch_history (id, profile_id, tmdb_id, media_type, title, poster_path, year, duration, progress, completed, quality, magnet_uri, watched_at, updated_at)
+				SELECT id, profile_id, tmdb_id, media_type, title, poster_path, year, duration, progress, completed, quality, magnet_uri, watched_at, updated_at
+				FROM watch_history_old`,
+			`DROP TABLE watch_history_old`,
+			`CREATE INDEX IF NOT EXISTS idx_watch_history_profile_updated ON watch_history (profile_id, updated_at)`,
+		},
+		pgUp: []string{
+			`ALTER TABLE watch_history DROP CONSTRAINT IF EXISTS watch_history_profile_id_tmdb_id_key`,
+			`ALTER TABLE watch_history ADD CONSTRAINT watch_history_profile_id_tmdb_id_media_type_key UNIQUE (profile_id, tmdb_id, media_type)`,
+		},
+		// Reverting keeps the most recently updated entry of each title.
+		down: []string{
+			`ALTER TABLE watch_history RENAME TO watch_history_old`,
+			`CREATE TABLE watch_history (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				profile_id  INTEGER NOT NULL DEFAULT 1,
+				tmdb_id     INTEGER NOT NULL,
+				media_type  TEXT NOT NULL DEFAULT 'movie',
+				title       TEXT NOT NULL,
+				poster_path TEXT DEFAULT '',
+				year        INTEGER DEFAULT 0,
+				duration    INTEGER DEFAULT 0,
+				progress    REAL DEFAULT 0,
+				completed   INTEGER DEFAULT 0,
+				quality     TEXT DEFAULT '',
+				magnet_uri  TEXT DEFAULT '',
+				watched_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (profile_id, tmdb_id)
+			)`,
+			`INSERT OR IGNORE INTO watch_history (id, profile_id, tmdb_id, media_type, title, poster_path, year, duration, progress, completed, quality, magnet_uri, watched_at, updated_at)
+				SELECT id, profile_id, tmdb_id, media_type, title, poster_path, year, duration, progress, completed, quality, magnet_uri, watched_at, updated_at
+				FROM watch_history_old ORDER BY updated_at DESC`,
+			`DROP TABLE watch_history_old`,
+			`CREATE INDEX IF NOT EXISTS idx_watch_history_profile_updated ON watch_history (profile_id, updated_at)`,
+		},
+		pgDown: []string{
+			`DELETE FROM watch_history w USING watch_history newer
+				WHERE w.profile_id = newer.profile_id AND w.tmdb_id = newer.tmdb_id
+				AND (w.updated_at, w.id) < (newer.updated_at, newer.id)`,
+			`ALTER TABLE watch_history DROP CONSTRAINT IF EXISTS watch_history_profile_id_tmdb_id_media_type_key`,
+			`ALTER TABLE watch_history ADD CONSTRAINT watch_history_profile_id_tmdb_id_key UNIQUE (profile_id, tmdb_id)`,
+		},
+	},
+}
+
+// LatestSchemaVersion is the schema version this build migrates to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+func (m migration) statements(postgres, up bool) []string {
+	switch {
+	case postgres && up && m.pgUp != nil:
+		return m.pgUp
+	case postgres && !up && m.pgDown != nil:
+		return m.pgDown
+	case up:
+		return m.up
+	default:
+		return m.down
+	}
+}
+
+// migrate brings the schema up to the latest version.
+func (d *DB) migrate() error {
+	return d.MigrateTo(LatestSchemaVersion())
+}
+
+// SchemaVersion returns the version of the last applied migration, or 0 for
+// an empty database.
+func (d *DB) SchemaVersion() (int, error) {
+	if err := d.createMigrationsTable(); err != nil {
+		return 0, err
+	}
+	var version int
+	if err := d.queryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrateTo applies migrations up to version, or reverts those after it
+// (newest first) when the database is ahead of it.
+func (d *DB) MigrateTo(version int) error {
+	latest := LatestSchemaVersion()
+	if version < 1 || version > latest {
+		return fmt.Errorf("unknown schema version %d (latest is %d)", version, latest)
+	}
+	current, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d)", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version > current && m.version <= version {
+			if err := d.runMigration(m, true); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version <= current && m.version > version {
+			if err := d.runMigration(m, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *DB) createMigrationsTable() error {
+	timestamp := "DATETIME"
+	if d.postgres {
+		timestamp = "TIMESTAMPTZ"
+	}
+	_, err := d.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) runMigration(m migration, up bool) error {
+	if m.baseline {
+		if !up {
+			return fmt.Errorf("migration %d (%s) can't be reverted", m.version, m.name)
+		}
+		create := d.baselineSQLite
+		if d.postgres {
+			create = d.baselinePostgres
+		}
+		if err := create(); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if _, err := d.exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+			return fmt.Errorf("record migration %d: %w", m.version, err)
+		}
+		return nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.statements(d.postgres, up) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	if up {
+		_, err = tx.Exec(d.rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), m.version, m.name)
+	} else {
+		_, err = tx.Exec(d.rebind("DELETE FROM schema_migrations WHERE version = ?"), m.version)
+	}
+	if err != nil {
+		return fmt.Errorf("record migration %d: %w", m.version, err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMigrationsOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %d (%s) has version %d, want %d", i, m.name, m.version, i+1)
+		}
+		if m.name == "" {
+			t.Errorf("migration %d has no name", m.version)
+		}
+		if m.baseline {
+			if i != 0 {
+				t.Errorf("migration %d (%s) is a baseline but not the first", m.version, m.name)
+			}
+			continue
+		}
+		if len(m.up) == 0 || len(m.down) == 0 {
+			t.Errorf("migration %d (%s) needs up and down statements", m.version, m.name)
+		}
+		if m.pgDown != nil && m.pgUp == nil {
+			t.Errorf("migration %d (%s) has pgDown without pgUp", m.version, m.name)
+		}
+	}
+	if got, want := LatestSchemaVersion(), len(migrations); got != want {
+		t.Errorf("LatestSchemaVersion() = %d, want %d", got, want)
+	}
+}
+
+func TestMigrationStatements(t *testing.T) {
+	m := migration{
+		up:     []string{"sqlite up"},
+		down:   []string{"sqlite down"},
+		pgUp:   []string{"pg up"},
+		pgDown: []string{"pg down"},
+	}
+	shared := migration{up: []string{"up"}, down: []string{"down"}}
+	pgUpOnly := migration{up: []string{"up"}, down: []string{"down"}, pgUp: []string{"pg up"}}
+
+	tests := []struct {
+		name     string
+		m        migration
+		postgres bool
+		up       bool
+		want     []string
+	}{
+		{"sqlite up", m, false, true, []string{"sqlite up"}},
+		{"sqlite down", m, false, false, []string{"sqlite down"}},
+		{"postgres up", m, true, true, []string{"pg up"}},
+		{"postgres down", m, true, false, []string{"pg down"}},
+		{"postgres up shared", shared, true, true, []string{"up"}},
+		{"postgres down shared", shared, true, false, []string{"down"}},
+		{"postgres down without pgDown", pgUpOnly, true, false, []string{"down"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.statements(tt.postgres, tt.up); !slices.Equal(got, tt.want) {
+				t.Errorf("statements(%v, %v) = %q, want %q", tt.postgres, tt.up, got, tt.want)
+			}
+		})
+	}
+}
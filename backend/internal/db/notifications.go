@@ -0,0 +1,159 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// FollowedShows returns the TV shows on each profile's watchlist or in its
+// watch history.
+func (d *DB) FollowedShows() ([]models.FollowedShow, error) {
+	rows, err := d.query(`
+		SELECT profile_id, tmdb_id, title, poster_path FROM watchlist WHERE media_type = 'tv'
+		UNION
+		SELECT profile_id, tmdb_id, title, poster_path FROM watch_history WHERE media_type = 'tv'
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query followed shows: %w", err)
+	}
+	defer rows.Close()
+
+	// A show in both lists may come back twice with different metadata.
+	seen := make(map[[2]int]bool)
+	var shows []models.FollowedShow
+	for rows.Next() {
+		var (
+			s      models.FollowedShow
+			poster sql.NullString
+		)
+		if err := rows.Scan(&s.ProfileID, &s.TMDbID, &s.Title, &poster); err != nil {
+			return nil, fmt.Errorf("scan followed show: %w", err)
+		}
+		key := [2]int{s.ProfileID, s.TMDbID}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		s.PosterPath = poster.String
+		shows = append(shows, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate followed shows: %w", err)
+	}
+	return shows, nil
+}
+
+// GetTrackedEpisode returns the latest aired episode recorded for a show,
+// reporting false if the show hasn't been checked yet.
+func (d *DB) GetTrackedEpisode(tmdbID int) (season, episode int, found bool, err error) {
+	err = d.queryRow("SELECT season, episode FROM episode_tracking WHERE tmdb_id = ?", tmdbID).Scan(&season, &episode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("get tracked episode of tmdb_id %d: %w", tmdbID, err)
+	}
+	return season, episode, true, nil
+}
+
+// SaveTrackedEpisode records the latest aired episode of a show.
+func (d *DB) SaveTrackedEpisode(tmdbID, season, episode int) error {
+	_, err := d.exec(`
+		INSERT INTO episode_tracking (tmdb_id, season, episode) VALUES (?, ?, ?)
+		ON CONFLICT(tmdb_id) DO UPDATE SET
+			season     = excluded.season,
+			episode    = excluded.episode,
+			checked_at = CURRENT_TIMESTAMP
+	`, tmdbID, season, episode)
+	if err != nil {
+		return fmt.Errorf("save tracked episode of tmdb_id %d: %w", tmdbID, err)
+	}
+	return nil
+}
+
+// AddNotification stores a notification unless the profile already has one
+// of the same type for the same episode, reporting whether it was added.
+func (d *DB) AddNotification(n models.Notification) (bool, error) {
+	res, err := d.exec(`
+		INSERT INTO notifications (profile_id, type, tmdb_id, title, season, episode, message, poster_path, air_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(profile_id, type, tmdb_id, season, episode) DO NOTHING
+	`, n.ProfileID, n.Type, n.TMDbID, n.Title, n.Season, n.Episode, n.Message, n.PosterPath, n.AirDate)
+	if err != nil {
+		return false, fmt.Errorf("add notification: %w", err)
+	}
+	added, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("add notification: %w", err)
+	}
+	return added > 0, nil
+}
+
+// ListNotifications returns up to limit of a profile's notifications, newest
+// first; only unread ones with unreadOnly.
+func (d *DB) ListNotifications(profileID int, unreadOnly bool, limit int) ([]models.Notification, error) {
+	rows, err := d.query(`
+		SELECT id, profile_id, type, tmdb_id, title, season, episode, message, poster_path, air_date, read, created_at
+		FROM notifications
+		WHERE profile_id = ? AND (? = 0 OR read = 0)
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, profileID, boolInt(unreadOnly), limit)
+	if err != nil {
+		return nil, fmt.Errorf("query notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.Notification
+	for rows.Next() {
+		var (
+			n                        models.Notification
+			message, poster, airDate sql.NullString
+			read                     int
+		)
+		err := rows.Scan(&n.ID, &n.ProfileID, &n.Type, &n.TMDbID, &n.Title, &n.Season, &n.Episode,
+			&message, &poster, &airDate, &read, &n.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan notification: %w", err)
+		}
+		n.Message, n.PosterPath, n.AirDate = message.String, poster.String, airDate.String
+		n.Read = read != 0
+		list = append(list, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate notifications: %w", err)
+	}
+	return list, nil
+}
+
+// CountUnreadNotifications returns how many of a profile's notifications are
+// unread.
+func (d *DB) CountUnreadNotifications(profileID int) (int, error) {
+	var n int
+	err := d.queryRow("SELECT COUNT(*) FROM notifications WHERE profile_id = ? AND read = 0", profileID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count unread notifications: %w", err)
+	}
+	return n, nil
+}
+
+// MarkNotificationsRead marks the given notifications of a profile as read,
+// or all of them when ids is empty.
+func (d *DB) MarkNotificationsRead(profileID int, ids []int) error {
+	query := "UPDATE notifications SET read = 1 WHERE profile_id = ?"
+	args := []any{profileID}
+	if len(ids) > 0 {
+		query += " AND id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	if _, err := d.exec(query, args...); err != nil {
+		return fmt.Errorf("mark notifications read: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// NewPostgres connects to the PostgreSQL database at dsn (a postgres:// URL),
+// runs migrations, and returns a ready-to-use DB handle.
+func NewPostgres(dsn string) (*DB, error) {
+	sqlDB, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres: %w", err)
+	}
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("connect postgres: %w", err)
+	}
+
+	d := &DB{db: sqlDB, postgres: true}
+	if err := d.migrate(); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	return d, nil
+}
+
+// baselinePostgres creates the PostgreSQL schema of migration 1. It mirrors
+// baselineSQLite's, with the columns added to SQLite databases over time
+// included from the start.
+func (d *DB) baselinePostgres() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS stream_sessions (
+			id              TEXT PRIMARY KEY,
+			tmdb_id         INTEGER NOT NULL,
+			title           TEXT NOT NULL,
+			magnet_uri      TEXT NOT NULL,
+			info_hash       TEXT NOT NULL,
+			file_path       TEXT,
+			file_size       BIGINT DEFAULT 0,
+			content_type    TEXT DEFAULT '',
+			status          TEXT DEFAULT 'starting',
+			source          TEXT DEFAULT 'torrent',
+			last_position   DOUBLE PRECISION DEFAULT 0,
+			season          INTEGER DEFAULT 0,
+			episode         INTEGER DEFAULT 0,
+			file_index      INTEGER DEFAULT -1,
+			audio_track     INTEGER DEFAULT -1,
+			subtitle_offset INTEGER DEFAULT 0,
+			created_at      TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at      TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS profiles (
+			id                SERIAL PRIMARY KEY,
+			name              TEXT NOT NULL UNIQUE,
+			avatar            TEXT DEFAULT '',
+			audio_language    TEXT DEFAULT '',
+			subtitle_language TEXT DEFAULT '',
+			created_at        TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`INSERT INTO profiles (id, name) VALUES (1, 'Default') ON CONFLICT DO NOTHING`,
+
+		// The explicit insert above doesn't advance the id sequence.
+		`SELECT setval(pg_get_serial_sequence('profiles', 'id'), (SELECT MAX(id) FROM profiles))`,
+
+		`CREATE TABLE IF NOT EXISTS watch_history (
+			id          BIGSERIAL PRIMARY KEY,
+			profile_id  INTEGER NOT NULL DEFAULT 1,
+			tmdb_id     INTEGER NOT NULL,
+			title       TEXT NOT NULL,
+			poster_path TEXT DEFAULT '',
+			year        INTEGER DEFAULT 0,
+			duration    INTEGER DEFAULT 0,
+			progress    DOUBLE PRECISION DEFAULT 0,
+			completed   INTEGER DEFAULT 0,
+			quality     TEXT DEFAULT '',
+			magnet_uri  TEXT DEFAULT '',
+			watched_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (profile_id, tmdb_id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS watchlist (
+			id          BIGSERIAL PRIMARY KEY,
+			profile_id  INTEGER NOT NULL,
+			tmdb_id     INTEGER NOT NULL,
+			media_type  TEXT NOT NULL DEFAULT 'movie',
+			title       TEXT NOT NULL,
+			poster_path TEXT DEFAULT '',
+			year        INTEGER DEFAULT 0,
+			added_at    TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (profile_id, tmdb_id, media_type)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS trakt_tokens (
+			profile_id    INTEGER PRIMARY KEY,
+			access_token  TEXT NOT NULL,
+			refresh_token TEXT NOT NULL,
+			expires_at    BIGINT NOT NULL -- unix seconds
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS downloads (
+			id           TEXT PRIMARY KEY,
+			tmdb_id      INTEGER NOT NULL,
+			title        TEXT NOT NULL,
+			season       INTEGER DEFAULT 0,
+			episode      INTEGER DEFAULT 0,
+			magnet_uri   TEXT NOT NULL,
+			info_hash    TEXT NOT NULL,
+			file_path    TEXT DEFAULT '',
+			file_index   INTEGER DEFAULT -1,
+			file_size    BIGINT DEFAULT 0,
+			status       TEXT NOT NULL,
+			error        TEXT DEFAULT '',
+			created_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			completed_at TIMESTAMPTZ
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS torrent_cache (
+			info_hash   TEXT PRIMARY KEY,
+			tmdb_id     INTEGER NOT NULL,
+			magnet_uri  TEXT NOT NULL,
+			title       TEXT NOT NULL,
+			file_path   TEXT DEFAULT '',
+			file_size   BIGINT DEFAULT 0,
+			last_used   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			created_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS settings (
+			key   TEXT PRIMARY KEY,
+			value TEXT NOT NULL -- JSON
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS ratings_cache (
+			imdb_id    TEXT PRIMARY KEY,
+			data       TEXT NOT NULL, -- JSON, "null" for unknown titles
+			fetched_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS skip_markers (
+			info_hash   TEXT NOT NULL,
+			file_index  INTEGER NOT NULL,
+			tmdb_id     INTEGER NOT NULL,
+			season      INTEGER NOT NULL,
+			episode     INTEGER NOT NULL,
+			data        TEXT NOT NULL, -- JSON, "[]" when nothing was found
+			analyzed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (info_hash, file_index)
+		)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := d.db.Exec(stmt); err != nil {
+			return fmt.Errorf("create schema: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// DefaultProfileID is the profile used when a request doesn't name one. It
+// owns all history recorded before profiles existed and can't be deleted.
+const DefaultProfileID = 1
+
+// ListProfiles returns all profiles ordered by creation.
+func (d *DB) ListProfiles() ([]models.Profile, error) {
+	rows, err := d.query(`
+		SELECT id, name, avatar, audio_language, subtitle_language, created_at
+		FROM profiles
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query profiles: %w", err)
+	}
+	defer rows.Close()
+
+	var profiles []models.Profile
+	for rows.Next() {
+		var p models.Profile
+		if err := rows.Scan(&p.ID, &p.Name, &p.Avatar, &p.AudioLanguage, &p.SubtitleLanguage, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan profile row: %w", err)
+		}
+		profiles = append(profiles, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate profile rows: %w", err)
+	}
+	return profiles, nil
+}
+
+// GetProfile returns a profile by ID, or nil if none exists.
+func (d *DB) GetProfile(id int) (*models.Profile, error) {
+	var p models.Profile
+	err := d.queryRow(`
+		SELECT id, name, avatar, audio_language, subtitle_language, created_at
+		FROM profiles
+		WHERE id = ?
+	`, id).Scan(&p.ID, &p.Name, &p.Avatar, &p.AudioLanguage, &p.SubtitleLanguage, &p.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get profile %d: %w", id, err)
+	}
+	return &p, nil
+}
+
+// CreateProfile inserts a new profile and returns it.
+func (d *DB) CreateProfile(p models.Profile) (*models.Profile, error) {
+	// RETURNING rather than LastInsertId, which PostgreSQL doesn't support.
+	var id int
+	err := d.queryRow(`
+		INSERT INTO profiles (name, avatar, audio_language, subtitle_language)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, p.Name, p.Avatar, p.AudioLanguage, p.SubtitleLanguage).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("create profile %q: %w", p.Name, err)
+	}
+	return d.GetProfile(id)
+}
+
+// UpdateProfile overwrites a profile's name, avatar and language preferences.
+func (d *DB) UpdateProfile(p models.Profile) error {
+	_, err := d.exec(`
+		UPDATE profiles
+		SET name = ?, avatar = ?, audio_language = ?, subtitle_language = ?
+		WHERE id = ?
+	`, p.Name, p.Avatar, p.AudioLanguage, p.SubtitleLanguage, p.ID)
+	if err != nil {
+		return fmt.Errorf("update profile %d: %w", p.ID, err)
+	}
+	return nil
+}
+
+// DeleteProfile removes a profile together with its history, watchlist and
+// notifications.
+func (d *DB) DeleteProfile(id int) error {
+	if id == DefaultProfileID {
+		return fmt.Errorf("the default profile can't be deleted")
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("delete profile %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"DELETE FROM watch_history WHERE profile_id = ?",
+		"DELETE FROM watchlist WHERE profile_id = ?",
+		"DELETE FROM notifications WHERE profile_id = ?",
+		"DELETE FROM profiles WHERE id = ?",
+	} {
+		if _, err := tx.Exec(d.rebind(stmt), id); err != nil {
+			return fmt.Errorf("delete profile %d: %w", id, err)
+		}
+	}
+	return tx.Commit()
+}
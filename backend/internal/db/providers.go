@@ -0,0 +1,64 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// GetProviderSession returns the saved login of a search provider, or nil if
+// there is none or it has expired.
+func (d *DB) GetProviderSession(provider string) (*models.ProviderSession, error) {
+	var (
+		cookies string
+		expires int64
+	)
+	err := d.queryRow(`
+		SELECT cookies, expires_at FROM provider_sessions WHERE provider = ? AND expires_at > ?
+	`, provider, time.Now().Unix()).Scan(&cookies, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get %s session: %w", provider, err)
+	}
+
+	s := &models.ProviderSession{Provider: provider, ExpiresAt: time.Unix(expires, 0)}
+	if err := json.Unmarshal([]byte(cookies), &s.Cookies); err != nil {
+		return nil, fmt.Errorf("decode %s session: %w", provider, err)
+	}
+	return s, nil
+}
+
+// SaveProviderSession saves (or replaces) a search provider's login.
+func (d *DB) SaveProviderSession(s *models.ProviderSession) error {
+	cookies, err := json.Marshal(s.Cookies)
+	if err != nil {
+		return fmt.Errorf("encode %s session: %w", s.Provider, err)
+	}
+	_, err = d.exec(`
+		INSERT INTO provider_sessions (provider, cookies, expires_at, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(provider) DO UPDATE SET
+			cookies    = excluded.cookies,
+			expires_at = excluded.expires_at,
+			updated_at = excluded.updated_at
+	`, s.Provider, string(cookies), s.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("save %s session: %w", s.Provider, err)
+	}
+	return nil
+}
+
+// DeleteProviderSession forgets a search provider's login, e.g. once the
+// site has ended it.
+func (d *DB) DeleteProviderSession(provider string) error {
+	_, err := d.exec("DELETE FROM provider_sessions WHERE provider = ?", provider)
+	if err != nil {
+		return fmt.Errorf("delete %s session: %w", provider, err)
+	}
+	return nil
+}
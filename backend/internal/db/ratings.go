@@ -0,0 +1,46 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetCachedRatings decodes the ratings cached for imdbID into dest. It
+// reports false when nothing is cached or the entry is older than maxAge.
+func (d *DB) GetCachedRatings(imdbID string, maxAge time.Duration, dest any) (bool, error) {
+	var data string
+	err := d.queryRow(
+		"SELECT data FROM ratings_cache WHERE imdb_id = ? AND fetched_at > ?",
+		imdbID, d.timestamp(time.Now().Add(-maxAge)),
+	).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get cached ratings %s: %w", imdbID, err)
+	}
+	if err := json.Unmarshal([]byte(data), dest); err != nil {
+		return false, fmt.Errorf("decode cached ratings %s: %w", imdbID, err)
+	}
+	return true, nil
+}
+
+// SaveCachedRatings caches ratings (which may be nil for unknown titles) for
+// imdbID.
+func (d *DB) SaveCachedRatings(imdbID string, ratings any) error {
+	data, err := json.Marshal(ratings)
+	if err != nil {
+		return fmt.Errorf("encode ratings %s: %w", imdbID, err)
+	}
+	_, err = d.exec(`
+		INSERT INTO ratings_cache (imdb_id, data, fetched_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(imdb_id) DO UPDATE SET data = excluded.data, fetched_at = excluded.fetched_at
+	`, imdbID, string(data))
+	if err != nil {
+		return fmt.Errorf("save ratings %s: %w", imdbID, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetCachedSearch decodes a provider's cached results for a normalized query
+// into dest. It reports false when nothing is cached or the entry is older
+// than maxAge.
+func (d *DB) GetCachedSearch(provider, query string, maxAge time.Duration, dest any) (bool, error) {
+	var data string
+	err := d.queryRow(
+		"SELECT results FROM search_cache WHERE provider = ? AND query = ? AND fetched_at > ?",
+		provider, query, d.timestamp(time.Now().Add(-maxAge)),
+	).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get cached %s search: %w", provider, err)
+	}
+	if err := json.Unmarshal([]byte(data), dest); err != nil {
+		return false, fmt.Errorf("decode cached %s search: %w", provider, err)
+	}
+	return true, nil
+}
+
+// SaveCachedSearch caches a provider's results for a normalized query.
+func (d *DB) SaveCachedSearch(provider, query string, results any) error {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("encode %s search: %w", provider, err)
+	}
+	_, err = d.exec(`
+		INSERT INTO search_cache (provider, query, results, fetched_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(provider, query) DO UPDATE SET results = excluded.results, fetched_at = excluded.fetched_at
+	`, provider, query, string(data))
+	if err != nil {
+		return fmt.Errorf("save %s search: %w", provider, err)
+	}
+	return nil
+}
+
+// PruneSearchCache deletes cached searches older than maxAge.
+func (d *DB) PruneSearchCache(maxAge time.Duration) error {
+	if _, err := d.exec("DELETE FROM search_cache WHERE fetched_at < ?", d.timestamp(time.Now().Add(-maxAge))); err != nil {
+		return fmt.Errorf("prune search cache: %w", err)
+	}
+	return nil
+}
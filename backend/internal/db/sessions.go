@@ -0,0 +1,132 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// SaveSession inserts or updates a persisted stream session so it can be
+// restored after a server restart.
+func (d *DB) SaveSession(s *models.StreamSession) error {
+	_, err := d.exec(`
+		INSERT INTO stream_sessions (id, tmdb_id, title, season, episode, magnet_uri, info_hash, file_path, file_index, file_size, content_type, audio_track, subtitle_offset, status, source, last_position, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+			magnet_uri      = excluded.magnet_uri,
+			info_hash       = excluded.info_hash,
+			file_path       = excluded.file_path,
+			file_index      = excluded.file_index,
+			file_size       = excluded.file_size,
+			content_type    = excluded.content_type,
+			audio_track     = excluded.audio_track,
+			subtitle_offset = excluded.subtitle_offset,
+			status          = excluded.status,
+			season          = excluded.season,
+			episode         = excluded.episode,
+			source          = excluded.source,
+			updated_at      = CURRENT_TIMESTAMP
+	`, s.ID, s.TMDbID, s.Title, s.Season, s.Episode, s.MagnetURI, s.InfoHash, s.FilePath, s.FileIndex, s.FileSize, s.ContentType, s.AudioTrack, s.SubtitleOffset, s.Status, s.Source, s.LastPosition)
+	if err != nil {
+		return fmt.Errorf("save session %s: %w", s.ID, err)
+	}
+	return nil
+}
+
+// UpdateSessionPosition records the last playback timestamp (seconds)
+// delivered to the client for a session.
+func (d *DB) UpdateSessionPosition(id string, position float64) error {
+	_, err := d.exec(`
+		UPDATE stream_sessions SET last_position = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, position, id)
+	if err != nil {
+		return fmt.Errorf("update position for session %s: %w", id, err)
+	}
+	return nil
+}
+
+// UpdateSessionAudioTrack records the audio track selected for a session.
+func (d *DB) UpdateSessionAudioTrack(id string, track int) error {
+	_, err := d.exec(`
+		UPDATE stream_sessions SET audio_track = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, track, id)
+	if err != nil {
+		return fmt.Errorf("update audio track for session %s: %w", id, err)
+	}
+	return nil
+}
+
+// UpdateSessionSubtitleOffset records the subtitle offset (milliseconds)
+// chosen for a session.
+func (d *DB) UpdateSessionSubtitleOffset(id string, offsetMs int64) error {
+	_, err := d.exec(`
+		UPDATE stream_sessions SET subtitle_offset = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, offsetMs, id)
+	if err != nil {
+		return fmt.Errorf("update subtitle offset for session %s: %w", id, err)
+	}
+	return nil
+}
+
+// sessionColumns is the column list read by GetSession and ListSessions.
+const sessionColumns = `id, tmdb_id, title, season, episode, magnet_uri, info_hash, file_path,
+	file_index, file_size, content_type, audio_track, subtitle_offset, status, source, last_position`
+
+// sessionScanner is satisfied by *sql.Row and *sql.Rows.
+type sessionScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row sessionScanner) (*models.StreamSession, error) {
+	var s models.StreamSession
+	err := row.Scan(
+		&s.ID, &s.TMDbID, &s.Title, &s.Season, &s.Episode, &s.MagnetURI, &s.InfoHash, &s.FilePath,
+		&s.FileIndex, &s.FileSize, &s.ContentType, &s.AudioTrack, &s.SubtitleOffset, &s.Status, &s.Source, &s.LastPosition,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetSession returns a persisted session by ID, or nil if none exists.
+func (d *DB) GetSession(id string) (*models.StreamSession, error) {
+	s, err := scanSession(d.queryRow("SELECT "+sessionColumns+" FROM stream_sessions WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session %s: %w", id, err)
+	}
+	return s, nil
+}
+
+// ListSessions returns all persisted sessions, most recently updated first.
+func (d *DB) ListSessions() ([]models.StreamSession, error) {
+	rows, err := d.query("SELECT " + sessionColumns + " FROM stream_sessions ORDER BY updated_at DESC")
+	if err != nil {
+		return nil, fmt.Errorf("query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.StreamSession
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession removes a persisted session.
+func (d *DB) DeleteSession(id string) error {
+	_, err := d.exec("DELETE FROM stream_sessions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete session %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SettingsKey is the settings row holding models.Settings.
+const SettingsKey = "settings"
+
+// GetSetting decodes the JSON value stored under key into dest. It reports
+// false, leaving dest untouched, when nothing is stored.
+func (d *DB) GetSetting(key string, dest any) (bool, error) {
+	var value string
+	err := d.queryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get setting %s: %w", key, err)
+	}
+	if err := json.Unmarshal([]byte(value), dest); err != nil {
+		return false, fmt.Errorf("decode setting %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// SaveSetting stores value as JSON under key.
+func (d *DB) SaveSetting(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode setting %s: %w", key, err)
+	}
+	_, err = d.exec(`
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, string(data))
+	if err != nil {
+		return fmt.Errorf("save setting %s: %w", key, err)
+	}
+	return nil
+}
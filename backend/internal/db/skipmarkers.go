@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// GetSkipMarkers returns the skip markers stored for a torrent file. It
+// reports false when the file hasn't been analysed; a file analysed without
+// finding anything has an empty list.
+func (d *DB) GetSkipMarkers(infoHash string, fileIndex int) ([]models.SkipMarker, bool, error) {
+	var data string
+	err := d.queryRow(
+		"SELECT data FROM skip_markers WHERE info_hash = ? AND file_index = ?",
+		infoHash, fileIndex,
+	).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("get skip markers %s/%d: %w", infoHash, fileIndex, err)
+	}
+	var markers []models.SkipMarker
+	if err := json.Unmarshal([]byte(data), &markers); err != nil {
+		return nil, false, fmt.Errorf("decode skip markers %s/%d: %w", infoHash, fileIndex, err)
+	}
+	return markers, true, nil
+}
+
+// SaveSkipMarkers stores the skip markers found in an episode's torrent
+// file. Markers are kept per file, since releases of an episode differ in
+// timing.
+func (d *DB) SaveSkipMarkers(infoHash string, fileIndex, tmdbID, season, episode int, markers []models.SkipMarker) error {
+	if markers == nil {
+		markers = []models.SkipMarker{}
+	}
+	data, err := json.Marshal(markers)
+	if err != nil {
+		return fmt.Errorf("encode skip markers %s/%d: %w", infoHash, fileIndex, err)
+	}
+	_, err = d.exec(`
+		INSERT INTO skip_markers (info_hash, file_index, tmdb_id, season, episode, data, analyzed_at)
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(info_hash, file_index) DO UPDATE SET data = excluded.data, analyzed_at = excluded.analyzed_at
+	`, infoHash, fileIndex, tmdbID, season, episode, string(data))
+	if err != nil {
+		return fmt.Errorf("save skip markers %s/%d: %w", infoHash, fileIndex, err)
+	}
+	return nil
+}
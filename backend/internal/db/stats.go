@@ -0,0 +1,195 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// statsTopN is how many genres and titles GetWatchStats ranks.
+const statsTopN = 10
+
+// GetWatchStats aggregates a profile's started titles last watched in
+// [from, to). Zero times leave that end of the range open.
+func (d *DB) GetWatchStats(profileID int, from, to time.Time) (*models.WatchStats, error) {
+	where := "h.profile_id = ? AND (h.progress > 0 OR h.completed = 1)"
+	args := []any{profileID}
+	if !from.IsZero() {
+		where += " AND h.updated_at >= ?"
+		args = append(args, d.timestamp(from))
+	}
+	if !to.IsZero() {
+		where += " AND h.updated_at < ?"
+		args = append(args, d.timestamp(to))
+	}
+
+	stats := &models.WatchStats{
+		Weekly:    []models.PeriodStat{},
+		Monthly:   []models.PeriodStat{},
+		TopGenres: []models.GenreStat{},
+		TopTitles: []models.TitleStat{},
+	}
+
+	var seconds float64
+	err := d.queryRow(`
+		SELECT COALESCE(SUM(h.progress), 0), COUNT(*), COALESCE(SUM(h.completed), 0)
+		FROM watch_history h
+		WHERE `+where, args...).Scan(&seconds, &stats.TitlesStarted, &stats.TitlesCompleted)
+	if err != nil {
+		return nil, fmt.Errorf("query watch totals: %w", err)
+	}
+	stats.Hours = hours(seconds)
+	if stats.TitlesStarted > 0 {
+		stats.CompletionRate = math.Round(float64(stats.TitlesCompleted)/float64(stats.TitlesStarted)*1000) / 1000
+	}
+
+	week := d.dialect(`strftime('%G-W%V', h.updated_at)`, `to_char(h.updated_at, 'IYYY-"W"IW')`)
+	month := d.dialect(`strftime('%Y-%m', h.updated_at)`, `to_char(h.updated_at, 'YYYY-MM')`)
+	if stats.Weekly, err = d.periodStats(week, where, args); err != nil {
+		return nil, err
+	}
+	if stats.Monthly, err = d.periodStats(month, where, args); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.query(`
+		SELECT g.genre, SUM(h.progress), COUNT(*)
+		FROM watch_history h
+		JOIN title_genres g ON g.media_type = h.media_type AND g.tmdb_id = h.tmdb_id
+		WHERE `+where+` AND g.genre <> ''
+		GROUP BY g.genre
+		ORDER BY 2 DESC, 3 DESC
+		LIMIT ?
+	`, append(args, statsTopN)...)
+	if err != nil {
+		return nil, fmt.Errorf("query genre stats: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g models.GenreStat
+		if err := rows.Scan(&g.Genre, &seconds, &g.Titles); err != nil {
+			return nil, fmt.Errorf("scan genre stats: %w", err)
+		}
+		g.Hours = hours(seconds)
+		stats.TopGenres = append(stats.TopGenres, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate genre stats: %w", err)
+	}
+
+	titleRows, err := d.query(`
+		SELECT h.tmdb_id, h.media_type, h.title, h.poster_path, h.progress, h.completed
+		FROM watch_history h
+		WHERE `+where+`
+		ORDER BY h.progress DESC
+		LIMIT ?
+	`, append(args, statsTopN)...)
+	if err != nil {
+		return nil, fmt.Errorf("query title stats: %w", err)
+	}
+	defer titleRows.Close()
+	for titleRows.Next() {
+		var (
+			t         models.TitleStat
+			completed int
+		)
+		if err := titleRows.Scan(&t.TMDbID, &t.MediaType, &t.Title, &t.PosterPath, &seconds, &completed); err != nil {
+			return nil, fmt.Errorf("scan title stats: %w", err)
+		}
+		t.Hours = hours(seconds)
+		t.Completed = completed != 0
+		stats.TopTitles = append(stats.TopTitles, t)
+	}
+	if err := titleRows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate title stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// periodStats groups the watch time matching where by the period expression.
+func (d *DB) periodStats(period, where string, args []any) ([]models.PeriodStat, error) {
+	rows, err := d.query(`
+		SELECT `+period+` AS period, SUM(h.progress), COUNT(*)
+		FROM watch_history h
+		WHERE `+where+`
+		GROUP BY period
+		ORDER BY period
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query period stats: %w", err)
+	}
+	defer rows.Close()
+
+	result := []models.PeriodStat{}
+	for rows.Next() {
+		var (
+			p       models.PeriodStat
+			seconds float64
+		)
+		if err := rows.Scan(&p.Period, &seconds, &p.Titles); err != nil {
+			return nil, fmt.Errorf("scan period stats: %w", err)
+		}
+		p.Hours = hours(seconds)
+		result = append(result, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate period stats: %w", err)
+	}
+	return result, nil
+}
+
+// TitlesWithoutGenres returns up to limit of a profile's history entries,
+// most recent first, whose genres haven't been saved.
+func (d *DB) TitlesWithoutGenres(profileID, limit int) ([]models.WatchHistory, error) {
+	rows, err := d.query(`
+		SELECT `+historyColumns+`
+		FROM watch_history h
+		WHERE h.profile_id = ? AND NOT EXISTS (
+			SELECT 1 FROM title_genres g WHERE g.media_type = h.media_type AND g.tmdb_id = h.tmdb_id
+		)
+		ORDER BY h.updated_at DESC
+		LIMIT ?
+	`, profileID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query titles without genres: %w", err)
+	}
+	defer rows.Close()
+
+	return scanHistoryRows(rows)
+}
+
+// SaveTitleGenres replaces the genres saved for a title. A title without
+// genres is saved with an empty one, so it isn't looked up again.
+func (d *DB) SaveTitleGenres(mediaType string, tmdbID int, genres []string) error {
+	if len(genres) == 0 {
+		genres = []string{""}
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("save genres for tmdb_id %d: %w", tmdbID, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(d.rebind("DELETE FROM title_genres WHERE media_type = ? AND tmdb_id = ?"), mediaType, tmdbID); err != nil {
+		return fmt.Errorf("save genres for tmdb_id %d: %w", tmdbID, err)
+	}
+	for _, g := range genres {
+		_, err := tx.Exec(d.rebind(`
+			INSERT INTO title_genres (media_type, tmdb_id, genre) VALUES (?, ?, ?)
+			ON CONFLICT DO NOTHING
+		`), mediaType, tmdbID, g)
+		if err != nil {
+			return fmt.Errorf("save genres for tmdb_id %d: %w", tmdbID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// hours converts seconds to hours, rounded to hundredths.
+func hours(seconds float64) float64 {
+	return math.Round(seconds/36) / 100
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// Store is the persistence interface the rest of the backend depends on.
+// DB implements it for both SQLite and PostgreSQL.
+type Store interface {
+	Close() error
+	Ping(ctx context.Context) error
+	DatabaseInfo() (*models.DatabaseInfo, error)
+	LibraryCounts() (*models.LibraryCounts, error)
+
+	SaveSession(s *models.StreamSession) error
+	UpdateSessionPosition(id string, position float64) error
+	UpdateSessionAudioTrack(id string, track int) error
+	UpdateSessionSubtitleOffset(id string, offsetMs int64) error
+	GetSession(id string) (*models.StreamSession, error)
+	ListSessions() ([]models.StreamSession, error)
+	DeleteSession(id string) error
+
+	ListProfiles() ([]models.Profile, error)
+	GetProfile(id int) (*models.Profile, error)
+	CreateProfile(p models.Profile) (*models.Profile, error)
+	UpdateProfile(p models.Profile) error
+	DeleteProfile(id int) error
+
+	GetHistory(profileID int, f models.HistoryFilter) ([]models.WatchHistory, int, error)
+	GetContinueWatching(profileID int) ([]models.WatchHistory, error)
+	GetHistoryEntry(profileID, tmdbID int, mediaType string) (*models.WatchHistory, error)
+	UpsertProgress(profileID, tmdbID int, mediaType, title, posterPath string, year int, duration int, progress float64, quality, magnetURI string) error
+	GetWatched(profileID int) ([]models.WatchHistory, error)
+	MarkWatched(profileID, tmdbID int, mediaType, title string, year int) error
+	DeleteHistory(profileID, tmdbID int, mediaType string) error
+
+	GetWatchStats(profileID int, from, to time.Time) (*models.WatchStats, error)
+	TitlesWithoutGenres(profileID, limit int) ([]models.WatchHistory, error)
+	SaveTitleGenres(mediaType string, tmdbID int, genres []string) error
+
+	ImportHistoryEntry(profileID int, h models.WatchHistory, conflict string) (bool, error)
+	ImportWatchlistItem(profileID int, item models.WatchlistItem, conflict string) (bool, error)
+
+	GetWatchlist(profileID int) ([]models.WatchlistItem, error)
+	AddToWatchlist(item models.WatchlistItem) error
+	RemoveFromWatchlist(profileID, tmdbID int, mediaType string) error
+
+	GetTraktToken(profileID int) (*models.TraktToken, error)
+	SaveTraktToken(profileID int, t *models.TraktToken) error
+	DeleteTraktToken(profileID int) error
+
+	SaveDownload(dl *models.Download) error
+	GetDownload(id string) (*models.Download, error)
+	ListDownloads(status string) ([]models.Download, error)
+	DeleteDownload(id string) error
+
+	FollowedShows() ([]models.FollowedShow, error)
+	GetTrackedEpisode(tmdbID int) (season, episode int, found bool, err error)
+	SaveTrackedEpisode(tmdbID, season, episode int) error
+	AddNotification(n models.Notification) (bool, error)
+	ListNotifications(profileID int, unreadOnly bool, limit int) ([]models.Notification, error)
+	CountUnreadNotifications(profileID int) (int, error)
+	MarkNotificationsRead(profileID int, ids []int) error
+
+	GetSetting(key string, dest any) (bool, error)
+	SaveSetting(key string, value any) error
+
+	GetProviderSession(provider string) (*models.ProviderSession, error)
+	SaveProviderSession(s *models.ProviderSession) error
+	DeleteProviderSession(provider string) error
+
+	GetCachedSearch(provider, query string, maxAge time.Duration, dest any) (bool, error)
+	SaveCachedSearch(provider, query string, results any) error
+	PruneSearchCache(maxAge time.Duration) error
+
+	GetCachedRatings(imdbID string, maxAge time.Duration, dest any) (bool, error)
+	SaveCachedRatings(imdbID string, ratings any) error
+
+	GetSkipMarkers(infoHash string, fileIndex int) ([]models.SkipMarker, bool, error)
+	SaveSkipMarkers(infoHash string, fileIndex, tmdbID, season, episode int, markers []models.SkipMarker) error
+}
+
+var _ Store = (*DB)(nil)
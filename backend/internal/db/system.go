@@ -0,0 +1,56 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// DatabaseInfo returns the database driver, size on disk and schema version.
+func (d *DB) DatabaseInfo() (*models.DatabaseInfo, error) {
+	info := &models.DatabaseInfo{Driver: d.dialect("sqlite", "postgres")}
+
+	sizeQuery := d.dialect(
+		"SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()",
+		"SELECT pg_database_size(current_database())",
+	)
+	if err := d.queryRow(sizeQuery).Scan(&info.SizeBytes); err != nil {
+		return nil, fmt.Errorf("get database size: %w", err)
+	}
+
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	info.SchemaVersion = version
+	return info, nil
+}
+
+// LibraryCounts counts profiles, history entries, watchlist items and
+// downloads by status.
+func (d *DB) LibraryCounts() (*models.LibraryCounts, error) {
+	counts := &models.LibraryCounts{Downloads: make(map[string]int)}
+	err := d.queryRow(`SELECT
+		(SELECT COUNT(*) FROM profiles),
+		(SELECT COUNT(*) FROM watch_history),
+		(SELECT COUNT(*) FROM watchlist)`,
+	).Scan(&counts.Profiles, &counts.HistoryEntries, &counts.WatchlistItems)
+	if err != nil {
+		return nil, fmt.Errorf("count library: %w", err)
+	}
+
+	rows, err := d.query("SELECT status, COUNT(*) FROM downloads GROUP BY status")
+	if err != nil {
+		return nil, fmt.Errorf("count downloads: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("scan download count: %w", err)
+		}
+		counts.Downloads[status] = n
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// GetTraktToken returns the Trakt OAuth token linked to a profile, or nil.
+func (d *DB) GetTraktToken(profileID int) (*models.TraktToken, error) {
+	var (
+		t       models.TraktToken
+		expires int64
+	)
+	err := d.queryRow(`
+		SELECT access_token, refresh_token, expires_at FROM trakt_tokens WHERE profile_id = ?
+	`, profileID).Scan(&t.AccessToken, &t.RefreshToken, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get trakt token for profile %d: %w", profileID, err)
+	}
+	t.ExpiresAt = time.Unix(expires, 0)
+	return &t, nil
+}
+
+// SaveTraktToken links (or re-links) a Trakt account to a profile.
+func (d *DB) SaveTraktToken(profileID int, t *models.TraktToken) error {
+	_, err := d.exec(`
+		INSERT INTO trakt_tokens (profile_id, access_token, refresh_token, expires_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(profile_id) DO UPDATE SET
+			access_token  = excluded.access_token,
+			refresh_token = excluded.refresh_token,
+			expires_at    = excluded.expires_at
+	`, profileID, t.AccessToken, t.RefreshToken, t.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("save trakt token for profile %d: %w", profileID, err)
+	}
+	return nil
+}
+
+// DeleteTraktToken unlinks a profile's Trakt account.
+func (d *DB) DeleteTraktToken(profileID int) error {
+	_, err := d.exec("DELETE FROM trakt_tokens WHERE profile_id = ?", profileID)
+	if err != nil {
+		return fmt.Errorf("delete trakt token for profile %d: %w", profileID, err)
+	}
+	return nil
+}
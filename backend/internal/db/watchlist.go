@@ -0,0 +1,62 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// GetWatchlist returns a profile's watchlist, most recently added first.
+func (d *DB) GetWatchlist(profileID int) ([]models.WatchlistItem, error) {
+	rows, err := d.query(`
+		SELECT id, profile_id, tmdb_id, media_type, title, poster_path, year, added_at
+		FROM watchlist
+		WHERE profile_id = ?
+		ORDER BY added_at DESC
+	`, profileID)
+	if err != nil {
+		return nil, fmt.Errorf("query watchlist: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.WatchlistItem
+	for rows.Next() {
+		var w models.WatchlistItem
+		if err := rows.Scan(&w.ID, &w.ProfileID, &w.TMDbID, &w.MediaType, &w.Title, &w.PosterPath, &w.Year, &w.AddedAt); err != nil {
+			return nil, fmt.Errorf("scan watchlist row: %w", err)
+		}
+		items = append(items, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate watchlist rows: %w", err)
+	}
+	return items, nil
+}
+
+// AddToWatchlist adds a title to a profile's watchlist, refreshing its
+// metadata if it is already there.
+func (d *DB) AddToWatchlist(item models.WatchlistItem) error {
+	_, err := d.exec(`
+		INSERT INTO watchlist (profile_id, tmdb_id, media_type, title, poster_path, year)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(profile_id, tmdb_id, media_type) DO UPDATE SET
+			title       = excluded.title,
+			poster_path = excluded.poster_path,
+			year        = excluded.year
+	`, item.ProfileID, item.TMDbID, item.MediaType, item.Title, item.PosterPath, item.Year)
+	if err != nil {
+		return fmt.Errorf("add tmdb_id %d to watchlist: %w", item.TMDbID, err)
+	}
+	return nil
+}
+
+// RemoveFromWatchlist removes a title from a profile's watchlist.
+func (d *DB) RemoveFromWatchlist(profileID, tmdbID int, mediaType string) error {
+	_, err := d.exec(`
+		DELETE FROM watchlist WHERE profile_id = ? AND tmdb_id = ? AND media_type = ?
+	`, profileID, tmdbID, mediaType)
+	if err != nil {
+		return fmt.Errorf("remove tmdb_id %d from watchlist: %w", tmdbID, err)
+	}
+	return nil
+}
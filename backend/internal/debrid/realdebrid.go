@@ -0,0 +1,192 @@
+package debrid
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+)
+
+const defaultBaseURL = "https://api.real-debrid.com/rest/1.0"
+
+// cachedWait is how long to wait for a magnet to turn "downloaded". Cached
+// torrents flip almost immediately; anything slower isn't cached.
+const cachedWait = 10 * time.Second
+
+var videoExts = map[string]bool{
+	".mp4": true, ".mkv": true, ".avi": true, ".webm": true,
+	".mov": true, ".wmv": true, ".flv": true, ".m4v": true,
+}
+
+// RealDebrid resolves magnets to direct download links for torrents that are
+// already cached on Real-Debrid.
+type RealDebrid struct {
+	apiKey  string
+	http    *httpclient.Client
+	baseURL string
+}
+
+// NewRealDebrid creates a Real-Debrid client authenticated with the given API token.
+func NewRealDebrid(apiKey string, opts httpclient.Options) *RealDebrid {
+	if opts.Timeout == 0 {
+		opts.Timeout = 15 * time.Second
+	}
+	return &RealDebrid{
+		apiKey:  apiKey,
+		http:    httpclient.New(opts),
+		baseURL: defaultBaseURL,
+	}
+}
+
+func (rd *RealDebrid) Name() string { return "debrid" }
+
+// Resolve adds the magnet to Real-Debrid, selects the largest video file and,
+// if the torrent is cached, returns an unrestricted direct link to it.
+// Uncached torrents are removed again and reported as an error.
+func (rd *RealDebrid) Resolve(ctx context.Context, req models.SourceRequest) (*models.DirectStream, error) {
+	if req.MagnetURI == "" {
+		return nil, fmt.Errorf("real-debrid needs a magnet uri")
+	}
+
+	var added struct {
+		ID string `json:"id"`
+	}
+	if err := rd.do(ctx, http.MethodPost, "/torrents/addMagnet", url.Values{"magnet": {req.MagnetURI}}, &added); err != nil {
+		return nil, fmt.Errorf("add magnet: %w", err)
+	}
+
+	stream, err := rd.resolveTorrent(ctx, added.ID)
+	if err != nil {
+		if delErr := rd.do(context.Background(), http.MethodDelete, "/torrents/delete/"+added.ID, nil, nil); delErr != nil {
+			log.Warn().Err(delErr).Str("id", added.ID).Msg("real-debrid: failed to delete torrent")
+		}
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (rd *RealDebrid) resolveTorrent(ctx context.Context, id string) (*models.DirectStream, error) {
+	info, err := rd.info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		bestID   int
+		bestSize int64
+		bestPath string
+	)
+	for _, f := range info.Files {
+		if videoExts[strings.ToLower(filepath.Ext(f.Path))] && f.Bytes > bestSize {
+			bestID, bestSize, bestPath = f.ID, f.Bytes, f.Path
+		}
+	}
+	if bestID == 0 {
+		return nil, fmt.Errorf("no video file in torrent")
+	}
+
+	form := url.Values{"files": {strconv.Itoa(bestID)}}
+	if err := rd.do(ctx, http.MethodPost, "/torrents/selectFiles/"+id, form, nil); err != nil {
+		return nil, fmt.Errorf("select files: %w", err)
+	}
+
+	deadline := time.Now().Add(cachedWait)
+	for {
+		info, err = rd.info(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if info.Status == "downloaded" && len(info.Links) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("torrent not cached on real-debrid (status %s)", info.Status)
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	var link struct {
+		Download string `json:"download"`
+		Filename string `json:"filename"`
+		Filesize int64  `json:"filesize"`
+		MimeType string `json:"mimeType"`
+	}
+	if err := rd.do(ctx, http.MethodPost, "/unrestrict/link", url.Values{"link": {info.Links[0]}}, &link); err != nil {
+		return nil, fmt.Errorf("unrestrict link: %w", err)
+	}
+
+	return &models.DirectStream{
+		URL:         link.Download,
+		FileName:    filepath.Base(bestPath),
+		ContentType: link.MimeType,
+		Size:        link.Filesize,
+	}, nil
+}
+
+type rdTorrentInfo struct {
+	Status string `json:"status"`
+	Files  []struct {
+		ID    int    `json:"id"`
+		Path  string `json:"path"`
+		Bytes int64  `json:"bytes"`
+	} `json:"files"`
+	Links []string `json:"links"`
+}
+
+func (rd *RealDebrid) info(ctx context.Context, id string) (*rdTorrentInfo, error) {
+	var info rdTorrentInfo
+	if err := rd.do(ctx, http.MethodGet, "/torrents/info/"+id, nil, &info); err != nil {
+		return nil, fmt.Errorf("torrent info: %w", err)
+	}
+	return &info, nil
+}
+
+// do performs an authenticated API call, form-encoding form (if any) and
+// JSON-decoding the response into dest (if non-nil).
+func (rd *RealDebrid) do(ctx context.Context, method, path string, form url.Values, dest any) error {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rd.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+rd.apiKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := rd.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("real-debrid api returned status %d", resp.StatusCode)
+	}
+	if dest == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
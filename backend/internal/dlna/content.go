@@ -0,0 +1,249 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	rootID = "0"
+
+	// DLNA.ORG_OP=01: byte seeking supported; DLNA.ORG_FLAGS: streaming
+	// transfer mode, DLNA v1.5.
+	dlnaFeatures = "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+)
+
+// ContentFeatures is the contentFeatures.dlna.org header value for media
+// responses.
+func ContentFeatures() string {
+	return dlnaFeatures
+}
+
+// soapRequest extracts the action arguments from a SOAP envelope.
+type soapRequest struct {
+	Body struct {
+		Action struct {
+			XMLName xml.Name
+			Args    []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+func parseSOAP(c *gin.Context) (action string, args map[string]string, err error) {
+	var req soapRequest
+	if err := xml.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		return "", nil, err
+	}
+	args = make(map[string]string)
+	for _, a := range req.Body.Action.Args {
+		args[a.XMLName.Local] = strings.TrimSpace(a.Value)
+	}
+	return req.Body.Action.XMLName.Local, args, nil
+}
+
+// soapResponse writes an action response; args are written in order as
+// name/value pairs.
+func soapResponse(c *gin.Context, service, action string, args ...string) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	b.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&b, `<u:%sResponse xmlns:u="urn:schemas-upnp-org:service:%s:1">`, action, service)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, "<%s>%s</%s>", args[i], xmlEscape(args[i+1]), args[i])
+	}
+	fmt.Fprintf(&b, `</u:%sResponse></s:Body></s:Envelope>`, action)
+
+	c.Header("Server", serverHeader)
+	c.Data(http.StatusOK, `text/xml; charset="utf-8"`, []byte(b.String()))
+}
+
+// soapFault writes a UPnP error response.
+func soapFault(c *gin.Context, code int, desc string) {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`+
+		`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`+
+		`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError>`+
+		`</detail></s:Fault></s:Body></s:Envelope>`, code, xmlEscape(desc))
+	c.Data(http.StatusInternalServerError, `text/xml; charset="utf-8"`, []byte(body))
+}
+
+func (s *Server) contentDirectoryControl(c *gin.Context) {
+	action, args, err := parseSOAP(c)
+	if err != nil {
+		soapFault(c, 402, "invalid args")
+		return
+	}
+
+	switch action {
+	case "Browse":
+		s.browse(c, args)
+	case "GetSystemUpdateID":
+		soapResponse(c, "ContentDirectory", action, "Id", "1")
+	case "GetSearchCapabilities":
+		soapResponse(c, "ContentDirectory", action, "SearchCaps", "")
+	case "GetSortCapabilities":
+		soapResponse(c, "ContentDirectory", action, "SortCaps", "")
+	default:
+		soapFault(c, 401, "invalid action")
+	}
+}
+
+func (s *Server) connectionManagerControl(c *gin.Context) {
+	action, _, err := parseSOAP(c)
+	if err != nil {
+		soapFault(c, 402, "invalid args")
+		return
+	}
+
+	switch action {
+	case "GetProtocolInfo":
+		soapResponse(c, "ConnectionManager", action,
+			"Source", "http-get:*:video/mp4:*,http-get:*:video/x-matroska:*,http-get:*:video/x-msvideo:*,http-get:*:video/webm:*",
+			"Sink", "")
+	case "GetCurrentConnectionIDs":
+		soapResponse(c, "ConnectionManager", action, "ConnectionIDs", "0")
+	case "GetCurrentConnectionInfo":
+		soapResponse(c, "ConnectionManager", action,
+			"RcsID", "-1", "AVTransportID", "-1", "ProtocolInfo", "",
+			"PeerConnectionManager", "", "PeerConnectionID", "-1",
+			"Direction", "Output", "Status", "OK")
+	default:
+		soapFault(c, 401, "invalid action")
+	}
+}
+
+// browse answers BrowseMetadata (the object itself) and BrowseDirectChildren.
+// Object IDs are "0" (root), "<folder>" and "<folder>/<video>".
+func (s *Server) browse(c *gin.Context, args map[string]string) {
+	objectID := args["ObjectID"]
+	start, _ := strconv.Atoi(args["StartingIndex"])
+	count, _ := strconv.Atoi(args["RequestedCount"])
+	baseURL := "http://" + c.Request.Host
+
+	folders := s.library.Folders()
+
+	var entries []string
+	var total int
+	switch args["BrowseFlag"] {
+	case "BrowseMetadata":
+		entry, ok := metadataEntry(objectID, folders, baseURL)
+		if !ok {
+			soapFault(c, 701, "no such object")
+			return
+		}
+		entries, total = []string{entry}, 1
+	case "BrowseDirectChildren":
+		if objectID == rootID {
+			for _, f := range folders {
+				entries = append(entries, containerEntry(f))
+			}
+		} else {
+			f, ok := findFolder(folders, objectID)
+			if !ok {
+				soapFault(c, 701, "no such object")
+				return
+			}
+			for _, v := range f.Videos {
+				entries = append(entries, itemEntry(f.ID, v, baseURL))
+			}
+		}
+		total = len(entries)
+		if start > len(entries) {
+			start = len(entries)
+		}
+		entries = entries[start:]
+		if count > 0 && count < len(entries) {
+			entries = entries[:count]
+		}
+	default:
+		soapFault(c, 402, "invalid BrowseFlag")
+		return
+	}
+
+	didl := `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" ` +
+		`xmlns:dc="http://purl.org/dc/elements/1.1/" ` +
+		`xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/" ` +
+		`xmlns:dlna="urn:schemas-dlna-org:metadata-1-0/">` +
+		strings.Join(entries, "") + `</DIDL-Lite>`
+
+	soapResponse(c, "ContentDirectory", "Browse",
+		"Result", didl,
+		"NumberReturned", strconv.Itoa(len(entries)),
+		"TotalMatches", strconv.Itoa(total),
+		"UpdateID", "1")
+}
+
+func findFolder(folders []Folder, id string) (Folder, bool) {
+	for _, f := range folders {
+		if f.ID == id {
+			return f, true
+		}
+	}
+	return Folder{}, false
+}
+
+func metadataEntry(objectID string, folders []Folder, baseURL string) (string, bool) {
+	if objectID == rootID {
+		return fmt.Sprintf(`<container id="0" parentID="-1" restricted="1" childCount="%d">`+
+			`<dc:title>StreamBox</dc:title><upnp:class>object.container.storageFolder</upnp:class></container>`,
+			len(folders)), true
+	}
+
+	folderID, videoID, isItem := strings.Cut(objectID, "/")
+	f, ok := findFolder(folders, folderID)
+	if !ok {
+		return "", false
+	}
+	if !isItem {
+		return containerEntry(f), true
+	}
+	for _, v := range f.Videos {
+		if v.ID == videoID {
+			return itemEntry(f.ID, v, baseURL), true
+		}
+	}
+	return "", false
+}
+
+func containerEntry(f Folder) string {
+	return fmt.Sprintf(`<container id="%s" parentID="0" restricted="1" childCount="%d">`+
+		`<dc:title>%s</dc:title><upnp:class>object.container.storageFolder</upnp:class></container>`,
+		xmlEscape(f.ID), len(f.Videos), xmlEscape(f.Title))
+}
+
+func itemEntry(folderID string, v Video, baseURL string) string {
+	var attrs strings.Builder
+	fmt.Fprintf(&attrs, ` protocolInfo="http-get:*:%s:%s"`, v.MimeType, dlnaFeatures)
+	if v.Size > 0 {
+		fmt.Fprintf(&attrs, ` size="%d"`, v.Size)
+	}
+	if v.Duration > 0 {
+		fmt.Fprintf(&attrs, ` duration="%s"`, formatDuration(v.Duration))
+	}
+
+	return fmt.Sprintf(`<item id="%s/%s" parentID="%s" restricted="1">`+
+		`<dc:title>%s</dc:title><upnp:class>object.item.videoItem.movie</upnp:class>`+
+		`<res%s>%s</res></item>`,
+		xmlEscape(folderID), xmlEscape(v.ID), xmlEscape(folderID),
+		xmlEscape(v.Title), attrs.String(), xmlEscape(baseURL+v.Path))
+}
+
+// formatDuration renders seconds as H:MM:SS.mmm.
+func formatDuration(seconds float64) string {
+	ms := int64(seconds * 1000)
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package dlna
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// HTTP paths served by the media server (see Routes).
+const (
+	descriptionPath       = "/dlna/device.xml"
+	contentDirectorySCPD  = "/dlna/ContentDirectory.xml"
+	connectionManagerSCPD = "/dlna/ConnectionManager.xml"
+	contentDirectoryCtl   = "/dlna/control/ContentDirectory"
+	connectionManagerCtl  = "/dlna/control/ConnectionManager"
+	contentDirectoryEvt   = "/dlna/event/ContentDirectory"
+	connectionManagerEvt  = "/dlna/event/ConnectionManager"
+)
+
+// Video is a playable item exposed to DLNA renderers.
+type Video struct {
+	ID       string // unique within its folder
+	Title    string
+	Path     string // server-relative URL the renderer fetches
+	MimeType string
+	Size     int64   // 0 if unknown (e.g. transcoded)
+	Duration float64 // seconds, 0 if unknown
+}
+
+// Folder is a top-level container of videos.
+type Folder struct {
+	ID     string
+	Title  string
+	Videos []Video
+}
+
+// Library supplies the content tree. It is queried on every browse, so it
+// always reflects the current sessions.
+type Library interface {
+	Folders() []Folder
+}
+
+// Server is a UPnP AV MediaServer: it announces itself over SSDP and answers
+// ContentDirectory browse requests so smart TVs and consoles can play
+// StreamBox content natively.
+type Server struct {
+	name    string
+	uuid    string
+	port    int
+	library Library
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// NewServer creates a media server announced as name, reachable over HTTP on
+// port. The device UUID is derived from the host name so renderers
+// recognize the server across restarts.
+func NewServer(name string, port int, library Library) *Server {
+	host, _ := os.Hostname()
+	return &Server{
+		name:    name,
+		uuid:    uuid.NewSHA1(uuid.NameSpaceOID, []byte("streambox-dlna:"+host+":"+name)).String(),
+		port:    port,
+		library: library,
+		stop:    make(chan struct{}),
+	}
+}
+
+// Start joins the SSDP multicast group and begins advertising.
+func (s *Server) Start() error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, ssdpAddr)
+	if err != nil {
+		return fmt.Errorf("join ssdp group: %w", err)
+	}
+	go s.advertise(conn, s.stop)
+
+	log.Info().Str("name", s.name).Str("uuid", s.uuid).Msg("dlna media server started")
+	return nil
+}
+
+// Close announces that the server is going away and stops advertising.
+func (s *Server) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// Routes registers the description, control and eventing endpoints.
+func (s *Server) Routes(r gin.IRoutes) {
+	r.GET(descriptionPath, s.serveDescription)
+	r.GET(contentDirectorySCPD, serveXML(contentDirectoryXML))
+	r.GET(connectionManagerSCPD, serveXML(connectionManagerXML))
+	r.POST(contentDirectoryCtl, s.contentDirectoryControl)
+	r.POST(connectionManagerCtl, s.connectionManagerControl)
+	for _, path := range []string{contentDirectoryEvt, connectionManagerEvt} {
+		r.Handle("SUBSCRIBE", path, subscribe)
+		r.Handle("UNSUBSCRIBE", path, func(c *gin.Context) { c.Status(http.StatusOK) })
+	}
+}
+
+func (s *Server) serveDescription(c *gin.Context) {
+	c.Header("Server", serverHeader)
+	c.Data(http.StatusOK, `text/xml; charset="utf-8"`, []byte(fmt.Sprintf(deviceXML,
+		xmlEscape(s.name), s.uuid,
+		contentDirectorySCPD, contentDirectoryCtl, contentDirectoryEvt,
+		connectionManagerSCPD, connectionManagerCtl, connectionManagerEvt,
+	)))
+}
+
+func serveXML(body string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, `text/xml; charset="utf-8"`, []byte(body))
+	}
+}
+
+// subscribe accepts GENA subscriptions without ever sending events; some
+// renderers refuse servers whose subscriptions fail. The content tree only
+// changes through new sessions, which renderers pick up on the next browse.
+func subscribe(c *gin.Context) {
+	c.Header("SID", "uuid:"+uuid.New().String())
+	c.Header("TIMEOUT", "Second-1800")
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,155 @@
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ssdpMaxAge       = 1800
+	ssdpNotifyPeriod = 15 * time.Minute
+	serverHeader     = "Linux/1.0 UPnP/1.0 StreamBox/1.0"
+)
+
+var ssdpAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// advertisedTypes are the search targets answered besides the device UUID.
+var advertisedTypes = []string{
+	"upnp:rootdevice",
+	"urn:schemas-upnp-org:device:MediaServer:1",
+	"urn:schemas-upnp-org:service:ContentDirectory:1",
+	"urn:schemas-upnp-org:service:ConnectionManager:1",
+}
+
+// advertise answers SSDP M-SEARCH requests and periodically multicasts
+// ssdp:alive notifications until stop is closed, then sends ssdp:byebye.
+func (s *Server) advertise(conn *net.UDPConn, stop <-chan struct{}) {
+	go s.answerSearches(conn)
+
+	s.notify("ssdp:alive")
+	ticker := time.NewTicker(ssdpNotifyPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.notify("ssdp:alive")
+		case <-stop:
+			s.notify("ssdp:byebye")
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (s *Server) answerSearches(conn *net.UDPConn) {
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return // closed
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil || req.Method != "M-SEARCH" || req.Header.Get("MAN") != `"ssdp:discover"` {
+			continue
+		}
+
+		targets := s.matchTargets(req.Header.Get("ST"))
+		if len(targets) == 0 {
+			continue
+		}
+		mx, _ := strconv.Atoi(req.Header.Get("MX"))
+		go s.respond(from, targets, mx)
+	}
+}
+
+// matchTargets returns the search targets to answer for an ST header.
+func (s *Server) matchTargets(st string) []string {
+	all := append([]string{"uuid:" + s.uuid}, advertisedTypes...)
+	if st == "ssdp:all" {
+		return all
+	}
+	for _, t := range all {
+		if t == st {
+			return []string{t}
+		}
+	}
+	return nil
+}
+
+// respond sends unicast search responses after the random delay (up to MX
+// seconds, capped at one) the spec asks for to spread load.
+func (s *Server) respond(to *net.UDPAddr, targets []string, mx int) {
+	if mx > 1 {
+		mx = 1
+	}
+	if mx > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(mx) * int64(time.Second))))
+	}
+
+	conn, err := net.DialUDP("udp4", nil, to)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	location := s.location(conn.LocalAddr().(*net.UDPAddr).IP)
+
+	for _, st := range targets {
+		msg := fmt.Sprintf("HTTP/1.1 200 OK\r\n"+
+			"CACHE-CONTROL: max-age=%d\r\n"+
+			"DATE: %s\r\n"+
+			"EXT:\r\n"+
+			"LOCATION: %s\r\n"+
+			"SERVER: %s\r\n"+
+			"ST: %s\r\n"+
+			"USN: %s\r\n\r\n",
+			ssdpMaxAge, time.Now().UTC().Format(http.TimeFormat), location, serverHeader, st, s.usn(st))
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			log.Debug().Err(err).Str("to", to.String()).Msg("ssdp response failed")
+			return
+		}
+	}
+}
+
+// notify multicasts a NOTIFY for every advertised target.
+func (s *Server) notify(nts string) {
+	conn, err := net.DialUDP("udp4", nil, ssdpAddr)
+	if err != nil {
+		log.Warn().Err(err).Msg("ssdp notify failed")
+		return
+	}
+	defer conn.Close()
+	location := s.location(conn.LocalAddr().(*net.UDPAddr).IP)
+
+	for _, nt := range append([]string{"uuid:" + s.uuid}, advertisedTypes...) {
+		msg := fmt.Sprintf("NOTIFY * HTTP/1.1\r\n"+
+			"HOST: %s\r\n"+
+			"CACHE-CONTROL: max-age=%d\r\n"+
+			"LOCATION: %s\r\n"+
+			"NT: %s\r\n"+
+			"NTS: %s\r\n"+
+			"SERVER: %s\r\n"+
+			"USN: %s\r\n\r\n",
+			ssdpAddr, ssdpMaxAge, location, nt, nts, serverHeader, s.usn(nt))
+		conn.Write([]byte(msg))
+	}
+}
+
+func (s *Server) usn(target string) string {
+	if strings.HasPrefix(target, "uuid:") {
+		return target
+	}
+	return "uuid:" + s.uuid + "::" + target
+}
+
+func (s *Server) location(ip net.IP) string {
+	return fmt.Sprintf("http://%s:%d%s", ip, s.port, descriptionPath)
+}
@@ -0,0 +1,189 @@
+// Package episodes watches the TV shows profiles follow (on their watchlist
+// or in their history) for newly aired episodes, storing a notification for
+// each follower and sending it to the notification sinks.
+package episodes
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/notify"
+	"github.com/streambox/backend/internal/tmdb"
+)
+
+// startDelay keeps the first check out of the busy startup.
+const startDelay = time.Minute
+
+// Tracker checks TMDB for new episodes of followed shows.
+type Tracker struct {
+	db       db.Store
+	tmdb     *tmdb.Client
+	notifier *notify.Notifier
+
+	mu sync.Mutex // one check at a time
+}
+
+func NewTracker(database db.Store, tmdbClient *tmdb.Client, notifier *notify.Notifier) *Tracker {
+	return &Tracker{db: database, tmdb: tmdbClient, notifier: notifier}
+}
+
+// Start checks for new episodes every interval until ctx is cancelled.
+func (t *Tracker) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		wait := startDelay
+		for {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+			wait = interval
+
+			added, err := t.Check(ctx)
+			if err != nil {
+				log.Warn().Err(err).Msg("new episode check failed")
+				continue
+			}
+			log.Debug().Int("notifications", added).Msg("new episode check done")
+		}
+	}()
+
+	log.Info().Dur("interval", interval).Msg("new episode tracking started")
+}
+
+// Check looks for episodes that aired since the last check of each followed
+// show, returning how many notifications it added. The first check of a
+// show only records its latest episode.
+func (t *Tracker) Check(ctx context.Context) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	followed, err := t.db.FollowedShows()
+	if err != nil {
+		return 0, err
+	}
+	followers := make(map[int][]models.FollowedShow)
+	var order []int
+	for _, f := range followed {
+		if followers[f.TMDbID] == nil {
+			order = append(order, f.TMDbID)
+		}
+		followers[f.TMDbID] = append(followers[f.TMDbID], f)
+	}
+
+	added := 0
+	for _, id := range order {
+		if ctx.Err() != nil {
+			return added, ctx.Err()
+		}
+		n, err := t.checkShow(ctx, id, followers[id])
+		added += n
+		if err != nil {
+			log.Warn().Err(err).Int("tmdb_id", id).Msg("failed to check show for new episodes")
+		}
+	}
+	return added, nil
+}
+
+func (t *Tracker) checkShow(ctx context.Context, tmdbID int, followers []models.FollowedShow) (int, error) {
+	show, err := t.tmdb.GetTVDetails(ctx, tmdbID)
+	if err != nil {
+		return 0, err
+	}
+	last := show.LastEpisodeToAir
+	if last == nil {
+		return 0, nil // nothing aired yet
+	}
+
+	season, episode, found, err := t.db.GetTrackedEpisode(tmdbID)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, t.db.SaveTrackedEpisode(tmdbID, last.SeasonNumber, last.EpisodeNumber)
+	}
+	if last.SeasonNumber < season || (last.SeasonNumber == season && last.EpisodeNumber <= episode) {
+		return 0, nil
+	}
+
+	added := 0
+	for _, ep := range t.airedSince(ctx, tmdbID, season, episode, *last) {
+		notified := false
+		for _, f := range followers {
+			ok, err := t.db.AddNotification(models.Notification{
+				ProfileID:  f.ProfileID,
+				Type:       string(notify.NewEpisode),
+				TMDbID:     tmdbID,
+				Title:      f.Title,
+				Season:     ep.SeasonNumber,
+				Episode:    ep.EpisodeNumber,
+				Message:    ep.Name,
+				PosterPath: f.PosterPath,
+				AirDate:    ep.AirDate,
+			})
+			if err != nil {
+				return added, err
+			}
+			if ok {
+				added++
+				notified = true
+			}
+		}
+		if notified {
+			t.notifyEpisode(followers[0].Title, tmdbID, ep)
+		}
+	}
+
+	return added, t.db.SaveTrackedEpisode(tmdbID, last.SeasonNumber, last.EpisodeNumber)
+}
+
+// airedSince returns the episodes of last's season after season/episode, up
+// to last. Earlier seasons that aired entirely between two checks are
+// skipped. If the season can't be loaded, only last is returned.
+func (t *Tracker) airedSince(ctx context.Context, tmdbID, season, episode int, last models.Episode) []models.Episode {
+	from := 1
+	if last.SeasonNumber == season {
+		from = episode + 1
+	}
+	if from >= last.EpisodeNumber {
+		return []models.Episode{last}
+	}
+
+	details, err := t.tmdb.GetSeasonDetails(ctx, tmdbID, last.SeasonNumber)
+	if err != nil {
+		log.Warn().Err(err).Int("tmdb_id", tmdbID).Int("season", last.SeasonNumber).Msg("failed to load season for new episodes")
+		return []models.Episode{last}
+	}
+	var eps []models.Episode
+	for _, ep := range details.Episodes {
+		if ep.EpisodeNumber >= from && ep.EpisodeNumber <= last.EpisodeNumber {
+			eps = append(eps, ep)
+		}
+	}
+	if len(eps) == 0 {
+		return []models.Episode{last}
+	}
+	return eps
+}
+
+func (t *Tracker) notifyEpisode(title string, tmdbID int, ep models.Episode) {
+	msg := title + notify.EpisodeLabel(ep.SeasonNumber, ep.EpisodeNumber)
+	if ep.Name != "" {
+		msg += fmt.Sprintf(" — %s", ep.Name)
+	}
+	t.notifier.Notify(notify.Event{
+		Type:    notify.NewEpisode,
+		Title:   "New episode",
+		Message: msg,
+		Data:    map[string]any{"tmdb_id": tmdbID, "title": title, "episode": ep},
+	})
+}
@@ -0,0 +1,227 @@
+// Package ffmpeg detects the FFmpeg and FFprobe binaries and what they were
+// built with, so features needing them are turned off up front instead of
+// failing mid-stream.
+package ffmpeg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// Feature is something the server does with FFmpeg or FFprobe.
+type Feature string
+
+const (
+	// Transcode remuxes to fragmented MP4 or HLS with AAC audio.
+	Transcode Feature = "transcode"
+	// VideoTranscode re-encodes video to H.264 for players that can't decode
+	// the source codec, with libx264 or a hardware encoder (see HWEncoder).
+	VideoTranscode Feature = "video_transcode"
+	// BurnSubtitles renders a subtitle onto the picture (re-encoding to H.264).
+	BurnSubtitles Feature = "burn_subtitles"
+	// Thumbnails makes the seek preview sprite sheets.
+	Thumbnails Feature = "thumbnails"
+	// SubtitleExtraction converts embedded text subtitles to WebVTT.
+	SubtitleExtraction Feature = "subtitle_extraction"
+	// SkipDetection finds intros and credits by black frames and silence.
+	SkipDetection Feature = "skip_detection"
+	// Probe reads durations, tracks and chapters, and Matroska keyframes for
+	// seeking, with FFprobe.
+	Probe Feature = "probe"
+	// ToneMap converts HDR video to SDR when transcoding, with zscale or
+	// the hardware encoder's filter (see Encoder).
+	ToneMap Feature = "tone_map"
+)
+
+// requirement is what a feature needs besides the ffmpeg binary.
+type requirement struct {
+	encoders []string
+	filters  []string
+	ffprobe  bool // FFprobe instead of FFmpeg
+}
+
+var requirements = map[Feature]requirement{
+	Transcode:          {encoders: []string{"aac"}},
+	VideoTranscode:     {encoders: []string{"libx264", "aac"}},
+	BurnSubtitles:      {encoders: []string{"libx264", "aac"}, filters: []string{"subtitles"}},
+	Thumbnails:         {encoders: []string{"mjpeg"}, filters: []string{"fps", "scale", "pad", "tile"}},
+	SubtitleExtraction: {encoders: []string{"webvtt"}},
+	SkipDetection:      {filters: []string{"scale", "blackdetect", "silencedetect"}},
+	ToneMap:            {filters: []string{"zscale", "tonemap"}},
+	Probe:              {ffprobe: true},
+}
+
+const detectTimeout = 10 * time.Second
+
+// Capabilities returns what the installed FFmpeg supports, detecting it on
+// first use. Call it at startup to log the result early.
+var Capabilities = sync.OnceValue(Detect)
+
+// Supports reports whether f can be used.
+func Supports(f Feature) bool {
+	return Capabilities().Features[string(f)]
+}
+
+// Reason explains why f can't be used, or returns "" if it can.
+func Reason(f Feature) string {
+	return Capabilities().Missing[string(f)]
+}
+
+// Detect runs the ffmpeg and ffprobe binaries on the PATH to list their
+// versions, encoders, filters and hardware acceleration methods.
+func Detect() *models.MediaCapabilities {
+	ctx, cancel := context.WithTimeout(context.Background(), detectTimeout)
+	defer cancel()
+
+	caps := &models.MediaCapabilities{
+		FFmpeg:   tool(ctx, "ffmpeg"),
+		FFprobe:  tool(ctx, "ffprobe"),
+		Encoders: []string{},
+		Decoders: []string{},
+		HWAccels: []string{},
+		Features: make(map[string]bool),
+		Missing:  make(map[string]string),
+	}
+	var filters []string
+	if caps.FFmpeg.Available {
+		if out, err := run(ctx, caps.FFmpeg.Path, "-encoders"); err == nil {
+			caps.Encoders = parseList(out, codecName)
+		}
+		if out, err := run(ctx, caps.FFmpeg.Path, "-decoders"); err == nil {
+			caps.Decoders = parseList(out, codecName)
+		}
+		if out, err := run(ctx, caps.FFmpeg.Path, "-filters"); err == nil {
+			filters = parseList(out, filterName)
+		}
+		if out, err := run(ctx, caps.FFmpeg.Path, "-hwaccels"); err == nil {
+			caps.HWAccels = parseHWAccels(out)
+		}
+		caps.HWEncoder = detectHWEncoder(ctx, caps.FFmpeg.Path, caps.Encoders)
+	}
+
+	for f, req := range requirements {
+		var missing []string
+		switch {
+		case req.ffprobe && !caps.FFprobe.Available:
+			missing = append(missing, "ffprobe")
+		case !req.ffprobe && !caps.FFmpeg.Available:
+			missing = append(missing, "ffmpeg")
+		default:
+			for _, e := range req.encoders {
+				if !slices.Contains(caps.Encoders, e) {
+					missing = append(missing, e+" encoder")
+				}
+			}
+			for _, name := range req.filters {
+				if !slices.Contains(filters, name) {
+					missing = append(missing, name+" filter")
+				}
+			}
+		}
+		caps.Features[string(f)] = len(missing) == 0
+		if len(missing) > 0 {
+			caps.Missing[string(f)] = "missing " + strings.Join(missing, ", ")
+		}
+	}
+	// A hardware encoder transcodes video without libx264, and may
+	// tone-map without zscale.
+	if caps.HWEncoder != "" && caps.Features[string(Transcode)] {
+		caps.Features[string(VideoTranscode)] = true
+		delete(caps.Missing, string(VideoTranscode))
+	}
+	if enc := hwEncoder(caps.HWEncoder); enc != nil && enc.toneMapNeeds != "" && slices.Contains(filters, enc.toneMapNeeds) {
+		caps.HWToneMap = true
+		caps.Features[string(ToneMap)] = true
+		delete(caps.Missing, string(ToneMap))
+	}
+	return caps
+}
+
+// tool finds name on the PATH and reads its version.
+func tool(ctx context.Context, name string) models.ToolInfo {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return models.ToolInfo{}
+	}
+	info := models.ToolInfo{Path: path}
+	out, err := run(ctx, path, "-version")
+	if err != nil {
+		return info
+	}
+	info.Available = true
+	// "ffmpeg version 6.1.1 Copyright (c) 2000-2023 the FFmpeg developers"
+	if fields := strings.Fields(firstLine(out)); len(fields) >= 3 && fields[1] == "version" {
+		info.Version = fields[2]
+	}
+	return info
+}
+
+func run(ctx context.Context, path string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, path, append([]string{"-hide_banner"}, args...)...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", path, strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// parseList returns the names name extracts from the lines of a -encoders
+// or -filters listing, skipping its legend.
+func parseList(out string, name func(line string) string) []string {
+	names := []string{}
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		if n := name(sc.Text()); n != "" {
+			names = append(names, n)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+var codecFlags = regexp.MustCompile(`^[VAS][.A-Z]{5}$`)
+
+// codecName parses " V....D libx264   libx264 H.264 / AVC ...". Legend
+// lines look like " V..... = Video".
+func codecName(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !codecFlags.MatchString(fields[0]) || fields[1] == "=" {
+		return ""
+	}
+	return fields[1]
+}
+
+// filterName parses " TSC blackdetect  V->V  Detect video intervals ...".
+func filterName(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.Contains(fields[2], "->") {
+		return ""
+	}
+	return fields[1]
+}
+
+// parseHWAccels parses the list after "Hardware acceleration methods:".
+func parseHWAccels(out string) []string {
+	_, list, ok := strings.Cut(out, "methods:")
+	if !ok {
+		return []string{}
+	}
+	accels := strings.Fields(list)
+	if accels == nil {
+		accels = []string{}
+	}
+	return accels
+}
@@ -0,0 +1,109 @@
+package ffmpeg
+
+import (
+	"context"
+	"os/exec"
+	"slices"
+)
+
+// Encoder is an H.264 hardware encoder and how FFmpeg feeds it.
+type Encoder struct {
+	Name string
+	// Filter is appended to the video filters, e.g. to upload frames to
+	// the GPU; "" if none is needed.
+	Filter string
+	// Args are the options the encoder needs besides -c:v.
+	Args []string
+	// ToneMap replaces Filter to also tone-map HDR to SDR on the GPU; only
+	// used if FFmpeg has the toneMapNeeds filter (see HWToneMap).
+	ToneMap      string
+	toneMapNeeds string
+}
+
+// hwEncoders are the H.264 hardware encoders tried, in order of preference.
+var hwEncoders = []Encoder{
+	{Name: "h264_nvenc", Args: []string{"-preset", "p4", "-pix_fmt", "yuv420p"}},
+	{Name: "h264_qsv", Args: []string{"-preset", "veryfast", "-pix_fmt", "nv12"}},
+	{Name: "h264_videotoolbox", Args: []string{"-pix_fmt", "yuv420p"}},
+	{
+		Name:         "h264_vaapi",
+		Filter:       "format=nv12,hwupload",
+		Args:         []string{"-vaapi_device", "/dev/dri/renderD128"},
+		ToneMap:      "format=p010,hwupload,tonemap_vaapi=format=nv12:t=bt709:m=bt709:p=bt709",
+		toneMapNeeds: "tonemap_vaapi",
+	},
+}
+
+// HWEncoder returns the hardware encoder found at startup, or nil if there
+// is none and video is encoded by libx264.
+func HWEncoder() *Encoder {
+	return hwEncoder(Capabilities().HWEncoder)
+}
+
+// HWToneMap reports whether the hardware encoder's ToneMap filter can be
+// used.
+func HWToneMap() bool {
+	return Capabilities().HWToneMap
+}
+
+func hwEncoder(name string) *Encoder {
+	for i := range hwEncoders {
+		if hwEncoders[i].Name == name {
+			return &hwEncoders[i]
+		}
+	}
+	return nil
+}
+
+// detectHWEncoder returns the first of hwEncoders that FFmpeg was built with
+// and that encodes a few test frames, since a build can include encoders for
+// hardware the machine doesn't have.
+func detectHWEncoder(ctx context.Context, path string, encoders []string) string {
+	for _, enc := range hwEncoders {
+		if !slices.Contains(encoders, enc.Name) {
+			continue
+		}
+		args := []string{"-hide_banner", "-loglevel", "error",
+			"-f", "lavfi", "-i", "color=c=black:s=256x144:d=0.2",
+		}
+		if enc.Filter != "" {
+			args = append(args, "-vf", enc.Filter)
+		}
+		args = append(args, "-c:v", enc.Name)
+		args = append(args, enc.Args...)
+		args = append(args, "-f", "null", "-")
+		if exec.CommandContext(ctx, path, args...).Run() == nil {
+			return enc.Name
+		}
+	}
+	return ""
+}
+
+// softwareDecoders are the decoders that read codecs whose native FFmpeg
+// decoder needs hardware acceleration.
+var softwareDecoders = map[string][]string{
+	"av1": {"libdav1d", "libaom-av1"},
+}
+
+// CanDecode reports whether FFmpeg can decode video in codec (FFprobe's
+// name) without hardware acceleration, e.g. to transcode it. It assumes so
+// if the decoders couldn't be listed.
+func CanDecode(codec string) bool {
+	caps := Capabilities()
+	if !caps.FFmpeg.Available {
+		return false
+	}
+	if len(caps.Decoders) == 0 {
+		return true
+	}
+	names, ok := softwareDecoders[codec]
+	if !ok {
+		names = []string{codec}
+	}
+	for _, n := range names {
+		if slices.Contains(caps.Decoders, n) {
+			return true
+		}
+	}
+	return false
+}
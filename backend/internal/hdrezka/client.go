@@ -1,47 +1,46 @@
 package hdrezka
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/httpclient"
 	"github.com/streambox/backend/internal/models"
 )
 
-// Client scrapes HDRezka for popular content.
+// Client scrapes HDRezka for popular content, search results and streams.
 type Client struct {
 	mirrors    []string
-	httpClient *http.Client
-	cache      []models.PopularItem
+	httpClient *httpclient.Client
+	cache      []models.HDRezkaItem
 	cacheTime  time.Time
 	mu         sync.RWMutex
 }
 
 const cacheDuration = 1 * time.Hour
 
-func NewClient(mirrors ...string) *Client {
+func NewClient(opts httpclient.Options, mirrors ...string) *Client {
 	if len(mirrors) == 0 {
 		mirrors = []string{"https://hdrezka.ag", "https://rezka.ag"}
 	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 15 * time.Second
+	}
+	opts.InsecureSkipVerify = true
 	return &Client{
-		mirrors: mirrors,
-		httpClient: &http.Client{
-			Timeout: 15 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
-		},
+		mirrors:    mirrors,
+		httpClient: httpclient.New(opts),
 	}
 }
 
 // GetPopular returns the popular items from the HDRezka homepage.
 // Results are cached for 1 hour.
-func (c *Client) GetPopular() ([]models.PopularItem, error) {
+func (c *Client) GetPopular(ctx context.Context) ([]models.HDRezkaItem, error) {
 	c.mu.RLock()
 	if len(c.cache) > 0 && time.Since(c.cacheTime) < cacheDuration {
 		items := c.cache
@@ -50,11 +49,11 @@ func (c *Client) GetPopular() ([]models.PopularItem, error) {
 	}
 	c.mu.RUnlock()
 
-	var items []models.PopularItem
+	var items []models.HDRezkaItem
 	var lastErr error
 
 	for _, mirror := range c.mirrors {
-		items, lastErr = c.scrapePopular(mirror)
+		items, lastErr = c.scrapePopular(ctx, mirror)
 		if lastErr == nil && len(items) > 0 {
 			c.mu.Lock()
 			c.cache = items
@@ -64,18 +63,21 @@ func (c *Client) GetPopular() ([]models.PopularItem, error) {
 			log.Info().Int("count", len(items)).Str("mirror", mirror).Msg("hdrezka popular loaded")
 			return items, nil
 		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		log.Warn().Err(lastErr).Str("mirror", mirror).Msg("hdrezka mirror failed")
 	}
 
 	return nil, fmt.Errorf("all hdrezka mirrors failed: %w", lastErr)
 }
 
-func (c *Client) scrapePopular(baseURL string) ([]models.PopularItem, error) {
-	req, err := http.NewRequest("GET", baseURL+"/", nil)
+func (c *Client) scrapePopular(ctx context.Context, baseURL string) ([]models.HDRezkaItem, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/", nil)
 	if err != nil {
 		return nil, fmt.Errorf("build request: %w", err)
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("User-Agent", httpclient.BrowserUserAgent)
 	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9")
 
 	resp, err := c.httpClient.Do(req)
@@ -93,40 +95,7 @@ func (c *Client) scrapePopular(baseURL string) ([]models.PopularItem, error) {
 		return nil, fmt.Errorf("parse html: %w", err)
 	}
 
-	var items []models.PopularItem
-
-	doc.Find("div.b-content__inline_item").Each(func(i int, s *goquery.Selection) {
-		linkEl := s.Find("div.b-content__inline_item-link a").First()
-		title := strings.TrimSpace(linkEl.Text())
-		href, _ := linkEl.Attr("href")
-
-		imgEl := s.Find("img").First()
-		poster := imgEl.AttrOr("src", "")
-
-		infoEl := s.Find("div.b-content__inline_item-link div").First()
-		info := strings.TrimSpace(infoEl.Text())
-
-		if title == "" {
-			return
-		}
-
-		// Ensure poster URL is absolute
-		if poster != "" && !strings.HasPrefix(poster, "http") {
-			poster = baseURL + poster
-		}
-		// Ensure link is absolute
-		if href != "" && !strings.HasPrefix(href, "http") {
-			href = baseURL + href
-		}
-
-		items = append(items, models.PopularItem{
-			Title:  title,
-			Poster: poster,
-			Info:   info,
-			URL:    href,
-		})
-	})
-
+	items := parseItems(doc, baseURL)
 	if len(items) == 0 {
 		return nil, fmt.Errorf("no items found on page")
 	}
@@ -0,0 +1,130 @@
+package hdrezka
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/streambox/backend/internal/models"
+)
+
+// HDRezka content categories, from the card's "cat" class.
+const (
+	TypeFilm    = "films"
+	TypeSeries  = "series"
+	TypeCartoon = "cartoons"
+	TypeAnime   = "animation"
+)
+
+var yearRe = regexp.MustCompile(`\b(19|20)\d{2}\b`)
+
+// parseItems extracts the title cards of a listing or search page.
+func parseItems(doc *goquery.Document, baseURL string) []models.HDRezkaItem {
+	var items []models.HDRezkaItem
+	doc.Find("div.b-content__inline_item").Each(func(i int, s *goquery.Selection) {
+		linkEl := s.Find("div.b-content__inline_item-link a").First()
+		title := strings.TrimSpace(linkEl.Text())
+		if title == "" {
+			return
+		}
+		href, _ := linkEl.Attr("href")
+		poster := s.Find("img").First().AttrOr("src", "")
+		info := strings.TrimSpace(s.Find("div.b-content__inline_item-link div").First().Text())
+
+		// Ensure poster and link URLs are absolute
+		if poster != "" && !strings.HasPrefix(poster, "http") {
+			poster = baseURL + poster
+		}
+		if href != "" && !strings.HasPrefix(href, "http") {
+			href = baseURL + href
+		}
+
+		item := models.HDRezkaItem{
+			PopularItem: models.PopularItem{Title: title, Poster: poster, Info: info, URL: href},
+		}
+		for _, class := range strings.Fields(s.Find("span.cat").First().AttrOr("class", "")) {
+			switch class {
+			case TypeFilm, TypeSeries, TypeCartoon, TypeAnime:
+				item.Type = class
+			}
+		}
+		if y := yearRe.FindString(info); y != "" {
+			item.Year, _ = strconv.Atoi(y)
+		}
+		items = append(items, item)
+	})
+	return items
+}
+
+// Search runs a site search and returns the matching titles, trying each
+// mirror in turn.
+func (c *Client) Search(ctx context.Context, query string) ([]models.HDRezkaItem, error) {
+	var lastErr error
+	for _, mirror := range c.mirrors {
+		items, err := c.searchOnMirror(ctx, mirror, query)
+		if err == nil {
+			return items, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("hdrezka search: %w", lastErr)
+}
+
+func (c *Client) searchOnMirror(ctx context.Context, baseURL, query string) ([]models.HDRezkaItem, error) {
+	q := url.Values{"do": {"search"}, "subaction": {"search"}, "q": {query}}
+	body, err := c.fetch(ctx, baseURL+"/search/?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parse search page: %w", err)
+	}
+	return parseItems(doc, baseURL), nil
+}
+
+// Details scrapes a title page for its original title, year and category.
+func (c *Client) Details(ctx context.Context, pageURL string) (*models.HDRezkaDetails, error) {
+	body, err := c.fetch(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parse title page: %w", err)
+	}
+
+	details := &models.HDRezkaDetails{
+		URL:           pageURL,
+		Title:         strings.TrimSpace(doc.Find("div.b-post__title h1").First().Text()),
+		OriginalTitle: strings.TrimSpace(doc.Find("div.b-post__origtitle").First().Text()),
+		Type:          typeFromURL(pageURL),
+	}
+	if details.Title == "" {
+		return nil, fmt.Errorf("no title found on %s", pageURL)
+	}
+	// The release date row links to the year's listing, e.g. /year/2010/.
+	if y := yearRe.FindString(doc.Find(`table.b-post__info a[href*="/year/"]`).First().AttrOr("href", "")); y != "" {
+		details.Year, _ = strconv.Atoi(y)
+	}
+	return details, nil
+}
+
+// typeFromURL returns the category of a title page from its path, e.g.
+// https://hdrezka.ag/films/fiction/123-nachalo-2010.html.
+func typeFromURL(pageURL string) string {
+	for _, t := range []string{TypeFilm, TypeSeries, TypeCartoon, TypeAnime} {
+		if strings.Contains(pageURL, "/"+t+"/") {
+			return t
+		}
+	}
+	return ""
+}
@@ -0,0 +1,240 @@
+package hdrezka
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+)
+
+// cdnMovieRe captures the player config object passed to initCDNMoviesEvents.
+var cdnMovieRe = regexp.MustCompile(`initCDNMoviesEvents\(\s*\d+\s*,\s*\d+\s*,[^{]*(\{.*?\})\s*\);`)
+
+// cdnSeriesRe captures the title and translator IDs passed to
+// initCDNSeriesEvents; episodes are then requested from the CDN endpoint.
+var cdnSeriesRe = regexp.MustCompile(`initCDNSeriesEvents\(\s*(\d+)\s*,\s*(\d+)\s*,`)
+
+// streamQualityRe splits a decoded streams string into "[quality]urls" parts.
+var streamQualityRe = regexp.MustCompile(`\[([^\]]+)\]([^\[]+)`)
+
+// trashCodes are the base64-encoded junk fragments HDRezka splices into the
+// streams string to obfuscate it.
+var trashCodes = buildTrashCodes()
+
+func buildTrashCodes() []string {
+	symbols := []string{"@", "#", "!", "^", "$"}
+	var codes []string
+	var gen func(prefix string, depth int)
+	gen = func(prefix string, depth int) {
+		if depth == 0 {
+			codes = append(codes, base64.StdEncoding.EncodeToString([]byte(prefix)))
+			return
+		}
+		for _, s := range symbols {
+			gen(prefix+s, depth-1)
+		}
+	}
+	gen("", 2)
+	gen("", 3)
+	return codes
+}
+
+func (c *Client) Name() string { return "hdrezka" }
+
+// Resolve searches HDRezka for the title and returns a direct MP4 link in the
+// best available quality. Series need req.Season and req.Episode.
+func (c *Client) Resolve(ctx context.Context, req models.SourceRequest) (*models.DirectStream, error) {
+	return c.resolve(ctx, req, "", false)
+}
+
+// ResolveHLS is like Resolve but returns the HLS playlist of the best
+// quality. If pageURL is set, that title page is used instead of a search.
+func (c *Client) ResolveHLS(ctx context.Context, req models.SourceRequest, pageURL string) (*models.DirectStream, error) {
+	return c.resolve(ctx, req, pageURL, true)
+}
+
+func (c *Client) resolve(ctx context.Context, req models.SourceRequest, pageURL string, hls bool) (*models.DirectStream, error) {
+	var lastErr error
+	for _, mirror := range c.mirrors {
+		stream, err := c.resolveOnMirror(ctx, mirror, req, pageURL, hls)
+		if err == nil {
+			return stream, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("hdrezka: %w", lastErr)
+}
+
+func (c *Client) resolveOnMirror(ctx context.Context, baseURL string, req models.SourceRequest, pageURL string, hls bool) (*models.DirectStream, error) {
+	if pageURL == "" {
+		var err error
+		if pageURL, err = c.searchTitle(ctx, baseURL, req.Title, req.Year); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := c.fetch(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var streams string
+	if m := cdnMovieRe.FindSubmatch(body); m != nil {
+		var player struct {
+			Streams string `json:"streams"`
+		}
+		if err := json.Unmarshal(m[1], &player); err != nil {
+			return nil, fmt.Errorf("parse player config: %w", err)
+		}
+		streams = player.Streams
+	} else if m := cdnSeriesRe.FindSubmatch(body); m != nil {
+		if req.Season <= 0 || req.Episode <= 0 {
+			return nil, fmt.Errorf("%s is a series; season and episode are required", pageURL)
+		}
+		if streams, err = c.episodeStreams(ctx, baseURL, string(m[1]), string(m[2]), req.Season, req.Episode); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("no player on %s", pageURL)
+	}
+
+	quality, streamURL, err := pickStream(decodeStreams(streams), hls)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &models.DirectStream{
+		URL:         streamURL,
+		ContentType: "video/mp4",
+		Quality:     quality,
+	}
+	if hls {
+		ds.ContentType = "application/vnd.apple.mpegurl"
+		ds.HLS = true
+	}
+	return ds, nil
+}
+
+// episodeStreams requests the encoded streams of one episode from the CDN
+// endpoint the series player uses.
+func (c *Client) episodeStreams(ctx context.Context, baseURL, id, translatorID string, season, episode int) (string, error) {
+	form := url.Values{
+		"id":            {id},
+		"translator_id": {translatorID},
+		"season":        {strconv.Itoa(season)},
+		"episode":       {strconv.Itoa(episode)},
+		"action":        {"get_stream"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/ajax/get_cdn_series/", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", httpclient.BrowserUserAgent)
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch episode: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		URL     string `json:"url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode episode response: %w", err)
+	}
+	if !out.Success || out.URL == "" {
+		return "", fmt.Errorf("S%02dE%02d unavailable: %s", season, episode, out.Message)
+	}
+	return out.URL, nil
+}
+
+// searchTitle runs a site search and returns the URL of the first result
+// whose title matches (and whose info line contains the year, if given).
+func (c *Client) searchTitle(ctx context.Context, baseURL, title string, year int) (string, error) {
+	items, err := c.searchOnMirror(ctx, baseURL, title)
+	if err != nil {
+		return "", err
+	}
+
+	titleLower := strings.ToLower(title)
+	for _, item := range items {
+		if !strings.Contains(strings.ToLower(item.Title), titleLower) {
+			continue
+		}
+		if year > 0 && !strings.Contains(item.Info, strconv.Itoa(year)) {
+			continue
+		}
+		if item.URL != "" {
+			return item.URL, nil
+		}
+	}
+	return "", fmt.Errorf("%q not found", title)
+}
+
+func (c *Client) fetch(ctx context.Context, pageURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("User-Agent", httpclient.BrowserUserAgent)
+	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// decodeStreams strips the obfuscation from a player "streams" value. The
+// result looks like "[720p]https://a.mp4:hls:manifest.m3u8 or https://a.mp4,[1080p]...".
+func decodeStreams(encoded string) string {
+	if !strings.HasPrefix(encoded, "#h") {
+		return encoded
+	}
+	s := strings.ReplaceAll(strings.TrimPrefix(encoded, "#h"), "//_//", "")
+	for _, code := range trashCodes {
+		s = strings.ReplaceAll(s, code, "")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(s + strings.Repeat("=", (4-len(s)%4)%4))
+	if err != nil {
+		return ""
+	}
+	return string(decoded)
+}
+
+// pickStream returns the highest quality entry's plain MP4 URL, or its HLS
+// playlist if hls is set. Qualities are listed lowest first.
+func pickStream(streams string, hls bool) (string, string, error) {
+	parts := streamQualityRe.FindAllStringSubmatch(streams, -1)
+	for i := len(parts) - 1; i >= 0; i-- {
+		quality := parts[i][1]
+		for _, u := range strings.Split(strings.TrimSuffix(strings.TrimSpace(parts[i][2]), ","), " or ") {
+			u = strings.TrimSpace(u)
+			isHLS := strings.Contains(u, ":hls:") || strings.HasSuffix(u, ".m3u8")
+			if strings.HasPrefix(u, "http") && isHLS == hls {
+				return quality, u, nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("no playable stream found")
+}
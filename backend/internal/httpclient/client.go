@@ -0,0 +1,277 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+// DefaultUserAgent is sent with every request that doesn't set its own User-Agent.
+const DefaultUserAgent = "StreamBox/1.0"
+
+// BrowserUserAgent is used by scrapers for sites that reject non-browser clients.
+const BrowserUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// ErrCircuitOpen is returned when a host has failed too often and is cooling down.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Options configures a Client. Zero values fall back to sensible defaults.
+type Options struct {
+	Timeout            time.Duration
+	MaxRetries         int
+	RetryBackoff       time.Duration
+	BreakerThreshold   int
+	BreakerCooldown    time.Duration
+	ProxyURL           string
+	UserAgent          string
+	InsecureSkipVerify bool
+	Jar                http.CookieJar
+	// HostRateLimit caps requests (including retries) per second to each
+	// host, in bursts of up to HostBurst; 0 is unlimited.
+	HostRateLimit float64
+	HostBurst     int
+}
+
+// Client is an http.Client wrapper with retries, exponential backoff,
+// per-host circuit breakers and optional per-host rate limits. It is safe
+// for concurrent use.
+type Client struct {
+	http     *http.Client
+	opts     Options
+	breakers map[string]*breaker
+	limiters map[string]*rate.Limiter
+	mu       sync.Mutex
+}
+
+// breaker tracks consecutive failures for a single host.
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// New creates a Client from the given options.
+func New(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 15 * time.Second
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 500 * time.Millisecond
+	}
+	if opts.BreakerThreshold <= 0 {
+		opts.BreakerThreshold = 5
+	}
+	if opts.BreakerCooldown <= 0 {
+		opts.BreakerCooldown = 30 * time.Second
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent
+	}
+	if opts.HostBurst <= 0 {
+		opts.HostBurst = 1
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.ProxyURL != "" {
+		proxyURL, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			log.Warn().Err(err).Str("proxy", opts.ProxyURL).Msg("invalid proxy url, ignoring")
+		} else {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	if opts.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &Client{
+		http: &http.Client{
+			Timeout:   opts.Timeout,
+			Transport: transport,
+			Jar:       opts.Jar,
+		},
+		opts:     opts,
+		breakers: make(map[string]*breaker),
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// Jar returns the cookie jar the client was created with (may be nil).
+func (c *Client) Jar() http.CookieJar {
+	return c.http.Jar
+}
+
+// Get issues a GET to the specified URL.
+func (c *Client) Get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// PostForm issues a POST with the given form values as the request body.
+func (c *Client) PostForm(ctx context.Context, rawURL string, data url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.Do(req)
+}
+
+// Do sends the request, retrying transient failures (network errors, 429
+// and 5xx responses) with exponential backoff. Requests with a body are only
+// retried when the body can be replayed via GetBody.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if err := c.allow(host); err != nil {
+		return nil, fmt.Errorf("%s: %w", host, err)
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, fmt.Errorf("rewind request body: %w", bodyErr)
+			}
+			req.Body = body
+		}
+
+		if err := c.wait(req.Context(), host); err != nil {
+			return nil, err
+		}
+		resp, err = c.http.Do(req)
+		if !isRetryable(resp, err) {
+			c.record(req.Context(), host, err == nil && resp.StatusCode < 500)
+			return resp, err
+		}
+
+		if attempt >= c.opts.MaxRetries || !replayable || req.Context().Err() != nil {
+			break
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		wait := c.backoff(attempt)
+		log.Debug().
+			Str("host", host).
+			Int("attempt", attempt+1).
+			Dur("wait", wait).
+			Msg("retrying http request")
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	c.record(req.Context(), host, false)
+	return resp, err
+}
+
+// backoff returns the delay before the given retry attempt, with jitter.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.opts.RetryBackoff << attempt
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// wait blocks until the host's rate limit allows a request.
+func (c *Client) wait(ctx context.Context, host string) error {
+	if c.opts.HostRateLimit <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	l := c.limiters[host]
+	if l == nil {
+		l = rate.NewLimiter(rate.Limit(c.opts.HostRateLimit), c.opts.HostBurst)
+		c.limiters[host] = l
+	}
+	c.mu.Unlock()
+	return l.Wait(ctx)
+}
+
+// allow reports whether requests to host are currently permitted.
+func (c *Client) allow(host string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.breakers[host]
+	if b == nil || b.openUntil.IsZero() {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) {
+		return ErrCircuitOpen
+	}
+	// Cooldown elapsed — let a trial request through (half-open).
+	b.openUntil = time.Time{}
+	return nil
+}
+
+// record updates the breaker for host after a request completes. Requests
+// the caller cancelled or timed out say nothing about the host, so they
+// are not counted.
+func (c *Client) record(ctx context.Context, host string, success bool) {
+	if ctx.Err() != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.breakers[host]
+	if b == nil {
+		b = &breaker{}
+		c.breakers[host] = b
+	}
+
+	if success {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+
+	b.failures++
+	if b.failures >= c.opts.BreakerThreshold {
+		b.openUntil = time.Now().Add(c.opts.BreakerCooldown)
+		log.Warn().
+			Str("host", host).
+			Int("failures", b.failures).
+			Dur("cooldown", c.opts.BreakerCooldown).
+			Msg("circuit breaker opened")
+	}
+}
+
+// isRetryable reports whether a request outcome is worth retrying.
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
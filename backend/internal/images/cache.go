@@ -0,0 +1,190 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streambox/backend/internal/httpclient"
+)
+
+const tmdbImageBaseURL = "https://image.tmdb.org/t/p"
+
+// Sizes are the TMDB image size variants that may be requested.
+var Sizes = map[string]bool{
+	"w45": true, "w92": true, "w154": true, "w185": true, "w300": true, "w342": true,
+	"w500": true, "w780": true, "w1280": true, "h632": true, "original": true,
+}
+
+// touchInterval is how stale an image's modification time, which records
+// when it was last used, may get before a request refreshes it.
+const touchInterval = time.Hour
+
+// fileRe matches TMDB image file names (the part after the size). SVGs
+// (network and company logos) are served sandboxed; see api.getImage.
+var fileRe = regexp.MustCompile(`^[A-Za-z0-9_-]+\.(jpg|jpeg|png|webp|svg)$`)
+
+// ErrInvalidPath is returned for unknown sizes or malformed file names.
+var ErrInvalidPath = errors.New("invalid image path")
+
+// Cache proxies image.tmdb.org assets and keeps them on disk, so repeat loads
+// don't hit the CDN and clients that can't reach it still get posters.
+type Cache struct {
+	dir     string
+	http    *httpclient.Client
+	baseURL string
+
+	maxBytes int64 // 0 for no limit (see SetMaxBytes)
+	mu       sync.Mutex
+	total    int64 // bytes on disk, guarded by mu
+}
+
+// NewCache creates an image cache stored under dir.
+func NewCache(dir string, opts httpclient.Options) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create image cache dir: %w", err)
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 20 * time.Second
+	}
+	return &Cache{
+		dir:     dir,
+		http:    httpclient.New(opts),
+		baseURL: tmdbImageBaseURL,
+	}, nil
+}
+
+// Get returns the local path of an image, downloading it on first request.
+func (c *Cache) Get(ctx context.Context, size, file string) (string, error) {
+	if !Sizes[size] || !fileRe.MatchString(file) {
+		return "", ErrInvalidPath
+	}
+
+	path := filepath.Join(c.dir, size, file)
+	if info, err := os.Stat(path); err == nil {
+		if now := time.Now(); now.Sub(info.ModTime()) > touchInterval {
+			os.Chtimes(path, now, now)
+		}
+		return path, nil
+	}
+
+	n, err := c.download(ctx, size, file, path)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.total += n
+	c.trim()
+	c.mu.Unlock()
+	return path, nil
+}
+
+// SetMaxBytes caps the cache's size on disk: once its images together
+// exceed maxBytes, the least recently used are deleted (0 for no limit).
+// Must be called before serving.
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	c.total = 0
+	for _, f := range c.files() {
+		c.total += f.size
+	}
+	c.trim()
+}
+
+// cachedFile is an image on disk; see files.
+type cachedFile struct {
+	path string
+	size int64
+	used time.Time // modification time, refreshed on use
+}
+
+// files lists the cached images, skipping downloads in progress.
+func (c *Cache) files() []cachedFile {
+	var files []cachedFile
+	filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files = append(files, cachedFile{path, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+	return files
+}
+
+// trim deletes the least recently used images until the rest take up at
+// most 90% of maxBytes, so it doesn't run again for every download. Must be
+// called with mu held.
+func (c *Cache) trim() {
+	if c.maxBytes <= 0 || c.total <= c.maxBytes {
+		return
+	}
+	files := c.files()
+	slices.SortFunc(files, func(a, b cachedFile) int { return a.used.Compare(b.used) })
+	c.total = 0
+	for _, f := range files {
+		c.total += f.size
+	}
+	for _, f := range files {
+		if c.total <= c.maxBytes/10*9 {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			c.total -= f.size
+		}
+	}
+}
+
+// download fetches an image into a temp file and renames it into place, so
+// concurrent requests never see a partial file. It returns the image's size.
+func (c *Cache) download(ctx context.Context, size, file, path string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/%s/%s", c.baseURL, size, file), nil)
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("tmdb image returned status %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, fmt.Errorf("create size dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), file+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, resp.Body)
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("write image: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("write image: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("store image: %w", err)
+	}
+	return n, nil
+}
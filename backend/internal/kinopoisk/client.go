@@ -0,0 +1,118 @@
+package kinopoisk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+)
+
+const defaultBaseURL = "https://kinopoiskapiunofficial.tech"
+
+// cacheTTL is how long lookups (including misses) are kept. The API's free
+// tier allows only a few hundred requests a day.
+const cacheTTL = 24 * time.Hour
+
+// Client looks up Kinopoisk ratings and localized titles through the
+// Kinopoisk unofficial API.
+type Client struct {
+	apiKey  string
+	http    *httpclient.Client
+	baseURL string
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry // by IMDb ID
+}
+
+type cacheEntry struct {
+	info    *models.KinopoiskInfo // nil if the title isn't on Kinopoisk
+	expires time.Time
+}
+
+// NewClient creates a Kinopoisk client authenticated with the given API key.
+func NewClient(apiKey string, opts httpclient.Options) *Client {
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &Client{
+		apiKey:  apiKey,
+		http:    httpclient.New(opts),
+		baseURL: defaultBaseURL,
+		cache:   make(map[string]cacheEntry),
+	}
+}
+
+type filmsResponse struct {
+	Items []struct {
+		KinopoiskID     int     `json:"kinopoiskId"`
+		IMDbID          string  `json:"imdbId"`
+		NameRu          string  `json:"nameRu"`
+		NameEn          string  `json:"nameEn"`
+		NameOriginal    string  `json:"nameOriginal"`
+		RatingKinopoisk float64 `json:"ratingKinopoisk"`
+		RatingIMDb      float64 `json:"ratingImdb"`
+	} `json:"items"`
+}
+
+// Lookup returns the Kinopoisk entry for an IMDb ID, or nil if Kinopoisk
+// doesn't list the title.
+func (c *Client) Lookup(ctx context.Context, imdbID string) (*models.KinopoiskInfo, error) {
+	c.mu.Lock()
+	if e, ok := c.cache[imdbID]; ok && time.Now().Before(e.expires) {
+		c.mu.Unlock()
+		return e.info, nil
+	}
+	c.mu.Unlock()
+
+	params := url.Values{}
+	params.Set("imdbId", imdbID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v2.2/films?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("X-API-KEY", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kinopoisk lookup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kinopoisk api returned status %d", resp.StatusCode)
+	}
+
+	var films filmsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&films); err != nil {
+		return nil, fmt.Errorf("decode kinopoisk response: %w", err)
+	}
+
+	var info *models.KinopoiskInfo
+	for _, f := range films.Items {
+		if f.IMDbID != imdbID {
+			continue
+		}
+		info = &models.KinopoiskInfo{
+			ID:            f.KinopoiskID,
+			Rating:        f.RatingKinopoisk,
+			RatingIMDb:    f.RatingIMDb,
+			TitleRu:       f.NameRu,
+			TitleEn:       f.NameEn,
+			TitleOriginal: f.NameOriginal,
+			URL:           fmt.Sprintf("https://www.kinopoisk.ru/film/%d/", f.KinopoiskID),
+		}
+		break
+	}
+
+	c.mu.Lock()
+	c.cache[imdbID] = cacheEntry{info: info, expires: time.Now().Add(cacheTTL)}
+	c.mu.Unlock()
+	return info, nil
+}
@@ -0,0 +1,268 @@
+// Package metrics implements the handful of Prometheus metric types StreamBox
+// exports and renders them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// collector is a metric family that can render itself.
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	registry = append(registry, c)
+	registryMu.Unlock()
+}
+
+// Handler serves all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registryMu.Lock()
+		collectors := append([]collector(nil), registry...)
+		registryMu.Unlock()
+		for _, c := range collectors {
+			c.write(w)
+		}
+	})
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labelString renders {a="x",b="y"} (empty without labels). extra is
+// appended as a pre-rendered pair, used for histogram buckets.
+func labelString(names, values []string, extra string) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, n := range names {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		pairs = append(pairs, n+`="`+v+`"`)
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// atomicFloat is a float64 updated with compare-and-swap.
+type atomicFloat struct{ bits atomic.Uint64 }
+
+func (f *atomicFloat) Add(v float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Set(v float64) { f.bits.Store(math.Float64bits(v)) }
+
+func (f *atomicFloat) Load() float64 { return math.Float64frombits(f.bits.Load()) }
+
+// Counter is a monotonically increasing value.
+type Counter struct{ v atomicFloat }
+
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add increases the counter; negative values are ignored.
+func (c *Counter) Add(v float64) {
+	if v > 0 {
+		c.v.Add(v)
+	}
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct{ v atomicFloat }
+
+func (g *Gauge) Inc()          { g.v.Add(1) }
+func (g *Gauge) Dec()          { g.v.Add(-1) }
+func (g *Gauge) Set(v float64) { g.v.Set(v) }
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64 // per bucket, non-cumulative; last is +Inf
+	sum     atomicFloat
+}
+
+// Observe records a value.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.counts[i].Add(1)
+	h.sum.Add(v)
+}
+
+// DefBuckets suit request latencies in seconds.
+var DefBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// vec holds the children of a labelled metric family.
+type vec[T any] struct {
+	name, help, typ string
+	labels          []string
+	newChild        func() *T
+	writeChild      func(w io.Writer, name, labels string, labelNames, values []string, child *T)
+
+	mu       sync.Mutex
+	children map[string]*T
+	values   map[string][]string
+}
+
+func newVec[T any](name, help, typ string, labels []string, newChild func() *T,
+	writeChild func(io.Writer, string, string, []string, []string, *T)) *vec[T] {
+	v := &vec[T]{
+		name: name, help: help, typ: typ, labels: labels,
+		newChild: newChild, writeChild: writeChild,
+		children: make(map[string]*T),
+		values:   make(map[string][]string),
+	}
+	register(v)
+	return v
+}
+
+func (v *vec[T]) with(values ...string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\x00")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c := v.children[key]
+	if c == nil {
+		c = v.newChild()
+		v.children[key] = c
+		v.values[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+func (v *vec[T]) write(w io.Writer) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	children := make([]*T, len(keys))
+	values := make([][]string, len(keys))
+	for i, k := range keys {
+		children[i], values[i] = v.children[k], v.values[k]
+	}
+	v.mu.Unlock()
+
+	writeHeader(w, v.name, v.help, v.typ)
+	for i, c := range children {
+		v.writeChild(w, v.name, labelString(v.labels, values[i], ""), v.labels, values[i], c)
+	}
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct{ v *vec[Counter] }
+
+// NewCounterVec registers a counter family. With no label names it has a
+// single child, available as With().
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labels,
+		func() *Counter { return &Counter{} },
+		func(w io.Writer, name, labels string, _, _ []string, c *Counter) {
+			fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(c.v.Load()))
+		})}
+}
+
+// With returns the counter for the given label values.
+func (c *CounterVec) With(values ...string) *Counter { return c.v.with(values...) }
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct{ v *vec[Gauge] }
+
+// NewGaugeVec registers a gauge family.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", labels,
+		func() *Gauge { return &Gauge{} },
+		func(w io.Writer, name, labels string, _, _ []string, g *Gauge) {
+			fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(g.v.Load()))
+		})}
+}
+
+// With returns the gauge for the given label values.
+func (g *GaugeVec) With(values ...string) *Gauge { return g.v.with(values...) }
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct{ v *vec[Histogram] }
+
+// NewHistogramVec registers a histogram family with the given upper bounds
+// (sorted ascending; +Inf is implicit).
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{newVec(name, help, "histogram", labels,
+		func() *Histogram {
+			return &Histogram{buckets: buckets, counts: make([]atomic.Uint64, len(buckets)+1)}
+		},
+		func(w io.Writer, name, labels string, labelNames, values []string, h *Histogram) {
+			var cumulative uint64
+			for i := range h.counts {
+				cumulative += h.counts[i].Load()
+				le := "+Inf"
+				if i < len(h.buckets) {
+					le = formatFloat(h.buckets[i])
+				}
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, labelString(labelNames, values, `le="`+le+`"`), cumulative)
+			}
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum.Load()))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, labels, cumulative)
+		})}
+}
+
+// With returns the histogram for the given label values.
+func (h *HistogramVec) With(values ...string) *Histogram { return h.v.with(values...) }
+
+// funcMetric is an unlabelled value computed at scrape time.
+type funcMetric struct {
+	name, help, typ string
+	fn              func() float64
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	writeHeader(w, f.name, f.help, f.typ)
+	fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn on every scrape.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&funcMetric{name, help, "gauge", fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn on every
+// scrape; fn must never decrease.
+func NewCounterFunc(name, help string, fn func() float64) {
+	register(&funcMetric{name, help, "counter", fn})
+}
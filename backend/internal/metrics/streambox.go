@@ -0,0 +1,33 @@
+package metrics
+
+// StreamBox metrics updated by the packages that own the activity.
+// Gauges for live state (sessions, torrent bytes) are registered as
+// functions in main, where the owning objects are created.
+var (
+	BytesServed = NewCounterVec("streambox_bytes_served_total",
+		"Bytes of media sent to clients.", "route")
+
+	TranscodesActive = NewGaugeVec("streambox_transcodes_active",
+		"Running FFmpeg processes.", "kind")
+
+	TranscodesStarted = NewCounterVec("streambox_transcodes_started_total",
+		"FFmpeg processes started.", "kind")
+
+	ProviderSearchDuration = NewHistogramVec("streambox_provider_search_duration_seconds",
+		"Torrent provider search latency.", DefBuckets, "provider")
+
+	ProviderSearchErrors = NewCounterVec("streambox_provider_search_errors_total",
+		"Failed torrent provider searches.", "provider")
+
+	TMDBRequests = NewCounterVec("streambox_tmdb_requests_total",
+		"TMDB API requests by outcome (ok, error or the HTTP status).", "status")
+)
+
+// TrackTranscode records an FFmpeg process of the given kind (stream, hls,
+// subtitles) as started and running; call the returned func when it exits.
+func TrackTranscode(kind string) (done func()) {
+	TranscodesStarted.With(kind).Inc()
+	active := TranscodesActive.With(kind)
+	active.Inc()
+	return active.Dec
+}
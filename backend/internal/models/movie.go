@@ -1,16 +1,58 @@
 package models
 
+import "time"
+
 type Movie struct {
-	ID          int      `json:"id"`
-	Title       string   `json:"title"`
-	Overview    string   `json:"overview"`
-	PosterPath  string   `json:"poster_path"`
-	BackdropPath string  `json:"backdrop_path"`
-	ReleaseDate string   `json:"release_date"`
-	VoteAverage float64  `json:"vote_average"`
-	Runtime     int      `json:"runtime"`
-	IMDbID      string   `json:"imdb_id,omitempty"`
-	Genres      []Genre  `json:"genres,omitempty"`
+	ID           int            `json:"id"`
+	Title        string         `json:"title"`
+	Overview     string         `json:"overview"`
+	PosterPath   string         `json:"poster_path"`
+	BackdropPath string         `json:"backdrop_path"`
+	ReleaseDate  string         `json:"release_date"`
+	VoteAverage  float64        `json:"vote_average"`
+	Runtime      int            `json:"runtime"`
+	IMDbID       string         `json:"imdb_id,omitempty"`
+	Genres       []Genre        `json:"genres,omitempty"`
+	Cast         []CastMember   `json:"cast,omitempty"`
+	Director     string         `json:"director,omitempty"`
+	Trailers     []Trailer      `json:"trailers,omitempty"`
+	Kinopoisk    *KinopoiskInfo `json:"kinopoisk,omitempty"`
+	Ratings      *Ratings       `json:"ratings,omitempty"`
+}
+
+// Ratings are a title's third-party scores from OMDb. Zero means unrated.
+type Ratings struct {
+	IMDb           float64 `json:"imdb,omitempty"`
+	IMDbVotes      int     `json:"imdb_votes,omitempty"`
+	RottenTomatoes int     `json:"rotten_tomatoes,omitempty"` // Tomatometer, percent
+	Metacritic     int     `json:"metacritic,omitempty"`      // Metascore, 0-100
+}
+
+// KinopoiskInfo is a title's Kinopoisk entry: its rating and localized titles.
+type KinopoiskInfo struct {
+	ID            int     `json:"id"`
+	Rating        float64 `json:"rating,omitempty"`
+	RatingIMDb    float64 `json:"rating_imdb,omitempty"`
+	TitleRu       string  `json:"title_ru,omitempty"`
+	TitleEn       string  `json:"title_en,omitempty"`
+	TitleOriginal string  `json:"title_original,omitempty"`
+	URL           string  `json:"url"`
+}
+
+// CastMember is an actor credited on a movie or TV show.
+type CastMember struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Character   string `json:"character"`
+	ProfilePath string `json:"profile_path"`
+}
+
+// Trailer is a YouTube video for a title; Key is the YouTube video ID.
+type Trailer struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Official bool   `json:"official"`
 }
 
 type Genre struct {
@@ -37,43 +79,468 @@ type TorrentResult struct {
 	Audio     string `json:"audio"`
 	Source    string `json:"source"`
 	TopicID   string `json:"topic_id,omitempty"`
+	Group     string `json:"group,omitempty"` // release/fansub group, where known
+
+	// Release details from the topic's description, where the provider has one
+	VideoCodec  string   `json:"video_codec,omitempty"`
+	Resolution  string   `json:"resolution,omitempty"` // e.g. "1920x1080"
+	AudioTracks []string `json:"audio_tracks,omitempty"`
+	Translation string   `json:"translation,omitempty"`
+
+	Live     *SwarmStats `json:"live,omitempty"`
+	Score    float64     `json:"score"`              // ranking score, higher is better
+	Mismatch []string    `json:"mismatch,omitempty"` // why it may not be the title searched for: "year", "title", "fan_edit"
+	Pack     string      `json:"pack,omitempty"`     // TV and anime releases: "episode", "season_pack" or "complete_series"
+}
+
+// Provider search statuses.
+const (
+	ProviderOK      = "ok"
+	ProviderError   = "error"
+	ProviderTimeout = "timeout"
+	ProviderSkipped = "skipped" // circuit breaker open after repeated failures
+)
+
+// ProviderStatus reports how one provider fared in a torrent search, so
+// clients can tell partial results from a complete set.
+type ProviderStatus struct {
+	Provider   string     `json:"provider"`
+	Status     string     `json:"status"`
+	Results    int        `json:"results"`
+	DurationMs int64      `json:"duration_ms"`
+	Error      string     `json:"error,omitempty"`
+	RetryAfter *time.Time `json:"retry_after,omitempty"` // when a skipped provider is tried again
+}
+
+// SwarmStats holds live seed/peer counts gathered from trackers and the DHT,
+// as opposed to the (often stale) numbers reported by the search site.
+type SwarmStats struct {
+	Seeds             int    `json:"seeds"`
+	Leechers          int    `json:"leechers"`
+	Completed         int    `json:"completed"`
+	DHTPeers          int    `json:"dht_peers"`
+	TrackersQueried   int    `json:"trackers_queried"`
+	TrackersResponded int    `json:"trackers_responded"`
+	ScrapedAt         string `json:"scraped_at"`
 }
 
 type AudioTrack struct {
 	Index    int    `json:"index"`
 	Language string `json:"language"`
 	Title    string `json:"title"`
+	Codec    string `json:"codec,omitempty"`
+	Channels int    `json:"channels,omitempty"`
+}
+
+// SubtitleTrack is a text subtitle stream embedded in the video file. Index
+// is the subtitle-relative stream index (FFmpeg 0:s:N).
+type SubtitleTrack struct {
+	Index    int    `json:"index"`
+	Language string `json:"language"`
+	Title    string `json:"title"`
+	Codec    string `json:"codec"`
+}
+
+// Chapter is a chapter marker from the video container. Start and End are in
+// seconds.
+type Chapter struct {
+	Title string  `json:"title"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// SkipMarker is a stretch of an episode players can offer to skip. Type is
+// "intro" or "credits"; Source is "chapter" when taken from the container's
+// chapters and "detected" when found by analysing the video. Start and End
+// are in seconds.
+type SkipMarker struct {
+	Type   string  `json:"type"`
+	Start  float64 `json:"start"`
+	End    float64 `json:"end"`
+	Source string  `json:"source"`
 }
 
 type StreamSession struct {
-	ID             string       `json:"session_id"`
-	TMDbID         int          `json:"tmdb_id"`
-	Title          string       `json:"title"`
-	MagnetURI      string       `json:"magnet_uri"`
-	InfoHash       string       `json:"info_hash"`
-	FilePath       string       `json:"file_path,omitempty"`
-	FileSize       int64        `json:"file_size"`
-	ContentType    string       `json:"content_type"`
-	NeedsTranscode bool         `json:"needs_transcode"`
-	Status         string       `json:"status"`
-	Duration       float64      `json:"duration"`
-	AudioTracks    []AudioTrack `json:"audio_tracks,omitempty"`
+	ID             string          `json:"session_id"`
+	TMDbID         int             `json:"tmdb_id"`
+	Title          string          `json:"title"`
+	Season         int             `json:"season,omitempty"`
+	Episode        int             `json:"episode,omitempty"`
+	MagnetURI      string          `json:"magnet_uri"`
+	InfoHash       string          `json:"info_hash"`
+	FilePath       string          `json:"file_path,omitempty"`
+	FileIndex      int             `json:"file_index"`
+	FileSize       int64           `json:"file_size"`
+	ContentType    string          `json:"content_type"`
+	NeedsTranscode bool            `json:"needs_transcode"`
+	Status         string          `json:"status"`
+	Duration       float64         `json:"duration"`
+	AudioTracks    []AudioTrack    `json:"audio_tracks,omitempty"`
+	AudioTrack     int             `json:"audio_track"` // selected track, -1 for the default
+	SubtitleTracks []SubtitleTrack `json:"subtitle_tracks,omitempty"`
+	Chapters       []Chapter       `json:"chapters,omitempty"`
+	SkipMarkers    []SkipMarker    `json:"skip_markers,omitempty"`
+	SubtitleOffset int64           `json:"subtitle_offset_ms"` // applied to all subtitles served for the session
+	Source         string          `json:"source"`
+	SourceErrors   []string        `json:"source_errors,omitempty"`
+	LastPosition   float64         `json:"last_position,omitempty"`
+	// ResumePosition is where the profile left off watching the title.
+	// StartPosition is where transcoded streams start without ?t=, set when
+	// the session was started with resume; seconds.
+	ResumePosition float64 `json:"resume_position,omitempty"`
+	StartPosition  float64 `json:"start_position,omitempty"`
+	// PlayMethod is how the file is served (PlayDirect etc.), decided from
+	// its container and codecs and what the client reported it can play;
+	// PlayReason says why it isn't played directly.
+	PlayMethod string `json:"play_method"`
+	PlayReason string `json:"play_reason,omitempty"`
+	Container  string `json:"container,omitempty"`   // from the file extension: mp4, webm, matroska, avi...
+	VideoCodec string `json:"video_codec,omitempty"` // FFprobe codec name, once probed
+	// VideoBitDepth is bits per sample of the video (8, 10...), once probed.
+	// AudioCodec is the codec of the selected audio track; TranscodeAudio
+	// reports whether it is converted to AAC rather than copied.
+	VideoBitDepth  int    `json:"video_bit_depth,omitempty"`
+	AudioCodec     string `json:"audio_codec,omitempty"`
+	TranscodeAudio bool   `json:"transcode_audio,omitempty"`
+	// VideoHeight is the height of the video in pixels, once probed.
+	// VideoMode is the rung of the transcoding ladder the video is served
+	// with (VideoCopy etc.). HDR is the video's HDR format (HDR10 etc.),
+	// "" for SDR.
+	VideoHeight int    `json:"video_height,omitempty"`
+	VideoMode   string `json:"video_mode,omitempty"`
+	HDR         string `json:"hdr,omitempty"`
+	// TranscodeOptions are the limits set for the session; the server's
+	// defaults (TRANSCODE_* settings) apply where they're unset.
+	TranscodeOptions TranscodeOptions `json:"transcode_options"`
+}
+
+// TranscodeOptions limit a session's transcoded output. Zero leaves a limit
+// unset.
+type TranscodeOptions struct {
+	// MaxHeight is the target resolution in pixels, e.g. 720. Taller video
+	// is transcoded and scaled down to it.
+	MaxHeight int `json:"max_height,omitempty"`
+	// MaxBitrate caps transcoded video, in kb/s.
+	MaxBitrate int `json:"max_bitrate,omitempty"`
+	// AudioChannels downmixes audio with more channels, e.g. 2 for 5.1 to
+	// stereo, converting it to AAC.
+	AudioChannels int `json:"audio_channels,omitempty"`
+	// ToneMap converts HDR video to SDR, transcoding it, for displays
+	// that show HDR washed out.
+	ToneMap bool `json:"tone_map,omitempty"`
+}
+
+// HDR formats.
+const (
+	HDR10          = "hdr10"
+	HDRHLG         = "hlg"
+	HDRDolbyVision = "dolby_vision" // without an HDR10 or HLG base layer
+)
+
+// Video modes, the transcoding ladder: video the player can decode is
+// copied; otherwise it's re-encoded to H.264 by a hardware encoder if one
+// works, or else by libx264 at a resolution and bitrate capped so that it
+// keeps up with playback.
+const (
+	VideoCopy        = "copy"
+	VideoHWTranscode = "hw_transcode"
+	VideoSWTranscode = "sw_transcode"
+)
+
+// Play methods: how a session's file reaches the client.
+const (
+	PlayDirect         = "direct"          // the file as it is
+	PlayRemux          = "remux"           // video and audio copied into fragmented MP4
+	PlayAudioTranscode = "audio_transcode" // video copied, audio converted to AAC
+	PlayTranscode      = "transcode"       // video re-encoded to H.264; audio converted unless playable
+)
+
+// ClientCapabilities is what a player can play, in FFprobe's names:
+// containers mp4, webm, matroska or avi; codecs such as h264, hevc, vp9,
+// av1, aac, ac3, eac3, opus.
+type ClientCapabilities struct {
+	Containers  []string `json:"containers"`
+	VideoCodecs []string `json:"video_codecs"`
+	AudioCodecs []string `json:"audio_codecs"`
+}
+
+// Download statuses.
+const (
+	DownloadQueued      = "queued" // waiting for torrent metadata
+	DownloadDownloading = "downloading"
+	DownloadPaused      = "paused"
+	DownloadCompleted   = "completed"
+	DownloadFailed      = "failed"
+)
+
+// Download is a torrent file fetched to completion for offline playback.
+type Download struct {
+	ID              string  `json:"id"`
+	TMDbID          int     `json:"tmdb_id"`
+	Title           string  `json:"title"`
+	Season          int     `json:"season,omitempty"`
+	Episode         int     `json:"episode,omitempty"`
+	MagnetURI       string  `json:"magnet_uri"`
+	InfoHash        string  `json:"info_hash"`
+	FilePath        string  `json:"file_path,omitempty"`
+	FileIndex       int     `json:"file_index"`
+	FileSize        int64   `json:"file_size"`
+	Status          string  `json:"status"`
+	Error           string  `json:"error,omitempty"`
+	DownloadedBytes int64   `json:"downloaded_bytes"`
+	Progress        float64 `json:"progress"` // percent
+	DownloadSpeed   int64   `json:"download_speed"`
+	PeersConnected  int     `json:"peers_connected"`
+	CreatedAt       string  `json:"created_at"`
+	CompletedAt     string  `json:"completed_at,omitempty"`
+}
+
+// Settings are server settings that can be changed at runtime through
+// /api/settings. Rate limits are in KiB/s; 0 means unlimited.
+type Settings struct {
+	DownloadLimitKBps int `json:"download_limit_kbps"`
+	UploadLimitKBps   int `json:"upload_limit_kbps"`
+	// SessionLimitKBps is the default download limit of each stream session.
+	SessionLimitKBps int `json:"session_limit_kbps"`
+	// PreferredAudioLanguages are ISO 639 codes, most preferred first, after
+	// the profile's audio language: releases with them rank higher and
+	// their audio track is selected when a stream starts.
+	PreferredAudioLanguages []string `json:"preferred_audio_languages"`
 }
 
 type StreamStatus struct {
-	Status          string       `json:"status"`
-	DownloadedBytes int64        `json:"downloaded_bytes"`
-	TotalBytes      int64        `json:"total_bytes"`
-	DownloadSpeed   int64        `json:"download_speed"`
-	PeersConnected  int          `json:"peers_connected"`
-	BufferedPercent float64      `json:"buffered_percent"`
-	Duration        float64      `json:"duration"`
-	AudioTracks     []AudioTrack `json:"audio_tracks,omitempty"`
+	Status          string            `json:"status"`
+	DownloadedBytes int64             `json:"downloaded_bytes"`
+	TotalBytes      int64             `json:"total_bytes"`
+	DownloadSpeed   int64             `json:"download_speed"`
+	PeersConnected  int               `json:"peers_connected"`
+	BufferedPercent float64           `json:"buffered_percent"`
+	Duration        float64           `json:"duration"`
+	AudioTracks     []AudioTrack      `json:"audio_tracks,omitempty"`
+	SubtitleTracks  []SubtitleTrack   `json:"subtitle_tracks,omitempty"`
+	Chapters        []Chapter         `json:"chapters,omitempty"`
+	SkipMarkers     []SkipMarker      `json:"skip_markers,omitempty"`
+	PeerSources     *PeerSources      `json:"peer_sources,omitempty"`
+	Health          *ConnectionHealth `json:"connection_health,omitempty"`
+	Fallback        *FallbackOffer    `json:"fallback,omitempty"`
+	Source          string            `json:"source"`
+	RateLimitKBps   int               `json:"rate_limit_kbps,omitempty"`
+	Prefetch        *PrefetchStatus   `json:"prefetch,omitempty"`
+	// Viewers counts the distinct clients (by IP and user agent) that
+	// requested the stream in the last 30 seconds or are still reading it.
+	Viewers int `json:"viewers"`
+	// SinglePlayer is set when only one client may watch at a time.
+	SinglePlayer bool `json:"single_player,omitempty"`
+	// Encoder is the FFmpeg process transcoding the stream live, if one
+	// was started.
+	Encoder *EncoderStatus `json:"encoder,omitempty"`
+	// Remux is the MP4 remux of the file made in the background, if
+	// REMUX_CACHE is on and the file needs only remuxing.
+	Remux *RemuxStatus `json:"remux,omitempty"`
+	// Buffer describes the data downloaded ahead of where the stream is
+	// being read, for torrent sessions that have been read from.
+	Buffer *BufferStatus `json:"buffer,omitempty"`
+	// StartBuffer is set while the session is "buffering": what has to be
+	// downloaded before it's ready, and when that should be.
+	StartBuffer *StartBufferStatus `json:"start_buffer,omitempty"`
+	// Metadata is set while a session started with "async" is fetching its
+	// torrent's metadata (status "resolving") or failed to (status "failed").
+	Metadata *MetadataProgress `json:"metadata,omitempty"`
+}
+
+// Encoder states.
+const (
+	EncoderRunning = "running"
+	EncoderExited  = "exited" // finished, or the player went away
+	EncoderFailed  = "failed"
+)
+
+// EncoderStatus describes the live FFmpeg process transcoding a session
+// from a position. A session has at most one: a newer request, e.g. a seek,
+// supersedes it and kills the process.
+type EncoderStatus struct {
+	State      string    `json:"state"`
+	Seek       float64   `json:"seek"`            // where it started, seconds
+	Position   float64   `json:"position"`        // output reached, seconds
+	Speed      float64   `json:"speed,omitempty"` // encoding speed relative to playback
+	StartedAt  time.Time `json:"started_at"`
+	Superseded int       `json:"superseded"` // earlier processes killed for a newer one
+	Error      string    `json:"error,omitempty"`
+}
+
+// Remux states.
+const (
+	RemuxRunning = "running" // waiting for pieces or remuxing them
+	RemuxReady   = "ready"   // served directly instead of the file
+	RemuxFailed  = "failed"
+)
+
+// RemuxStatus describes the background remux of a session's file to MP4.
+type RemuxStatus struct {
+	State   string  `json:"state"`
+	Percent float64 `json:"percent"` // of the file remuxed
+	Error   string  `json:"error,omitempty"`
+}
+
+// BufferStatus describes the downloaded data ahead of the reader position,
+// the offset of a session's file last read by a stream, transcode or segmenter.
+type BufferStatus struct {
+	Offset int64 `json:"offset"` // reader position, bytes
+	// AheadBytes are downloaded contiguously from Offset, i.e. can be read
+	// without waiting for peers.
+	AheadBytes int64 `json:"ahead_bytes"`
+	// AheadSeconds is AheadBytes as playback time at the file's average
+	// bitrate, once the duration is known.
+	AheadSeconds float64 `json:"ahead_seconds,omitempty"`
+	// Pieces maps the pieces from the one at Offset over the readahead
+	// window, "1" for a downloaded piece and "0" for a missing one.
+	Pieces string `json:"pieces"`
+}
+
+// StartBufferStatus describes the data a session waits for before it's
+// ready: the first seconds of playback and, for MP4 files, the index (moov
+// atom), wherever it is in the file.
+type StartBufferStatus struct {
+	Seconds      float64 `json:"seconds"`       // of playback from the start
+	NeededBytes  int64   `json:"needed_bytes"`  // from the start, plus the index once located
+	MissingBytes int64   `json:"missing_bytes"` // of NeededBytes, not downloaded yet
+	// WaitingIndex is set while an MP4 file's index isn't downloaded.
+	WaitingIndex bool `json:"waiting_index,omitempty"`
+	// TimeToPlay estimates the seconds until the session is ready from the
+	// missing bytes and the download speed; omitted while nothing downloads.
+	TimeToPlay float64 `json:"time_to_play,omitempty"`
+}
+
+// MetadataProgress describes the metadata of an asynchronously started
+// session's torrent being fetched from peers.
+type MetadataProgress struct {
+	ElapsedSec     float64 `json:"elapsed_sec"`
+	TimeoutSec     float64 `json:"timeout_sec"`
+	PeersConnected int     `json:"peers_connected"`
+	PeersKnown     int     `json:"peers_known"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// SessionInfo describes a running session for the admin listing. Clients
+// counts the streams currently reading the session's data, FFmpeg jobs
+// included.
+type SessionInfo struct {
+	Session    StreamSession `json:"session"`
+	Stream     *StreamStatus `json:"status"`
+	Clients    int           `json:"clients"`
+	LastActive time.Time     `json:"last_active"`
+}
+
+// PrefetchStatus describes the next episode being prepared automatically
+// near the end of a TV episode. Status is "searching", "ready" or "failed".
+type PrefetchStatus struct {
+	Status    string `json:"status"`
+	SessionID string `json:"session_id,omitempty"`
+	Season    int    `json:"season,omitempty"`
+	Episode   int    `json:"episode,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// FallbackOffer describes a lower-quality release that was started in the
+// background after the original session stalled for too long. When
+// AutoSwitch is set, clients should switch to it without asking the user.
+type FallbackOffer struct {
+	SessionID  string `json:"session_id"`
+	Title      string `json:"title"`
+	Provider   string `json:"provider"`
+	Quality    string `json:"quality"`
+	SizeHuman  string `json:"size_human"`
+	Reason     string `json:"reason"`
+	AutoSwitch bool   `json:"auto_switch"`
+}
+
+// PeerSources counts connected peers by how they were discovered.
+// LSD is reported for completeness; the torrent client doesn't implement
+// local service discovery, so it is always zero.
+type PeerSources struct {
+	DHT      int `json:"dht"`
+	Tracker  int `json:"tracker"`
+	PEX      int `json:"pex"`
+	LSD      int `json:"lsd"`
+	Incoming int `json:"incoming"`
+	Other    int `json:"other"`
+}
+
+// ConnectionHealth summarises the swarm connection state of a torrent.
+type ConnectionHealth struct {
+	KnownPeers       int     `json:"known_peers"`
+	PendingPeers     int     `json:"pending_peers"`
+	HalfOpenPeers    int     `json:"half_open_peers"`
+	ConnectedSeeders int     `json:"connected_seeders"`
+	TCPConns         int     `json:"tcp_conns"`
+	UTPConns         int     `json:"utp_conns"`
+	UsefulRatio      float64 `json:"useful_ratio"`
+}
+
+// ClientStats describes the torrent client and each torrent active in it,
+// for debugging slow streams. Rates are bytes per second over the time
+// since the previous request (0 on the first).
+type ClientStats struct {
+	DHTNodes       int            `json:"dht_nodes"`
+	DHTGoodNodes   int            `json:"dht_good_nodes"`
+	PeersConnected int            `json:"peers_connected"`
+	PeersKnown     int            `json:"peers_known"`
+	DownloadRate   int64          `json:"download_rate"`
+	UploadRate     int64          `json:"upload_rate"`
+	Downloaded     int64          `json:"downloaded_bytes"`
+	Uploaded       int64          `json:"uploaded_bytes"`
+	Torrents       []TorrentStats `json:"torrents"`
+	// ClientStatus is the client's own status report, which includes each
+	// tracker's last announce result and next announce time (?verbose=1).
+	ClientStatus string `json:"client_status,omitempty"`
+}
+
+// TorrentStats describes a torrent active in the client. Pieces has one
+// character per piece: "1" complete, "0" not.
+type TorrentStats struct {
+	InfoHash         string       `json:"info_hash"`
+	Name             string       `json:"name"`
+	MetadataFetched  bool         `json:"metadata_fetched"`
+	Sessions         []string     `json:"sessions,omitempty"`
+	References       int          `json:"references"`
+	BytesCompleted   int64        `json:"bytes_completed"`
+	Length           int64        `json:"length"`
+	PieceCount       int          `json:"piece_count"`
+	PiecesComplete   int          `json:"pieces_complete"`
+	Pieces           string       `json:"pieces,omitempty"`
+	PeersConnected   int          `json:"peers_connected"`
+	PeersKnown       int          `json:"peers_known"`
+	ConnectedSeeders int          `json:"connected_seeders"`
+	PeerSources      *PeerSources `json:"peer_sources"`
+	Trackers         []string     `json:"trackers"`
+	Seed             SeedStatus   `json:"seed"`
+}
+
+// SeedOverride replaces the configured seeding policy for one torrent. Nil
+// fields keep the configured value; a ratio or minutes of 0 is unlimited.
+type SeedOverride struct {
+	Enabled *bool    `json:"enabled"`
+	Ratio   *float64 `json:"ratio,omitempty"`
+	Minutes *int     `json:"minutes,omitempty"`
+}
+
+// SeedStatus is a torrent's upload state under the seeding policy.
+type SeedStatus struct {
+	Uploading    bool          `json:"uploading"` // uploads to peers are allowed
+	Seeding      bool          `json:"seeding"`   // kept in the client to seed after use
+	SeedingSince *time.Time    `json:"seeding_since,omitempty"`
+	Uploaded     int64         `json:"uploaded_bytes"`
+	Ratio        float64       `json:"ratio"`         // uploaded / completed bytes
+	RatioLimit   float64       `json:"ratio_limit"`   // 0 is unlimited
+	MinutesLimit int           `json:"minutes_limit"` // 0 is unlimited
+	Override     *SeedOverride `json:"override,omitempty"`
 }
 
 type WatchHistory struct {
 	ID         int     `json:"id"`
+	ProfileID  int     `json:"profile_id"`
 	TMDbID     int     `json:"tmdb_id"`
+	MediaType  string  `json:"media_type"` // "movie" or "tv"
 	Title      string  `json:"title"`
 	PosterPath string  `json:"poster_path"`
 	Year       int     `json:"year"`
@@ -86,39 +553,220 @@ type WatchHistory struct {
 	UpdatedAt  string  `json:"updated_at"`
 }
 
+// HistoryFilter selects a page of watch history. Completed and MediaType are
+// ignored when unset; Query matches titles case-insensitively. A PerPage of 0
+// returns every matching entry.
+type HistoryFilter struct {
+	Page      int
+	PerPage   int
+	Completed *bool
+	MediaType string
+	Query     string
+}
+
+// HistoryPage is one page of watch history.
+type HistoryPage struct {
+	Page         int            `json:"page"`
+	PerPage      int            `json:"per_page"`
+	TotalPages   int            `json:"total_pages"`
+	TotalResults int            `json:"total_results"`
+	Results      []WatchHistory `json:"results"`
+}
+
+// WatchStats aggregates a profile's watch history over a period. Time is
+// credited to the week and month an entry was last watched in.
+type WatchStats struct {
+	From            string       `json:"from,omitempty"`
+	To              string       `json:"to,omitempty"`
+	Hours           float64      `json:"hours"`
+	TitlesStarted   int          `json:"titles_started"`
+	TitlesCompleted int          `json:"titles_completed"`
+	CompletionRate  float64      `json:"completion_rate"` // completed / started
+	Weekly          []PeriodStat `json:"weekly"`          // ISO weeks, e.g. "2024-W07"
+	Monthly         []PeriodStat `json:"monthly"`         // e.g. "2024-02"
+	TopGenres       []GenreStat  `json:"top_genres"`
+	TopTitles       []TitleStat  `json:"top_titles"`
+}
+
+// PeriodStat is the watch time of one week or month.
+type PeriodStat struct {
+	Period string  `json:"period"`
+	Hours  float64 `json:"hours"`
+	Titles int     `json:"titles"`
+}
+
+// GenreStat is the watch time of one genre.
+type GenreStat struct {
+	Genre  string  `json:"genre"`
+	Hours  float64 `json:"hours"`
+	Titles int     `json:"titles"`
+}
+
+// TitleStat is the watch time of one title.
+type TitleStat struct {
+	TMDbID     int     `json:"tmdb_id"`
+	MediaType  string  `json:"media_type"`
+	Title      string  `json:"title"`
+	PosterPath string  `json:"poster_path"`
+	Hours      float64 `json:"hours"`
+	Completed  bool    `json:"completed"`
+}
+
+// UserDataExport is the archive of GET /api/export, restored by POST
+// /api/import.
+type UserDataExport struct {
+	Version    int             `json:"version"`
+	ExportedAt string          `json:"exported_at"`
+	Settings   *Settings       `json:"settings,omitempty"`
+	Profiles   []ProfileExport `json:"profiles"`
+}
+
+// ProfileExport is a profile with its history and watchlist. Profiles are
+// matched by name on import.
+type ProfileExport struct {
+	Profile
+	History   []WatchHistory  `json:"history"`
+	Watchlist []WatchlistItem `json:"watchlist"`
+}
+
+// ImportResult counts what POST /api/import restored and what it kept from
+// the existing data instead.
+type ImportResult struct {
+	ProfilesCreated   int  `json:"profiles_created"`
+	HistoryImported   int  `json:"history_imported"`
+	HistorySkipped    int  `json:"history_skipped"`
+	WatchlistImported int  `json:"watchlist_imported"`
+	WatchlistSkipped  int  `json:"watchlist_skipped"`
+	SettingsImported  bool `json:"settings_imported"`
+}
+
+// Profile is a household member with their own history, watchlist and
+// language preferences.
+type Profile struct {
+	ID               int    `json:"id"`
+	Name             string `json:"name"`
+	Avatar           string `json:"avatar"`
+	AudioLanguage    string `json:"audio_language"`
+	SubtitleLanguage string `json:"subtitle_language"`
+	CreatedAt        string `json:"created_at"`
+}
+
+type WatchlistItem struct {
+	ID         int    `json:"id"`
+	ProfileID  int    `json:"profile_id"`
+	TMDbID     int    `json:"tmdb_id"`
+	MediaType  string `json:"media_type"`
+	Title      string `json:"title"`
+	PosterPath string `json:"poster_path"`
+	Year       int    `json:"year"`
+	AddedAt    string `json:"added_at"`
+}
+
+// TraktToken is a Trakt.tv OAuth token linked to a profile.
+type TraktToken struct {
+	AccessToken  string    `json:"-"`
+	RefreshToken string    `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// ProviderSession is a search provider's saved login.
+type ProviderSession struct {
+	Provider  string
+	Cookies   []ProviderCookie
+	ExpiresAt time.Time // when the first cookie expires
+}
+
+// ProviderCookie is a saved provider cookie.
+type ProviderCookie struct {
+	Name    string    `json:"name"`
+	Value   string    `json:"value"`
+	Path    string    `json:"path,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// TraktDeviceCode is shown to the user to link a Trakt account: they open
+// VerificationURL and enter UserCode.
+type TraktDeviceCode struct {
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+}
+
+// TraktStatus reports whether a profile has a linked Trakt account.
+type TraktStatus struct {
+	Connected bool `json:"connected"`
+	Pending   bool `json:"pending"` // device authorization in progress
+}
+
+// TraktSyncResult counts items copied in each direction by a sync.
+type TraktSyncResult struct {
+	WatchlistPulled int `json:"watchlist_pulled"`
+	WatchlistPushed int `json:"watchlist_pushed"`
+	HistoryPulled   int `json:"history_pulled"`
+	HistoryPushed   int `json:"history_pushed"`
+}
+
+// CastDevice is a Chromecast (or other Google Cast receiver) on the LAN.
+type CastDevice struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Model string `json:"model,omitempty"`
+	Host  string `json:"host"`
+	Port  int    `json:"port"`
+}
+
+// CastStatus is the playback state of a Cast device.
+type CastStatus struct {
+	DeviceID    string  `json:"device_id"`
+	PlayerState string  `json:"player_state"` // IDLE, BUFFERING, PLAYING or PAUSED
+	CurrentTime float64 `json:"current_time"`
+	Duration    float64 `json:"duration,omitempty"`
+	ContentID   string  `json:"content_id,omitempty"`
+	IdleReason  string  `json:"idle_reason,omitempty"` // FINISHED, CANCELLED, INTERRUPTED or ERROR
+}
+
 type SubtitleResult struct {
-	FileID   int    `json:"file_id"`
-	Language string `json:"language"`
-	Name     string `json:"name"`
-	Downloads int   `json:"downloads"`
+	ID        string `json:"id"` // "<provider>:<id>", for /api/subtitles/download/:id
+	Provider  string `json:"provider"`
+	Language  string `json:"language"`
+	Name      string `json:"name"`
+	Downloads int    `json:"downloads"`
+	HashMatch bool   `json:"hash_match"` // made for the exact release being played
 }
 
 // ----- TV Series types -----
 
 type TVShow struct {
-	ID              int       `json:"id"`
-	Name            string    `json:"name"`
-	Overview        string    `json:"overview"`
-	PosterPath      string    `json:"poster_path"`
-	BackdropPath    string    `json:"backdrop_path"`
-	FirstAirDate    string    `json:"first_air_date"`
-	VoteAverage     float64   `json:"vote_average"`
-	NumberOfSeasons int       `json:"number_of_seasons,omitempty"`
-	NumberOfEpisodes int      `json:"number_of_episodes,omitempty"`
-	IMDbID          string    `json:"imdb_id,omitempty"`
-	Genres          []Genre   `json:"genres,omitempty"`
-	Seasons         []Season  `json:"seasons,omitempty"`
+	ID               int            `json:"id"`
+	Name             string         `json:"name"`
+	Overview         string         `json:"overview"`
+	PosterPath       string         `json:"poster_path"`
+	BackdropPath     string         `json:"backdrop_path"`
+	FirstAirDate     string         `json:"first_air_date"`
+	VoteAverage      float64        `json:"vote_average"`
+	NumberOfSeasons  int            `json:"number_of_seasons,omitempty"`
+	NumberOfEpisodes int            `json:"number_of_episodes,omitempty"`
+	IMDbID           string         `json:"imdb_id,omitempty"`
+	Genres           []Genre        `json:"genres,omitempty"`
+	Seasons          []Season       `json:"seasons,omitempty"`
+	Cast             []CastMember   `json:"cast,omitempty"`
+	Creators         []string       `json:"creators,omitempty"`
+	Trailers         []Trailer      `json:"trailers,omitempty"`
+	Kinopoisk        *KinopoiskInfo `json:"kinopoisk,omitempty"`
+	Ratings          *Ratings       `json:"ratings,omitempty"`
+	LastEpisodeToAir *Episode       `json:"last_episode_to_air,omitempty"`
+	NextEpisodeToAir *Episode       `json:"next_episode_to_air,omitempty"`
 }
 
 type Season struct {
-	ID            int       `json:"id"`
-	SeasonNumber  int       `json:"season_number"`
-	Name          string    `json:"name"`
-	Overview      string    `json:"overview"`
-	PosterPath    string    `json:"poster_path"`
-	AirDate       string    `json:"air_date"`
-	EpisodeCount  int       `json:"episode_count"`
-	Episodes      []Episode `json:"episodes,omitempty"`
+	ID           int       `json:"id"`
+	SeasonNumber int       `json:"season_number"`
+	Name         string    `json:"name"`
+	Overview     string    `json:"overview"`
+	PosterPath   string    `json:"poster_path"`
+	AirDate      string    `json:"air_date"`
+	EpisodeCount int       `json:"episode_count"`
+	Episodes     []Episode `json:"episodes,omitempty"`
 }
 
 type Episode struct {
@@ -167,10 +815,277 @@ type PopularItem struct {
 	URL    string `json:"url"`
 }
 
+// HDRezkaItem is a title card from an HDRezka listing or search, mapped to
+// TMDB where a match was found.
+type HDRezkaItem struct {
+	PopularItem
+	Type      string `json:"type,omitempty"` // films, series, cartoons or animation
+	Year      int    `json:"year,omitempty"`
+	TMDbID    int    `json:"tmdb_id,omitempty"`
+	MediaType string `json:"media_type,omitempty"` // TMDB "movie" or "tv"
+}
+
+// HDRezkaDetails is scraped from an HDRezka title page.
+type HDRezkaDetails struct {
+	URL           string `json:"url"`
+	Title         string `json:"title"`
+	OriginalTitle string `json:"original_title,omitempty"`
+	Year          int    `json:"year,omitempty"`
+	Type          string `json:"type,omitempty"`
+}
+
+// Anime is an AniList title, mapped to TMDB where a match was found so it
+// can use the regular movie and TV pages.
+type Anime struct {
+	ID           int      `json:"id"` // AniList ID
+	MALID        int      `json:"mal_id,omitempty"`
+	Title        string   `json:"title"`
+	TitleRomaji  string   `json:"title_romaji,omitempty"`
+	TitleEnglish string   `json:"title_english,omitempty"`
+	TitleNative  string   `json:"title_native,omitempty"`
+	Synonyms     []string `json:"synonyms,omitempty"`
+	Format       string   `json:"format,omitempty"` // TV, TV_SHORT, MOVIE, OVA, ONA, SPECIAL
+	Status       string   `json:"status,omitempty"`
+	Episodes     int      `json:"episodes,omitempty"`
+	Duration     int      `json:"duration,omitempty"` // minutes per episode
+	Year         int      `json:"year,omitempty"`
+	Score        float64  `json:"score,omitempty"` // 0-10
+	Genres       []string `json:"genres,omitempty"`
+	Overview     string   `json:"overview,omitempty"`
+	PosterURL    string   `json:"poster_url,omitempty"`
+	BackdropURL  string   `json:"backdrop_url,omitempty"`
+	AniListURL   string   `json:"anilist_url"`
+	TMDbID       int      `json:"tmdb_id,omitempty"`
+	MediaType    string   `json:"media_type,omitempty"` // TMDB "movie" or "tv"
+}
+
 // TorrentFile represents a single file inside a multi-file torrent.
 type TorrentFile struct {
 	Index     int    `json:"index"`
 	Path      string `json:"path"`
 	Size      int64  `json:"size"`
 	SizeHuman string `json:"size_human"`
+	// Season and Episode are parsed from the file name in season packs;
+	// Label names the episode ("S01E03").
+	Season  int    `json:"season,omitempty"`
+	Episode int    `json:"episode,omitempty"`
+	Label   string `json:"label,omitempty"`
+}
+
+// MagnetInspection describes a magnet link's contents without starting a stream.
+type MagnetInspection struct {
+	InfoHash        string        `json:"info_hash"`
+	MagnetURI       string        `json:"magnet_uri"`
+	DisplayName     string        `json:"display_name"`
+	Trackers        []string      `json:"trackers"`
+	MetadataFetched bool          `json:"metadata_fetched"`
+	Name            string        `json:"name,omitempty"`
+	Files           []TorrentFile `json:"files,omitempty"`
+	TotalSize       int64         `json:"total_size"`
+	TotalSizeHuman  string        `json:"total_size_human,omitempty"`
+	Swarm           *SwarmStats   `json:"swarm,omitempty"`
+}
+
+// TorrentHealth is the result of briefly joining a torrent's swarm.
+type TorrentHealth struct {
+	InfoHash         string      `json:"info_hash"`
+	Status           string      `json:"status"` // healthy, weak or dead
+	MetadataResolved bool        `json:"metadata_resolved"`
+	MetadataMs       int64       `json:"metadata_ms,omitempty"` // time until metadata arrived
+	KnownPeers       int         `json:"known_peers"`
+	ConnectedPeers   int         `json:"connected_peers"`
+	ConnectedSeeds   int         `json:"connected_seeds"`
+	Swarm            *SwarmStats `json:"swarm,omitempty"`
+}
+
+// SourceRequest identifies a title to play when resolving alternative
+// (non-torrent) sources.
+type SourceRequest struct {
+	TMDbID    int
+	Title     string
+	Year      int
+	IMDbID    string
+	Season    int
+	Episode   int
+	MagnetURI string
+	InfoHash  string
+	// Provider and Quality of the chosen release, if known
+	Provider string
+	Quality  string
+	// TopicID of the release on its provider, used to fetch its .torrent file
+	TopicID string
+	// Client identifies the requester (its IP address) for the stream
+	// limit's queue
+	Client string
+	// Capabilities of the player, if it reported them
+	Capabilities *ClientCapabilities
+	// AudioLanguage the requester prefers (ISO 639 code); its track is
+	// selected once the file is probed
+	AudioLanguage string
+}
+
+// DirectStream is a directly streamable HTTP resource resolved by a source
+// such as a debrid service or HDRezka.
+type DirectStream struct {
+	URL         string
+	FileName    string
+	ContentType string
+	Size        int64
+	Quality     string
+	HLS         bool // URL is an HLS playlist, proxied via the session's hls route
+}
+
+// HealthReport is the body of /healthz and /readyz. Status is "ok",
+// "degraded" (working with reduced features, e.g. without FFmpeg) or "fail".
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the result of probing one dependency.
+type HealthCheck struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+	// FreeBytes is the free space left for torrent data (disk check only).
+	FreeBytes uint64 `json:"free_bytes,omitempty"`
+}
+
+// MediaCapabilities describes the FFmpeg installation, detected at startup.
+// Missing maps each unavailable feature to what it lacks.
+type MediaCapabilities struct {
+	FFmpeg   ToolInfo          `json:"ffmpeg"`
+	FFprobe  ToolInfo          `json:"ffprobe"`
+	Encoders []string          `json:"encoders"`
+	Decoders []string          `json:"decoders"`
+	HWAccels []string          `json:"hwaccels"`
+	Features map[string]bool   `json:"features"`
+	Missing  map[string]string `json:"missing,omitempty"`
+	// HWEncoder is the H.264 hardware encoder that worked in a test
+	// encode, used to transcode video instead of libx264; "" if none.
+	// HWToneMap reports that it also tone-maps HDR video.
+	HWEncoder string `json:"hw_encoder,omitempty"`
+	HWToneMap bool   `json:"hw_tone_map,omitempty"`
+}
+
+// ToolInfo is a binary found (or not) on the PATH.
+type ToolInfo struct {
+	Available bool   `json:"available"`
+	Path      string `json:"path,omitempty"`
+	Version   string `json:"version,omitempty"`
+}
+
+// SystemInfo is the diagnostics summary served at /api/system.
+type SystemInfo struct {
+	StartedAt      time.Time     `json:"started_at"`
+	UptimeSeconds  int64         `json:"uptime_seconds"`
+	GoVersion      string        `json:"go_version"`
+	Disk           DiskUsage     `json:"disk"`
+	Database       DatabaseInfo  `json:"database"`
+	Memory         MemoryUsage   `json:"memory"`
+	ActiveSessions int           `json:"active_sessions"`
+	Library        LibraryCounts `json:"library"`
+}
+
+// DiskUsage is the space torrent data takes in TorrentDir, against the
+// MAX_CACHE_GB budget, and what is left on its file system.
+type DiskUsage struct {
+	Path       string `json:"path"`
+	UsedBytes  int64  `json:"used_bytes"`
+	LimitBytes int64  `json:"limit_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+}
+
+type DatabaseInfo struct {
+	Driver        string `json:"driver"` // "sqlite" or "postgres"
+	SizeBytes     int64  `json:"size_bytes"`
+	SchemaVersion int    `json:"schema_version"`
+}
+
+// MemoryUsage is the Go runtime's view of the process memory.
+type MemoryUsage struct {
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	Goroutines     int    `json:"goroutines"`
+	GCCycles       uint32 `json:"gc_cycles"`
+}
+
+// LibraryCounts counts the stored user data. Downloads are keyed by status.
+type LibraryCounts struct {
+	Profiles       int            `json:"profiles"`
+	HistoryEntries int            `json:"history_entries"`
+	WatchlistItems int            `json:"watchlist_items"`
+	Downloads      map[string]int `json:"downloads"`
+}
+
+// FollowedShow is a TV show on a profile's watchlist or in its watch
+// history, which is checked for new episodes.
+type FollowedShow struct {
+	ProfileID  int
+	TMDbID     int
+	Title      string
+	PosterPath string
+}
+
+// Notification is a message for a profile, e.g. that a new episode of a
+// followed show aired.
+type Notification struct {
+	ID         int    `json:"id"`
+	ProfileID  int    `json:"profile_id"`
+	Type       string `json:"type"` // event type, e.g. "episode.new"
+	TMDbID     int    `json:"tmdb_id"`
+	Title      string `json:"title"`
+	Season     int    `json:"season,omitempty"`
+	Episode    int    `json:"episode,omitempty"`
+	Message    string `json:"message"` // e.g. the episode name
+	PosterPath string `json:"poster_path"`
+	AirDate    string `json:"air_date,omitempty"`
+	Read       bool   `json:"read"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// ReleaseDate is a movie's release in one country, from TMDB.
+type ReleaseDate struct {
+	Country string `json:"country"` // ISO 3166-1
+	Type    int    `json:"type"`    // ReleaseDigital etc.
+	Date    string `json:"date"`    // YYYY-MM-DD
+	Note    string `json:"note,omitempty"`
+}
+
+// TMDB release types.
+const (
+	ReleasePremiere        = 1
+	ReleaseTheatricalLimit = 2
+	ReleaseTheatrical      = 3
+	ReleaseDigital         = 4
+	ReleasePhysical        = 5
+	ReleaseTV              = 6
+)
+
+// CalendarEntry is an upcoming episode or movie release of a followed title.
+type CalendarEntry struct {
+	Date        string `json:"date"`       // YYYY-MM-DD
+	MediaType   string `json:"media_type"` // "tv" or "movie"
+	TMDbID      int    `json:"tmdb_id"`
+	Title       string `json:"title"`
+	PosterPath  string `json:"poster_path"`
+	Season      int    `json:"season,omitempty"`
+	Episode     int    `json:"episode,omitempty"`
+	EpisodeName string `json:"episode_name,omitempty"`
+	Release     string `json:"release,omitempty"` // movies: "digital"
+	Country     string `json:"country,omitempty"` // movies: where it's released first
+}
+
+// CalendarDay holds the entries of one date.
+type CalendarDay struct {
+	Date    string          `json:"date"`
+	Entries []CalendarEntry `json:"entries"`
+}
+
+// Calendar is the upcoming releases of a profile's followed titles between
+// From and To (inclusive), by date; days without releases are left out.
+type Calendar struct {
+	From string        `json:"from"`
+	To   string        `json:"to"`
+	Days []CalendarDay `json:"days"`
 }
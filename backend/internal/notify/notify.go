@@ -0,0 +1,124 @@
+// Package notify sends notifications about server events (finished
+// downloads, new episodes, failed transcodes, low disk space) to external
+// services such as webhooks, Discord, Gotify and ntfy.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// sendTimeout bounds how long a sink may take to deliver one event.
+const sendTimeout = 30 * time.Second
+
+// EventType names an event; it is sent to webhooks and matched against
+// NOTIFY_EVENTS.
+type EventType string
+
+const (
+	DownloadCompleted EventType = "download.completed"
+	DownloadFailed    EventType = "download.failed"
+	NewEpisode        EventType = "episode.new"
+	TranscodeFailed   EventType = "transcode.failed"
+	DiskSpaceLow      EventType = "disk.low"
+)
+
+// EventTypes lists every event type.
+var EventTypes = []EventType{DownloadCompleted, DownloadFailed, NewEpisode, TranscodeFailed, DiskSpaceLow}
+
+// Event is a notification. Title and Message are human-readable; Data holds
+// the object the event is about, e.g. the download.
+type Event struct {
+	Type    EventType `json:"event"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	Data    any       `json:"data,omitempty"`
+}
+
+// Sink delivers events to one service.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, e Event) error
+}
+
+// Notifier fans events out to sinks. The zero value (and nil) drops
+// everything.
+type Notifier struct {
+	sinks  []Sink
+	events map[EventType]bool // nil: all
+}
+
+// New returns a notifier sending the given event types (all if empty) to
+// sinks.
+func New(events []EventType, sinks ...Sink) *Notifier {
+	n := &Notifier{sinks: sinks}
+	if len(events) > 0 {
+		n.events = make(map[EventType]bool, len(events))
+		for _, e := range events {
+			n.events[e] = true
+		}
+	}
+	return n
+}
+
+// Add registers another sink. Must be called before events are sent.
+func (n *Notifier) Add(sink Sink) {
+	n.sinks = append(n.sinks, sink)
+}
+
+// Sinks returns the names of the registered sinks.
+func (n *Notifier) Sinks() []string {
+	if n == nil {
+		return nil
+	}
+	names := make([]string, len(n.sinks))
+	for i, s := range n.sinks {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// Notify sends e to every sink in the background. Failures are logged.
+func (n *Notifier) Notify(e Event) {
+	if n == nil || len(n.sinks) == 0 || (n.events != nil && !n.events[e.Type]) {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, sink := range n.sinks {
+		go func(sink Sink) {
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+			if err := sink.Send(ctx, e); err != nil {
+				log.Warn().Err(err).Str("sink", sink.Name()).Str("event", string(e.Type)).Msg("notification failed")
+			}
+		}(sink)
+	}
+}
+
+// Download returns the event for a download that completed or failed.
+func Download(d models.Download) Event {
+	name := d.Title + EpisodeLabel(d.Season, d.Episode)
+	if d.Status == models.DownloadCompleted {
+		return Event{Type: DownloadCompleted, Title: "Download complete", Message: name, Data: d}
+	}
+	return Event{Type: DownloadFailed, Title: "Download failed", Message: name + ": " + d.Error, Data: d}
+}
+
+// EpisodeLabel formats " S01" or " S01E02"; empty without a season.
+func EpisodeLabel(season, episode int) string {
+	switch {
+	case season <= 0:
+		return ""
+	case episode <= 0:
+		return fmt.Sprintf(" S%02d", season)
+	default:
+		return fmt.Sprintf(" S%02dE%02d", season, episode)
+	}
+}
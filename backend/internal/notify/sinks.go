@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/streambox/backend/internal/httpclient"
+)
+
+// Webhook POSTs each event as JSON to a URL.
+type Webhook struct {
+	url  string
+	http *httpclient.Client
+}
+
+func NewWebhook(url string, opts httpclient.Options) *Webhook {
+	return &Webhook{url: url, http: httpclient.New(opts)}
+}
+
+func (w *Webhook) Name() string { return "webhook" }
+
+func (w *Webhook) Send(ctx context.Context, e Event) error {
+	return postJSON(ctx, w.http, w.url, e, nil)
+}
+
+// Discord posts events to a channel through a Discord webhook URL.
+type Discord struct {
+	url  string
+	http *httpclient.Client
+}
+
+func NewDiscord(webhookURL string, opts httpclient.Options) *Discord {
+	return &Discord{url: webhookURL, http: httpclient.New(opts)}
+}
+
+func (d *Discord) Name() string { return "discord" }
+
+// discordColors tints the embed by how bad the news is.
+var discordColors = map[EventType]int{
+	DownloadCompleted: 0x2ecc71,
+	NewEpisode:        0x3498db,
+	DownloadFailed:    0xe74c3c,
+	TranscodeFailed:   0xe74c3c,
+	DiskSpaceLow:      0xf39c12,
+}
+
+func (d *Discord) Send(ctx context.Context, e Event) error {
+	body := map[string]any{
+		"username": "StreamBox",
+		"embeds": []map[string]any{{
+			"title":       e.Title,
+			"description": e.Message,
+			"color":       discordColors[e.Type],
+			"timestamp":   e.Time,
+		}},
+	}
+	return postJSON(ctx, d.http, d.url, body, nil)
+}
+
+// Gotify pushes events to a Gotify server with an application token.
+type Gotify struct {
+	url   string
+	token string
+	http  *httpclient.Client
+}
+
+func NewGotify(serverURL, token string, opts httpclient.Options) *Gotify {
+	return &Gotify{url: strings.TrimSuffix(serverURL, "/") + "/message", token: token, http: httpclient.New(opts)}
+}
+
+func (g *Gotify) Name() string { return "gotify" }
+
+func (g *Gotify) Send(ctx context.Context, e Event) error {
+	body := map[string]any{
+		"title":    e.Title,
+		"message":  e.Message,
+		"priority": priority(e.Type, 5, 8),
+		"extras":   map[string]any{"streambox::event": e.Type},
+	}
+	return postJSON(ctx, g.http, g.url, body, http.Header{"X-Gotify-Key": {g.token}})
+}
+
+// Ntfy publishes events to an ntfy topic URL, e.g. https://ntfy.sh/mytopic.
+type Ntfy struct {
+	url   string
+	token string // access token for protected topics; may be empty
+	http  *httpclient.Client
+}
+
+func NewNtfy(topicURL, token string, opts httpclient.Options) *Ntfy {
+	return &Ntfy{url: topicURL, token: token, http: httpclient.New(opts)}
+}
+
+func (n *Ntfy) Name() string { return "ntfy" }
+
+func (n *Ntfy) Send(ctx context.Context, e Event) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(e.Message))
+	if err != nil {
+		return fmt.Errorf("build ntfy request: %w", err)
+	}
+	req.Header.Set("Title", e.Title)
+	req.Header.Set("Tags", strings.ReplaceAll(string(e.Type), ".", "_"))
+	req.Header.Set("Priority", fmt.Sprint(priority(e.Type, 3, 4)))
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	return do(n.http, req)
+}
+
+// priority returns high for failures and warnings, normal otherwise.
+func priority(t EventType, normal, high int) int {
+	switch t {
+	case DownloadFailed, TranscodeFailed, DiskSpaceLow:
+		return high
+	}
+	return normal
+}
+
+func postJSON(ctx context.Context, client *httpclient.Client, target string, body any, header http.Header) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encode notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(client, req)
+}
+
+func do(client *httpclient.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		// Webhook URLs often embed a secret; keep it out of the logs.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %d", req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package omdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+)
+
+const defaultBaseURL = "https://www.omdbapi.com/"
+
+// cacheTTL is how long ratings are served from the database. The free tier
+// allows 1,000 requests a day, and scores change slowly.
+const cacheTTL = 7 * 24 * time.Hour
+
+// Client fetches IMDb, Rotten Tomatoes and Metacritic scores from OMDb,
+// caching them in the database.
+type Client struct {
+	apiKey  string
+	http    *httpclient.Client
+	baseURL string
+	db      db.Store
+}
+
+// NewClient creates an OMDb client authenticated with the given API key.
+func NewClient(apiKey string, database db.Store, opts httpclient.Options) *Client {
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &Client{
+		apiKey:  apiKey,
+		http:    httpclient.New(opts),
+		baseURL: defaultBaseURL,
+		db:      database,
+	}
+}
+
+type omdbResponse struct {
+	Response   string `json:"Response"`
+	Error      string `json:"Error"`
+	IMDbRating string `json:"imdbRating"`
+	IMDbVotes  string `json:"imdbVotes"`
+	Metascore  string `json:"Metascore"`
+	Ratings    []struct {
+		Source string `json:"Source"`
+		Value  string `json:"Value"`
+	} `json:"Ratings"`
+}
+
+// Ratings returns the scores for an IMDb ID, or nil if OMDb doesn't know
+// the title.
+func (c *Client) Ratings(ctx context.Context, imdbID string) (*models.Ratings, error) {
+	var cached *models.Ratings
+	found, err := c.db.GetCachedRatings(imdbID, cacheTTL, &cached)
+	if err != nil {
+		log.Warn().Err(err).Str("imdb_id", imdbID).Msg("omdb cache read failed")
+	} else if found {
+		return cached, nil
+	}
+
+	params := url.Values{}
+	params.Set("apikey", c.apiKey)
+	params.Set("i", imdbID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("omdb lookup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body omdbResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode omdb response (status %d): %w", resp.StatusCode, err)
+	}
+
+	var ratings *models.Ratings
+	switch {
+	case body.Response == "True":
+		ratings = body.ratings()
+	case strings.Contains(strings.ToLower(body.Error), "not found"):
+		// Cached as nil so unknown titles don't use up the quota.
+	default:
+		return nil, fmt.Errorf("omdb api error (status %d): %s", resp.StatusCode, body.Error)
+	}
+
+	if err := c.db.SaveCachedRatings(imdbID, ratings); err != nil {
+		log.Warn().Err(err).Str("imdb_id", imdbID).Msg("omdb cache write failed")
+	}
+	return ratings, nil
+}
+
+// ratings converts OMDb's strings ("8.8", "1,234", "87%", "74/100"); "N/A"
+// values are left zero.
+func (r *omdbResponse) ratings() *models.Ratings {
+	out := &models.Ratings{}
+	out.IMDb, _ = strconv.ParseFloat(r.IMDbRating, 64)
+	out.IMDbVotes, _ = strconv.Atoi(strings.ReplaceAll(r.IMDbVotes, ",", ""))
+	out.Metacritic, _ = strconv.Atoi(r.Metascore)
+	for _, rt := range r.Ratings {
+		if rt.Source == "Rotten Tomatoes" {
+			out.RottenTomatoes, _ = strconv.Atoi(strings.TrimSuffix(rt.Value, "%"))
+		}
+	}
+	return out
+}
@@ -0,0 +1,366 @@
+// Package openapi builds an OpenAPI 3 document for the HTTP API from its
+// routes and the Go types the handlers read and write.
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Document is an OpenAPI 3.0 document, limited to the parts StreamBox uses.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Security   []map[string][]any  `json:"security,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem maps lower-case HTTP methods to operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // "path" or "query"
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Route documents one endpoint. Path parameters are taken from the route
+// pattern; request and response schemas are derived from example values.
+type Route struct {
+	Summary string
+	Tag     string
+	Query   []Param
+	// Body is a value of the JSON request body's type, nil for none.
+	Body any
+	// Upload names the file field of a multipart/form-data request body.
+	Upload string
+	// Response is a value of the JSON 200 response's type, nil for none.
+	Response any
+	// Produces is the content type of non-JSON responses, e.g. "video/mp4".
+	Produces string
+}
+
+// Param is a query parameter. Type is a JSON schema type ("string" when
+// empty).
+type Param struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+}
+
+// errorSchema is the body of every error response.
+var errorSchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"code":       {Type: "string", Description: "stable error code, e.g. not_found or upstream_error"},
+		"error":      {Type: "string", Description: "human-readable message"},
+		"details":    {Type: "string"},
+		"retryable":  {Type: "boolean", Description: "whether repeating the request may succeed"},
+		"request_id": {Type: "string", Description: "also sent as X-Request-ID and logged"},
+		"data":       {Description: "structured context, e.g. a queue position"},
+	},
+	Required: []string{"code", "error", "retryable"},
+}
+
+// Builder assembles a Document route by route.
+type Builder struct {
+	doc   *Document
+	types map[string]reflect.Type // component name -> Go type
+	ids   map[string]bool
+}
+
+// New returns a Builder for an API served under basePath ("" for the root).
+// Requests are documented as authenticated by API key, bearer token or
+// session cookie, which the server accepts when auth is enabled.
+func New(title, version, basePath string) *Builder {
+	if basePath == "" {
+		basePath = "/"
+	}
+	return &Builder{
+		doc: &Document{
+			OpenAPI: "3.0.3",
+			Info:    Info{Title: title, Version: version},
+			Servers: []Server{{URL: basePath}},
+			Security: []map[string][]any{
+				{"apiKey": {}}, {"bearer": {}}, {"session": {}}, {},
+			},
+			Paths: make(map[string]PathItem),
+			Components: Components{
+				Schemas: map[string]*Schema{"Error": errorSchema},
+				SecuritySchemes: map[string]SecurityScheme{
+					"apiKey":  {Type: "apiKey", In: "header", Name: "X-API-Key"},
+					"bearer":  {Type: "http", Scheme: "bearer"},
+					"session": {Type: "apiKey", In: "cookie", Name: "streambox_session"},
+				},
+			},
+		},
+		types: make(map[string]reflect.Type),
+		ids:   make(map[string]bool),
+	}
+}
+
+var pathParam = regexp.MustCompile(`[:*]([A-Za-z_]+)`)
+
+// Add documents a Gin route such as "/api/stream/:id". operationID should be
+// unique; repeated IDs get the method appended.
+func (b *Builder) Add(method, path, operationID string, r Route) {
+	if b.ids[operationID] {
+		operationID += capitalize(strings.ToLower(method))
+	}
+	b.ids[operationID] = true
+
+	op := &Operation{
+		OperationID: operationID,
+		Summary:     r.Summary,
+		Responses: map[string]Response{
+			"default": {Description: "Error", Content: jsonContent(&Schema{Ref: "#/components/schemas/Error"})},
+		},
+	}
+	if r.Tag != "" {
+		op.Tags = []string{r.Tag}
+	}
+
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		op.Parameters = append(op.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	for _, p := range r.Query {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		op.Parameters = append(op.Parameters, Parameter{Name: p.Name, In: "query", Description: p.Description, Required: p.Required, Schema: &Schema{Type: typ}})
+	}
+
+	switch {
+	case r.Body != nil:
+		op.RequestBody = &RequestBody{Required: true, Content: jsonContent(b.schema(reflect.TypeOf(r.Body)))}
+	case r.Upload != "":
+		form := &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{r.Upload: {Type: "string", Format: "binary"}},
+			Required:   []string{r.Upload},
+		}
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{"multipart/form-data": {Schema: form}}}
+	}
+	switch {
+	case r.Response != nil:
+		op.Responses["200"] = Response{Description: "OK", Content: jsonContent(b.schema(reflect.TypeOf(r.Response)))}
+	case r.Produces != "":
+		op.Responses["200"] = Response{Description: "OK", Content: map[string]MediaType{r.Produces: {Schema: &Schema{Type: "string", Format: "binary"}}}}
+	default:
+		op.Responses["200"] = Response{Description: "OK"}
+	}
+
+	oaPath := pathParam.ReplaceAllString(path, "{$1}")
+	item := b.doc.Paths[oaPath]
+	if item == nil {
+		item = make(PathItem)
+		b.doc.Paths[oaPath] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// Document returns the assembled document.
+func (b *Builder) Document() *Document {
+	return b.doc
+}
+
+func jsonContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// schema returns the schema of t, registering named structs as components.
+func (b *Builder) schema(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t, nullable = t.Elem(), true
+	}
+
+	var s *Schema
+	switch {
+	case t == timeType:
+		s = &Schema{Type: "string", Format: "date-time"}
+	case t == rawType:
+		s = &Schema{}
+	default:
+		switch t.Kind() {
+		case reflect.Bool:
+			s = &Schema{Type: "boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			s = &Schema{Type: "integer", Format: "int32"}
+		case reflect.Int64, reflect.Uint64:
+			s = &Schema{Type: "integer", Format: "int64"}
+		case reflect.Float32, reflect.Float64:
+			s = &Schema{Type: "number"}
+		case reflect.String:
+			s = &Schema{Type: "string"}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				s = &Schema{Type: "string", Format: "byte"}
+			} else {
+				s = &Schema{Type: "array", Items: b.schema(t.Elem())}
+			}
+		case reflect.Map:
+			s = &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+		case reflect.Struct:
+			if t.Name() == "" {
+				s = b.structSchema(t)
+			} else {
+				s = &Schema{Ref: "#/components/schemas/" + b.component(t)}
+			}
+		default: // interfaces: any JSON value
+			s = &Schema{}
+		}
+	}
+
+	if nullable {
+		if s.Ref != "" {
+			// Siblings of $ref are ignored in OpenAPI 3.0.
+			return &Schema{AllOf: []*Schema{s}, Nullable: true}
+		}
+		s.Nullable = true
+	}
+	return s
+}
+
+// component registers a named struct type and returns its component name.
+func (b *Builder) component(t reflect.Type) string {
+	name := capitalize(t.Name())
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	if existing, ok := b.types[name]; ok {
+		if existing == t {
+			return name
+		}
+		// Same name in another package.
+		name = capitalize(t.PkgPath()[strings.LastIndexByte(t.PkgPath(), '/')+1:]) + name
+		if existing, ok := b.types[name]; ok && existing == t {
+			return name
+		}
+	}
+	b.types[name] = t
+	b.doc.Components.Schemas[name] = &Schema{} // placeholder for recursive types
+	*b.doc.Components.Schemas[name] = *b.structSchema(t)
+	return name
+}
+
+func (b *Builder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	b.addFields(s, t)
+	return s
+}
+
+// addFields adds t's JSON fields to s, flattening embedded structs like
+// encoding/json does.
+func (b *Builder) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = b.schema(f.Type)
+		if strings.Contains(f.Tag.Get("binding"), "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
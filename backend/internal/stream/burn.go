@@ -0,0 +1,87 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streambox/backend/internal/subtitle"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+// burnSubtitleWait bounds how long a stream request waits for the subtitle
+// to burn in. Embedded tracks are extracted from the whole file, which can
+// take longer; the extraction keeps running and a retry picks it up.
+const burnSubtitleWait = 90 * time.Second
+
+var errSubtitlesNotConfigured = errors.New("no subtitle providers configured")
+
+// SetSubtitles sets the registry that subtitles to burn in are downloaded
+// from.
+func (s *Server) SetSubtitles(subtitles *subtitle.Registry) {
+	s.subtitles = subtitles
+}
+
+// burnSubtitleFile writes the subtitle to burn into a session's video to a
+// temp file, shifted by the session's subtitle offset. spec is "track:N" for
+// embedded track N, or else a subtitle download ID (see /api/subtitles).
+// The caller removes the file.
+func (s *Server) burnSubtitleFile(ctx context.Context, sess *torrent.Session, spec string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, burnSubtitleWait)
+	defer cancel()
+
+	var (
+		data []byte
+		err  error
+	)
+	if t, ok := strings.CutPrefix(spec, "track:"); ok {
+		track, convErr := strconv.Atoi(t)
+		if convErr != nil || track < 0 {
+			return "", fmt.Errorf("invalid subtitle track %q", t)
+		}
+		data, err = s.embeddedSubtitle(ctx, sess, track)
+	} else {
+		if s.subtitles == nil || s.subtitles.Len() == 0 {
+			return "", errSubtitlesNotConfigured
+		}
+		data, err = s.subtitles.Download(ctx, spec)
+	}
+	if err != nil {
+		return "", fmt.Errorf("get subtitle: %w", err)
+	}
+
+	f, err := os.CreateTemp("", "streambox-burn-*.vtt")
+	if err != nil {
+		return "", fmt.Errorf("create subtitle file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(subtitle.ShiftVTT(data, sess.SubtitleOffset)); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("write subtitle file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// burnArgs returns the FFmpeg video options rendering a subtitle file onto
+// the picture, which means re-encoding the video. Input seeking restarts
+// timestamps at zero, so they are shifted to the source timeline for the
+// subtitles filter and back afterwards.
+func burnArgs(subtitleFile string, seekTime float64) []string {
+	filter := "subtitles=" + escapeFilterValue(subtitleFile)
+	if seekTime > 0 {
+		offset := strconv.FormatFloat(seekTime, 'f', 3, 64)
+		filter = "setpts=PTS+" + offset + "/TB," + filter + ",setpts=PTS-STARTPTS"
+	}
+	return append([]string{"-vf", filter}, h264Args...)
+}
+
+// escapeFilterValue escapes the characters of a filter option value that
+// FFmpeg's option parser treats specially. Temp file paths need no
+// filtergraph-level escaping on top.
+func escapeFilterValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `:`, `\:`, `'`, `\'`).Replace(v)
+}
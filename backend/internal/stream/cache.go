@@ -0,0 +1,600 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/metrics"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+const (
+	// cacheIdleTimeout stops transcode caches nobody has read from and
+	// deletes their files.
+	cacheIdleTimeout = 10 * time.Minute
+	// cacheRangeWait bounds how long a range request waits for FFmpeg to
+	// write the start of the range.
+	cacheRangeWait = 30 * time.Second
+	// cacheRangeAhead is how far past the cached output a range may start
+	// and still be waited for; ranges further ahead are transcoded live.
+	cacheRangeAhead = 16 << 20
+	// cacheCheckInterval is how often caches are checked for idleness and
+	// the size limit.
+	cacheCheckInterval = 10 * time.Second
+	// cacheChunk is how much cached output is copied per write.
+	cacheChunk = 256 << 10
+)
+
+// errCacheFull stops FFmpeg writing a cache past the size limit.
+var errCacheFull = errors.New("transcode cache full")
+
+// transcodeCache is the fragmented-MP4 output of a session transcoded from
+// the start, written to a file as FFmpeg produces it. Bytes already
+// written can be served again with Range support, so players can buffer
+// backwards and retry failed requests without restarting FFmpeg.
+type transcodeCache struct {
+	path  string
+	file  *os.File // write end
+	cmd   *exec.Cmd
+	audio int
+	play  string // session play method when started: remux, transcode...
+	copy  bool   // audio copied rather than converted (Session.CopiesAudio)
+	opts  models.TranscodeOptions
+
+	mu       sync.Mutex
+	size     int64         // bytes written so far
+	limit    int64         // size the cache may grow to; 0 for no limit
+	finished bool          // FFmpeg exited
+	complete bool          // FFmpeg transcoded the whole input; size is final
+	full     bool          // FFmpeg was stopped at limit; later ranges are transcoded live
+	changed  chan struct{} // closed and replaced whenever the state changes
+	marks    []cacheMark   // output time by byte offset, from FFmpeg progress
+	lastUsed time.Time
+	done     chan struct{}
+}
+
+// cacheMark is a point in the output: size bytes hold media up to time.
+type cacheMark struct {
+	size int64
+	time float64
+}
+
+// Write appends FFmpeg output to the cache file, failing once the cache
+// would grow past its limit.
+func (tc *transcodeCache) Write(p []byte) (int, error) {
+	tc.mu.Lock()
+	if tc.limit > 0 && tc.size+int64(len(p)) > tc.limit {
+		tc.full = true
+		tc.mu.Unlock()
+		return 0, errCacheFull
+	}
+	tc.mu.Unlock()
+
+	n, err := tc.file.Write(p)
+	tc.mu.Lock()
+	tc.size += int64(n)
+	tc.notify()
+	tc.mu.Unlock()
+	return n, err
+}
+
+// notify wakes waiters. Must be called with mu held.
+func (tc *transcodeCache) notify() {
+	close(tc.changed)
+	tc.changed = make(chan struct{})
+}
+
+// wait blocks until more than off bytes are cached, FFmpeg exits or ctx is
+// done, and returns the cached size and whether it is final.
+func (tc *transcodeCache) wait(ctx context.Context, off int64) (int64, bool) {
+	for {
+		tc.mu.Lock()
+		size, finished, changed := tc.size, tc.finished, tc.changed
+		tc.lastUsed = time.Now()
+		tc.mu.Unlock()
+		if size > off || finished {
+			return size, finished
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return size, finished
+		}
+	}
+}
+
+// timeAt returns the media time reached at byte offset off of the output.
+func (tc *transcodeCache) timeAt(off int64) float64 {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	t := 0.0
+	for _, m := range tc.marks {
+		if m.size > off {
+			break
+		}
+		t = m.time
+	}
+	return t
+}
+
+// estimateTime returns the media time at byte offset off, extrapolating
+// from the output written so far, or from the source file's bitrate before
+// FFmpeg has reported progress.
+func (tc *transcodeCache) estimateTime(sess *torrent.Session, off int64) float64 {
+	tc.mu.Lock()
+	var last cacheMark
+	if len(tc.marks) > 0 {
+		last = tc.marks[len(tc.marks)-1]
+	}
+	tc.mu.Unlock()
+
+	var t float64
+	switch {
+	case last.size > 0 && last.time > 0:
+		t = last.time * float64(off) / float64(last.size)
+	case sess.FileSize > 0:
+		t = sess.Duration * float64(off) / float64(sess.FileSize)
+	}
+	if sess.Duration > 0 {
+		t = min(t, sess.Duration)
+	}
+	return t
+}
+
+// trackMarks reads FFmpeg -progress output, recording how far the output
+// file has got in media time.
+func (tc *transcodeCache) trackMarks(r io.Reader) {
+	var mark cacheMark
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "out_time":
+			if secs, ok := parseClock(val); ok {
+				mark.time = secs
+			}
+		case "total_size":
+			if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+				mark.size = n
+			}
+		case "progress":
+			tc.mu.Lock()
+			tc.marks = append(tc.marks, mark)
+			tc.mu.Unlock()
+		}
+	}
+}
+
+func (tc *transcodeCache) usable(sess *torrent.Session, audio int) bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	// A failed run is retried rather than serving a truncated file forever.
+	return tc.audio == audio && tc.play == sess.PlayMethod && tc.copy == sess.CopiesAudio(audio) && tc.opts == sess.Transcode() &&
+		(!tc.finished || tc.complete || tc.full)
+}
+
+func (tc *transcodeCache) touch() {
+	tc.mu.Lock()
+	tc.lastUsed = time.Now()
+	tc.mu.Unlock()
+}
+
+func (tc *transcodeCache) stop() {
+	if tc.cmd.Process != nil {
+		tc.cmd.Process.Kill()
+	}
+	<-tc.done
+	os.Remove(tc.path)
+}
+
+// transcodeCacheFor returns the session's cache for an audio track, starting
+// FFmpeg if there is none yet. Starting one takes a transcode slot for the
+// session on behalf of client.
+func (s *Server) transcodeCacheFor(sess *torrent.Session, audio int, client string) (*transcodeCache, error) {
+	s.cachesMu.Lock()
+	defer s.cachesMu.Unlock()
+
+	if tc := s.caches[sess.ID]; tc != nil {
+		if tc.usable(sess, audio) {
+			tc.touch()
+			return tc, nil
+		}
+		delete(s.caches, sess.ID)
+		go tc.stop()
+	}
+
+	release, err := s.transcodes.Acquire(client, sess.ID)
+	if err != nil {
+		return nil, err
+	}
+	tc, err := s.startTranscodeCache(sess, audio)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	go func() {
+		<-tc.done
+		release()
+	}()
+	s.caches[sess.ID] = tc
+	s.trimCaches()
+	return tc, nil
+}
+
+// SetCacheDir keeps transcode caches in dir rather than the temp directory,
+// deleting the least recently used ones once together they exceed maxBytes
+// (0 for no limit). Caches left by a previous run are deleted. Must be
+// called before serving.
+func (s *Server) SetCacheDir(dir string, maxBytes int64) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	stale, _ := filepath.Glob(filepath.Join(dir, cacheFilePattern))
+	remuxes, _ := filepath.Glob(filepath.Join(dir, remuxFilePattern))
+	for _, path := range append(stale, remuxes...) {
+		os.Remove(path)
+	}
+	s.cacheDir, s.cacheMax = dir, maxBytes
+	return nil
+}
+
+// cacheFilePattern names cache files, for os.CreateTemp and filepath.Glob.
+const cacheFilePattern = "streambox-transcode-*.mp4"
+
+// trimCaches stops the least recently used transcode caches and deletes
+// their files until the rest fit in the size limit. Must be called with
+// cachesMu held.
+func (s *Server) trimCaches() {
+	if s.cacheMax <= 0 {
+		return
+	}
+	type cacheUse struct {
+		id   string
+		tc   *transcodeCache
+		size int64
+		used time.Time
+	}
+	var (
+		uses  []cacheUse
+		total int64
+	)
+	for id, tc := range s.caches {
+		tc.mu.Lock()
+		uses = append(uses, cacheUse{id, tc, tc.size, tc.lastUsed})
+		total += tc.size
+		tc.mu.Unlock()
+	}
+	slices.SortFunc(uses, func(a, b cacheUse) int { return a.used.Compare(b.used) })
+	for _, u := range uses {
+		if total <= s.cacheMax {
+			break
+		}
+		delete(s.caches, u.id)
+		go u.tc.stop()
+		total -= u.size
+		log.Info().Str("session_id", u.id).Int64("size", u.size).Msg("transcode cache evicted")
+	}
+}
+
+// dropCache stops a session's transcode cache and deletes its file; called
+// when the session stops.
+func (s *Server) dropCache(sessionID string) {
+	s.cachesMu.Lock()
+	tc := s.caches[sessionID]
+	delete(s.caches, sessionID)
+	s.cachesMu.Unlock()
+	if tc != nil {
+		tc.stop()
+	}
+}
+
+// startTranscodeCache starts FFmpeg transcoding the session from the start
+// into a new cache file. Must be called with cachesMu held.
+func (s *Server) startTranscodeCache(sess *torrent.Session, audio int) (*transcodeCache, error) {
+	f, err := os.CreateTemp(s.cacheDir, cacheFilePattern)
+	if err != nil {
+		return nil, fmt.Errorf("create cache file: %w", err)
+	}
+
+	input, reader, _, err := s.openInput(s.ctx, sess, 0)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("open input: %w", err)
+	}
+
+	progressR, progressW, err := os.Pipe()
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		if reader != nil {
+			reader.Close()
+		}
+		return nil, fmt.Errorf("create progress pipe: %w", err)
+	}
+
+	tc := &transcodeCache{
+		path:     f.Name(),
+		file:     f,
+		limit:    s.cacheMax,
+		audio:    audio,
+		play:     sess.PlayMethod,
+		copy:     sess.CopiesAudio(audio),
+		opts:     sess.Transcode(),
+		changed:  make(chan struct{}),
+		lastUsed: time.Now(),
+		done:     make(chan struct{}),
+	}
+
+	args := append([]string{"-progress", "pipe:3", "-nostats"}, transcodeArgs(input, nil, audio, videoArgs(sess), audioArgs(sess, audio))...)
+	cmd := exec.CommandContext(s.ctx, "ffmpeg", args...)
+	if reader != nil {
+		cmd.Stdin = reader
+	}
+	cmd.Stdout = tc
+	cmd.ExtraFiles = []*os.File{progressW}
+	var stderrBuf strings.Builder
+	cmd.Stderr = &stderrBuf
+	tc.cmd = cmd
+
+	if err := cmd.Start(); err != nil {
+		progressR.Close()
+		progressW.Close()
+		f.Close()
+		os.Remove(f.Name())
+		if reader != nil {
+			reader.Close()
+		}
+		return nil, fmt.Errorf("start ffmpeg: %w", err)
+	}
+	progressW.Close()
+	go func() {
+		tc.trackMarks(progressR)
+		progressR.Close()
+	}()
+
+	transcodeDone := metrics.TrackTranscode("cache")
+	go func(r io.Closer) {
+		err := cmd.Wait()
+		transcodeDone()
+		if r != nil {
+			r.Close()
+		}
+		f.Close()
+
+		tc.mu.Lock()
+		full := tc.full
+		tc.mu.Unlock()
+		if err != nil && !full && !strings.Contains(err.Error(), "signal: killed") {
+			s.transcodeFailed(sess, "cache", err, stderrBuf.String())
+		}
+
+		tc.mu.Lock()
+		tc.finished, tc.complete = true, err == nil && !full
+		tc.notify()
+		tc.mu.Unlock()
+		close(tc.done)
+	}(reader)
+
+	log.Info().
+		Str("session_id", sess.ID).
+		Int("audio_track", audio).
+		Msg("transcode cache started")
+
+	return tc, nil
+}
+
+// serveCached serves a transcoded session from its cache. A request for the
+// whole stream follows the cache as FFmpeg writes it; a Range request gets
+// the part of the range that is cached once FFmpeg has reached its start.
+// Ranges FFmpeg won't reach soon, or at all because the cache stopped at its
+// size limit, are transcoded live from the time estimated for their start.
+// Finished caches are served like a regular file.
+func (s *Server) serveCached(c *gin.Context, sess *torrent.Session, audioTrack int) {
+	tc, err := s.transcodeCacheFor(sess, audioTrack, c.ClientIP())
+	if err != nil {
+		if respondBusy(c, err) {
+			return
+		}
+		log.Error().Err(err).Str("session_id", sess.ID).Msg("failed to start transcode cache")
+		apierror.Respond(c, http.StatusInternalServerError, "transcoding failed to start")
+		return
+	}
+
+	f, err := os.Open(tc.path)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "transcode cache unavailable", err.Error())
+		return
+	}
+	defer f.Close()
+
+	c.Writer.Header().Set("Content-Type", "video/mp4")
+	c.Writer.Header().Set("Accept-Ranges", "bytes")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+
+	tc.mu.Lock()
+	complete := tc.complete
+	tc.mu.Unlock()
+	if complete {
+		http.ServeContent(c.Writer, c.Request, sess.FilePath, time.Time{}, &cacheReader{ctx: c.Request.Context(), f: f, tc: tc, s: s, sessionID: sess.ID})
+		return
+	}
+
+	start, end, ok := parseRange(c.GetHeader("Range"))
+	if !ok || (start == 0 && end < 0) {
+		// The whole stream, as it is transcoded.
+		c.Status(http.StatusOK)
+		s.copyCached(c, tc, f, sess.ID, 0, -1)
+		return
+	}
+
+	tc.mu.Lock()
+	size, finished := tc.size, tc.finished
+	tc.mu.Unlock()
+	if start <= size+cacheRangeAhead && !finished {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cacheRangeWait)
+		size, finished = tc.wait(ctx, max(start, end))
+		cancel()
+	}
+	if size <= start {
+		tc.mu.Lock()
+		complete = tc.complete
+		tc.mu.Unlock()
+		if complete {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", size))
+			c.Status(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		seekTime := tc.estimateTime(sess, start)
+		log.Debug().Str("session_id", sess.ID).Int64("offset", start).Int64("cached", size).Float64("seek", seekTime).Msg("range not cached, transcoding live")
+		c.Writer.Header().Del("Accept-Ranges")
+		s.serveTranscoded(c, sess, seekTime, audioTrack, videoArgs(sess))
+		return
+	}
+
+	last := size - 1
+	if end >= 0 && end < last {
+		last = end
+	}
+	total := "*"
+	if finished {
+		total = strconv.FormatInt(size, 10)
+	}
+	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%s", start, last, total))
+	c.Header("Content-Length", strconv.FormatInt(last-start+1, 10))
+	c.Status(http.StatusPartialContent)
+	s.copyCached(c, tc, f, sess.ID, start, last)
+}
+
+// copyCached writes cached bytes from start to last (inclusive; -1 follows
+// the cache until FFmpeg exits) and records the playback position reached.
+func (s *Server) copyCached(c *gin.Context, tc *transcodeCache, f *os.File, sessionID string, start, last int64) {
+	ctx := c.Request.Context()
+	buf := make([]byte, cacheChunk)
+	off := start
+	for (last < 0 || off <= last) && ctx.Err() == nil {
+		size, _ := tc.wait(ctx, off)
+		if size <= off {
+			return // FFmpeg exited or the client went away
+		}
+		limit := size
+		if last >= 0 {
+			limit = min(size, last+1)
+		}
+		n, err := f.ReadAt(buf[:min(int64(len(buf)), limit-off)], off)
+		if n > 0 {
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				return
+			}
+			c.Writer.Flush()
+			off += int64(n)
+			s.manager.RecordPosition(sessionID, tc.timeAt(off))
+		}
+		if err != nil && err != io.EOF {
+			log.Warn().Err(err).Str("session_id", sessionID).Msg("failed to read transcode cache")
+			return
+		}
+	}
+}
+
+// parseRange parses a single "bytes=start-" or "bytes=start-end" range; end
+// is -1 if open. Other forms are reported as not ok and answered with the
+// whole stream, as RFC 9110 allows.
+func parseRange(h string) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(h, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, -1, false
+	}
+	from, to, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found || from == "" {
+		return 0, -1, false
+	}
+	start, err := strconv.ParseInt(from, 10, 64)
+	if err != nil || start < 0 {
+		return 0, -1, false
+	}
+	if to == "" {
+		return start, -1, true
+	}
+	end, err = strconv.ParseInt(to, 10, 64)
+	if err != nil || end < start {
+		return 0, -1, false
+	}
+	return start, end, true
+}
+
+// cacheReader reads a finished cache file for http.ServeContent, recording
+// the playback position reached.
+type cacheReader struct {
+	ctx       context.Context
+	f         *os.File
+	tc        *transcodeCache
+	s         *Server
+	sessionID string
+	off       int64
+}
+
+func (r *cacheReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.f.Read(p)
+	if n > 0 {
+		r.off += int64(n)
+		r.tc.touch()
+		r.s.manager.RecordPosition(r.sessionID, r.tc.timeAt(r.off))
+	}
+	return n, err
+}
+
+func (r *cacheReader) Seek(offset int64, whence int) (int64, error) {
+	n, err := r.f.Seek(offset, whence)
+	if err == nil {
+		r.off = n
+	}
+	return n, err
+}
+
+// reapCaches periodically stops transcode caches that clients stopped
+// reading, or that the size limit has no room for, and deletes their files.
+func (s *Server) reapCaches() {
+	ticker := time.NewTicker(cacheCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.cachesMu.Lock()
+		for id, tc := range s.caches {
+			tc.mu.Lock()
+			idle := time.Since(tc.lastUsed) > cacheIdleTimeout
+			tc.mu.Unlock()
+			if idle {
+				delete(s.caches, id)
+				go tc.stop()
+			}
+		}
+		s.trimCaches()
+		s.cachesMu.Unlock()
+	}
+}
@@ -0,0 +1,35 @@
+package stream
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		start, end int64
+		ok         bool
+	}{
+		{"bytes=0-", 0, -1, true},
+		{"bytes=1024-", 1024, -1, true},
+		{"bytes=0-499", 0, 499, true},
+		{"bytes=500-500", 500, 500, true},
+		{"bytes= 100-200", 100, 200, true},
+		// Suffix ranges need the total size, which a transcode in progress
+		// doesn't have yet.
+		{"bytes=-500", 0, -1, false},
+		{"bytes=0-99,200-299", 0, -1, false},
+		{"bytes=500-100", 0, -1, false},
+		{"bytes=abc-", 0, -1, false},
+		{"bytes=0-abc", 0, -1, false},
+		{"bytes=100", 0, -1, false},
+		{"items=0-100", 0, -1, false},
+		{"", 0, -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, end, ok := parseRange(tt.header)
+			if start != tt.start || end != tt.end || ok != tt.ok {
+				t.Errorf("parseRange(%q) = %d, %d, %v; want %d, %d, %v", tt.header, start, end, ok, tt.start, tt.end, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package stream
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+const dashManifestFile = "manifest.mpd"
+
+var (
+	// dashSegmentRe matches video segments (seg-NNNNN.m4s) and audio
+	// segments (aN-NNNNN.m4s).
+	dashSegmentRe = regexp.MustCompile(`^(?:seg|a(\d+))-(\d+)\.m4s$`)
+	// dashInitRe matches initialization segments: init.mp4 for video,
+	// init-aN.mp4 for audio.
+	dashInitRe = regexp.MustCompile(`^init(?:-a(\d+))?\.mp4$`)
+)
+
+// dashVideoCodecs are the RFC 6381 codec strings advertised for copied
+// video; transcoded video is H.264. The profile and level are typical, not
+// read from the file.
+var dashVideoCodecs = map[string]string{
+	"h264": "avc1.640028",
+	"hevc": "hvc1.1.6.L120.90",
+	"av1":  "av01.0.08M.08",
+	"vp9":  "vp09.00.40.08",
+}
+
+// ServeDASH serves the DASH manifest (manifest.mpd), an initialization
+// segment or a media segment of a session. It shares the HLS segmenter (see
+// ServeHLS), writing fragmented MP4 instead of MPEG-TS with video and each
+// audio track as separate representations. Only files with a known
+// duration have a manifest, a static one listing every segment.
+func (s *Server) ServeDASH(c *gin.Context, sessionID, file string) {
+	sess := s.manager.GetSession(sessionID)
+	if sess == nil {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+	s.detectSkipMarkers(sess)
+	done, ok := s.watch(c, sess)
+	if !ok {
+		return
+	}
+	defer done()
+
+	if d := sess.Direct(); d != nil && d.HLS {
+		apierror.Respond(c, http.StatusConflict, "dash unavailable for an hls source; use the hls playlist")
+		return
+	}
+	if featureUnavailable(c, ffmpeg.Transcode) {
+		return
+	}
+	sess.WaitProbed(c.Request.Context(), probeWait)
+	if sess.Duration <= 0 {
+		apierror.Respond(c, http.StatusConflict, "dash needs the duration, which is unknown; use the hls playlist")
+		return
+	}
+
+	if file == dashManifestFile {
+		if !s.applyTranscodeQuery(c, sess) {
+			return
+		}
+		if a := c.Query("audio"); a != "" {
+			if parsed, err := strconv.Atoi(a); err == nil && parsed >= 0 {
+				s.manager.SetAudioTrack(sess.ID, parsed)
+			}
+		}
+		c.Header("Cache-Control", "no-cache")
+		query := ""
+		if token := c.Query("token"); token != "" {
+			// Carried to the segments, like withToken does for HLS.
+			query = "?token=" + url.QueryEscape(token)
+		}
+		c.Data(http.StatusOK, "application/dash+xml", []byte(dashManifest(sess, query)))
+		return
+	}
+
+	if m := dashInitRe.FindStringSubmatch(file); m != nil {
+		track, ok := dashTrack(sess, m[1])
+		if !ok {
+			apierror.Respond(c, http.StatusNotFound, "unknown dash file")
+			return
+		}
+		// Written along with a job's first segment.
+		path, err := s.waitInit(sess, track, c.ClientIP())
+		if err != nil {
+			s.segmentUnavailable(c, sess, -1, err)
+			return
+		}
+		c.Header("Content-Type", "video/mp4")
+		c.File(path)
+		return
+	}
+
+	m := dashSegmentRe.FindStringSubmatch(file)
+	if m == nil {
+		apierror.Respond(c, http.StatusNotFound, "unknown dash file")
+		return
+	}
+	track, ok := dashTrack(sess, m[1])
+	if !ok {
+		apierror.Respond(c, http.StatusNotFound, "unknown dash file")
+		return
+	}
+	n, _ := strconv.Atoi(m[2])
+	path, err := s.waitSegment(sess, segmentsFMP4, track, n, c.ClientIP())
+	if err != nil {
+		s.segmentUnavailable(c, sess, n, err)
+		return
+	}
+
+	s.manager.RecordPosition(sess.ID, float64(n*hlsSegmentSeconds))
+	c.Header("Content-Type", "video/mp4")
+	c.File(path)
+}
+
+// dashTrack parses the audio track of a DASH file name, "" for video.
+func dashTrack(sess *torrent.Session, s string) (int, bool) {
+	if s == "" {
+		return -1, true
+	}
+	track, err := strconv.Atoi(s)
+	return track, err == nil && track < len(sess.AudioTracks)
+}
+
+// waitInit makes sure a job is writing fragmented MP4 and waits for the
+// initialization segment of a rendition.
+func (s *Server) waitInit(sess *torrent.Session, track int, client string) (string, error) {
+	s.hlsMu.Lock()
+	start := 0
+	if job := s.hls[sess.ID]; job != nil && job.usable(sess, segmentsFMP4) {
+		start = job.start
+	}
+	s.hlsMu.Unlock()
+
+	segment, err := s.waitSegment(sess, segmentsFMP4, track, start, client)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(segment), initSegmentName(track)), nil
+}
+
+// segmentUnavailable answers a segment request that failed, n -1 for an
+// initialization segment.
+func (s *Server) segmentUnavailable(c *gin.Context, sess *torrent.Session, n int, err error) {
+	if respondBusy(c, err) {
+		return
+	}
+	log.Warn().Err(err).Str("session_id", sess.ID).Int("segment", n).Msg("dash segment unavailable")
+	apierror.Respond(c, http.StatusServiceUnavailable, "segment unavailable", err.Error())
+}
+
+// dashManifest builds a static manifest with a video adaptation set and an
+// audio one per track, the selected track marked main. Segments are numbered
+// from 0 and hlsSegmentSeconds long, like the HLS VOD playlist. query is
+// appended to the segment URLs.
+func dashManifest(sess *torrent.Session, query string) string {
+	// Copied video's bitrate is about the file's.
+	bandwidth := int64(5_000_000)
+	if sess.FileSize > 0 {
+		bandwidth = int64(float64(sess.FileSize*8) / sess.Duration)
+	}
+	codecs := "avc1.640028"
+	if sess.VideoMode == models.VideoCopy {
+		if c, ok := dashVideoCodecs[sess.VideoCodec]; ok {
+			codecs = c
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, `<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT%.3fS" minBufferTime="PT%dS">`+"\n",
+		sess.Duration, hlsTargetDuration)
+	b.WriteString("  <Period id=\"0\" start=\"PT0S\">\n")
+	b.WriteString("    <AdaptationSet id=\"0\" contentType=\"video\" mimeType=\"video/mp4\" segmentAlignment=\"true\">\n")
+	fmt.Fprintf(&b, "      <Representation id=\"video\" codecs=\"%s\" bandwidth=\"%d\">\n", codecs, bandwidth)
+	writeSegmentTemplate(&b, -1, query)
+	b.WriteString("      </Representation>\n    </AdaptationSet>\n")
+
+	selected := max(sess.AudioTrack, 0)
+	for _, t := range sess.AudioTracks {
+		fmt.Fprintf(&b, "    <AdaptationSet id=\"%d\" contentType=\"audio\" mimeType=\"audio/mp4\"", t.Index+1)
+		if t.Language != "" && t.Language != "und" {
+			fmt.Fprintf(&b, " lang=\"%s\"", xmlEscape(t.Language))
+		}
+		b.WriteString(">\n")
+		role := "alternate"
+		if t.Index == selected {
+			role = "main"
+		}
+		fmt.Fprintf(&b, "      <Role schemeIdUri=\"urn:mpeg:dash:role:2011\" value=\"%s\"/>\n", role)
+		fmt.Fprintf(&b, "      <Label>%s</Label>\n", xmlEscape(t.Title))
+		// Audio is always converted to AAC.
+		fmt.Fprintf(&b, "      <Representation id=\"audio-%d\" codecs=\"mp4a.40.2\" bandwidth=\"192000\">\n", t.Index)
+		writeSegmentTemplate(&b, t.Index, query)
+		b.WriteString("      </Representation>\n    </AdaptationSet>\n")
+	}
+	b.WriteString("  </Period>\n</MPD>\n")
+	return b.String()
+}
+
+// writeSegmentTemplate writes the SegmentTemplate of a rendition (track -1
+// for video).
+func writeSegmentTemplate(b *strings.Builder, track int, query string) {
+	segment, _ := segmentFiles(segmentsFMP4, track, 0)
+	media := strings.Replace(segment, "00000", "$Number%05d$", 1)
+	fmt.Fprintf(b, "        <SegmentTemplate timescale=\"1\" duration=\"%d\" startNumber=\"0\" initialization=\"%s\" media=\"%s\"/>\n",
+		hlsSegmentSeconds, xmlEscape(initSegmentName(track)+query), xmlEscape(media+query))
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
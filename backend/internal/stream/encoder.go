@@ -0,0 +1,120 @@
+package stream
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+const (
+	// encoderStopWait bounds how long a new encoder waits for the one it
+	// supersedes to exit, so they don't read the torrent at once.
+	encoderStopWait = 5 * time.Second
+	// encoderStatusTTL is how long an exited encoder is still reported.
+	encoderStatusTTL = 10 * time.Minute
+)
+
+// encoder supervises the live FFmpeg process transcoding a session for a
+// player (see serveTranscoded). Each session has at most one: starting
+// another kills it, since a seek or another player superseded it.
+type encoder struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the process exited
+	status models.EncoderStatus
+	ended  time.Time
+}
+
+// startEncoder registers the live encoder of a session starting at seek,
+// killing the one it supersedes. FFmpeg must run with the returned context,
+// which ends with ctx, on shutdown or when the encoder is superseded; finish
+// must be called once it exited.
+func (s *Server) startEncoder(ctx context.Context, sessionID string, seek float64) (*encoder, context.Context) {
+	e := &encoder{
+		done:   make(chan struct{}),
+		status: models.EncoderStatus{State: models.EncoderRunning, Seek: seek, Position: seek, StartedAt: time.Now()},
+	}
+	encCtx, cancel := context.WithCancel(s.ctx)
+	stop := context.AfterFunc(ctx, cancel)
+	e.cancel = func() {
+		stop()
+		cancel()
+	}
+
+	s.encodersMu.Lock()
+	for id, old := range s.encoders {
+		if old.status.State != models.EncoderRunning && time.Since(old.ended) > encoderStatusTTL {
+			delete(s.encoders, id)
+		}
+	}
+	prev := s.encoders[sessionID]
+	if prev != nil {
+		e.status.Superseded = prev.status.Superseded
+		if prev.status.State == models.EncoderRunning {
+			e.status.Superseded++
+			prev.cancel()
+		} else {
+			prev = nil
+		}
+	}
+	s.encoders[sessionID] = e
+	s.encodersMu.Unlock()
+
+	if prev != nil {
+		log.Debug().Str("session_id", sessionID).Float64("seek", seek).Msg("superseding live transcode")
+		select {
+		case <-prev.done:
+		case <-time.After(encoderStopWait):
+		case <-ctx.Done():
+		}
+	}
+	return e, encCtx
+}
+
+// encoderProgress records the output position and speed FFmpeg reported.
+func (s *Server) encoderProgress(e *encoder, position, speed float64) {
+	s.encodersMu.Lock()
+	e.status.Position = position
+	if speed > 0 {
+		e.status.Speed = speed
+	}
+	s.encodersMu.Unlock()
+}
+
+// finishEncoder records that an encoder's process exited, with err if it
+// failed rather than being stopped.
+func (s *Server) finishEncoder(e *encoder, err error) {
+	e.cancel()
+	s.encodersMu.Lock()
+	e.status.State = models.EncoderExited
+	if err != nil {
+		e.status.State = models.EncoderFailed
+		e.status.Error = err.Error()
+	}
+	e.status.Speed = 0
+	e.ended = time.Now()
+	s.encodersMu.Unlock()
+	close(e.done)
+}
+
+// encoderStatus adds a session's live encoder to its status.
+func (s *Server) encoderStatus(sessionID string, st *models.StreamStatus) {
+	s.encodersMu.Lock()
+	defer s.encodersMu.Unlock()
+	if e := s.encoders[sessionID]; e != nil {
+		status := e.status
+		st.Encoder = &status
+	}
+}
+
+// dropEncoder kills the live encoder of a stopped session.
+func (s *Server) dropEncoder(sessionID string) {
+	s.encodersMu.Lock()
+	e := s.encoders[sessionID]
+	delete(s.encoders, sessionID)
+	s.encodersMu.Unlock()
+	if e != nil {
+		e.cancel()
+	}
+}
@@ -0,0 +1,557 @@
+package stream
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/metrics"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+const (
+	// hlsSegmentSeconds is the target segment length passed to FFmpeg.
+	hlsSegmentSeconds = 6
+	// hlsTargetDuration is advertised in playlists. Copied video can only be
+	// cut on keyframes, so real segments may run longer than the target.
+	hlsTargetDuration = 10
+	// hlsSegmentWait bounds how long a segment request waits for FFmpeg.
+	hlsSegmentWait = 90 * time.Second
+	// hlsRestartGap is how far (in segments) a request may run ahead of
+	// FFmpeg before the job is restarted at the requested position.
+	hlsRestartGap = 10
+	// hlsIdleTimeout stops jobs whose segments haven't been requested.
+	hlsIdleTimeout = 2 * time.Minute
+
+	hlsPlaylistFile = "playlist.m3u8"
+	hlsContentType  = "application/vnd.apple.mpegurl"
+	hlsFFmpegList   = "index.m3u8"
+	// hlsVideoPlaylist is the video-only media playlist of a master playlist
+	// with audio renditions.
+	hlsVideoPlaylist = "video.m3u8"
+)
+
+// Segment formats an HLS job writes: MPEG-TS for HLS playlists, fragmented
+// MP4 for DASH manifests (see dash.go). Their file extensions.
+const (
+	segmentsTS   = "ts"
+	segmentsFMP4 = "m4s"
+)
+
+// hlsJob is a running FFmpeg HLS segmenter for one session. Its segments
+// are served to HLS and DASH players alike.
+type hlsJob struct {
+	dir      string
+	cmd      *exec.Cmd
+	format   string // segmentsTS or segmentsFMP4
+	start    int    // first segment number produced
+	audio    int    // selected track, -1 for the default, allAudioTracks for renditions
+	opts     models.TranscodeOptions
+	lastUsed time.Time
+	done     chan struct{}
+}
+
+var (
+	// segmentRe matches video segments (seg-NNNNN.ts) and audio rendition
+	// segments (aN-NNNNN.ts).
+	segmentRe       = regexp.MustCompile(`^(?:seg|a(\d+))-(\d+)\.ts$`)
+	audioPlaylistRe = regexp.MustCompile(`^audio-(\d+)\.m3u8$`)
+)
+
+// allAudioTracks selects every audio track: as separate HLS renditions, or
+// as extra tracks in fragmented MP4.
+const allAudioTracks = -2
+
+func segmentName(n int) string {
+	return fmt.Sprintf("seg-%05d.ts", n)
+}
+
+// audioSegmentName is the name of segment n of an audio rendition.
+func audioSegmentName(track, n int) string {
+	return fmt.Sprintf("a%d-%05d.ts", track, n)
+}
+
+// segmentFiles returns the file name of segment n of a rendition (track -1
+// for video, or video with the selected audio) in format and of the FFmpeg
+// playlist listing it.
+func segmentFiles(format string, track, n int) (segment, list string) {
+	if track < 0 {
+		segment, list = segmentName(n), hlsFFmpegList
+	} else {
+		segment, list = audioSegmentName(track, n), fmt.Sprintf("index-a%d.m3u8", track)
+	}
+	return strings.TrimSuffix(segment, ".ts") + "." + format, list
+}
+
+// initSegmentName is the name of the fragmented MP4 initialization segment
+// of a rendition.
+func initSegmentName(track int) string {
+	if track < 0 {
+		return "init.mp4"
+	}
+	return fmt.Sprintf("init-a%d.mp4", track)
+}
+
+// useRenditions reports whether a session's HLS output carries each audio
+// track as a separate rendition, so players can switch tracks without a new
+// FFmpeg. Only VOD playlists (known duration) do.
+func useRenditions(sess *torrent.Session) bool {
+	return sess.Duration > 0 && len(sess.AudioTracks) > 1
+}
+
+// hlsAudio returns the audio selection an HLS job for the session needs to
+// write segments in format. DASH always has separate renditions.
+func hlsAudio(sess *torrent.Session, format string) int {
+	if useRenditions(sess) || format == segmentsFMP4 {
+		return allAudioTracks
+	}
+	return sess.AudioTrack
+}
+
+// usable reports whether the job writes the segments in format a session
+// needs now.
+func (j *hlsJob) usable(sess *torrent.Session, format string) bool {
+	return j.format == format && j.audio == hlsAudio(sess, format) && j.opts == sess.Transcode()
+}
+
+// listed returns the segment numbers FFmpeg has finished and listed in an
+// FFmpeg playlist.
+func (j *hlsJob) listed(list string) map[int]bool {
+	segs := make(map[int]bool)
+	f, err := os.Open(filepath.Join(j.dir, list))
+	if err != nil {
+		return segs
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		name, ok := strings.CutSuffix(line, "."+j.format)
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if n, err := strconv.Atoi(name[strings.LastIndex(name, "-")+1:]); err == nil {
+			segs[n] = true
+		}
+	}
+	return segs
+}
+
+// produced returns the highest finished video segment number, or start-1.
+func (j *hlsJob) produced() int {
+	last := j.start - 1
+	for n := range j.listed(hlsFFmpegList) {
+		if n > last {
+			last = n
+		}
+	}
+	return last
+}
+
+func (j *hlsJob) stop() {
+	if j.cmd.Process != nil {
+		j.cmd.Process.Kill()
+	}
+	<-j.done
+	os.RemoveAll(j.dir)
+}
+
+// ServeHLS serves the HLS playlist (playlist.m3u8) or a segment (seg-NNNNN.ts)
+// of a session. When the duration is known a full VOD playlist is generated so
+// clients can seek anywhere; requesting a segment far from what FFmpeg is
+// producing restarts it there. Files with several audio tracks get a master
+// playlist instead, with video.m3u8 and an audio-N.m3u8 rendition per track
+// (segments aN-NNNNN.ts), so players switch languages without a restart.
+// Otherwise FFmpeg's own EVENT playlist is served and ?t=<seconds> on the
+// playlist restarts it at that position, with EXT-X-MEDIA-SEQUENCE set to the
+// matching segment number.
+func (s *Server) ServeHLS(c *gin.Context, sessionID, file string) {
+	sess := s.manager.GetSession(sessionID)
+	if sess == nil {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+	s.detectSkipMarkers(sess)
+	done, ok := s.watch(c, sess)
+	if !ok {
+		return
+	}
+	defer done()
+
+	if d := sess.Direct(); d != nil && d.HLS {
+		s.serveDirectHLS(c, sess, file)
+		return
+	}
+	if featureUnavailable(c, ffmpeg.Transcode) {
+		return
+	}
+
+	if file == hlsPlaylistFile {
+		if !s.applyTranscodeQuery(c, sess) {
+			return
+		}
+		if a := c.Query("audio"); a != "" {
+			if parsed, err := strconv.Atoi(a); err == nil && parsed >= 0 {
+				s.manager.SetAudioTrack(sess.ID, parsed)
+			}
+		}
+		s.servePlaylist(c, sess)
+		return
+	}
+
+	if useRenditions(sess) {
+		if file == hlsVideoPlaylist {
+			s.serveMediaPlaylist(c, sess, segmentName)
+			return
+		}
+		if m := audioPlaylistRe.FindStringSubmatch(file); m != nil {
+			if track, _ := strconv.Atoi(m[1]); track < len(sess.AudioTracks) {
+				s.serveMediaPlaylist(c, sess, func(n int) string { return audioSegmentName(track, n) })
+				return
+			}
+		}
+	}
+
+	m := segmentRe.FindStringSubmatch(file)
+	if m == nil {
+		apierror.Respond(c, http.StatusNotFound, "unknown hls file")
+		return
+	}
+	n, _ := strconv.Atoi(m[2])
+	track := -1
+	if m[1] != "" {
+		track, _ = strconv.Atoi(m[1])
+		if !useRenditions(sess) || track >= len(sess.AudioTracks) {
+			apierror.Respond(c, http.StatusNotFound, "unknown hls file")
+			return
+		}
+	}
+
+	path, err := s.waitSegment(sess, segmentsTS, track, n, c.ClientIP())
+	if err != nil {
+		if respondBusy(c, err) {
+			return
+		}
+		log.Warn().Err(err).Str("session_id", sess.ID).Int("segment", n).Msg("hls segment unavailable")
+		apierror.Respond(c, http.StatusServiceUnavailable, "segment unavailable", err.Error())
+		return
+	}
+
+	s.manager.RecordPosition(sess.ID, float64(n*hlsSegmentSeconds))
+	c.Header("Content-Type", "video/mp2t")
+	c.File(path)
+}
+
+func (s *Server) servePlaylist(c *gin.Context, sess *torrent.Session) {
+	c.Header("Content-Type", hlsContentType)
+	c.Header("Cache-Control", "no-cache")
+
+	if useRenditions(sess) {
+		c.Data(http.StatusOK, hlsContentType, withToken([]byte(masterPlaylist(sess)), c))
+		return
+	}
+	if sess.Duration > 0 {
+		c.Data(http.StatusOK, hlsContentType, withToken([]byte(vodPlaylist(sess.Duration, segmentName)), c))
+		return
+	}
+
+	start := 0
+	restart := false
+	if t := c.Query("t"); t != "" {
+		if parsed, err := strconv.ParseFloat(t, 64); err == nil && parsed > 0 {
+			start = int(parsed) / hlsSegmentSeconds
+			restart = true
+		}
+	}
+
+	s.hlsMu.Lock()
+	job := s.hls[sess.ID]
+	if job == nil || restart || !job.usable(sess, segmentsTS) {
+		var err error
+		if job, err = s.startHLS(sess, segmentsTS, start, c.ClientIP()); err != nil {
+			s.hlsMu.Unlock()
+			if respondBusy(c, err) {
+				return
+			}
+			apierror.Respond(c, http.StatusInternalServerError, "hls failed to start", err.Error())
+			return
+		}
+	}
+	job.lastUsed = time.Now()
+	s.hlsMu.Unlock()
+
+	// Wait for the first segment so the playlist isn't empty.
+	if _, err := waitFor(job, -1, job.start); err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, "playlist unavailable", err.Error())
+		return
+	}
+	path := filepath.Join(job.dir, hlsFFmpegList)
+	if c.Query("token") == "" {
+		c.File(path)
+		return
+	}
+	list, err := os.ReadFile(path)
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, "playlist unavailable", err.Error())
+		return
+	}
+	c.Data(http.StatusOK, hlsContentType, withToken(list, c))
+}
+
+func (s *Server) serveMediaPlaylist(c *gin.Context, sess *torrent.Session, name func(int) string) {
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, hlsContentType, withToken([]byte(vodPlaylist(sess.Duration, name)), c))
+}
+
+// masterPlaylist lists the video playlist and an audio rendition per track,
+// the selected one as default.
+func masterPlaylist(sess *torrent.Session) string {
+	selected := max(sess.AudioTrack, 0)
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, t := range sess.AudioTracks {
+		name := strings.ReplaceAll(t.Title, `"`, "'")
+		fmt.Fprintf(&b, `#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="%s"`, name)
+		if t.Language != "" && t.Language != "und" {
+			fmt.Fprintf(&b, `,LANGUAGE="%s"`, t.Language)
+		}
+		if t.Index == selected {
+			b.WriteString(",DEFAULT=YES")
+		} else {
+			b.WriteString(",DEFAULT=NO")
+		}
+		fmt.Fprintf(&b, ",AUTOSELECT=YES,URI=\"audio-%d.m3u8\"\n", t.Index)
+	}
+
+	// Video is copied, so its bitrate is about the file's.
+	bandwidth := int64(5_000_000)
+	if sess.FileSize > 0 {
+		bandwidth = int64(float64(sess.FileSize*8) / sess.Duration)
+	}
+	fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,AUDIO=\"audio\"\n%s\n", bandwidth, hlsVideoPlaylist)
+	return b.String()
+}
+
+// vodPlaylist lists every segment of a title of the given duration.
+func vodPlaylist(duration float64, name func(int) string) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", hlsTargetDuration)
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+
+	count := int(math.Ceil(duration / hlsSegmentSeconds))
+	for i := 0; i < count; i++ {
+		length := math.Min(hlsSegmentSeconds, duration-float64(i*hlsSegmentSeconds))
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", length, name(i))
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+// waitSegment makes sure a job is producing segment n of a rendition (see
+// segmentFiles) in format and waits for it.
+func (s *Server) waitSegment(sess *torrent.Session, format string, track, n int, client string) (string, error) {
+	s.hlsMu.Lock()
+	job := s.hls[sess.ID]
+	if job == nil || !job.usable(sess, format) || n < job.start || n > job.produced()+hlsRestartGap {
+		var err error
+		if job, err = s.startHLS(sess, format, n, client); err != nil {
+			s.hlsMu.Unlock()
+			return "", err
+		}
+	}
+	job.lastUsed = time.Now()
+	s.hlsMu.Unlock()
+
+	return waitFor(job, track, n)
+}
+
+// waitFor polls until FFmpeg lists segment n of a rendition, exits, or
+// hlsSegmentWait passes.
+func waitFor(job *hlsJob, track, n int) (string, error) {
+	segment, list := segmentFiles(job.format, track, n)
+	path := filepath.Join(job.dir, segment)
+	deadline := time.After(hlsSegmentWait)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if job.listed(list)[n] {
+			return path, nil
+		}
+		select {
+		case <-job.done:
+			if job.listed(list)[n] {
+				return path, nil
+			}
+			return "", fmt.Errorf("ffmpeg exited before segment %d", n)
+		case <-deadline:
+			return "", fmt.Errorf("timed out waiting for segment %d", n)
+		case <-ticker.C:
+		}
+	}
+}
+
+// startHLS replaces the session's HLS job with one writing segments in
+// format from segment startSeg. Must be called with hlsMu held.
+func (s *Server) startHLS(sess *torrent.Session, format string, startSeg int, client string) (*hlsJob, error) {
+	// Taken before stopping the old job, so a restart keeps the session's
+	// transcode slot.
+	release, err := s.transcodes.Acquire(client, sess.ID)
+	if err != nil {
+		return nil, err
+	}
+	if old := s.hls[sess.ID]; old != nil {
+		delete(s.hls, sess.ID)
+		old.stop()
+	}
+
+	dir, err := os.MkdirTemp("", "streambox-hls-")
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("create segment dir: %w", err)
+	}
+
+	seekTime := float64(startSeg * hlsSegmentSeconds)
+	input, reader, seek, err := s.openInput(s.ctx, sess, seekTime)
+	if err != nil {
+		release()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("open input: %w", err)
+	}
+
+	args := []string{"-nostats"}
+	args = append(args, seek...)
+	// Keep source timestamps so segments from a restarted job line up with
+	// the playlist timeline.
+	args = append(args, "-copyts", "-i", input)
+	audio := hlsAudio(sess, format)
+	switch {
+	case audio == allAudioTracks:
+		// One output per rendition: video only, then each audio track.
+		args = append(args, "-map", "0:v:0")
+		args = append(args, videoArgs(sess)...)
+		args = append(args, hlsOutputArgs(dir, format, -1, startSeg)...)
+		for _, t := range sess.AudioTracks {
+			args = append(args, "-map", fmt.Sprintf("0:a:%d", t.Index), "-c:a", "aac", "-b:a", "192k")
+			args = append(args, downmixArgs(sess, t.Index)...)
+			args = append(args, hlsOutputArgs(dir, format, t.Index, startSeg)...)
+		}
+	default:
+		if audio >= 0 {
+			args = append(args, "-map", "0:v:0", "-map", fmt.Sprintf("0:a:%d", audio))
+		}
+		args = append(args, videoArgs(sess)...)
+		args = append(args, "-c:a", "aac", "-b:a", "192k")
+		args = append(args, downmixArgs(sess, audio)...)
+		args = append(args, hlsOutputArgs(dir, format, -1, startSeg)...)
+	}
+
+	cmd := exec.CommandContext(s.ctx, "ffmpeg", args...)
+	if reader != nil {
+		cmd.Stdin = reader
+	}
+	var stderrBuf strings.Builder
+	cmd.Stderr = &stderrBuf
+
+	if err := cmd.Start(); err != nil {
+		release()
+		if reader != nil {
+			reader.Close()
+		}
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("start ffmpeg: %w", err)
+	}
+
+	job := &hlsJob{
+		dir:      dir,
+		cmd:      cmd,
+		format:   format,
+		start:    startSeg,
+		audio:    audio,
+		opts:     sess.Transcode(),
+		lastUsed: time.Now(),
+		done:     make(chan struct{}),
+	}
+	transcodeDone := metrics.TrackTranscode("hls")
+	go func(r io.Closer) {
+		err := cmd.Wait()
+		transcodeDone()
+		release()
+		if r != nil {
+			r.Close()
+		}
+		if err != nil && !strings.Contains(err.Error(), "signal: killed") {
+			s.transcodeFailed(sess, "hls", err, stderrBuf.String())
+		}
+		close(job.done)
+	}(reader)
+
+	s.hls[sess.ID] = job
+
+	log.Info().
+		Str("session_id", sess.ID).
+		Str("format", format).
+		Int("start_segment", startSeg).
+		Msg("hls segmenter started")
+
+	return job, nil
+}
+
+// hlsOutputArgs returns the FFmpeg HLS muxer options writing the segments of
+// a rendition (see segmentFiles) in format into dir.
+func hlsOutputArgs(dir, format string, track, startSeg int) []string {
+	segment, list := segmentFiles(format, track, 0)
+	pattern := strings.Replace(segment, "00000", "%05d", 1)
+	segmentType := []string{"-hls_segment_type", "mpegts"}
+	if format == segmentsFMP4 {
+		segmentType = []string{"-hls_segment_type", "fmp4", "-hls_fmp4_init_filename", initSegmentName(track)}
+	}
+	args := []string{
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentSeconds),
+		"-hls_list_size", "0",
+	}
+	args = append(args, segmentType...)
+	return append(args,
+		"-hls_flags", "temp_file",
+		"-start_number", strconv.Itoa(startSeg),
+		"-hls_segment_filename", filepath.Join(dir, pattern),
+		"-y",
+		filepath.Join(dir, list),
+	)
+}
+
+// reapHLS periodically stops HLS jobs that clients stopped requesting and
+// removes their segments.
+func (s *Server) reapHLS() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.hlsMu.Lock()
+		for id, job := range s.hls {
+			if time.Since(job.lastUsed) > hlsIdleTimeout {
+				delete(s.hls, id)
+				go job.stop()
+			}
+		}
+		s.hlsMu.Unlock()
+	}
+}
@@ -0,0 +1,228 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+const (
+	// maxPlaylistSize caps upstream HLS playlists read into memory.
+	maxPlaylistSize = 4 << 20
+	// hlsProxyTTL is how long URL maps outlive their last request; paused
+	// players must still be able to resume.
+	hlsProxyTTL = 6 * time.Hour
+)
+
+// uriAttrRe matches URI attributes of tags such as EXT-X-KEY and EXT-X-MEDIA.
+var uriAttrRe = regexp.MustCompile(`URI="([^"]+)"`)
+
+// hlsProxy maps the upstream URLs of a direct HLS session to local names
+// ("px-<n><ext>"), so clients only ever fetch URLs that appeared in the
+// session's own playlists rather than arbitrary ones.
+type hlsProxy struct {
+	mu       sync.Mutex
+	urls     []string
+	index    map[string]int
+	lastUsed time.Time
+}
+
+// name returns the local file name for an upstream URL.
+func (p *hlsProxy) name(upstream string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n, ok := p.index[upstream]
+	if !ok {
+		n = len(p.urls)
+		p.urls = append(p.urls, upstream)
+		p.index[upstream] = n
+	}
+	u, _ := url.Parse(upstream)
+	ext := ""
+	if u != nil {
+		ext = path.Ext(u.Path)
+	}
+	return fmt.Sprintf("px-%d%s", n, ext)
+}
+
+// lookup returns the upstream URL of a local file name.
+func (p *hlsProxy) lookup(file string) (string, bool) {
+	var n int
+	if _, err := fmt.Sscanf(file, "px-%d", &n); err != nil {
+		return "", false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastUsed = time.Now()
+	if n < 0 || n >= len(p.urls) {
+		return "", false
+	}
+	return p.urls[n], true
+}
+
+func (s *Server) hlsProxyFor(sessionID string) *hlsProxy {
+	s.hlsProxiesMu.Lock()
+	defer s.hlsProxiesMu.Unlock()
+	p := s.hlsProxies[sessionID]
+	if p == nil {
+		p = &hlsProxy{index: make(map[string]int), lastUsed: time.Now()}
+		s.hlsProxies[sessionID] = p
+	}
+	return p
+}
+
+// serveDirectHLS proxies the HLS playlist of a direct-source session and
+// everything it references. Playlists are rewritten to point back here.
+func (s *Server) serveDirectHLS(c *gin.Context, sess *torrent.Session, file string) {
+	proxy := s.hlsProxyFor(sess.ID)
+
+	upstream := sess.Direct().URL
+	if file != hlsPlaylistFile {
+		var ok bool
+		if upstream, ok = proxy.lookup(file); !ok {
+			apierror.Respond(c, http.StatusNotFound, "unknown hls file")
+			return
+		}
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, upstream, nil)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "invalid stream url")
+		return
+	}
+	if rng := c.GetHeader("Range"); rng != "" {
+		req.Header.Set("Range", rng)
+	}
+
+	resp, err := s.proxy.Do(req)
+	if err != nil {
+		log.Warn().Err(err).Str("session_id", sess.ID).Msg("hls upstream request failed")
+		apierror.Respond(c, http.StatusBadGateway, "upstream stream unavailable")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		apierror.Respond(c, http.StatusBadGateway, "upstream stream unavailable", resp.Status)
+		return
+	}
+
+	if isPlaylist(file, resp) {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
+		if err != nil {
+			apierror.Respond(c, http.StatusBadGateway, "failed to read upstream playlist", err.Error())
+			return
+		}
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusOK, "application/vnd.apple.mpegurl", withToken(rewritePlaylist(body, resp.Request.URL, proxy), c))
+		return
+	}
+
+	for _, h := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges"} {
+		if v := resp.Header.Get(h); v != "" {
+			c.Writer.Header().Set(h, v)
+		}
+	}
+	c.Status(resp.StatusCode)
+	io.Copy(c.Writer, resp.Body)
+}
+
+func isPlaylist(file string, resp *http.Response) bool {
+	if file == hlsPlaylistFile || strings.HasSuffix(file, ".m3u8") {
+		return true
+	}
+	ct := strings.ToLower(resp.Header.Get("Content-Type"))
+	return strings.Contains(ct, "mpegurl")
+}
+
+// rewritePlaylist replaces every URI in an HLS playlist, resolved against
+// base, with its local proxy name.
+func rewritePlaylist(body []byte, base *url.URL, proxy *hlsProxy) []byte {
+	local := func(ref string) string {
+		u, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return ref
+		}
+		return proxy.name(u.String())
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), maxPlaylistSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#"):
+			line = uriAttrRe.ReplaceAllStringFunc(line, func(attr string) string {
+				return `URI="` + local(uriAttrRe.FindStringSubmatch(attr)[1]) + `"`
+			})
+		case strings.TrimSpace(line) != "":
+			line = local(line)
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// withToken appends the stream token a playlist was requested with (see
+// ?token= in the API) to every URI in it, so players that can't send other
+// credentials, such as Cast receivers, carry it to the segments. Playlists
+// requested without one are returned as they are.
+func withToken(body []byte, c *gin.Context) []byte {
+	token := c.Query("token")
+	if token == "" {
+		return body
+	}
+	query := "?token=" + url.QueryEscape(token)
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), maxPlaylistSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#"):
+			line = uriAttrRe.ReplaceAllStringFunc(line, func(attr string) string {
+				return `URI="` + uriAttrRe.FindStringSubmatch(attr)[1] + query + `"`
+			})
+		case strings.TrimSpace(line) != "":
+			line = strings.TrimSpace(line) + query
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// reapHLSProxies drops URL maps whose stream hasn't been requested within
+// hlsProxyTTL.
+func (s *Server) reapHLSProxies() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.hlsProxiesMu.Lock()
+		for id, p := range s.hlsProxies {
+			p.mu.Lock()
+			idle := time.Since(p.lastUsed) > hlsProxyTTL
+			p.mu.Unlock()
+			if idle {
+				delete(s.hlsProxies, id)
+			}
+		}
+		s.hlsProxiesMu.Unlock()
+	}
+}
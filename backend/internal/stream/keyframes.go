@@ -0,0 +1,408 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+const (
+	// keyframeWindowBefore/After size the byte window around an estimated
+	// seek position that is downloaded and scanned for keyframes.
+	keyframeWindowBefore = 12 * 1024 * 1024
+	keyframeWindowAfter  = 4 * 1024 * 1024
+	// keyframeProbeTimeout bounds downloading and scanning one window.
+	keyframeProbeTimeout = 20 * time.Second
+	// keyframeCacheTTL is how long a session's index is kept after last use.
+	keyframeCacheTTL = 6 * time.Hour
+	// matroskaHeaderLimit is how far into the file the track headers are
+	// looked for; attachments (fonts) can precede the first cluster.
+	matroskaHeaderLimit = 64 * 1024 * 1024
+)
+
+// Matroska element IDs (with their length marker bits).
+const (
+	ebmlID    = 0x1A45DFA3
+	segmentID = 0x18538067
+	infoID    = 0x1549A966
+	tracksID  = 0x1654AE6B
+	clusterID = 0x1F43B675
+)
+
+// unknownLen is the data size of unknown-size (streamed) elements.
+const unknownLen = -1
+
+var clusterIDBytes = []byte{0x1F, 0x43, 0xB6, 0x75}
+
+// keyframe is a video keyframe and the start of the Matroska cluster holding
+// it, where FFmpeg can start demuxing.
+type keyframe struct {
+	time float64
+	pos  int64
+}
+
+// keyframeIndex caches the keyframes found in the probed parts of a
+// session's file. Frames in one window are consecutive, so a seek time that
+// falls between two of them is resolved without probing again.
+type keyframeIndex struct {
+	mu        sync.Mutex
+	header    []byte // EBML header, Segment start, Info and Tracks
+	headerErr error
+	windows   [][]keyframe
+	lastUsed  time.Time
+}
+
+// isMatroska reports whether the file can be seeked with a keyframe index.
+func isMatroska(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".mkv" || ext == ".webm"
+}
+
+// keyframes returns the session's index, creating it on first use.
+func (s *Server) keyframes(sessionID string) *keyframeIndex {
+	s.keyframesMu.Lock()
+	defer s.keyframesMu.Unlock()
+	idx := s.keyframeIdx[sessionID]
+	if idx == nil {
+		idx = &keyframeIndex{}
+		s.keyframeIdx[sessionID] = idx
+	}
+	idx.lastUsed = time.Now()
+	return idx
+}
+
+func (s *Server) reapKeyframes() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.keyframesMu.Lock()
+		for id, idx := range s.keyframeIdx {
+			if time.Since(idx.lastUsed) > keyframeCacheTTL {
+				delete(s.keyframeIdx, id)
+			}
+		}
+		s.keyframesMu.Unlock()
+	}
+}
+
+// keyframeSeek finds the keyframe at or before seekTime in a Matroska
+// session. It returns the file's headers, to be fed to FFmpeg ahead of the
+// data from pos, since demuxing can't start mid-file without them. Unknown
+// regions are downloaded and scanned with ffprobe first.
+func (s *Server) keyframeSeek(ctx context.Context, sess *torrent.Session, seekTime float64) (header []byte, pos int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, keyframeProbeTimeout)
+	defer cancel()
+
+	idx := s.keyframes(sess.ID)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.headerErr != nil {
+		return nil, 0, idx.headerErr
+	}
+	if idx.header == nil {
+		header, err := readMatroskaHeader(ctx, sess)
+		if err != nil {
+			err = fmt.Errorf("read matroska header: %w", err)
+			if ctx.Err() == nil {
+				idx.headerErr = err // not timing out: the file can't be indexed
+			}
+			return nil, 0, err
+		}
+		idx.header = header
+	}
+
+	if kf, ok := idx.lookup(seekTime); ok {
+		return idx.header, kf.pos, nil
+	}
+
+	window, err := probeKeyframes(ctx, sess, idx.header, idx.estimate(sess, seekTime))
+	if err != nil {
+		return idx.header, 0, err
+	}
+	if len(window) > 0 {
+		idx.windows = append(idx.windows, window)
+	}
+	if kf, ok := idx.lookup(seekTime); ok {
+		return idx.header, kf.pos, nil
+	}
+	return idx.header, 0, fmt.Errorf("no keyframe around %.3fs in probed window", seekTime)
+}
+
+// lookup returns the keyframe at or before t whose successor is known to be
+// after t.
+func (idx *keyframeIndex) lookup(t float64) (keyframe, bool) {
+	for _, w := range idx.windows {
+		for i := 0; i+1 < len(w); i++ {
+			if w[i].time <= t && t < w[i+1].time {
+				return w[i], true
+			}
+		}
+	}
+	return keyframe{}, false
+}
+
+// estimate guesses the byte position of t, interpolating between the
+// nearest known keyframes and falling back to the average bitrate.
+func (idx *keyframeIndex) estimate(sess *torrent.Session, t float64) int64 {
+	bytesPerSec := float64(sess.FileSize) / sess.Duration
+	lo, hi := keyframe{pos: -1}, keyframe{pos: -1}
+	for _, w := range idx.windows {
+		for _, kf := range w {
+			if kf.time <= t && (lo.pos < 0 || kf.time > lo.time) {
+				lo = kf
+			}
+			if kf.time > t && (hi.pos < 0 || kf.time < hi.time) {
+				hi = kf
+			}
+		}
+	}
+
+	switch {
+	case lo.pos >= 0 && hi.pos >= 0:
+		return lo.pos + int64((t-lo.time)/(hi.time-lo.time)*float64(hi.pos-lo.pos))
+	case lo.pos >= 0:
+		return lo.pos + int64((t-lo.time)*bytesPerSec)
+	case hi.pos >= 0:
+		return max(0, hi.pos-int64((hi.time-t)*bytesPerSec))
+	}
+	return int64(t * bytesPerSec)
+}
+
+// probeKeyframes downloads the window around center and lists its video
+// keyframes with ffprobe (demuxing only, no decoding).
+func probeKeyframes(ctx context.Context, sess *torrent.Session, header []byte, center int64) ([]keyframe, error) {
+	start := max(0, center-keyframeWindowBefore)
+	end := min(sess.FileSize, center+keyframeWindowAfter)
+	if start >= end {
+		return nil, fmt.Errorf("probe window [%d, %d) is empty", start, end)
+	}
+
+	r, err := sess.NewReaderAt(start)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	buf := make([]byte, end-start)
+	n, err := io.ReadFull(&ctxReader{ctx: ctx, r: r}, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("download probe window: %w", err)
+	}
+	buf = buf[:n]
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,pos,flags",
+		"-of", "csv=p=0",
+		"-i", "pipe:0",
+	)
+	// The window starts mid-cluster; the demuxer resyncs on the next one.
+	cmd.Stdin = io.MultiReader(bytes.NewReader(header), bytes.NewReader(buf))
+	out, err := cmd.Output()
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("ffprobe keyframes: %w", err)
+	}
+
+	var frames []keyframe
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) < 3 || !strings.HasPrefix(fields[2], "K") {
+			continue
+		}
+		t, err1 := strconv.ParseFloat(fields[0], 64)
+		p, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		local := p - int64(len(header))
+		if local < 0 || local >= int64(len(buf)) {
+			continue
+		}
+		cluster := clusterStart(buf, local)
+		if cluster < 0 {
+			continue
+		}
+		frames = append(frames, keyframe{time: t, pos: start + cluster})
+	}
+	return frames, nil
+}
+
+// clusterStart returns the offset in buf of the cluster enclosing off, or -1.
+func clusterStart(buf []byte, off int64) int64 {
+	for i := bytes.LastIndex(buf[:off], clusterIDBytes); i >= 0; i = bytes.LastIndex(buf[:i], clusterIDBytes) {
+		size, n, ok := parseVint(buf[i+4:])
+		if ok && (size == unknownLen || int64(i)+4+int64(n)+size > off) {
+			return int64(i)
+		}
+	}
+	return -1
+}
+
+// readMatroskaHeader builds a minimal stream header for demuxing from any
+// cluster: the EBML header, the Segment start (with unknown size, since data
+// is omitted) and the Info and Tracks elements.
+func readMatroskaHeader(ctx context.Context, sess *torrent.Session) ([]byte, error) {
+	r := sess.NewReader()
+	defer r.Close()
+	cr := &ctxReader{ctx: ctx, r: r}
+
+	var out bytes.Buffer
+	id, size, raw, err := readElementHeader(cr)
+	if err != nil {
+		return nil, err
+	}
+	if id != ebmlID || size == unknownLen || size > 4096 {
+		return nil, errors.New("not a matroska file")
+	}
+	out.Write(raw)
+	if _, err := io.CopyN(&out, cr, size); err != nil {
+		return nil, err
+	}
+
+	id, _, raw, err = readElementHeader(cr)
+	if err != nil {
+		return nil, err
+	}
+	if id != segmentID {
+		return nil, errors.New("missing matroska segment")
+	}
+	pos := int64(out.Len() + len(raw))
+	// Segment ID followed by an 8-byte unknown size
+	out.Write([]byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+
+	var haveTracks bool
+	for pos < matroskaHeaderLimit {
+		id, size, raw, err := readElementHeader(cr)
+		if err != nil {
+			return nil, err
+		}
+		pos += int64(len(raw))
+		if id == clusterID {
+			break
+		}
+		if size == unknownLen {
+			return nil, fmt.Errorf("matroska element %x has unknown size", id)
+		}
+
+		switch id {
+		case infoID, tracksID:
+			if size > 1024*1024 {
+				return nil, fmt.Errorf("matroska element %x too large", id)
+			}
+			out.Write(raw)
+			if _, err := io.CopyN(&out, cr, size); err != nil {
+				return nil, err
+			}
+			haveTracks = haveTracks || id == tracksID
+		default:
+			if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+		pos += size
+	}
+	if !haveTracks {
+		return nil, errors.New("matroska tracks not found")
+	}
+	return out.Bytes(), nil
+}
+
+// readElementHeader reads an EBML element ID and data size, returning the
+// raw header bytes too. The size is unknownLen for unknown-size elements.
+func readElementHeader(r io.Reader) (id int64, size int64, raw []byte, err error) {
+	raw = make([]byte, 1, 12)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return 0, 0, nil, err
+	}
+	idLen := vintLen(raw[0])
+	if idLen == 0 || idLen > 4 {
+		return 0, 0, nil, errors.New("invalid ebml id")
+	}
+	raw = raw[:idLen+1]
+	if _, err := io.ReadFull(r, raw[1:]); err != nil {
+		return 0, 0, nil, err
+	}
+	for _, b := range raw[:idLen] {
+		id = id<<8 | int64(b)
+	}
+
+	sizeLen := vintLen(raw[idLen])
+	if sizeLen == 0 {
+		return 0, 0, nil, errors.New("invalid ebml size")
+	}
+	raw = raw[:idLen+sizeLen]
+	if _, err := io.ReadFull(r, raw[idLen+1:]); err != nil {
+		return 0, 0, nil, err
+	}
+	size, _, _ = parseVint(raw[idLen:])
+	return id, size, raw, nil
+}
+
+// vintLen returns the length of an EBML variable-size integer from its first
+// byte, or 0 if invalid.
+func vintLen(b byte) int {
+	for n := 1; n <= 8; n++ {
+		if b&(0x80>>(n-1)) != 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// parseVint decodes an EBML data size. All value bits set means unknownLen.
+func parseVint(b []byte) (v int64, n int, ok bool) {
+	if len(b) == 0 {
+		return 0, 0, false
+	}
+	n = vintLen(b[0])
+	if n == 0 || len(b) < n {
+		return 0, 0, false
+	}
+	first := int64(b[0]) & int64(0xFF>>n)
+	v = first
+	allOnes := first == int64(0xFF>>n)
+	for _, c := range b[1:n] {
+		v = v<<8 | int64(c)
+		allOnes = allOnes && c == 0xFF
+	}
+	if allOnes {
+		return unknownLen, n, true
+	}
+	return v, n, true
+}
+
+// ctxReader reads a torrent reader under a context, so downloads of missing
+// pieces can be abandoned.
+type ctxReader struct {
+	ctx context.Context
+	r   atorrent.Reader
+}
+
+func (c *ctxReader) Read(b []byte) (int, error) {
+	return c.r.ReadContext(c.ctx, b)
+}
+
+// prefixedReader feeds a header ahead of a torrent reader.
+type prefixedReader struct {
+	io.Reader
+	io.Closer
+}
+
+func newPrefixedReader(header []byte, r io.ReadCloser) io.ReadCloser {
+	return &prefixedReader{Reader: io.MultiReader(bytes.NewReader(header), r), Closer: r}
+}
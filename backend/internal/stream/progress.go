@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// trackProgress reads FFmpeg -progress output and records the playback
+// position delivered so far (seek offset + output time) on the session, and
+// with the encoding speed on its encoder.
+func (s *Server) trackProgress(r io.Reader, sessionID string, seekTime float64, enc *encoder) {
+	scanner := bufio.NewScanner(r)
+	position, speed := seekTime, 0.0
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "out_time":
+			if secs, ok := parseClock(val); ok {
+				position = seekTime + secs
+				s.manager.RecordPosition(sessionID, position)
+			}
+		case "speed":
+			speed, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(val), "x"), 64)
+		case "progress":
+			// Ends each block of values.
+			s.encoderProgress(enc, position, speed)
+		}
+	}
+}
+
+// parseClock parses an FFmpeg "HH:MM:SS.micro" timestamp into seconds.
+func parseClock(v string) (float64, bool) {
+	parts := strings.Split(strings.TrimPrefix(v, "-"), ":")
+	if len(parts) != 3 || strings.HasPrefix(v, "-") {
+		return 0, false
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	sec, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	return float64(h*3600+m*60) + sec, true
+}
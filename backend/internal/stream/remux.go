@@ -0,0 +1,207 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/metrics"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+// remuxPoll is how often a background remux checks whether the next part of
+// the file has downloaded.
+const remuxPoll = 2 * time.Second
+
+// remuxFilePattern names remux files, for os.CreateTemp and filepath.Glob.
+const remuxFilePattern = "streambox-remux-*.mp4"
+
+// remuxJob remuxes a session's Matroska file to a regular MP4 on disk as its
+// pieces download. Once finished, the MP4 is served directly, with Range
+// requests, instead of remuxing the file live for each request.
+type remuxJob struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed when FFmpeg exited
+	path   string
+	size   int64
+	read   atomic.Int64       // bytes of the file fed to FFmpeg
+	status models.RemuxStatus // guarded by remuxesMu
+}
+
+// SetRemuxCache turns remuxing in the background (see remuxJob) on or off.
+// Files go in the cache directory (see SetCacheDir). Must be called before
+// serving.
+func (s *Server) SetRemuxCache(on bool) {
+	s.remuxCache = on
+}
+
+// startRemux starts remuxing a session in the background if that's on and
+// the session is played by remuxing a Matroska file whose selected audio
+// track MP4 can hold. It runs once per session.
+func (s *Server) startRemux(sess *torrent.Session) {
+	audio := max(sess.AudioTrack, 0)
+	if !s.remuxCache || sess.Direct() != nil || sess.PlayMethod != models.PlayRemux ||
+		sess.VideoCodec == "" || !isMatroska(sess.FilePath) || !sess.CopiesAudio(audio) {
+		return
+	}
+
+	s.remuxesMu.Lock()
+	defer s.remuxesMu.Unlock()
+	if s.remuxes[sess.ID] != nil || s.ctx.Err() != nil {
+		return
+	}
+	f, err := os.CreateTemp(s.cacheDir, remuxFilePattern)
+	if err != nil {
+		log.Warn().Err(err).Str("session_id", sess.ID).Msg("failed to create remux file")
+		return
+	}
+	f.Close()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	job := &remuxJob{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		path:   f.Name(),
+		size:   sess.FileSize,
+		status: models.RemuxStatus{State: models.RemuxRunning},
+	}
+	s.remuxes[sess.ID] = job
+	go s.remux(ctx, sess, job, audio)
+}
+
+// remux runs a remux job's FFmpeg, then has the session served from the
+// MP4.
+func (s *Server) remux(ctx context.Context, sess *torrent.Session, job *remuxJob, audio int) {
+	defer close(job.done)
+
+	reader := sess.NewBackgroundReader()
+	defer reader.Close()
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-nostats",
+		"-i", "pipe:0",
+		"-map", "0:v:0", "-map", fmt.Sprintf("0:a:%d", audio),
+		"-c", "copy",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		"-y", job.path,
+	)
+	cmd.Stdin = &downloadedReader{ctx: ctx, sess: sess, r: reader, job: job}
+	var stderrBuf strings.Builder
+	cmd.Stderr = &stderrBuf
+
+	log.Info().Str("session_id", sess.ID).Int("audio_track", audio).Msg("background remux started")
+	transcodeDone := metrics.TrackTranscode("remux")
+	err := cmd.Run()
+	transcodeDone()
+	if ctx.Err() != nil {
+		return // the session stopped; its file is removed by dropRemux
+	}
+	if err != nil {
+		s.transcodeFailed(sess, "remux", err, stderrBuf.String())
+		os.Remove(job.path)
+		s.setRemuxStatus(job, models.RemuxFailed, err)
+		return
+	}
+	if !s.manager.SetRemuxed(sess.ID, job.path, audio) {
+		return
+	}
+	s.setRemuxStatus(job, models.RemuxReady, nil)
+	log.Info().Str("session_id", sess.ID).Msg("background remux finished, serving directly")
+}
+
+func (s *Server) setRemuxStatus(job *remuxJob, state string, err error) {
+	s.remuxesMu.Lock()
+	defer s.remuxesMu.Unlock()
+	job.status.State = state
+	if err != nil {
+		job.status.Error = err.Error()
+	}
+}
+
+// serveRemux serves a session's finished MP4 remux like a regular file.
+func (s *Server) serveRemux(c *gin.Context, sess *torrent.Session, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Error().Err(err).Str("session_id", sess.ID).Msg("failed to open remux")
+		apierror.Respond(c, http.StatusInternalServerError, "failed to open remux")
+		return
+	}
+	defer f.Close()
+	http.ServeContent(c.Writer, c.Request, filepath.Base(path), time.Time{}, f)
+}
+
+// remuxStatus adds a session's background remux to its status.
+func (s *Server) remuxStatus(sessionID string, st *models.StreamStatus) {
+	s.remuxesMu.Lock()
+	defer s.remuxesMu.Unlock()
+	job := s.remuxes[sessionID]
+	if job == nil {
+		return
+	}
+	status := job.status
+	switch {
+	case status.State == models.RemuxReady:
+		status.Percent = 100
+	case job.size > 0:
+		status.Percent = float64(job.read.Load()) / float64(job.size) * 100
+	}
+	st.Remux = &status
+}
+
+// dropRemux stops the background remux of a stopped session and deletes its
+// file.
+func (s *Server) dropRemux(sessionID string) {
+	s.remuxesMu.Lock()
+	job := s.remuxes[sessionID]
+	delete(s.remuxes, sessionID)
+	s.remuxesMu.Unlock()
+	if job != nil {
+		job.stop()
+	}
+}
+
+func (j *remuxJob) stop() {
+	j.cancel()
+	<-j.done
+	os.Remove(j.path)
+}
+
+// downloadedReader reads a session's file as far as it has downloaded,
+// polling for the next part rather than blocking in the torrent reader, so
+// a background job ends promptly when cancelled.
+type downloadedReader struct {
+	ctx  context.Context
+	sess *torrent.Session
+	r    io.Reader
+	off  int64
+	job  *remuxJob
+}
+
+func (d *downloadedReader) Read(p []byte) (int, error) {
+	n := min(int64(len(p)), d.sess.FileSize-d.off)
+	if n <= 0 {
+		return 0, io.EOF
+	}
+	for !d.sess.RangeComplete(d.off, n) {
+		select {
+		case <-d.ctx.Done():
+			return 0, d.ctx.Err()
+		case <-time.After(remuxPoll):
+		}
+	}
+	read, err := d.r.Read(p[:n])
+	d.off += int64(read)
+	d.job.read.Store(d.off)
+	return read, err
+}
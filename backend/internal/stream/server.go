@@ -1,71 +1,579 @@
 package stream
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	atorrent "github.com/anacrolix/torrent"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/admission"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/metrics"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/notify"
+	"github.com/streambox/backend/internal/subtitle"
 	"github.com/streambox/backend/internal/torrent"
 )
 
+// probeWait bounds how long a stream request waits for the session's media
+// probe before picking a play method without the codecs.
+const probeWait = 10 * time.Second
+
 // Server handles HTTP video streaming from torrent sessions.
 type Server struct {
-	manager *torrent.Manager
+	manager   *torrent.Manager
+	subtitles *subtitle.Registry // subtitles to burn in (see burn.go); may be nil
+	notifier  *notify.Notifier   // told about failed transcodes; may be nil
+	// proxy fetches direct-source streams; no timeout since responses are long-lived.
+	proxy *http.Client
+
+	hls   map[string]*hlsJob // HLS segmenters by session ID (see hls.go)
+	hlsMu sync.Mutex
+
+	subs   map[string]*subtitleEntry // extracted subtitles by "session:track" (see subtitles.go)
+	subsMu sync.Mutex
+
+	keyframeIdx map[string]*keyframeIndex // seek indexes by session ID (see keyframes.go)
+	keyframesMu sync.Mutex
+
+	hlsProxies   map[string]*hlsProxy // direct HLS URL maps by session ID (see hlsproxy.go)
+	hlsProxiesMu sync.Mutex
+
+	caches   map[string]*transcodeCache // transcoded output by session ID (see cache.go)
+	cachesMu sync.Mutex
+	cacheDir string // where caches are written; "" for the temp directory
+	cacheMax int64  // total size of caches in bytes; 0 for no limit
+
+	trickplays   map[string]*trickplay // thumbnail sprites by session ID (see trickplay.go)
+	trickplaysMu sync.Mutex
+
+	skipJobs   map[string]bool // sessions being analysed for skip markers (see skip.go)
+	skipJobsMu sync.Mutex
+
+	encoders   map[string]*encoder // live transcodes by session ID (see encoder.go)
+	encodersMu sync.Mutex
+
+	remuxes    map[string]*remuxJob // background MP4 remuxes by session ID (see remux.go)
+	remuxesMu  sync.Mutex
+	remuxCache bool
+
+	transcodes *admission.Queue // sessions being transcoded for clients (see SetTranscodeLimit)
+
+	// ctx is cancelled by Close, killing all FFmpeg processes.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewServer(manager *torrent.Manager) *Server {
-	return &Server{manager: manager}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		manager: manager,
+		proxy:   &http.Client{},
+		hls:     make(map[string]*hlsJob),
+		subs:    make(map[string]*subtitleEntry),
+		ctx:     ctx,
+		cancel:  cancel,
+
+		encoders: make(map[string]*encoder),
+		remuxes:  make(map[string]*remuxJob),
+
+		keyframeIdx: make(map[string]*keyframeIndex),
+		hlsProxies:  make(map[string]*hlsProxy),
+		caches:      make(map[string]*transcodeCache),
+		trickplays:  make(map[string]*trickplay),
+		skipJobs:    make(map[string]bool),
+		transcodes:  admission.NewQueue("transcodes", 0),
+	}
+	manager.OnSessionStopped(s.dropCache)
+	manager.OnSessionStopped(s.dropEncoder)
+	manager.OnSessionStopped(s.dropRemux)
+	manager.OnStatus(s.encoderStatus)
+	manager.OnStatus(s.remuxStatus)
+	go s.reapHLS()
+	go s.reapSubtitles()
+	go s.reapKeyframes()
+	go s.reapHLSProxies()
+	go s.reapCaches()
+	go s.reapTrickplay()
+	return s
+}
+
+// SetTranscodeLimit limits how many sessions can be transcoded for clients
+// at once (streams and HLS); requests beyond it get 429 with their place in
+// the queue. Background jobs such as thumbnails aren't limited. Must be
+// called before serving.
+func (s *Server) SetTranscodeLimit(limit int) {
+	s.transcodes = admission.NewQueue("transcodes", limit)
+}
+
+// SetNotifier sets where transcodes that fail are reported. Must be called
+// before serving.
+func (s *Server) SetNotifier(n *notify.Notifier) {
+	s.notifier = n
+}
+
+// transcodeFailed logs an FFmpeg run for sess that exited with an error and
+// sends a notification. Sessions transcoded by the hardware encoder fall back
+// to libx264. kind is "stream", "cache", "hls" or "remux".
+func (s *Server) transcodeFailed(sess *torrent.Session, kind string, err error, stderr string) {
+	log.Warn().Err(err).Str("session_id", sess.ID).Str("kind", kind).Str("stderr", stderr).Msg("ffmpeg exited with error")
+	if s.manager.HWTranscodeFailed(sess.ID) {
+		log.Warn().Str("session_id", sess.ID).Msg("hardware encoder failed, transcoding with libx264 from now on")
+	}
+
+	// FFmpeg's last line is usually the reason.
+	reason := err.Error()
+	if lines := strings.Split(strings.TrimSpace(stderr), "\n"); lines[len(lines)-1] != "" {
+		reason = lines[len(lines)-1]
+	}
+	s.notifier.Notify(notify.Event{
+		Type:    notify.TranscodeFailed,
+		Title:   "Transcode failed",
+		Message: sess.Title + ": " + reason,
+		Data:    map[string]any{"session_id": sess.ID, "title": sess.Title, "kind": kind, "error": reason},
+	})
+}
+
+// featureUnavailable answers 501 if the installed FFmpeg can't do f,
+// reporting whether it did.
+func featureUnavailable(c *gin.Context, f ffmpeg.Feature) bool {
+	if ffmpeg.Supports(f) {
+		return false
+	}
+	apierror.Respond(c, http.StatusNotImplemented, strings.ReplaceAll(string(f), "_", " ")+" unavailable", ffmpeg.Reason(f))
+	return true
+}
+
+// respondBusy answers 429 if err is an *admission.BusyError, reporting
+// whether it did.
+func respondBusy(c *gin.Context, err error) bool {
+	var busy *admission.BusyError
+	if !errors.As(err, &busy) {
+		return false
+	}
+	c.Header("Retry-After", "5")
+	apierror.Write(c, apierror.New(http.StatusTooManyRequests, "server busy").WithCode(apierror.CodeBusy).WithDetails(busy.Error()).WithData(busy))
+	return true
+}
+
+// Close kills all running FFmpeg processes (ending their responses) and
+// removes HLS segments, transcode caches and thumbnails. Used on shutdown.
+func (s *Server) Close() {
+	s.cancel()
+
+	s.hlsMu.Lock()
+	jobs := s.hls
+	s.hls = make(map[string]*hlsJob)
+	s.hlsMu.Unlock()
+	for _, job := range jobs {
+		job.stop()
+	}
+
+	s.cachesMu.Lock()
+	caches := s.caches
+	s.caches = make(map[string]*transcodeCache)
+	s.cachesMu.Unlock()
+	for _, tc := range caches {
+		tc.stop()
+	}
+
+	s.trickplaysMu.Lock()
+	trickplays := s.trickplays
+	s.trickplays = make(map[string]*trickplay)
+	s.trickplaysMu.Unlock()
+	for _, tp := range trickplays {
+		tp.mu.Lock()
+		tp.stopped = true
+		tp.mu.Unlock()
+		os.RemoveAll(tp.dir)
+	}
+
+	s.remuxesMu.Lock()
+	remuxes := s.remuxes
+	s.remuxes = make(map[string]*remuxJob)
+	s.remuxesMu.Unlock()
+	for _, job := range remuxes {
+		job.stop()
+	}
 }
 
 // ServeStream serves the video data for a streaming session.
 // For MP4/WebM it serves directly via http.ServeContent (Range support).
-// For MKV/AVI it pipes through FFmpeg for remuxing to fragmented MP4.
-// Supports ?t=<seconds> for time-based seeking on transcoded streams.
+// For MKV/AVI it pipes through FFmpeg for remuxing to fragmented MP4, served
+// from a disk cache with Range support (see cache.go). Supports ?t=<seconds>
+// for time-based seeking on transcoded streams, which starts a live FFmpeg.
+// ?original=1 serves the file as it is even if it would be transcoded, for
+// players like VLC and mpv that handle any container.
 func (s *Server) ServeStream(c *gin.Context, sessionID string) {
 	sess := s.manager.GetSession(sessionID)
 	if sess == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		apierror.Respond(c, http.StatusNotFound, "session not found")
 		return
 	}
+	s.detectSkipMarkers(sess)
 
-	if !sess.NeedsTranscode {
+	if d := sess.Direct(); d != nil && d.HLS {
+		// Not a single file; players load the proxied playlist instead.
+		c.Redirect(http.StatusFound, "/api/stream/"+sess.ID+"/hls/"+hlsPlaylistFile)
+		return
+	}
+	done, ok := s.watch(c, sess)
+	if !ok {
+		return
+	}
+	defer done()
+	if !s.applyTranscodeQuery(c, sess) {
+		return
+	}
+	// ?burn_subtitle= renders a subtitle onto the picture for devices that
+	// can't display text tracks; this re-encodes even files that need no
+	// transcoding.
+	burn := c.Query("burn_subtitle")
+	// The play method depends on the codecs, known once the file is probed.
+	sess.WaitProbed(c.Request.Context(), probeWait)
+	transcode := sess.NeedsTranscode && c.Query("original") != "1"
+	if transcode && burn == "" {
+		s.startRemux(sess)
+	}
+
+	if d := sess.Direct(); d != nil && !transcode && burn == "" {
+		s.proxyDirect(c, d.URL)
+		return
+	}
+
+	if path := sess.Remuxed(); path != "" && !transcode && burn == "" && c.Query("original") != "1" {
+		s.serveRemux(c, sess, path)
+		return
+	}
+
+	if !transcode && burn == "" {
 		// Direct serving — create a fresh reader per request so concurrent
 		// Range requests don't conflict on seek position.
 		reader := sess.NewReader()
 		defer reader.Close()
-		http.ServeContent(c.Writer, c.Request, sess.FilePath, time.Time{}, reader.(io.ReadSeeker))
+		http.ServeContent(c.Writer, c.Request, sess.FilePath, time.Time{}, contextReader{reader, c.Request.Context()})
+		return
+	}
+
+	if featureUnavailable(c, ffmpeg.Transcode) || (burn != "" && featureUnavailable(c, ffmpeg.BurnSubtitles)) {
 		return
 	}
 
-	// Transcoding path — pipe through FFmpeg
-	seekTime := 0.0
-	if t := c.Query("t"); t != "" {
+	// Transcoding path — pipe through FFmpeg. Resumed sessions start at
+	// their start position unless ?t= says otherwise.
+	seekTime := sess.StartPosition
+	if t, ok := c.GetQuery("t"); ok {
+		seekTime = 0
 		if parsed, err := strconv.ParseFloat(t, 64); err == nil && parsed > 0 {
 			seekTime = parsed
 		}
 	}
 
-	audioTrack := -1
-	if a := c.Query("audio"); a != "" {
+	// Without ?audio= the session's last selected track is used; ?audio=all
+	// includes every track, for players that can switch between them.
+	audioTrack := sess.AudioTrack
+	if a := c.Query("audio"); a == "all" {
+		audioTrack = allAudioTracks
+	} else if a != "" {
 		if parsed, err := strconv.Atoi(a); err == nil && parsed >= 0 {
 			audioTrack = parsed
+			s.manager.SetAudioTrack(sess.ID, audioTrack)
 		}
 	}
 
-	s.serveTranscoded(c, sess, seekTime, audioTrack)
+	if burn != "" {
+		file, err := s.burnSubtitleFile(c.Request.Context(), sess, burn)
+		if err != nil {
+			if c.Request.Context().Err() != nil {
+				return
+			}
+			log.Warn().Err(err).Str("session_id", sess.ID).Str("subtitle", burn).Msg("subtitle for burn-in unavailable")
+			apierror.Respond(c, http.StatusServiceUnavailable, "subtitle unavailable", err.Error())
+			return
+		}
+		defer os.Remove(file)
+		s.serveTranscoded(c, sess, seekTime, audioTrack, burnArgs(file, seekTime))
+		return
+	}
+
+	if seekTime == 0 {
+		s.serveCached(c, sess, audioTrack)
+		return
+	}
+	s.serveTranscoded(c, sess, seekTime, audioTrack, videoArgs(sess))
 }
 
 // serveTranscoded pipes the torrent data through FFmpeg to convert MKV/AVI to
-// fragmented MP4 that browsers can play. Supports time-based seeking.
-func (s *Server) serveTranscoded(c *gin.Context, sess *torrent.Session, seekTime float64, audioTrack int) {
-	// Create a fresh reader for this request
-	var reader io.Reader
+// fragmented MP4 that browsers can play. Supports time-based seeking. video
+// overrides the video options, which copy the video by default.
+func (s *Server) serveTranscoded(c *gin.Context, sess *torrent.Session, seekTime float64, audioTrack int, video []string) {
+	release, err := s.transcodes.Acquire(c.ClientIP(), sess.ID)
+	if respondBusy(c, err) {
+		return
+	}
+	defer release()
+
+	// The process this one supersedes is killed before reading starts.
+	enc, ctx := s.startEncoder(c.Request.Context(), sess.ID, seekTime)
+	var failure error
+	defer func() { s.finishEncoder(enc, failure) }()
+
+	input, reader, seek, err := s.openInput(c.Request.Context(), sess, seekTime)
+	if err != nil {
+		failure = err
+		log.Error().Err(err).Float64("seek", seekTime).Msg("failed to seek reader")
+		apierror.Respond(c, http.StatusInternalServerError, "seek failed")
+		return
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+
+	// FFmpeg reports its output timestamp on fd 3 so the delivered position
+	// can be persisted for crash recovery.
+	args := append([]string{"-progress", "pipe:3", "-nostats"}, transcodeArgs(input, seek, audioTrack, video, audioArgs(sess, audioTrack))...)
+
+	progressR, progressW, err := os.Pipe()
+	if err != nil {
+		failure = err
+		log.Error().Err(err).Msg("failed to create progress pipe")
+		apierror.Respond(c, http.StatusInternalServerError, "transcoding failed to start")
+		return
+	}
+	defer progressR.Close()
+
+	// FFmpeg is killed once the request ends rather than when it next
+	// writes, e.g. when another client took the session over, and when a
+	// newer request supersedes it.
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	if reader != nil {
+		cmd.Stdin = reader
+	}
+	cmd.ExtraFiles = []*os.File{progressW}
+	cmd.Stdout = c.Writer
+
+	var stderrBuf strings.Builder
+	cmd.Stderr = &stderrBuf
+
+	c.Writer.Header().Set("Content-Type", "video/mp4")
+	c.Writer.Header().Set("Transfer-Encoding", "chunked")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+
+	if err := cmd.Start(); err != nil {
+		failure = err
+		progressW.Close()
+		log.Error().Err(err).Msg("failed to start ffmpeg")
+		apierror.Respond(c, http.StatusInternalServerError, "transcoding failed to start")
+		return
+	}
+	progressW.Close()
+	defer metrics.TrackTranscode("stream")()
+	go s.trackProgress(progressR, sess.ID, seekTime, enc)
+
+	err = cmd.Wait()
+	if err != nil {
+		if !strings.Contains(stderrBuf.String(), "Broken pipe") &&
+			!strings.Contains(err.Error(), "signal: killed") {
+			failure = err
+			s.transcodeFailed(sess, "stream", err, stderrBuf.String())
+		}
+	}
+}
+
+// h264Args re-encode the video to H.264, which every player decodes.
+var h264Args = []string{
+	"-c:v", "libx264",
+	"-preset", "veryfast",
+	"-crf", "23",
+	"-pix_fmt", "yuv420p",
+}
+
+// Caps on transcoded video. libx264 must keep up with playback on the CPU,
+// all the more after decoding HEVC or AV1 above 1080p, which takes much of
+// it alone.
+const (
+	swMaxHeight      = 1080
+	swMaxRate        = 8000 // kb/s
+	swHeavyMaxHeight = 720
+	swHeavyMaxRate   = 4000
+	hwMaxRate        = 12000
+)
+
+// videoArgs returns the FFmpeg video options for a session by its rung of
+// the transcoding ladder (models.VideoCopy etc.). The session's transcode
+// options replace the ladder's caps.
+func videoArgs(sess *torrent.Session) []string {
+	switch sess.VideoMode {
+	case models.VideoHWTranscode:
+		if enc := ffmpeg.HWEncoder(); enc != nil {
+			return hwVideoArgs(sess, enc)
+		}
+		return swVideoArgs(sess)
+	case models.VideoSWTranscode:
+		return swVideoArgs(sess)
+	}
+	return []string{"-c:v", "copy"}
+}
+
+// swVideoArgs re-encode video to H.264 with libx264, scaled down and with
+// the bitrate capped so it keeps up with playback.
+func swVideoArgs(sess *torrent.Session) []string {
+	height, rate := swMaxHeight, swMaxRate
+	if (sess.VideoCodec == "hevc" || sess.VideoCodec == "av1") && sess.VideoHeight > swMaxHeight {
+		height, rate = swHeavyMaxHeight, swHeavyMaxRate
+	}
+	opts := sess.Transcode()
+	if opts.MaxHeight > 0 {
+		height = opts.MaxHeight
+	}
+	if opts.MaxBitrate > 0 {
+		rate = opts.MaxBitrate
+	}
+	filters := []string{scaleFilter(height)}
+	if sess.ToneMaps() {
+		filters = append(filters, toneMapFilter)
+	}
+	args := append([]string{"-vf", strings.Join(filters, ",")}, h264Args...)
+	return append(args, bitrateArgs(rate)...)
+}
+
+// hwVideoArgs re-encode video to H.264 with a hardware encoder, at the
+// source resolution unless the session has a target.
+func hwVideoArgs(sess *torrent.Session, enc *ffmpeg.Encoder) []string {
+	opts := sess.Transcode()
+	var filters []string
+	if opts.MaxHeight > 0 {
+		filters = append(filters, scaleFilter(opts.MaxHeight))
+	}
+	upload := enc.Filter
+	if sess.ToneMaps() {
+		if enc.ToneMap != "" && ffmpeg.HWToneMap() {
+			upload = enc.ToneMap
+		} else {
+			filters = append(filters, toneMapFilter)
+		}
+	}
+	if upload != "" {
+		filters = append(filters, upload)
+	}
+	var args []string
+	if len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
+	}
+	args = append(args, "-c:v", enc.Name)
+	args = append(args, enc.Args...)
+	rate := hwMaxRate
+	if opts.MaxBitrate > 0 {
+		rate = opts.MaxBitrate
+	}
+	return append(args, bitrateArgs(rate)...)
+}
+
+// toneMapFilter converts HDR video to SDR: linear light, Hable's curve,
+// then BT.709 in 8 bits.
+const toneMapFilter = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709,tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+
+// scaleFilter scales video down to height, keeping the aspect ratio, if
+// it's taller.
+func scaleFilter(height int) string {
+	return fmt.Sprintf("scale=-2:'min(%d,ih)'", height)
+}
+
+// bitrateArgs cap the video bitrate at rate kb/s.
+func bitrateArgs(rate int) []string {
+	return []string{"-maxrate", fmt.Sprintf("%dk", rate), "-bufsize", fmt.Sprintf("%dk", 2*rate)}
+}
+
+// aacArgs convert audio to AAC, which every player decodes.
+var aacArgs = []string{"-c:a", "aac", "-b:a", "192k"}
+
+// audioArgs returns the FFmpeg audio options for a session's audio track
+// (allAudioTracks for all): a copy if its player decodes the codec and it
+// needs no downmixing, otherwise AAC.
+func audioArgs(sess *torrent.Session, audioTrack int) []string {
+	if sess.CopiesAudio(audioTrack) {
+		return []string{"-c:a", "copy"}
+	}
+	return append(slices.Clone(aacArgs), downmixArgs(sess, audioTrack)...)
+}
+
+// downmixArgs downmix converted audio to the session's channel limit if
+// the track (allAudioTracks for any; negative for the default) has more
+// channels.
+func downmixArgs(sess *torrent.Session, audioTrack int) []string {
+	most := sess.Transcode().AudioChannels
+	if most <= 0 {
+		return nil
+	}
+	for i, t := range sess.AudioTracks {
+		if (audioTrack == allAudioTracks || i == max(audioTrack, 0)) && t.Channels > most {
+			return []string{"-ac", strconv.Itoa(most)}
+		}
+	}
+	return nil
+}
+
+// transcodeArgs returns the FFmpeg arguments remuxing input to fragmented MP4
+// on stdout. Video is copied and audio converted to AAC unless video and
+// audio give other options.
+func transcodeArgs(input string, seek []string, audioTrack int, video, audio []string) []string {
+	if video == nil {
+		video = []string{"-c:v", "copy"}
+	}
+	if audio == nil {
+		audio = aacArgs
+	}
+	args := append(seek, "-i", input)
+	switch {
+	case audioTrack == allAudioTracks:
+		args = append(args, "-map", "0:v:0", "-map", "0:a")
+	case audioTrack >= 0:
+		args = append(args, "-map", "0:v:0", "-map", fmt.Sprintf("0:a:%d", audioTrack))
+	}
+	args = append(args, video...)
+	args = append(args, audio...)
+	return append(args,
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4",
+		"-y",
+		"pipe:1",
+	)
+}
+
+// openInput returns the FFmpeg input for a session and the input options that
+// seek to seekTime. Direct-source sessions let FFmpeg read (and seek) the URL
+// itself; torrent sessions feed a fresh reader, positioned near seekTime,
+// through stdin ("pipe:0"). Matroska files start at the keyframe before
+// seekTime (see keyframes.go), other files at a position estimated from the
+// bitrate.
+func (s *Server) openInput(ctx context.Context, sess *torrent.Session, seekTime float64) (string, io.ReadCloser, []string, error) {
+	if d := sess.Direct(); d != nil {
+		return d.URL, nil, seekArgs(seekTime, false), nil
+	}
+	if seekTime > 0 && sess.Duration > 0 && isMatroska(sess.FilePath) && ffmpeg.Supports(ffmpeg.Probe) {
+		header, pos, err := s.keyframeSeek(ctx, sess, seekTime)
+		if err == nil {
+			r, err := sess.NewReaderAt(pos)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			// Cluster timestamps are absolute, so -ss is too.
+			return "pipe:0", newPrefixedReader(header, r), seekArgs(seekTime, true), nil
+		}
+		log.Debug().Err(err).Str("session_id", sess.ID).Float64("seek", seekTime).Msg("keyframe seek failed, estimating position")
+	}
 	if seekTime > 0 && sess.Duration > 0 {
 		// Approximate byte position based on time ratio
 		ratio := seekTime / sess.Duration
@@ -78,58 +586,77 @@ func (s *Server) serveTranscoded(c *gin.Context, sess *torrent.Session, seekTime
 		}
 		r, err := sess.NewReaderAt(bytePos)
 		if err != nil {
-			log.Error().Err(err).Float64("seek", seekTime).Msg("failed to seek reader")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "seek failed"})
-			return
+			return "", nil, nil, err
 		}
-		defer r.Close()
-		reader = r
-	} else {
-		r := sess.NewReader()
-		defer r.Close()
-		reader = r
+		return "pipe:0", r, seekArgs(seekTime, false), nil
 	}
+	return "pipe:0", sess.NewReader(), seekArgs(seekTime, false), nil
+}
 
-	args := []string{}
-	if seekTime > 0 {
-		args = append(args, "-ss", strconv.FormatFloat(seekTime, 'f', 3, 64))
+// seekArgs returns the FFmpeg input options seeking to seekTime. Unless
+// absolute, the time is relative to the first timestamp of the input.
+func seekArgs(seekTime float64, absolute bool) []string {
+	if seekTime <= 0 {
+		return nil
 	}
-	args = append(args, "-i", "pipe:0")
-	if audioTrack >= 0 {
-		args = append(args, "-map", "0:v:0", "-map", fmt.Sprintf("0:a:%d", audioTrack))
+	args := []string{"-ss", strconv.FormatFloat(seekTime, 'f', 3, 64)}
+	if absolute {
+		args = append([]string{"-seek_timestamp", "1"}, args...)
 	}
-	args = append(args,
-		"-c:v", "copy",
-		"-c:a", "aac",
-		"-b:a", "192k",
-		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
-		"-f", "mp4",
-		"-y",
-		"pipe:1",
-	)
+	return args
+}
 
-	cmd := exec.Command("ffmpeg", args...)
-	cmd.Stdin = reader
-	cmd.Stdout = c.Writer
+// watch counts the request as one of a client watching sess (see
+// torrent.Session.Watch) and answers 409 if the session plays on another
+// client. ?takeover=1 moves a single-player session to the requesting
+// client instead. The request's context then ends when another client takes
+// the session over; done must be called when the request ends.
+func (s *Server) watch(c *gin.Context, sess *torrent.Session) (done func(), ok bool) {
+	ctx, done, err := sess.Watch(c.Request.Context(), c.ClientIP(), c.Request.UserAgent(), c.Query("takeover") == "1")
+	if err != nil {
+		apierror.Write(c, apierror.New(http.StatusConflict, "session in use").WithCode(apierror.CodeInUse).WithDetails(err.Error()))
+		return nil, false
+	}
+	c.Request = c.Request.WithContext(ctx)
+	return done, true
+}
 
-	var stderrBuf strings.Builder
-	cmd.Stderr = &stderrBuf
+// contextReader reads session data with a request's context, so the
+// response ends with the request even while waiting for pieces.
+type contextReader struct {
+	atorrent.Reader
+	ctx context.Context
+}
 
-	c.Writer.Header().Set("Content-Type", "video/mp4")
-	c.Writer.Header().Set("Transfer-Encoding", "chunked")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
+func (r contextReader) Read(p []byte) (int, error) {
+	return r.Reader.ReadContext(r.ctx, p)
+}
 
-	if err := cmd.Start(); err != nil {
-		log.Error().Err(err).Msg("failed to start ffmpeg")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "transcoding failed to start"})
+// proxyDirect relays a direct-source HTTP stream, forwarding Range requests so
+// the browser can seek natively.
+func (s *Server) proxyDirect(c *gin.Context, streamURL string) {
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, streamURL, nil)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "invalid stream url")
 		return
 	}
+	if rng := c.GetHeader("Range"); rng != "" {
+		req.Header.Set("Range", rng)
+	}
 
-	err := cmd.Wait()
+	resp, err := s.proxy.Do(req)
 	if err != nil {
-		if !strings.Contains(stderrBuf.String(), "Broken pipe") &&
-			!strings.Contains(err.Error(), "signal: killed") {
-			log.Warn().Err(err).Str("stderr", stderrBuf.String()).Msg("ffmpeg exited with error")
+		log.Warn().Err(err).Msg("direct stream request failed")
+		apierror.Respond(c, http.StatusBadGateway, "upstream stream unavailable")
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag"} {
+		if v := resp.Header.Get(h); v != "" {
+			c.Writer.Header().Set(h, v)
 		}
 	}
+	c.Status(resp.StatusCode)
+	io.Copy(c.Writer, resp.Body)
 }
@@ -0,0 +1,238 @@
+package stream
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/metrics"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+const (
+	// skipIntroWindow is how far into an episode an intro is looked for.
+	skipIntroWindow = 600.0
+	// An intro lasts between skipIntroMin and skipIntroMax seconds.
+	skipIntroMin = 15.0
+	skipIntroMax = 120.0
+	// skipCreditsWindow is how far before the end credits are looked for.
+	skipCreditsWindow = 180.0
+	// skipCreditsMin is the shortest stretch taken for credits.
+	skipCreditsMin = 10.0
+	// skipPoll is how often an analysis waiting for data checks again.
+	skipPoll = 30 * time.Second
+)
+
+var (
+	blackDetectRe  = regexp.MustCompile(`black_start:\s*([\d.]+)\s+black_end:\s*([\d.]+)`)
+	silenceStartRe = regexp.MustCompile(`silence_start:\s*(-?[\d.]+)`)
+	silenceEndRe   = regexp.MustCompile(`silence_end:\s*([\d.]+)`)
+)
+
+// detectSkipMarkers starts looking for the intro and credits of an episode
+// session whose chapters don't name them, unless already running. The
+// analysis waits until the beginning and end of the file are downloaded, so
+// it never competes with playback.
+func (s *Server) detectSkipMarkers(sess *torrent.Session) {
+	if sess.Direct() != nil || sess.Season == 0 || sess.Episode == 0 || !ffmpeg.Supports(ffmpeg.SkipDetection) {
+		return
+	}
+	if need, probed := s.manager.NeedsSkipDetection(sess.ID); probed && !need {
+		return
+	}
+
+	s.skipJobsMu.Lock()
+	defer s.skipJobsMu.Unlock()
+	if s.skipJobs[sess.ID] {
+		return
+	}
+	s.skipJobs[sess.ID] = true
+	go s.runSkipDetection(sess)
+}
+
+func (s *Server) runSkipDetection(sess *torrent.Session) {
+	defer func() {
+		s.skipJobsMu.Lock()
+		delete(s.skipJobs, sess.ID)
+		s.skipJobsMu.Unlock()
+	}()
+
+	ticker := time.NewTicker(skipPoll)
+	defer ticker.Stop()
+
+	// The intro is published as soon as it is found; the markers are only
+	// stored once the credits have been looked for too.
+	var (
+		markers   []models.SkipMarker
+		introDone bool
+	)
+	for {
+		need, probed := s.manager.NeedsSkipDetection(sess.ID)
+		// Probing fills these in, so read them under the manager's lock.
+		info, ok := s.manager.Snapshot(sess.ID)
+		if !ok || (probed && (!need || info.Duration <= 0)) {
+			return
+		}
+		if probed && !introDone && sess.RangeComplete(0, skipBytes(info, skipIntroWindow)) {
+			intro, ok, err := s.detectIntro(sess, info.Duration)
+			if err != nil {
+				log.Warn().Err(err).Str("session_id", sess.ID).Msg("intro detection failed")
+				return
+			}
+			if ok {
+				markers = append(markers, intro)
+				s.manager.SetSkipMarkers(sess.ID, markers, false)
+			}
+			introDone = true
+		}
+		creditsStart := math.Max(info.Duration-skipCreditsWindow, 0)
+		if introDone && sess.RangeComplete(skipOffset(info, creditsStart), info.FileSize) {
+			credits, ok, err := s.detectCredits(sess, info.Duration)
+			if err != nil {
+				log.Warn().Err(err).Str("session_id", sess.ID).Msg("credits detection failed")
+				return
+			}
+			if ok {
+				markers = append(markers, credits)
+			}
+			s.manager.SetSkipMarkers(sess.ID, markers, true)
+			log.Info().Str("session_id", sess.ID).Int("markers", len(markers)).Msg("detected skip markers")
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+		if !s.manager.Active(sess.ID) {
+			return
+		}
+	}
+}
+
+// skipOffset estimates the byte offset of a time from the average bitrate,
+// backed off by a margin.
+func skipOffset(info models.StreamSession, t float64) int64 {
+	return max(int64(t/info.Duration*float64(info.FileSize))-trickplayMargin, 0)
+}
+
+// skipBytes estimates the number of bytes from the start of the file to past
+// time t.
+func skipBytes(info models.StreamSession, t float64) int64 {
+	return min(int64(t/info.Duration*float64(info.FileSize))+trickplayMargin, info.FileSize)
+}
+
+// detectIntro looks for the intro as the first stretch of the right length
+// between two scene breaks near the start of the episode, which lasts
+// duration seconds.
+func (s *Server) detectIntro(sess *torrent.Session, duration float64) (models.SkipMarker, bool, error) {
+	window := math.Min(skipIntroWindow, duration)
+	breaks, err := s.sceneBreaks(sess, 0, window)
+	if err != nil {
+		return models.SkipMarker{}, false, err
+	}
+	breaks = append([]float64{0}, breaks...)
+	for i := 1; i < len(breaks); i++ {
+		if d := breaks[i] - breaks[i-1]; d >= skipIntroMin && d <= skipIntroMax {
+			return models.SkipMarker{Type: "intro", Start: breaks[i-1], End: breaks[i], Source: "detected"}, true, nil
+		}
+	}
+	return models.SkipMarker{}, false, nil
+}
+
+// detectCredits takes the credits to start at the first scene break of the
+// last minutes of the episode, which lasts duration seconds.
+func (s *Server) detectCredits(sess *torrent.Session, duration float64) (models.SkipMarker, bool, error) {
+	start := math.Max(duration-skipCreditsWindow, 0)
+	breaks, err := s.sceneBreaks(sess, start, duration-start)
+	if err != nil {
+		return models.SkipMarker{}, false, err
+	}
+	for _, b := range breaks {
+		if duration-b >= skipCreditsMin {
+			return models.SkipMarker{Type: "credits", Start: b, End: duration, Source: "detected"}, true, nil
+		}
+	}
+	return models.SkipMarker{}, false, nil
+}
+
+// sceneBreaks returns the times, in order, within [start, start+length) where
+// the picture goes black while the sound goes quiet, as between an episode's
+// intro or credits and the episode itself.
+func (s *Server) sceneBreaks(sess *torrent.Session, start, length float64) ([]float64, error) {
+	input, reader, seek, err := s.openInput(s.ctx, sess, start)
+	if err != nil {
+		return nil, fmt.Errorf("open input: %w", err)
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+
+	args := append([]string{"-nostats", "-hide_banner"}, seek...)
+	args = append(args,
+		"-i", input,
+		"-t", strconv.FormatFloat(length, 'f', 3, 64),
+		"-vf", "scale=320:-2,blackdetect=d=0.3:pix_th=0.10",
+		"-af", "silencedetect=noise=-45dB:d=0.3",
+		"-f", "null",
+		"-",
+	)
+	cmd := exec.CommandContext(s.ctx, "ffmpeg", args...)
+	if reader != nil {
+		cmd.Stdin = reader
+	}
+	var stderrBuf strings.Builder
+	cmd.Stderr = &stderrBuf
+
+	transcodeDone := metrics.TrackTranscode("skip")
+	err = cmd.Run()
+	transcodeDone()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, lastLine(stderrBuf.String()))
+	}
+
+	// Filter times start at zero with input seeking.
+	var breaks []float64
+	black, silence := parseDetectLog(stderrBuf.String())
+	for _, b := range black {
+		for _, q := range silence {
+			if b[0] < q[1] && q[0] < b[1] {
+				breaks = append(breaks, start+(b[0]+b[1])/2)
+				break
+			}
+		}
+	}
+	sort.Float64s(breaks)
+	return breaks, nil
+}
+
+// parseDetectLog returns the black and silent intervals logged by FFmpeg's
+// blackdetect and silencedetect filters. Silence still running at the end
+// of the input has no end and is left out.
+func parseDetectLog(out string) (black, silence [][2]float64) {
+	silenceStart := -1.0
+	for _, line := range strings.Split(out, "\n") {
+		if m := blackDetectRe.FindStringSubmatch(line); m != nil {
+			from, _ := strconv.ParseFloat(m[1], 64)
+			to, _ := strconv.ParseFloat(m[2], 64)
+			black = append(black, [2]float64{from, to})
+		} else if m := silenceStartRe.FindStringSubmatch(line); m != nil {
+			silenceStart, _ = strconv.ParseFloat(m[1], 64)
+			silenceStart = math.Max(silenceStart, 0)
+		} else if m := silenceEndRe.FindStringSubmatch(line); m != nil && silenceStart >= 0 {
+			to, _ := strconv.ParseFloat(m[1], 64)
+			silence = append(silence, [2]float64{silenceStart, to})
+			silenceStart = -1
+		}
+	}
+	return black, silence
+}
@@ -0,0 +1,160 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/metrics"
+	"github.com/streambox/backend/internal/subtitle"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+// subtitleCacheTTL is how long an extracted track is kept after last use.
+const subtitleCacheTTL = 6 * time.Hour
+
+// subtitleEntry is a cached (or in-progress) subtitle extraction.
+type subtitleEntry struct {
+	done     chan struct{}
+	data     []byte
+	err      error
+	lastUsed time.Time
+}
+
+// ServeSubtitle extracts an embedded text subtitle track (FFmpeg 0:s:track)
+// as WebVTT. Extraction reads the whole file, since subtitles are
+// interleaved with the video, so results are cached per session and track.
+// Cues are shifted by ?offset_ms=, or else by the session's stored offset.
+func (s *Server) ServeSubtitle(c *gin.Context, sessionID string, track int) {
+	sess := s.manager.GetSession(sessionID)
+	if sess == nil {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+	if featureUnavailable(c, ffmpeg.SubtitleExtraction) {
+		return
+	}
+
+	data, err := s.embeddedSubtitle(c.Request.Context(), sess, track)
+	if err != nil {
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, "failed to extract subtitles", err.Error())
+		return
+	}
+
+	offset := sess.SubtitleOffset
+	if o, err := strconv.ParseInt(c.Query("offset_ms"), 10, 64); err == nil {
+		offset = o
+	}
+	c.Data(http.StatusOK, "text/vtt", subtitle.ShiftVTT(data, offset))
+}
+
+// embeddedSubtitle returns an embedded text track as WebVTT, extracting it
+// unless it is cached.
+func (s *Server) embeddedSubtitle(ctx context.Context, sess *torrent.Session, track int) ([]byte, error) {
+	key := fmt.Sprintf("%s:%d", sess.ID, track)
+
+	s.subsMu.Lock()
+	entry := s.subs[key]
+	if entry == nil {
+		entry = &subtitleEntry{done: make(chan struct{})}
+		s.subs[key] = entry
+		go s.extractSubtitle(sess, track, entry)
+	}
+	entry.lastUsed = time.Now()
+	s.subsMu.Unlock()
+
+	select {
+	case <-entry.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if entry.err != nil {
+		// Drop failures so the next request retries.
+		s.subsMu.Lock()
+		if s.subs[key] == entry {
+			delete(s.subs, key)
+		}
+		s.subsMu.Unlock()
+		return nil, entry.err
+	}
+	return entry.data, nil
+}
+
+func (s *Server) extractSubtitle(sess *torrent.Session, track int, entry *subtitleEntry) {
+	defer close(entry.done)
+
+	input, reader, _, err := s.openInput(s.ctx, sess, 0)
+	if err != nil {
+		entry.err = err
+		return
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+
+	cmd := exec.CommandContext(s.ctx, "ffmpeg",
+		"-nostats",
+		"-i", input,
+		"-map", fmt.Sprintf("0:s:%d", track),
+		"-f", "webvtt",
+		"pipe:1",
+	)
+	if reader != nil {
+		cmd.Stdin = reader
+	}
+	var stdout bytes.Buffer
+	var stderrBuf strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderrBuf
+
+	start := time.Now()
+	transcodeDone := metrics.TrackTranscode("subtitles")
+	err = cmd.Run()
+	transcodeDone()
+	if err != nil {
+		log.Warn().Err(err).Str("stderr", stderrBuf.String()).Int("track", track).Msg("subtitle extraction failed")
+		entry.err = fmt.Errorf("ffmpeg: %w", err)
+		return
+	}
+	entry.data = stdout.Bytes()
+
+	log.Info().
+		Str("session_id", sess.ID).
+		Int("track", track).
+		Int("bytes", len(entry.data)).
+		Dur("took", time.Since(start)).
+		Msg("extracted embedded subtitles")
+}
+
+// reapSubtitles drops cached tracks that haven't been requested recently.
+func (s *Server) reapSubtitles() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.subsMu.Lock()
+		for key, entry := range s.subs {
+			select {
+			case <-entry.done:
+				if time.Since(entry.lastUsed) > subtitleCacheTTL {
+					delete(s.subs, key)
+				}
+			default: // still extracting
+			}
+		}
+		s.subsMu.Unlock()
+	}
+}
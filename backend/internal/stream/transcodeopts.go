@@ -0,0 +1,60 @@
+package stream
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+// applyTranscodeQuery sets a session's transcode options from the request:
+// ?resolution= is the target height (720 or 720p), ?max_bitrate= caps the
+// video in kb/s, ?audio_channels= downmixes (2 for stereo) and ?tonemap=1
+// converts HDR video to SDR. Options not given are kept; 0 unsets one. It
+// answers 400 and reports false if a value is invalid.
+func (s *Server) applyTranscodeQuery(c *gin.Context, sess *torrent.Session) bool {
+	opts := sess.TranscodeOptions
+	changed := false
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{
+		{"resolution", &opts.MaxHeight},
+		{"max_bitrate", &opts.MaxBitrate},
+		{"audio_channels", &opts.AudioChannels},
+	} {
+		v, ok := c.GetQuery(p.name)
+		if !ok {
+			continue
+		}
+		if p.name == "resolution" {
+			v = strings.TrimSuffix(strings.ToLower(v), "p")
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			apierror.Respond(c, http.StatusBadRequest, "invalid "+p.name)
+			return false
+		}
+		*p.dst = n
+		changed = true
+	}
+	if v, ok := c.GetQuery("tonemap"); ok {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "invalid tonemap")
+			return false
+		}
+		opts.ToneMap = on
+		changed = true
+	}
+	if changed && opts != sess.TranscodeOptions {
+		if _, err := s.manager.SetTranscodeOptions(sess.ID, opts); err != nil {
+			apierror.Respond(c, http.StatusNotFound, "session not found")
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,304 @@
+package stream
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/apierror"
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/metrics"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+const (
+	// trickplayInterval is the number of seconds between thumbnails.
+	trickplayInterval = 10
+	// Thumbnails are tiled into sprite sheets of this many columns and rows.
+	trickplayColumns = 10
+	trickplayRows    = 10
+	trickplayWidth   = 160
+	trickplayHeight  = 90
+	// trickplaySheetSeconds is the stretch of video one sheet covers.
+	trickplaySheetSeconds = trickplayInterval * trickplayColumns * trickplayRows
+	// trickplayMargin is added around a sheet's estimated byte range, since
+	// the estimate assumes a constant bitrate.
+	trickplayMargin = 4 << 20
+	// trickplayPoll is how often newly downloaded stretches are checked for.
+	trickplayPoll = 30 * time.Second
+	// trickplayIdleTimeout stops generation and deletes the sheets once
+	// thumbnails haven't been requested for this long.
+	trickplayIdleTimeout = 30 * time.Minute
+
+	trickplayVTTFile = "thumbnails.vtt"
+)
+
+// trickplay generates a session's thumbnail sprite sheets in the background.
+// A sheet is made once the pieces of its stretch of video are downloaded, so
+// generation never competes with playback for bandwidth.
+type trickplay struct {
+	dir    string
+	sheets int // sheets the title needs
+
+	mu       sync.Mutex
+	ready    map[int]bool // generated sheets
+	failed   map[int]bool // sheets FFmpeg couldn't make; not retried
+	lastUsed time.Time
+	stopped  bool
+}
+
+func sheetName(n int) string {
+	return fmt.Sprintf("sprite-%03d.jpg", n)
+}
+
+func (tp *trickplay) touch() {
+	tp.mu.Lock()
+	tp.lastUsed = time.Now()
+	tp.mu.Unlock()
+}
+
+// vtt returns the WebVTT thumbnail track of the generated sheets. Stretches
+// without a sheet yet have no cues; clients re-fetch the track for more.
+func (tp *trickplay) vtt(duration float64) string {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	perSheet := trickplayColumns * trickplayRows
+	for n := 0; n < tp.sheets; n++ {
+		if !tp.ready[n] {
+			continue
+		}
+		for i := 0; i < perSheet; i++ {
+			start := float64((n*perSheet + i) * trickplayInterval)
+			if start >= duration {
+				break
+			}
+			end := math.Min(start+trickplayInterval, duration)
+			x, y := (i%trickplayColumns)*trickplayWidth, (i/trickplayColumns)*trickplayHeight
+			fmt.Fprintf(&b, "\n%s --> %s\nthumbnails/%s#xywh=%d,%d,%d,%d\n",
+				vttTimestamp(start), vttTimestamp(end), sheetName(n), x, y, trickplayWidth, trickplayHeight)
+		}
+	}
+	return b.String()
+}
+
+func vttTimestamp(secs float64) string {
+	ms := int64(math.Round(secs * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// ServeThumbnails serves a session's thumbnail track (thumbnails.vtt) or one
+// of its sprite sheets, starting generation on first use. Only torrent
+// sessions with a known duration have thumbnails.
+func (s *Server) ServeThumbnails(c *gin.Context, sessionID, file string) {
+	sess := s.manager.GetSession(sessionID)
+	if sess == nil {
+		apierror.Respond(c, http.StatusNotFound, "session not found")
+		return
+	}
+	if sess.Direct() != nil || sess.Duration <= 0 {
+		apierror.Respond(c, http.StatusNotFound, "thumbnails unavailable for this session")
+		return
+	}
+	if featureUnavailable(c, ffmpeg.Thumbnails) {
+		return
+	}
+
+	tp, err := s.trickplayFor(sess)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "failed to start thumbnails", err.Error())
+		return
+	}
+
+	if file == trickplayVTTFile {
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusOK, "text/vtt", []byte(tp.vtt(sess.Duration)))
+		return
+	}
+
+	var n int
+	if _, err := fmt.Sscanf(file, "sprite-%d.jpg", &n); err != nil {
+		apierror.Respond(c, http.StatusNotFound, "unknown thumbnail file")
+		return
+	}
+	tp.mu.Lock()
+	ready := tp.ready[n]
+	tp.mu.Unlock()
+	if !ready {
+		apierror.Respond(c, http.StatusNotFound, "thumbnails not generated yet")
+		return
+	}
+	c.Header("Content-Type", "image/jpeg")
+	c.File(filepath.Join(tp.dir, sheetName(n)))
+}
+
+func (s *Server) trickplayFor(sess *torrent.Session) (*trickplay, error) {
+	s.trickplaysMu.Lock()
+	defer s.trickplaysMu.Unlock()
+
+	if tp := s.trickplays[sess.ID]; tp != nil {
+		tp.touch()
+		return tp, nil
+	}
+
+	dir, err := os.MkdirTemp("", "streambox-trickplay-")
+	if err != nil {
+		return nil, fmt.Errorf("create thumbnail dir: %w", err)
+	}
+	tp := &trickplay{
+		dir:      dir,
+		sheets:   int(math.Ceil(sess.Duration / trickplaySheetSeconds)),
+		ready:    make(map[int]bool),
+		failed:   make(map[int]bool),
+		lastUsed: time.Now(),
+	}
+	s.trickplays[sess.ID] = tp
+	go s.generateTrickplay(sess, tp)
+	return tp, nil
+}
+
+// generateTrickplay makes sheets as their stretches finish downloading,
+// until all are made, the session ends or thumbnails go unused.
+func (s *Server) generateTrickplay(sess *torrent.Session, tp *trickplay) {
+	ticker := time.NewTicker(trickplayPoll)
+	defer ticker.Stop()
+
+	for {
+		pending := 0
+		for n := 0; n < tp.sheets; n++ {
+			tp.mu.Lock()
+			skip := tp.ready[n] || tp.failed[n] || tp.stopped
+			tp.mu.Unlock()
+			if skip {
+				continue
+			}
+			pending++
+			if !sheetDownloaded(sess, n) {
+				continue
+			}
+
+			err := s.makeSheet(sess, tp, n)
+			tp.mu.Lock()
+			if err != nil {
+				tp.failed[n] = true
+			} else {
+				tp.ready[n] = true
+			}
+			tp.mu.Unlock()
+			if err != nil {
+				log.Warn().Err(err).Str("session_id", sess.ID).Int("sheet", n).Msg("thumbnail sheet failed")
+			}
+		}
+
+		tp.mu.Lock()
+		stopped := tp.stopped
+		tp.mu.Unlock()
+		if pending == 0 || stopped {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+		if !s.manager.Active(sess.ID) {
+			return
+		}
+	}
+}
+
+// sheetDownloaded reports whether the bytes of a sheet's stretch of video,
+// estimated from the average bitrate, are downloaded.
+func sheetDownloaded(sess *torrent.Session, n int) bool {
+	start := float64(n * trickplaySheetSeconds)
+	end := math.Min(start+trickplaySheetSeconds, sess.Duration)
+	from := int64(start/sess.Duration*float64(sess.FileSize)) - trickplayMargin
+	to := int64(end/sess.Duration*float64(sess.FileSize)) + trickplayMargin
+	from, to = max(from, 0), min(to, sess.FileSize)
+	// The container header is needed to read any part of the file.
+	return sess.RangeComplete(0, trickplayMargin) && sess.RangeComplete(from, to-from)
+}
+
+// makeSheet tiles the thumbnails of sheet n into one JPEG. Only keyframes
+// are decoded, which keeps this cheap.
+func (s *Server) makeSheet(sess *torrent.Session, tp *trickplay, n int) error {
+	start := float64(n * trickplaySheetSeconds)
+	input, reader, seek, err := s.openInput(s.ctx, sess, start)
+	if err != nil {
+		return fmt.Errorf("open input: %w", err)
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+
+	filter := fmt.Sprintf("fps=1/%d,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+		trickplayInterval, trickplayWidth, trickplayHeight, trickplayWidth, trickplayHeight, trickplayColumns, trickplayRows)
+	args := []string{"-nostats", "-skip_frame", "nokey"}
+	args = append(args, seek...)
+	args = append(args,
+		"-i", input,
+		"-t", strconv.Itoa(trickplaySheetSeconds),
+		"-an", "-sn",
+		"-vf", filter,
+		"-frames:v", "1",
+		"-q:v", "5",
+		"-y",
+		filepath.Join(tp.dir, sheetName(n)),
+	)
+
+	cmd := exec.CommandContext(s.ctx, "ffmpeg", args...)
+	if reader != nil {
+		cmd.Stdin = reader
+	}
+	var stderrBuf strings.Builder
+	cmd.Stderr = &stderrBuf
+
+	transcodeDone := metrics.TrackTranscode("trickplay")
+	err = cmd.Run()
+	transcodeDone()
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, lastLine(stderrBuf.String()))
+	}
+	return nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	return s[strings.LastIndex(s, "\n")+1:]
+}
+
+// reapTrickplay stops thumbnail generation nobody has used for a while and
+// deletes the sheets.
+func (s *Server) reapTrickplay() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.trickplaysMu.Lock()
+		for id, tp := range s.trickplays {
+			tp.mu.Lock()
+			idle := time.Since(tp.lastUsed) > trickplayIdleTimeout
+			if idle {
+				tp.stopped = true
+			}
+			tp.mu.Unlock()
+			if idle {
+				delete(s.trickplays, id)
+				os.RemoveAll(tp.dir)
+			}
+		}
+		s.trickplaysMu.Unlock()
+	}
+}
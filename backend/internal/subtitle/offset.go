@@ -0,0 +1,42 @@
+package subtitle
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// vttTimestamp matches WebVTT cue timestamps: [hh:]mm:ss.ttt
+var vttTimestamp = regexp.MustCompile(`(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})`)
+
+// ShiftVTT moves every cue in a WebVTT document by offsetMs milliseconds
+// (positive delays the subtitles). Times that would go negative are clamped
+// to zero.
+func ShiftVTT(vtt []byte, offsetMs int64) []byte {
+	if offsetMs == 0 {
+		return vtt
+	}
+
+	lines := bytes.Split(vtt, []byte("\n"))
+	for i, line := range lines {
+		if !bytes.Contains(line, []byte("-->")) {
+			continue
+		}
+		lines[i] = vttTimestamp.ReplaceAllFunc(line, func(ts []byte) []byte {
+			m := vttTimestamp.FindSubmatch(ts)
+			h, _ := strconv.ParseInt(string(m[1]), 10, 64) // empty when hours are omitted
+			min, _ := strconv.ParseInt(string(m[2]), 10, 64)
+			sec, _ := strconv.ParseInt(string(m[3]), 10, 64)
+			ms, _ := strconv.ParseInt(string(m[4]), 10, 64)
+
+			total := ((h*60+min)*60+sec)*1000 + ms + offsetMs
+			if total < 0 {
+				total = 0
+			}
+			return []byte(fmt.Sprintf("%02d:%02d:%02d.%03d",
+				total/3600000, total/60000%60, total/1000%60, total%1000))
+		})
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
@@ -2,42 +2,64 @@ package subtitle
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"time"
 
+	"github.com/streambox/backend/internal/httpclient"
 	"github.com/streambox/backend/internal/models"
 )
 
-const defaultBaseURL = "https://api.opensubtitles.com/api/v1"
+const (
+	openSubtitlesName = "opensubtitles"
+	defaultBaseURL    = "https://api.opensubtitles.com/api/v1"
+)
 
 // Client communicates with the OpenSubtitles REST API v1 to search and
 // download subtitles.
 type Client struct {
 	apiKey  string
-	http    *http.Client
+	http    *httpclient.Client
 	baseURL string
 }
 
 // NewClient creates an OpenSubtitles client authenticated with the given API key.
-func NewClient(apiKey string) *Client {
+func NewClient(apiKey string, opts httpclient.Options) *Client {
+	if opts.Timeout == 0 {
+		opts.Timeout = 15 * time.Second
+	}
 	return &Client{
-		apiKey: apiKey,
-		http: &http.Client{
-			Timeout: 15 * time.Second,
-		},
+		apiKey:  apiKey,
+		http:    httpclient.New(opts),
 		baseURL: defaultBaseURL,
 	}
 }
 
-// Search finds subtitles for the given IMDb ID and language code (e.g. "en", "ru").
-func (c *Client) Search(imdbID string, lang string) ([]models.SubtitleResult, error) {
-	reqURL := fmt.Sprintf("%s/subtitles?imdb_id=%s&languages=%s", c.baseURL, imdbID, lang)
+func (c *Client) Name() string {
+	return openSubtitlesName
+}
+
+// Search finds subtitles by IMDb ID and language code (e.g. "en", "ru"). If
+// q.MovieHash (see torrent.Manager.MovieHash) is set, subtitles made for that
+// exact release are flagged and listed first; q.IMDbID may then be empty.
+func (c *Client) Search(ctx context.Context, q Query) ([]models.SubtitleResult, error) {
+	params := url.Values{"languages": {q.Lang}}
+	if q.IMDbID != "" {
+		params.Set("imdb_id", q.IMDbID)
+	}
+	if q.MovieHash != "" {
+		params.Set("moviehash", q.MovieHash)
+	}
+	// Encode sorts the parameters, which the API expects (it redirects otherwise).
+	reqURL := c.baseURL + "/subtitles?" + params.Encode()
 
-	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("build search request: %w", err)
 	}
@@ -65,26 +87,31 @@ func (c *Client) Search(imdbID string, lang string) ([]models.SubtitleResult, er
 			continue
 		}
 		results = append(results, models.SubtitleResult{
-			FileID:    item.Attributes.Files[0].FileID,
+			ID:        strconv.Itoa(item.Attributes.Files[0].FileID),
 			Language:  item.Attributes.Language,
 			Name:      item.Attributes.Release,
 			Downloads: item.Attributes.DownloadCount,
+			HashMatch: item.Attributes.MovieHashMatch,
 		})
 	}
-
 	return results, nil
 }
 
 // Download fetches a subtitle file by file ID and returns its contents as
 // WebVTT (converted from SRT).
-func (c *Client) Download(fileID int) ([]byte, error) {
+func (c *Client) Download(ctx context.Context, id string) ([]byte, error) {
+	fileID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file id %q", id)
+	}
+
 	// Step 1: Request a download link from the API.
 	body, err := json.Marshal(map[string]int{"file_id": fileID})
 	if err != nil {
 		return nil, fmt.Errorf("marshal download body: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/download", bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/download", bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("build download request: %w", err)
 	}
@@ -111,7 +138,7 @@ func (c *Client) Download(fileID int) ([]byte, error) {
 	}
 
 	// Step 2: Fetch the actual SRT file from the download link.
-	srtResp, err := c.http.Get(dlResp.Link)
+	srtResp, err := c.http.Get(ctx, dlResp.Link)
 	if err != nil {
 		return nil, fmt.Errorf("fetch srt file: %w", err)
 	}
@@ -154,10 +181,11 @@ type osSubtitleItem struct {
 }
 
 type osAttributes struct {
-	Language      string   `json:"language"`
-	Release       string   `json:"release"`
-	DownloadCount int      `json:"download_count"`
-	Files         []osFile `json:"files"`
+	Language       string   `json:"language"`
+	Release        string   `json:"release"`
+	DownloadCount  int      `json:"download_count"`
+	MovieHashMatch bool     `json:"moviehash_match"`
+	Files          []osFile `json:"files"`
 }
 
 type osFile struct {
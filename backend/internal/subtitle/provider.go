@@ -0,0 +1,130 @@
+package subtitle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// Query describes a subtitle search. Providers use whichever fields they
+// support and return nothing if none apply.
+type Query struct {
+	IMDbID    string
+	Lang      string // ISO 639-1, e.g. "en", "ru"
+	MovieHash string // OpenSubtitles hash of the exact file, if known
+}
+
+// Provider is the interface that subtitle sources must implement. IDs in
+// results are provider-local; the registry namespaces them.
+type Provider interface {
+	Name() string
+	Search(ctx context.Context, q Query) ([]models.SubtitleResult, error)
+	// Download returns the subtitle as WebVTT.
+	Download(ctx context.Context, id string) ([]byte, error)
+}
+
+// Registry holds all registered subtitle providers and searches them
+// concurrently.
+type Registry struct {
+	providers []Provider
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(p Provider) {
+	r.providers = append(r.providers, p)
+}
+
+// Len returns the number of registered providers.
+func (r *Registry) Len() int {
+	return len(r.providers)
+}
+
+// Search queries all providers concurrently and returns the merged results,
+// with duplicates (same language and release) collapsed. Results made for the
+// exact file come first; otherwise provider registration order is kept.
+func (r *Registry) Search(ctx context.Context, q Query) ([]models.SubtitleResult, error) {
+	perProvider := make([][]models.SubtitleResult, len(r.providers))
+	var wg sync.WaitGroup
+
+	for i, p := range r.providers {
+		wg.Add(1)
+		go func(i int, prov Provider) {
+			defer wg.Done()
+			results, err := prov.Search(ctx, q)
+			if err != nil {
+				log.Warn().Err(err).Str("provider", prov.Name()).Msg("subtitle search failed")
+				return
+			}
+			for j := range results {
+				results[j].Provider = prov.Name()
+				results[j].ID = prov.Name() + ":" + results[j].ID
+			}
+			perProvider[i] = results
+		}(i, p)
+	}
+	wg.Wait()
+
+	var merged []models.SubtitleResult
+	seen := make(map[string]int) // dedupe key -> index in merged
+	for _, results := range perProvider {
+		for _, res := range results {
+			key := strings.ToLower(res.Language) + "|" + normalizeRelease(res.Name)
+			if i, ok := seen[key]; ok {
+				if betterResult(res, merged[i]) {
+					merged[i] = res
+				}
+				continue
+			}
+			seen[key] = len(merged)
+			merged = append(merged, res)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].HashMatch && !merged[j].HashMatch
+	})
+	return merged, nil
+}
+
+// Download fetches a subtitle by a namespaced ID from Search
+// ("provider:id"). Bare IDs are treated as OpenSubtitles file IDs.
+func (r *Registry) Download(ctx context.Context, id string) ([]byte, error) {
+	name, localID, ok := strings.Cut(id, ":")
+	if !ok {
+		name, localID = openSubtitlesName, id
+	}
+	for _, p := range r.providers {
+		if p.Name() == name {
+			return p.Download(ctx, localID)
+		}
+	}
+	return nil, fmt.Errorf("unknown subtitle provider %q", name)
+}
+
+// normalizeRelease reduces a release name to lowercase letters and digits so
+// the same release listed by different providers compares equal.
+func normalizeRelease(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// betterResult reports whether a should replace its duplicate b.
+func betterResult(a, b models.SubtitleResult) bool {
+	if a.HashMatch != b.HashMatch {
+		return a.HashMatch
+	}
+	return a.Downloads > b.Downloads
+}
@@ -0,0 +1,150 @@
+package subtitle
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+)
+
+const (
+	subdlName        = "subdl"
+	subdlAPIURL      = "https://api.subdl.com/api/v1/subtitles"
+	subdlDownloadURL = "https://dl.subdl.com/subtitle/"
+
+	// subdlMaxArchive caps the size of a downloaded subtitle archive.
+	subdlMaxArchive = 20 * 1024 * 1024
+)
+
+// Subdl searches and downloads subtitles from subdl.com. Subtitles are
+// served as ZIP archives containing SRT files.
+type Subdl struct {
+	apiKey string
+	http   *httpclient.Client
+}
+
+// NewSubdl creates a Subdl provider authenticated with the given API key.
+func NewSubdl(apiKey string, opts httpclient.Options) *Subdl {
+	if opts.Timeout == 0 {
+		opts.Timeout = 15 * time.Second
+	}
+	return &Subdl{
+		apiKey: apiKey,
+		http:   httpclient.New(opts),
+	}
+}
+
+func (s *Subdl) Name() string {
+	return subdlName
+}
+
+// Search finds subtitles by IMDb ID. Subdl doesn't support hash matching.
+func (s *Subdl) Search(ctx context.Context, q Query) ([]models.SubtitleResult, error) {
+	if q.IMDbID == "" {
+		return nil, nil
+	}
+
+	params := url.Values{
+		"api_key":       {s.apiKey},
+		"imdb_id":       {q.IMDbID},
+		"languages":     {strings.ToUpper(q.Lang)},
+		"subs_per_page": {"30"},
+	}
+	resp, err := s.http.Get(ctx, subdlAPIURL+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("search subtitles: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("subdl api returned status %d", resp.StatusCode)
+	}
+
+	var sdResp struct {
+		Status    bool   `json:"status"`
+		Error     string `json:"error"`
+		Subtitles []struct {
+			ReleaseName string `json:"release_name"`
+			Language    string `json:"language"`
+			URL         string `json:"url"` // "/subtitle/<id>.zip"
+		} `json:"subtitles"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sdResp); err != nil {
+		return nil, fmt.Errorf("decode search response: %w", err)
+	}
+	if !sdResp.Status {
+		if sdResp.Error != "" {
+			return nil, fmt.Errorf("subdl: %s", sdResp.Error)
+		}
+		return nil, nil
+	}
+
+	var results []models.SubtitleResult
+	for _, sub := range sdResp.Subtitles {
+		id := strings.TrimSuffix(path.Base(sub.URL), ".zip")
+		if id == "" || id == "." {
+			continue
+		}
+		results = append(results, models.SubtitleResult{
+			ID:       id,
+			Language: strings.ToLower(sub.Language),
+			Name:     sub.ReleaseName,
+		})
+	}
+
+	return results, nil
+}
+
+// Download fetches a subtitle archive and returns its first SRT as WebVTT.
+func (s *Subdl) Download(ctx context.Context, id string) ([]byte, error) {
+	if strings.ContainsAny(id, "/?#") {
+		return nil, fmt.Errorf("invalid subtitle id %q", id)
+	}
+
+	resp, err := s.http.Get(ctx, subdlDownloadURL+id+".zip")
+	if err != nil {
+		return nil, fmt.Errorf("fetch subtitle archive: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("subtitle download returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, subdlMaxArchive))
+	if err != nil {
+		return nil, fmt.Errorf("read subtitle archive: %w", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open subtitle archive: %w", err)
+	}
+	for _, f := range archive.File {
+		if !strings.EqualFold(path.Ext(f.Name), ".srt") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", f.Name, err)
+		}
+		srt, err := io.ReadAll(io.LimitReader(rc, subdlMaxArchive))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		return srtToVTT(srt), nil
+	}
+
+	return nil, fmt.Errorf("no srt file in subtitle archive")
+}
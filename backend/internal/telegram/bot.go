@@ -0,0 +1,223 @@
+// Package telegram is an optional Telegram bot for StreamBox: allowed chats
+// can search titles, pick a torrent to download for offline playback, and
+// receive notifications (see notify.Sink).
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/notify"
+	"github.com/streambox/backend/internal/tmdb"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+const defaultBaseURL = "https://api.telegram.org"
+
+// pollTimeout is how long a getUpdates call waits for new messages.
+const pollTimeout = 50 * time.Second
+
+// pollRetryDelay is the pause after a failed getUpdates call.
+const pollRetryDelay = 5 * time.Second
+
+// Bot answers messages sent to it through long polling, so it needs no
+// public URL.
+type Bot struct {
+	token   string
+	http    *httpclient.Client
+	baseURL string
+	chats   []int64 // allowed chats, which also receive notifications
+
+	tmdb      *tmdb.Client
+	providers *torrent.ProviderRegistry
+	torrents  *torrent.Manager
+
+	mu     sync.Mutex
+	offers map[int64][]offer // torrents last listed in each chat
+}
+
+// NewBot creates a bot for the token from @BotFather. Only the given chats
+// may use it; others are told their chat ID so it can be added.
+func NewBot(token string, chats []int64, tmdbClient *tmdb.Client, providers *torrent.ProviderRegistry, torrents *torrent.Manager, opts httpclient.Options) *Bot {
+	// Long polls hold the request open for pollTimeout.
+	if opts.Timeout < pollTimeout+10*time.Second {
+		opts.Timeout = pollTimeout + 10*time.Second
+	}
+	return &Bot{
+		token:     token,
+		http:      httpclient.New(opts),
+		baseURL:   defaultBaseURL,
+		chats:     chats,
+		tmdb:      tmdbClient,
+		providers: providers,
+		torrents:  torrents,
+		offers:    make(map[int64][]offer),
+	}
+}
+
+type update struct {
+	UpdateID      int64          `json:"update_id"`
+	Message       *message       `json:"message"`
+	CallbackQuery *callbackQuery `json:"callback_query"`
+}
+
+type message struct {
+	MessageID int64  `json:"message_id"`
+	Chat      chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+type chat struct {
+	ID int64 `json:"id"`
+}
+
+type callbackQuery struct {
+	ID      string   `json:"id"`
+	Data    string   `json:"data"`
+	Message *message `json:"message"`
+}
+
+type button struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+type keyboard struct {
+	InlineKeyboard [][]button `json:"inline_keyboard"`
+}
+
+// Run polls for messages until ctx is cancelled.
+func (b *Bot) Run(ctx context.Context) {
+	if me, err := b.getMe(ctx); err != nil {
+		log.Warn().Err(err).Msg("telegram bot token check failed")
+	} else {
+		log.Info().Str("bot", "@"+me).Int("chats", len(b.chats)).Msg("telegram bot started")
+	}
+
+	var offset int64
+	for ctx.Err() == nil {
+		var updates []update
+		err := b.call(ctx, "getUpdates", map[string]any{
+			"offset":          offset,
+			"timeout":         int(pollTimeout.Seconds()),
+			"allowed_updates": []string{"message", "callback_query"},
+		}, &updates)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warn().Err(err).Msg("telegram poll failed")
+				select {
+				case <-time.After(pollRetryDelay):
+				case <-ctx.Done():
+				}
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			// Searches take a while; don't hold up other chats.
+			go b.handle(ctx, u)
+		}
+	}
+}
+
+func (b *Bot) getMe(ctx context.Context) (string, error) {
+	var me struct {
+		Username string `json:"username"`
+	}
+	if err := b.call(ctx, "getMe", nil, &me); err != nil {
+		return "", err
+	}
+	return me.Username, nil
+}
+
+// eventIcons prefix notifications by event type.
+var eventIcons = map[notify.EventType]string{
+	notify.DownloadCompleted: "✅ ",
+	notify.DownloadFailed:    "❌ ",
+	notify.NewEpisode:        "🆕 ",
+	notify.TranscodeFailed:   "⚠️ ",
+	notify.DiskSpaceLow:      "⚠️ ",
+}
+
+// Name and Send make the bot a notify.Sink, messaging the allowed chats.
+func (b *Bot) Name() string { return "telegram" }
+
+func (b *Bot) Send(ctx context.Context, e notify.Event) error {
+	text := eventIcons[e.Type] + e.Title + "\n" + e.Message
+	var errs []error
+	for _, id := range b.chats {
+		if err := b.send(ctx, id, text, nil); err != nil {
+			errs = append(errs, fmt.Errorf("chat %d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *Bot) send(ctx context.Context, chatID int64, text string, kb *keyboard) error {
+	params := map[string]any{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}
+	if kb != nil {
+		params["reply_markup"] = kb
+	}
+	return b.call(ctx, "sendMessage", params, nil)
+}
+
+// call invokes a Bot API method, decoding its result into dest.
+func (b *Bot) call(ctx context.Context, method string, params, dest any) error {
+	if params == nil {
+		params = struct{}{}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+"/bot"+b.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build %s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.http.Do(req)
+	if err != nil {
+		// The URL holds the token; keep it out of error messages.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("decode %s response: %w", method, err)
+	}
+	if !res.OK {
+		return fmt.Errorf("telegram %s: %s (status %d)", method, res.Description, resp.StatusCode)
+	}
+	if dest == nil {
+		return nil
+	}
+	if err := json.Unmarshal(res.Result, dest); err != nil {
+		return fmt.Errorf("decode %s result: %w", method, err)
+	}
+	return nil
+}
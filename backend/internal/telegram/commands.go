@@ -0,0 +1,310 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/models"
+	"github.com/streambox/backend/internal/notify"
+	"github.com/streambox/backend/internal/torrent"
+)
+
+// maxChoices caps the titles and torrents offered per message.
+const maxChoices = 8
+
+const helpText = `Send a movie or show title to search for it, then pick a release to download it to the server.
+
+/downloads — unfinished downloads
+/help — this message
+
+You'll get a message here when a download finishes.`
+
+// offer is a torrent listed in a chat, picked later by its index in the
+// callback data (which is limited to 64 bytes, too short for a magnet).
+type offer struct {
+	tmdbID    int
+	title     string
+	season    int
+	magnetURI string
+}
+
+// handle answers one message or button press.
+func (b *Bot) handle(ctx context.Context, u update) {
+	var chatID int64
+	switch {
+	case u.Message != nil:
+		chatID = u.Message.Chat.ID
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil:
+		chatID = u.CallbackQuery.Message.Chat.ID
+		// Stops the button's loading spinner.
+		if err := b.call(ctx, "answerCallbackQuery", map[string]any{"callback_query_id": u.CallbackQuery.ID}, nil); err != nil {
+			log.Debug().Err(err).Msg("telegram callback answer failed")
+		}
+	default:
+		return
+	}
+
+	if !slices.Contains(b.chats, chatID) {
+		log.Warn().Int64("chat_id", chatID).Msg("telegram message from a chat not in TELEGRAM_ALLOWED_CHATS")
+		b.reply(ctx, chatID, fmt.Sprintf("This chat isn't allowed to use StreamBox. To allow it, add %d to TELEGRAM_ALLOWED_CHATS.", chatID), nil)
+		return
+	}
+
+	if u.CallbackQuery != nil {
+		b.handleChoice(ctx, chatID, u.CallbackQuery.Data)
+		return
+	}
+
+	text := strings.TrimSpace(u.Message.Text)
+	command, args, _ := strings.Cut(text, " ")
+	// In groups, commands may be addressed as /command@botname.
+	command, _, _ = strings.Cut(command, "@")
+	switch command {
+	case "/start", "/help":
+		b.reply(ctx, chatID, helpText, nil)
+	case "/downloads":
+		b.listDownloads(ctx, chatID)
+	case "/search":
+		b.search(ctx, chatID, strings.TrimSpace(args))
+	default:
+		if strings.HasPrefix(text, "/") {
+			b.reply(ctx, chatID, "Unknown command.\n\n"+helpText, nil)
+			return
+		}
+		b.search(ctx, chatID, text)
+	}
+}
+
+func (b *Bot) reply(ctx context.Context, chatID int64, text string, kb *keyboard) {
+	if err := b.send(ctx, chatID, text, kb); err != nil {
+		log.Warn().Err(err).Int64("chat_id", chatID).Msg("telegram reply failed")
+	}
+}
+
+// search lists the TMDB titles matching query.
+func (b *Bot) search(ctx context.Context, chatID int64, query string) {
+	if query == "" {
+		b.reply(ctx, chatID, "What should I search for? Send a title.", nil)
+		return
+	}
+
+	res, err := b.tmdb.SearchMulti(ctx, query, 1)
+	if err != nil {
+		log.Warn().Err(err).Str("query", query).Msg("telegram title search failed")
+		b.reply(ctx, chatID, "Search failed, try again later.", nil)
+		return
+	}
+
+	kb := &keyboard{}
+	for _, item := range res.Results {
+		if len(kb.InlineKeyboard) == maxChoices {
+			break
+		}
+		label, data := "🎬 ", "m:"
+		if item.MediaType == "tv" {
+			label, data = "📺 ", "tv:"
+		}
+		label += item.Title + yearLabel(item.Date)
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []button{{Text: label, CallbackData: data + strconv.Itoa(item.ID)}})
+	}
+	if len(kb.InlineKeyboard) == 0 {
+		b.reply(ctx, chatID, fmt.Sprintf("Nothing found for %q.", query), nil)
+		return
+	}
+	b.reply(ctx, chatID, "Which one?", kb)
+}
+
+// handleChoice acts on a button press. Data is one of m:<tmdb id> (a movie),
+// tv:<tmdb id> (a show), s:<tmdb id>:<season> or d:<offer index>.
+func (b *Bot) handleChoice(ctx context.Context, chatID int64, data string) {
+	kind, rest, _ := strings.Cut(data, ":")
+	var ids []int
+	for _, s := range strings.Split(rest, ":") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			log.Debug().Str("data", data).Msg("invalid telegram callback data")
+			return
+		}
+		ids = append(ids, n)
+	}
+
+	switch {
+	case kind == "m" && len(ids) == 1:
+		b.movieTorrents(ctx, chatID, ids[0])
+	case kind == "tv" && len(ids) == 1:
+		b.listSeasons(ctx, chatID, ids[0])
+	case kind == "s" && len(ids) == 2:
+		b.seasonTorrents(ctx, chatID, ids[0], ids[1])
+	case kind == "d" && len(ids) == 1:
+		b.startDownload(ctx, chatID, ids[0])
+	default:
+		log.Debug().Str("data", data).Msg("invalid telegram callback data")
+	}
+}
+
+func (b *Bot) movieTorrents(ctx context.Context, chatID int64, tmdbID int) {
+	movie, err := b.tmdb.GetDetails(ctx, tmdbID)
+	if err != nil {
+		log.Warn().Err(err).Int("tmdb_id", tmdbID).Msg("telegram movie lookup failed")
+		b.reply(ctx, chatID, "Couldn't load that movie, try again later.", nil)
+		return
+	}
+
+	results, _, err := b.providers.Search(ctx, movie.Title, movie.IMDbID, year(movie.ReleaseDate))
+	b.offerTorrents(ctx, chatID, movie.ID, movie.Title, 0, results, err, torrent.RankOptions{Title: movie.Title, Year: year(movie.ReleaseDate)})
+}
+
+func (b *Bot) listSeasons(ctx context.Context, chatID int64, tmdbID int) {
+	show, err := b.tmdb.GetTVDetails(ctx, tmdbID)
+	if err != nil {
+		log.Warn().Err(err).Int("tmdb_id", tmdbID).Msg("telegram show lookup failed")
+		b.reply(ctx, chatID, "Couldn't load that show, try again later.", nil)
+		return
+	}
+
+	kb := &keyboard{}
+	var row []button
+	for _, s := range show.Seasons {
+		if s.SeasonNumber == 0 {
+			continue // specials are rarely released as season packs
+		}
+		row = append(row, button{Text: strconv.Itoa(s.SeasonNumber), CallbackData: fmt.Sprintf("s:%d:%d", show.ID, s.SeasonNumber)})
+		if len(row) == 5 {
+			kb.InlineKeyboard = append(kb.InlineKeyboard, row)
+			row = nil
+		}
+	}
+	if row != nil {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, row)
+	}
+	if len(kb.InlineKeyboard) == 0 {
+		b.reply(ctx, chatID, show.Name+" has no seasons yet.", nil)
+		return
+	}
+	b.reply(ctx, chatID, show.Name+yearLabel(show.FirstAirDate)+" — which season?", kb)
+}
+
+func (b *Bot) seasonTorrents(ctx context.Context, chatID int64, tmdbID, season int) {
+	show, err := b.tmdb.GetTVDetails(ctx, tmdbID)
+	if err != nil {
+		log.Warn().Err(err).Int("tmdb_id", tmdbID).Msg("telegram show lookup failed")
+		b.reply(ctx, chatID, "Couldn't load that show, try again later.", nil)
+		return
+	}
+
+	results, _, err := b.providers.SearchTV(ctx, show.Name, season, 0, year(show.FirstAirDate))
+	b.offerTorrents(ctx, chatID, show.ID, show.Name, season, results, err, torrent.RankOptions{Series: true, Title: show.Name, Year: year(show.FirstAirDate)})
+}
+
+// offerTorrents lists the best of a search's results to pick one to
+// download.
+func (b *Bot) offerTorrents(ctx context.Context, chatID int64, tmdbID int, title string, season int, results []models.TorrentResult, err error, opts torrent.RankOptions) {
+	name := title + notify.EpisodeLabel(season, 0)
+	if err != nil {
+		log.Warn().Err(err).Str("title", name).Msg("telegram torrent search failed")
+		b.reply(ctx, chatID, "Torrent search failed, try again later.", nil)
+		return
+	}
+
+	opts.CanTranscode = ffmpeg.Supports(ffmpeg.Transcode)
+	results = torrent.Rank(results, opts)
+	if len(results) > maxChoices {
+		results = results[:maxChoices]
+	}
+	if len(results) == 0 {
+		b.reply(ctx, chatID, "No torrents found for "+name+".", nil)
+		return
+	}
+
+	offers := make([]offer, len(results))
+	var text strings.Builder
+	text.WriteString("Releases of " + name + ":\n")
+	kb := &keyboard{}
+	for i, r := range results {
+		offers[i] = offer{tmdbID: tmdbID, title: title, season: season, magnetURI: r.MagnetURI}
+		fmt.Fprintf(&text, "\n%d. %s\n%s · %s · %d seeds · %s\n", i+1, truncate(r.Title, 120), r.Quality, r.SizeHuman, r.Seeds, r.Provider)
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []button{{
+			Text:         fmt.Sprintf("%d. %s · %s", i+1, r.Quality, r.SizeHuman),
+			CallbackData: "d:" + strconv.Itoa(i),
+		}})
+	}
+
+	b.mu.Lock()
+	b.offers[chatID] = offers
+	b.mu.Unlock()
+	b.reply(ctx, chatID, text.String(), kb)
+}
+
+func (b *Bot) startDownload(ctx context.Context, chatID int64, index int) {
+	b.mu.Lock()
+	offers := b.offers[chatID]
+	b.mu.Unlock()
+	if index < 0 || index >= len(offers) {
+		b.reply(ctx, chatID, "That list is out of date, search again.", nil)
+		return
+	}
+	o := offers[index]
+
+	dl, err := b.torrents.StartDownload(o.tmdbID, o.title, o.season, 0, o.magnetURI, -1)
+	if err != nil {
+		log.Warn().Err(err).Str("title", o.title).Msg("telegram download failed to start")
+		msg := "Couldn't start the download."
+		if errors.Is(err, torrent.ErrInvalidMagnet) {
+			msg = "That release has an invalid magnet link, pick another."
+		}
+		b.reply(ctx, chatID, msg, nil)
+		return
+	}
+	b.reply(ctx, chatID, "⬇️ Downloading "+dl.Title+notify.EpisodeLabel(dl.Season, dl.Episode)+". I'll let you know when it's done.", nil)
+}
+
+func (b *Bot) listDownloads(ctx context.Context, chatID int64) {
+	downloads, err := b.torrents.Downloads("")
+	if err != nil {
+		log.Warn().Err(err).Msg("telegram download list failed")
+		b.reply(ctx, chatID, "Couldn't list downloads, try again later.", nil)
+		return
+	}
+
+	var text strings.Builder
+	for _, d := range downloads {
+		if d.Status == models.DownloadCompleted || d.Status == models.DownloadFailed {
+			continue
+		}
+		fmt.Fprintf(&text, "%s%s — %s, %.0f%%\n", d.Title, notify.EpisodeLabel(d.Season, d.Episode), d.Status, d.Progress)
+	}
+	if text.Len() == 0 {
+		b.reply(ctx, chatID, "Nothing is downloading.", nil)
+		return
+	}
+	b.reply(ctx, chatID, text.String(), nil)
+}
+
+// year returns the year of a TMDB date (YYYY-MM-DD), or "".
+func year(date string) string {
+	if len(date) < 4 {
+		return ""
+	}
+	return date[:4]
+}
+
+func yearLabel(date string) string {
+	if y := year(date); y != "" {
+		return " (" + y + ")"
+	}
+	return ""
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
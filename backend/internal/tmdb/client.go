@@ -1,6 +1,7 @@
 package tmdb
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,6 +9,8 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/metrics"
 	"github.com/streambox/backend/internal/models"
 )
 
@@ -16,23 +19,24 @@ const defaultBaseURL = "https://api.themoviedb.org/3"
 // Client communicates with the TMDB v3 API to fetch movie metadata.
 type Client struct {
 	apiKey     string
-	httpClient *http.Client
+	httpClient *httpclient.Client
 	baseURL    string
 }
 
 // NewClient creates a TMDB client authenticated with the given API key.
-func NewClient(apiKey string) *Client {
+func NewClient(apiKey string, opts httpclient.Options) *Client {
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
 	return &Client{
-		apiKey: apiKey,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		baseURL: defaultBaseURL,
+		apiKey:     apiKey,
+		httpClient: httpclient.New(opts),
+		baseURL:    defaultBaseURL,
 	}
 }
 
 // Search queries TMDB for movies matching the given query string.
-func (c *Client) Search(query string, page int) (*models.MovieSearchResult, error) {
+func (c *Client) Search(ctx context.Context, query string, page int) (*models.MovieSearchResult, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("query", query)
@@ -43,7 +47,7 @@ func (c *Client) Search(query string, page int) (*models.MovieSearchResult, erro
 	reqURL := fmt.Sprintf("%s/search/movie?%s", c.baseURL, params.Encode())
 
 	var tmdbResp tmdbSearchResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb search: %w", err)
 	}
 
@@ -60,7 +64,7 @@ func (c *Client) Search(query string, page int) (*models.MovieSearchResult, erro
 }
 
 // GetTrending returns the trending movies for the current week.
-func (c *Client) GetTrending() ([]models.Movie, error) {
+func (c *Client) GetTrending(ctx context.Context) ([]models.Movie, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("language", "ru-RU")
@@ -68,7 +72,7 @@ func (c *Client) GetTrending() ([]models.Movie, error) {
 	reqURL := fmt.Sprintf("%s/trending/movie/week?%s", c.baseURL, params.Encode())
 
 	var tmdbResp tmdbSearchResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb trending: %w", err)
 	}
 
@@ -80,7 +84,7 @@ func (c *Client) GetTrending() ([]models.Movie, error) {
 }
 
 // GetPopular returns popular movies from TMDB, paginated.
-func (c *Client) GetPopular(page int) (*models.MovieSearchResult, error) {
+func (c *Client) GetPopular(ctx context.Context, page int) (*models.MovieSearchResult, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("page", strconv.Itoa(page))
@@ -90,7 +94,7 @@ func (c *Client) GetPopular(page int) (*models.MovieSearchResult, error) {
 	reqURL := fmt.Sprintf("%s/movie/popular?%s", c.baseURL, params.Encode())
 
 	var tmdbResp tmdbSearchResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb popular: %w", err)
 	}
 
@@ -106,17 +110,19 @@ func (c *Client) GetPopular(page int) (*models.MovieSearchResult, error) {
 	return result, nil
 }
 
-// GetDetails returns full movie details including runtime, genres, and IMDb ID.
-func (c *Client) GetDetails(id int) (*models.Movie, error) {
+// GetDetails returns full movie details including runtime, genres, IMDb ID,
+// cast, director and trailers.
+func (c *Client) GetDetails(ctx context.Context, id int) (*models.Movie, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("language", "ru-RU")
-	params.Set("append_to_response", "external_ids")
+	params.Set("append_to_response", "external_ids,credits,videos")
+	params.Set("include_video_language", videoLanguages)
 
 	reqURL := fmt.Sprintf("%s/movie/%d?%s", c.baseURL, id, params.Encode())
 
 	var tmdbResp tmdbDetailResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb details for %d: %w", id, err)
 	}
 
@@ -135,6 +141,13 @@ func (c *Client) GetDetails(id int) (*models.Movie, error) {
 	if tmdbResp.ExternalIDs != nil {
 		movie.IMDbID = tmdbResp.ExternalIDs.IMDbID
 	}
+	if tmdbResp.Credits != nil {
+		movie.Cast = tmdbResp.Credits.cast()
+		movie.Director = tmdbResp.Credits.director()
+	}
+	if tmdbResp.Videos != nil {
+		movie.Trailers = tmdbResp.Videos.trailers()
+	}
 
 	for i, g := range tmdbResp.Genres {
 		movie.Genres[i] = models.Genre{
@@ -146,10 +159,40 @@ func (c *Client) GetDetails(id int) (*models.Movie, error) {
 	return movie, nil
 }
 
+// GetReleaseDates returns a movie's releases in every country TMDB knows
+// of, of all types (theatrical, digital, ...).
+func (c *Client) GetReleaseDates(ctx context.Context, id int) ([]models.ReleaseDate, error) {
+	params := url.Values{}
+	params.Set("api_key", c.apiKey)
+
+	reqURL := fmt.Sprintf("%s/movie/%d/release_dates?%s", c.baseURL, id, params.Encode())
+
+	var tmdbResp tmdbReleaseDatesResponse
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
+		return nil, fmt.Errorf("tmdb release dates for %d: %w", id, err)
+	}
+
+	var dates []models.ReleaseDate
+	for _, country := range tmdbResp.Results {
+		for _, r := range country.ReleaseDates {
+			if len(r.ReleaseDate) < 10 {
+				continue
+			}
+			dates = append(dates, models.ReleaseDate{
+				Country: country.Country,
+				Type:    r.Type,
+				Date:    r.ReleaseDate[:10], // drop the time of day
+				Note:    r.Note,
+			})
+		}
+	}
+	return dates, nil
+}
+
 // ----- TV Series methods -----
 
 // SearchTV queries TMDB for TV shows matching the given query string.
-func (c *Client) SearchTV(query string, page int) (*models.TVShowSearchResult, error) {
+func (c *Client) SearchTV(ctx context.Context, query string, page int) (*models.TVShowSearchResult, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("query", query)
@@ -159,7 +202,7 @@ func (c *Client) SearchTV(query string, page int) (*models.TVShowSearchResult, e
 	reqURL := fmt.Sprintf("%s/search/tv?%s", c.baseURL, params.Encode())
 
 	var tmdbResp tmdbTVSearchResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb search tv: %w", err)
 	}
 
@@ -176,7 +219,7 @@ func (c *Client) SearchTV(query string, page int) (*models.TVShowSearchResult, e
 }
 
 // GetTrendingTV returns the trending TV shows for the current week.
-func (c *Client) GetTrendingTV() ([]models.TVShow, error) {
+func (c *Client) GetTrendingTV(ctx context.Context) ([]models.TVShow, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("language", "ru-RU")
@@ -184,7 +227,7 @@ func (c *Client) GetTrendingTV() ([]models.TVShow, error) {
 	reqURL := fmt.Sprintf("%s/trending/tv/week?%s", c.baseURL, params.Encode())
 
 	var tmdbResp tmdbTVSearchResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb trending tv: %w", err)
 	}
 
@@ -196,7 +239,7 @@ func (c *Client) GetTrendingTV() ([]models.TVShow, error) {
 }
 
 // GetPopularTV returns popular TV shows from TMDB, paginated.
-func (c *Client) GetPopularTV(page int) (*models.TVShowSearchResult, error) {
+func (c *Client) GetPopularTV(ctx context.Context, page int) (*models.TVShowSearchResult, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("page", strconv.Itoa(page))
@@ -205,7 +248,7 @@ func (c *Client) GetPopularTV(page int) (*models.TVShowSearchResult, error) {
 	reqURL := fmt.Sprintf("%s/tv/popular?%s", c.baseURL, params.Encode())
 
 	var tmdbResp tmdbTVSearchResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb popular tv: %w", err)
 	}
 
@@ -221,17 +264,19 @@ func (c *Client) GetPopularTV(page int) (*models.TVShowSearchResult, error) {
 	return result, nil
 }
 
-// GetTVDetails returns full TV show details including seasons and IMDb ID.
-func (c *Client) GetTVDetails(id int) (*models.TVShow, error) {
+// GetTVDetails returns full TV show details including seasons, IMDb ID,
+// cast, creators and trailers.
+func (c *Client) GetTVDetails(ctx context.Context, id int) (*models.TVShow, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("language", "ru-RU")
-	params.Set("append_to_response", "external_ids")
+	params.Set("append_to_response", "external_ids,credits,videos")
+	params.Set("include_video_language", videoLanguages)
 
 	reqURL := fmt.Sprintf("%s/tv/%d?%s", c.baseURL, id, params.Encode())
 
 	var tmdbResp tmdbTVDetailResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb tv details for %d: %w", id, err)
 	}
 
@@ -252,6 +297,23 @@ func (c *Client) GetTVDetails(id int) (*models.TVShow, error) {
 	if tmdbResp.ExternalIDs != nil {
 		show.IMDbID = tmdbResp.ExternalIDs.IMDbID
 	}
+	if tmdbResp.Credits != nil {
+		show.Cast = tmdbResp.Credits.cast()
+	}
+	if tmdbResp.Videos != nil {
+		show.Trailers = tmdbResp.Videos.trailers()
+	}
+	for _, cr := range tmdbResp.CreatedBy {
+		show.Creators = append(show.Creators, cr.Name)
+	}
+	if e := tmdbResp.LastEpisodeToAir; e != nil {
+		last := e.toEpisode()
+		show.LastEpisodeToAir = &last
+	}
+	if e := tmdbResp.NextEpisodeToAir; e != nil {
+		next := e.toEpisode()
+		show.NextEpisodeToAir = &next
+	}
 
 	for i, g := range tmdbResp.Genres {
 		show.Genres[i] = models.Genre{ID: g.ID, Name: g.Name}
@@ -273,7 +335,7 @@ func (c *Client) GetTVDetails(id int) (*models.TVShow, error) {
 }
 
 // GetSeasonDetails returns full season details including all episodes.
-func (c *Client) GetSeasonDetails(tvID, seasonNumber int) (*models.Season, error) {
+func (c *Client) GetSeasonDetails(ctx context.Context, tvID, seasonNumber int) (*models.Season, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("language", "ru-RU")
@@ -281,7 +343,7 @@ func (c *Client) GetSeasonDetails(tvID, seasonNumber int) (*models.Season, error
 	reqURL := fmt.Sprintf("%s/tv/%d/season/%d?%s", c.baseURL, tvID, seasonNumber, params.Encode())
 
 	var tmdbResp tmdbSeasonDetailResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb season %d for tv %d: %w", seasonNumber, tvID, err)
 	}
 
@@ -297,24 +359,14 @@ func (c *Client) GetSeasonDetails(tvID, seasonNumber int) (*models.Season, error
 	}
 
 	for i, e := range tmdbResp.Episodes {
-		season.Episodes[i] = models.Episode{
-			ID:            e.ID,
-			EpisodeNumber: e.EpisodeNumber,
-			SeasonNumber:  e.SeasonNumber,
-			Name:          e.Name,
-			Overview:      e.Overview,
-			StillPath:     e.StillPath,
-			AirDate:       e.AirDate,
-			VoteAverage:   e.VoteAverage,
-			Runtime:       e.Runtime,
-		}
+		season.Episodes[i] = e.toEpisode()
 	}
 
 	return season, nil
 }
 
 // SearchMulti queries TMDB for both movies and TV shows, filtering out person results.
-func (c *Client) SearchMulti(query string, page int) (*models.MediaSearchResult, error) {
+func (c *Client) SearchMulti(ctx context.Context, query string, page int) (*models.MediaSearchResult, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("query", query)
@@ -325,7 +377,7 @@ func (c *Client) SearchMulti(query string, page int) (*models.MediaSearchResult,
 	reqURL := fmt.Sprintf("%s/search/multi?%s", c.baseURL, params.Encode())
 
 	var tmdbResp tmdbMultiSearchResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb search multi: %w", err)
 	}
 
@@ -345,7 +397,7 @@ func (c *Client) SearchMulti(query string, page int) (*models.MediaSearchResult,
 }
 
 // GetTrendingAll returns trending movies and TV shows for the current week.
-func (c *Client) GetTrendingAll() ([]models.MediaItem, error) {
+func (c *Client) GetTrendingAll(ctx context.Context) ([]models.MediaItem, error) {
 	params := url.Values{}
 	params.Set("api_key", c.apiKey)
 	params.Set("language", "ru-RU")
@@ -353,7 +405,7 @@ func (c *Client) GetTrendingAll() ([]models.MediaItem, error) {
 	reqURL := fmt.Sprintf("%s/trending/all/week?%s", c.baseURL, params.Encode())
 
 	var tmdbResp tmdbMultiSearchResponse
-	if err := c.doGet(reqURL, &tmdbResp); err != nil {
+	if err := c.doGet(ctx, reqURL, &tmdbResp); err != nil {
 		return nil, fmt.Errorf("tmdb trending all: %w", err)
 	}
 
@@ -367,16 +419,19 @@ func (c *Client) GetTrendingAll() ([]models.MediaItem, error) {
 }
 
 // doGet performs an HTTP GET request and JSON-decodes the response body into dest.
-func (c *Client) doGet(url string, dest interface{}) error {
-	resp, err := c.httpClient.Get(url)
+func (c *Client) doGet(ctx context.Context, url string, dest interface{}) error {
+	resp, err := c.httpClient.Get(ctx, url)
 	if err != nil {
+		metrics.TMDBRequests.With("error").Inc()
 		return fmt.Errorf("http get: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.TMDBRequests.With(strconv.Itoa(resp.StatusCode)).Inc()
 		return fmt.Errorf("tmdb api returned status %d", resp.StatusCode)
 	}
+	metrics.TMDBRequests.With("ok").Inc()
 
 	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
 		return fmt.Errorf("decode json: %w", err)
@@ -426,6 +481,19 @@ type tmdbDetailResponse struct {
 	Runtime      int              `json:"runtime"`
 	Genres       []tmdbGenre      `json:"genres"`
 	ExternalIDs  *tmdbExternalIDs `json:"external_ids"`
+	Credits      *tmdbCredits     `json:"credits"`
+	Videos       *tmdbVideos      `json:"videos"`
+}
+
+type tmdbReleaseDatesResponse struct {
+	Results []struct {
+		Country      string `json:"iso_3166_1"`
+		ReleaseDates []struct {
+			Type        int    `json:"type"`
+			ReleaseDate string `json:"release_date"`
+			Note        string `json:"note"`
+		} `json:"release_dates"`
+	} `json:"results"`
 }
 
 type tmdbGenre struct {
@@ -437,6 +505,79 @@ type tmdbExternalIDs struct {
 	IMDbID string `json:"imdb_id"`
 }
 
+// maxCast caps how many cast members are returned with details.
+const maxCast = 20
+
+// videoLanguages are the video languages requested alongside ru-RU
+// metadata; most trailers only exist in English.
+const videoLanguages = "ru,en,null"
+
+type tmdbCredits struct {
+	Cast []struct {
+		ID          int    `json:"id"`
+		Name        string `json:"name"`
+		Character   string `json:"character"`
+		ProfilePath string `json:"profile_path"`
+	} `json:"cast"`
+	Crew []struct {
+		Name string `json:"name"`
+		Job  string `json:"job"`
+	} `json:"crew"`
+}
+
+func (cr *tmdbCredits) cast() []models.CastMember {
+	var cast []models.CastMember
+	for i, m := range cr.Cast {
+		if i >= maxCast {
+			break
+		}
+		cast = append(cast, models.CastMember{
+			ID:          m.ID,
+			Name:        m.Name,
+			Character:   m.Character,
+			ProfilePath: m.ProfilePath,
+		})
+	}
+	return cast
+}
+
+func (cr *tmdbCredits) director() string {
+	for _, m := range cr.Crew {
+		if m.Job == "Director" {
+			return m.Name
+		}
+	}
+	return ""
+}
+
+type tmdbVideos struct {
+	Results []struct {
+		Key      string `json:"key"`
+		Name     string `json:"name"`
+		Site     string `json:"site"`
+		Type     string `json:"type"`
+		Official bool   `json:"official"`
+	} `json:"results"`
+}
+
+// trailers returns YouTube trailers, then teasers.
+func (v *tmdbVideos) trailers() []models.Trailer {
+	var trailers, teasers []models.Trailer
+	for _, r := range v.Results {
+		if r.Site != "YouTube" {
+			continue
+		}
+		t := models.Trailer{Key: r.Key, Name: r.Name, Type: r.Type, Official: r.Official}
+		switch r.Type {
+		case "Trailer":
+			trailers = append(trailers, t)
+		case "Teaser":
+			teasers = append(teasers, t)
+		}
+	}
+	return append(trailers, teasers...)
+}
+
 // ----- TV series internal types -----
 
 type tmdbTVEntry struct {
@@ -481,6 +622,13 @@ type tmdbTVDetailResponse struct {
 	Genres           []tmdbGenre      `json:"genres"`
 	Seasons          []tmdbSeason     `json:"seasons"`
 	ExternalIDs      *tmdbExternalIDs `json:"external_ids"`
+	Credits          *tmdbCredits     `json:"credits"`
+	Videos           *tmdbVideos      `json:"videos"`
+	CreatedBy        []struct {
+		Name string `json:"name"`
+	} `json:"created_by"`
+	LastEpisodeToAir *tmdbEpisode `json:"last_episode_to_air"`
+	NextEpisodeToAir *tmdbEpisode `json:"next_episode_to_air"`
 }
 
 type tmdbSeason struct {
@@ -494,13 +642,13 @@ type tmdbSeason struct {
 }
 
 type tmdbSeasonDetailResponse struct {
-	ID           int            `json:"id"`
-	SeasonNumber int            `json:"season_number"`
-	Name         string         `json:"name"`
-	Overview     string         `json:"overview"`
-	PosterPath   string         `json:"poster_path"`
-	AirDate      string         `json:"air_date"`
-	Episodes     []tmdbEpisode  `json:"episodes"`
+	ID           int           `json:"id"`
+	SeasonNumber int           `json:"season_number"`
+	Name         string        `json:"name"`
+	Overview     string        `json:"overview"`
+	PosterPath   string        `json:"poster_path"`
+	AirDate      string        `json:"air_date"`
+	Episodes     []tmdbEpisode `json:"episodes"`
 }
 
 type tmdbEpisode struct {
@@ -515,6 +663,20 @@ type tmdbEpisode struct {
 	Runtime       int     `json:"runtime"`
 }
 
+func (e *tmdbEpisode) toEpisode() models.Episode {
+	return models.Episode{
+		ID:            e.ID,
+		EpisodeNumber: e.EpisodeNumber,
+		SeasonNumber:  e.SeasonNumber,
+		Name:          e.Name,
+		Overview:      e.Overview,
+		StillPath:     e.StillPath,
+		AirDate:       e.AirDate,
+		VoteAverage:   e.VoteAverage,
+		Runtime:       e.Runtime,
+	}
+}
+
 type tmdbMultiEntry struct {
 	ID           int     `json:"id"`
 	MediaType    string  `json:"media_type"`
@@ -0,0 +1,74 @@
+package torrent
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// SetAudioLanguages sets the audio languages (ISO 639 codes), in order of
+// preference, whose track is selected once a new session's file is probed.
+// The requesting profile's language comes first.
+func (m *Manager) SetAudioLanguages(langs []string) {
+	m.mu.Lock()
+	m.audioLanguages = langs
+	m.mu.Unlock()
+}
+
+// setAudioLanguage records the requesting profile's audio language on a new
+// session, selecting its track if the file is already probed.
+func (m *Manager) setAudioLanguage(sess *Session, lang string) {
+	m.mu.Lock()
+	sess.audioLanguage = lang
+	selected := sess.probed && m.selectAudioTrack(sess)
+	m.mu.Unlock()
+	if selected {
+		m.persistAudioTrack(sess)
+	}
+}
+
+// selectAudioTrack selects the track of the most preferred language in
+// the session's file, unless a track was chosen already or there is only
+// one. It reports whether it selected one. m.mu must be held.
+func (m *Manager) selectAudioTrack(sess *Session) bool {
+	if sess.AudioTrack >= 0 || len(sess.AudioTracks) < 2 {
+		return false
+	}
+	for _, lang := range preferredLanguages(sess.audioLanguage, m.audioLanguages) {
+		for _, t := range sess.AudioTracks {
+			if trackLanguage(t) == lang {
+				sess.AudioTrack = t.Index
+				m.applyPlayMethod(sess) // the track's codec may play directly or not
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// persistAudioTrack saves the audio track selected for a session.
+func (m *Manager) persistAudioTrack(sess *Session) {
+	m.mu.RLock()
+	track := sess.AudioTrack
+	m.mu.RUnlock()
+
+	log.Info().Str("session_id", sess.ID).Int("audio_track", track).Msg("preferred audio track selected")
+	if m.db != nil {
+		if err := m.db.UpdateSessionAudioTrack(sess.ID, track); err != nil {
+			log.Warn().Err(err).Str("session_id", sess.ID).Msg("failed to persist audio track")
+		}
+	}
+}
+
+// trackLanguage returns the language of an audio track: its language tag,
+// or else what its title says, e.g. "Дубляж" or "English".
+func trackLanguage(t models.AudioTrack) string {
+	if lang := normalizeLanguage(t.Language); lang != "" && lang != "und" {
+		return lang
+	}
+	for _, al := range audioLanguages {
+		if al.pattern.MatchString(t.Title) {
+			return al.lang
+		}
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+func TestTrackLanguage(t *testing.T) {
+	tests := []struct {
+		name  string
+		track models.AudioTrack
+		want  string
+	}{
+		{"two-letter tag", models.AudioTrack{Language: "ru"}, "ru"},
+		{"three-letter tag", models.AudioTrack{Language: "rus", Title: "English"}, "ru"},
+		{"bibliographic tag", models.AudioTrack{Language: "ger"}, "de"},
+		{"undetermined, Russian title", models.AudioTrack{Language: "und", Title: "Дубляж"}, "ru"},
+		{"untagged, voice-over title", models.AudioTrack{Title: "MVO (LostFilm)"}, "ru"},
+		{"untagged, Ukrainian title", models.AudioTrack{Title: "Украинский"}, "uk"},
+		{"untagged, English title", models.AudioTrack{Title: "English 5.1"}, "en"},
+		{"unknown", models.AudioTrack{Title: "Commentary"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trackLanguage(tt.track); got != tt.want {
+				t.Errorf("trackLanguage(%+v) = %q, want %q", tt.track, got, tt.want)
+			}
+		})
+	}
+}
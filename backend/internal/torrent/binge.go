@@ -0,0 +1,272 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+const (
+	// nextPrebufferBytes is how much of the next episode is downloaded ahead
+	// so playback can start without a buffering pause.
+	nextPrebufferBytes = 32 * 1024 * 1024
+	// nextSearchCandidates caps how many search results are opened (metadata
+	// fetched) while looking for the next episode.
+	nextSearchCandidates = 3
+	// prefetchProgress is the share of an episode after which the next one
+	// is prepared automatically.
+	prefetchProgress = 0.9
+)
+
+// Prefetch states of the next episode, reported in the stream status.
+const (
+	PrefetchSearching = "searching"
+	PrefetchReady     = "ready"
+	PrefetchFailed    = "failed"
+)
+
+// episodeRes match "S01E02", "s1.e2" and "1x02" style episode markers.
+var episodeRes = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bS(\d{1,2})[ ._-]?E(\d{1,3})`),
+	regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b`),
+}
+
+// parseEpisode extracts the season and episode numbers from a file name.
+func parseEpisode(name string) (season, episode int, ok bool) {
+	for _, re := range episodeRes {
+		if m := re.FindStringSubmatch(name); m != nil {
+			season, _ = strconv.Atoi(m[1])
+			episode, _ = strconv.Atoi(m[2])
+			return season, episode, true
+		}
+	}
+	return 0, 0, false
+}
+
+// findEpisodeFile returns the index of the video file for the given episode.
+func findEpisodeFile(files []*atorrent.File, season, episode int) int {
+	for i, f := range files {
+		if !isVideoFile(f.DisplayPath()) {
+			continue
+		}
+		if s, e, ok := parseEpisode(f.DisplayPath()); ok && s == season && e == episode {
+			return i
+		}
+	}
+	return -1
+}
+
+// episodeFileIndex returns the index of the given episode's file in the
+// magnet's torrent, or -1 (the largest video file) if it has none, e.g.
+// because it is a single episode named differently.
+func (m *Manager) episodeFileIndex(magnetURI string, season, episode int) int {
+	t, err := m.addMagnet(magnetURI)
+	if err != nil {
+		return -1 // starting the session reports the error
+	}
+	m.releaseTorrentLater(t)
+	return findEpisodeFile(t.Files(), season, episode)
+}
+
+// isEpisode reports whether sess plays a TV episode, i.e. has a next one.
+func isEpisode(sess *Session) bool {
+	if sess.Season > 0 && sess.Episode > 0 {
+		return true
+	}
+	_, _, ok := parseEpisode(sess.FilePath)
+	return ok
+}
+
+// maybePrefetch prepares the next episode in the background once playback
+// of a TV episode passes prefetchProgress, so binge playback starts without
+// buffering. It runs at most once per session.
+func (m *Manager) maybePrefetch(sess *Session, position float64) {
+	m.mu.Lock()
+	due := sess.Duration > 0 && position >= sess.Duration*prefetchProgress &&
+		sess.prefetch == "" && sess.next == "" && isEpisode(sess)
+	if due {
+		sess.prefetch = PrefetchSearching
+	}
+	m.mu.Unlock()
+	if !due {
+		return
+	}
+
+	go func() {
+		_, err := m.Next(context.Background(), sess.ID)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if err != nil {
+			sess.prefetch = PrefetchFailed
+			sess.prefetchErr = err.Error()
+			log.Info().Err(err).Str("session_id", sess.ID).Msg("next episode prefetch failed")
+			return
+		}
+		sess.prefetch = PrefetchReady
+	}()
+}
+
+// prefetchStatus reports the next-episode prefetch of sess, or nil if none
+// was started. m.mu must be held.
+func (m *Manager) prefetchStatus(sess *Session) *models.PrefetchStatus {
+	if sess.next != "" {
+		st := &models.PrefetchStatus{Status: PrefetchReady, SessionID: sess.next}
+		if next := m.sessions[sess.next]; next != nil {
+			st.Season, st.Episode = next.Season, next.Episode
+		}
+		return st
+	}
+	if sess.prefetch == "" {
+		return nil
+	}
+	return &models.PrefetchStatus{Status: sess.prefetch, Error: sess.prefetchErr}
+}
+
+// rankNextCandidates orders search results for the next episode: releases
+// from the same provider and in the same quality as the current one first,
+// then by seeders.
+func rankNextCandidates(results []models.TorrentResult, provider, quality string) {
+	score := func(r models.TorrentResult) int {
+		s := 0
+		if provider != "" && r.Provider == provider {
+			s += 2
+		}
+		if quality != "" && quality != "unknown" && strings.EqualFold(r.Quality, quality) {
+			s++
+		}
+		return s
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if si, sj := score(results[i]), score(results[j]); si != sj {
+			return si > sj
+		}
+		return results[i].Seeds > results[j].Seeds
+	})
+}
+
+// Next prepares the episode after the one playing in sessionID and returns
+// its session. The same torrent (season pack) is checked first, then TV
+// search results for the current and the following season, preferring the
+// current release's provider and quality. The new session is pre-buffered in
+// the background; repeated calls return the same session.
+func (m *Manager) Next(ctx context.Context, sessionID string) (*models.StreamSession, error) {
+	sess := m.lookup(sessionID)
+	if sess == nil {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	m.nextMu.Lock()
+	defer m.nextMu.Unlock()
+
+	m.mu.RLock()
+	next := m.sessions[sess.next]
+	season, episode := sess.Season, sess.Episode
+	provider, quality := sess.provider, sess.quality
+	m.mu.RUnlock()
+	if next != nil {
+		return &next.StreamSession, nil
+	}
+
+	if season == 0 || episode == 0 {
+		var ok bool
+		if season, episode, ok = parseEpisode(sess.FilePath); !ok {
+			return nil, fmt.Errorf("session %s is not a tv episode", sessionID)
+		}
+	}
+
+	targets := [][2]int{{season, episode + 1}, {season + 1, 1}}
+
+	// Season packs usually contain the next episode already.
+	if sess.torrent != nil {
+		for _, tg := range targets {
+			if idx := findEpisodeFile(sess.torrent.Files(), tg[0], tg[1]); idx >= 0 {
+				return m.startNext(sess, sess.MagnetURI, idx, tg[0], tg[1], provider, quality)
+			}
+		}
+	}
+
+	if m.providers == nil {
+		return nil, fmt.Errorf("next episode not in torrent and no providers configured")
+	}
+
+	for _, tg := range targets {
+		results, _, _ := m.providers.SearchTV(ctx, sess.Title, tg[0], tg[1], "")
+		rankNextCandidates(results, provider, quality)
+
+		tried := 0
+		for _, r := range results {
+			if tried >= nextSearchCandidates {
+				break
+			}
+			if r.MagnetURI == "" || r.Seeds == 0 {
+				continue
+			}
+			if mg, err := ParseMagnet(r.MagnetURI); err != nil || mg.InfoHash.HexString() == sess.InfoHash {
+				continue
+			}
+			tried++
+
+			t, err := m.addMagnet(r.MagnetURI)
+			if err != nil {
+				log.Debug().Err(err).Str("release", r.Title).Msg("next episode candidate unavailable")
+				continue
+			}
+			idx := findEpisodeFile(t.Files(), tg[0], tg[1])
+			if idx >= 0 {
+				next, err := m.startNext(sess, r.MagnetURI, idx, tg[0], tg[1], r.Provider, r.Quality)
+				m.releaseTorrent(t) // the session holds its own reference
+				return next, err
+			}
+			m.releaseTorrent(t)
+		}
+	}
+
+	return nil, fmt.Errorf("next episode after S%02dE%02d not found", season, episode)
+}
+
+// startNext starts the next-episode session, links it to prev and begins
+// pre-buffering its first bytes. provider and quality describe the release.
+func (m *Manager) startNext(prev *Session, magnetURI string, fileIndex, season, episode int, provider, quality string) (*models.StreamSession, error) {
+	next, err := m.startTorrentSession(uuid.New().String(), prev.TMDbID, prev.Title, magnetURI, fileIndex, "")
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	next.Season, next.Episode = season, episode
+	next.provider, next.quality = provider, quality
+	next.year = prev.year
+	next.isNext = true
+	prev.next = next.ID
+	lang := prev.audioLanguage
+	m.mu.Unlock()
+	m.setAudioLanguage(next, lang)
+	m.persist(next)
+
+	go func() {
+		r := next.NewReader()
+		defer r.Close()
+		if _, err := io.CopyN(io.Discard, r, nextPrebufferBytes); err != nil && err != io.EOF {
+			log.Debug().Err(err).Str("session_id", next.ID).Msg("next episode prebuffer stopped")
+		}
+	}()
+
+	log.Info().
+		Str("session_id", prev.ID).
+		Str("next_id", next.ID).
+		Int("season", season).
+		Int("episode", episode).
+		Msg("next episode prepared")
+
+	return &next.StreamSession, nil
+}
@@ -0,0 +1,274 @@
+package torrent
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/anacrolix/torrent/iplist"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/httpclient"
+)
+
+// maxBlocklist bounds the (uncompressed) size of a blocklist; the common
+// level1 lists are well under 20MB.
+const maxBlocklist = 64 << 20
+
+// Blocklist filters peers (and DHT nodes) whose address falls in a list of
+// IP ranges, loaded from a file or URL and reloaded periodically. Lists can
+// be in the PeerGuardian P2P format ("description:first-last"), the eMule
+// ipfilter.dat format ("first - last , level , description") or CIDRs, one
+// per line and optionally gzipped. Until the first load nothing is blocked.
+type Blocklist struct {
+	source string
+	http   *httpclient.Client
+
+	ranges atomic.Pointer[blockRanges]
+}
+
+// blockRanges are the loaded ranges, split by address family so each list
+// is sorted on addresses of the same length.
+type blockRanges struct {
+	v4, v6 *iplist.IPList
+}
+
+// NewBlocklist creates a blocklist loaded from source, a file path or an
+// http(s) URL (see Start).
+func NewBlocklist(source string, opts httpclient.Options) *Blocklist {
+	return &Blocklist{source: source, http: httpclient.New(opts)}
+}
+
+// Lookup returns the range containing ip, if it is blocked. It implements
+// iplist.Ranger for the client config.
+func (b *Blocklist) Lookup(ip net.IP) (iplist.Range, bool) {
+	r := b.ranges.Load()
+	if r == nil {
+		return iplist.Range{}, false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return r.v4.Lookup(v4)
+	}
+	return r.v6.Lookup(ip)
+}
+
+// NumRanges returns the number of ranges loaded.
+func (b *Blocklist) NumRanges() int {
+	r := b.ranges.Load()
+	if r == nil {
+		return 0
+	}
+	return r.v4.NumRanges() + r.v6.NumRanges()
+}
+
+// Start loads the list now and then every interval until ctx is done.
+func (b *Blocklist) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := b.Load(ctx); err != nil {
+				log.Warn().Err(err).Str("source", b.source).Msg("ip blocklist load failed")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Load reads the list from its source and replaces the loaded ranges. Lines
+// that can't be parsed are skipped; the previous ranges are kept if the
+// source can't be read or has no valid ranges.
+func (b *Blocklist) Load(ctx context.Context) error {
+	body, err := b.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	br := bufio.NewReader(body)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("read ip blocklist: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var v4, v6 []iplist.Range
+	skipped := 0
+	sc := bufio.NewScanner(io.LimitReader(r, maxBlocklist))
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		rng, ok, err := parseBlocklistLine(sc.Text())
+		switch {
+		case err != nil:
+			skipped++
+		case !ok:
+		case len(rng.First) == net.IPv4len:
+			v4 = append(v4, rng)
+		default:
+			v6 = append(v6, rng)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read ip blocklist: %w", err)
+	}
+	if len(v4)+len(v6) == 0 {
+		return fmt.Errorf("ip blocklist has no valid ranges (%d lines skipped)", skipped)
+	}
+
+	ranges := &blockRanges{v4: iplist.New(mergeRanges(v4)), v6: iplist.New(mergeRanges(v6))}
+	b.ranges.Store(ranges)
+	log.Info().Int("ranges", ranges.v4.NumRanges()+ranges.v6.NumRanges()).Int("skipped_lines", skipped).
+		Str("source", b.source).Msg("ip blocklist loaded")
+	return nil
+}
+
+// open returns the list's raw contents from its file or URL.
+func (b *Blocklist) open(ctx context.Context) (io.ReadCloser, error) {
+	if !strings.HasPrefix(b.source, "http://") && !strings.HasPrefix(b.source, "https://") {
+		f, err := os.Open(b.source)
+		if err != nil {
+			return nil, fmt.Errorf("open ip blocklist: %w", err)
+		}
+		return f, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build ip blocklist request: %w", err)
+	}
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch ip blocklist: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch ip blocklist: status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// parseBlocklistLine parses one line of a blocklist. ok is false for blank
+// lines, comments and eMule entries whose access level allows the range.
+func parseBlocklistLine(line string) (r iplist.Range, ok bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") || strings.HasPrefix(line, ";") {
+		return r, false, nil
+	}
+
+	// PeerGuardian P2P: "description:first-last". The description may
+	// contain colons and commas, so split at the last colon.
+	if i := strings.LastIndex(line, ":"); i >= 0 && strings.Count(line[i+1:], ".") == 6 {
+		r.Description = line[:i]
+		r.First, r.Last, err = parseIPRange(line[i+1:])
+		return r, err == nil, err
+	}
+
+	// eMule ipfilter.dat: "first - last , level , description"; levels
+	// above 127 allow the range.
+	if fields := strings.SplitN(line, ",", 3); len(fields) >= 2 {
+		level, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return r, false, fmt.Errorf("bad access level %q", fields[1])
+		}
+		if level > 127 {
+			return r, false, nil
+		}
+		if len(fields) == 3 {
+			r.Description = strings.TrimSpace(fields[2])
+		}
+		r.First, r.Last, err = parseIPRange(fields[0])
+		return r, err == nil, err
+	}
+
+	// CIDR, e.g. "10.0.0.0/8".
+	if strings.Contains(line, "/") {
+		_, n, err := net.ParseCIDR(line)
+		if err != nil {
+			return r, false, err
+		}
+		r.First, r.Last = normalizeIP(n.IP), normalizeIP(iplist.IPNetLast(n))
+		return r, true, nil
+	}
+
+	// A bare range or address.
+	r.First, r.Last, err = parseIPRange(line)
+	return r, err == nil, err
+}
+
+// parseIPRange parses "first-last" or a single address.
+func parseIPRange(s string) (first, last net.IP, err error) {
+	lo, hi, found := strings.Cut(s, "-")
+	if first = parseBlocklistIP(lo); first == nil {
+		return nil, nil, fmt.Errorf("bad address %q", lo)
+	}
+	if !found {
+		return first, first, nil
+	}
+	if last = parseBlocklistIP(hi); last == nil || len(last) != len(first) || bytes.Compare(first, last) > 0 {
+		return nil, nil, fmt.Errorf("bad range %q", s)
+	}
+	return first, last, nil
+}
+
+// parseBlocklistIP parses an address, allowing the zero-padded IPv4 octets
+// of ipfilter.dat files ("001.002.003.004").
+func parseBlocklistIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if octets := strings.Split(s, "."); len(octets) == 4 {
+		for i, o := range octets {
+			if trimmed := strings.TrimLeft(o, "0"); trimmed != "" {
+				octets[i] = trimmed
+			} else if o != "" {
+				octets[i] = "0"
+			}
+		}
+		s = strings.Join(octets, ".")
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	return normalizeIP(ip)
+}
+
+// normalizeIP returns IPv4 addresses in their 4-byte form.
+func normalizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// mergeRanges sorts ranges of one address family and merges overlapping
+// ones, as iplist.New requires.
+func mergeRanges(ranges []iplist.Range) []iplist.Range {
+	slices.SortFunc(ranges, func(a, b iplist.Range) int { return bytes.Compare(a.First, b.First) })
+	out := ranges[:0]
+	for _, r := range ranges {
+		if n := len(out); n > 0 && bytes.Compare(r.First, out[n-1].Last) <= 0 {
+			if bytes.Compare(r.Last, out[n-1].Last) > 0 {
+				out[n-1].Last = r.Last
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// providerBreaker is a circuit breaker per provider: after failures
+// consecutive failed searches a provider is skipped for cooldown, then
+// tried again. A success closes the breaker; a failure right after the
+// cooldown opens it again.
+type providerBreaker struct {
+	failures int
+	cooldown time.Duration
+
+	mu    sync.Mutex
+	state map[string]*breakerState
+}
+
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+}
+
+func newProviderBreaker(failures int, cooldown time.Duration) *providerBreaker {
+	return &providerBreaker{failures: failures, cooldown: cooldown, state: make(map[string]*breakerState)}
+}
+
+// allow reports whether provider may be searched, and if not, when it may
+// be again. A nil breaker allows everything.
+func (b *providerBreaker) allow(provider string) (time.Time, bool) {
+	if b == nil {
+		return time.Time{}, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.state[provider]
+	if !ok || !time.Now().Before(st.openUntil) {
+		return time.Time{}, true
+	}
+	return st.openUntil, false
+}
+
+// record counts a search's outcome, opening the breaker once provider has
+// failed too many times in a row.
+func (b *providerBreaker) record(provider string, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if st, ok := b.state[provider]; ok && st.failures >= b.failures {
+			log.Info().Str("provider", provider).Msg("torrent provider recovered")
+		}
+		delete(b.state, provider)
+		return
+	}
+
+	st, ok := b.state[provider]
+	if !ok {
+		st = &breakerState{}
+		b.state[provider] = st
+	}
+	st.failures++
+	if st.failures >= b.failures {
+		st.openUntil = time.Now().Add(b.cooldown)
+		log.Warn().Err(err).Str("provider", provider).Int("failures", st.failures).
+			Time("retry_after", st.openUntil).Msg("torrent provider failing, skipping it")
+	}
+}
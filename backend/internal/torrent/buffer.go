@@ -0,0 +1,61 @@
+package torrent
+
+import (
+	"strings"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// bufferStatus describes the data downloaded ahead of where the session's
+// file was last read, or nil if it hasn't been read yet. Reads are those of
+// the readers from NewReader, the ones serving players, transcodes and
+// segments. duration is the session's, read under the manager's lock.
+func (s *Session) bufferStatus(duration float64) *models.BufferStatus {
+	pos := s.readPos.Load()
+	if s.file == nil || pos <= 0 || s.torrent.Info() == nil {
+		return nil
+	}
+	pieceLen := s.torrent.Info().PieceLength
+	length := s.file.Length()
+	if pieceLen <= 0 || length == 0 {
+		return nil
+	}
+	pos = min(pos, length)
+	pieceAt := func(b int64) int {
+		return int((s.file.Offset() + min(b, length-1)) / pieceLen)
+	}
+
+	st := &models.BufferStatus{Offset: pos}
+	first, last := pieceAt(pos), pieceAt(pos+playheadReadaheadBytes)
+	var sb strings.Builder
+	sb.Grow(last - first + 1)
+	contiguous := pos < length
+	for i := first; i <= last; i++ {
+		complete := s.torrent.Piece(i).State().Complete
+		if complete {
+			sb.WriteByte('1')
+		} else {
+			sb.WriteByte('0')
+			contiguous = false
+		}
+		if contiguous {
+			end := min(int64(i+1)*pieceLen-s.file.Offset(), length)
+			st.AheadBytes = end - pos
+		}
+	}
+	st.Pieces = sb.String()
+
+	// Past the window, count on until the first missing piece.
+	for i := last + 1; contiguous && i < s.file.EndPieceIndex(); i++ {
+		if !s.torrent.Piece(i).State().Complete {
+			break
+		}
+		end := min(int64(i+1)*pieceLen-s.file.Offset(), length)
+		st.AheadBytes = end - pos
+	}
+
+	if duration > 0 && s.FileSize > 0 {
+		st.AheadSeconds = float64(st.AheadBytes) / float64(s.FileSize) * duration
+	}
+	return st
+}
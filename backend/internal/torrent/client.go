@@ -2,24 +2,56 @@ package torrent
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
+	"github.com/streambox/backend/internal/httpclient"
+	"golang.org/x/time/rate"
 )
 
 // TorrentClient wraps the anacrolix/torrent client for BitTorrent operations.
 type TorrentClient struct {
 	client  *torrent.Client
 	dataDir string
+
+	// Global peer transfer limits, adjustable at runtime (see ratelimit.go)
+	downLimiter *rate.Limiter
+	upLimiter   *rate.Limiter
+
+	// scrapeHTTPClient is used for HTTP tracker scrapes.
+	scrapeHTTPClient *httpclient.Client
+	// trackerProxied disables UDP tracker scrapes, which can't be proxied.
+	trackerProxied bool
+
+	rates    rateSample   // last transfer totals, for Rates (see stats.go)
+	trackers *TrackerList // added to public torrents (see trackers.go)
+}
+
+// ClientOptions configures NewClient.
+type ClientOptions struct {
+	Proxies ProxyOptions
+	// Blocklist, if not nil, refuses peers in its ranges.
+	Blocklist *Blocklist
+	// SeedWhileDownloading uploads to any peer while torrents are still
+	// downloading, rather than only in exchange for data.
+	SeedWhileDownloading bool
 }
 
 // NewClient creates a new torrent client that stores data in dataDir.
-func NewClient(dataDir string) (*TorrentClient, error) {
+func NewClient(dataDir string, opts ClientOptions) (*TorrentClient, error) {
 	cfg := torrent.NewDefaultClientConfig()
 	cfg.DataDir = dataDir
 	cfg.DefaultStorage = storage.NewFileByInfoHash(dataDir)
 	cfg.ListenPort = 6881
-	cfg.Seed = false
+	// Uploads are allowed or not per torrent by the seeding policy (see
+	// seeding.go); until a torrent's data is complete, they are only made in
+	// exchange for data unless seeding while downloading.
+	cfg.Seed = true
+	cfg.DisableAggressiveUpload = !opts.SeedWhileDownloading
 	cfg.EstablishedConnsPerTorrent = 80
 	cfg.NoDHT = false
 	cfg.DisableTrackers = false
@@ -27,29 +59,144 @@ func NewClient(dataDir string) (*TorrentClient, error) {
 		Preferred:        true,
 		RequirePreferred: false,
 	}
+	// Own limiters rather than the library's shared unlimited default, so
+	// SetRateLimits can change them in place.
+	downLimiter := rate.NewLimiter(rate.Inf, 0)
+	upLimiter := rate.NewLimiter(rate.Inf, 0)
+	cfg.DownloadRateLimiter = downLimiter
+	cfg.UploadRateLimiter = upLimiter
+	if opts.Blocklist != nil {
+		// The client keeps the Ranger it was created with; reloads swap
+		// the ranges behind it.
+		cfg.IPBlocklist = opts.Blocklist
+	}
+
+	peerDialer, err := applyProxies(cfg, opts.Proxies)
+	if err != nil {
+		return nil, err
+	}
 
 	client, err := torrent.NewClient(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("create torrent client: %w", err)
 	}
+	if peerDialer != nil {
+		client.AddDialer(peerDialer)
+	}
 
 	return &TorrentClient{
-		client:  client,
-		dataDir: dataDir,
+		client:           client,
+		dataDir:          dataDir,
+		downLimiter:      downLimiter,
+		upLimiter:        upLimiter,
+		scrapeHTTPClient: httpclient.New(httpclient.Options{Timeout: 10 * time.Second, ProxyURL: opts.Proxies.TrackerProxy}),
+		trackerProxied:   opts.Proxies.TrackerProxy != "",
 	}, nil
 }
 
-// AddMagnet adds a magnet URI and waits for the torrent metadata to be retrieved.
-func (tc *TorrentClient) AddMagnet(magnetURI string) (*torrent.Torrent, error) {
-	t, err := tc.client.AddMagnet(magnetURI)
+// activeTorrent returns the torrent with the given hex info hash if it is
+// active in the client.
+func (tc *TorrentClient) activeTorrent(infoHash string) (*torrent.Torrent, bool) {
+	var h metainfo.Hash
+	if err := h.FromHexString(infoHash); err != nil {
+		return nil, false
+	}
+	return tc.client.Torrent(h)
+}
+
+// AddMagnetNoWait adds a magnet URI or bare info hash without waiting for
+// metadata. The returned bool reports whether the torrent was newly added
+// (false if it was already active in the client, e.g. for a running stream
+// session). Torrents saved with SaveMetainfo or uploaded as .torrent files
+// get their metadata from disk, so they start without peers. An active
+// torrent is returned as it is, so sessions for other files of it (e.g.
+// episodes of a season pack) share its peers and downloaded pieces.
+func (tc *TorrentClient) AddMagnetNoWait(magnetURI string) (*torrent.Torrent, bool, error) {
+	magnet, err := ParseMagnet(magnetURI)
+	if err != nil {
+		return nil, false, err
+	}
+	if t, ok := tc.client.Torrent(magnet.InfoHash); ok {
+		return t, false, nil
+	}
+	spec, err := torrent.TorrentSpecFromMagnetUri(magnet.String())
+	if err != nil {
+		return nil, false, fmt.Errorf("parse magnet: %w", err)
+	}
+	if mi, err := metainfo.LoadFromFile(tc.metainfoPath(spec.InfoHash.HexString())); err == nil {
+		if saved, err := torrent.TorrentSpecFromMetaInfoErr(mi); err == nil {
+			spec = saved
+		}
+	}
+	t, isNew, err := tc.client.AddTorrentSpec(spec)
+	if err != nil {
+		return nil, false, fmt.Errorf("add magnet: %w", err)
+	}
+	if isNew {
+		tc.addExtraTrackers(t, spec.Trackers)
+	}
+	return t, isNew, nil
+}
+
+// SaveMetainfo stores a torrent's metadata next to its data, so downloaded
+// files can be played back offline.
+func (tc *TorrentClient) SaveMetainfo(t *torrent.Torrent) error {
+	mi := t.Metainfo()
+	return tc.writeMetainfo(&mi, t.InfoHash().HexString())
+}
+
+func (tc *TorrentClient) writeMetainfo(mi *metainfo.MetaInfo, infoHash string) error {
+	f, err := os.Create(tc.metainfoPath(infoHash))
 	if err != nil {
-		return nil, fmt.Errorf("add magnet: %w", err)
+		return fmt.Errorf("create metainfo file: %w", err)
+	}
+	defer f.Close()
+	if err := mi.Write(f); err != nil {
+		return fmt.Errorf("write metainfo: %w", err)
+	}
+	return nil
+}
+
+// RemoveData deletes the downloaded data and saved metadata of a torrent.
+// The torrent must not be active in the client.
+func (tc *TorrentClient) RemoveData(infoHash string) error {
+	if err := os.RemoveAll(filepath.Join(tc.dataDir, infoHash)); err != nil {
+		return fmt.Errorf("remove torrent data: %w", err)
 	}
-	<-t.GotInfo()
-	return t, nil
+	if err := os.Remove(tc.metainfoPath(infoHash)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove metainfo: %w", err)
+	}
+	return nil
+}
+
+func (tc *TorrentClient) metainfoPath(infoHash string) string {
+	return filepath.Join(tc.dataDir, infoHash+".torrent")
+}
+
+// dataPath returns where a torrent's file is stored on disk (see
+// storage.NewFileByInfoHash). Only its completed pieces hold data.
+func (tc *TorrentClient) dataPath(infoHash string, f *torrent.File) string {
+	return filepath.Join(tc.dataDir, infoHash, filepath.FromSlash(f.Path()))
+}
+
+// DataTransferred returns the payload bytes downloaded from and uploaded to
+// peers since startup.
+func (tc *TorrentClient) DataTransferred() (downloaded, uploaded int64) {
+	stats := tc.client.Stats()
+	return stats.BytesReadData.Int64(), stats.BytesWrittenData.Int64()
 }
 
 // Close shuts down the torrent client.
 func (tc *TorrentClient) Close() {
 	tc.client.Close()
 }
+
+// Closed reports whether the client has shut down.
+func (tc *TorrentClient) Closed() bool {
+	select {
+	case <-tc.client.Closed():
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,460 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// downloadPollInterval is how often unfinished downloads are checked for
+// completion.
+const downloadPollInterval = 5 * time.Second
+
+var (
+	// ErrDownloadNotFound is returned for unknown download IDs.
+	ErrDownloadNotFound = errors.New("download not found")
+	// ErrDownloadState is returned when an action doesn't apply to the
+	// download's current status (e.g. pausing a completed download).
+	ErrDownloadState = errors.New("invalid download state")
+)
+
+// download holds the runtime state of an unfinished download. Unlike stream
+// sessions, the whole file is wanted at normal priority, so it is fetched to
+// completion regardless of playback.
+type download struct {
+	models.Download
+	torrent *atorrent.Torrent // nil until added to the client
+	file    *atorrent.File    // nil until metadata arrives
+	done    chan struct{}     // closed when the download is deleted
+
+	lastBytes int64
+	lastCheck time.Time
+}
+
+// StartDownload queues a torrent file (by fileIndex, or the largest video
+// file if negative) for download to completion.
+func (m *Manager) StartDownload(tmdbID int, title string, season, episode int, magnetURI string, fileIndex int) (*models.Download, error) {
+	if m.db == nil {
+		return nil, errors.New("downloads need a database")
+	}
+	mg, err := ParseMagnet(magnetURI)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &download{
+		Download: models.Download{
+			ID:        uuid.New().String(),
+			TMDbID:    tmdbID,
+			Title:     title,
+			Season:    season,
+			Episode:   episode,
+			MagnetURI: mg.String(),
+			InfoHash:  mg.InfoHash.HexString(),
+			FileIndex: fileIndex,
+			Status:    models.DownloadQueued,
+		},
+		done: make(chan struct{}),
+	}
+	if err := m.db.SaveDownload(&d.Download); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.downloads[d.ID] = d
+	m.mu.Unlock()
+	go m.runDownload(d)
+
+	log.Info().Str("download_id", d.ID).Str("title", title).Msg("download queued")
+	return m.GetDownload(d.ID)
+}
+
+// RestoreDownloads resumes the downloads that were unfinished at the last
+// shutdown. Paused downloads are re-added but stay paused.
+func (m *Manager) RestoreDownloads() {
+	if m.db == nil {
+		return
+	}
+	recs, err := m.db.ListDownloads("")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load downloads")
+		return
+	}
+
+	for _, rec := range recs {
+		switch rec.Status {
+		case models.DownloadQueued, models.DownloadDownloading, models.DownloadPaused:
+			if rec.Status == models.DownloadDownloading {
+				rec.Status = models.DownloadQueued
+			}
+			d := &download{Download: rec, done: make(chan struct{})}
+			m.mu.Lock()
+			m.downloads[d.ID] = d
+			m.mu.Unlock()
+			go m.runDownload(d)
+		}
+	}
+}
+
+// runDownload adds the torrent, waits for its metadata and then for the file
+// to complete.
+func (m *Manager) runDownload(d *download) {
+	t, err := m.acquireTorrent(d.MagnetURI)
+	if err != nil {
+		m.failDownload(d, err)
+		return
+	}
+
+	m.mu.Lock()
+	select {
+	case <-d.done:
+		// Deleted while the torrent was being added.
+		m.mu.Unlock()
+		m.releaseTorrent(t)
+		return
+	default:
+	}
+	d.torrent = t
+	m.mu.Unlock()
+
+	// Unlike streams, downloads wait for metadata as long as it takes.
+	select {
+	case <-t.GotInfo():
+	case <-d.done:
+		return
+	}
+
+	f, fileIndex := selectFile(t, d.FileIndex, d.FilePath)
+	if f == nil {
+		m.failDownload(d, errors.New("no video file found in torrent"))
+		return
+	}
+	if err := m.client.SaveMetainfo(t); err != nil {
+		log.Warn().Err(err).Str("download_id", d.ID).Msg("failed to save torrent metadata")
+	}
+
+	m.mu.Lock()
+	if m.downloads[d.ID] != d {
+		m.mu.Unlock()
+		return // deleted meanwhile
+	}
+	d.file = f
+	d.FileIndex = fileIndex
+	d.FilePath = f.DisplayPath()
+	d.FileSize = f.Length()
+	paused := d.Status == models.DownloadPaused
+	if !paused {
+		d.Status = models.DownloadDownloading
+	}
+	rec := d.Download
+	m.mu.Unlock()
+
+	if !paused {
+		f.Download()
+	}
+	m.saveDownload(&rec)
+
+	ticker := time.NewTicker(downloadPollInterval)
+	defer ticker.Stop()
+	for {
+		if f.BytesCompleted() == f.Length() {
+			m.completeDownload(d)
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-d.done:
+			return
+		}
+	}
+}
+
+func (m *Manager) completeDownload(d *download) {
+	m.mu.Lock()
+	if m.downloads[d.ID] != d {
+		m.mu.Unlock()
+		return // deleted meanwhile
+	}
+	delete(m.downloads, d.ID)
+	d.Status = models.DownloadCompleted
+	rec := d.Download
+	m.mu.Unlock()
+
+	m.saveDownload(&rec)
+	m.releaseTorrent(d.torrent)
+	log.Info().Str("download_id", d.ID).Str("file", d.FilePath).Msg("download completed")
+	m.downloadFinished(rec)
+}
+
+func (m *Manager) failDownload(d *download, err error) {
+	m.mu.Lock()
+	if m.downloads[d.ID] != d {
+		m.mu.Unlock()
+		return // deleted meanwhile
+	}
+	delete(m.downloads, d.ID)
+	d.Status = models.DownloadFailed
+	d.Error = err.Error()
+	rec := d.Download
+	m.mu.Unlock()
+
+	m.saveDownload(&rec)
+	if d.torrent != nil {
+		m.releaseTorrent(d.torrent)
+	}
+	log.Warn().Err(err).Str("download_id", d.ID).Msg("download failed")
+	m.downloadFinished(rec)
+}
+
+// OnDownloadFinished registers fn to be called, in its own goroutine, with
+// each download that completes or fails. Must be called before any download
+// starts.
+func (m *Manager) OnDownloadFinished(fn func(models.Download)) {
+	m.downloadHooks = append(m.downloadHooks, fn)
+}
+
+func (m *Manager) downloadFinished(rec models.Download) {
+	for _, fn := range m.downloadHooks {
+		go fn(rec)
+	}
+}
+
+func (m *Manager) saveDownload(rec *models.Download) {
+	if err := m.db.SaveDownload(rec); err != nil {
+		log.Warn().Err(err).Str("download_id", rec.ID).Msg("failed to persist download")
+	}
+}
+
+// PauseDownload stops fetching an unfinished download. Streams of the same
+// torrent keep working.
+func (m *Manager) PauseDownload(id string) (*models.Download, error) {
+	m.mu.Lock()
+	d := m.downloads[id]
+	if d == nil {
+		m.mu.Unlock()
+		return nil, m.stateError(id)
+	}
+	d.Status = models.DownloadPaused
+	f := d.file
+	rec := d.Download
+	m.mu.Unlock()
+
+	if f != nil {
+		f.SetPriority(atorrent.PiecePriorityNone)
+	}
+	m.saveDownload(&rec)
+	return m.GetDownload(id)
+}
+
+// ResumeDownload continues a paused download or retries a failed one.
+func (m *Manager) ResumeDownload(id string) (*models.Download, error) {
+	m.mu.Lock()
+	d := m.downloads[id]
+	if d != nil {
+		f := d.file
+		if d.Status == models.DownloadPaused {
+			d.Status = models.DownloadQueued
+			if f != nil {
+				d.Status = models.DownloadDownloading
+			}
+		}
+		rec := d.Download
+		m.mu.Unlock()
+
+		if f != nil {
+			f.Download()
+		}
+		m.saveDownload(&rec)
+		return m.GetDownload(id)
+	}
+	m.mu.Unlock()
+
+	rec, err := m.db.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, ErrDownloadNotFound
+	}
+	if rec.Status != models.DownloadFailed {
+		return nil, fmt.Errorf("%w: download is %s", ErrDownloadState, rec.Status)
+	}
+
+	rec.Status, rec.Error = models.DownloadQueued, ""
+	d = &download{Download: *rec, done: make(chan struct{})}
+	m.mu.Lock()
+	m.downloads[id] = d
+	m.mu.Unlock()
+	m.saveDownload(rec)
+	go m.runDownload(d)
+	return m.GetDownload(id)
+}
+
+// DeleteDownload cancels (if unfinished) and forgets a download. With
+// removeFiles, the downloaded data is deleted too unless a stream session or
+// another download uses the same torrent.
+func (m *Manager) DeleteDownload(id string, removeFiles bool) error {
+	rec, err := m.db.GetDownload(id)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return ErrDownloadNotFound
+	}
+
+	m.mu.Lock()
+	d := m.downloads[id]
+	delete(m.downloads, id)
+	if d != nil {
+		close(d.done)
+	}
+	m.mu.Unlock()
+
+	if err := m.db.DeleteDownload(id); err != nil {
+		return err
+	}
+	if d != nil && d.torrent != nil {
+		m.releaseTorrent(d.torrent)
+	}
+
+	if removeFiles {
+		others, err := m.db.ListDownloads("")
+		if err != nil {
+			return err
+		}
+		for _, o := range others {
+			if o.InfoHash == rec.InfoHash {
+				return nil // still needed by another download
+			}
+		}
+		m.stopSeeding(rec.InfoHash)
+		if m.hasSessionFor(rec.InfoHash) {
+			log.Info().Str("info_hash", rec.InfoHash).Msg("keeping download data used by a stream session")
+			return nil
+		}
+		if err := m.client.RemoveData(rec.InfoHash); err != nil {
+			return err
+		}
+	}
+
+	log.Info().Str("download_id", id).Bool("files_removed", removeFiles).Msg("download deleted")
+	return nil
+}
+
+// GetDownload returns a download with its current progress.
+func (m *Manager) GetDownload(id string) (*models.Download, error) {
+	rec, err := m.db.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, ErrDownloadNotFound
+	}
+	m.fillProgress(rec)
+	return rec, nil
+}
+
+// Downloads lists downloads with the given status (all if empty), newest
+// first, with their current progress.
+func (m *Manager) Downloads(status string) ([]models.Download, error) {
+	if m.db == nil {
+		return nil, nil
+	}
+	recs, err := m.db.ListDownloads(status)
+	if err != nil {
+		return nil, err
+	}
+	for i := range recs {
+		m.fillProgress(&recs[i])
+	}
+	return recs, nil
+}
+
+func (m *Manager) fillProgress(rec *models.Download) {
+	if rec.Status == models.DownloadCompleted {
+		rec.DownloadedBytes = rec.FileSize
+		rec.Progress = 100
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.downloads[rec.ID]
+	if d == nil || d.file == nil {
+		return
+	}
+
+	completed := d.file.BytesCompleted()
+	now := time.Now()
+	if !d.lastCheck.IsZero() {
+		if elapsed := now.Sub(d.lastCheck).Seconds(); elapsed > 0 && completed >= d.lastBytes {
+			rec.DownloadSpeed = int64(float64(completed-d.lastBytes) / elapsed)
+		}
+	}
+	d.lastBytes, d.lastCheck = completed, now
+
+	rec.DownloadedBytes = completed
+	if rec.FileSize > 0 {
+		rec.Progress = float64(completed) / float64(rec.FileSize) * 100
+	}
+	if rec.Status == models.DownloadDownloading {
+		rec.PeersConnected = d.torrent.Stats().ActivePeers
+	}
+}
+
+// stateError explains why an action can't be applied to a download that
+// isn't running.
+func (m *Manager) stateError(id string) error {
+	rec, err := m.db.GetDownload(id)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return ErrDownloadNotFound
+	}
+	return fmt.Errorf("%w: download is %s", ErrDownloadState, rec.Status)
+}
+
+// PlayDownload returns a stream session for a download's file, reusing a
+// running one. Completed downloads play from disk without peers.
+func (m *Manager) PlayDownload(id string) (*models.StreamSession, error) {
+	rec, err := m.db.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, ErrDownloadNotFound
+	}
+
+	m.mu.RLock()
+	for _, sess := range m.sessions {
+		if sess.InfoHash == rec.InfoHash && sess.FileIndex == rec.FileIndex && !sess.isNext {
+			s := sess.StreamSession
+			m.mu.RUnlock()
+			return &s, nil
+		}
+	}
+	m.mu.RUnlock()
+
+	sess, err := m.startTorrentSession(uuid.New().String(), rec.TMDbID, rec.Title, rec.MagnetURI, rec.FileIndex, rec.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	sess.Season, sess.Episode = rec.Season, rec.Episode
+	m.persist(sess)
+	return &sess.StreamSession, nil
+}
+
+// PlaybackContentType is the content type a file is streamed as: transcoded
+// files are served as fragmented MP4.
+func PlaybackContentType(path string) string {
+	if needsTranscoding(path) {
+		return "video/mp4"
+	}
+	return detectContentType(path)
+}
@@ -0,0 +1,264 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// Stall fallback modes.
+const (
+	FallbackOff    = "off"
+	FallbackOffer  = "offer"
+	FallbackSwitch = "switch"
+)
+
+const (
+	// watchdogInterval is how often sessions are checked for stalling.
+	watchdogInterval = 10 * time.Second
+	// stallSpeed is the speed below which a session counts as stalled when
+	// its bitrate is unknown (ffprobe hasn't reported a duration).
+	stallSpeed = 64 * 1024
+	// fallbackMaxSizeRatio is the largest size, relative to the stalled
+	// release, that a fallback candidate may have.
+	fallbackMaxSizeRatio = 0.7
+)
+
+// StartStallWatchdog enables automatic fallback: when a session downloads
+// slower than its playback bitrate for longer than after, a smaller release
+// of the same title is searched for and started in the background. In
+// FallbackOffer mode the client is offered the switch; in FallbackSwitch mode
+// the offer is flagged for automatic switching. Providers must be set first.
+func (m *Manager) StartStallWatchdog(mode string, after time.Duration) {
+	if mode != FallbackOffer && mode != FallbackSwitch || m.providers == nil {
+		return
+	}
+	m.fallbackMode = mode
+	m.fallbackAfter = after
+
+	go func() {
+		ticker := time.NewTicker(watchdogInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			m.checkStalls()
+		}
+	}()
+
+	log.Info().Str("mode", mode).Dur("after", after).Msg("stall fallback watchdog started")
+}
+
+// checkStalls updates per-session stall timers and triggers fallbacks.
+func (m *Manager) checkStalls() {
+	now := time.Now()
+
+	m.mu.Lock()
+	var stalled []*Session
+	for _, sess := range m.sessions {
+		if sess.fallbackTried || sess.isFallback || sess.isNext || sess.direct != nil {
+			continue
+		}
+
+		completed := sess.file.BytesCompleted()
+		if completed >= sess.FileSize {
+			sess.stallSince = time.Time{}
+			continue
+		}
+
+		if !sess.wdCheck.IsZero() {
+			elapsed := now.Sub(sess.wdCheck).Seconds()
+			speed := float64(completed-sess.wdBytes) / elapsed
+
+			required := float64(stallSpeed)
+			if sess.Duration > 0 {
+				required = float64(sess.FileSize) / sess.Duration
+			}
+
+			if speed < required {
+				if sess.stallSince.IsZero() {
+					sess.stallSince = now
+				}
+			} else {
+				sess.stallSince = time.Time{}
+			}
+
+			if !sess.stallSince.IsZero() && now.Sub(sess.stallSince) >= m.fallbackAfter {
+				sess.fallbackTried = true
+				stalled = append(stalled, sess)
+			}
+		}
+		sess.wdBytes = completed
+		sess.wdCheck = now
+	}
+	m.mu.Unlock()
+
+	for _, sess := range stalled {
+		go m.startFallback(sess)
+	}
+}
+
+// startFallback searches for a smaller release of the stalled session's title
+// (or episode) and starts it as a background session.
+func (m *Manager) startFallback(sess *Session) {
+	log.Info().Str("session_id", sess.ID).Str("title", sess.Title).Msg("session stalled, looking for fallback release")
+
+	m.mu.RLock()
+	season, episode, year := sess.Season, sess.Episode, sess.year
+	m.mu.RUnlock()
+	if season == 0 || episode == 0 {
+		season, episode, _ = parseEpisode(sess.FilePath)
+	}
+	yearStr := ""
+	if year > 0 {
+		yearStr = strconv.Itoa(year)
+	}
+
+	var results []models.TorrentResult
+	var err error
+	if season > 0 && episode > 0 {
+		results, _, err = m.providers.SearchTV(context.Background(), sess.Title, season, episode, yearStr)
+	} else {
+		results, _, err = m.providers.Search(context.Background(), sess.Title, "", yearStr)
+	}
+	if err != nil || len(results) == 0 {
+		log.Warn().Err(err).Str("session_id", sess.ID).Msg("no fallback releases found")
+		return
+	}
+
+	opts := RankOptions{Title: sess.Title, Year: yearStr, Series: episode > 0}
+	candidate, fileIndex := m.pickFallback(results, sess, opts, season, episode)
+	if candidate == nil {
+		log.Warn().Str("session_id", sess.ID).Msg("no smaller fallback release available")
+		return
+	}
+
+	fb, err := m.StartStream(sess.TMDbID, sess.Title, candidate.MagnetURI, fileIndex)
+	if err != nil {
+		log.Warn().Err(err).Str("session_id", sess.ID).Msg("failed to start fallback release")
+		return
+	}
+	if episode > 0 {
+		m.mu.Lock()
+		if fbSess := m.sessions[fb.ID]; fbSess != nil {
+			fbSess.Season, fbSess.Episode = season, episode
+			fbSess.year = year
+		}
+		m.mu.Unlock()
+	}
+
+	offer := &models.FallbackOffer{
+		SessionID:  fb.ID,
+		Title:      candidate.Title,
+		Provider:   candidate.Provider,
+		Quality:    candidate.Quality,
+		SizeHuman:  candidate.SizeHuman,
+		Reason:     fmt.Sprintf("download below playback bitrate for %s", m.fallbackAfter),
+		AutoSwitch: m.fallbackMode == FallbackSwitch,
+	}
+
+	m.mu.Lock()
+	_, alive := m.sessions[sess.ID]
+	if fbSess := m.sessions[fb.ID]; alive && fbSess != nil {
+		fbSess.isFallback = true
+		sess.fallback = offer
+	}
+	m.mu.Unlock()
+
+	if !alive {
+		// Original session was stopped while we were preparing the fallback.
+		m.StopSession(fb.ID)
+		return
+	}
+
+	log.Info().
+		Str("session_id", sess.ID).
+		Str("fallback_id", fb.ID).
+		Str("release", candidate.Title).
+		Msg("fallback release ready")
+}
+
+// pickFallback chooses the best-seeded release that names the stalled
+// session's title (and year), isn't the same torrent and is meaningfully
+// smaller, returning it with the file to play (-1 for the largest). For an
+// episode (season > 0), releases that can't hold it are dropped and the
+// candidates' torrents opened to find its file, whose size is compared
+// rather than the whole season pack's.
+func (m *Manager) pickFallback(results []models.TorrentResult, sess *Session, opts RankOptions, season, episode int) (*models.TorrentResult, int) {
+	maxSize := int64(float64(sess.FileSize) * fallbackMaxSizeRatio)
+	if season > 0 {
+		results = selectPacks(results, season, episode)
+	}
+
+	var candidates []models.TorrentResult
+	for _, r := range results {
+		if r.MagnetURI == "" || r.Seeds == 0 || len(mismatches(r, opts)) > 0 {
+			continue
+		}
+		// A pack's size isn't its episode's; that's checked once opened.
+		if (season == 0 || r.Pack == PackEpisode) && (r.SizeBytes <= 0 || r.SizeBytes > maxSize) {
+			continue
+		}
+		if mg, err := ParseMagnet(r.MagnetURI); err == nil && mg.InfoHash.HexString() == sess.InfoHash {
+			continue
+		}
+		candidates = append(candidates, r)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Seeds > candidates[j].Seeds
+	})
+
+	if season == 0 {
+		if len(candidates) == 0 {
+			return nil, -1
+		}
+		return &candidates[0], -1
+	}
+	for i := range candidates[:min(len(candidates), nextSearchCandidates)] {
+		t, err := m.addMagnet(candidates[i].MagnetURI)
+		if err != nil {
+			log.Debug().Err(err).Str("release", candidates[i].Title).Msg("fallback candidate unavailable")
+			continue
+		}
+		m.releaseTorrentLater(t)
+		files := t.Files()
+		if idx := findEpisodeFile(files, season, episode); idx >= 0 && files[idx].Length() <= maxSize {
+			return &candidates[i], idx
+		}
+	}
+	return nil, -1
+}
+
+// AcceptFallback switches a stalled session to its prepared fallback: the
+// original session is stopped and the fallback session is returned. Clients
+// should start playing it at their current position (?t= for transcodes).
+func (m *Manager) AcceptFallback(sessionID string) (*models.StreamSession, error) {
+	m.mu.Lock()
+	sess := m.sessions[sessionID]
+	if sess == nil {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	if sess.fallback == nil {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("no fallback prepared for session %s", sessionID)
+	}
+	fb := m.sessions[sess.fallback.SessionID]
+	sess.fallback = nil
+	if fb != nil {
+		fb.isFallback = false
+	}
+	m.mu.Unlock()
+
+	if fb == nil {
+		return nil, fmt.Errorf("fallback session is gone")
+	}
+
+	if err := m.StopSession(sessionID); err != nil {
+		return nil, err
+	}
+	return &fb.StreamSession, nil
+}
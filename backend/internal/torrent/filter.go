@@ -0,0 +1,57 @@
+package torrent
+
+import (
+	"strings"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// ResultFilter narrows search results; zero fields don't filter.
+type ResultFilter struct {
+	MinSeeds int
+	// Qualities are the accepted qualities, e.g. "1080p"; "2160p", "4k"
+	// and "uhd" are the same.
+	Qualities []string
+	// MaxSizeBytes drops larger releases; those of unknown size are kept.
+	MaxSizeBytes int64
+	// AudioLanguage keeps releases with audio in the language (ISO 639
+	// code), as far as their names and descriptions tell.
+	AudioLanguage string
+}
+
+// match reports whether r passes the filter.
+func (f ResultFilter) match(r models.TorrentResult) bool {
+	if f.MinSeeds > 0 && seeds(r) < f.MinSeeds {
+		return false
+	}
+	if len(f.Qualities) > 0 {
+		quality := qualityClass(r.Quality)
+		ok := false
+		for _, q := range f.Qualities {
+			if quality != "" && qualityClass(q) == quality {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if f.MaxSizeBytes > 0 && r.SizeBytes > f.MaxSizeBytes {
+		return false
+	}
+	if lang := normalizeLanguage(f.AudioLanguage); lang != "" && !hasAudioLanguage(r, lang) {
+		return false
+	}
+	return true
+}
+
+// qualityClass lowercases a quality and maps the names of 2160p to it.
+func qualityClass(q string) string {
+	q = strings.ToLower(strings.TrimSpace(q))
+	switch q {
+	case "4k", "uhd":
+		return "2160p"
+	}
+	return q
+}
@@ -0,0 +1,147 @@
+package torrent
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/rs/zerolog/log"
+)
+
+// idleCheckInterval is how often sessions are checked for inactivity.
+const idleCheckInterval = time.Minute
+
+// activityReader records reads of a session's data as activity, so sessions
+// being streamed are never considered idle.
+type activityReader struct {
+	atorrent.Reader
+	sess   *Session
+	closed atomic.Bool
+	off    int64 // position, recorded as the session's reader position
+}
+
+func (r *activityReader) Read(b []byte) (int, error) {
+	r.sess.touch()
+	n, err := r.Reader.Read(b)
+	r.advance(n)
+	return n, err
+}
+
+func (r *activityReader) Seek(offset int64, whence int) (int64, error) {
+	off, err := r.Reader.Seek(offset, whence)
+	if err == nil {
+		r.off = off
+	}
+	return off, err
+}
+
+func (r *activityReader) advance(n int) {
+	if n > 0 {
+		r.off += int64(n)
+		r.sess.readPos.Store(r.off)
+	}
+}
+
+// Close releases the reader; closing it again is a no-op.
+func (r *activityReader) Close() error {
+	if r.closed.CompareAndSwap(false, true) {
+		r.sess.readers.Add(-1)
+	}
+	return r.Reader.Close()
+}
+
+func (r *activityReader) ReadContext(ctx context.Context, b []byte) (int, error) {
+	r.sess.touch()
+	n, err := r.Reader.ReadContext(ctx, b)
+	r.advance(n)
+	return n, err
+}
+
+func (s *Session) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+func (s *Session) idleSince() time.Time {
+	return time.Unix(0, s.lastActive.Load())
+}
+
+// StartIdleReaper unloads sessions that have been neither read from nor
+// accessed through the API for longer than ttl, so abandoned sessions stop
+// downloading. Unloaded sessions stay persisted with their playback position
+// and are restored on their next access.
+func (m *Manager) StartIdleReaper(ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(idleCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			m.reapIdle(ttl)
+		}
+	}()
+
+	log.Info().Dur("ttl", ttl).Msg("idle session reaper started")
+}
+
+// reapIdle unloads sessions idle for longer than ttl. A prepared next
+// episode counts as active while the episode before it is.
+func (m *Manager) reapIdle(ttl time.Duration) {
+	m.mu.Lock()
+	lastActive := make(map[string]time.Time, len(m.sessions))
+	for id, sess := range m.sessions {
+		lastActive[id] = sess.idleSince()
+	}
+	for _, sess := range m.sessions {
+		if t, ok := lastActive[sess.next]; ok && lastActive[sess.ID].After(t) {
+			lastActive[sess.next] = lastActive[sess.ID]
+		}
+	}
+
+	var idle []*Session
+	for id, sess := range m.sessions {
+		if time.Since(lastActive[id]) > ttl {
+			idle = append(idle, sess)
+			delete(m.sessions, id)
+			sess.release()
+		}
+	}
+	m.mu.Unlock()
+
+	for _, sess := range idle {
+		m.flush(sess)
+		if sess.reader != nil {
+			sess.reader.Close()
+		}
+		if sess.torrent != nil {
+			m.releaseTorrent(sess.torrent)
+		}
+		log.Info().
+			Str("session_id", sess.ID).
+			Time("last_active", lastActive[sess.ID]).
+			Msg("idle session unloaded")
+	}
+}
+
+// flush persists a session together with its latest playback position, so
+// it can be restored after being unloaded.
+func (m *Manager) flush(sess *Session) {
+	if m.db == nil {
+		return
+	}
+	m.mu.RLock()
+	rec := sess.StreamSession
+	m.mu.RUnlock()
+
+	// SaveSession keeps the stored position; RecordPosition throttles its
+	// writes, so flush the latest one explicitly.
+	err := m.db.SaveSession(&rec)
+	if err == nil && rec.LastPosition > 0 {
+		err = m.db.UpdateSessionPosition(rec.ID, rec.LastPosition)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("session_id", rec.ID).Msg("failed to persist session")
+	}
+}
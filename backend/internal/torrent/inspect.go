@@ -0,0 +1,123 @@
+package torrent
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// scrapeTimeout caps how long tracker/DHT scrapes may take during inspection.
+const scrapeTimeout = 8 * time.Second
+
+// ErrInvalidMagnet is returned when the input is neither a magnet URI nor an info hash.
+var ErrInvalidMagnet = errors.New("invalid magnet URI or info hash")
+
+// ParseMagnet accepts a magnet URI or a bare info hash (40-char hex or
+// 32-char base32) and returns the parsed magnet.
+func ParseMagnet(input string) (metainfo.Magnet, error) {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(strings.ToLower(input), "magnet:") {
+		m, err := metainfo.ParseMagnetUri(input)
+		if err != nil {
+			return metainfo.Magnet{}, fmt.Errorf("%w: %v", ErrInvalidMagnet, err)
+		}
+		return m, nil
+	}
+
+	var m metainfo.Magnet
+	switch len(input) {
+	case 40:
+		if err := m.InfoHash.FromHexString(input); err != nil {
+			return metainfo.Magnet{}, fmt.Errorf("%w: %v", ErrInvalidMagnet, err)
+		}
+	case 32:
+		raw, err := base32.StdEncoding.DecodeString(strings.ToUpper(input))
+		if err != nil || len(raw) != 20 {
+			return metainfo.Magnet{}, fmt.Errorf("%w: bad base32 hash", ErrInvalidMagnet)
+		}
+		copy(m.InfoHash[:], raw)
+	default:
+		return metainfo.Magnet{}, ErrInvalidMagnet
+	}
+	return m, nil
+}
+
+// Inspect parses a magnet/info hash and, if metadata arrives within timeout,
+// lists every file in the torrent. Trackers and the DHT are scraped
+// concurrently for live swarm counts. No stream session is created; the
+// torrent is kept for torrentLinger in case one is started, then dropped
+// unless something else uses it.
+func (m *Manager) Inspect(input string, timeout time.Duration) (*models.MagnetInspection, error) {
+	magnet, err := ParseMagnet(input)
+	if err != nil {
+		return nil, err
+	}
+	magnetURI := magnet.String()
+
+	result := &models.MagnetInspection{
+		InfoHash:    magnet.InfoHash.HexString(),
+		MagnetURI:   magnetURI,
+		DisplayName: magnet.DisplayName,
+		Trackers:    magnet.Trackers,
+	}
+	if result.Trackers == nil {
+		result.Trackers = []string{}
+	}
+
+	t, err := m.acquireTorrent(magnetURI)
+	if err != nil {
+		return nil, err
+	}
+	defer m.releaseTorrentLater(t)
+
+	scrapeCtx, cancel := context.WithTimeout(context.Background(), min(timeout, scrapeTimeout))
+	defer cancel()
+	swarm := make(chan *models.SwarmStats, 1)
+	go func() { swarm <- m.client.Scrape(scrapeCtx, magnet) }()
+
+	select {
+	case <-t.GotInfo():
+		result.MetadataFetched = true
+		result.Name = t.Name()
+		for i, f := range t.Files() {
+			result.Files = append(result.Files, models.TorrentFile{
+				Index:     i,
+				Path:      f.DisplayPath(),
+				Size:      f.Length(),
+				SizeHuman: formatFileSize(f.Length()),
+			})
+			result.TotalSize += f.Length()
+		}
+		result.TotalSizeHuman = formatFileSize(result.TotalSize)
+	case <-time.After(timeout):
+		log.Info().Str("info_hash", result.InfoHash).Dur("timeout", timeout).Msg("inspect: metadata timeout")
+	}
+
+	result.Swarm = <-swarm
+	return result, nil
+}
+
+// hasSessionFor reports whether any active session streams, or any
+// unfinished download fetches, the given info hash.
+func (m *Manager) hasSessionFor(infoHash string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, s := range m.sessions {
+		if s.InfoHash == infoHash {
+			return true
+		}
+	}
+	for _, d := range m.downloads {
+		if d.InfoHash == infoHash {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// Kinozal category IDs for all films and all series.
+const (
+	kinozalMovieCategory = "1002"
+	kinozalTVCategory    = "1001"
+)
+
+var (
+	kinozalIDRe   = regexp.MustCompile(`id=(\d+)`)
+	kinozalHashRe = regexp.MustCompile(`\b[0-9A-Fa-f]{40}\b`)
+)
+
+// Kinozal is a torrent search provider that scrapes kinozal.tv. Listings
+// don't carry magnets: the info hash of each top result is fetched from its
+// details, which needs a login.
+type Kinozal struct {
+	username string
+	password string
+	client   *httpclient.Client
+	jar      http.CookieJar
+	mirrors  *mirrorList
+
+	mu       sync.Mutex      // serializes logins
+	loggedIn map[string]bool // by mirror host, as each has its own cookies
+
+	detailLimit   int // results whose info hash is fetched; the rest are dropped
+	detailWorkers int // info hashes fetched at once
+}
+
+func NewKinozal(mirrors []string, username, password string, opts httpclient.Options) *Kinozal {
+	jar, _ := cookiejar.New(nil)
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = httpclient.BrowserUserAgent
+	}
+	opts.Jar = jar
+	return &Kinozal{
+		username: username,
+		password: password,
+		client:   httpclient.New(opts),
+		jar:      jar,
+		mirrors:  newMirrorList(mirrors),
+		loggedIn: make(map[string]bool),
+
+		detailLimit:   10,
+		detailWorkers: 4,
+	}
+}
+
+func (k *Kinozal) Name() string { return "kinozal" }
+
+// Search searches Kinozal's film sections.
+func (k *Kinozal) Search(ctx context.Context, title, imdbID string, year string) ([]models.TorrentResult, error) {
+	query := title
+	if year != "" {
+		query += " " + year
+	}
+	return k.doSearch(ctx, query, kinozalMovieCategory, nil)
+}
+
+// SearchTV searches Kinozal's series sections. Kinozal names season packs
+// "Title (1 сезон: 1-8 серии из 8)", so only the title is searched for, and
+// other seasons' releases are dropped before their info hashes are fetched.
+func (k *Kinozal) SearchTV(ctx context.Context, title string, seasonNum, episode int, year string) ([]models.TorrentResult, error) {
+	keep := func(res models.TorrentResult) bool {
+		return parsePack(res.Title).covers(seasonNum, episode)
+	}
+	return k.doSearch(ctx, title, kinozalTVCategory, keep)
+}
+
+// doSearch searches a category. keep, if set, drops results before their
+// info hashes are fetched.
+func (k *Kinozal) doSearch(ctx context.Context, query, category string, keep func(models.TorrentResult) bool) ([]models.TorrentResult, error) {
+	// Kinozal expects the query in its page encoding.
+	encoded, err := charmap.Windows1251.NewEncoder().String(query)
+	if err != nil {
+		encoded = query
+	}
+	// t=1 sorts by seeders.
+	searchPath := fmt.Sprintf("/browse.php?s=%s&c=%s&t=1", url.QueryEscape(encoded), category)
+
+	doc, host, err := k.page(ctx, searchPath)
+	if err != nil {
+		return nil, fmt.Errorf("kinozal search: %w", err)
+	}
+	var results []models.TorrentResult
+	for _, res := range parseKinozalResults(doc) {
+		if keep == nil || keep(res) {
+			results = append(results, res)
+		}
+	}
+
+	// Fetch info hashes for the top results, a few at a time.
+	results = results[:min(k.detailLimit, len(results))]
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, k.detailWorkers)
+	for i := range results {
+		wg.Add(1)
+		go func(res *models.TorrentResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			hash, err := k.infoHash(ctx, host, res.TopicID)
+			if err != nil {
+				log.Warn().Err(err).Str("topic", res.TopicID).Msg("failed to get kinozal info hash")
+				return
+			}
+			res.MagnetURI = "magnet:?xt=urn:btih:" + hash + "&dn=" + url.QueryEscape(res.Title)
+		}(&results[i])
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var withMagnets []models.TorrentResult
+	for _, r := range results {
+		if r.MagnetURI != "" {
+			withMagnets = append(withMagnets, r)
+		}
+	}
+	return withMagnets, nil
+}
+
+// page fetches and parses a page from the first mirror that answers,
+// logging in to it first, and returns the mirror's host.
+func (k *Kinozal) page(ctx context.Context, pagePath string) (*goquery.Document, string, error) {
+	resp, host, err := k.mirrors.do(ctx, func(host string) (*http.Response, error) {
+		if err := k.ensureLoggedIn(ctx, host); err != nil {
+			return nil, err
+		}
+		return k.client.Get(ctx, "https://"+host+pagePath)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("kinozal returned status %d", resp.StatusCode)
+	}
+	doc, err := decodeKinozalPage(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return doc, host, nil
+}
+
+// infoHash fetches the info hash of a release from host, logging in again
+// once if the session has ended.
+func (k *Kinozal) infoHash(ctx context.Context, host, id string) (string, error) {
+	detailsURL := fmt.Sprintf("https://%s/get_srv_details.php?id=%s&action=2", host, id)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := k.client.Get(ctx, detailsURL)
+		if err != nil {
+			return "", fmt.Errorf("fetch details: %w", err)
+		}
+		body, err := io.ReadAll(transform.NewReader(resp.Body, charmap.Windows1251.NewDecoder()))
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("read details: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("kinozal returned status %d", resp.StatusCode)
+		}
+
+		if hash := kinozalHashRe.FindString(string(body)); hash != "" {
+			return strings.ToLower(hash), nil
+		}
+		if attempt > 0 || !strings.Contains(string(body), "takelogin.php") {
+			return "", fmt.Errorf("no info hash in details of %s", id)
+		}
+		k.mu.Lock()
+		delete(k.loggedIn, host)
+		k.mu.Unlock()
+		if err := k.ensureLoggedIn(ctx, host); err != nil {
+			return "", err
+		}
+	}
+}
+
+// ensureLoggedIn logs in to host unless already logged in there.
+func (k *Kinozal) ensureLoggedIn(ctx context.Context, host string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.loggedIn[host] {
+		return nil
+	}
+
+	form := url.Values{
+		"username": {k.username},
+		"password": {k.password},
+		"returnto": {"/"},
+	}
+	resp, err := k.client.PostForm(ctx, "https://"+host+"/takelogin.php", form)
+	if err != nil {
+		return fmt.Errorf("kinozal login: %w", err)
+	}
+	resp.Body.Close()
+
+	u := &url.URL{Scheme: "https", Host: host, Path: "/"}
+	for _, c := range k.jar.Cookies(u) {
+		if c.Name == "uid" {
+			k.loggedIn[host] = true
+			log.Info().Str("mirror", host).Msg("kinozal login successful")
+			return nil
+		}
+	}
+	return errKinozalLogin
+}
+
+var errKinozalLogin = errors.New("kinozal login failed: check username and password")
+
+// decodeKinozalPage decodes a cp1251 page and parses it.
+func decodeKinozalPage(body io.Reader) (*goquery.Document, error) {
+	doc, err := goquery.NewDocumentFromReader(transform.NewReader(body, charmap.Windows1251.NewDecoder()))
+	if err != nil {
+		return nil, fmt.Errorf("parse page: %w", err)
+	}
+	return doc, nil
+}
+
+// parseKinozalResults extracts results from Kinozal's listing table, whose
+// names read "Дюна / Dune / 2021 / ДБ, СТ / WEB-DL (1080p)".
+func parseKinozalResults(doc *goquery.Document) []models.TorrentResult {
+	var results []models.TorrentResult
+
+	doc.Find("table.t_peer tr.bg").Each(func(i int, s *goquery.Selection) {
+		link := s.Find("td.nam a").First()
+		title := strings.TrimSpace(link.Text())
+		m := kinozalIDRe.FindStringSubmatch(link.AttrOr("href", ""))
+		if title == "" || m == nil {
+			return
+		}
+
+		// The plain "s" cells hold the comment count, size and date.
+		var sizeBytes int64
+		s.Find("td.s").EachWithBreak(func(_ int, cell *goquery.Selection) bool {
+			sizeBytes = parseHumanSize(cell.Text())
+			return sizeBytes == 0
+		})
+		seeds, _ := strconv.Atoi(strings.TrimSpace(s.Find("td.sl_s").Text()))
+		peers, _ := strconv.Atoi(strings.TrimSpace(s.Find("td.sl_p").Text()))
+
+		results = append(results, models.TorrentResult{
+			Provider:  "kinozal",
+			Title:     title,
+			Quality:   extractQuality(title),
+			SizeBytes: sizeBytes,
+			SizeHuman: formatSize(sizeBytes),
+			Seeds:     seeds,
+			Peers:     peers,
+			Audio:     extractAudio(title),
+			Source:    extractSource(title),
+			TopicID:   m[1],
+		})
+	})
+
+	return results
+}
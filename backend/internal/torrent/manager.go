@@ -1,32 +1,120 @@
 package torrent
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	atorrent "github.com/anacrolix/torrent"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/admission"
 	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/ffmpeg"
 	"github.com/streambox/backend/internal/models"
 )
 
 // Session holds the runtime state of a single streaming session.
 type Session struct {
 	models.StreamSession
-	torrent        *atorrent.Torrent
-	file           *atorrent.File
-	reader         atorrent.Reader
+	torrent *atorrent.Torrent
+	file    *atorrent.File
+	reader  atorrent.Reader
+	direct  *models.DirectStream // set instead of torrent/file for direct-source sessions
+
+	// Download speed measurement (see downloadSpeed)
+	speedMu        sync.Mutex
 	lastBytes      int64
 	lastSpeedCheck time.Time
 	lastSpeed      int64
+
+	// Stall watchdog state (see fallback.go)
+	wdBytes       int64
+	wdCheck       time.Time
+	stallSince    time.Time
+	fallbackTried bool
+	isFallback    bool
+	fallback      *models.FallbackOffer
+
+	lastPersist time.Time // last time LastPosition was written to the database
+
+	// Playhead-aware piece priorities (see priority.go)
+	prioMu    sync.Mutex
+	prioPiece int // piece at the playhead when priorities were last set
+
+	// OpenSubtitles hash of the file, computed on demand (see moviehash.go)
+	hashMu    sync.Mutex
+	movieHash string
+
+	// Binge mode (see binge.go)
+	next   string // ID of the prepared next-episode session
+	isNext bool   // prepared but not yet handed off to
+
+	// Release the session plays, for picking the next episode's release
+	provider string
+	quality  string
+	year     int // of the title, 0 if unknown; narrows fallback searches
+
+	// Automatic next-episode prefetch state (see binge.go)
+	prefetch    string
+	prefetchErr string
+
+	rateLimit *int // download limit override in KiB/s (see ratelimit.go)
+
+	audioLanguage string // the requesting profile's audio language (see audiolang.go)
+
+	// MP4 remux of the file made in the background (see remux.go)
+	remuxed      string // path; "" until finished
+	remuxedAudio int    // the audio track it holds
+
+	// Clients watching the session (see viewers.go)
+	viewersMu    sync.Mutex
+	viewers      map[string]*viewer // by IP and user agent
+	viewerReqs   int                // requests seen, numbering them
+	singlePlayer bool               // one client at a time
+
+	probed    bool                       // media info is known (see probeMedia)
+	probeDone chan struct{}              // closed when probeMedia finishes, successfully or not
+	caps      *models.ClientCapabilities // what the player can play; nil for DefaultCapabilities
+	hwFailed  bool                       // the hardware encoder failed; transcode with libx264 (see videoMode)
+	transcode models.TranscodeOptions    // TranscodeOptions over the defaults (see transcodeopts.go)
+	skipKnown bool                       // SkipMarkers are final (see skip.go)
+	start     startBuffer                // data waited for while buffering (see startbuffer.go)
+
+	lastActive atomic.Int64 // unix nanos of the last read or API access (see idle.go)
+	readers    atomic.Int32 // open readers from NewReader, i.e. streams being served
+	readPos    atomic.Int64 // byte offset a NewReader reader last read up to (see buffer.go)
+
+	release func() // frees the session's stream slot (see SetStreamLimit)
+}
+
+// WaitProbed waits up to timeout for the session's media to be probed, so
+// its play method is decided from its codecs rather than its extension.
+func (s *Session) WaitProbed(ctx context.Context, timeout time.Duration) {
+	if s.probeDone == nil {
+		return
+	}
+	select {
+	case <-s.probeDone:
+	case <-time.After(timeout):
+	case <-ctx.Done():
+	}
+}
+
+// Direct returns the resolved HTTP stream for direct-source sessions, or nil
+// for torrent-backed sessions.
+func (s *Session) Direct() *models.DirectStream {
+	return s.direct
 }
 
 // GetReader returns the torrent file reader (implements io.Reader and io.ReadSeeker).
@@ -35,11 +123,13 @@ func (s *Session) GetReader() atorrent.Reader {
 }
 
 // NewReader creates a fresh reader for concurrent access (e.g. Range requests).
+// Reads count as session activity.
 func (s *Session) NewReader() atorrent.Reader {
 	r := s.file.NewReader()
 	r.SetReadahead(16 * 1024 * 1024)
 	r.SetResponsive()
-	return r
+	s.readers.Add(1)
+	return &activityReader{Reader: r, sess: s}
 }
 
 // NewReaderAt creates a reader seeked to the given byte offset.
@@ -55,28 +145,133 @@ func (s *Session) NewReaderAt(offset int64) (atorrent.Reader, error) {
 	return r, nil
 }
 
+// RangeComplete reports whether bytes [off, off+n) of the session's file are
+// downloaded and verified. Direct-source sessions have nothing downloaded.
+func (s *Session) RangeComplete(off, n int64) bool {
+	if s.file == nil || n <= 0 {
+		return false
+	}
+	pieceLen := s.torrent.Info().PieceLength
+	if pieceLen <= 0 || off < 0 || off >= s.file.Length() {
+		return false
+	}
+	end := min(off+n, s.file.Length())
+	first := int((s.file.Offset() + off) / pieceLen)
+	last := int((s.file.Offset() + end - 1) / pieceLen)
+	for i := first; i <= last; i++ {
+		if !s.torrent.Piece(i).State().Complete {
+			return false
+		}
+	}
+	return true
+}
+
 // Manager manages active torrent streaming sessions.
 type Manager struct {
 	client   *TorrentClient
-	db       *db.DB
+	db       db.Store
 	sessions map[string]*Session
+	pending  map[string]*pendingSession // PlayAsync sessions not started yet (see resolve.go)
 	mu       sync.RWMutex
+
+	providers     *ProviderRegistry
+	fallbackMode  string
+	fallbackAfter time.Duration
+
+	sources         []DirectSource
+	metadataTimeout time.Duration
+
+	restoreMu sync.Mutex               // guards restoring
+	restoring map[string]chan struct{} // in-flight restores, closed when done
+	nextMu    sync.Mutex               // serializes next-episode preparation
+
+	downloads     map[string]*download // unfinished downloads (see downloads.go)
+	refsMu        sync.Mutex
+	torrentRefs   map[string]int           // users of each torrent by info hash (see refs.go)
+	downloadHooks []func(models.Download)  // called when a download finishes
+	stopHooks     []func(sessionID string) // called when a session stops
+	// statusHooks complete session statuses (see OnStatus)
+	statusHooks []func(sessionID string, st *models.StreamStatus)
+
+	// Seeding state by info hash, guarded by refsMu (see seeding.go)
+	seedPolicy    SeedPolicy
+	seedOverrides map[string]models.SeedOverride
+	seeds         map[string]time.Time // torrents kept to seed, since when
+	uploadBlocked map[string]bool
+
+	sessionLimit int // default session download limit in KiB/s (see ratelimit.go)
+	throttleOnce sync.Once
+
+	audioLanguages []string // preferred audio track languages (see audiolang.go)
+
+	startBufferSec int // see SetStartBuffer
+
+	transcodeDefaults models.TranscodeOptions // see SetTranscodeDefaults
+
+	streams *admission.Queue // running sessions, limited by SetStreamLimit
 }
 
-func NewManager(client *TorrentClient, database *db.DB) *Manager {
+// ErrMetadataTimeout is returned when a magnet's metadata doesn't arrive in time.
+var ErrMetadataTimeout = errors.New("timed out waiting for torrent metadata")
+
+// SetProviders sets the search providers used to find fallback releases and
+// next episodes.
+func (m *Manager) SetProviders(providers *ProviderRegistry) {
+	m.providers = providers
+}
+
+func NewManager(client *TorrentClient, database db.Store, metadataTimeout time.Duration) *Manager {
 	return &Manager{
-		client:   client,
-		db:       database,
-		sessions: make(map[string]*Session),
+		client:          client,
+		db:              database,
+		sessions:        make(map[string]*Session),
+		pending:         make(map[string]*pendingSession),
+		metadataTimeout: metadataTimeout,
+		restoring:       make(map[string]chan struct{}),
+		downloads:       make(map[string]*download),
+		torrentRefs:     make(map[string]int),
+		seedOverrides:   make(map[string]models.SeedOverride),
+		seeds:           make(map[string]time.Time),
+		uploadBlocked:   make(map[string]bool),
+		streams:         admission.NewQueue("streams", 0),
 	}
 }
 
-// ListFiles adds a magnet URI, waits for metadata, and returns all video files.
+// SetStreamLimit limits how many sessions can run at once; Play turns away
+// new ones beyond it. Sessions the server starts itself (fallbacks, next
+// episodes, restores) count but are never refused. Must be called before
+// any session starts.
+func (m *Manager) SetStreamLimit(limit int) {
+	m.streams = admission.NewQueue("streams", limit)
+}
+
+// addMagnet adds a magnet and waits up to metadataTimeout for its metadata.
+// The caller holds a reference to the torrent (see releaseTorrent); on
+// timeout it's given back, dropping the torrent unless something else uses
+// it.
+func (m *Manager) addMagnet(magnetURI string) (*atorrent.Torrent, error) {
+	t, err := m.acquireTorrent(magnetURI)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-t.GotInfo():
+		return t, nil
+	case <-time.After(m.metadataTimeout):
+		m.releaseTorrent(t)
+		return nil, ErrMetadataTimeout
+	}
+}
+
+// ListFiles adds a magnet URI, waits for metadata, and returns all video
+// files, labelled with their episode where the name has one.
 func (m *Manager) ListFiles(magnetURI string) ([]models.TorrentFile, error) {
-	t, err := m.client.AddMagnet(magnetURI)
+	t, err := m.addMagnet(magnetURI)
 	if err != nil {
 		return nil, fmt.Errorf("add magnet: %w", err)
 	}
+	m.releaseTorrentLater(t)
 
 	videoExts := map[string]bool{
 		".mp4": true, ".mkv": true, ".avi": true, ".webm": true,
@@ -89,12 +284,17 @@ func (m *Manager) ListFiles(magnetURI string) ([]models.TorrentFile, error) {
 		if !videoExts[ext] {
 			continue
 		}
-		files = append(files, models.TorrentFile{
+		file := models.TorrentFile{
 			Index:     i,
 			Path:      f.DisplayPath(),
 			Size:      f.Length(),
 			SizeHuman: formatFileSize(f.Length()),
-		})
+		}
+		if season, episode, ok := parseEpisode(f.DisplayPath()); ok {
+			file.Season, file.Episode = season, episode
+			file.Label = fmt.Sprintf("S%02dE%02d", season, episode)
+		}
+		files = append(files, file)
 	}
 
 	return files, nil
@@ -103,25 +303,29 @@ func (m *Manager) ListFiles(magnetURI string) ([]models.TorrentFile, error) {
 // StartStream adds a magnet URI to the torrent client, identifies the video
 // file (by fileIndex or largest), creates a reader, and returns a StreamSession.
 func (m *Manager) StartStream(tmdbID int, title, magnetURI string, fileIndex int) (*models.StreamSession, error) {
+	sess, err := m.startTorrentSession(uuid.New().String(), tmdbID, title, magnetURI, fileIndex, "")
+	if err != nil {
+		return nil, err
+	}
+	m.persist(sess)
+	return &sess.StreamSession, nil
+}
+
+// startTorrentSession creates and registers a torrent-backed session with the
+// given ID. The file is chosen by fileIndex (checked against filePath when
+// restoring a persisted session), then by filePath, then as the largest
+// video file.
+func (m *Manager) startTorrentSession(id string, tmdbID int, title, magnetURI string, fileIndex int, filePath string) (*Session, error) {
 	log.Info().Str("title", title).Msg("starting stream")
 
-	t, err := m.client.AddMagnet(magnetURI)
+	t, err := m.addMagnet(magnetURI)
 	if err != nil {
 		return nil, fmt.Errorf("add magnet: %w", err)
 	}
 
-	var videoFile *atorrent.File
-	if fileIndex >= 0 {
-		allFiles := t.Files()
-		if fileIndex < len(allFiles) {
-			videoFile = allFiles[fileIndex]
-		}
-	}
-	if videoFile == nil {
-		videoFile = findLargestVideoFile(t.Files())
-	}
+	videoFile, fileIndex := selectFile(t, fileIndex, filePath)
 	if videoFile == nil {
-		t.Drop()
+		m.releaseTorrent(t)
 		return nil, fmt.Errorf("no video file found in torrent")
 	}
 
@@ -130,25 +334,34 @@ func (m *Manager) StartStream(tmdbID int, title, magnetURI string, fileIndex int
 	reader.SetResponsive()
 
 	contentType := detectContentType(videoFile.DisplayPath())
-	needsTranscode := needsTranscoding(videoFile.DisplayPath())
 
 	sess := &Session{
 		StreamSession: models.StreamSession{
-			ID:             uuid.New().String(),
-			TMDbID:         tmdbID,
-			Title:          title,
-			MagnetURI:      magnetURI,
-			InfoHash:       t.InfoHash().HexString(),
-			FilePath:       videoFile.DisplayPath(),
-			FileSize:       videoFile.Length(),
-			ContentType:    contentType,
-			NeedsTranscode: needsTranscode,
-			Status:         "ready",
+			ID:          id,
+			TMDbID:      tmdbID,
+			Title:       title,
+			MagnetURI:   magnetURI,
+			InfoHash:    t.InfoHash().HexString(),
+			FilePath:    videoFile.DisplayPath(),
+			FileIndex:   fileIndex,
+			FileSize:    videoFile.Length(),
+			ContentType: contentType,
+			Container:   containerOf(videoFile.DisplayPath()),
+			Status:      m.initialStatus(),
+			AudioTrack:  -1,
+			Source:      SourceTorrent,
 		},
-		torrent: t,
-		file:    videoFile,
-		reader:  reader,
+		torrent:   t,
+		file:      videoFile,
+		reader:    reader,
+		prioPiece: -1,
+		probeDone: make(chan struct{}),
 	}
+	m.applyPlayMethod(sess)
+	// Download sequentially from the start until the client reports a playhead.
+	prioritize(sess, 0)
+	sess.touch()
+	sess.release = m.streams.Take(sess.ID)
 
 	m.mu.Lock()
 	m.sessions[sess.ID] = sess
@@ -156,42 +369,173 @@ func (m *Manager) StartStream(tmdbID int, title, magnetURI string, fileIndex int
 
 	// Probe duration and audio tracks in background
 	go m.probeMedia(sess)
+	if sess.Status == StatusBuffering {
+		go m.waitStartBuffer(sess)
+	}
 
 	log.Info().
 		Str("session_id", sess.ID).
 		Str("file", videoFile.DisplayPath()).
 		Int64("size", videoFile.Length()).
-		Bool("transcode", needsTranscode).
+		Str("play_method", sess.PlayMethod).
 		Msg("stream session created")
 
-	return &sess.StreamSession, nil
+	return sess, nil
 }
 
-// probeMedia runs ffprobe on the torrent data to extract duration and audio tracks.
+// selectFile picks a torrent's file by fileIndex (checked against filePath
+// when set), then by filePath, then as the largest video file. It returns
+// nil if the torrent has no video file.
+func selectFile(t *atorrent.Torrent, fileIndex int, filePath string) (*atorrent.File, int) {
+	allFiles := t.Files()
+	var videoFile *atorrent.File
+	if fileIndex >= 0 && fileIndex < len(allFiles) {
+		videoFile = allFiles[fileIndex]
+		if filePath != "" && videoFile.DisplayPath() != filePath {
+			videoFile = nil
+		}
+	}
+	if videoFile == nil && filePath != "" {
+		for _, f := range allFiles {
+			if f.DisplayPath() == filePath {
+				videoFile = f
+				break
+			}
+		}
+	}
+	if videoFile == nil {
+		videoFile = findLargestVideoFile(allFiles)
+	}
+	for i, f := range allFiles {
+		if f == videoFile {
+			return f, i
+		}
+	}
+	return nil, -1
+}
+
+// textSubtitleCodecs are embedded subtitle formats FFmpeg can convert to
+// WebVTT. Bitmap formats (PGS, VobSub) are skipped.
+var textSubtitleCodecs = map[string]bool{
+	"subrip": true, "ass": true, "ssa": true, "webvtt": true, "mov_text": true, "text": true,
+}
+
+const (
+	// probeHeadBytes of a torrent file are downloaded before FFprobe reads
+	// it from disk, rather than through a reader competing with playback
+	// for bandwidth; most containers describe their streams at the start.
+	probeHeadBytes = 16 * 1024 * 1024
+	// probeTailBytes are fetched as well when the head alone doesn't probe:
+	// MP4 files written without faststart keep their index at the end.
+	probeTailBytes = 8 * 1024 * 1024
+	// probeAttempts is how often a torrent file is probed, with twice as
+	// much of its head each time, before it plays without media info.
+	probeAttempts = 3
+	// probeDataTimeout is how long an attempt waits for its data.
+	probeDataTimeout = 3 * time.Minute
+)
+
+// probeMedia runs ffprobe on the downloaded start of the torrent file (or
+// the direct stream URL) to extract duration, audio tracks, text subtitle
+// tracks and chapters. If the data doesn't probe, it's probed again once
+// more is downloaded; probeDone is closed after the first attempt so
+// playback needn't wait for the retries. Without FFprobe the session plays
+// with none of them.
 func (m *Manager) probeMedia(sess *Session) {
-	r := sess.file.NewReader()
-	r.SetReadahead(10 * 1024 * 1024)
-	r.SetResponsive()
-	defer r.Close()
+	var once sync.Once
+	done := func() { once.Do(func() { close(sess.probeDone) }) }
+	defer done()
+	if !ffmpeg.Supports(ffmpeg.Probe) {
+		return
+	}
+
+	if sess.direct != nil {
+		out, err := ffprobe(sess.direct.URL, 10*1024*1024)
+		if err != nil {
+			log.Warn().Err(err).Str("session", sess.ID).Msg("ffprobe failed")
+			return
+		}
+		m.applyProbe(sess, out)
+		return
+	}
+
+	path := m.client.dataPath(sess.InfoHash, sess.file)
+	for attempt := range probeAttempts {
+		head, tail := int64(probeHeadBytes)<<attempt, int64(0)
+		if attempt > 0 {
+			tail = probeTailBytes
+		}
+		if err := m.waitProbeData(sess, head, tail); err != nil {
+			log.Info().Err(err).Str("session", sess.ID).Int("attempt", attempt+1).Msg("media probe gave up")
+			return
+		}
+		out, err := ffprobe(path, head)
+		if err == nil && m.applyProbe(sess, out) {
+			return
+		}
+		log.Debug().Err(err).Str("session", sess.ID).Int("attempt", attempt+1).Msg("ffprobe on downloaded data failed, waiting for more")
+		done()
+	}
+	log.Warn().Str("session", sess.ID).Msg("ffprobe failed")
+}
 
-	cmd := exec.Command("ffprobe",
+// waitProbeData waits until the first head and last tail bytes of the
+// session's file are downloaded, fetching the tail ahead of the rest. It
+// fails after probeDataTimeout or once the session is stopped.
+func (m *Manager) waitProbeData(sess *Session, head, tail int64) error {
+	size := sess.file.Length()
+	tailOff := max(size-tail, 0)
+	if tail > 0 {
+		pieceLen := sess.torrent.Info().PieceLength
+		if pieceLen > 0 {
+			first := int((sess.file.Offset() + tailOff) / pieceLen)
+			for i := first; i < sess.file.EndPieceIndex(); i++ {
+				sess.torrent.Piece(i).SetPriority(atorrent.PiecePriorityHigh)
+			}
+		}
+	}
+
+	deadline := time.Now().Add(probeDataTimeout)
+	for {
+		if sess.RangeComplete(0, min(head, size)) && (tail == 0 || sess.RangeComplete(tailOff, tail)) {
+			return nil
+		}
+		m.mu.RLock()
+		stopped := m.sessions[sess.ID] != sess
+		m.mu.RUnlock()
+		if stopped {
+			return fmt.Errorf("session stopped")
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("data not downloaded within %s", probeDataTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// ffprobe returns FFprobe's JSON description of input, reading up to
+// probeSize bytes to find its streams.
+func ffprobe(input string, probeSize int64) ([]byte, error) {
+	out, err := exec.Command("ffprobe",
 		"-v", "quiet",
 		"-print_format", "json",
 		"-show_format",
 		"-show_streams",
-		"-select_streams", "a",
+		"-show_chapters",
 		"-analyzeduration", "5000000",
-		"-probesize", "10000000",
-		"-i", "pipe:0",
-	)
-	cmd.Stdin = r
-
-	out, err := cmd.Output()
+		"-probesize", strconv.FormatInt(probeSize, 10),
+		"-i", input,
+	).Output()
 	if err != nil {
-		log.Warn().Err(err).Str("session", sess.ID).Msg("ffprobe failed")
-		return
+		return nil, fmt.Errorf("ffprobe: %w", err)
 	}
+	return out, nil
+}
 
+// applyProbe records the media info in FFprobe's output on the session and
+// decides its play method again. It reports false if the output names no
+// streams, i.e. the data read wasn't enough.
+func (m *Manager) applyProbe(sess *Session, out []byte) bool {
 	var probe struct {
 		Format struct {
 			Duration string `json:"duration"`
@@ -199,15 +543,37 @@ func (m *Manager) probeMedia(sess *Session) {
 		Streams []struct {
 			Index     int    `json:"index"`
 			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Channels  int    `json:"channels"`
+			PixFmt    string `json:"pix_fmt"`
+			Height    int    `json:"height"`
+			Transfer  string `json:"color_transfer"`
+			RawBits   string `json:"bits_per_raw_sample"`
 			Tags      struct {
 				Language string `json:"language"`
 				Title    string `json:"title"`
 			} `json:"tags"`
+			Disposition struct {
+				AttachedPic int `json:"attached_pic"`
+			} `json:"disposition"`
+			SideData []struct {
+				Type string `json:"side_data_type"`
+			} `json:"side_data_list"`
 		} `json:"streams"`
+		Chapters []struct {
+			StartTime string `json:"start_time"`
+			EndTime   string `json:"end_time"`
+			Tags      struct {
+				Title string `json:"title"`
+			} `json:"tags"`
+		} `json:"chapters"`
 	}
 	if err := json.Unmarshal(out, &probe); err != nil {
 		log.Warn().Err(err).Msg("parse ffprobe output")
-		return
+		return false
+	}
+	if len(probe.Streams) == 0 {
+		return false
 	}
 
 	// Parse duration
@@ -216,36 +582,122 @@ func (m *Manager) probeMedia(sess *Session) {
 		log.Warn().Err(err).Str("raw", probe.Format.Duration).Msg("parse duration")
 	}
 
-	// Parse audio tracks
-	var tracks []models.AudioTrack
-	for i, s := range probe.Streams {
-		title := s.Tags.Title
-		if title == "" {
-			lang := s.Tags.Language
-			if lang == "" {
-				lang = "und"
+	// Parse audio and subtitle tracks; indexes are per type, as used in
+	// FFmpeg's 0:a:N / 0:s:N stream specifiers.
+	var (
+		videoCodec  string
+		videoDepth  int
+		videoHeight int
+		videoHDR    string
+		tracks      []models.AudioTrack
+		subtitles   []models.SubtitleTrack
+		subIndex    int
+		canExtract  = ffmpeg.Supports(ffmpeg.SubtitleExtraction)
+	)
+	for _, s := range probe.Streams {
+		lang := s.Tags.Language
+		if lang == "" {
+			lang = "und"
+		}
+		switch s.CodecType {
+		case "video":
+			// Cover art is stored as a video stream too.
+			if videoCodec == "" && s.Disposition.AttachedPic == 0 {
+				videoCodec = s.CodecName
+				videoDepth = bitDepth(s.RawBits, s.PixFmt)
+				videoHeight = s.Height
+				dolbyVision := false
+				for _, sd := range s.SideData {
+					dolbyVision = dolbyVision || sd.Type == "DOVI configuration record"
+				}
+				videoHDR = hdrFormat(s.Transfer, dolbyVision)
+			}
+		case "audio":
+			i := len(tracks)
+			title := s.Tags.Title
+			if title == "" {
+				title = fmt.Sprintf("Track %d (%s)", i+1, lang)
 			}
-			title = fmt.Sprintf("Track %d (%s)", i+1, lang)
+			tracks = append(tracks, models.AudioTrack{
+				Index:    i,
+				Language: s.Tags.Language,
+				Title:    title,
+				Codec:    s.CodecName,
+				Channels: s.Channels,
+			})
+		case "subtitle":
+			i := subIndex
+			subIndex++
+			if !textSubtitleCodecs[s.CodecName] || !canExtract {
+				continue
+			}
+			title := s.Tags.Title
+			if title == "" {
+				title = fmt.Sprintf("Subtitles %d (%s)", i+1, lang)
+			}
+			subtitles = append(subtitles, models.SubtitleTrack{
+				Index:    i,
+				Language: s.Tags.Language,
+				Title:    title,
+				Codec:    s.CodecName,
+			})
 		}
-		tracks = append(tracks, models.AudioTrack{
-			Index:    i,
-			Language: s.Tags.Language,
-			Title:    title,
-		})
 	}
 
+	// Chapters are kept only if their times parse; untitled ones are
+	// numbered.
+	var chapters []models.Chapter
+	for i, ch := range probe.Chapters {
+		start, err1 := strconv.ParseFloat(ch.StartTime, 64)
+		end, err2 := strconv.ParseFloat(ch.EndTime, 64)
+		if err1 != nil || err2 != nil || end <= start {
+			continue
+		}
+		title := ch.Tags.Title
+		if title == "" {
+			title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		chapters = append(chapters, models.Chapter{Title: title, Start: start, End: end})
+	}
+
+	skipMarkers, skipKnown := m.skipMarkersFor(sess, chapters)
+
 	m.mu.Lock()
 	if dur > 0 {
 		sess.Duration = dur
 	}
+	sess.VideoCodec = videoCodec
+	sess.VideoBitDepth = videoDepth
+	sess.VideoHeight = videoHeight
+	sess.HDR = videoHDR
 	sess.AudioTracks = tracks
+	sess.SubtitleTracks = subtitles
+	sess.Chapters = chapters
+	sess.SkipMarkers = skipMarkers
+	sess.skipKnown = skipKnown
+	sess.probed = true
+	m.applyPlayMethod(sess)
+	selected := m.selectAudioTrack(sess)
+	if sess.StartPosition > 0 && sess.torrent != nil && dur > 0 {
+		// Resuming: fetch from the start position rather than the beginning.
+		prioritize(sess, int64(sess.StartPosition/dur*float64(sess.FileSize)))
+	}
 	m.mu.Unlock()
+	if selected {
+		m.persistAudioTrack(sess)
+	}
 
 	log.Info().
 		Str("session_id", sess.ID).
 		Float64("duration_sec", dur).
 		Int("audio_tracks", len(tracks)).
+		Int("subtitle_tracks", len(subtitles)).
+		Int("chapters", len(chapters)).
+		Str("video_codec", videoCodec).
+		Int("video_bit_depth", videoDepth).
+		Str("play_method", sess.PlayMethod).
 		Msg("probed media info")
+	return true
 }
 
 func formatDuration(seconds float64) string {
@@ -259,21 +711,106 @@ func formatDuration(seconds float64) string {
 }
 
 // GetSession returns the runtime Session by ID (used by stream server).
+// Sessions lost to a server restart are restored from the database.
 func (m *Manager) GetSession(id string) *Session {
+	return m.lookup(id)
+}
+
+// Counts returns the number of running sessions and unfinished downloads.
+func (m *Manager) Counts() (sessions, downloads int) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.sessions[id]
+	return len(m.sessions), len(m.downloads)
 }
 
-// GetStatus returns download/buffering status for a session.
-func (m *Manager) GetStatus(sessionID string) (*models.StreamStatus, error) {
+// Sessions returns a snapshot of all sessions: running ones first, then
+// persisted sessions that have not been restored since the last restart.
+// Prepared next-episode sessions are left out until playback reaches them.
+func (m *Manager) Sessions() []models.StreamSession {
+	m.mu.RLock()
+	list := make([]models.StreamSession, 0, len(m.sessions))
+	seen := make(map[string]bool, len(m.sessions))
+	for id, sess := range m.sessions {
+		seen[id] = true
+		if !sess.isNext {
+			list = append(list, sess.StreamSession)
+		}
+	}
+	m.mu.RUnlock()
+
+	if m.db == nil {
+		return list
+	}
+	recs, err := m.db.ListSessions()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to list persisted sessions")
+		return list
+	}
+	for _, rec := range recs {
+		if !seen[rec.ID] {
+			list = append(list, rec)
+		}
+	}
+	return list
+}
+
+// Active reports whether a session is loaded, without restoring it.
+func (m *Manager) Active(sessionID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sessions[sessionID] != nil
+}
+
+// Downloaded reports whether a running torrent session's file is complete.
+// Direct-source sessions are never downloaded.
+func (m *Manager) Downloaded(sessionID string) bool {
 	m.mu.RLock()
 	sess := m.sessions[sessionID]
 	m.mu.RUnlock()
+	if sess == nil || sess.file == nil {
+		return false
+	}
+	return sess.file.BytesCompleted() == sess.file.Length()
+}
 
+// GetStatus returns download/buffering status for a session.
+func (m *Manager) GetStatus(sessionID string) (*models.StreamStatus, error) {
+	if st := m.pendingStatus(sessionID); st != nil {
+		return st, nil
+	}
+	sess := m.lookup(sessionID)
 	if sess == nil {
 		return nil, fmt.Errorf("session not found: %s", sessionID)
 	}
+	return m.status(sess), nil
+}
+
+// status returns a session's status, completed by the status hooks.
+func (m *Manager) status(sess *Session) *models.StreamStatus {
+	st := m.sessionStatus(sess)
+	for _, fn := range m.statusHooks {
+		fn(sess.ID, st)
+	}
+	return st
+}
+
+func (m *Manager) sessionStatus(sess *Session) *models.StreamStatus {
+	if sess.direct != nil {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		return &models.StreamStatus{
+			Status:          sess.Status,
+			TotalBytes:      sess.FileSize,
+			BufferedPercent: 100,
+			Duration:        sess.Duration,
+			AudioTracks:     sess.AudioTracks,
+			Chapters:        sess.Chapters,
+			SkipMarkers:     sess.SkipMarkers,
+			Source:          sess.Source,
+			Viewers:         sess.Viewers(),
+			SinglePlayer:    sess.isSinglePlayer(),
+		}
+	}
 
 	t := sess.torrent
 	stats := t.Stats()
@@ -289,54 +826,236 @@ func (m *Manager) GetStatus(sessionID string) (*models.StreamStatus, error) {
 	}
 	sess.reader.SetReadahead(readahead)
 
-	// Calculate download speed
-	now := time.Now()
-	var speed int64
-	if !sess.lastSpeedCheck.IsZero() {
-		elapsed := now.Sub(sess.lastSpeedCheck).Seconds()
-		if elapsed > 0 {
-			speed = int64(float64(bytesCompleted-sess.lastBytes) / elapsed)
-			if speed < 0 {
-				speed = 0
-			}
-			sess.lastSpeed = speed
-		}
-	}
-	sess.lastBytes = bytesCompleted
-	sess.lastSpeedCheck = now
+	speed := sess.downloadSpeed(bytesCompleted)
+	sources, health := peerBreakdown(t, stats)
+
+	m.mu.RLock()
+	info := sess.StreamSession
+	fallback := sess.fallback
+	rateLimit := m.sessionRateLimit(sess)
+	prefetch := m.prefetchStatus(sess)
+	startBuffer := m.startBufferStatus(sess, speed)
+	m.mu.RUnlock()
 
 	return &models.StreamStatus{
-		Status:          sess.Status,
+		Status:          info.Status,
 		DownloadedBytes: bytesCompleted,
-		TotalBytes:      sess.FileSize,
+		TotalBytes:      info.FileSize,
 		DownloadSpeed:   speed,
 		PeersConnected:  stats.ActivePeers,
-		BufferedPercent: float64(bytesCompleted) / float64(sess.FileSize) * 100,
-		Duration:        sess.Duration,
-		AudioTracks:     sess.AudioTracks,
-	}, nil
+		BufferedPercent: float64(bytesCompleted) / float64(info.FileSize) * 100,
+		Duration:        info.Duration,
+		AudioTracks:     info.AudioTracks,
+		SubtitleTracks:  info.SubtitleTracks,
+		Chapters:        info.Chapters,
+		SkipMarkers:     info.SkipMarkers,
+		PeerSources:     sources,
+		Health:          health,
+		Fallback:        fallback,
+		Source:          info.Source,
+		RateLimitKBps:   rateLimit,
+		Prefetch:        prefetch,
+		Viewers:         sess.Viewers(),
+		SinglePlayer:    sess.isSinglePlayer(),
+		Buffer:          sess.bufferStatus(info.Duration),
+		StartBuffer:     startBuffer,
+	}
+}
+
+// speedWindow is the shortest interval download speed is measured over, so
+// callers asking at about the same time (status polls, event streams,
+// listings) get one steady reading.
+const speedWindow = 2 * time.Second
+
+// downloadSpeed returns the session's download speed in bytes/s given the
+// bytes completed now, measured since the last measurement at least
+// speedWindow ago.
+func (s *Session) downloadSpeed(completed int64) int64 {
+	s.speedMu.Lock()
+	defer s.speedMu.Unlock()
+	now := time.Now()
+	if s.lastSpeedCheck.IsZero() {
+		s.lastBytes, s.lastSpeedCheck = completed, now
+		return 0
+	}
+	elapsed := now.Sub(s.lastSpeedCheck)
+	if elapsed < speedWindow {
+		return s.lastSpeed
+	}
+	s.lastSpeed = max(int64(float64(completed-s.lastBytes)/elapsed.Seconds()), 0)
+	s.lastBytes, s.lastSpeedCheck = completed, now
+	return s.lastSpeed
+}
+
+// Snapshot returns a copy of a session's fields taken under the manager's
+// lock, for reading those that probing and API calls update, such as
+// Duration, while the session runs. It reports false if the session isn't
+// running.
+func (m *Manager) Snapshot(sessionID string) (models.StreamSession, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sess := m.sessions[sessionID]
+	if sess == nil {
+		return models.StreamSession{}, false
+	}
+	return sess.StreamSession, true
+}
+
+// ClientRunning reports whether the torrent client is up, for health checks.
+func (m *Manager) ClientRunning() bool {
+	return !m.client.Closed()
+}
+
+// ListSessions returns every running session with its status, most recently
+// active first. Listing doesn't count as session activity.
+func (m *Manager) ListSessions() []models.SessionInfo {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, sess := range m.sessions {
+		sessions = append(sessions, sess)
+	}
+	m.mu.RUnlock()
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].idleSince().After(sessions[j].idleSince())
+	})
+
+	infos := make([]models.SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		status := m.status(sess)
+		m.mu.RLock()
+		rec := sess.StreamSession
+		m.mu.RUnlock()
+		infos = append(infos, models.SessionInfo{
+			Session:    rec,
+			Stream:     status,
+			Clients:    int(sess.readers.Load()),
+			LastActive: sess.idleSince(),
+		})
+	}
+	return infos
+}
+
+// StopAll stops every running session and returns how many were stopped.
+func (m *Manager) StopAll() int {
+	m.mu.RLock()
+	ids := make([]string, 0, len(m.sessions))
+	for id := range m.sessions {
+		ids = append(ids, id)
+	}
+	m.mu.RUnlock()
+
+	stopped := 0
+	for _, id := range ids {
+		// Stopping a session also stops its prepared fallback, which may
+		// be listed here too.
+		if m.Active(id) && m.StopSession(id) == nil {
+			stopped++
+		}
+	}
+	return stopped
 }
 
 // StopSession stops and removes a streaming session.
 func (m *Manager) StopSession(sessionID string) error {
 	m.mu.Lock()
+	if m.stopPending(sessionID) {
+		m.mu.Unlock()
+		return nil
+	}
 	sess := m.sessions[sessionID]
 	if sess == nil {
 		m.mu.Unlock()
+		// Not running (e.g. after a restart) — forget the persisted copy.
+		if m.db != nil {
+			if rec, err := m.db.GetSession(sessionID); err == nil && rec != nil {
+				return m.db.DeleteSession(sessionID)
+			}
+		}
 		return fmt.Errorf("session not found: %s", sessionID)
 	}
 	delete(m.sessions, sessionID)
+	sess.release()
+	fallback := sess.fallback
+	if next := m.sessions[sess.next]; next != nil {
+		// Playback moved on to the prepared next episode.
+		next.isNext = false
+	}
 	m.mu.Unlock()
 
 	if sess.reader != nil {
 		sess.reader.Close()
 	}
-	sess.torrent.Drop()
+	// Episodes of a season pack share one torrent.
+	if sess.torrent != nil {
+		m.releaseTorrent(sess.torrent)
+	}
+
+	// Discard a prepared fallback release that was never switched to.
+	if fallback != nil {
+		m.StopSession(fallback.SessionID)
+	}
+
+	if m.db != nil {
+		if err := m.db.DeleteSession(sessionID); err != nil {
+			log.Warn().Err(err).Str("session_id", sessionID).Msg("failed to delete persisted session")
+		}
+	}
+
+	for _, fn := range m.stopHooks {
+		go fn(sessionID)
+	}
 
 	log.Info().Str("session_id", sessionID).Msg("stream session stopped")
 	return nil
 }
 
+// OnSessionStopped registers fn to be called, in its own goroutine, with the
+// ID of each session that is stopped. Must be called before any session
+// starts.
+func (m *Manager) OnSessionStopped(fn func(sessionID string)) {
+	m.stopHooks = append(m.stopHooks, fn)
+}
+
+// OnStatus registers fn to be called with each session status reported, to
+// add what the manager doesn't track, such as transcoding. Must be called
+// before serving.
+func (m *Manager) OnStatus(fn func(sessionID string, st *models.StreamStatus)) {
+	m.statusHooks = append(m.statusHooks, fn)
+}
+
+// Close persists every running session (including its latest playback
+// position) so it is restored on the next start, then closes their readers
+// and drops all torrents. Unfinished downloads resume on the next start.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, sess := range m.sessions {
+		sessions = append(sessions, sess)
+	}
+	torrents := make(map[*atorrent.Torrent]bool)
+	for _, d := range m.downloads {
+		if d.torrent != nil {
+			torrents[d.torrent] = true
+		}
+	}
+	m.mu.Unlock()
+
+	for _, sess := range sessions {
+		m.flush(sess)
+		if sess.reader != nil {
+			sess.reader.Close()
+		}
+		if sess.torrent != nil {
+			torrents[sess.torrent] = true
+		}
+	}
+	for t := range torrents {
+		t.Drop()
+	}
+
+	log.Info().Int("sessions", len(sessions)).Int("torrents", len(torrents)).Msg("torrent manager closed")
+}
+
 // findLargestVideoFile finds the largest file with a video extension in the torrent.
 func findLargestVideoFile(files []*atorrent.File) *atorrent.File {
 	videoExts := map[string]bool{
@@ -357,6 +1076,15 @@ func findLargestVideoFile(files []*atorrent.File) *atorrent.File {
 	return largest
 }
 
+// isVideoFile reports whether path has a video file extension.
+func isVideoFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".mkv", ".avi", ".webm", ".mov", ".wmv", ".flv", ".m4v":
+		return true
+	}
+	return false
+}
+
 // needsTranscoding returns true if the file format is not natively playable in browsers.
 func needsTranscoding(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
@@ -0,0 +1,213 @@
+package torrent
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// Reasons a release may not be the title searched for, set on
+// TorrentResult.Mismatch.
+const (
+	MismatchYear    = "year"     // released in another year
+	MismatchTitle   = "title"    // named differently
+	MismatchFanEdit = "fan_edit" // an unofficial cut
+)
+
+// mismatchPenalties are subtracted from a mismatched release's score.
+var mismatchPenalties = map[string]float64{
+	MismatchYear:    30,
+	MismatchTitle:   25,
+	MismatchFanEdit: 20,
+}
+
+var (
+	// yearRe matches a year or a range of years, as series list them
+	// ("[2019-2023, ...]"); see findYears.
+	yearRe = regexp.MustCompile(`((?:19|20)\d{2})(?:\s*[-–]\s*((?:19|20)\d{2}))?`)
+	// releaseTagsRe matches leading group tags, e.g. "[SubsPlease] ".
+	releaseTagsRe = regexp.MustCompile(`^\s*(?:\[[^\]]*\]\s*)+`)
+	// bracketsRe matches the bracketed parts of a release name.
+	bracketsRe = regexp.MustCompile(`[\[(][^\])]*[\])]`)
+	fanEditRe  = regexp.MustCompile(`(?i)fan[\s._-]?edit|фан[\s-]?эдит|фанатск\S*\s+(?:монтаж|верси|редакци)`)
+)
+
+// releaseName is what a release's name says about the title it contains.
+type releaseName struct {
+	titles         []string // e.g. the Russian and original titles
+	year, lastYear int      // 0 if unknown; lastYear is set for ranges
+	fanEdit        bool
+}
+
+// parseReleaseName parses titles and year from a release name in the styles
+// providers use: "Дюна / Dune (Director) [2021, ...]", "Dune (2021) [1080p]",
+// "Dune.2021.1080p.BluRay" and "[Group] Title - 01 (1080p)".
+func parseReleaseName(name string) releaseName {
+	rn := releaseName{fanEdit: fanEditRe.MatchString(name)}
+	rn.year, rn.lastYear = releaseYear(name)
+
+	name = releaseTagsRe.ReplaceAllString(name, "")
+	if !strings.Contains(strings.TrimSpace(name), " ") {
+		name = strings.NewReplacer(".", " ", "_", " ").Replace(name)
+	}
+	for _, t := range splitAlternatives(name) {
+		// Bracketed parts, and the details after them, aren't the title.
+		t = strings.TrimSpace(t)
+		if i := strings.IndexAny(t, "(["); i > 0 {
+			t = t[:i]
+		}
+		for _, m := range findYears(t) {
+			if m[0] > 0 {
+				t = t[:m[0]]
+				break
+			}
+		}
+		if t = strings.TrimSpace(t); t != "" {
+			rn.titles = append(rn.titles, t)
+		}
+	}
+	return rn
+}
+
+// splitAlternatives splits a release name into the alternative titles it
+// lists separated by " / " or " | ", ignoring separators in brackets such
+// as "(Денис Вильнёв / Denis Villeneuve)" and slashes within titles such as
+// "AC/DC".
+func splitAlternatives(name string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth = max(depth-1, 0)
+		case '/', '|':
+			if depth == 0 && i > 0 && name[i-1] == ' ' && i+1 < len(name) && name[i+1] == ' ' {
+				parts = append(parts, name[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, name[start:])
+}
+
+// releaseYear finds a release's year: the first one in brackets, else the
+// last one in the name, so titles that are years ("1917") aren't taken for
+// it.
+func releaseYear(name string) (year, lastYear int) {
+	for _, part := range bracketsRe.FindAllString(name, -1) {
+		if years := findYears(part); len(years) > 0 {
+			return parseYears(part, years[0])
+		}
+	}
+	years := findYears(name)
+	if len(years) == 0 {
+		return 0, 0
+	}
+	m := years[len(years)-1]
+	if len(years) == 1 && strings.TrimSpace(releaseTagsRe.ReplaceAllString(name[:m[0]], "")) == "" {
+		return 0, 0 // the name starts with it: a title, not a year
+	}
+	return parseYears(name, m)
+}
+
+// findYears returns the submatch indexes of the years in s that stand alone
+// rather than being part of a longer number or word.
+func findYears(s string) [][]int {
+	var years [][]int
+	for _, m := range yearRe.FindAllStringSubmatchIndex(s, -1) {
+		before, _ := utf8.DecodeLastRuneInString(s[:m[0]])
+		after, _ := utf8.DecodeRuneInString(s[m[1]:])
+		if !isWordRune(before) && !isWordRune(after) {
+			years = append(years, m)
+		}
+	}
+	return years
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// parseYears parses the year (and last year of a range) at submatch
+// indexes m of s.
+func parseYears(s string, m []int) (year, lastYear int) {
+	year, _ = strconv.Atoi(s[m[2]:m[3]])
+	if m[4] >= 0 {
+		lastYear, _ = strconv.Atoi(s[m[4]:m[5]])
+	}
+	return year, lastYear
+}
+
+// mismatches checks r against the title and year searched for. For series
+// only a release older than the show counts as another year, since season
+// packs carry the year of their season.
+func mismatches(r models.TorrentResult, opts RankOptions) []string {
+	rn := parseReleaseName(r.Title)
+	var reasons []string
+
+	if want, _ := strconv.Atoi(strings.TrimSpace(opts.Year)); want > 0 && rn.year > 0 {
+		last := max(rn.year, rn.lastYear)
+		if last < want-1 || (!opts.Series && rn.year > want+1) {
+			reasons = append(reasons, MismatchYear)
+		}
+	}
+	if opts.Title != "" && !titleMatches(rn.titles, opts.Title) {
+		reasons = append(reasons, MismatchTitle)
+	}
+	if rn.fanEdit {
+		reasons = append(reasons, MismatchFanEdit)
+	}
+	return reasons
+}
+
+// titleMatches reports whether one of a release's titles contains want as
+// whole words. Titles in another script than want (a Russian title searched
+// on an English-only tracker) can't be compared, so they don't mismatch.
+func titleMatches(titles []string, want string) bool {
+	w := normalizeTitle(want)
+	if w == "" {
+		return true
+	}
+	compared := false
+	for _, t := range titles {
+		n := normalizeTitle(t)
+		if n == "" || hasCyrillic(n) != hasCyrillic(w) {
+			continue
+		}
+		compared = true
+		if strings.Contains(" "+n+" ", " "+w+" ") {
+			return true
+		}
+	}
+	return !compared
+}
+
+// normalizeTitle lowercases a title and reduces it to its words, so
+// punctuation and "ё" spellings compare equal.
+func normalizeTitle(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == 'ё' || r == 'Ё':
+			return 'е'
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func hasCyrillic(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package torrent
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+func TestParseReleaseName(t *testing.T) {
+	tests := []struct {
+		name           string
+		titles         []string
+		year, lastYear int
+		fanEdit        bool
+	}{
+		{"Дюна / Dune (Денис Вильнёв / Denis Villeneuve) [2021, США, фантастика, BDRip 1080p]", []string{"Дюна", "Dune"}, 2021, 0, false},
+		{"Dune.2021.1080p.BluRay.x264", []string{"Dune"}, 2021, 0, false},
+		{"Dune (2021) [1080p]", []string{"Dune"}, 2021, 0, false},
+		{"[SubsPlease] Frieren - 01 (1080p)", []string{"Frieren - 01"}, 0, 0, false},
+		{"1917 (2019) 1080p", []string{"1917"}, 2019, 0, false},
+		{"Друзья / Friends [1994-2004, сериал]", []string{"Друзья", "Friends"}, 1994, 2004, false},
+		{"Звёздные войны (фан-эдит) / Star Wars [1977]", []string{"Звёздные войны", "Star Wars"}, 1977, 0, true},
+		{"AC/DC: Live at Donington / AC/DC Live [1991]", []string{"AC/DC: Live at Donington", "AC/DC Live"}, 1991, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rn := parseReleaseName(tt.name)
+			if !slices.Equal(rn.titles, tt.titles) || rn.year != tt.year || rn.lastYear != tt.lastYear || rn.fanEdit != tt.fanEdit {
+				t.Errorf("parseReleaseName() = %q, %d-%d, fan edit %v; want %q, %d-%d, fan edit %v",
+					rn.titles, rn.year, rn.lastYear, rn.fanEdit, tt.titles, tt.year, tt.lastYear, tt.fanEdit)
+			}
+		})
+	}
+}
+
+func TestTitleMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		titles []string
+		want   string
+		match  bool
+	}{
+		{"Cyrillic", []string{"Дюна", "Dune"}, "Дюна", true},
+		{"Latin", []string{"Дюна", "Dune"}, "Dune", true},
+		{"Cyrillic case", []string{"ДЮНА"}, "дюна", true},
+		{"yo spelling", []string{"Елки 2"}, "Ёлки", true},
+		{"Cyrillic mismatch", []string{"Начало", "Inception"}, "Интерстеллар", false},
+		{"other script only", []string{"Dune"}, "Дюна", true},
+		{"punctuation", []string{"Star Wars Episode IV - A New Hope"}, "Star Wars: Episode IV", true},
+		{"whole words", []string{"Dunes of Mars"}, "Dune", false},
+		{"no titles", nil, "Dune", true},
+		{"nothing searched", []string{"Dune"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := titleMatches(tt.titles, tt.want); got != tt.match {
+				t.Errorf("titleMatches(%q, %q) = %v, want %v", tt.titles, tt.want, got, tt.match)
+			}
+		})
+	}
+}
+
+func TestMismatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		opts  RankOptions
+		want  []string
+	}{
+		{"match", "Дюна / Dune [2021, BDRip 1080p]", RankOptions{Title: "Дюна", Year: "2021"}, nil},
+		{"year off by one", "Dune (2020) 1080p", RankOptions{Title: "Dune", Year: "2021"}, nil},
+		{"other year", "Dune (1984) 1080p", RankOptions{Title: "Dune", Year: "2021"}, []string{MismatchYear}},
+		{"other title", "Начало / Inception [2010]", RankOptions{Title: "Дюна", Year: "2021"}, []string{MismatchYear, MismatchTitle}},
+		{"series range", "Друзья / Friends [1994-2004]", RankOptions{Title: "Friends", Year: "1994", Series: true}, nil},
+		{"later season", "Show [2023]", RankOptions{Title: "Show", Year: "2019", Series: true}, nil},
+		{"older series", "Show [2015]", RankOptions{Title: "Show", Year: "2019", Series: true}, []string{MismatchYear}},
+		{"fan edit", "Dune (2021) Fan Edit", RankOptions{Title: "Dune", Year: "2021"}, []string{MismatchFanEdit}},
+		{"unknown year", "Dune 1080p", RankOptions{Title: "Dune", Year: "2021"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mismatches(models.TorrentResult{Title: tt.title}, tt.opts)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("mismatches(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
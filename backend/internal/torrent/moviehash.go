@@ -0,0 +1,71 @@
+package torrent
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	atorrent "github.com/anacrolix/torrent"
+)
+
+// movieHashChunk is how much of each end of the file the hash covers.
+const movieHashChunk = 64 * 1024
+
+// MovieHash returns the OpenSubtitles hash of a session's video file: its
+// size plus the sum of the first and last 64KB read as little-endian uint64s.
+// It identifies the exact release, so subtitles found by it are in sync. Only
+// the two chunks are downloaded; the result is cached on the session.
+func (m *Manager) MovieHash(ctx context.Context, sessionID string) (string, error) {
+	sess := m.GetSession(sessionID)
+	if sess == nil {
+		return "", fmt.Errorf("session %s not found", sessionID)
+	}
+	if sess.file == nil {
+		return "", errors.New("movie hash is not available for direct streams")
+	}
+
+	sess.hashMu.Lock()
+	defer sess.hashMu.Unlock()
+	if sess.movieHash != "" {
+		return sess.movieHash, nil
+	}
+
+	size := sess.file.Length()
+	if size < movieHashChunk {
+		return "", fmt.Errorf("file too small to hash (%d bytes)", size)
+	}
+
+	r := sess.NewReader()
+	defer r.Close()
+
+	hash := uint64(size)
+	buf := make([]byte, movieHashChunk)
+	for _, off := range []int64{0, size - movieHashChunk} {
+		if _, err := r.Seek(off, io.SeekStart); err != nil {
+			return "", fmt.Errorf("seek to %d: %w", off, err)
+		}
+		if err := readFullContext(ctx, r, buf); err != nil {
+			return "", fmt.Errorf("read chunk at %d: %w", off, err)
+		}
+		for i := 0; i < len(buf); i += 8 {
+			hash += binary.LittleEndian.Uint64(buf[i:])
+		}
+	}
+
+	sess.movieHash = fmt.Sprintf("%016x", hash)
+	return sess.movieHash, nil
+}
+
+// readFullContext fills buf from r, giving up when ctx is done.
+func readFullContext(ctx context.Context, r atorrent.Reader, buf []byte) error {
+	for n := 0; n < len(buf); {
+		read, err := r.ReadContext(ctx, buf[n:])
+		n += read
+		if err != nil && (n < len(buf) || err != io.EOF) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package torrent
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+)
+
+const nyaaBaseURL = "https://nyaa.si"
+
+// nyaaCategory is Nyaa's "Anime - English-translated" category; raws and
+// AMVs are left out.
+const nyaaCategory = "1_2"
+
+var (
+	// nyaaGroupRe matches the fansub group tag releases start with, e.g.
+	// "[SubsPlease] Title - 01 (1080p)".
+	nyaaGroupRe  = regexp.MustCompile(`^\s*\[([^\]]+)\]`)
+	nyaaDualRe   = regexp.MustCompile(`(?i)\bdual[\s-]?audio\b|\bmulti[\s-]?audio\b`)
+	nyaaDubRe    = regexp.MustCompile(`(?i)\b(English|Eng)\s*dub(bed)?\b|\bdub\b`)
+	nyaaSourceRe = regexp.MustCompile(`(?i)\b(BDRip|BD|Blu-?ray|WEB-?DL|WEB-?Rip|WEB|HDTV|DVD(Rip)?)\b`)
+	nyaaSizeRe   = regexp.MustCompile(`^([\d.]+)\s*([KMGT]i?B|B)$`)
+)
+
+// Nyaa is a torrent provider for anime using the nyaa.si RSS feed, which
+// carries seeders, info hashes and sizes without scraping HTML.
+type Nyaa struct {
+	client *httpclient.Client
+}
+
+func NewNyaa(opts httpclient.Options) *Nyaa {
+	if opts.Timeout == 0 {
+		opts.Timeout = 15 * time.Second
+	}
+	return &Nyaa{client: httpclient.New(opts)}
+}
+
+func (n *Nyaa) Name() string { return "nyaa" }
+
+// Search searches by title only: anime releases rarely carry IMDb IDs or
+// years in their names.
+func (n *Nyaa) Search(ctx context.Context, title, imdbID string, year string) ([]models.TorrentResult, error) {
+	return n.search(ctx, title)
+}
+
+// SearchTV searches by title; most fansub releases number episodes across
+// seasons, so seasonNum isn't part of the query, and episode is only a
+// good guess within the first season.
+func (n *Nyaa) SearchTV(ctx context.Context, title string, seasonNum, episode int, year string) ([]models.TorrentResult, error) {
+	if seasonNum > 1 {
+		episode = 0
+	}
+	return n.SearchAnime(ctx, title, episode)
+}
+
+// SearchAnime searches releases of a title, narrowed to one episode if
+// episode > 0.
+func (n *Nyaa) SearchAnime(ctx context.Context, title string, episode int) ([]models.TorrentResult, error) {
+	if episode > 0 {
+		return n.search(ctx, fmt.Sprintf("%s %02d", title, episode))
+	}
+	return n.search(ctx, title)
+}
+
+func (n *Nyaa) search(ctx context.Context, query string) ([]models.TorrentResult, error) {
+	params := url.Values{}
+	params.Set("page", "rss")
+	params.Set("q", query)
+	params.Set("c", nyaaCategory)
+	params.Set("f", "0")
+	params.Set("s", "seeders")
+	params.Set("o", "desc")
+
+	resp, err := n.client.Get(ctx, nyaaBaseURL+"/?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("nyaa request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nyaa returned status %d", resp.StatusCode)
+	}
+
+	var feed nyaaFeed
+	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("decode nyaa feed: %w", err)
+	}
+
+	results := make([]models.TorrentResult, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		if item.InfoHash == "" {
+			continue
+		}
+		size := parseNyaaSize(item.Size)
+		results = append(results, models.TorrentResult{
+			Provider:  "nyaa",
+			Title:     item.Title,
+			MagnetURI: buildMagnet(item.InfoHash, item.Title),
+			Quality:   extractQuality(item.Title),
+			SizeBytes: size,
+			SizeHuman: formatSize(size),
+			Seeds:     item.Seeders,
+			Peers:     item.Leechers,
+			Audio:     nyaaAudio(item.Title),
+			Source:    nyaaSource(item.Title),
+			TopicID:   path.Base(item.GUID),
+			Group:     nyaaGroup(item.Title),
+		})
+	}
+	return results, nil
+}
+
+// FetchTorrentFile downloads a release's .torrent file by its view ID.
+func (n *Nyaa) FetchTorrentFile(ctx context.Context, topicID string) ([]byte, error) {
+	if _, err := strconv.Atoi(topicID); err != nil {
+		return nil, fmt.Errorf("invalid nyaa id %q", topicID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, nyaaBaseURL+"/download/"+topicID+".torrent", nil)
+	if err != nil {
+		return nil, fmt.Errorf("build download request: %w", err)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download torrent file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nyaa download returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTorrentFileSize))
+	if err != nil {
+		return nil, fmt.Errorf("read torrent file: %w", err)
+	}
+	return data, nil
+}
+
+func nyaaGroup(title string) string {
+	if m := nyaaGroupRe.FindStringSubmatch(title); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	return ""
+}
+
+// nyaaAudio labels the audio of a release: Japanese unless it's dubbed or
+// ships several tracks.
+func nyaaAudio(title string) string {
+	switch {
+	case nyaaDualRe.MatchString(title):
+		return "Japanese, English"
+	case nyaaDubRe.MatchString(title):
+		return "English"
+	}
+	return "Japanese"
+}
+
+func nyaaSource(title string) string {
+	src := strings.ToLower(nyaaSourceRe.FindString(title))
+	switch {
+	case src == "":
+		return ""
+	case strings.HasPrefix(src, "bd"), strings.HasPrefix(src, "blu"):
+		return "bluray"
+	case strings.HasPrefix(src, "web"):
+		return "web"
+	}
+	return src
+}
+
+// parseNyaaSize parses sizes such as "1.4 GiB".
+func parseNyaaSize(s string) int64 {
+	m := nyaaSizeRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0
+	}
+	shift := map[byte]uint{'B': 0, 'K': 10, 'M': 20, 'G': 30, 'T': 40}[m[2][0]]
+	return int64(v * float64(int64(1)<<shift))
+}
+
+// Nyaa RSS feed types. Fields in the nyaa: namespace are matched by local
+// name.
+
+type nyaaFeed struct {
+	Items []nyaaItem `xml:"channel>item"`
+}
+
+type nyaaItem struct {
+	Title    string `xml:"title"`
+	GUID     string `xml:"guid"` // https://nyaa.si/view/{id}
+	Seeders  int    `xml:"seeders"`
+	Leechers int    `xml:"leechers"`
+	InfoHash string `xml:"infoHash"`
+	Size     string `xml:"size"`
+}
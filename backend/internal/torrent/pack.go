@@ -0,0 +1,157 @@
+package torrent
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// What a TV release holds, set on TorrentResult.Pack.
+const (
+	PackEpisode  = "episode"         // a single episode
+	PackSeason   = "season_pack"     // a season, or a run of its episodes
+	PackComplete = "complete_series" // several seasons or the whole show
+)
+
+// Go's \b only knows ASCII word characters, so the Cyrillic patterns below
+// spell out their boundaries.
+var (
+	// Several seasons: "S01-S05", "S01-05", "Сезон: 1-5", "Seasons 1-5",
+	// "1-5 сезоны".
+	packSeasonRangeRes = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bS(\d{1,2})\s*[-–]\s*S?(\d{1,2})\b`),
+		regexp.MustCompile(`(?i)(?:сезон[ыа]?|\bseasons?)[:\s]*(\d{1,2})\s*[-–]\s*(\d{1,2})(?:\D|$)`),
+		regexp.MustCompile(`(?i)(?:^|\D)(\d{1,2})\s*[-–]\s*(\d{1,2})\s*сезон`),
+	}
+	packCompleteRe = regexp.MustCompile(`(?i)\bcomplete\s+series\b|полный\s+сериал|все\s+сезоны|\ball\s+seasons\b`)
+
+	// Episodes, possibly a run of them: "S01E05", "S01E01-E08", "01x01-08",
+	// "Серии: 1-8 из 8", "1-8 серии", "5 серия".
+	packSeasonEpisodeRes = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bS(\d{1,2})[ ._-]?E(\d{1,3})(?:\s*-\s*E?(\d{1,3})\b)?`),
+		regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b(?:\s*-\s*(\d{2,3})\b)?`),
+	}
+	packEpisodeRes = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(?:серии|серия|эпизоды|эпизод|\bepisodes?)[:\s]*(\d{1,3})(?:\s*[-–]\s*(\d{1,3}))?(?:\D|$)`),
+		regexp.MustCompile(`(?i)(?:^|\D)(\d{1,3})(?:\s*[-–]\s*(\d{1,3}))?\s*(?:серии|серия)`),
+		// Fansub numbering: "Title - 05 (1080p)", "Title (01-12)".
+		regexp.MustCompile(`\s-\s(\d{2,4})(?:v\d)?\s*[\[(]`),
+		regexp.MustCompile(`\((\d{2,3})\s*-\s*(\d{2,3})\)`),
+	}
+	packBatchRe = regexp.MustCompile(`(?i)\bbatch\b`)
+	// episodeWordRe matches text starting with the word for episodes.
+	episodeWordRe = regexp.MustCompile(`(?i)^\s*(?:сери|эпизод|episode)`)
+
+	// One season: "S01", "1 сезон", "Сезон: 1", "Season 1". Kinozal's
+	// "2 сезон: 1-8 серии" is why the number before the word comes first.
+	packSeasonRes = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bS(\d{1,2})\b`),
+		regexp.MustCompile(`(?i)(?:^|\D)(\d{1,2})\s*сезон`),
+		regexp.MustCompile(`(?i)(?:сезон|\bseason)[:\s]*(\d{1,2})(?:\D|$)`),
+	}
+)
+
+// releasePack is what a release name says about the seasons and episodes in
+// it; numbers are 0 where unknown.
+type releasePack struct {
+	kind                 string
+	season, lastSeason   int
+	episode, lastEpisode int
+}
+
+// parsePack parses the season and episode markers trackers put in release
+// names: scene "S01E05", Rutracker's "Сезон: 1 / Серии: 1-8 из 8", Kinozal's
+// "(1 сезон: 1-8 серии из 8)", Rutor's "[01x01-08 из 08]" and fansub
+// "Title - 05".
+func parsePack(name string) releasePack {
+	var p releasePack
+
+	for _, re := range packSeasonRangeRes {
+		m := re.FindStringSubmatchIndex(name)
+		// Kinozal's "1 сезон: 1-8 серии" is a run of episodes.
+		if m == nil || episodeWordRe.MatchString(name[m[5]:]) {
+			continue
+		}
+		first, _ := strconv.Atoi(name[m[2]:m[3]])
+		last, _ := strconv.Atoi(name[m[4]:m[5]])
+		if last > first {
+			return releasePack{kind: PackComplete, season: first, lastSeason: last}
+		}
+	}
+	if packCompleteRe.MatchString(name) {
+		return releasePack{kind: PackComplete}
+	}
+
+	for _, re := range packSeasonEpisodeRes {
+		if m := re.FindStringSubmatch(name); m != nil {
+			p.season, _ = strconv.Atoi(m[1])
+			p.episode, _ = strconv.Atoi(m[2])
+			p.lastEpisode, _ = strconv.Atoi(m[3])
+			break
+		}
+	}
+	if p.episode == 0 {
+		for _, re := range packEpisodeRes {
+			if m := re.FindStringSubmatch(name); m != nil {
+				p.episode, _ = strconv.Atoi(m[1])
+				if len(m) > 2 {
+					p.lastEpisode, _ = strconv.Atoi(m[2])
+				}
+				break
+			}
+		}
+	}
+	if p.season == 0 {
+		for _, re := range packSeasonRes {
+			if m := re.FindStringSubmatch(name); m != nil {
+				p.season, _ = strconv.Atoi(m[1])
+				break
+			}
+		}
+	}
+	p.lastSeason = p.season
+
+	switch {
+	case p.lastEpisode > p.episode || packBatchRe.MatchString(name):
+		p.kind = PackSeason
+	case p.episode > 0:
+		p.kind, p.lastEpisode = PackEpisode, p.episode
+	case p.season > 0:
+		p.kind = PackSeason
+	}
+	return p
+}
+
+// covers reports whether the release may hold the given season and episode
+// (0 for any). Releases that don't say are assumed to.
+func (p releasePack) covers(season, episode int) bool {
+	if season > 0 && p.season > 0 && (season < p.season || season > p.lastSeason) {
+		return false
+	}
+	if episode > 0 && p.episode > 0 && p.lastEpisode > 0 && (episode < p.episode || episode > p.lastEpisode) {
+		return false
+	}
+	return true
+}
+
+// selectPacks tags results with what they hold and drops those that can't
+// hold the given season and episode (0 for any).
+func selectPacks(results []models.TorrentResult, season, episode int) []models.TorrentResult {
+	kept := results[:0]
+	for _, r := range results {
+		p := parsePack(r.Title)
+		if !p.covers(season, episode) {
+			continue
+		}
+		r.Pack = p.kind
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// episodeTag formats a scene episode marker, e.g. "S01E05".
+func episodeTag(season, episode int) string {
+	return fmt.Sprintf("S%02dE%02d", season, episode)
+}
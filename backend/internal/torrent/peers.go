@@ -0,0 +1,48 @@
+package torrent
+
+import (
+	"strings"
+
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/streambox/backend/internal/models"
+)
+
+// peerBreakdown classifies a torrent's live connections by discovery source
+// and collects swarm health counters, to help explain why a well-seeded
+// torrent may only connect to a handful of peers.
+func peerBreakdown(t *atorrent.Torrent, stats atorrent.TorrentStats) (*models.PeerSources, *models.ConnectionHealth) {
+	sources := &models.PeerSources{}
+	health := &models.ConnectionHealth{
+		KnownPeers:       stats.TotalPeers,
+		PendingPeers:     stats.PendingPeers,
+		HalfOpenPeers:    stats.HalfOpenPeers,
+		ConnectedSeeders: stats.ConnectedSeeders,
+	}
+
+	for _, pc := range t.PeerConns() {
+		switch pc.Discovery {
+		case atorrent.PeerSourceDhtGetPeers, atorrent.PeerSourceDhtAnnouncePeer:
+			sources.DHT++
+		case atorrent.PeerSourceTracker:
+			sources.Tracker++
+		case atorrent.PeerSourcePex:
+			sources.PEX++
+		case atorrent.PeerSourceIncoming:
+			sources.Incoming++
+		default:
+			sources.Other++
+		}
+
+		if strings.Contains(pc.Network, "utp") {
+			health.UTPConns++
+		} else {
+			health.TCPConns++
+		}
+	}
+
+	if read := stats.BytesReadData.Int64(); read > 0 {
+		health.UsefulRatio = float64(stats.BytesReadUsefulData.Int64()) / float64(read)
+	}
+
+	return sources, health
+}
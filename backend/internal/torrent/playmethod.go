@@ -0,0 +1,334 @@
+package torrent
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/streambox/backend/internal/ffmpeg"
+	"github.com/streambox/backend/internal/models"
+)
+
+// DefaultCapabilities are assumed for players that don't report theirs:
+// what current browsers play in a <video> element.
+var DefaultCapabilities = models.ClientCapabilities{
+	Containers:  []string{"mp4", "webm"},
+	VideoCodecs: []string{"h264", "vp8", "vp9"},
+	AudioCodecs: []string{"aac", "mp3", "opus", "vorbis", "flac"},
+}
+
+// codecAliases maps other common names to FFprobe's.
+var codecAliases = map[string]string{
+	"avc":  "h264",
+	"avc1": "h264",
+	"h265": "hevc",
+	"hev1": "hevc",
+	"hvc1": "hevc",
+	"av01": "av1",
+	"mkv":  "matroska",
+	"m4v":  "mp4",
+	"mov":  "mp4",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+}
+
+// NormalizeCapabilities lowercases the names in caps and maps aliases to
+// FFprobe's names.
+func NormalizeCapabilities(caps models.ClientCapabilities) models.ClientCapabilities {
+	norm := func(names []string) []string {
+		out := make([]string, 0, len(names))
+		for _, n := range names {
+			n = strings.ToLower(strings.TrimSpace(n))
+			if alias, ok := codecAliases[n]; ok {
+				n = alias
+			}
+			if n != "" && !slices.Contains(out, n) {
+				out = append(out, n)
+			}
+		}
+		return out
+	}
+	return models.ClientCapabilities{
+		Containers:  norm(caps.Containers),
+		VideoCodecs: norm(caps.VideoCodecs),
+		AudioCodecs: norm(caps.AudioCodecs),
+	}
+}
+
+// mp4AudioCodecs can be copied into the fragmented MP4 served when
+// remuxing; other codecs (DTS, TrueHD, Vorbis, PCM...) are converted to AAC.
+var mp4AudioCodecs = map[string]bool{
+	"aac": true, "mp3": true, "ac3": true, "eac3": true, "opus": true, "flac": true, "alac": true,
+}
+
+// containerOf names a file's container from its extension.
+func containerOf(path string) string {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".mp4", ".m4v", ".mov":
+		return "mp4"
+	case ".mkv":
+		return "matroska"
+	case "":
+		return ""
+	default:
+		return ext[1:]
+	}
+}
+
+// decidePlayMethod picks how to serve sess to a player with caps (nil for
+// DefaultCapabilities). Until the file is probed, only the container is
+// known, so it's played directly if the player handles the container and
+// remuxed otherwise. Once probed, a video codec (or H.264 bit depth) the
+// player can't decode needs transcoding, if FFmpeg can decode and encode
+// video, an audio codec it can't decode
+// needs audio conversion, and a container it can't read needs remuxing,
+// unless the file was already remuxed to MP4 (see SetRemuxed). The
+// session's transcode options add to that: video above the target
+// resolution is transcoded, and audio with more channels than allowed is
+// converted.
+func decidePlayMethod(sess *Session, caps *models.ClientCapabilities) (method, reason string) {
+	if caps == nil {
+		caps = &DefaultCapabilities
+	}
+	if d := sess.direct; d != nil && d.HLS {
+		return models.PlayDirect, "" // players handle the playlist themselves
+	}
+
+	var problems []string
+	if !slices.Contains(caps.Containers, sess.Container) {
+		problems = append(problems, fmt.Sprintf("container %s", orUnknown(sess.Container)))
+	}
+	if sess.VideoCodec == "" {
+		if len(problems) == 0 {
+			return models.PlayDirect, ""
+		}
+		return models.PlayRemux, "unsupported " + strings.Join(problems, ", ")
+	}
+	// limits are the session's transcode options that apply to the file.
+	var limits []string
+	audioOK := true
+	if audio := selectedAudioCodec(sess); audio != "" && !slices.Contains(caps.AudioCodecs, audio) {
+		problems = append(problems, "audio codec "+audio)
+		audioOK = false
+	}
+	if i, most := selectedAudio(sess), sess.transcode.AudioChannels; i >= 0 && most > 0 && sess.AudioTracks[i].Channels > most {
+		limits = append(limits, fmt.Sprintf("%d-channel audio downmixed to %d", sess.AudioTracks[i].Channels, most))
+		audioOK = false
+	}
+
+	videoProblem := ""
+	if !slices.Contains(caps.VideoCodecs, sess.VideoCodec) {
+		videoProblem = "video codec " + sess.VideoCodec
+	} else if sess.VideoCodec == "h264" && sess.VideoBitDepth > 8 {
+		// Hi10P: hardware decoders, and so browsers, handle 8-bit H.264 only.
+		videoProblem = fmt.Sprintf("%d-bit h264", sess.VideoBitDepth)
+	}
+	if videoProblem != "" {
+		problems = append(problems, videoProblem)
+		reason = playReason(problems, limits)
+		if !ffmpeg.Supports(ffmpeg.VideoTranscode) {
+			return models.PlayAudioTranscode, reason + "; video transcoding unavailable (" + ffmpeg.Reason(ffmpeg.VideoTranscode) + ")"
+		}
+		if !ffmpeg.CanDecode(sess.VideoCodec) {
+			return models.PlayAudioTranscode, reason + "; video transcoding unavailable (no " + sess.VideoCodec + " decoder)"
+		}
+		return models.PlayTranscode, reason
+	}
+	// Video above the target resolution is scaled down, and HDR video
+	// tone-mapped if asked, where it can be.
+	if ffmpeg.Supports(ffmpeg.VideoTranscode) && ffmpeg.CanDecode(sess.VideoCodec) {
+		var video []string
+		if h := sess.transcode.MaxHeight; h > 0 && sess.VideoHeight > h {
+			video = append(video, fmt.Sprintf("%dp video scaled to %dp", sess.VideoHeight, h))
+		}
+		if sess.tonemaps() {
+			video = append(video, sess.HDR+" video tone-mapped to SDR")
+		}
+		if len(video) > 0 {
+			return models.PlayTranscode, playReason(problems, append(limits, video...))
+		}
+	}
+	switch {
+	case !audioOK:
+		return models.PlayAudioTranscode, playReason(problems, limits)
+	case len(problems) > 0 && sess.remuxPlays(caps):
+		return models.PlayDirect, "" // the MP4 remux made in the background
+	case len(problems) > 0:
+		return models.PlayRemux, playReason(problems, limits)
+	}
+	return models.PlayDirect, ""
+}
+
+// tonemaps reports whether the session's video is tone-mapped from HDR to
+// SDR when transcoded.
+func (s *Session) tonemaps() bool {
+	return s.transcode.ToneMap && s.HDR != "" && ffmpeg.Supports(ffmpeg.ToneMap)
+}
+
+// ToneMaps reports whether the session's transcoded video is tone-mapped
+// from HDR to SDR.
+func (s *Session) ToneMaps() bool {
+	return s.VideoMode != models.VideoCopy && s.tonemaps()
+}
+
+// playReason says why a file isn't played directly: what the player can't
+// play, then the transcode options that apply.
+func playReason(problems, limits []string) string {
+	var parts []string
+	if len(problems) > 0 {
+		parts = append(parts, "unsupported "+strings.Join(problems, ", "))
+	}
+	return strings.Join(append(parts, limits...), "; ")
+}
+
+// selectedAudio returns the index of the audio track a session plays by
+// default, or -1 if it has none.
+func selectedAudio(sess *Session) int {
+	if len(sess.AudioTracks) == 0 {
+		return -1
+	}
+	i := sess.AudioTrack
+	if i < 0 || i >= len(sess.AudioTracks) {
+		i = 0
+	}
+	return i
+}
+
+// selectedAudioCodec returns the codec of the audio track a session plays by
+// default, or "" if unknown.
+func selectedAudioCodec(sess *Session) string {
+	if i := selectedAudio(sess); i >= 0 {
+		return sess.AudioTracks[i].Codec
+	}
+	return ""
+}
+
+// bitDepth returns the bits per sample of a video stream from FFprobe's
+// bits_per_raw_sample, or its pixel format (yuv420p10le...) when that is
+// missing, as it is for most Matroska files; 0 if unknown.
+func bitDepth(rawSample, pixFmt string) int {
+	if n, err := strconv.Atoi(rawSample); err == nil && n > 0 {
+		return n
+	}
+	if m := pixFmtDepth.FindStringSubmatch(pixFmt); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	if pixFmt != "" {
+		return 8
+	}
+	return 0
+}
+
+// hdrFormat names the HDR format of a video stream from FFprobe's color
+// transfer characteristic and whether it carries a Dolby Vision
+// configuration, or returns "" for SDR.
+func hdrFormat(transfer string, dolbyVision bool) string {
+	switch {
+	case transfer == "smpte2084": // PQ
+		return models.HDR10
+	case transfer == "arib-std-b67":
+		return models.HDRHLG
+	case dolbyVision:
+		return models.HDRDolbyVision
+	}
+	return ""
+}
+
+// pixFmtDepth matches the bit depth in pixel formats like yuv420p10le.
+var pixFmtDepth = regexp.MustCompile(`p(\d{2})(?:le|be)?$`)
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// applyPlayMethod decides the session's play method. Must be called with
+// m.mu held once the session is registered.
+func (m *Manager) applyPlayMethod(sess *Session) {
+	sess.transcode = withDefaults(sess.TranscodeOptions, m.transcodeDefaults)
+	sess.PlayMethod, sess.PlayReason = decidePlayMethod(sess, sess.caps)
+	sess.NeedsTranscode = sess.PlayMethod != models.PlayDirect
+	sess.VideoMode = videoMode(sess.PlayMethod, sess.hwFailed)
+	sess.AudioCodec = selectedAudioCodec(sess)
+	sess.TranscodeAudio = sess.NeedsTranscode && !sess.CopiesAudio(max(selectedAudio(sess), 0))
+}
+
+// videoMode picks the rung of the transcoding ladder for video played with
+// method: a copy unless it's transcoded, then a hardware encoder if one
+// works and hasn't failed for the session, otherwise libx264.
+func videoMode(method string, hwFailed bool) string {
+	switch {
+	case method != models.PlayTranscode:
+		return models.VideoCopy
+	case ffmpeg.HWEncoder() != nil && !hwFailed:
+		return models.VideoHWTranscode
+	}
+	return models.VideoSWTranscode
+}
+
+// HWTranscodeFailed moves a session whose video failed to transcode on the
+// hardware encoder down the ladder to libx264. It reports whether it did.
+func (m *Manager) HWTranscodeFailed(sessionID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess := m.sessions[sessionID]
+	if sess == nil || sess.VideoMode != models.VideoHWTranscode {
+		return false
+	}
+	sess.hwFailed = true
+	m.applyPlayMethod(sess)
+	return true
+}
+
+// copiesAudio reports whether audio track t is copied rather than converted
+// when the session isn't played directly: the player must decode it, MP4
+// must hold it and it mustn't need downmixing. Remuxing before the file is
+// probed converts, to be safe.
+func (s *Session) copiesAudio(t models.AudioTrack) bool {
+	caps := s.caps
+	if caps == nil {
+		caps = &DefaultCapabilities
+	}
+	if most := s.transcode.AudioChannels; most > 0 && t.Channels > most {
+		return false
+	}
+	return mp4AudioCodecs[t.Codec] && slices.Contains(caps.AudioCodecs, t.Codec)
+}
+
+// CopiesAudio reports whether audio track (negative for all tracks) is
+// copied into remuxed or transcoded output rather than converted to AAC.
+func (s *Session) CopiesAudio(track int) bool {
+	if track >= 0 {
+		return track < len(s.AudioTracks) && s.copiesAudio(s.AudioTracks[track])
+	}
+	for _, t := range s.AudioTracks {
+		if !s.copiesAudio(t) {
+			return false
+		}
+	}
+	return len(s.AudioTracks) > 0
+}
+
+// SetCapabilities records what the session's player can play and decides
+// its play method again, returning the updated session.
+func (m *Manager) SetCapabilities(sessionID string, caps models.ClientCapabilities) (*models.StreamSession, error) {
+	caps = NormalizeCapabilities(caps)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess := m.sessions[sessionID]
+	if sess == nil {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	sess.caps = &caps
+	m.applyPlayMethod(sess)
+	snapshot := sess.StreamSession
+	return &snapshot, nil
+}
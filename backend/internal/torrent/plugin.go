@@ -0,0 +1,181 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+)
+
+const (
+	// pluginTimeout bounds one plugin search, webhook or command.
+	pluginTimeout = 30 * time.Second
+	// maxPluginOutput caps the JSON a plugin may return.
+	maxPluginOutput = 8 << 20
+)
+
+// Plugin is a user-configured provider backed by a webhook or an executable.
+// Either one receives a pluginQuery as JSON (POST body or stdin) and answers
+// with a JSON array of TorrentResult, or an object with a "results" array.
+type Plugin struct {
+	name    string
+	target  string // http(s) URL, or the path of an executable
+	webhook bool
+	client  *httpclient.Client
+}
+
+// NewPlugin creates a plugin provider. target is a webhook URL if it starts
+// with http:// or https://, and a command to run otherwise.
+func NewPlugin(name, target string, opts httpclient.Options) *Plugin {
+	if opts.Timeout == 0 {
+		opts.Timeout = pluginTimeout
+	}
+	return &Plugin{
+		name:    name,
+		target:  target,
+		webhook: strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"),
+		client:  httpclient.New(opts),
+	}
+}
+
+type pluginQuery struct {
+	Title   string `json:"title"`
+	IMDb    string `json:"imdb,omitempty"`
+	Year    string `json:"year,omitempty"`
+	Season  int    `json:"season,omitempty"`  // set for TV searches
+	Episode int    `json:"episode,omitempty"` // set for TV searches of one episode
+}
+
+func (p *Plugin) Name() string { return p.name }
+
+func (p *Plugin) Search(ctx context.Context, title, imdbID string, year string) ([]models.TorrentResult, error) {
+	return p.search(ctx, pluginQuery{Title: title, IMDb: imdbID, Year: year})
+}
+
+func (p *Plugin) SearchTV(ctx context.Context, title string, seasonNum, episode int, year string) ([]models.TorrentResult, error) {
+	return p.search(ctx, pluginQuery{Title: title, Year: year, Season: seasonNum, Episode: episode})
+}
+
+func (p *Plugin) search(ctx context.Context, q pluginQuery) ([]models.TorrentResult, error) {
+	input, err := json.Marshal(q)
+	if err != nil {
+		return nil, fmt.Errorf("encode plugin query: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pluginTimeout)
+	defer cancel()
+
+	var output []byte
+	if p.webhook {
+		output, err = p.callWebhook(ctx, input)
+	} else {
+		output, err = p.runCommand(ctx, input)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := parsePluginOutput(output)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+
+	valid := results[:0]
+	for _, r := range results {
+		if _, err := ParseMagnet(r.MagnetURI); err != nil {
+			continue
+		}
+		r.Provider = p.name
+		if r.Quality == "" {
+			r.Quality = extractQuality(r.Title)
+		}
+		if r.SizeHuman == "" {
+			r.SizeHuman = formatSize(r.SizeBytes)
+		}
+		r.Live, r.Score = nil, 0
+		valid = append(valid, r)
+	}
+	return valid, nil
+}
+
+func (p *Plugin) callWebhook(ctx context.Context, input []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.target, bytes.NewReader(input))
+	if err != nil {
+		return nil, fmt.Errorf("build plugin request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s request: %w", p.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("plugin %s returned status %d", p.name, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxPluginOutput))
+}
+
+func (p *Plugin) runCommand(ctx context.Context, input []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.target)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &limitedBuffer{buf: &stdout, max: maxPluginOutput}
+	cmd.Stderr = &limitedBuffer{buf: &stderr, max: 4 << 10}
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("plugin %s: %w: %s", p.name, err, msg)
+		}
+		return nil, fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// parsePluginOutput accepts a bare array of results or {"results": [...]}.
+func parsePluginOutput(output []byte) ([]models.TorrentResult, error) {
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return nil, nil
+	}
+
+	var results []models.TorrentResult
+	if output[0] == '[' {
+		if err := json.Unmarshal(output, &results); err != nil {
+			return nil, fmt.Errorf("decode results: %w", err)
+		}
+		return results, nil
+	}
+
+	var wrapped struct {
+		Results []models.TorrentResult `json:"results"`
+	}
+	if err := json.Unmarshal(output, &wrapped); err != nil {
+		return nil, fmt.Errorf("decode results: %w", err)
+	}
+	return wrapped.Results, nil
+}
+
+// limitedBuffer drops writes beyond max bytes instead of failing them, so a
+// chatty command doesn't get killed by a broken pipe.
+type limitedBuffer struct {
+	buf *bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
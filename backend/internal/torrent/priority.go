@@ -0,0 +1,105 @@
+package torrent
+
+import (
+	"fmt"
+
+	atorrent "github.com/anacrolix/torrent"
+)
+
+const (
+	// playheadNowBytes after the playhead are fetched with top priority.
+	playheadNowBytes = 8 * 1024 * 1024
+	// playheadReadaheadBytes after the playhead are fetched ahead of the
+	// rest of the file.
+	playheadReadaheadBytes = 64 * 1024 * 1024
+	// playheadIndexPieces at each end of the file stay wanted even behind
+	// the playhead, since containers keep their index there.
+	playheadIndexPieces = 2
+)
+
+// SetPlayhead reports the client's playback position in seconds. The
+// torrent's piece priorities are rearranged around the matching byte offset.
+func (m *Manager) SetPlayhead(sessionID string, position float64) error {
+	sess := m.lookup(sessionID)
+	if sess == nil {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	m.mu.RLock()
+	duration, size := sess.Duration, sess.FileSize
+	m.mu.RUnlock()
+	if duration <= 0 {
+		return fmt.Errorf("duration of session %s is not known yet", sessionID)
+	}
+	m.maybePrefetch(sess, position)
+
+	offset := int64(position / duration * float64(size))
+	return m.SetPlayheadOffset(sessionID, offset)
+}
+
+// SetPlayheadOffset reports the client's playback position as a byte offset
+// into the file.
+func (m *Manager) SetPlayheadOffset(sessionID string, offset int64) error {
+	sess := m.lookup(sessionID)
+	if sess == nil {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if sess.torrent == nil {
+		return nil // direct sources have no pieces to prioritize
+	}
+	prioritize(sess, offset)
+	return nil
+}
+
+// prioritize marks the pieces just after offset as "now", the following
+// window as "readahead", the rest of the file as normal (sequential
+// download) and the already-played part, except the container index at both
+// ends, as unwanted. Pieces being read keep their reader priority regardless.
+func prioritize(sess *Session, offset int64) {
+	f := sess.file
+	pieceLen := sess.torrent.Info().PieceLength
+	if pieceLen <= 0 || f.Length() == 0 {
+		return
+	}
+
+	clamp := func(b int64) int64 {
+		if b < 0 {
+			return 0
+		}
+		if b >= f.Length() {
+			return f.Length() - 1
+		}
+		return b
+	}
+	pieceAt := func(b int64) int {
+		return int((f.Offset() + clamp(b)) / pieceLen)
+	}
+
+	cur := pieceAt(offset)
+
+	sess.prioMu.Lock()
+	defer sess.prioMu.Unlock()
+	if cur == sess.prioPiece {
+		return
+	}
+	sess.prioPiece = cur
+
+	nowEnd := pieceAt(offset + playheadNowBytes)
+	readaheadEnd := pieceAt(offset + playheadReadaheadBytes)
+	begin, end := f.BeginPieceIndex(), f.EndPieceIndex()
+
+	for i := begin; i < end; i++ {
+		prio := atorrent.PiecePriorityNone
+		switch {
+		case i >= cur && i <= nowEnd:
+			prio = atorrent.PiecePriorityNow
+		case i > nowEnd && i <= readaheadEnd:
+			prio = atorrent.PiecePriorityReadahead
+		case i > readaheadEnd:
+			prio = atorrent.PiecePriorityNormal
+		case i < begin+playheadIndexPieces || i >= end-playheadIndexPieces:
+			prio = atorrent.PiecePriorityNormal
+		}
+		sess.torrent.Piece(i).SetPriority(prio)
+	}
+}
@@ -1,92 +1,278 @@
 package torrent
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/metrics"
 	"github.com/streambox/backend/internal/models"
 )
 
 // Provider is the interface that torrent search providers must implement.
 type Provider interface {
 	Name() string
-	Search(title, imdbID string, year string) ([]models.TorrentResult, error)
+	Search(ctx context.Context, title, imdbID string, year string) ([]models.TorrentResult, error)
 }
 
+// Defaults for a provider's search timeout and circuit breaker.
+const (
+	defaultProviderTimeout = 20 * time.Second
+	defaultBreakerFailures = 3
+	defaultBreakerCooldown = 5 * time.Minute
+)
+
+// ErrUnknownProvider is returned by Only for names no provider has.
+var ErrUnknownProvider = errors.New("unknown torrent provider")
+
+// ErrProvidersFailed is returned when every provider searched failed, timed
+// out or was skipped.
+var ErrProvidersFailed = errors.New("all torrent providers failed")
+
 // ProviderRegistry holds all registered torrent search providers and
 // searches them concurrently.
 type ProviderRegistry struct {
 	providers []Provider
+
+	timeout time.Duration    // per-provider search deadline
+	breaker *providerBreaker // nil disables skipping failing providers
+
+	cache *searchCache // nil without caching (see searchcache.go)
+	fresh bool         // skip cached results
 }
 
 func NewProviderRegistry() *ProviderRegistry {
-	return &ProviderRegistry{}
+	return &ProviderRegistry{
+		timeout: defaultProviderTimeout,
+		breaker: newProviderBreaker(defaultBreakerFailures, defaultBreakerCooldown),
+	}
+}
+
+// SetTimeout sets how long a search waits for each provider.
+func (r *ProviderRegistry) SetTimeout(d time.Duration) {
+	r.timeout = d
+}
+
+// SetBreaker skips a provider for cooldown after failures consecutive
+// failed searches; 0 failures disables the breaker.
+func (r *ProviderRegistry) SetBreaker(failures int, cooldown time.Duration) {
+	if failures <= 0 {
+		r.breaker = nil
+		return
+	}
+	r.breaker = newProviderBreaker(failures, cooldown)
 }
 
 func (r *ProviderRegistry) Register(p Provider) {
 	r.providers = append(r.providers, p)
 }
 
-// TVSearcher is an optional interface for providers that support TV series search.
+// TVSearcher is an optional interface for providers that support TV series
+// search. seasonNum and episode are 0 when not searched for; with an episode,
+// providers should also find the season packs holding it.
 type TVSearcher interface {
-	SearchTV(title string, seasonNum int, year string) ([]models.TorrentResult, error)
+	SearchTV(ctx context.Context, title string, seasonNum, episode int, year string) ([]models.TorrentResult, error)
+}
+
+// AnimeSearcher is an optional interface for providers with anime releases
+// numbered by episode.
+type AnimeSearcher interface {
+	SearchAnime(ctx context.Context, title string, episode int) ([]models.TorrentResult, error)
+}
+
+// TorrentFileFetcher is an optional interface for providers that can download
+// a result's .torrent file by its TopicID. Full metadata lets streams start
+// without fetching it from peers.
+type TorrentFileFetcher interface {
+	FetchTorrentFile(ctx context.Context, topicID string) ([]byte, error)
+}
+
+// Get returns the registered provider with the given name, or nil.
+func (r *ProviderRegistry) Get(name string) Provider {
+	for _, p := range r.providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Only returns a view of the registry searching just the named providers.
+func (r *ProviderRegistry) Only(names []string) (*ProviderRegistry, error) {
+	only := *r
+	only.providers = nil
+	for _, name := range names {
+		p := r.Get(name)
+		if p == nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+		}
+		if !slices.Contains(only.providers, p) {
+			only.providers = append(only.providers, p)
+		}
+	}
+	return &only, nil
 }
 
 // Search queries all registered providers concurrently and returns
-// aggregated results.
-func (r *ProviderRegistry) Search(title, imdbID string, year string) ([]models.TorrentResult, error) {
-	var (
-		allResults []models.TorrentResult
-		mu         sync.Mutex
-		wg         sync.WaitGroup
-	)
+// aggregated results, with how each provider fared. Cancelling ctx cancels
+// the providers' requests.
+func (r *ProviderRegistry) Search(ctx context.Context, title, imdbID string, year string) ([]models.TorrentResult, []models.ProviderStatus, error) {
+	var searches []providerSearch
+	for _, p := range r.providers {
+		searches = append(searches, providerSearch{
+			name: p.Name(),
+			key:  searchKey("movie", title, imdbID, year),
+			search: func(ctx context.Context) ([]models.TorrentResult, error) {
+				return p.Search(ctx, title, imdbID, year)
+			},
+		})
+	}
+	return r.searchAll(ctx, "movie", searches)
+}
 
+// SearchTV queries providers that implement TVSearcher concurrently. Results
+// are tagged with what they hold (see pack.go), and those that can't hold
+// the season and episode searched for are dropped.
+func (r *ProviderRegistry) SearchTV(ctx context.Context, title string, seasonNum, episode int, year string) ([]models.TorrentResult, []models.ProviderStatus, error) {
+	var searches []providerSearch
 	for _, p := range r.providers {
-		wg.Add(1)
-		go func(prov Provider) {
-			defer wg.Done()
-			results, err := prov.Search(title, imdbID, year)
-			if err != nil {
-				log.Warn().Err(err).Str("provider", prov.Name()).Msg("torrent search failed")
-				return
-			}
-			mu.Lock()
-			allResults = append(allResults, results...)
-			mu.Unlock()
-		}(p)
+		tvp, ok := p.(TVSearcher)
+		if !ok {
+			continue
+		}
+		searches = append(searches, providerSearch{
+			name: p.Name(),
+			key:  searchKey("tv", title, seasonNum, episode, year),
+			search: func(ctx context.Context) ([]models.TorrentResult, error) {
+				return tvp.SearchTV(ctx, title, seasonNum, episode, year)
+			},
+		})
 	}
+	results, statuses, err := r.searchAll(ctx, "tv", searches)
+	return selectPacks(results, seasonNum, episode), statuses, err
+}
 
-	wg.Wait()
-	return allResults, nil
+// SearchAnime queries providers that implement AnimeSearcher concurrently,
+// tagging and dropping results like SearchTV.
+func (r *ProviderRegistry) SearchAnime(ctx context.Context, title string, episode int) ([]models.TorrentResult, []models.ProviderStatus, error) {
+	var searches []providerSearch
+	for _, p := range r.providers {
+		ap, ok := p.(AnimeSearcher)
+		if !ok {
+			continue
+		}
+		searches = append(searches, providerSearch{
+			name: p.Name(),
+			key:  searchKey("anime", title, episode),
+			search: func(ctx context.Context) ([]models.TorrentResult, error) {
+				return ap.SearchAnime(ctx, title, episode)
+			},
+		})
+	}
+	results, statuses, err := r.searchAll(ctx, "anime", searches)
+	return selectPacks(results, 0, episode), statuses, err
 }
 
-// SearchTV queries providers that implement TVSearcher concurrently.
-func (r *ProviderRegistry) SearchTV(title string, seasonNum int, year string) ([]models.TorrentResult, error) {
+// providerSearch is one provider's part of a search.
+type providerSearch struct {
+	name   string
+	key    string // cache key
+	search func(ctx context.Context) ([]models.TorrentResult, error)
+}
+
+// searchAll runs the searches concurrently and aggregates their results.
+// It fails with ErrProvidersFailed only if no provider answered.
+func (r *ProviderRegistry) searchAll(ctx context.Context, kind string, searches []providerSearch) ([]models.TorrentResult, []models.ProviderStatus, error) {
 	var (
 		allResults []models.TorrentResult
 		mu         sync.Mutex
 		wg         sync.WaitGroup
 	)
+	statuses := make([]models.ProviderStatus, len(searches))
 
-	for _, p := range r.providers {
-		tvp, ok := p.(TVSearcher)
-		if !ok {
-			continue
-		}
+	for i, ps := range searches {
 		wg.Add(1)
-		go func(prov TVSearcher, name string) {
+		go func() {
 			defer wg.Done()
-			results, err := prov.SearchTV(title, seasonNum, year)
-			if err != nil {
-				log.Warn().Err(err).Str("provider", name).Msg("tv torrent search failed")
-				return
-			}
+			results, status := r.searchProvider(ctx, kind, ps)
+			statuses[i] = status
 			mu.Lock()
 			allResults = append(allResults, results...)
 			mu.Unlock()
-		}(tvp, p.Name())
+		}()
 	}
 
 	wg.Wait()
-	return allResults, nil
+	for _, st := range statuses {
+		if st.Status == models.ProviderOK {
+			return allResults, statuses, nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, statuses, err
+	}
+	if len(statuses) > 0 {
+		return nil, statuses, ErrProvidersFailed
+	}
+	return allResults, statuses, nil
+}
+
+// searchProvider runs one provider's search, unless its breaker is open,
+// giving up on it after the registry's timeout. A search cut short by ctx
+// itself isn't held against the provider.
+func (r *ProviderRegistry) searchProvider(ctx context.Context, kind string, ps providerSearch) ([]models.TorrentResult, models.ProviderStatus) {
+	status := models.ProviderStatus{Provider: ps.name}
+	if until, ok := r.breaker.allow(ps.name); !ok {
+		status.Status = models.ProviderSkipped
+		status.Error = "provider is failing, skipped until it cools down"
+		status.RetryAfter = &until
+		return nil, status
+	}
+
+	searchCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	results, err := r.cached(ps.name, ps.key, func() ([]models.TorrentResult, error) {
+		results, err := ps.search(searchCtx)
+		if ctx.Err() == nil {
+			observeSearch(ps.name, start, err)
+		}
+		return results, err
+	})
+	status.DurationMs = time.Since(start).Milliseconds()
+
+	switch {
+	case ctx.Err() != nil:
+		status.Status = models.ProviderError
+		status.Error = ctx.Err().Error()
+		return nil, status
+	case err != nil && searchCtx.Err() != nil:
+		err = fmt.Errorf("no response within %s", r.timeout)
+		status.Status = models.ProviderTimeout
+	case err != nil:
+		status.Status = models.ProviderError
+	default:
+		status.Status = models.ProviderOK
+	}
+	r.breaker.record(ps.name, err)
+
+	if err != nil {
+		log.Warn().Err(err).Str("provider", ps.name).Str("kind", kind).Msg("torrent search failed")
+		status.Error = err.Error()
+		return nil, status
+	}
+	status.Results = len(results)
+	return results, status
+}
+
+// observeSearch records a provider search in the metrics.
+func observeSearch(provider string, start time.Time, err error) {
+	metrics.ProviderSearchDuration.With(provider).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.ProviderSearchErrors.With(provider).Inc()
+	}
 }
@@ -0,0 +1,68 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/anacrolix/torrent"
+	"golang.org/x/net/proxy"
+)
+
+// ProxyOptions route torrent traffic through proxies. Empty URLs connect
+// directly.
+type ProxyOptions struct {
+	// PeerProxy is a socks5:// URL for peer connections.
+	PeerProxy string
+	// TrackerProxy is an http(s):// or socks5:// URL for tracker announces
+	// and scrapes.
+	TrackerProxy string
+}
+
+// errTrackerProxied is returned for UDP tracker traffic while trackers are
+// proxied, since neither proxy type can carry it.
+var errTrackerProxied = errors.New("udp trackers are disabled while tracker traffic is proxied")
+
+// applyProxies configures cfg for opts. It returns the dialer for peer
+// connections, to be added once the client exists, or nil.
+//
+// SOCKS5 (as implemented by x/net/proxy) only relays outgoing TCP, so a peer
+// proxy also turns off uTP, the DHT and incoming connections; otherwise they
+// would bypass the proxy. Peers are then found through trackers only.
+func applyProxies(cfg *torrent.ClientConfig, opts ProxyOptions) (torrent.Dialer, error) {
+	if opts.TrackerProxy != "" {
+		u, err := url.Parse(opts.TrackerProxy)
+		if err != nil {
+			return nil, fmt.Errorf("parse tracker proxy: %w", err)
+		}
+		cfg.HTTPProxy = http.ProxyURL(u)
+		cfg.TrackerListenPacket = func(string, string) (net.PacketConn, error) {
+			return nil, errTrackerProxied
+		}
+	}
+
+	if opts.PeerProxy == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(opts.PeerProxy)
+	if err != nil {
+		return nil, fmt.Errorf("parse peer proxy: %w", err)
+	}
+	d, err := proxy.FromURL(u, proxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("peer proxy: %w", err)
+	}
+	cd, ok := d.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("peer proxy %s does not support contexts", u.Scheme)
+	}
+
+	cfg.DisableTCP = true
+	cfg.DisableUTP = true
+	cfg.NoDHT = true
+	cfg.AcceptPeerConnections = false
+	cfg.NoDefaultPortForwarding = true
+	return torrent.NetworkDialer{Network: "tcp", Dialer: cd}, nil
+}
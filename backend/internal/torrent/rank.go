@@ -0,0 +1,230 @@
+package torrent
+
+import (
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// RankOptions tune how search results are scored.
+type RankOptions struct {
+	// AudioLanguage is the preferred audio language (ISO 639 code, e.g. "ru").
+	AudioLanguage string
+	// AudioLanguages are further preferred languages, in order, after
+	// AudioLanguage; releases in later ones get a smaller boost.
+	AudioLanguages []string
+	// CanTranscode is false when FFmpeg is unavailable, so releases browsers
+	// can't decode (HEVC, AV1) won't play.
+	CanTranscode bool
+	// Series disables the size check's upper bound, since season packs hold
+	// many episodes.
+	Series bool
+	// Episode skips the size check entirely, for results that are single
+	// episodes rather than movies or season packs. Results tagged
+	// PackEpisode skip it regardless.
+	Episode bool
+	// Title and Year are what was searched for; releases whose names don't
+	// match are flagged and scored down (see match.go).
+	Title string
+	Year  string
+	// Strict drops mismatched releases instead.
+	Strict bool
+	// Filter drops the results it doesn't match.
+	Filter ResultFilter
+}
+
+// qualityScores favour 1080p: 2160p releases are often too large to stream
+// from a fresh swarm.
+var qualityScores = map[string]float64{
+	"2160p": 8,
+	"4k":    8,
+	"uhd":   8,
+	"1080p": 10,
+	"720p":  6,
+	"480p":  2,
+}
+
+// qualitySizes are plausible movie sizes per quality in bytes; releases
+// outside them are usually fakes, samples or mislabelled.
+var qualitySizes = map[string][2]int64{
+	"480p":  {300 << 20, 4 << 30},
+	"720p":  {600 << 20, 12 << 30},
+	"1080p": {1 << 30, 45 << 30},
+	"2160p": {4 << 30, 120 << 30},
+	"4k":    {4 << 30, 120 << 30},
+	"uhd":   {4 << 30, 120 << 30},
+}
+
+var unplayableCodecRe = regexp.MustCompile(`(?i)\b(HEVC|[xh]\.?265|AV1)\b`)
+
+// audioLanguages maps release audio labels and title markers to languages.
+var audioLanguages = []struct {
+	pattern *regexp.Regexp
+	lang    string
+}{
+	{regexp.MustCompile(`(?i)Дубляж|Лицензия|\bDVO\b|\bAVO\b|\bMVO\b|перевод|\bRus\b|Русск|\bRussian\b`), "ru"},
+	{regexp.MustCompile(`(?i)\bUkr\b|Украин|\bUkrainian\b`), "uk"},
+	{regexp.MustCompile(`(?i)\bEng(lish)?\b|Английск`), "en"},
+}
+
+// Rank dedupes results by info hash, keeping the best-seeded copy, scores
+// them and sorts them by descending score. Releases not matching
+// opts.Title and opts.Year are flagged, or dropped if opts.Strict, and those
+// opts.Filter doesn't match are dropped.
+func Rank(results []models.TorrentResult, opts RankOptions) []models.TorrentResult {
+	ranked := make([]models.TorrentResult, 0, len(results))
+	seen := make(map[string]int)
+	for _, r := range results {
+		key := dedupKey(r)
+		if i, ok := seen[key]; ok {
+			if seeds(r) > seeds(ranked[i]) {
+				ranked[i] = r
+			}
+			continue
+		}
+		seen[key] = len(ranked)
+		ranked = append(ranked, r)
+	}
+
+	langs := preferredLanguages(opts.AudioLanguage, opts.AudioLanguages)
+	kept := ranked[:0]
+	for _, r := range ranked {
+		if !opts.Filter.match(r) {
+			continue
+		}
+		r.Mismatch = mismatches(r, opts)
+		if opts.Strict && len(r.Mismatch) > 0 {
+			continue
+		}
+		r.Score = score(r, langs, opts)
+		kept = append(kept, r)
+	}
+	ranked = kept
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked
+}
+
+// dedupKey identifies a release across providers: by info hash where the
+// magnet is known, else by provider topic.
+func dedupKey(r models.TorrentResult) string {
+	if mg, err := ParseMagnet(r.MagnetURI); err == nil {
+		return mg.InfoHash.HexString()
+	}
+	if r.TopicID != "" {
+		return r.Provider + ":" + r.TopicID
+	}
+	return r.Provider + ":" + r.Title
+}
+
+// seeds prefers live swarm counts over the provider's, if a tracker answered.
+func seeds(r models.TorrentResult) int {
+	if r.Live != nil && r.Live.TrackersResponded > 0 {
+		return r.Live.Seeds
+	}
+	return r.Seeds
+}
+
+func score(r models.TorrentResult, langs []string, opts RankOptions) float64 {
+	n := seeds(r)
+	if n == 0 {
+		return -50
+	}
+	s := 10 * math.Log2(1+float64(n))
+
+	quality := strings.ToLower(r.Quality)
+	s += qualityScores[quality]
+
+	if bounds, ok := qualitySizes[quality]; ok && r.SizeBytes > 0 && !opts.Episode && r.Pack != PackEpisode {
+		if r.SizeBytes < bounds[0] || (!opts.Series && r.SizeBytes > bounds[1]) {
+			s -= 15
+		}
+	}
+
+	if !opts.CanTranscode && (unplayableCodecRe.MatchString(r.Title) || r.VideoCodec == "hevc" || r.VideoCodec == "av1") {
+		s -= 20
+	}
+
+	for i, lang := range langs {
+		if hasAudioLanguage(r, lang) {
+			s += max(15-5*float64(i), 5)
+			break
+		}
+	}
+
+	for _, reason := range r.Mismatch {
+		s -= mismatchPenalties[reason]
+	}
+
+	return math.Round(s*10) / 10
+}
+
+func hasAudioLanguage(r models.TorrentResult, lang string) bool {
+	text := r.Audio + " " + r.Title + " " + r.Translation + " " + strings.Join(r.AudioTracks, " ")
+	for _, al := range audioLanguages {
+		if al.lang == lang && al.pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeLanguage maps three-letter codes used in media files ("rus",
+// "eng") to the two-letter ones profiles use.
+func normalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if two, ok := languageCodes[lang]; ok {
+		return two
+	}
+	return lang
+}
+
+// languageCodes maps ISO 639-2 codes, including the bibliographic ones
+// Matroska uses ("ger", "fre"), to ISO 639-1.
+var languageCodes = map[string]string{
+	"rus": "ru", "eng": "en", "ukr": "uk",
+	"ger": "de", "deu": "de", "fre": "fr", "fra": "fr",
+	"spa": "es", "ita": "it", "por": "pt", "pol": "pl",
+	"jpn": "ja", "kor": "ko", "chi": "zh", "zho": "zh",
+	"tur": "tr", "kaz": "kk", "bel": "be",
+}
+
+// preferredLanguages normalizes first and then rest into one list, in
+// order and without repeats or blanks.
+func preferredLanguages(first string, rest []string) []string {
+	var langs []string
+	for _, lang := range append([]string{first}, rest...) {
+		if lang = normalizeLanguage(lang); lang != "" && !slices.Contains(langs, lang) {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// Best returns the result to play from ranked results: the best-ranked
+// seeded one in the preferred quality ("" for any), else the best-ranked
+// seeded one in another quality. Releases flagged as not being the title
+// searched for are passed over.
+func Best(ranked []models.TorrentResult, quality string) (models.TorrentResult, bool) {
+	var fallback *models.TorrentResult
+	for i, r := range ranked {
+		if r.MagnetURI == "" || seeds(r) == 0 || len(r.Mismatch) > 0 {
+			continue
+		}
+		if quality == "" || qualityClass(r.Quality) == qualityClass(quality) {
+			return r, true
+		}
+		if fallback == nil {
+			fallback = &ranked[i]
+		}
+	}
+	if fallback == nil {
+		return models.TorrentResult{}, false
+	}
+	return *fallback, true
+}
@@ -0,0 +1,211 @@
+package torrent
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+func TestRank(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []models.TorrentResult
+		opts    RankOptions
+		want    []string // titles, best first
+	}{
+		{
+			name: "more seeds first",
+			results: []models.TorrentResult{
+				{Title: "few", TopicID: "1", Quality: "1080p", Seeds: 10},
+				{Title: "many", TopicID: "2", Quality: "1080p", Seeds: 100},
+			},
+			want: []string{"many", "few"},
+		},
+		{
+			name: "1080p over 2160p",
+			results: []models.TorrentResult{
+				{Title: "uhd", TopicID: "1", Quality: "2160p", Seeds: 50},
+				{Title: "fhd", TopicID: "2", Quality: "1080p", Seeds: 50},
+			},
+			want: []string{"fhd", "uhd"},
+		},
+		{
+			name: "unseeded last",
+			results: []models.TorrentResult{
+				{Title: "dead", TopicID: "1", Quality: "1080p"},
+				{Title: "alive", TopicID: "2", Quality: "480p", Seeds: 1},
+			},
+			want: []string{"alive", "dead"},
+		},
+		{
+			name: "implausible size",
+			results: []models.TorrentResult{
+				{Title: "tiny", TopicID: "1", Quality: "1080p", Seeds: 50, SizeBytes: 200 << 20},
+				{Title: "normal", TopicID: "2", Quality: "720p", Seeds: 50, SizeBytes: 2 << 30},
+			},
+			want: []string{"normal", "tiny"},
+		},
+		{
+			name: "size ignored for episodes",
+			results: []models.TorrentResult{
+				{Title: "episode", TopicID: "1", Quality: "1080p", Seeds: 50, SizeBytes: 200 << 20},
+				{Title: "normal", TopicID: "2", Quality: "720p", Seeds: 50, SizeBytes: 2 << 30},
+			},
+			opts: RankOptions{Episode: true},
+			want: []string{"episode", "normal"},
+		},
+		{
+			name: "HEVC without FFmpeg",
+			results: []models.TorrentResult{
+				{Title: "Movie 1080p HEVC", TopicID: "1", Quality: "1080p", Seeds: 50},
+				{Title: "Movie 720p", TopicID: "2", Quality: "720p", Seeds: 50},
+			},
+			want: []string{"Movie 720p", "Movie 1080p HEVC"},
+		},
+		{
+			name: "HEVC with FFmpeg",
+			results: []models.TorrentResult{
+				{Title: "Movie 1080p HEVC", TopicID: "1", Quality: "1080p", Seeds: 50},
+				{Title: "Movie 720p", TopicID: "2", Quality: "720p", Seeds: 50},
+			},
+			opts: RankOptions{CanTranscode: true},
+			want: []string{"Movie 1080p HEVC", "Movie 720p"},
+		},
+		{
+			name: "preferred audio language",
+			results: []models.TorrentResult{
+				{Title: "Movie 1080p Eng", TopicID: "1", Quality: "1080p", Seeds: 100},
+				{Title: "Movie 1080p Rus", TopicID: "2", Quality: "1080p", Seeds: 50},
+			},
+			opts: RankOptions{AudioLanguage: "ru"},
+			want: []string{"Movie 1080p Rus", "Movie 1080p Eng"},
+		},
+		{
+			name: "dedupe keeps the best-seeded copy",
+			results: []models.TorrentResult{
+				{Title: "copy a", Provider: "p", TopicID: "1", Quality: "1080p", Seeds: 5},
+				{Title: "copy b", Provider: "p", TopicID: "1", Quality: "1080p", Seeds: 20},
+				{Title: "other", Provider: "q", TopicID: "1", Quality: "1080p", Seeds: 10},
+			},
+			want: []string{"copy b", "other"},
+		},
+		{
+			name: "mismatched year scored down",
+			results: []models.TorrentResult{
+				{Title: "Dune Part Two (2024) 1080p", TopicID: "1", Quality: "1080p", Seeds: 100},
+				{Title: "Dune (2021) 1080p", TopicID: "2", Quality: "1080p", Seeds: 30},
+			},
+			opts: RankOptions{Title: "Dune", Year: "2021"},
+			want: []string{"Dune (2021) 1080p", "Dune Part Two (2024) 1080p"},
+		},
+		{
+			name: "strict drops mismatches",
+			results: []models.TorrentResult{
+				{Title: "Дюна / Dune [2021, BDRip 1080p]", TopicID: "1", Quality: "1080p", Seeds: 10},
+				{Title: "Начало / Inception [2010, BDRip 1080p]", TopicID: "2", Quality: "1080p", Seeds: 100},
+			},
+			opts: RankOptions{Title: "Дюна", Year: "2021", Strict: true},
+			want: []string{"Дюна / Dune [2021, BDRip 1080p]"},
+		},
+		{
+			name: "filter",
+			results: []models.TorrentResult{
+				{Title: "fhd", TopicID: "1", Quality: "1080p", Seeds: 50},
+				{Title: "hd", TopicID: "2", Quality: "720p", Seeds: 50},
+				{Title: "uhd", TopicID: "3", Quality: "4k", Seeds: 50},
+			},
+			opts: RankOptions{Filter: ResultFilter{Qualities: []string{"720p", "2160p"}}},
+			want: []string{"uhd", "hd"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, r := range Rank(tt.results, tt.opts) {
+				got = append(got, r.Title)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Rank() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBest(t *testing.T) {
+	ranked := []models.TorrentResult{
+		{Title: "no magnet", Quality: "1080p", Seeds: 100},
+		{Title: "mismatch", MagnetURI: "magnet:?a", Quality: "1080p", Seeds: 90, Mismatch: []string{MismatchYear}},
+		{Title: "unseeded", MagnetURI: "magnet:?b", Quality: "1080p"},
+		{Title: "uhd", MagnetURI: "magnet:?c", Quality: "2160p", Seeds: 50},
+		{Title: "fhd", MagnetURI: "magnet:?d", Quality: "1080p", Seeds: 40},
+	}
+	tests := []struct {
+		name    string
+		ranked  []models.TorrentResult
+		quality string
+		want    string
+		ok      bool
+	}{
+		{"any quality", ranked, "", "uhd", true},
+		{"preferred quality", ranked, "1080p", "fhd", true},
+		{"quality alias", ranked, "4k", "uhd", true},
+		{"fallback quality", ranked, "720p", "uhd", true},
+		{"nothing playable", ranked[:3], "", "", false},
+		{"empty", nil, "1080p", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Best(tt.ranked, tt.quality)
+			if got.Title != tt.want || ok != tt.ok {
+				t.Errorf("Best(%q) = %q, %v; want %q, %v", tt.quality, got.Title, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		lang, want string
+	}{
+		{"ru", "ru"},
+		{"rus", "ru"},
+		{"ENG", "en"},
+		{" ukr ", "uk"},
+		{"ger", "de"},
+		{"deu", "de"},
+		{"fre", "fr"},
+		{"und", "und"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			if got := normalizeLanguage(tt.lang); got != tt.want {
+				t.Errorf("normalizeLanguage(%q) = %q, want %q", tt.lang, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferredLanguages(t *testing.T) {
+	tests := []struct {
+		name  string
+		first string
+		rest  []string
+		want  []string
+	}{
+		{"first only", "ru", nil, []string{"ru"}},
+		{"first then rest", "uk", []string{"ru", "en"}, []string{"uk", "ru", "en"}},
+		{"no first", "", []string{"rus", "eng"}, []string{"ru", "en"}},
+		{"repeats", "rus", []string{"ru", "en", "ENG"}, []string{"ru", "en"}},
+		{"blanks", " ", []string{"", "en"}, []string{"en"}},
+		{"none", "", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := preferredLanguages(tt.first, tt.rest); !slices.Equal(got, tt.want) {
+				t.Errorf("preferredLanguages(%q, %q) = %q, want %q", tt.first, tt.rest, got, tt.want)
+			}
+		})
+	}
+}
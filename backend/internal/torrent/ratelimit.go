@@ -0,0 +1,148 @@
+package torrent
+
+import (
+	"time"
+
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// minLimiterBurst keeps limiter bursts above the client's read and
+	// 16 KiB chunk sizes, which the torrent library requires.
+	minLimiterBurst = 256 * 1024
+	// throttleInterval is how often per-session download limits are enforced.
+	throttleInterval = 250 * time.Millisecond
+)
+
+// SetRateLimits changes the global peer download and upload limits in KiB/s;
+// 0 removes a limit.
+func (tc *TorrentClient) SetRateLimits(downKBps, upKBps int) {
+	setLimiter(tc.downLimiter, downKBps)
+	setLimiter(tc.upLimiter, upKBps)
+}
+
+func setLimiter(l *rate.Limiter, kbps int) {
+	if kbps <= 0 {
+		l.SetLimit(rate.Inf)
+		return
+	}
+	bytesPerSec := kbps * 1024
+	l.SetBurst(max(bytesPerSec, minLimiterBurst))
+	l.SetLimit(rate.Limit(bytesPerSec))
+}
+
+// throttle is the per-torrent state of the session limiter: a token bucket
+// refilled at the session limit and drained by downloaded bytes.
+type throttle struct {
+	bytes     int64
+	allowance float64
+	paused    bool
+}
+
+// SetRateLimits applies global transfer limits to the torrent client and sets
+// the default download limit of stream sessions.
+func (m *Manager) SetRateLimits(settings models.Settings) {
+	m.client.SetRateLimits(settings.DownloadLimitKBps, settings.UploadLimitKBps)
+
+	m.mu.Lock()
+	m.sessionLimit = settings.SessionLimitKBps
+	m.mu.Unlock()
+
+	m.throttleOnce.Do(func() { go m.throttleSessions() })
+
+	log.Info().
+		Int("download_kbps", settings.DownloadLimitKBps).
+		Int("upload_kbps", settings.UploadLimitKBps).
+		Int("session_kbps", settings.SessionLimitKBps).
+		Msg("rate limits set")
+}
+
+// SetSessionRateLimit overrides the download limit of one session in KiB/s;
+// 0 makes it unlimited and a negative value restores the default.
+func (m *Manager) SetSessionRateLimit(sessionID string, kbps int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess := m.sessions[sessionID]
+	if sess == nil {
+		return false
+	}
+	if kbps < 0 {
+		sess.rateLimit = nil
+	} else {
+		sess.rateLimit = &kbps
+	}
+	return true
+}
+
+// sessionRateLimit returns the effective download limit of sess in KiB/s.
+// m.mu must be held.
+func (m *Manager) sessionRateLimit(sess *Session) int {
+	if sess.rateLimit != nil {
+		return *sess.rateLimit
+	}
+	return m.sessionLimit
+}
+
+// throttleSessions enforces per-session limits. The torrent library only has
+// client-wide limiters, so a session's torrent is paused (its requests
+// cancelled) while it is over budget and resumed once the bucket refills.
+// Torrents shared by several sessions use the lowest of their limits.
+func (m *Manager) throttleSessions() {
+	state := make(map[*atorrent.Torrent]*throttle)
+	ticker := time.NewTicker(throttleInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		limits := make(map[*atorrent.Torrent]int)
+		m.mu.RLock()
+		for _, sess := range m.sessions {
+			if sess.torrent == nil {
+				continue
+			}
+			limit := m.sessionRateLimit(sess)
+			if limit <= 0 {
+				continue
+			}
+			if cur, ok := limits[sess.torrent]; !ok || limit < cur {
+				limits[sess.torrent] = limit
+			}
+		}
+		m.mu.RUnlock()
+
+		for t, th := range state {
+			if _, ok := limits[t]; !ok {
+				if th.paused {
+					t.AllowDataDownload()
+				}
+				delete(state, t)
+			}
+		}
+
+		for t, limit := range limits {
+			stats := t.Stats()
+			read := stats.BytesReadData.Int64()
+			budget := float64(limit*1024) * throttleInterval.Seconds()
+
+			th := state[t]
+			if th == nil {
+				th = &throttle{bytes: read, allowance: budget}
+				state[t] = th
+			}
+			// Refill up to one second's worth, so pauses don't bank bandwidth.
+			th.allowance = min(th.allowance+budget-float64(read-th.bytes), float64(limit*1024))
+			th.bytes = read
+
+			switch {
+			case th.allowance < 0 && !th.paused:
+				t.DisallowDataDownload()
+				th.paused = true
+			case th.allowance >= 0 && th.paused:
+				t.AllowDataDownload()
+				th.paused = false
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package torrent
+
+import (
+	"time"
+
+	atorrent "github.com/anacrolix/torrent"
+)
+
+// Torrents are shared by everything using them: stream sessions (several
+// for the episodes of a season pack), downloads and lookups such as
+// ListFiles or Inspect. Each takes a reference with acquireTorrent and gives
+// it back with releaseTorrent; the torrent is dropped from the client when
+// the last reference goes, never under another user.
+
+// torrentLinger is how long lookups keep the torrent they added, so a
+// stream started right after listing its files doesn't fetch the metadata
+// again.
+const torrentLinger = 2 * time.Minute
+
+// acquireTorrent adds a magnet URI or bare info hash to the client, or finds
+// its torrent active already, and takes a reference to it.
+func (m *Manager) acquireTorrent(magnetURI string) (*atorrent.Torrent, error) {
+	magnet, err := ParseMagnet(magnetURI)
+	if err != nil {
+		return nil, err
+	}
+	hash := magnet.InfoHash.HexString()
+
+	// Counted before adding, so a release racing with this can't drop the
+	// torrent between adding it and taking the reference.
+	m.refsMu.Lock()
+	m.torrentRefs[hash]++
+	m.refsMu.Unlock()
+
+	t, _, err := m.client.AddMagnetNoWait(magnetURI)
+	if err != nil {
+		m.refsMu.Lock()
+		m.unref(hash)
+		m.refsMu.Unlock()
+		return nil, err
+	}
+	return t, nil
+}
+
+// releaseTorrent gives back a reference taken by acquireTorrent (or
+// addMagnet), dropping the torrent if it was the last one, unless the
+// seeding policy keeps it (see seeding.go).
+func (m *Manager) releaseTorrent(t *atorrent.Torrent) {
+	m.refsMu.Lock()
+	defer m.refsMu.Unlock()
+	if m.unref(t.InfoHash().HexString()) && !m.keepSeeding(t) {
+		t.Drop()
+	}
+}
+
+// releaseTorrentLater releases a lookup's reference after torrentLinger.
+func (m *Manager) releaseTorrentLater(t *atorrent.Torrent) {
+	time.AfterFunc(torrentLinger, func() { m.releaseTorrent(t) })
+}
+
+// unref decrements hash's reference count and reports whether it reached
+// zero. m.refsMu must be held.
+func (m *Manager) unref(hash string) bool {
+	if m.torrentRefs[hash]--; m.torrentRefs[hash] > 0 {
+		return false
+	}
+	delete(m.torrentRefs, hash)
+	return true
+}
@@ -0,0 +1,57 @@
+package torrent
+
+import (
+	"slices"
+
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/streambox/backend/internal/models"
+)
+
+// NewBackgroundReader creates a reader for background jobs such as remuxing
+// the file as it downloads (see stream/remux.go). Unlike NewReader, it
+// reads ahead no further than the piece it's at, so it takes little
+// bandwidth from playback, and its reads don't count as session activity,
+// so it doesn't keep an abandoned session from going idle.
+func (s *Session) NewBackgroundReader() atorrent.Reader {
+	r := s.file.NewReader()
+	r.SetReadahead(0)
+	return r
+}
+
+// SetRemuxed records an MP4 remux of a session's file, holding its audio
+// track audio, to serve directly instead of remuxing the file for each
+// request, and decides the play method again. It reports whether the
+// session is still running.
+func (m *Manager) SetRemuxed(sessionID, path string, audio int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess := m.sessions[sessionID]
+	if sess == nil {
+		return false
+	}
+	sess.remuxed, sess.remuxedAudio = path, audio
+	m.applyPlayMethod(sess)
+	return true
+}
+
+// Remuxed returns the path of the MP4 remux the session's file is served
+// from, or "" if the file itself is served.
+func (s *Session) Remuxed() string {
+	if s.PlayMethod != models.PlayDirect || !s.remuxPlays(s.caps) {
+		return ""
+	}
+	return s.remuxed
+}
+
+// remuxPlays reports whether the session's MP4 remux can be played by a
+// player with caps in place of the file: it must hold the selected audio
+// track and the player must read MP4.
+func (s *Session) remuxPlays(caps *models.ClientCapabilities) bool {
+	if s.remuxed == "" {
+		return false
+	}
+	if caps == nil {
+		caps = &DefaultCapabilities
+	}
+	return max(s.AudioTrack, 0) == s.remuxedAudio && slices.Contains(caps.Containers, "mp4")
+}
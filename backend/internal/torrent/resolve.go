@@ -0,0 +1,148 @@
+package torrent
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// Statuses of sessions started with PlayAsync before they are ready.
+const (
+	StatusResolving = "resolving" // fetching the torrent's metadata
+	StatusFailed    = "failed"    // no source could be started
+)
+
+// failedResolveTTL is how long a failed PlayAsync session keeps reporting
+// its error in the status.
+const failedResolveTTL = 10 * time.Minute
+
+// pendingSession is a PlayAsync session whose torrent is being resolved.
+// Its fields are guarded by Manager.mu.
+type pendingSession struct {
+	session models.StreamSession
+	started time.Time
+	err     string
+	stopped bool // StopSession was called; the session is stopped once started
+}
+
+// PlayAsync starts a session like Play, but returns at once with a session
+// in StatusResolving instead of waiting for the torrent's metadata, which
+// can take up to the metadata timeout for slow magnets. The session gets the
+// returned ID once started; until then GetStatus reports the metadata
+// progress, or the error if every source failed. onReady, if not nil, is
+// called with the started session. The stream slot is taken right away, so
+// a *admission.BusyError is still returned synchronously.
+func (m *Manager) PlayAsync(req models.SourceRequest, fileIndex int, onReady func(*models.StreamSession)) (*models.StreamSession, error) {
+	id := uuid.New().String()
+	release, err := m.streams.Acquire(req.Client, id)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pendingSession{
+		session: models.StreamSession{
+			ID:        id,
+			TMDbID:    req.TMDbID,
+			Title:     req.Title,
+			MagnetURI: req.MagnetURI,
+			Status:    StatusResolving,
+			Source:    SourceTorrent,
+		},
+		started: time.Now(),
+	}
+	if mg, err := ParseMagnet(req.MagnetURI); err == nil {
+		p.session.InfoHash = mg.InfoHash.HexString()
+	}
+
+	m.mu.Lock()
+	m.pending[id] = p
+	m.mu.Unlock()
+
+	go func() {
+		defer release()
+		session, err := m.play(id, req, fileIndex)
+
+		m.mu.Lock()
+		stopped := p.stopped
+		if err != nil {
+			p.err = err.Error()
+			p.session.Status = StatusFailed
+		} else {
+			delete(m.pending, id)
+		}
+		m.mu.Unlock()
+
+		switch {
+		case err != nil:
+			log.Warn().Err(err).Str("session_id", id).Str("title", req.Title).Msg("async stream start failed")
+			time.AfterFunc(failedResolveTTL, func() {
+				m.mu.Lock()
+				delete(m.pending, id)
+				m.mu.Unlock()
+			})
+		case stopped:
+			m.StopSession(id)
+		case onReady != nil:
+			onReady(session)
+		}
+	}()
+
+	snapshot := p.session
+	return &snapshot, nil
+}
+
+// Resolving reports whether sessionID names a PlayAsync session that isn't
+// started yet (or failed to start).
+func (m *Manager) Resolving(sessionID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.pending[sessionID] != nil
+}
+
+// pendingStatus returns the status of a PlayAsync session that isn't
+// started yet, or nil if sessionID names none.
+func (m *Manager) pendingStatus(sessionID string) *models.StreamStatus {
+	m.mu.RLock()
+	p := m.pending[sessionID]
+	var (
+		status   string
+		infoHash string
+		started  time.Time
+		errText  string
+	)
+	if p != nil {
+		status, infoHash, started, errText = p.session.Status, p.session.InfoHash, p.started, p.err
+	}
+	m.mu.RUnlock()
+	if p == nil {
+		return nil
+	}
+
+	progress := &models.MetadataProgress{
+		ElapsedSec: time.Since(started).Seconds(),
+		TimeoutSec: m.metadataTimeout.Seconds(),
+		Error:      errText,
+	}
+	st := &models.StreamStatus{Status: status, Source: SourceTorrent, Metadata: progress}
+	if t, ok := m.client.activeTorrent(infoHash); ok {
+		stats := t.Stats()
+		st.PeersConnected = stats.ActivePeers
+		progress.PeersConnected = stats.ActivePeers
+		progress.PeersKnown = stats.TotalPeers
+	}
+	return st
+}
+
+// stopPending stops a PlayAsync session that isn't started yet, reporting
+// whether sessionID named one. Must be called with m.mu held.
+func (m *Manager) stopPending(sessionID string) bool {
+	p := m.pending[sessionID]
+	if p == nil {
+		return false
+	}
+	p.stopped = true
+	delete(m.pending, sessionID)
+	return true
+}
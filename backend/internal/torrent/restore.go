@@ -0,0 +1,252 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// positionPersistInterval throttles playback position writes to the database.
+const positionPersistInterval = 5 * time.Second
+
+// persist writes the session to the database so it survives a restart.
+func (m *Manager) persist(sess *Session) {
+	if m.db == nil {
+		return
+	}
+	if err := m.db.SaveSession(&sess.StreamSession); err != nil {
+		log.Warn().Err(err).Str("session_id", sess.ID).Msg("failed to persist session")
+	}
+}
+
+// RecordPosition stores the last playback timestamp (seconds) delivered to
+// the client, so a transcode can resume there after a crash or restart.
+func (m *Manager) RecordPosition(sessionID string, position float64) {
+	m.mu.Lock()
+	sess := m.sessions[sessionID]
+	if sess == nil {
+		m.mu.Unlock()
+		return
+	}
+	sess.LastPosition = position
+	sess.touch()
+	due := time.Since(sess.lastPersist) >= positionPersistInterval
+	if due {
+		sess.lastPersist = time.Now()
+	}
+	m.mu.Unlock()
+
+	m.maybePrefetch(sess, position)
+
+	if due && m.db != nil {
+		if err := m.db.UpdateSessionPosition(sessionID, position); err != nil {
+			log.Warn().Err(err).Str("session_id", sessionID).Msg("failed to persist playback position")
+		}
+	}
+}
+
+// SetResumePosition records where the viewer left off watching a session's
+// title. With seek set, transcoded streams start there (see StartPosition)
+// and pieces from there are downloaded first once the duration is known.
+func (m *Manager) SetResumePosition(sessionID string, position float64, seek bool) *models.StreamSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess := m.sessions[sessionID]
+	if sess == nil {
+		return nil
+	}
+	sess.ResumePosition = position
+	if seek {
+		sess.StartPosition = position
+		if sess.torrent != nil && sess.Duration > 0 {
+			prioritize(sess, int64(position/sess.Duration*float64(sess.FileSize)))
+		}
+	}
+	s := sess.StreamSession
+	return &s
+}
+
+// SetAudioTrack records the audio track selected for a session so it is kept
+// across restarts.
+func (m *Manager) SetAudioTrack(sessionID string, track int) {
+	m.mu.Lock()
+	sess := m.sessions[sessionID]
+	if sess == nil || sess.AudioTrack == track {
+		m.mu.Unlock()
+		return
+	}
+	sess.AudioTrack = track
+	m.applyPlayMethod(sess) // the new track's codec may play directly or not
+	m.mu.Unlock()
+
+	if m.db != nil {
+		if err := m.db.UpdateSessionAudioTrack(sessionID, track); err != nil {
+			log.Warn().Err(err).Str("session_id", sessionID).Msg("failed to persist audio track")
+		}
+	}
+}
+
+// SetSubtitleOffset records the subtitle timing offset (milliseconds) chosen
+// for a session. It applies to embedded and downloaded subtitles alike.
+func (m *Manager) SetSubtitleOffset(sessionID string, offsetMs int64) {
+	m.mu.Lock()
+	sess := m.sessions[sessionID]
+	if sess == nil || sess.SubtitleOffset == offsetMs {
+		m.mu.Unlock()
+		return
+	}
+	sess.SubtitleOffset = offsetMs
+	m.mu.Unlock()
+
+	if m.db != nil {
+		if err := m.db.UpdateSessionSubtitleOffset(sessionID, offsetMs); err != nil {
+			log.Warn().Err(err).Str("session_id", sessionID).Msg("failed to persist subtitle offset")
+		}
+	}
+}
+
+// RestoreSessions re-adds the torrents of all persisted sessions in the
+// background, so clients can reconnect to their session IDs after a restart
+// without waiting for metadata. Sessions that fail here are retried lazily
+// on first access.
+func (m *Manager) RestoreSessions() {
+	if m.db == nil {
+		return
+	}
+	recs, err := m.db.ListSessions()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load persisted sessions")
+		return
+	}
+	if len(recs) == 0 {
+		return
+	}
+
+	log.Info().Int("count", len(recs)).Msg("restoring persisted sessions")
+	for _, rec := range recs {
+		go m.lookup(rec.ID)
+	}
+}
+
+// Resume returns a session (restoring it after a restart if needed) along
+// with the last delivered playback position, for ?t= continuation.
+func (m *Manager) Resume(sessionID string) (*models.StreamSession, error) {
+	sess := m.lookup(sessionID)
+	if sess == nil {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s := sess.StreamSession
+	return &s, nil
+}
+
+// lookup returns the in-memory session, falling back to restoring it from the
+// database when the server restarted (or the session was unloaded as idle)
+// since the session was created. Lookups count as session activity.
+func (m *Manager) lookup(id string) *Session {
+	m.mu.RLock()
+	sess := m.sessions[id]
+	m.mu.RUnlock()
+	if sess != nil {
+		sess.touch()
+		return sess
+	}
+	if m.db == nil {
+		return nil
+	}
+
+	// Only one restore per session runs; concurrent callers wait for it.
+	m.restoreMu.Lock()
+	if wait, ok := m.restoring[id]; ok {
+		m.restoreMu.Unlock()
+		<-wait
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		return m.sessions[id]
+	}
+	done := make(chan struct{})
+	m.restoring[id] = done
+	m.restoreMu.Unlock()
+
+	defer func() {
+		m.restoreMu.Lock()
+		delete(m.restoring, id)
+		m.restoreMu.Unlock()
+		close(done)
+	}()
+
+	// It may have been restored just before we registered.
+	m.mu.RLock()
+	sess = m.sessions[id]
+	m.mu.RUnlock()
+	if sess != nil {
+		return sess
+	}
+
+	sess, err := m.restore(id)
+	if err != nil {
+		log.Warn().Err(err).Str("session_id", id).Msg("failed to restore session")
+		return nil
+	}
+	return sess
+}
+
+// restore re-creates a persisted session under its original ID.
+func (m *Manager) restore(id string) (*Session, error) {
+	rec, err := m.db.GetSession(id)
+	if err != nil || rec == nil {
+		return nil, err
+	}
+
+	log.Info().Str("session_id", id).Str("source", rec.Source).Msg("restoring persisted session")
+
+	var sess *Session
+	if rec.Source == "" || rec.Source == SourceTorrent {
+		sess, err = m.startTorrentSession(rec.ID, rec.TMDbID, rec.Title, rec.MagnetURI, rec.FileIndex, rec.FilePath)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		sess, err = m.restoreDirect(rec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	sess.LastPosition = rec.LastPosition
+	sess.Season, sess.Episode = rec.Season, rec.Episode
+	sess.AudioTrack = rec.AudioTrack
+	m.mu.Unlock()
+	return sess, nil
+}
+
+// restoreDirect re-resolves a direct-source session with the source that
+// originally served it, since resolved links expire.
+func (m *Manager) restoreDirect(rec *models.StreamSession) (*Session, error) {
+	req := models.SourceRequest{
+		TMDbID:    rec.TMDbID,
+		Title:     rec.Title,
+		Season:    rec.Season,
+		Episode:   rec.Episode,
+		MagnetURI: rec.MagnetURI,
+		InfoHash:  rec.InfoHash,
+	}
+	for _, src := range m.sources {
+		if src.Name() != rec.Source {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), sourceResolveTimeout)
+		defer cancel()
+		ds, err := src.Resolve(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("re-resolve %s: %w", rec.Source, err)
+		}
+		return m.startDirect(rec.ID, req, rec.Source, ds, nil), nil
+	}
+	return nil, fmt.Errorf("source %q is not configured", rec.Source)
+}
@@ -0,0 +1,173 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+)
+
+// Rutor category IDs: foreign and Russian films, animation, anime.
+var rutorMovieCategories = []int{1, 5, 7, 10}
+
+// Rutor category IDs: foreign and Russian series.
+var rutorTVCategories = []int{4, 16}
+
+// Rutor is a torrent search provider that scrapes rutor.info. Listings
+// carry magnets, so no login or topic pages are needed.
+type Rutor struct {
+	client  *httpclient.Client
+	mirrors *mirrorList
+}
+
+func NewRutor(mirrors []string, opts httpclient.Options) *Rutor {
+	if opts.Timeout == 0 {
+		opts.Timeout = 20 * time.Second
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = httpclient.BrowserUserAgent
+	}
+	return &Rutor{client: httpclient.New(opts), mirrors: newMirrorList(mirrors)}
+}
+
+func (r *Rutor) Name() string { return "rutor" }
+
+// Search searches Rutor's film, animation and anime sections.
+func (r *Rutor) Search(ctx context.Context, title, imdbID string, year string) ([]models.TorrentResult, error) {
+	query := title
+	if year != "" {
+		query += " " + year
+	}
+	return r.searchCategories(ctx, []string{query}, rutorMovieCategories)
+}
+
+// SearchTV searches Rutor's series sections. Season packs are named
+// inconsistently ("[S01]", "[01x01-08 из 08]"), so the title is searched
+// for alone; an episode is also searched for by its scene marker
+// ("S01E05"), which single-episode releases of foreign shows carry.
+func (r *Rutor) SearchTV(ctx context.Context, title string, seasonNum, episode int, year string) ([]models.TorrentResult, error) {
+	queries := []string{title}
+	if seasonNum > 0 && episode > 0 {
+		queries = append(queries, title+" "+episodeTag(seasonNum, episode))
+	}
+	return r.searchCategories(ctx, queries, rutorTVCategories)
+}
+
+// searchCategories searches each query in each category at once, as
+// Rutor's search takes one category, and merges the results. It fails only
+// if every search does.
+func (r *Rutor) searchCategories(ctx context.Context, queries []string, categories []int) ([]models.TorrentResult, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []models.TorrentResult
+		lastErr error
+		failed  int
+	)
+	for _, query := range queries {
+		for _, cat := range categories {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := r.searchCategory(ctx, query, cat)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					log.Warn().Err(err).Int("category", cat).Msg("rutor search failed")
+					lastErr = err
+					failed++
+					return
+				}
+				results = append(results, res...)
+			}()
+		}
+	}
+	wg.Wait()
+
+	if failed == len(queries)*len(categories) {
+		return nil, lastErr
+	}
+	return results, nil
+}
+
+func (r *Rutor) searchCategory(ctx context.Context, query string, category int) ([]models.TorrentResult, error) {
+	// /search/{page}/{category}/{mode}/{sort}/{query}: mode 000 matches the
+	// phrase in titles, sort 2 is by seeders.
+	searchPath := fmt.Sprintf("/search/0/%d/000/2/%s", category, url.PathEscape(query))
+
+	resp, _, err := r.mirrors.do(ctx, func(host string) (*http.Response, error) {
+		return r.client.Get(ctx, "https://"+host+searchPath)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rutor search: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rutor returned status %d", resp.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parse search results: %w", err)
+	}
+	return parseRutorResults(doc), nil
+}
+
+// parseRutorResults extracts results from Rutor's listing table. Rows have
+// the date, the links and title, a comment count (only when there are
+// comments), the size, and the seeders and leechers.
+func parseRutorResults(doc *goquery.Document) []models.TorrentResult {
+	var results []models.TorrentResult
+
+	doc.Find("#index tr.gai, #index tr.tum").Each(func(i int, s *goquery.Selection) {
+		cells := s.Children()
+		if cells.Length() < 4 {
+			return
+		}
+
+		magnet := s.Find(`a[href^="magnet:"]`).AttrOr("href", "")
+		titleLink := s.Find(`a[href^="/torrent/"]`).First()
+		title := strings.TrimSpace(titleLink.Text())
+		if magnet == "" || title == "" {
+			return
+		}
+
+		// "/torrent/{id}/{slug}"
+		topicID := path.Base(path.Dir(titleLink.AttrOr("href", "")))
+		if _, err := strconv.Atoi(topicID); err != nil {
+			topicID = ""
+		}
+
+		sizeBytes := parseHumanSize(cells.Eq(cells.Length() - 2).Text())
+		peersCell := cells.Last()
+		seeds, _ := strconv.Atoi(strings.TrimSpace(peersCell.Find("span.green").Text()))
+		peers, _ := strconv.Atoi(strings.TrimSpace(peersCell.Find("span.red").Text()))
+
+		results = append(results, models.TorrentResult{
+			Provider:  "rutor",
+			Title:     title,
+			MagnetURI: magnet,
+			Quality:   extractQuality(title),
+			SizeBytes: sizeBytes,
+			SizeHuman: formatSize(sizeBytes),
+			Seeds:     seeds,
+			Peers:     peers,
+			Audio:     extractAudio(title),
+			Source:    extractSource(title),
+			TopicID:   topicID,
+		})
+	})
+
+	return results
+}
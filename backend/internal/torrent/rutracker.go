@@ -1,6 +1,8 @@
 package torrent
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,10 +11,13 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/httpclient"
 	"github.com/streambox/backend/internal/models"
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/transform"
@@ -38,32 +43,124 @@ var tvAndAnimeKeywords = []string{
 	"аниме", "anime",
 }
 
+// rutrackerSessionTTL is how long a login is kept when its cookies don't
+// say when they expire.
+const rutrackerSessionTTL = 30 * 24 * time.Hour
+
+// reloginInterval is how soon after a login another one is skipped, when
+// concurrent requests find the session ended at once.
+const reloginInterval = time.Minute
+
 // Rutracker is a torrent search provider that scrapes rutracker.org.
 type Rutracker struct {
 	mirror   string
 	username string
 	password string
-	client   *http.Client
-	loggedIn bool
+	client   *httpclient.Client
+	jar      *sessionJar
+	store    db.Store // saves the login across restarts; may be nil
+
+	mu        sync.Mutex // serializes logins
+	loggedIn  bool
+	lastLogin time.Time
+
+	topicLimit   int // results whose topic page is fetched for the magnet
+	topicWorkers int // topic pages fetched at once
 }
 
-func NewRutracker(mirror, username, password string) *Rutracker {
-	jar, _ := cookiejar.New(nil)
+func NewRutracker(mirror, username, password string, opts httpclient.Options) *Rutracker {
+	jar := newSessionJar()
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	opts.Jar = jar
 	return &Rutracker{
 		mirror:   mirror,
 		username: username,
 		password: password,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-			Jar:     jar,
-		},
+		client:   httpclient.New(opts),
+		jar:      jar,
+
+		topicLimit:   10,
+		topicWorkers: 4,
 	}
 }
 
+// SetTopicLimits sets how many of a search's top results get their topic
+// page fetched (results without one are dropped, as the magnet is there),
+// and how many pages are fetched at once.
+func (r *Rutracker) SetTopicLimits(topics, workers int) {
+	r.topicLimit = topics
+	r.topicWorkers = max(workers, 1)
+}
+
 func (r *Rutracker) Name() string { return "rutracker" }
 
-// login authenticates with Rutracker and stores the session cookie.
-func (r *Rutracker) login() error {
+// SetSessionStore saves logins in store and restores the saved one, so
+// restarts don't log in again; fresh logins from the same account can trip
+// Rutracker's anti-abuse limits.
+func (r *Rutracker) SetSessionStore(store db.Store) {
+	r.store = store
+	s, err := store.GetProviderSession(r.Name())
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to load rutracker session")
+		return
+	}
+	if s == nil {
+		return
+	}
+
+	cookies := make([]*http.Cookie, 0, len(s.Cookies))
+	for _, c := range s.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value, Path: c.Path, Expires: c.Expires})
+	}
+	r.jar.SetCookies(r.forumURL(), cookies)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loggedIn = r.hasSessionCookie()
+	if r.loggedIn {
+		log.Info().Time("expires_at", s.ExpiresAt).Msg("rutracker session restored")
+	}
+}
+
+func (r *Rutracker) forumURL() *url.URL {
+	return &url.URL{Scheme: "https", Host: r.mirror, Path: "/forum/"}
+}
+
+func (r *Rutracker) hasSessionCookie() bool {
+	for _, cookie := range r.jar.Cookies(r.forumURL()) {
+		if cookie.Name == "bb_session" {
+			return true
+		}
+	}
+	return false
+}
+
+// saveSession stores the jar's cookies for the forum, if there is a store.
+func (r *Rutracker) saveSession() {
+	if r.store == nil {
+		return
+	}
+	s := &models.ProviderSession{Provider: r.Name()}
+	for _, c := range r.jar.Cookies(r.forumURL()) {
+		expires := r.jar.expiry(c.Name)
+		s.Cookies = append(s.Cookies, models.ProviderCookie{Name: c.Name, Value: c.Value, Path: "/forum/", Expires: expires})
+		if !expires.IsZero() && (s.ExpiresAt.IsZero() || expires.Before(s.ExpiresAt)) {
+			s.ExpiresAt = expires
+		}
+	}
+	if s.ExpiresAt.IsZero() {
+		s.ExpiresAt = time.Now().Add(rutrackerSessionTTL)
+	}
+	if err := r.store.SaveProviderSession(s); err != nil {
+		log.Warn().Err(err).Msg("failed to save rutracker session")
+	}
+}
+
+// login authenticates with Rutracker and stores the session cookie. r.mu
+// must be held.
+func (r *Rutracker) login(ctx context.Context) error {
 	loginURL := fmt.Sprintf("https://%s/forum/login.php", r.mirror)
 
 	data := url.Values{
@@ -72,117 +169,139 @@ func (r *Rutracker) login() error {
 		"login":          {"Вход"},
 	}
 
-	resp, err := r.client.PostForm(loginURL, data)
+	resp, err := r.client.PostForm(ctx, loginURL, data)
 	if err != nil {
 		return fmt.Errorf("rutracker login request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Check for bb_session cookie in response headers directly
-	for _, cookie := range resp.Cookies() {
-		if cookie.Name == "bb_session" {
-			r.loggedIn = true
-			log.Info().Msg("rutracker login successful")
-			return nil
-		}
-	}
-
-	// Also check the cookie jar (redirect may have consumed the cookies)
-	u, _ := url.Parse(fmt.Sprintf("https://%s/forum/", r.mirror))
-	for _, cookie := range r.client.Jar.Cookies(u) {
-		if cookie.Name == "bb_session" {
-			r.loggedIn = true
-			log.Info().Msg("rutracker login successful")
-			return nil
-		}
+	// The jar holds the cookies set by the response and any redirect.
+	if !r.hasSessionCookie() {
+		return fmt.Errorf("rutracker login failed: bb_session cookie not found")
 	}
-
-	return fmt.Errorf("rutracker login failed: bb_session cookie not found")
+	r.loggedIn = true
+	r.lastLogin = time.Now()
+	log.Info().Msg("rutracker login successful")
+	r.saveSession()
+	return nil
 }
 
-func (r *Rutracker) ensureLoggedIn() error {
+func (r *Rutracker) ensureLoggedIn(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if !r.loggedIn {
-		return r.login()
+		return r.login(ctx)
 	}
 	return nil
 }
 
+// relogin logs in again after Rutracker ended the session, forgetting the
+// saved one, unless another request has just done so.
+func (r *Rutracker) relogin(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loggedIn && time.Since(r.lastLogin) < reloginInterval {
+		return nil
+	}
+	r.loggedIn = false
+	if r.store != nil {
+		if err := r.store.DeleteProviderSession(r.Name()); err != nil {
+			log.Warn().Err(err).Msg("failed to delete rutracker session")
+		}
+	}
+	return r.login(ctx)
+}
+
 // Search searches Rutracker for movie torrents matching the given title.
 // Also searches anime categories for anime films.
-func (r *Rutracker) Search(title, imdbID string, year string) ([]models.TorrentResult, error) {
+func (r *Rutracker) Search(ctx context.Context, title, imdbID string, year string) ([]models.TorrentResult, error) {
 	query := title
 	if year != "" {
 		query += " " + year
 	}
 	categories := rutrackerMovieCategories + "," + rutrackerAnimeCategories
-	return r.doSearch(query, categories, movieAndAnimeKeywords, title)
+	return r.doSearch(ctx, []string{query}, categories, movieAndAnimeKeywords, title, nil)
 }
 
-// SearchTV searches Rutracker for TV series and anime torrents.
-func (r *Rutracker) SearchTV(title string, seasonNum int, year string) ([]models.TorrentResult, error) {
-	query := title
+// SearchTV searches Rutracker for TV series and anime torrents. Topics hold
+// whole seasons, so an episode is looked for in its season's topics. A
+// season search also searches the title alone for the multi-season packs
+// ("Сезон: 1-5") the season query misses, dropping other seasons' topics.
+func (r *Rutracker) SearchTV(ctx context.Context, title string, seasonNum, episode int, year string) ([]models.TorrentResult, error) {
+	queries := []string{title}
 	if seasonNum > 0 {
-		query += fmt.Sprintf(" сезон %d", seasonNum)
+		queries = []string{fmt.Sprintf("%s сезон %d", title, seasonNum), title}
+	}
+	keep := func(res models.TorrentResult) bool {
+		return parsePack(res.Title).covers(seasonNum, episode)
 	}
 	categories := rutrackerTVCategories + "," + rutrackerAnimeCategories
-	return r.doSearch(query, categories, tvAndAnimeKeywords, title)
+	return r.doSearch(ctx, queries, categories, tvAndAnimeKeywords, title, keep)
 }
 
-// doSearch is the shared search logic for both movies and TV.
+// doSearch is the shared search logic for both movies and TV. Results of
+// the queries are merged in order, without repeated topics.
 // titleQuery is the original title (without year/season) used to filter irrelevant results.
-func (r *Rutracker) doSearch(query, categories string, forumKeywords []string, titleQuery string) ([]models.TorrentResult, error) {
-	if err := r.ensureLoggedIn(); err != nil {
+// keep, if set, drops results before their topic pages are fetched.
+func (r *Rutracker) doSearch(ctx context.Context, queries []string, categories string, forumKeywords []string, titleQuery string, keep func(models.TorrentResult) bool) ([]models.TorrentResult, error) {
+	if err := r.ensureLoggedIn(ctx); err != nil {
 		return nil, err
 	}
 
-	searchURL := fmt.Sprintf("https://%s/forum/tracker.php?nm=%s&c=%s",
-		r.mirror, url.QueryEscape(query), categories)
-
-	req, err := http.NewRequest("GET", searchURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("build search request: %w", err)
-	}
-
-	resp, err := r.client.Do(req)
-	if err != nil {
-		r.loggedIn = false
-		if loginErr := r.login(); loginErr != nil {
-			return nil, loginErr
+	var results []models.TorrentResult
+	seen := make(map[string]bool)
+	for _, query := range queries {
+		searchURL := fmt.Sprintf("https://%s/forum/tracker.php?nm=%s&c=%s",
+			r.mirror, url.QueryEscape(query), categories)
+
+		// Network errors are retried by the HTTP client; only a login page in
+		// place of the results means the session has ended.
+		doc, err := r.searchPage(ctx, searchURL)
+		if errors.Is(err, errNotLoggedIn) {
+			if err := r.relogin(ctx); err != nil {
+				return nil, err
+			}
+			doc, err = r.searchPage(ctx, searchURL)
 		}
-		resp, err = r.client.Do(req)
 		if err != nil {
-			return nil, fmt.Errorf("rutracker search: %w", err)
+			return nil, err
 		}
-	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("rutracker returned status %d", resp.StatusCode)
-	}
-
-	// Decode cp1251 → UTF-8
-	utf8Reader := transform.NewReader(resp.Body, charmap.Windows1251.NewDecoder())
-	doc, err := goquery.NewDocumentFromReader(utf8Reader)
-	if err != nil {
-		return nil, fmt.Errorf("parse search results: %w", err)
+		for _, res := range r.parseSearchResults(doc, forumKeywords, titleQuery) {
+			if (res.TopicID != "" && seen[res.TopicID]) || (keep != nil && !keep(res)) {
+				continue
+			}
+			seen[res.TopicID] = true
+			results = append(results, res)
+		}
 	}
 
-	results := r.parseSearchResults(doc, forumKeywords, titleQuery)
-
-	// Fetch magnet links for top results (limit to avoid too many requests)
-	limit := 10
-	if len(results) < limit {
-		limit = len(results)
-	}
+	// Fetch magnet links and release details for top results, a few at a
+	// time (limit to avoid too many requests)
+	limit := min(r.topicLimit, len(results))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, r.topicWorkers)
 	for i := 0; i < limit; i++ {
-		if results[i].TopicID != "" {
-			magnet, err := r.getMagnet(results[i].TopicID)
+		if results[i].TopicID == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(res *models.TorrentResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			details, err := r.getTopic(ctx, res.TopicID)
 			if err != nil {
-				log.Warn().Err(err).Str("topic", results[i].TopicID).Msg("failed to get magnet")
-				continue
+				log.Warn().Err(err).Str("topic", res.TopicID).Msg("failed to get magnet")
+				return
 			}
-			results[i].MagnetURI = magnet
-		}
+			details.apply(res)
+		}(&results[i])
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	// Filter out results without magnets
@@ -196,6 +315,31 @@ func (r *Rutracker) doSearch(query, categories string, forumKeywords []string, t
 	return filtered, nil
 }
 
+// searchPage fetches and parses a search results page, returning
+// errNotLoggedIn if Rutracker answers with its login form.
+func (r *Rutracker) searchPage(ctx context.Context, searchURL string) (*goquery.Document, error) {
+	resp, err := r.client.Get(ctx, searchURL)
+	if err != nil {
+		return nil, fmt.Errorf("rutracker search: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rutracker returned status %d", resp.StatusCode)
+	}
+
+	// Decode cp1251 → UTF-8
+	utf8Reader := transform.NewReader(resp.Body, charmap.Windows1251.NewDecoder())
+	doc, err := goquery.NewDocumentFromReader(utf8Reader)
+	if err != nil {
+		return nil, fmt.Errorf("parse search results: %w", err)
+	}
+	if strings.HasSuffix(resp.Request.URL.Path, "/login.php") || doc.Find(`input[name="login_username"]`).Length() > 0 {
+		return nil, errNotLoggedIn
+	}
+	return doc, nil
+}
+
 // parseSearchResults extracts torrent results from the Rutracker HTML table.
 // titleQuery filters results where the search term only appears in credits, not the title.
 func (r *Rutracker) parseSearchResults(doc *goquery.Document, forumKeywords []string, titleQuery string) []models.TorrentResult {
@@ -277,31 +421,207 @@ func (r *Rutracker) parseSearchResults(doc *goquery.Document, forumKeywords []st
 	return results
 }
 
-// getMagnet fetches the magnet link from a topic page.
-func (r *Rutracker) getMagnet(topicID string) (string, error) {
+// topicDetails is what a topic page adds to a search result: the magnet
+// and the release details from the first post's structured description.
+type topicDetails struct {
+	magnet      string
+	videoCodec  string
+	resolution  string
+	audioTracks []string
+	translation string
+	quality     string // e.g. "BDRip 1080p", from "Качество видео"
+}
+
+// getTopic fetches a topic page and parses its magnet and release details.
+func (r *Rutracker) getTopic(ctx context.Context, topicID string) (*topicDetails, error) {
 	topicURL := fmt.Sprintf("https://%s/forum/viewtopic.php?t=%s", r.mirror, topicID)
 
-	resp, err := r.client.Get(topicURL)
+	resp, err := r.client.Get(ctx, topicURL)
 	if err != nil {
-		return "", fmt.Errorf("fetch topic: %w", err)
+		return nil, fmt.Errorf("fetch topic: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Read body and decode cp1251
+	// Decode cp1251 → UTF-8
 	utf8Reader := transform.NewReader(resp.Body, charmap.Windows1251.NewDecoder())
-	body, err := io.ReadAll(utf8Reader)
+	doc, err := goquery.NewDocumentFromReader(utf8Reader)
 	if err != nil {
-		return "", fmt.Errorf("read topic page: %w", err)
+		return nil, fmt.Errorf("parse topic page: %w", err)
+	}
+
+	details := parseTopic(doc)
+	if details.magnet == "" {
+		return nil, fmt.Errorf("no magnet link found on topic %s", topicID)
+	}
+	return details, nil
+}
+
+var (
+	magnetRe = regexp.MustCompile(`magnet:\?xt=urn:btih:[a-fA-F0-9]+[^"'\s]*`)
+	// topicFieldRe matches "Label: value" lines of a release description.
+	topicFieldRe = regexp.MustCompile(`^\s*([^:]{2,40}?)\s*:\s*(.+?)\s*$`)
+	// resolutionRe matches frame sizes such as "1920x1080" (with a Latin
+	// or Cyrillic x, or a multiplication sign).
+	resolutionRe = regexp.MustCompile(`\b(\d{3,4})\s*[xх×]\s*(\d{3,4})\b`)
+)
+
+// videoCodecs maps codec names in release descriptions to FFprobe's.
+var videoCodecs = []struct {
+	pattern *regexp.Regexp
+	codec   string
+}{
+	{regexp.MustCompile(`(?i)\b(HEVC|[xh]\.?265)\b`), "hevc"},
+	{regexp.MustCompile(`(?i)\bAV1\b`), "av1"},
+	{regexp.MustCompile(`(?i)\b(AVC|[xh]\.?264)\b`), "h264"},
+	{regexp.MustCompile(`(?i)\bVP9\b`), "vp9"},
+	{regexp.MustCompile(`(?i)\bMPEG-?2\b`), "mpeg2video"},
+	{regexp.MustCompile(`(?i)\b(XviD|DivX|MPEG-?4 (Visual|ASP))\b`), "mpeg4"},
+}
+
+// parseTopic reads the magnet and, from the first post, the "Видео",
+// "Аудио", "Перевод" and "Качество видео" lines of the release description.
+func parseTopic(doc *goquery.Document) *topicDetails {
+	details := &topicDetails{magnet: doc.Find("a.magnet-link").AttrOr("href", "")}
+	if !strings.HasPrefix(details.magnet, "magnet:") {
+		html, _ := doc.Html()
+		details.magnet = magnetRe.FindString(html)
 	}
 
-	// Extract magnet link with regex (faster than full HTML parse)
-	magnetRe := regexp.MustCompile(`magnet:\?xt=urn:btih:[a-fA-F0-9]+[^"'\s]*`)
-	match := magnetRe.Find(body)
-	if match == nil {
-		return "", fmt.Errorf("no magnet link found on topic %s", topicID)
+	post := doc.Find(".post_body").First()
+	post.Find("br").ReplaceWithHtml("\n")
+	for _, line := range strings.Split(post.Text(), "\n") {
+		m := topicFieldRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		label, value := strings.ToLower(m[1]), m[2]
+		switch {
+		case strings.HasPrefix(label, "видео") && details.videoCodec == "" && details.resolution == "":
+			for _, vc := range videoCodecs {
+				if vc.pattern.MatchString(value) {
+					details.videoCodec = vc.codec
+					break
+				}
+			}
+			if res := resolutionRe.FindStringSubmatch(value); res != nil {
+				details.resolution = res[1] + "x" + res[2]
+			}
+		case strings.HasPrefix(label, "аудио"):
+			details.audioTracks = append(details.audioTracks, truncateDetail(value))
+		case strings.HasPrefix(label, "перевод") && details.translation == "":
+			details.translation = truncateDetail(value)
+		case label == "качество видео" || label == "качество":
+			if details.quality == "" {
+				details.quality = truncateDetail(value)
+			}
+		}
 	}
+	return details
+}
 
-	return string(match), nil
+// truncateDetail shortens a description value to keep results compact.
+func truncateDetail(s string) string {
+	const maxLen = 160
+	if r := []rune(s); len(r) > maxLen {
+		return string(r[:maxLen-1]) + "…"
+	}
+	return s
+}
+
+// apply adds the topic's details to a search result, filling in what the
+// title didn't tell.
+func (d *topicDetails) apply(res *models.TorrentResult) {
+	res.MagnetURI = d.magnet
+	res.VideoCodec = d.videoCodec
+	res.Resolution = d.resolution
+	res.AudioTracks = d.audioTracks
+	res.Translation = d.translation
+
+	if res.Quality == "unknown" {
+		if q := resolutionQuality(d.resolution); q != "" {
+			res.Quality = q
+		} else if d.quality != "" {
+			res.Quality = extractQuality(d.quality)
+		}
+	}
+	if res.Source == "" {
+		res.Source = extractSource(d.quality)
+	}
+	if res.Audio == "" {
+		res.Audio = extractAudio(d.translation + " " + strings.Join(d.audioTracks, " "))
+	}
+}
+
+// resolutionQuality maps a frame size such as "1920x1080" to a quality
+// label, by width so cropped (letterboxed) frames count at full height.
+func resolutionQuality(resolution string) string {
+	w, _, ok := strings.Cut(resolution, "x")
+	if !ok {
+		return ""
+	}
+	width, _ := strconv.Atoi(w)
+	switch {
+	case width >= 3200:
+		return "2160p"
+	case width >= 1600:
+		return "1080p"
+	case width >= 1000:
+		return "720p"
+	case width >= 600:
+		return "480p"
+	}
+	return ""
+}
+
+// maxTorrentFileSize caps downloaded .torrent files.
+const maxTorrentFileSize = 10 << 20
+
+// FetchTorrentFile downloads a topic's .torrent file (dl.php), which needs a
+// logged-in session. Unlike the topic's magnet it carries the full metadata.
+func (r *Rutracker) FetchTorrentFile(ctx context.Context, topicID string) ([]byte, error) {
+	if err := r.ensureLoggedIn(ctx); err != nil {
+		return nil, err
+	}
+
+	data, err := r.fetchTorrentFile(ctx, topicID)
+	if errors.Is(err, errNotLoggedIn) {
+		// The session cookie expired; log in again once.
+		if err := r.relogin(ctx); err != nil {
+			return nil, err
+		}
+		data, err = r.fetchTorrentFile(ctx, topicID)
+	}
+	return data, err
+}
+
+var errNotLoggedIn = errors.New("rutracker session expired")
+
+func (r *Rutracker) fetchTorrentFile(ctx context.Context, topicID string) ([]byte, error) {
+	dlURL := fmt.Sprintf("https://%s/forum/dl.php?t=%s", r.mirror, url.QueryEscape(topicID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, dlURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build download request: %w", err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rutracker torrent download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rutracker returned status %d for torrent %s", resp.StatusCode, topicID)
+	}
+	// Without a valid session dl.php answers with the login page.
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return nil, errNotLoggedIn
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTorrentFileSize))
+	if err != nil {
+		return nil, fmt.Errorf("read torrent file: %w", err)
+	}
+	return data, nil
 }
 
 func extractTopicID(href string) string {
@@ -335,7 +655,7 @@ var audioPatterns = []struct {
 	{regexp.MustCompile(`(?i)\bAVO\b`), "AVO"},
 	{regexp.MustCompile(`(?i)\bUkr\b`), "Ukr"},
 	{regexp.MustCompile(`(?i)Original\s*\(Eng\)`), "Original Eng"},
-	{regexp.MustCompile(`(?i)Проф\.\s*(?:много|одно)голос`), "Профессиональный перевод"},
+	{regexp.MustCompile(`(?i)Проф(?:\.|ессиональный)\s*\(?(?:много|одно)голос`), "Профессиональный перевод"},
 	{regexp.MustCompile(`(?i)iTunes`), "iTunes"},
 }
 
@@ -373,3 +693,41 @@ func formatSize(bytes int64) string {
 	}
 	return fmt.Sprintf("%.0f MB", float64(bytes)/float64(mb))
 }
+
+// sessionJar is a cookie jar that also remembers when its cookies expire,
+// which the standard jar doesn't tell, so logins can be saved with their
+// expiry.
+type sessionJar struct {
+	*cookiejar.Jar
+
+	mu      sync.Mutex
+	expires map[string]time.Time // by cookie name
+}
+
+func newSessionJar() *sessionJar {
+	jar, _ := cookiejar.New(nil)
+	return &sessionJar{Jar: jar, expires: make(map[string]time.Time)}
+}
+
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	for _, c := range cookies {
+		switch {
+		case c.MaxAge > 0:
+			j.expires[c.Name] = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			j.expires[c.Name] = c.Expires
+		default:
+			delete(j.expires, c.Name)
+		}
+	}
+	j.mu.Unlock()
+	j.Jar.SetCookies(u, cookies)
+}
+
+// expiry returns when the named cookie expires, or zero for session cookies.
+func (j *sessionJar) expiry(name string) time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.expires[name]
+}
@@ -0,0 +1,286 @@
+package torrent
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// udpProtocolID is the magic constant that opens a BEP 15 connect request.
+const udpProtocolID = 0x41727101980
+
+// trackerScrape is a single tracker's answer for one info hash.
+type trackerScrape struct {
+	seeders   int
+	completed int
+	leechers  int
+}
+
+// Scrape queries the magnet's trackers and the DHT for live swarm counts.
+// Seeds/leechers are the maximum reported by any single tracker since swarms
+// shared across trackers would be double-counted by summing.
+func (tc *TorrentClient) Scrape(ctx context.Context, magnet metainfo.Magnet) *models.SwarmStats {
+	stats := &models.SwarmStats{TrackersQueried: len(magnet.Trackers)}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for _, tr := range magnet.Trackers {
+		wg.Add(1)
+		go func(tracker string) {
+			defer wg.Done()
+			res, err := tc.scrapeTracker(ctx, tracker, magnet.InfoHash)
+			if err != nil {
+				log.Debug().Err(err).Str("tracker", tracker).Msg("tracker scrape failed")
+				return
+			}
+			mu.Lock()
+			stats.TrackersResponded++
+			stats.Seeds = max(stats.Seeds, res.seeders)
+			stats.Leechers = max(stats.Leechers, res.leechers)
+			stats.Completed = max(stats.Completed, res.completed)
+			mu.Unlock()
+		}(tr)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		n := tc.dhtPeerCount(ctx, magnet.InfoHash)
+		mu.Lock()
+		stats.DHTPeers = n
+		mu.Unlock()
+	}()
+
+	wg.Wait()
+	stats.ScrapedAt = time.Now().UTC().Format(time.RFC3339)
+	return stats
+}
+
+// scrapeTracker dispatches to the HTTP or UDP scrape protocol.
+func (tc *TorrentClient) scrapeTracker(ctx context.Context, tracker string, ih metainfo.Hash) (*trackerScrape, error) {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return nil, fmt.Errorf("parse tracker url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return tc.scrapeHTTP(ctx, u, ih)
+	case "udp":
+		if tc.trackerProxied {
+			return nil, errTrackerProxied
+		}
+		return scrapeUDP(ctx, u, ih)
+	default:
+		return nil, fmt.Errorf("unsupported tracker scheme %q", u.Scheme)
+	}
+}
+
+// scrapeHTTP performs a BEP 48 scrape. Only trackers whose announce path ends
+// in "announce" support the conventional scrape URL.
+func (tc *TorrentClient) scrapeHTTP(ctx context.Context, announce *url.URL, ih metainfo.Hash) (*trackerScrape, error) {
+	idx := strings.LastIndex(announce.Path, "/")
+	if idx < 0 || !strings.HasPrefix(announce.Path[idx+1:], "announce") {
+		return nil, errors.New("tracker does not support scrape")
+	}
+
+	u := *announce
+	u.Path = announce.Path[:idx+1] + "scrape" + strings.TrimPrefix(announce.Path[idx+1:], "announce")
+	q := u.Query()
+	q.Set("info_hash", string(ih[:]))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("build scrape request: %w", err)
+	}
+	resp, err := tc.scrapeHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("scrape request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tracker returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("read scrape response: %w", err)
+	}
+
+	var sr struct {
+		Files map[string]struct {
+			Complete   int `bencode:"complete"`
+			Incomplete int `bencode:"incomplete"`
+			Downloaded int `bencode:"downloaded"`
+		} `bencode:"files"`
+		FailureReason string `bencode:"failure reason"`
+	}
+	if err := bencode.Unmarshal(body, &sr); err != nil {
+		return nil, fmt.Errorf("decode scrape response: %w", err)
+	}
+	if sr.FailureReason != "" {
+		return nil, fmt.Errorf("tracker failure: %s", sr.FailureReason)
+	}
+
+	f, ok := sr.Files[string(ih[:])]
+	if !ok {
+		return nil, errors.New("info hash missing from scrape response")
+	}
+	return &trackerScrape{seeders: f.Complete, completed: f.Downloaded, leechers: f.Incomplete}, nil
+}
+
+// scrapeUDP performs a BEP 15 connect + scrape exchange.
+func scrapeUDP(ctx context.Context, u *url.URL, ih metainfo.Hash) (*trackerScrape, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("dial tracker: %w", err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	// Connect
+	tid := rand.Uint32()
+	req := make([]byte, 16)
+	binary.BigEndian.PutUint64(req[0:], udpProtocolID)
+	binary.BigEndian.PutUint32(req[8:], 0)
+	binary.BigEndian.PutUint32(req[12:], tid)
+	if _, err := conn.Write(req); err != nil {
+		return nil, fmt.Errorf("send connect: %w", err)
+	}
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("read connect response: %w", err)
+	}
+	if n < 16 || binary.BigEndian.Uint32(buf[0:]) != 0 || binary.BigEndian.Uint32(buf[4:]) != tid {
+		return nil, errors.New("bad connect response")
+	}
+	connID := binary.BigEndian.Uint64(buf[8:])
+
+	// Scrape
+	tid = rand.Uint32()
+	req = make([]byte, 36)
+	binary.BigEndian.PutUint64(req[0:], connID)
+	binary.BigEndian.PutUint32(req[8:], 2)
+	binary.BigEndian.PutUint32(req[12:], tid)
+	copy(req[16:], ih[:])
+	if _, err := conn.Write(req); err != nil {
+		return nil, fmt.Errorf("send scrape: %w", err)
+	}
+
+	n, err = conn.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("read scrape response: %w", err)
+	}
+	if n >= 8 && binary.BigEndian.Uint32(buf[0:]) == 3 {
+		return nil, fmt.Errorf("tracker error: %s", strings.TrimSpace(string(buf[8:n])))
+	}
+	if n < 20 || binary.BigEndian.Uint32(buf[0:]) != 2 || binary.BigEndian.Uint32(buf[4:]) != tid {
+		return nil, errors.New("bad scrape response")
+	}
+
+	return &trackerScrape{
+		seeders:   int(binary.BigEndian.Uint32(buf[8:])),
+		completed: int(binary.BigEndian.Uint32(buf[12:])),
+		leechers:  int(binary.BigEndian.Uint32(buf[16:])),
+	}, nil
+}
+
+// dhtPeerCount runs a get_peers traversal on every DHT server until ctx is
+// done and returns the number of distinct peers found.
+func (tc *TorrentClient) dhtPeerCount(ctx context.Context, ih metainfo.Hash) int {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		seen = make(map[string]bool)
+	)
+
+	for _, s := range tc.client.DhtServers() {
+		a, err := s.Announce(ih, 0, false)
+		if err != nil {
+			log.Debug().Err(err).Msg("dht get_peers failed")
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer a.Close()
+			for {
+				select {
+				case pv, ok := <-a.Peers():
+					if !ok {
+						return
+					}
+					mu.Lock()
+					for _, p := range pv.Peers {
+						seen[p.String()] = true
+					}
+					mu.Unlock()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return len(seen)
+}
+
+// Scrape returns live swarm counts for a magnet URI or info hash.
+func (m *Manager) Scrape(input string, timeout time.Duration) (*models.SwarmStats, error) {
+	magnet, err := ParseMagnet(input)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.client.Scrape(ctx, magnet), nil
+}
+
+// AttachLiveStats scrapes the first limit results concurrently and stores the
+// fresh counts in each result's Live field. Results whose magnet can't be
+// parsed are left untouched.
+func (m *Manager) AttachLiveStats(results []models.TorrentResult, limit int, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := range results[:min(limit, len(results))] {
+		magnet, err := ParseMagnet(results[i].MagnetURI)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(res *models.TorrentResult) {
+			defer wg.Done()
+			res.Live = m.client.Scrape(ctx, magnet)
+		}(&results[i])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,87 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// mirrorList spreads a tracker's requests over its mirror domains. Requests
+// start at the last mirror that answered, so a blocked domain costs one
+// failed request rather than one per search.
+type mirrorList struct {
+	hosts []string
+
+	mu      sync.Mutex
+	current int
+}
+
+func newMirrorList(hosts []string) *mirrorList {
+	return &mirrorList{hosts: hosts}
+}
+
+// do calls fetch with each mirror's host in turn until one answers with a
+// status below 500, returning its response and host. It gives up early once
+// ctx is done.
+func (m *mirrorList) do(ctx context.Context, fetch func(host string) (*http.Response, error)) (*http.Response, string, error) {
+	if len(m.hosts) == 0 {
+		return nil, "", fmt.Errorf("no mirrors configured")
+	}
+	m.mu.Lock()
+	start := m.current
+	m.mu.Unlock()
+
+	var err error
+	for i := range m.hosts {
+		idx := (start + i) % len(m.hosts)
+		host := m.hosts[idx]
+
+		var resp *http.Response
+		resp, err = fetch(host)
+		if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+			resp.Body.Close()
+			err = fmt.Errorf("%s returned status %d", host, resp.StatusCode)
+		}
+		if err == nil {
+			m.mu.Lock()
+			m.current = idx
+			m.mu.Unlock()
+			return resp, host, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, "", fmt.Errorf("all mirrors failed: %w", err)
+}
+
+// humanSizeRe matches sizes as trackers print them: "1.46 GB", "700 MB",
+// "1,4 ГБ".
+var humanSizeRe = regexp.MustCompile(`(?i)(\d+(?:[.,]\d+)?)\s*(TB|GB|MB|KB|ТБ|ГБ|МБ|КБ|B|Б)`)
+
+// humanSizeShifts maps size units to their power-of-two shifts.
+var humanSizeShifts = map[string]uint{
+	"B": 0, "KB": 10, "MB": 20, "GB": 30, "TB": 40,
+	"Б": 0, "КБ": 10, "МБ": 20, "ГБ": 30, "ТБ": 40,
+}
+
+// parseHumanSize parses the first size in s, returning 0 if there is none.
+func parseHumanSize(s string) int64 {
+	m := humanSizeRe.FindStringSubmatch(strings.Join(strings.Fields(s), " "))
+	if m == nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", "."), 64)
+	if err != nil {
+		return 0
+	}
+	shift, ok := humanSizeShifts[strings.ToUpper(m[2])]
+	if !ok {
+		return 0
+	}
+	return int64(v * float64(int64(1)<<shift))
+}
@@ -0,0 +1,101 @@
+package torrent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/models"
+)
+
+// searchCachePruneInterval is how often expired searches are deleted.
+const searchCachePruneInterval = time.Hour
+
+// searchCache keeps each provider's results for recent searches, so
+// repeated searches don't scrape the sites again.
+type searchCache struct {
+	store db.Store
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// SetCache caches provider results in store for ttl; 0 disables caching.
+func (r *ProviderRegistry) SetCache(store db.Store, ttl time.Duration) {
+	if ttl <= 0 {
+		r.cache = nil
+		return
+	}
+	r.cache = &searchCache{store: store, ttl: ttl}
+}
+
+// Fresh returns a view of the registry that searches the providers again
+// instead of using cached results, and caches the new ones.
+func (r *ProviderRegistry) Fresh() *ProviderRegistry {
+	fresh := *r
+	fresh.fresh = true
+	return &fresh
+}
+
+// cached returns the provider's cached results for the search key, or runs
+// search and caches what it finds. Failed searches aren't cached.
+func (r *ProviderRegistry) cached(provider, key string, search func() ([]models.TorrentResult, error)) ([]models.TorrentResult, error) {
+	c := r.cache
+	if c == nil {
+		return search()
+	}
+
+	if !r.fresh {
+		var results []models.TorrentResult
+		ok, err := c.store.GetCachedSearch(provider, key, c.ttl, &results)
+		if err != nil {
+			log.Warn().Err(err).Str("provider", provider).Msg("failed to read search cache")
+		}
+		if ok {
+			return results, nil
+		}
+	}
+
+	results, err := search()
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []models.TorrentResult{}
+	}
+	if err := c.store.SaveCachedSearch(provider, key, results); err != nil {
+		log.Warn().Err(err).Str("provider", provider).Msg("failed to cache search results")
+	}
+	c.prune()
+	return results, nil
+}
+
+// prune deletes expired searches, at most every searchCachePruneInterval.
+func (c *searchCache) prune() {
+	c.mu.Lock()
+	if time.Since(c.lastPrune) < searchCachePruneInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.lastPrune = time.Now()
+	c.mu.Unlock()
+
+	if err := c.store.PruneSearchCache(c.ttl); err != nil {
+		log.Warn().Err(err).Msg("failed to prune search cache")
+	}
+}
+
+// searchKey normalizes a search into a cache key: its kind ("movie", "tv",
+// "anime") and arguments, with the title lowercased and its whitespace
+// collapsed.
+func searchKey(kind, title string, args ...any) string {
+	parts := []string{kind, strings.Join(strings.Fields(strings.ToLower(title)), " ")}
+	for _, a := range args {
+		parts = append(parts, strings.TrimSpace(fmt.Sprint(a)))
+	}
+	return strings.Join(parts, "|")
+}
@@ -0,0 +1,286 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// seedOverridesKey is the settings row holding the per-torrent overrides.
+const seedOverridesKey = "seed_overrides"
+
+// seedCheckInterval is how often torrents' uploads and seeding limits are
+// checked.
+const seedCheckInterval = 10 * time.Second
+
+// ErrInvalidSeedOverride is returned for overrides with negative limits.
+var ErrInvalidSeedOverride = errors.New("invalid seed override")
+
+// SeedPolicy controls uploading. By default a torrent uploads only in
+// exchange for data while it downloads, and not at all once the data its
+// streams and downloads use is complete; when nothing uses it any more it's
+// dropped.
+type SeedPolicy struct {
+	// WhileStreaming uploads to any peer while a torrent is in use. The
+	// client must be created with SeedWhileDownloading to match.
+	WhileStreaming bool
+	// AfterComplete keeps torrents with complete files in the client to
+	// seed once nothing uses them, until a limit below is reached.
+	AfterComplete bool
+	// Ratio stops seeding once uploaded / completed bytes reaches it; 0 is
+	// unlimited.
+	Ratio float64
+	// Minutes stops seeding after that long; 0 is unlimited.
+	Minutes int
+}
+
+// SetSeedPolicy sets the seeding policy, loads the per-torrent overrides and
+// starts enforcing them. Must be called before any session starts.
+func (m *Manager) SetSeedPolicy(policy SeedPolicy) {
+	overrides := make(map[string]models.SeedOverride)
+	if m.db != nil {
+		if _, err := m.db.GetSetting(seedOverridesKey, &overrides); err != nil {
+			log.Warn().Err(err).Msg("failed to load seed overrides")
+		}
+	}
+
+	m.refsMu.Lock()
+	m.seedPolicy = policy
+	m.seedOverrides = overrides
+	m.refsMu.Unlock()
+
+	go m.manageSeeding()
+	log.Info().Bool("while_streaming", policy.WhileStreaming).Bool("after_complete", policy.AfterComplete).
+		Float64("ratio", policy.Ratio).Int("minutes", policy.Minutes).Int("overrides", len(overrides)).
+		Msg("seeding policy set")
+}
+
+// SetSeedOverride replaces the seeding policy for the torrent with the given
+// info hash (or magnet URI), or restores the policy if o is nil. Overrides
+// are saved, and may be set before the torrent is added.
+func (m *Manager) SetSeedOverride(infoHash string, o *models.SeedOverride) error {
+	mg, err := ParseMagnet(infoHash)
+	if err != nil {
+		return err
+	}
+	infoHash = mg.InfoHash.HexString()
+	if o != nil && ((o.Ratio != nil && *o.Ratio < 0) || (o.Minutes != nil && *o.Minutes < 0)) {
+		return fmt.Errorf("%w: ratio and minutes must not be negative", ErrInvalidSeedOverride)
+	}
+
+	m.refsMu.Lock()
+	if o == nil {
+		delete(m.seedOverrides, infoHash)
+	} else {
+		m.seedOverrides[infoHash] = *o
+	}
+	saved := make(map[string]models.SeedOverride, len(m.seedOverrides))
+	for h, ov := range m.seedOverrides {
+		saved[h] = ov
+	}
+	m.refsMu.Unlock()
+
+	if m.db != nil {
+		if err := m.db.SaveSetting(seedOverridesKey, saved); err != nil {
+			return err
+		}
+	}
+	if t, ok := m.client.activeTorrent(infoHash); ok {
+		m.checkSeeding(t, m.usedFilesComplete())
+	}
+	return nil
+}
+
+// keepSeeding takes the reference of a torrent nothing else uses any more
+// if the policy seeds it, reporting whether it did. m.refsMu must be held.
+func (m *Manager) keepSeeding(t *atorrent.Torrent) bool {
+	hash := t.InfoHash().HexString()
+	o, hasOverride := m.seedOverrides[hash]
+	enabled := m.seedPolicy.AfterComplete
+	if hasOverride && o.Enabled != nil {
+		enabled = *o.Enabled
+	}
+	if !enabled || !hasCompleteFile(t) {
+		return false
+	}
+	ratio, _ := m.seedLimits(hash)
+	if ratio > 0 && seedRatio(t) >= ratio {
+		return false
+	}
+
+	m.torrentRefs[hash]++
+	m.seeds[hash] = time.Now()
+	log.Info().Str("info_hash", hash).Str("name", t.Name()).Msg("seeding torrent")
+	return true
+}
+
+// stopSeeding gives back the seeding reference of the torrent, if held,
+// dropping it unless something else uses it.
+func (m *Manager) stopSeeding(infoHash string) {
+	m.refsMu.Lock()
+	defer m.refsMu.Unlock()
+	m.stopSeedingLocked(infoHash)
+}
+
+// stopSeedingLocked is stopSeeding with m.refsMu held.
+func (m *Manager) stopSeedingLocked(infoHash string) {
+	if _, ok := m.seeds[infoHash]; !ok {
+		return
+	}
+	delete(m.seeds, infoHash)
+	if m.unref(infoHash) {
+		if t, ok := m.client.activeTorrent(infoHash); ok {
+			t.Drop()
+		}
+	}
+	log.Info().Str("info_hash", infoHash).Msg("stopped seeding torrent")
+}
+
+// seedLimits returns the ratio and minutes limits of a torrent, 0 meaning
+// unlimited. m.refsMu must be held.
+func (m *Manager) seedLimits(infoHash string) (ratio float64, minutes int) {
+	ratio, minutes = m.seedPolicy.Ratio, m.seedPolicy.Minutes
+	if o, ok := m.seedOverrides[infoHash]; ok {
+		if o.Ratio != nil {
+			ratio = *o.Ratio
+		}
+		if o.Minutes != nil {
+			minutes = *o.Minutes
+		}
+	}
+	return ratio, minutes
+}
+
+// manageSeeding checks every torrent's uploads and seeding limits.
+func (m *Manager) manageSeeding() {
+	ticker := time.NewTicker(seedCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		complete := m.usedFilesComplete()
+		active := make(map[string]bool)
+		for _, t := range m.client.client.Torrents() {
+			active[t.InfoHash().HexString()] = true
+			m.checkSeeding(t, complete)
+		}
+
+		m.refsMu.Lock()
+		for hash := range m.uploadBlocked {
+			if !active[hash] {
+				delete(m.uploadBlocked, hash)
+			}
+		}
+		m.refsMu.Unlock()
+	}
+}
+
+// checkSeeding stops seeding t once a limit is reached, and allows or
+// disallows its uploads. complete is the result of usedFilesComplete.
+func (m *Manager) checkSeeding(t *atorrent.Torrent, complete map[*atorrent.Torrent]bool) {
+	hash := t.InfoHash().HexString()
+
+	m.refsMu.Lock()
+	o := m.seedOverrides[hash]
+	if since, ok := m.seeds[hash]; ok {
+		ratio, minutes := m.seedLimits(hash)
+		if (o.Enabled != nil && !*o.Enabled) ||
+			(ratio > 0 && seedRatio(t) >= ratio) ||
+			(minutes > 0 && time.Since(since) >= time.Duration(minutes)*time.Minute) {
+			m.stopSeedingLocked(hash)
+		}
+	}
+	_, seeding := m.seeds[hash]
+
+	var allow bool
+	switch done, used := complete[t]; {
+	case o.Enabled != nil:
+		allow = *o.Enabled
+	case seeding, m.seedPolicy.WhileStreaming:
+		allow = true
+	default:
+		// Still downloading: the client only uploads in exchange for data.
+		allow = !used || !done
+	}
+	changed := m.uploadBlocked[hash] == allow
+	if allow {
+		delete(m.uploadBlocked, hash)
+	} else {
+		m.uploadBlocked[hash] = true
+	}
+	m.refsMu.Unlock()
+
+	if changed {
+		if allow {
+			t.AllowDataUpload()
+		} else {
+			t.DisallowDataUpload()
+		}
+	}
+}
+
+// usedFilesComplete reports, for each torrent streamed or downloaded,
+// whether all the files in use are complete.
+func (m *Manager) usedFilesComplete() map[*atorrent.Torrent]bool {
+	complete := make(map[*atorrent.Torrent]bool)
+	use := func(t *atorrent.Torrent, f *atorrent.File) {
+		if t == nil || f == nil {
+			return
+		}
+		done, seen := complete[t]
+		complete[t] = (done || !seen) && f.BytesCompleted() == f.Length()
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, sess := range m.sessions {
+		use(sess.torrent, sess.file)
+	}
+	for _, d := range m.downloads {
+		use(d.torrent, d.file)
+	}
+	return complete
+}
+
+// seedStatus describes t's upload state for ClientStats.
+func (m *Manager) seedStatus(t *atorrent.Torrent) models.SeedStatus {
+	hash := t.InfoHash().HexString()
+	st := models.SeedStatus{Uploaded: t.Stats().BytesWrittenData.Int64(), Ratio: seedRatio(t)}
+
+	m.refsMu.Lock()
+	defer m.refsMu.Unlock()
+	st.Uploading = !m.uploadBlocked[hash]
+	if since, ok := m.seeds[hash]; ok {
+		st.Seeding = true
+		st.SeedingSince = &since
+	}
+	st.RatioLimit, st.MinutesLimit = m.seedLimits(hash)
+	if o, ok := m.seedOverrides[hash]; ok {
+		st.Override = &o
+	}
+	return st
+}
+
+// seedRatio is t's uploaded bytes over its completed bytes.
+func seedRatio(t *atorrent.Torrent) float64 {
+	completed := t.BytesCompleted()
+	if completed <= 0 {
+		return 0
+	}
+	return float64(t.Stats().BytesWrittenData.Int64()) / float64(completed)
+}
+
+// hasCompleteFile reports whether any of t's files is fully downloaded.
+func hasCompleteFile(t *atorrent.Torrent) bool {
+	if t.Info() == nil {
+		return false
+	}
+	for _, f := range t.Files() {
+		if f.Length() > 0 && f.BytesCompleted() == f.Length() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package torrent
+
+import (
+	"regexp"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// Chapter titles marking an episode's intro or credits, as named by common
+// release groups ("OP"/"ED" in anime).
+var (
+	introChapterRe   = regexp.MustCompile(`(?i)\b(intro|opening|op)\b|заставка|вступление`)
+	creditsChapterRe = regexp.MustCompile(`(?i)\b(credits|ending|outro|ed)\b|титры`)
+)
+
+// chapterSkipMarkers returns the skip markers named by a file's chapters.
+func chapterSkipMarkers(chapters []models.Chapter) []models.SkipMarker {
+	var markers []models.SkipMarker
+	for _, ch := range chapters {
+		kind := ""
+		switch {
+		case introChapterRe.MatchString(ch.Title):
+			kind = "intro"
+		case creditsChapterRe.MatchString(ch.Title):
+			kind = "credits"
+		default:
+			continue
+		}
+		markers = append(markers, models.SkipMarker{Type: kind, Start: ch.Start, End: ch.End, Source: "chapter"})
+	}
+	return markers
+}
+
+// skipMarkersFor returns the skip markers of an episode session: those stored
+// from an earlier analysis of the file, or else those named by its chapters.
+// known is false when neither applies and the file is worth analysing (see
+// the stream package).
+func (m *Manager) skipMarkersFor(sess *Session, chapters []models.Chapter) (markers []models.SkipMarker, known bool) {
+	if sess.Season == 0 || sess.Episode == 0 {
+		return nil, true
+	}
+	if markers := chapterSkipMarkers(chapters); len(markers) > 0 {
+		return markers, true
+	}
+	if m.db == nil || sess.direct != nil {
+		return nil, true
+	}
+	markers, known, err := m.db.GetSkipMarkers(sess.InfoHash, sess.FileIndex)
+	if err != nil {
+		log.Warn().Err(err).Str("session_id", sess.ID).Msg("load skip markers")
+		return nil, true
+	}
+	return markers, known
+}
+
+// NeedsSkipDetection reports whether an active session is an episode whose
+// intro and credits haven't been found yet. need is only meaningful once the
+// session is probed.
+func (m *Manager) NeedsSkipDetection(sessionID string) (need, probed bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sess := m.sessions[sessionID]
+	if sess == nil {
+		return false, true
+	}
+	return !sess.skipKnown, sess.probed
+}
+
+// SetSkipMarkers records the skip markers detected in a session's file. Final
+// markers are also stored for later sessions playing the same file.
+func (m *Manager) SetSkipMarkers(sessionID string, markers []models.SkipMarker, final bool) {
+	m.mu.Lock()
+	sess := m.sessions[sessionID]
+	if sess == nil {
+		m.mu.Unlock()
+		return
+	}
+	sess.SkipMarkers = markers
+	sess.skipKnown = final
+	rec := sess.StreamSession
+	m.mu.Unlock()
+
+	if !final || m.db == nil {
+		return
+	}
+	if err := m.db.SaveSkipMarkers(rec.InfoHash, rec.FileIndex, rec.TMDbID, rec.Season, rec.Episode, markers); err != nil {
+		log.Warn().Err(err).Str("session_id", sessionID).Msg("save skip markers")
+	}
+}
@@ -0,0 +1,222 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// SourceTorrent is the StreamSession.Source value for torrent-backed sessions.
+const SourceTorrent = "torrent"
+
+const (
+	// sourceResolveTimeout bounds how long a single failover source may take.
+	sourceResolveTimeout = 45 * time.Second
+	// torrentFileTimeout bounds fetching a release's .torrent file before
+	// falling back to its magnet.
+	torrentFileTimeout = 15 * time.Second
+)
+
+// DirectSource resolves a title to a directly streamable HTTP resource. Direct
+// sources are tried in registration order when a torrent can't be started.
+type DirectSource interface {
+	Name() string
+	Resolve(ctx context.Context, req models.SourceRequest) (*models.DirectStream, error)
+}
+
+// RegisterSource appends a failover source to the chain.
+func (m *Manager) RegisterSource(s DirectSource) {
+	m.sources = append(m.sources, s)
+}
+
+// Play starts a session from the first source that works: the requested
+// torrent, then each registered direct source. Errors from sources that were
+// skipped are recorded in the session's SourceErrors. Without a fileIndex,
+// an episode's file is looked up in season packs by name. With a stream
+// limit set, a *admission.BusyError is returned while the limit is reached.
+func (m *Manager) Play(req models.SourceRequest, fileIndex int) (*models.StreamSession, error) {
+	id := uuid.New().String()
+	release, err := m.streams.Acquire(req.Client, id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return m.play(id, req, fileIndex)
+}
+
+// play starts session id for Play and PlayAsync, which hold its stream slot.
+func (m *Manager) play(id string, req models.SourceRequest, fileIndex int) (*models.StreamSession, error) {
+	if req.TopicID != "" {
+		req.MagnetURI = m.fetchTorrentFile(req)
+	}
+	if fileIndex < 0 && req.Season > 0 && req.Episode > 0 {
+		fileIndex = m.episodeFileIndex(req.MagnetURI, req.Season, req.Episode)
+	}
+
+	sess, err := m.startTorrentSession(id, req.TMDbID, req.Title, req.MagnetURI, fileIndex, "")
+	if err == nil {
+		sess.Season, sess.Episode = req.Season, req.Episode
+		sess.provider, sess.quality = req.Provider, req.Quality
+		sess.year = req.Year
+		if req.Capabilities != nil {
+			m.SetCapabilities(sess.ID, *req.Capabilities)
+		}
+		m.setAudioLanguage(sess, req.AudioLanguage)
+		if sess.quality == "" {
+			sess.quality = extractQuality(sess.torrent.Name())
+		}
+		m.persist(sess)
+		return &sess.StreamSession, nil
+	}
+	if len(m.sources) == 0 {
+		return nil, err
+	}
+
+	log.Warn().Err(err).Str("title", req.Title).Msg("torrent failed, trying failover sources")
+	errs := []string{SourceTorrent + ": " + err.Error()}
+
+	if req.InfoHash == "" {
+		if mg, perr := ParseMagnet(req.MagnetURI); perr == nil {
+			req.InfoHash = mg.InfoHash.HexString()
+		}
+	}
+
+	for _, src := range m.sources {
+		ctx, cancel := context.WithTimeout(context.Background(), sourceResolveTimeout)
+		ds, rerr := src.Resolve(ctx, req)
+		cancel()
+		if rerr != nil {
+			log.Warn().Err(rerr).Str("source", src.Name()).Msg("failover source failed")
+			errs = append(errs, src.Name()+": "+rerr.Error())
+			continue
+		}
+		sess := m.startDirect(id, req, src.Name(), ds, errs)
+		m.persist(sess)
+		return &sess.StreamSession, nil
+	}
+
+	return nil, fmt.Errorf("all sources failed: %s", strings.Join(errs, "; "))
+}
+
+// fetchTorrentFile downloads the release's .torrent file from its provider,
+// if supported, so the session starts with full metadata instead of waiting
+// for peers to send it. It returns the magnet to start the session from: the
+// requested one, or the file's own if the info hashes differ. Any failure
+// falls back to the requested magnet.
+func (m *Manager) fetchTorrentFile(req models.SourceRequest) string {
+	if m.providers == nil {
+		return req.MagnetURI
+	}
+	fetcher, ok := m.providers.Get(req.Provider).(TorrentFileFetcher)
+	if !ok {
+		return req.MagnetURI
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), torrentFileTimeout)
+	defer cancel()
+	data, err := fetcher.FetchTorrentFile(ctx, req.TopicID)
+	if err == nil {
+		var magnet metainfo.Magnet
+		if _, magnet, err = m.storeTorrentFile(bytes.NewReader(data)); err == nil {
+			log.Debug().
+				Str("provider", req.Provider).
+				Str("topic_id", req.TopicID).
+				Str("info_hash", magnet.InfoHash.HexString()).
+				Msg("using provider torrent file")
+			if mg, perr := ParseMagnet(req.MagnetURI); perr != nil || mg.InfoHash != magnet.InfoHash {
+				return magnet.String()
+			}
+			return req.MagnetURI
+		}
+	}
+
+	log.Warn().Err(err).
+		Str("provider", req.Provider).
+		Str("topic_id", req.TopicID).
+		Msg("torrent file unavailable, using magnet")
+	return req.MagnetURI
+}
+
+// PlayDirect starts a session from an already resolved direct stream,
+// without trying a torrent first. The stream limit applies as for Play.
+func (m *Manager) PlayDirect(req models.SourceRequest, source string, ds *models.DirectStream) (*models.StreamSession, error) {
+	id := uuid.New().String()
+	release, err := m.streams.Acquire(req.Client, id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sess := m.startDirect(id, req, source, ds, nil)
+	m.persist(sess)
+	return &sess.StreamSession, nil
+}
+
+// startDirect registers a session backed by a direct HTTP stream.
+func (m *Manager) startDirect(id string, req models.SourceRequest, source string, ds *models.DirectStream, errs []string) *Session {
+	name := ds.FileName
+	if name == "" {
+		if u, err := url.Parse(ds.URL); err == nil {
+			name = path.Base(u.Path)
+		}
+	}
+
+	contentType := ds.ContentType
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = detectContentType(name)
+	}
+	sess := &Session{
+		StreamSession: models.StreamSession{
+			ID:           id,
+			TMDbID:       req.TMDbID,
+			Title:        req.Title,
+			Season:       req.Season,
+			Episode:      req.Episode,
+			MagnetURI:    req.MagnetURI,
+			InfoHash:     req.InfoHash,
+			FilePath:     name,
+			FileIndex:    -1,
+			FileSize:     ds.Size,
+			ContentType:  contentType,
+			Container:    containerOf(name),
+			Status:       StatusReady,
+			AudioTrack:   -1,
+			Source:       source,
+			SourceErrors: errs,
+		},
+		direct:        ds,
+		probeDone:     make(chan struct{}),
+		audioLanguage: req.AudioLanguage,
+	}
+	if req.Capabilities != nil {
+		caps := NormalizeCapabilities(*req.Capabilities)
+		sess.caps = &caps
+	}
+	m.applyPlayMethod(sess)
+	sess.touch()
+	sess.release = m.streams.Take(sess.ID)
+
+	m.mu.Lock()
+	m.sessions[sess.ID] = sess
+	m.mu.Unlock()
+
+	go m.probeMedia(sess)
+
+	log.Info().
+		Str("session_id", sess.ID).
+		Str("source", source).
+		Str("file", name).
+		Str("play_method", sess.PlayMethod).
+		Msg("direct stream session created")
+
+	return sess
+}
@@ -0,0 +1,247 @@
+package torrent
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/models"
+)
+
+// Statuses of started sessions.
+const (
+	StatusBuffering = "buffering" // downloading the start buffer (see SetStartBuffer)
+	StatusReady     = "ready"
+)
+
+const (
+	// startBufferPoll is how often a buffering session checks its data.
+	startBufferPoll = time.Second
+	// startBufferRate is the bitrate, in bytes/s, assumed for files whose
+	// duration FFprobe couldn't read.
+	startBufferRate = 1024 * 1024
+	// mp4MaxBoxes bounds the top-level MP4 boxes walked to find the index.
+	mp4MaxBoxes = 64
+)
+
+var (
+	// errNoIndex is returned by locateMoov for MP4 files whose top-level
+	// boxes don't parse or hold no index.
+	errNoIndex = errors.New("no moov box")
+	// errNotDownloaded is returned by locateMoov while the box header it
+	// needs next isn't downloaded.
+	errNotDownloaded = errors.New("box header not downloaded")
+)
+
+// startBuffer is the data a buffering session waits for, guarded by
+// Manager.mu.
+type startBuffer struct {
+	need     int64 // bytes from the start of the file
+	moovOff  int64 // the MP4 index, once located
+	moovSize int64
+	moovWait bool // an MP4 file whose index isn't located yet
+}
+
+// SetStartBuffer sets the seconds of playback downloaded from the start of
+// a torrent file before its session turns from StatusBuffering to
+// StatusReady; MP4 files also need their index, which players read first.
+// 0 makes sessions ready at once. Must be called before starting sessions.
+func (m *Manager) SetStartBuffer(seconds int) {
+	m.startBufferSec = max(seconds, 0)
+}
+
+// initialStatus is the status a torrent session starts in.
+func (m *Manager) initialStatus() string {
+	if m.startBufferSec > 0 {
+		return StatusBuffering
+	}
+	return StatusReady
+}
+
+// waitStartBuffer turns a buffering session ready once its start buffer is
+// downloaded, and gives up when the session stops.
+func (m *Manager) waitStartBuffer(sess *Session) {
+	start := time.Now()
+	for {
+		m.mu.RLock()
+		stopped := m.sessions[sess.ID] != sess
+		m.mu.RUnlock()
+		if stopped {
+			return
+		}
+		if m.startBuffered(sess) {
+			break
+		}
+		time.Sleep(startBufferPoll)
+	}
+
+	m.mu.Lock()
+	sess.Status = StatusReady
+	m.mu.Unlock()
+	log.Info().Str("session_id", sess.ID).Dur("waited", time.Since(start)).Msg("start buffer downloaded")
+}
+
+// startBuffered updates the data the session waits for and reports whether
+// it's downloaded. The file must have been probed, so the amount follows
+// its bitrate.
+func (m *Manager) startBuffered(sess *Session) bool {
+	probed := false
+	select {
+	case <-sess.probeDone:
+		probed = true
+	default:
+	}
+
+	m.mu.RLock()
+	need := m.startBufferBytes(sess)
+	sb := sess.start
+	m.mu.RUnlock()
+
+	sb.need = need
+	if sess.Container == "mp4" && sb.moovSize == 0 {
+		sb.moovWait = true
+		off, size, err := locateMoov(sess)
+		switch {
+		case err == nil:
+			sb.moovOff, sb.moovSize, sb.moovWait = off, size, false
+			wantPieces(sess, off, size)
+		case errors.Is(err, errNoIndex):
+			// Not one the player can read from the start either; don't wait.
+			log.Debug().Err(err).Str("session_id", sess.ID).Msg("mp4 index not found")
+			sb.moovWait = false
+		}
+	}
+
+	m.mu.Lock()
+	sess.start = sb
+	m.mu.Unlock()
+
+	return probed && !sb.moovWait && sess.RangeComplete(0, need) &&
+		(sb.moovSize == 0 || sess.RangeComplete(sb.moovOff, sb.moovSize))
+}
+
+// startBufferBytes is how much of the start of the session's file is
+// downloaded before it's ready. m.mu must be held.
+func (m *Manager) startBufferBytes(sess *Session) int64 {
+	rate := float64(startBufferRate)
+	if sess.Duration > 0 {
+		rate = float64(sess.FileSize) / sess.Duration
+	}
+	return min(int64(float64(m.startBufferSec)*rate), sess.FileSize)
+}
+
+// locateMoov walks the top-level boxes of the session's MP4 file for its
+// index, reading only downloaded data. Files written without faststart keep
+// it after the media data, so the piece holding the next box header is
+// fetched first while it's missing, and errNotDownloaded returned.
+func locateMoov(sess *Session) (int64, int64, error) {
+	r := sess.NewBackgroundReader()
+	defer r.Close()
+
+	size := sess.file.Length()
+	var off int64
+	for range mp4MaxBoxes {
+		if off+8 > size {
+			return 0, 0, errNoIndex
+		}
+		n := min(int64(16), size-off)
+		if !sess.RangeComplete(off, n) {
+			wantPieces(sess, off, n)
+			return 0, 0, errNotDownloaded
+		}
+		var hdr [16]byte
+		if _, err := r.Seek(off, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(r, hdr[:n]); err != nil {
+			return 0, 0, err
+		}
+
+		boxSize := int64(binary.BigEndian.Uint32(hdr[:4]))
+		switch boxSize {
+		case 0: // up to the end of the file
+			boxSize = size - off
+		case 1: // 64-bit size after the type
+			if n < 16 {
+				return 0, 0, errNoIndex
+			}
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+		}
+		if boxSize < 8 || boxSize > size-off {
+			return 0, 0, errNoIndex
+		}
+		if string(hdr[4:8]) == "moov" {
+			return off, boxSize, nil
+		}
+		off += boxSize
+	}
+	return 0, 0, errNoIndex
+}
+
+// wantPieces fetches the pieces holding bytes [off, off+n) of the session's
+// file ahead of sequential download.
+func wantPieces(sess *Session, off, n int64) {
+	pieceLen := sess.torrent.Info().PieceLength
+	if pieceLen <= 0 || n <= 0 {
+		return
+	}
+	first := int((sess.file.Offset() + off) / pieceLen)
+	last := int((sess.file.Offset() + off + n - 1) / pieceLen)
+	for i := first; i <= last && i < sess.file.EndPieceIndex(); i++ {
+		if !sess.torrent.Piece(i).State().Complete {
+			sess.torrent.Piece(i).SetPriority(atorrent.PiecePriorityHigh)
+		}
+	}
+}
+
+// startBufferStatus describes what a buffering session waits for, with the
+// time to play estimated at speed (bytes/s). m.mu must be held.
+func (m *Manager) startBufferStatus(sess *Session, speed int64) *models.StartBufferStatus {
+	if sess.Status != StatusBuffering {
+		return nil
+	}
+	sb := sess.start
+	st := &models.StartBufferStatus{
+		Seconds:      float64(m.startBufferSec),
+		NeededBytes:  sb.need,
+		MissingBytes: sess.missingBytes(0, sb.need),
+		WaitingIndex: sb.moovWait,
+	}
+	if sb.moovSize > 0 {
+		st.WaitingIndex = sess.missingBytes(sb.moovOff, sb.moovSize) > 0
+		// Count the part of the index past the start, e.g. all of it at
+		// the end of the file.
+		end := sb.moovOff + sb.moovSize
+		if from := max(sb.moovOff, sb.need); from < end {
+			st.NeededBytes += end - from
+			st.MissingBytes += sess.missingBytes(from, end-from)
+		}
+	}
+	if speed > 0 {
+		st.TimeToPlay = float64(st.MissingBytes) / float64(speed)
+	}
+	return st
+}
+
+// missingBytes counts the bytes of [off, off+n) of the session's file in
+// pieces not downloaded yet.
+func (s *Session) missingBytes(off, n int64) int64 {
+	pieceLen := s.torrent.Info().PieceLength
+	end := min(off+n, s.file.Length())
+	if pieceLen <= 0 || off >= end {
+		return 0
+	}
+	var missing int64
+	for b := off; b < end; {
+		i := (s.file.Offset() + b) / pieceLen
+		next := min((i+1)*pieceLen-s.file.Offset(), end)
+		if !s.torrent.Piece(int(i)).State().Complete {
+			missing += next - b
+		}
+		b = next
+	}
+	return missing
+}
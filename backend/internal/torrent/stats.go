@@ -0,0 +1,138 @@
+package torrent
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	atorrent "github.com/anacrolix/torrent"
+	"github.com/streambox/backend/internal/models"
+)
+
+// rateSample holds the transfer totals at the previous Rates call.
+type rateSample struct {
+	mu       sync.Mutex
+	at       time.Time
+	down, up int64
+	downRate int64
+	upRate   int64
+}
+
+// Rates returns the client's download and upload rates in bytes per second
+// since the previous call, or the last rates if that was under a second ago.
+func (tc *TorrentClient) Rates() (down, up int64) {
+	d, u := tc.DataTransferred()
+	r := &tc.rates
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(r.at).Seconds()
+	if !r.at.IsZero() {
+		if elapsed < 1 {
+			return r.downRate, r.upRate
+		}
+		r.downRate = int64(float64(d-r.down) / elapsed)
+		r.upRate = int64(float64(u-r.up) / elapsed)
+	}
+	r.at, r.down, r.up = now, d, u
+	return r.downRate, r.upRate
+}
+
+// dhtNodes returns the number of nodes, and of good ones, in the routing
+// tables of the client's DHT servers.
+func (tc *TorrentClient) dhtNodes() (nodes, good int) {
+	for _, s := range tc.client.DhtServers() {
+		if st, ok := s.Stats().(dht.ServerStats); ok {
+			nodes += st.Nodes
+			good += st.GoodNodes
+		}
+	}
+	return nodes, good
+}
+
+// ClientStats reports the torrent client's DHT, peers and transfer rates
+// and the state of every active torrent, with the sessions streaming it.
+// pieces includes each torrent's piece completion map; verbose adds the
+// client's own status report.
+func (m *Manager) ClientStats(pieces, verbose bool) *models.ClientStats {
+	tc := m.client
+	stats := &models.ClientStats{Torrents: []models.TorrentStats{}}
+	stats.DHTNodes, stats.DHTGoodNodes = tc.dhtNodes()
+	stats.DownloadRate, stats.UploadRate = tc.Rates()
+	stats.Downloaded, stats.Uploaded = tc.DataTransferred()
+
+	sessions := make(map[string][]string)
+	m.mu.RLock()
+	for id, sess := range m.sessions {
+		if sess.torrent != nil {
+			sessions[sess.InfoHash] = append(sessions[sess.InfoHash], id)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, t := range tc.client.Torrents() {
+		ts := torrentStats(t, pieces)
+		ts.Sessions = sessions[ts.InfoHash]
+		ts.Seed = m.seedStatus(t)
+		slices.Sort(ts.Sessions)
+		m.refsMu.Lock()
+		ts.References = m.torrentRefs[ts.InfoHash]
+		m.refsMu.Unlock()
+
+		stats.PeersConnected += ts.PeersConnected
+		stats.PeersKnown += ts.PeersKnown
+		stats.Torrents = append(stats.Torrents, ts)
+	}
+	slices.SortFunc(stats.Torrents, func(a, b models.TorrentStats) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	if verbose {
+		var sb strings.Builder
+		tc.client.WriteStatus(&sb)
+		stats.ClientStatus = sb.String()
+	}
+	return stats
+}
+
+// torrentStats describes one torrent; see ClientStats.
+func torrentStats(t *atorrent.Torrent, pieces bool) models.TorrentStats {
+	st := t.Stats()
+	ts := models.TorrentStats{
+		InfoHash:         t.InfoHash().HexString(),
+		Name:             t.Name(),
+		PeersConnected:   st.ActivePeers,
+		PeersKnown:       st.TotalPeers,
+		ConnectedSeeders: st.ConnectedSeeders,
+		PiecesComplete:   st.PiecesComplete,
+		Trackers:         []string{},
+	}
+	ts.PeerSources, _ = peerBreakdown(t, st)
+	mi := t.Metainfo()
+	for _, tier := range mi.UpvertedAnnounceList() {
+		ts.Trackers = append(ts.Trackers, tier...)
+	}
+	if t.Info() == nil {
+		return ts
+	}
+
+	ts.MetadataFetched = true
+	ts.BytesCompleted = t.BytesCompleted()
+	ts.Length = t.Length()
+	ts.PieceCount = t.NumPieces()
+	if pieces {
+		var sb strings.Builder
+		sb.Grow(ts.PieceCount)
+		for _, run := range t.PieceStateRuns() {
+			c := "0"
+			if run.Complete {
+				c = "1"
+			}
+			sb.WriteString(strings.Repeat(c, run.Length))
+		}
+		ts.Pieces = sb.String()
+	}
+	return ts
+}
@@ -0,0 +1,180 @@
+package torrent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/httpclient"
+)
+
+// maxTrackerList bounds the size of a fetched tracker list.
+const maxTrackerList = 1 << 20
+
+// TrackerList holds the trackers added to every public torrent to find more
+// peers: a configured list plus, optionally, a public list (e.g.
+// ngosang/trackerslist) fetched from a URL and refreshed periodically.
+// Private torrents keep only their own trackers.
+type TrackerList struct {
+	static []string
+	url    string
+	http   *httpclient.Client
+
+	mu      sync.RWMutex
+	fetched []string
+}
+
+// NewTrackerList creates a list of the static trackers and, if listURL is
+// not empty, the ones fetched from it (see Start).
+func NewTrackerList(static []string, listURL string, opts httpclient.Options) *TrackerList {
+	return &TrackerList{static: static, url: listURL, http: httpclient.New(opts)}
+}
+
+// Trackers returns the static and fetched trackers, without duplicates.
+func (l *TrackerList) Trackers() []string {
+	if l == nil {
+		return nil
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := slices.Clone(l.static)
+	for _, tr := range l.fetched {
+		if !slices.Contains(out, tr) {
+			out = append(out, tr)
+		}
+	}
+	return out
+}
+
+// Start fetches the public list now and then every interval until ctx is
+// done, adding new trackers to the torrents already in client. It does
+// nothing without a list URL.
+func (l *TrackerList) Start(ctx context.Context, client *TorrentClient, interval time.Duration) {
+	if l.url == "" || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := l.Refresh(ctx); err != nil {
+				log.Warn().Err(err).Str("url", l.url).Msg("tracker list refresh failed")
+			} else {
+				client.addTrackersToAll()
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Refresh fetches the public list: announce URLs one per line, blank lines
+// and # comments ignored. The previous list is kept on failure.
+func (l *TrackerList) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url, nil)
+	if err != nil {
+		return fmt.Errorf("build tracker list request: %w", err)
+	}
+	resp, err := l.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch tracker list: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch tracker list: status %d", resp.StatusCode)
+	}
+
+	var trackers []string
+	sc := bufio.NewScanner(io.LimitReader(resp.Body, maxTrackerList))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if validTracker(line) && !slices.Contains(trackers, line) {
+			trackers = append(trackers, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read tracker list: %w", err)
+	}
+	if len(trackers) == 0 {
+		return fmt.Errorf("tracker list has no trackers")
+	}
+
+	l.mu.Lock()
+	l.fetched = trackers
+	l.mu.Unlock()
+	log.Info().Int("trackers", len(trackers)).Str("url", l.url).Msg("tracker list refreshed")
+	return nil
+}
+
+// validTracker reports whether s is an announce URL the client can use.
+func validTracker(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "udp", "http", "https", "ws", "wss":
+		return true
+	}
+	return false
+}
+
+// SetTrackerList makes the client add l's trackers to every public torrent.
+// Must be called before any torrent is added.
+func (tc *TorrentClient) SetTrackerList(l *TrackerList) {
+	tc.trackers = l
+}
+
+// addExtraTrackers adds the tracker list to t, which is known to be public
+// or whose metadata isn't known yet. Should the metadata show t is private,
+// its own trackers (own) are restored, as private torrents must announce to
+// those only.
+func (tc *TorrentClient) addExtraTrackers(t *torrent.Torrent, own [][]string) {
+	extra := tc.trackers.Trackers()
+	if len(extra) == 0 {
+		return
+	}
+	if info := t.Info(); info != nil {
+		if info.Private == nil || !*info.Private {
+			t.AddTrackers([][]string{extra})
+		}
+		return
+	}
+	t.AddTrackers([][]string{extra})
+	go func() {
+		select {
+		case <-t.GotInfo():
+			if p := t.Info().Private; p != nil && *p {
+				t.ModifyTrackers(own)
+			}
+		case <-t.Closed():
+		}
+	}()
+}
+
+// addTrackersToAll adds the tracker list to the client's public torrents,
+// after it was refreshed.
+func (tc *TorrentClient) addTrackersToAll() {
+	extra := tc.trackers.Trackers()
+	for _, t := range tc.client.Torrents() {
+		if info := t.Info(); info != nil && info.Private != nil && *info.Private {
+			continue
+		}
+		t.AddTrackers([][]string{extra})
+	}
+}
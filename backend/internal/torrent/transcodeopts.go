@@ -0,0 +1,48 @@
+package torrent
+
+import (
+	"fmt"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+// SetTranscodeDefaults sets the limits on transcoded output for sessions
+// that don't set their own. Must be called before starting sessions.
+func (m *Manager) SetTranscodeDefaults(opts models.TranscodeOptions) {
+	m.transcodeDefaults = opts
+}
+
+// SetTranscodeOptions sets the limits on a session's transcoded output,
+// which override the defaults where set, and decides its play method again,
+// returning the updated session.
+func (m *Manager) SetTranscodeOptions(sessionID string, opts models.TranscodeOptions) (*models.StreamSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess := m.sessions[sessionID]
+	if sess == nil {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	sess.TranscodeOptions = opts
+	m.applyPlayMethod(sess)
+	snapshot := sess.StreamSession
+	return &snapshot, nil
+}
+
+// Transcode returns the limits the session's output is transcoded with.
+func (s *Session) Transcode() models.TranscodeOptions {
+	return s.transcode
+}
+
+// withDefaults fills in the limits opts leaves unset from defaults.
+func withDefaults(opts, defaults models.TranscodeOptions) models.TranscodeOptions {
+	if opts.MaxHeight == 0 {
+		opts.MaxHeight = defaults.MaxHeight
+	}
+	if opts.MaxBitrate == 0 {
+		opts.MaxBitrate = defaults.MaxBitrate
+	}
+	if opts.AudioChannels == 0 {
+		opts.AudioChannels = defaults.AudioChannels
+	}
+	return opts
+}
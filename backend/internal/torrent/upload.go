@@ -0,0 +1,69 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/streambox/backend/internal/models"
+)
+
+// ErrInvalidTorrentFile is returned for uploads that aren't valid .torrent files.
+var ErrInvalidTorrentFile = errors.New("invalid torrent file")
+
+// AddTorrentFile stores an uploaded .torrent file's metadata and returns the
+// torrent's magnet URI and file list. Streams and downloads started from
+// that magnet (or the bare info hash) use the stored metadata, so they
+// don't wait for peers to send it.
+func (m *Manager) AddTorrentFile(r io.Reader) (*models.MagnetInspection, error) {
+	info, magnet, err := m.storeTorrentFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.MagnetInspection{
+		InfoHash:        magnet.InfoHash.HexString(),
+		MagnetURI:       magnet.String(),
+		DisplayName:     magnet.DisplayName,
+		Trackers:        magnet.Trackers,
+		MetadataFetched: true,
+		Name:            info.BestName(),
+	}
+	if result.Trackers == nil {
+		result.Trackers = []string{}
+	}
+	for i, f := range info.UpvertedFiles() {
+		result.Files = append(result.Files, models.TorrentFile{
+			Index:     i,
+			Path:      f.DisplayPath(info),
+			Size:      f.Length,
+			SizeHuman: formatFileSize(f.Length),
+		})
+		result.TotalSize += f.Length
+	}
+	result.TotalSizeHuman = formatFileSize(result.TotalSize)
+	return result, nil
+}
+
+// storeTorrentFile parses a .torrent file and saves its metadata where the
+// torrent client picks it up when the torrent is added.
+func (m *Manager) storeTorrentFile(r io.Reader) (*metainfo.Info, metainfo.Magnet, error) {
+	mi, err := metainfo.Load(r)
+	if err != nil {
+		return nil, metainfo.Magnet{}, fmt.Errorf("%w: %v", ErrInvalidTorrentFile, err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, metainfo.Magnet{}, fmt.Errorf("%w: %v", ErrInvalidTorrentFile, err)
+	}
+	if !info.HasV1() {
+		return nil, metainfo.Magnet{}, fmt.Errorf("%w: v2-only torrents are not supported", ErrInvalidTorrentFile)
+	}
+
+	magnet := mi.Magnet(nil, &info)
+	if err := m.client.writeMetainfo(mi, magnet.InfoHash.HexString()); err != nil {
+		return nil, metainfo.Magnet{}, err
+	}
+	return &info, magnet, nil
+}
@@ -0,0 +1,117 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// viewerTTL is how long a client counts as watching after its last request
+// for a session's media ended, bridging the gaps between HLS segment and
+// Range requests.
+const viewerTTL = 30 * time.Second
+
+// ErrOtherViewer is returned by Watch when a single-player session is being
+// watched by another client.
+var ErrOtherViewer = errors.New("session is playing on another device")
+
+// viewer is a distinct client of a session, told apart by IP and user agent.
+type viewer struct {
+	lastSeen time.Time
+	// cancels end the client's requests in flight, by request.
+	cancels map[int]context.CancelFunc
+}
+
+func (v *viewer) active(now time.Time) bool {
+	return len(v.cancels) > 0 || now.Sub(v.lastSeen) < viewerTTL
+}
+
+// Watch records a request for the session's media by a client, returning a
+// context for the request, cancelled when another client takes the session
+// over, and a func to call when the request ends. Single-player sessions
+// fail with ErrOtherViewer while another client is watching, unless
+// takeover, which ends the other clients' requests.
+func (s *Session) Watch(ctx context.Context, ip, userAgent string, takeover bool) (context.Context, func(), error) {
+	key := ip + "\x00" + userAgent
+	now := time.Now()
+
+	s.viewersMu.Lock()
+	defer s.viewersMu.Unlock()
+	if s.viewers == nil {
+		s.viewers = make(map[string]*viewer)
+	}
+	for k, v := range s.viewers {
+		if !v.active(now) {
+			delete(s.viewers, k)
+		}
+	}
+	if s.singlePlayer {
+		for k, v := range s.viewers {
+			if k == key {
+				continue
+			}
+			if !takeover {
+				return nil, nil, ErrOtherViewer
+			}
+			for _, cancel := range v.cancels {
+				cancel()
+			}
+			delete(s.viewers, k)
+		}
+	}
+
+	v := s.viewers[key]
+	if v == nil {
+		v = &viewer{cancels: make(map[int]context.CancelFunc)}
+		s.viewers[key] = v
+	}
+	v.lastSeen = now
+	ctx, cancel := context.WithCancel(ctx)
+	s.viewerReqs++
+	id := s.viewerReqs
+	v.cancels[id] = cancel
+
+	done := func() {
+		cancel()
+		s.viewersMu.Lock()
+		delete(v.cancels, id)
+		v.lastSeen = time.Now()
+		s.viewersMu.Unlock()
+	}
+	return ctx, done, nil
+}
+
+// Viewers returns how many distinct clients are watching the session.
+func (s *Session) Viewers() int {
+	now := time.Now()
+	s.viewersMu.Lock()
+	defer s.viewersMu.Unlock()
+	n := 0
+	for _, v := range s.viewers {
+		if v.active(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// SetSinglePlayer restricts a session to one client at a time, or lifts the
+// restriction. It reports whether the session exists.
+func (m *Manager) SetSinglePlayer(sessionID string, on bool) bool {
+	m.mu.RLock()
+	sess := m.sessions[sessionID]
+	m.mu.RUnlock()
+	if sess == nil {
+		return false
+	}
+	sess.viewersMu.Lock()
+	sess.singlePlayer = on
+	sess.viewersMu.Unlock()
+	return true
+}
+
+func (s *Session) isSinglePlayer() bool {
+	s.viewersMu.Lock()
+	defer s.viewersMu.Unlock()
+	return s.singlePlayer
+}
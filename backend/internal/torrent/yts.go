@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/streambox/backend/internal/httpclient"
 	"github.com/streambox/backend/internal/models"
 )
 
@@ -32,18 +34,21 @@ var ytsTrackers = []string{
 
 // YTS is a torrent provider that uses the YTS.mx API.
 type YTS struct {
-	client *http.Client
+	client *httpclient.Client
 }
 
-func NewYTS() *YTS {
+func NewYTS(opts httpclient.Options) *YTS {
+	if opts.Timeout == 0 {
+		opts.Timeout = 15 * time.Second
+	}
 	return &YTS{
-		client: &http.Client{Timeout: 15 * time.Second},
+		client: httpclient.New(opts),
 	}
 }
 
 func (y *YTS) Name() string { return "yts" }
 
-func (y *YTS) Search(title, imdbID string, year string) ([]models.TorrentResult, error) {
+func (y *YTS) Search(ctx context.Context, title, imdbID string, year string) ([]models.TorrentResult, error) {
 	params := url.Values{}
 	if imdbID != "" {
 		params.Set("query_term", imdbID)
@@ -55,8 +60,8 @@ func (y *YTS) Search(title, imdbID string, year string) ([]models.TorrentResult,
 	var err error
 	for _, mirror := range ytsMirrors {
 		reqURL := fmt.Sprintf("%s/list_movies.json?%s", mirror, params.Encode())
-		resp, err = y.client.Get(reqURL)
-		if err == nil {
+		resp, err = y.client.Get(ctx, reqURL)
+		if err == nil || ctx.Err() != nil {
 			break
 		}
 	}
@@ -0,0 +1,249 @@
+package trakt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/streambox/backend/internal/db"
+	"github.com/streambox/backend/internal/httpclient"
+	"github.com/streambox/backend/internal/models"
+)
+
+const defaultBaseURL = "https://api.trakt.tv"
+
+// tokenRefreshMargin is how long before expiry an access token is refreshed.
+const tokenRefreshMargin = 24 * time.Hour
+
+// ErrNotConnected is returned when a profile has no linked Trakt account.
+var ErrNotConnected = errors.New("trakt account not connected")
+
+// Client talks to the Trakt API on behalf of StreamBox profiles. OAuth tokens
+// are obtained with the device-code flow and stored per profile.
+type Client struct {
+	clientID     string
+	clientSecret string
+	http         *httpclient.Client
+	baseURL      string
+	db           db.Store
+
+	mu        sync.Mutex
+	pending   map[int]bool // profiles with a device authorization in progress
+	scrobbles map[scrobbleKey]scrobbleState
+}
+
+// NewClient creates a Trakt client for the given API application credentials.
+func NewClient(clientID, clientSecret string, database db.Store, opts httpclient.Options) *Client {
+	if opts.Timeout == 0 {
+		opts.Timeout = 15 * time.Second
+	}
+	return &Client{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		http:         httpclient.New(opts),
+		baseURL:      defaultBaseURL,
+		db:           database,
+		pending:      make(map[int]bool),
+		scrobbles:    make(map[scrobbleKey]scrobbleState),
+	}
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+func (t *tokenResponse) token() *models.TraktToken {
+	return &models.TraktToken{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		ExpiresAt:    time.Unix(t.CreatedAt+t.ExpiresIn, 0),
+	}
+}
+
+// StartDeviceAuth begins linking a Trakt account to a profile. The returned
+// code is shown to the user; the token is polled for in the background and
+// stored once they approve.
+func (c *Client) StartDeviceAuth(ctx context.Context, profileID int) (*models.TraktDeviceCode, error) {
+	var code struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURL string `json:"verification_url"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+	}
+	if _, err := c.do(ctx, http.MethodPost, "/oauth/device/code", "", map[string]string{"client_id": c.clientID}, &code); err != nil {
+		return nil, fmt.Errorf("request device code: %w", err)
+	}
+
+	c.mu.Lock()
+	c.pending[profileID] = true
+	c.mu.Unlock()
+
+	go c.pollDeviceToken(profileID, code.DeviceCode, time.Duration(code.Interval)*time.Second, time.Duration(code.ExpiresIn)*time.Second)
+
+	return &models.TraktDeviceCode{
+		UserCode:        code.UserCode,
+		VerificationURL: code.VerificationURL,
+		ExpiresIn:       code.ExpiresIn,
+	}, nil
+}
+
+// pollDeviceToken polls until the user approves or denies the device code,
+// or it expires.
+func (c *Client) pollDeviceToken(profileID int, deviceCode string, interval, expiresIn time.Duration) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, profileID)
+		c.mu.Unlock()
+	}()
+
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(expiresIn)
+	body := map[string]string{
+		"code":          deviceCode,
+		"client_id":     c.clientID,
+		"client_secret": c.clientSecret,
+	}
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		var tok tokenResponse
+		status, err := c.do(context.Background(), http.MethodPost, "/oauth/device/token", "", body, &tok)
+		switch {
+		case err == nil:
+			if err := c.db.SaveTraktToken(profileID, tok.token()); err != nil {
+				log.Error().Err(err).Int("profile_id", profileID).Msg("failed to save trakt token")
+				return
+			}
+			log.Info().Int("profile_id", profileID).Msg("trakt account connected")
+			return
+		case status == http.StatusBadRequest:
+			// Authorization pending — keep polling.
+		case status == http.StatusTooManyRequests:
+			interval += time.Second
+		default:
+			// 404 invalid, 409 already used, 410 expired, 418 denied
+			log.Warn().Err(err).Int("profile_id", profileID).Msg("trakt device authorization failed")
+			return
+		}
+	}
+	log.Warn().Int("profile_id", profileID).Msg("trakt device code expired")
+}
+
+// Status reports whether a profile has a linked Trakt account.
+func (c *Client) Status(profileID int) (*models.TraktStatus, error) {
+	tok, err := c.db.GetTraktToken(profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	pending := c.pending[profileID]
+	c.mu.Unlock()
+
+	return &models.TraktStatus{Connected: tok != nil, Pending: pending}, nil
+}
+
+// Disconnect revokes a profile's token and forgets it.
+func (c *Client) Disconnect(ctx context.Context, profileID int) error {
+	tok, err := c.db.GetTraktToken(profileID)
+	if err != nil || tok == nil {
+		return err
+	}
+
+	body := map[string]string{
+		"token":         tok.AccessToken,
+		"client_id":     c.clientID,
+		"client_secret": c.clientSecret,
+	}
+	if _, err := c.do(ctx, http.MethodPost, "/oauth/revoke", "", body, nil); err != nil {
+		log.Warn().Err(err).Int("profile_id", profileID).Msg("failed to revoke trakt token")
+	}
+	return c.db.DeleteTraktToken(profileID)
+}
+
+// accessToken returns a valid access token for a profile, refreshing it when
+// it is about to expire.
+func (c *Client) accessToken(ctx context.Context, profileID int) (string, error) {
+	tok, err := c.db.GetTraktToken(profileID)
+	if err != nil {
+		return "", err
+	}
+	if tok == nil {
+		return "", ErrNotConnected
+	}
+	if time.Until(tok.ExpiresAt) > tokenRefreshMargin {
+		return tok.AccessToken, nil
+	}
+
+	body := map[string]string{
+		"refresh_token": tok.RefreshToken,
+		"client_id":     c.clientID,
+		"client_secret": c.clientSecret,
+		"redirect_uri":  "urn:ietf:wg:oauth:2.0:oob",
+		"grant_type":    "refresh_token",
+	}
+	var fresh tokenResponse
+	if _, err := c.do(ctx, http.MethodPost, "/oauth/token", "", body, &fresh); err != nil {
+		return "", fmt.Errorf("refresh trakt token: %w", err)
+	}
+	if err := c.db.SaveTraktToken(profileID, fresh.token()); err != nil {
+		return "", err
+	}
+	return fresh.AccessToken, nil
+}
+
+// do performs a Trakt API call, JSON-encoding body (if any) and decoding the
+// response into dest (if non-nil). token may be empty for OAuth endpoints.
+// The HTTP status is returned alongside errors for callers that branch on it.
+func (c *Client) do(ctx context.Context, method, path, token string, body, dest any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("trakt-api-version", "2")
+	req.Header.Set("trakt-api-key", c.clientID)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("trakt api returned status %d", resp.StatusCode)
+	}
+	if dest == nil || resp.StatusCode == http.StatusNoContent {
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return resp.StatusCode, fmt.Errorf("decode response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,74 @@
+package trakt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Scrobble actions.
+const (
+	ActionStart = "start"
+	ActionPause = "pause"
+	ActionStop  = "stop"
+)
+
+// scrobbleRefresh throttles repeated "start" scrobbles for the same movie.
+// Trakt keeps a started scrobble active until it is paused or stopped.
+const scrobbleRefresh = 5 * time.Minute
+
+type scrobbleKey struct {
+	profileID int
+	tmdbID    int
+}
+
+type scrobbleState struct {
+	action string
+	at     time.Time
+}
+
+// Scrobble reports playback of a movie to Trakt in the background. progress
+// is in percent. Duplicate events are dropped and profiles without a linked
+// account are ignored.
+func (c *Client) Scrobble(profileID, tmdbID int, progress float64, action string) {
+	key := scrobbleKey{profileID, tmdbID}
+
+	c.mu.Lock()
+	last := c.scrobbles[key]
+	if last.action == action && (action != ActionStart || time.Since(last.at) < scrobbleRefresh) {
+		c.mu.Unlock()
+		return
+	}
+	if action == ActionStop {
+		delete(c.scrobbles, key)
+	} else {
+		c.scrobbles[key] = scrobbleState{action: action, at: time.Now()}
+	}
+	c.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		token, err := c.accessToken(ctx, profileID)
+		if errors.Is(err, ErrNotConnected) {
+			return
+		}
+		if err != nil {
+			log.Warn().Err(err).Int("profile_id", profileID).Msg("trakt scrobble skipped")
+			return
+		}
+
+		body := map[string]any{
+			"movie":    map[string]any{"ids": map[string]int{"tmdb": tmdbID}},
+			"progress": progress,
+		}
+		status, err := c.do(ctx, http.MethodPost, "/scrobble/"+action, token, body, nil)
+		if err != nil && status != http.StatusConflict { // 409: already scrobbled
+			log.Warn().Err(err).Int("tmdb_id", tmdbID).Str("action", action).Msg("trakt scrobble failed")
+		}
+	}()
+}
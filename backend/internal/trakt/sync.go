@@ -0,0 +1,159 @@
+package trakt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/streambox/backend/internal/models"
+)
+
+type traktIDs struct {
+	TMDb int `json:"tmdb"`
+}
+
+type traktMedia struct {
+	Title string   `json:"title"`
+	Year  int      `json:"year"`
+	IDs   traktIDs `json:"ids"`
+}
+
+type traktRef struct {
+	IDs traktIDs `json:"ids"`
+}
+
+// Sync copies the watchlist and watched movies in both directions between a
+// profile and its Trakt account. Items are only ever added, never removed.
+func (c *Client) Sync(ctx context.Context, profileID int) (*models.TraktSyncResult, error) {
+	token, err := c.accessToken(ctx, profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &models.TraktSyncResult{}
+	if err := c.syncWatchlist(ctx, token, profileID, res); err != nil {
+		return nil, fmt.Errorf("sync watchlist: %w", err)
+	}
+	if err := c.syncHistory(ctx, token, profileID, res); err != nil {
+		return nil, fmt.Errorf("sync history: %w", err)
+	}
+	return res, nil
+}
+
+func (c *Client) syncWatchlist(ctx context.Context, token string, profileID int, res *models.TraktSyncResult) error {
+	var remote []struct {
+		Type  string      `json:"type"`
+		Movie *traktMedia `json:"movie"`
+		Show  *traktMedia `json:"show"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/sync/watchlist", token, nil, &remote); err != nil {
+		return err
+	}
+
+	local, err := c.db.GetWatchlist(profileID)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for _, w := range local {
+		have[fmt.Sprintf("%s:%d", w.MediaType, w.TMDbID)] = true
+	}
+
+	onTrakt := make(map[string]bool)
+	for _, r := range remote {
+		media, mediaType := r.Movie, "movie"
+		if r.Type == "show" {
+			media, mediaType = r.Show, "tv"
+		}
+		if media == nil || media.IDs.TMDb == 0 {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", mediaType, media.IDs.TMDb)
+		onTrakt[key] = true
+		if have[key] {
+			continue
+		}
+		err := c.db.AddToWatchlist(models.WatchlistItem{
+			ProfileID: profileID,
+			TMDbID:    media.IDs.TMDb,
+			MediaType: mediaType,
+			Title:     media.Title,
+			Year:      media.Year,
+		})
+		if err != nil {
+			return err
+		}
+		res.WatchlistPulled++
+	}
+
+	var movies, shows []traktRef
+	for _, w := range local {
+		if onTrakt[fmt.Sprintf("%s:%d", w.MediaType, w.TMDbID)] {
+			continue
+		}
+		ref := traktRef{IDs: traktIDs{TMDb: w.TMDbID}}
+		if w.MediaType == "tv" {
+			shows = append(shows, ref)
+		} else {
+			movies = append(movies, ref)
+		}
+	}
+	if len(movies)+len(shows) == 0 {
+		return nil
+	}
+	body := map[string][]traktRef{"movies": movies, "shows": shows}
+	if _, err := c.do(ctx, http.MethodPost, "/sync/watchlist", token, body, nil); err != nil {
+		return err
+	}
+	res.WatchlistPushed = len(movies) + len(shows)
+	return nil
+}
+
+func (c *Client) syncHistory(ctx context.Context, token string, profileID int, res *models.TraktSyncResult) error {
+	var remote []struct {
+		Movie traktMedia `json:"movie"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/sync/watched/movies", token, nil, &remote); err != nil {
+		return err
+	}
+
+	local, err := c.db.GetWatched(profileID)
+	if err != nil {
+		return err
+	}
+	have := make(map[int]bool)
+	for _, h := range local {
+		have[h.TMDbID] = true
+	}
+
+	onTrakt := make(map[int]bool)
+	for _, r := range remote {
+		id := r.Movie.IDs.TMDb
+		if id == 0 {
+			continue
+		}
+		onTrakt[id] = true
+		if have[id] {
+			continue
+		}
+		if err := c.db.MarkWatched(profileID, id, "movie", r.Movie.Title, r.Movie.Year); err != nil {
+			return err
+		}
+		res.HistoryPulled++
+	}
+
+	var movies []traktRef
+	for _, h := range local {
+		if !onTrakt[h.TMDbID] {
+			movies = append(movies, traktRef{IDs: traktIDs{TMDb: h.TMDbID}})
+		}
+	}
+	if len(movies) == 0 {
+		return nil
+	}
+	if _, err := c.do(ctx, http.MethodPost, "/sync/history", token, map[string][]traktRef{"movies": movies}, nil); err != nil {
+		return err
+	}
+	res.HistoryPushed = len(movies)
+	return nil
+}
@@ -1,14 +1,16 @@
 import { BrowserRouter, Routes, Route } from 'react-router-dom'
+import { BASE_PATH } from './api/client'
 import Layout from './components/layout/Layout'
 import HomePage from './pages/HomePage'
 import SearchPage from './pages/SearchPage'
 import MoviePage from './pages/MoviePage'
 import TVShowPage from './pages/TVShowPage'
 import PlayerPage from './pages/PlayerPage'
+import LoginPage from './pages/LoginPage'
 
 export default function App() {
   return (
-    <BrowserRouter>
+    <BrowserRouter basename={BASE_PATH || undefined}>
       <Routes>
         <Route element={<Layout />}>
           <Route path="/" element={<HomePage />} />
@@ -18,6 +20,7 @@ export default function App() {
         </Route>
         {/* PlayerPage is fullscreen, no layout */}
         <Route path="/watch/:sessionId" element={<PlayerPage />} />
+        <Route path="/login" element={<LoginPage />} />
       </Routes>
     </BrowserRouter>
   )
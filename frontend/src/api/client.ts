@@ -6,6 +6,9 @@ import type {
   StreamStatus,
   SubtitleResult,
   WatchHistory,
+  HistoryPage,
+  WatchStats,
+  SystemInfo,
   TVShow,
   TVShowSearchResult,
   Season,
@@ -13,9 +16,16 @@ import type {
   MediaSearchResult,
   TorrentFile,
   PopularItem,
+  NotificationList,
+  Calendar,
+  ClientCapabilities,
 } from '../types'
 
-const BASE = '/api'
+// BASE_PATH is the prefix the app is served under behind a reverse proxy;
+// the server sets it in index.html.
+export const BASE_PATH = (window as { __BASE_PATH__?: string }).__BASE_PATH__ ?? ''
+export const API_BASE = `${BASE_PATH}/api`
+const BASE = API_BASE
 
 async function request<T>(path: string, options?: RequestInit): Promise<T> {
   const res = await fetch(`${BASE}${path}`, {
@@ -24,6 +34,9 @@ async function request<T>(path: string, options?: RequestInit): Promise<T> {
     },
     ...options,
   })
+  if (res.status === 401 && !path.startsWith('/auth/')) {
+    redirectToLogin()
+  }
   if (!res.ok) {
     const text = await res.text().catch(() => res.statusText)
     throw new Error(`API error ${res.status}: ${text}`)
@@ -31,6 +44,35 @@ async function request<T>(path: string, options?: RequestInit): Promise<T> {
   return res.json()
 }
 
+function redirectToLogin() {
+  if (window.location.pathname === `${BASE_PATH}/login`) return
+  const next = window.location.pathname + window.location.search
+  window.location.assign(`${BASE_PATH}/login?next=${encodeURIComponent(next)}`)
+}
+
+// --- Auth ---
+
+export interface AuthStatus {
+  enabled: boolean
+  password_login: boolean
+  authenticated: boolean
+}
+
+export async function getAuthStatus(): Promise<AuthStatus> {
+  return request<AuthStatus>('/auth/status')
+}
+
+export async function login(username: string, password: string): Promise<void> {
+  await request('/auth/login', {
+    method: 'POST',
+    body: JSON.stringify({ username, password }),
+  })
+}
+
+export async function logout(): Promise<void> {
+  await request('/auth/logout', { method: 'POST' })
+}
+
 // --- Movies ---
 
 export async function searchMovies(query: string, page = 1): Promise<MovieSearchResult> {
@@ -109,9 +151,11 @@ export async function searchTVTorrents(
   title: string,
   season: number,
   year?: string,
+  episode?: number,
 ): Promise<TorrentResult[]> {
   const params = new URLSearchParams({ title, season: String(season) })
   if (year) params.set('year', year)
+  if (episode) params.set('episode', String(episode))
   const data = await request<{ results: TorrentResult[] }>(`/torrents/search/tv?${params}`)
   return data.results || []
 }
@@ -126,15 +170,82 @@ export async function listTorrentFiles(magnetUri: string): Promise<TorrentFile[]
 
 // --- Streaming ---
 
+// Probe strings for what this browser's <video> element can play, keyed by
+// the FFprobe names the server uses.
+const containerProbes: Record<string, string> = {
+  mp4: 'video/mp4',
+  webm: 'video/webm',
+  matroska: 'video/x-matroska',
+}
+const videoProbes: Record<string, string> = {
+  h264: 'video/mp4; codecs="avc1.640028"',
+  hevc: 'video/mp4; codecs="hvc1.1.6.L120.90"',
+  vp9: 'video/webm; codecs="vp9"',
+  vp8: 'video/webm; codecs="vp8"',
+  av1: 'video/mp4; codecs="av01.0.08M.08"',
+}
+const audioProbes: Record<string, string> = {
+  aac: 'audio/mp4; codecs="mp4a.40.2"',
+  mp3: 'audio/mpeg',
+  opus: 'audio/webm; codecs="opus"',
+  vorbis: 'audio/webm; codecs="vorbis"',
+  flac: 'audio/flac',
+  ac3: 'audio/mp4; codecs="ac-3"',
+  eac3: 'audio/mp4; codecs="ec-3"',
+}
+
+// detectCapabilities lists the containers and codecs this browser can play,
+// so the server can serve files directly instead of guessing by extension.
+export function detectCapabilities(): ClientCapabilities {
+  const video = document.createElement('video')
+  const supported = (probes: Record<string, string>) =>
+    Object.keys(probes).filter((name) => video.canPlayType(probes[name]) !== '')
+  return {
+    containers: supported(containerProbes),
+    video_codecs: supported(videoProbes),
+    audio_codecs: supported(audioProbes),
+  }
+}
+
 export async function startStream(
   tmdbId: number,
   title: string,
   magnetUri: string,
   fileIndex = -1,
+  release?: Pick<TorrentResult, 'provider' | 'quality' | 'topic_id'>,
 ): Promise<StreamSession> {
   return request<StreamSession>('/stream/start', {
     method: 'POST',
-    body: JSON.stringify({ tmdb_id: tmdbId, title, magnet_uri: magnetUri, file_index: fileIndex }),
+    body: JSON.stringify({
+      tmdb_id: tmdbId,
+      title,
+      magnet_uri: magnetUri,
+      file_index: fileIndex,
+      provider: release?.provider,
+      quality: release?.quality,
+      topic_id: release?.topic_id ? String(release.topic_id) : undefined,
+      capabilities: detectCapabilities(),
+    }),
+  })
+}
+
+// autoStream searches the title's torrents and streams the best one, in
+// the preferred quality where there is one.
+export async function autoStream(
+  tmdbId: number,
+  episode?: { season: number; episode: number },
+  quality?: string,
+): Promise<{ session: StreamSession; torrent: TorrentResult }> {
+  return request<{ session: StreamSession; torrent: TorrentResult }>('/stream/auto', {
+    method: 'POST',
+    body: JSON.stringify({
+      tmdb_id: tmdbId,
+      media_type: episode ? 'tv' : 'movie',
+      season: episode?.season,
+      episode: episode?.episode,
+      quality,
+      capabilities: detectCapabilities(),
+    }),
   })
 }
 
@@ -143,7 +254,12 @@ export function getStreamUrl(sessionId: string, seekTime?: number, audioTrack?:
   if (seekTime && seekTime > 0) params.set('t', seekTime.toFixed(3))
   if (audioTrack !== undefined && audioTrack >= 0) params.set('audio', String(audioTrack))
   const qs = params.toString()
-  return `/api/stream/${sessionId}${qs ? '?' + qs : ''}`
+  return `${BASE}/stream/${sessionId}${qs ? '?' + qs : ''}`
+}
+
+// Playlist for opening the stream in VLC, mpv or IINA without transcoding.
+export function getExternalPlayerUrl(sessionId: string): string {
+  return `${BASE}/stream/${sessionId}/playlist.m3u`
 }
 
 export async function getStreamStatus(sessionId: string): Promise<StreamStatus> {
@@ -156,18 +272,43 @@ export async function stopStream(sessionId: string): Promise<void> {
 
 // --- Subtitles ---
 
-export async function searchSubtitles(imdbId: string, lang = 'en'): Promise<SubtitleResult[]> {
-  return request<SubtitleResult[]>(`/subtitles/search?imdb_id=${encodeURIComponent(imdbId)}&lang=${lang}`)
+export async function searchSubtitles(imdbId: string, lang = 'en', sessionId?: string): Promise<SubtitleResult[]> {
+  const session = sessionId ? `&session=${encodeURIComponent(sessionId)}` : ''
+  const data = await request<{ results: SubtitleResult[] | null }>(`/subtitles/search?imdb_id=${encodeURIComponent(imdbId)}&lang=${lang}${session}`)
+  return data.results ?? []
+}
+
+export function getSubtitleUrl(id: string, sessionId?: string): string {
+  const session = sessionId ? `?session=${encodeURIComponent(sessionId)}` : ''
+  return `${BASE}/subtitles/download/${encodeURIComponent(id)}${session}`
 }
 
-export function getSubtitleUrl(fileId: number): string {
-  return `/api/subtitles/download/${fileId}`
+export async function setSubtitleOffset(sessionId: string, offsetMs: number): Promise<void> {
+  await request(`/stream/${sessionId}/subtitle-offset`, {
+    method: 'PUT',
+    body: JSON.stringify({ offset_ms: offsetMs }),
+  })
 }
 
 // --- Watch History ---
 
-export async function getHistory(): Promise<WatchHistory[]> {
-  return request<WatchHistory[]>('/history')
+export async function getHistory(
+  params: { page?: number; per_page?: number; completed?: boolean; media_type?: 'movie' | 'tv'; q?: string } = {},
+): Promise<HistoryPage> {
+  const query = new URLSearchParams()
+  for (const [key, value] of Object.entries(params)) {
+    if (value !== undefined && value !== '') query.set(key, String(value))
+  }
+  const qs = query.toString()
+  return request<HistoryPage>(`/history${qs ? '?' + qs : ''}`)
+}
+
+export async function getStats(year?: number): Promise<WatchStats> {
+  return request<WatchStats>(`/stats${year ? '?year=' + year : ''}`)
+}
+
+export async function getSystemInfo(): Promise<SystemInfo> {
+  return request<SystemInfo>('/system')
 }
 
 export async function getContinueWatching(): Promise<WatchHistory[]> {
@@ -193,6 +334,27 @@ export async function updateProgress(
   })
 }
 
-export async function deleteHistory(tmdbId: number): Promise<void> {
-  await fetch(`${BASE}/history/${tmdbId}`, { method: 'DELETE' })
+export async function deleteHistory(tmdbId: number, mediaType: 'movie' | 'tv' = 'movie'): Promise<void> {
+  await fetch(`${BASE}/history/${tmdbId}?media_type=${mediaType}`, { method: 'DELETE' })
+}
+
+export async function getNotifications(unreadOnly = false): Promise<NotificationList> {
+  return request<NotificationList>(`/notifications${unreadOnly ? '?unread=1' : ''}`)
+}
+
+export async function getUnreadNotifications(): Promise<number> {
+  const res = await request<{ unread: number }>('/notifications/unread')
+  return res.unread
+}
+
+export async function markNotificationsRead(ids: number[] = []): Promise<number> {
+  const res = await request<{ unread: number }>('/notifications/read', {
+    method: 'POST',
+    body: JSON.stringify({ ids }),
+  })
+  return res.unread
+}
+
+export async function getCalendar(days = 30): Promise<Calendar> {
+  return request<Calendar>(`/calendar?days=${days}`)
 }
@@ -1,4 +1,5 @@
 import { Link } from 'react-router-dom'
+import { API_BASE } from '../../api/client'
 import type { MediaItem } from '../../types'
 
 interface MediaCardProps {
@@ -9,7 +10,7 @@ export default function MediaCard({ item }: MediaCardProps) {
   const year = item.date ? new Date(item.date).getFullYear() : null
   const rating = item.vote_average ? item.vote_average.toFixed(1) : null
   const posterUrl = item.poster_path
-    ? `https://image.tmdb.org/t/p/w342${item.poster_path}`
+    ? `${API_BASE}/images/w342${item.poster_path}`
     : null
   const link = item.media_type === 'tv' ? `/tv/${item.id}` : `/movie/${item.id}`
 
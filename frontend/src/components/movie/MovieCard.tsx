@@ -1,4 +1,5 @@
 import { Link } from 'react-router-dom'
+import { API_BASE } from '../../api/client'
 import type { Movie } from '../../types'
 
 interface MovieCardProps {
@@ -9,7 +10,7 @@ export default function MovieCard({ movie }: MovieCardProps) {
   const year = movie.release_date ? new Date(movie.release_date).getFullYear() : null
   const rating = movie.vote_average ? movie.vote_average.toFixed(1) : null
   const posterUrl = movie.poster_path
-    ? `https://image.tmdb.org/t/p/w342${movie.poster_path}`
+    ? `${API_BASE}/images/w342${movie.poster_path}`
     : null
 
   return (
@@ -1,13 +1,13 @@
 import { useEffect, useState } from 'react'
 import { Link } from 'react-router-dom'
 import type { MediaItem, PopularItem, WatchHistory } from '../types'
-import { getTrendingAll, getPopularTV, getContinueWatching, getPopularHDRezka } from '../api/client'
+import { API_BASE, getTrendingAll, getPopularTV, getContinueWatching, getPopularHDRezka } from '../api/client'
 import MediaGrid from '../components/media/MediaGrid'
 import PopularCard from '../components/media/PopularCard'
 
 function ContinueWatchingCard({ item }: { item: WatchHistory }) {
   const posterUrl = item.poster_path
-    ? `https://image.tmdb.org/t/p/w342${item.poster_path}`
+    ? `${API_BASE}/images/w342${item.poster_path}`
     : null
 
   return (
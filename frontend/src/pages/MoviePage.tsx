@@ -1,7 +1,7 @@
 import { useEffect, useState } from 'react'
 import { useParams, useNavigate } from 'react-router-dom'
 import type { Movie, TorrentResult } from '../types'
-import { getMovieDetails, searchTorrents, startStream } from '../api/client'
+import { API_BASE, getMovieDetails, searchTorrents, startStream } from '../api/client'
 
 export default function MoviePage() {
   const { id } = useParams<{ id: string }>()
@@ -51,7 +51,7 @@ export default function MoviePage() {
     if (!movie) return
     try {
       setStreamLoading(torrent.magnet_uri)
-      const session = await startStream(movie.id, movie.title, torrent.magnet_uri)
+      const session = await startStream(movie.id, movie.title, torrent.magnet_uri, -1, torrent)
       const year = movie.release_date ? new Date(movie.release_date).getFullYear() : 0
       navigate(`/watch/${session.session_id}`, {
         state: {
@@ -112,10 +112,10 @@ export default function MoviePage() {
 
   const year = movie.release_date ? new Date(movie.release_date).getFullYear() : null
   const backdropUrl = movie.backdrop_path
-    ? `https://image.tmdb.org/t/p/w1280${movie.backdrop_path}`
+    ? `${API_BASE}/images/w1280${movie.backdrop_path}`
     : null
   const posterUrl = movie.poster_path
-    ? `https://image.tmdb.org/t/p/w342${movie.poster_path}`
+    ? `${API_BASE}/images/w342${movie.poster_path}`
     : null
 
   return (
@@ -1,6 +1,6 @@
 import { useEffect, useState, useRef, useCallback } from 'react'
 import { useParams, useNavigate, useLocation } from 'react-router-dom'
-import { getStreamUrl, getStreamStatus, stopStream, updateProgress, searchSubtitles, getSubtitleUrl } from '../api/client'
+import { API_BASE, getStreamUrl, getStreamStatus, stopStream, updateProgress, searchSubtitles, getSubtitleUrl } from '../api/client'
 import type { StreamSession, StreamStatus, SubtitleResult, AudioTrack } from '../types'
 
 interface MovieMeta {
@@ -48,7 +48,7 @@ export default function PlayerPage() {
   const [showSpeedMenu, setShowSpeedMenu] = useState(false)
   const [subtitles, setSubtitles] = useState<{ lang: string; results: SubtitleResult[] }[]>([])
   const [showSubMenu, setShowSubMenu] = useState(false)
-  const [activeSubtitle, setActiveSubtitle] = useState<number | null>(null)
+  const [activeSubtitle, setActiveSubtitle] = useState<string | null>(null)
   const [doubleTapSide, setDoubleTapSide] = useState<'left' | 'right' | null>(null)
   const [audioTracks, setAudioTracks] = useState<AudioTrack[]>([])
   const [selectedAudio, setSelectedAudio] = useState(-1)
@@ -103,7 +103,7 @@ export default function PlayerPage() {
         quality: movieMeta.quality || '',
         magnet_uri: movieMeta.magnet_uri || '',
       })
-      navigator.sendBeacon(`/api/history/${movieMeta.tmdb_id}`, new Blob([body], { type: 'application/json' }))
+      navigator.sendBeacon(`${API_BASE}/history/${movieMeta.tmdb_id}`, new Blob([body], { type: 'application/json' }))
     }
     window.addEventListener('beforeunload', onUnload)
     return () => window.removeEventListener('beforeunload', onUnload)
@@ -116,14 +116,14 @@ export default function PlayerPage() {
       const results: { lang: string; results: SubtitleResult[] }[] = []
       for (const lang of ['ru', 'en']) {
         try {
-          const subs = await searchSubtitles(movieMeta.imdb_id!, lang)
+          const subs = await searchSubtitles(movieMeta.imdb_id!, lang, sessionId)
           if (subs.length > 0) results.push({ lang, results: subs })
         } catch { /* ignore */ }
       }
       setSubtitles(results)
     }
     loadSubs()
-  }, [movieMeta?.imdb_id])
+  }, [movieMeta?.imdb_id, sessionId])
 
   // --- Poll stream status ---
   useEffect(() => {
@@ -137,7 +137,7 @@ export default function PlayerPage() {
         if (s.audio_tracks && s.audio_tracks.length > 0 && audioTracks.length === 0) {
           setAudioTracks(s.audio_tracks)
         }
-        if (s.status === 'ready' || s.buffered_percent >= 2) setReady(true)
+        if (s.status === 'ready') setReady(true)
       } catch { /* ignore */ }
     }
     poll()
@@ -395,8 +395,8 @@ export default function PlayerPage() {
     navigate(-1)
   }, [sessionId, navigate, saveProgress])
 
-  const selectSubtitle = useCallback((fileId: number | null) => {
-    setActiveSubtitle(fileId)
+  const selectSubtitle = useCallback((id: string | null) => {
+    setActiveSubtitle(id)
     setShowSubMenu(false)
     const video = videoRef.current
     if (!video) return
@@ -406,15 +406,15 @@ export default function PlayerPage() {
       if (track) track.remove()
       else break
     }
-    if (fileId !== null) {
+    if (id !== null) {
       const track = document.createElement('track')
       track.kind = 'subtitles'
-      track.src = getSubtitleUrl(fileId)
+      track.src = getSubtitleUrl(id, sessionId)
       track.default = true
       video.appendChild(track)
       if (video.textTracks[0]) video.textTracks[0].mode = 'showing'
     }
-  }, [])
+  }, [sessionId])
 
   // --- Format helpers ---
   const formatTime = (s: number) => {
@@ -482,6 +482,9 @@ export default function PlayerPage() {
                 <p>Downloaded: {status.buffered_percent.toFixed(1)}%</p>
                 {status.download_speed > 0 && <p>Speed: {formatSpeed(status.download_speed)}</p>}
                 <p>Peers: {status.peers_connected}</p>
+                {status.start_buffer?.time_to_play !== undefined && (
+                  <p>Starting in ~{Math.ceil(status.start_buffer.time_to_play)}s</p>
+                )}
               </div>
             )}
           </div>
@@ -635,8 +638,8 @@ export default function PlayerPage() {
                       Off
                     </button>
                     {subtitles.map(({ lang, results }) => (
-                      <button key={lang} onClick={() => selectSubtitle(results[0].file_id)}
-                        className={`block w-full text-left px-3 py-1.5 text-sm transition-colors ${activeSubtitle === results[0].file_id ? 'text-indigo-400 bg-zinc-800' : 'text-white hover:bg-zinc-800'}`}>
+                      <button key={lang} onClick={() => selectSubtitle(results[0].id)}
+                        className={`block w-full text-left px-3 py-1.5 text-sm transition-colors ${activeSubtitle === results[0].id ? 'text-indigo-400 bg-zinc-800' : 'text-white hover:bg-zinc-800'}`}>
                         {lang === 'ru' ? 'Russian' : 'English'} ({results[0].name})
                       </button>
                     ))}
@@ -1,7 +1,7 @@
 import { useEffect, useState } from 'react'
 import { useParams, useNavigate } from 'react-router-dom'
 import type { TVShow, Season, Episode, TorrentResult, TorrentFile } from '../types'
-import { getTVDetails, getSeasonDetails, searchTVTorrents, listTorrentFiles, startStream } from '../api/client'
+import { API_BASE, getTVDetails, getSeasonDetails, searchTVTorrents, listTorrentFiles, startStream } from '../api/client'
 
 export default function TVShowPage() {
   const { id } = useParams<{ id: string }>()
@@ -80,7 +80,7 @@ export default function TVShowPage() {
     if (!show) return
     try {
       setStreamLoading(torrent.magnet_uri)
-      const session = await startStream(show.id, show.name, torrent.magnet_uri, fileIndex)
+      const session = await startStream(show.id, show.name, torrent.magnet_uri, fileIndex, torrent)
       const year = show.first_air_date ? new Date(show.first_air_date).getFullYear() : 0
       navigate(`/watch/${session.session_id}`, {
         state: {
@@ -156,10 +156,10 @@ export default function TVShowPage() {
 
   const year = show.first_air_date ? new Date(show.first_air_date).getFullYear() : null
   const backdropUrl = show.backdrop_path
-    ? `https://image.tmdb.org/t/p/w1280${show.backdrop_path}`
+    ? `${API_BASE}/images/w1280${show.backdrop_path}`
     : null
   const posterUrl = show.poster_path
-    ? `https://image.tmdb.org/t/p/w342${show.poster_path}`
+    ? `${API_BASE}/images/w342${show.poster_path}`
     : null
   const realSeasons = (show.seasons || []).filter(s => s.season_number > 0)
 
@@ -244,7 +244,7 @@ export default function TVShowPage() {
                 <div key={ep.id} className="flex gap-4 p-3 rounded-lg bg-zinc-900 border border-zinc-800">
                   {ep.still_path ? (
                     <img
-                      src={`https://image.tmdb.org/t/p/w300${ep.still_path}`}
+                      src={`${API_BASE}/images/w300${ep.still_path}`}
                       alt={ep.name}
                       className="w-32 h-18 object-cover rounded flex-shrink-0"
                       loading="lazy"
@@ -35,6 +35,23 @@ export interface TorrentResult {
   audio: string
   source: string
   topic_id: number
+  group?: string
+  video_codec?: string
+  resolution?: string
+  audio_tracks?: string[]
+  translation?: string
+  score: number
+  mismatch?: ('year' | 'title' | 'fan_edit')[]
+  pack?: 'episode' | 'season_pack' | 'complete_series'
+}
+
+export interface ProviderStatus {
+  provider: string
+  status: 'ok' | 'error' | 'timeout' | 'skipped'
+  results: number
+  duration_ms: number
+  error?: string
+  retry_after?: string
 }
 
 export interface AudioTrack {
@@ -43,6 +60,19 @@ export interface AudioTrack {
   title: string
 }
 
+export interface Chapter {
+  title: string
+  start: number
+  end: number
+}
+
+export interface SkipMarker {
+  type: 'intro' | 'credits'
+  start: number
+  end: number
+  source: 'chapter' | 'detected'
+}
+
 export interface StreamSession {
   session_id: string
   tmdb_id: number
@@ -53,9 +83,24 @@ export interface StreamSession {
   file_size: number
   content_type: string
   needs_transcode: boolean
+  play_method: 'direct' | 'remux' | 'audio_transcode' | 'transcode'
+  play_reason?: string
+  container?: string
+  video_codec?: string
+  video_bit_depth?: number
+  audio_codec?: string
+  transcode_audio?: boolean
   status: string
   duration: number
   audio_tracks?: AudioTrack[]
+  resume_position?: number
+  start_position?: number
+}
+
+export interface ClientCapabilities {
+  containers: string[]
+  video_codecs: string[]
+  audio_codecs: string[]
 }
 
 export interface StreamStatus {
@@ -67,11 +112,32 @@ export interface StreamStatus {
   buffered_percent: number
   duration: number
   audio_tracks?: AudioTrack[]
+  chapters?: Chapter[]
+  skip_markers?: SkipMarker[]
+  metadata?: MetadataProgress
+  start_buffer?: StartBufferStatus
+}
+
+export interface StartBufferStatus {
+  seconds: number
+  needed_bytes: number
+  missing_bytes: number
+  waiting_index?: boolean
+  time_to_play?: number
+}
+
+export interface MetadataProgress {
+  elapsed_sec: number
+  timeout_sec: number
+  peers_connected: number
+  peers_known: number
+  error?: string
 }
 
 export interface WatchHistory {
   id: number
   tmdb_id: number
+  media_type: 'movie' | 'tv'
   title: string
   poster_path: string
   year: number
@@ -84,11 +150,63 @@ export interface WatchHistory {
   updated_at: string
 }
 
+export interface HistoryPage {
+  page: number
+  per_page: number
+  total_pages: number
+  total_results: number
+  results: WatchHistory[]
+}
+
+export interface PeriodStat {
+  period: string
+  hours: number
+  titles: number
+}
+
+export interface WatchStats {
+  from?: string
+  to?: string
+  hours: number
+  titles_started: number
+  titles_completed: number
+  completion_rate: number
+  weekly: PeriodStat[]
+  monthly: PeriodStat[]
+  top_genres: { genre: string; hours: number; titles: number }[]
+  top_titles: {
+    tmdb_id: number
+    media_type: 'movie' | 'tv'
+    title: string
+    poster_path: string
+    hours: number
+    completed: boolean
+  }[]
+}
+
+export interface SystemInfo {
+  started_at: string
+  uptime_seconds: number
+  go_version: string
+  disk: { path: string; used_bytes: number; limit_bytes: number; free_bytes: number }
+  database: { driver: 'sqlite' | 'postgres'; size_bytes: number; schema_version: number }
+  memory: { heap_alloc_bytes: number; sys_bytes: number; goroutines: number; gc_cycles: number }
+  active_sessions: number
+  library: {
+    profiles: number
+    history_entries: number
+    watchlist_items: number
+    downloads: Record<string, number>
+  }
+}
+
 export interface SubtitleResult {
-  file_id: number
+  id: string
+  provider: string
   language: string
   name: string
   downloads: number
+  hash_match: boolean
 }
 
 // --- External Popular ---
@@ -172,4 +290,46 @@ export interface TorrentFile {
   path: string
   size: number
   size_human: string
+  season?: number
+  episode?: number
+  label?: string
+}
+
+export interface Notification {
+  id: number
+  profile_id: number
+  type: string
+  tmdb_id: number
+  title: string
+  season?: number
+  episode?: number
+  message: string
+  poster_path: string
+  air_date?: string
+  read: boolean
+  created_at: string
+}
+
+export interface NotificationList {
+  notifications: Notification[]
+  unread: number
+}
+
+export interface CalendarEntry {
+  date: string
+  media_type: 'movie' | 'tv'
+  tmdb_id: number
+  title: string
+  poster_path: string
+  season?: number
+  episode?: number
+  episode_name?: string
+  release?: string
+  country?: string
+}
+
+export interface Calendar {
+  from: string
+  to: string
+  days: { date: string; entries: CalendarEntry[] }[]
 }